@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"password-manager/internal/storage"
+	"password-manager/internal/suggest"
+	"password-manager/internal/tui"
+)
+
+// resolveAccount returns the entry name that get and copy read for name
+// and --username. An entry called name is taken as it is unless a
+// username is given; otherwise name is taken as a site, or as the entry
+// whose site to look on, and the accounts there are picked by username.
+// When that leaves more than one account, the error lists them.
+func resolveAccount(name, username string) (string, error) {
+	entries, err := database.ListMetadata()
+	if err != nil {
+		return "", err
+	}
+	site := name
+	for _, named := range entries {
+		if named.Name != name {
+			continue
+		}
+		if username == "" || (named.URL == "" && strings.EqualFold(named.Username, username)) {
+			return name, nil
+		}
+		if named.URL == "" {
+			return "", fmt.Errorf("'%s' has username %s, not %s", name, displayUsername(named.Username), username)
+		}
+		site = named.URL
+	}
+
+	accounts, err := database.FindByURL(site)
+	if err != nil {
+		return "", err
+	}
+	host := suggest.Host(site)
+	if username != "" {
+		var matching []*storage.PasswordEntry
+		for _, entry := range accounts {
+			if strings.EqualFold(entry.Username, username) {
+				matching = append(matching, entry)
+			}
+		}
+		if len(matching) == 0 && len(accounts) > 0 {
+			return "", fmt.Errorf("no account for %s with username %s; there are:\n%s", host, username, accountList(accounts))
+		}
+		if len(matching) == 0 {
+			return "", fmt.Errorf("no account for %s with username %s", name, username)
+		}
+		accounts = matching
+	}
+	switch len(accounts) {
+	case 0:
+		// Not a site either: the lookup by name reports it
+		return name, nil
+	case 1:
+		return accounts[0].Name, nil
+	}
+	return "", fmt.Errorf("%d accounts for %s; pick one with --username:\n%s", len(accounts), host, accountList(accounts))
+}
+
+// accountList lists accounts one per line, username first
+func accountList(accounts []*storage.PasswordEntry) string {
+	width := 0
+	for _, entry := range accounts {
+		width = max(width, len(displayUsername(entry.Username)))
+	}
+	var b strings.Builder
+	for _, entry := range accounts {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, displayUsername(entry.Username), entry.Name)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// displayUsername stands in for an empty username
+func displayUsername(username string) string {
+	if username == "" {
+		return "(no username)"
+	}
+	return username
+}
+
+// printGroupedByHost lists entries under the host of their URL, with the
+// username of each account first. Entries without a URL come last.
+func printGroupedByHost(entries []*storage.PasswordEntry, color bool) {
+	groups := make(map[string][]*storage.PasswordEntry)
+	var hosts []string
+	for _, entry := range entries {
+		host := suggest.Host(entry.URL)
+		if _, ok := groups[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		groups[host] = append(groups[host], entry)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if (hosts[i] == "") != (hosts[j] == "") {
+			return hosts[j] == ""
+		}
+		return hosts[i] < hosts[j]
+	})
+
+	for i, host := range hosts {
+		if i > 0 {
+			fmt.Println()
+		}
+		accounts := groups[host]
+		heading := host
+		if heading == "" {
+			heading = "(no URL)"
+		}
+		fmt.Printf("%s (%d)\n", heading, len(accounts))
+		width := 0
+		for _, entry := range accounts {
+			width = max(width, len(displayUsername(entry.Username)))
+		}
+		for _, entry := range accounts {
+			fmt.Printf("  %-*s  %s%s%s\n", width, displayUsername(entry.Username),
+				tui.EntryIcon(entry.Name, entry.Icon, color), entry.Name, recipientMarker(entry))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+func TestAccountList(t *testing.T) {
+	got := accountList([]*storage.PasswordEntry{
+		{Name: "google-work", Username: "work@corp.com"},
+		{Name: "google-old"},
+	})
+	want := "  work@corp.com  google-work\n  (no username)  google-old"
+	if got != want {
+		t.Errorf("accountList =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseListArgsGroupBy(t *testing.T) {
+	opts, err := parseListArgs([]string{"--long", "--group-by=url"})
+	if err != nil || opts.groupBy != "url" || !opts.long {
+		t.Errorf("parseListArgs = %+v, %v", opts, err)
+	}
+	if opts, err := parseListArgs([]string{"--long"}); err != nil || opts.groupBy != "" {
+		t.Errorf("Expected no grouping without --group-by, got %+v, %v", opts, err)
+	}
+	for _, args := range [][]string{
+		{"--group-by", "tag"},
+		{"--group-by", "url", "--template", "{{.Name}}"},
+		{"--group-by", "url", "--json"},
+		{"--tag"},
+		{"--bogus"},
+		{"gmail"},
+	} {
+		if _, err := parseListArgs(args); err == nil {
+			t.Errorf("Expected parseListArgs(%q) to fail", args)
+		}
+	}
+}
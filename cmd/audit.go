@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/query"
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+)
+
+// handleAudit reports the weak, reused and stale passwords, of the
+// entries matching --where if given, and exits with status 1 if there are
+// any, so it can run from cron. Findings acknowledged with 'audit ack' are
+// listed apart, in gray, or left out with --hide-acked.
+func handleAudit() {
+	if len(os.Args) > 2 {
+		switch os.Args[2] {
+		case "ack":
+			handleAuditAck(os.Args[3:])
+			return
+		case "unack":
+			handleAuditUnack(os.Args[3:])
+			return
+		case "acks":
+			handleAuditAcks(os.Args[3:])
+			return
+		}
+	}
+
+	opts, err := parseAuditArgs(os.Args[2:])
+	if err != nil {
+		failFlags(auditFlags(&auditOptions{}), err, auditUsage())
+	}
+	if opts.misplacedSecrets {
+		handleMisplacedSecrets(opts.fix, opts.json)
+		return
+	}
+	if opts.where != nil {
+		entries, err := queryEntries(opts.where)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		opts.Only = make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			opts.Only[entry.Name] = true
+		}
+	}
+	report, err := database.Audit(opts.AuditOptions)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if opts.hideAcked {
+		report.Acknowledged = []storage.AckedFinding{}
+	}
+	if opts.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		writeAuditReport(os.Stdout, report, opts.AuditOptions, tui.ColorEnabled(false))
+	}
+	if report.Problems() > 0 {
+		exit(1)
+	}
+}
+
+// auditUsage returns the usage lines of audit and its subcommands
+func auditUsage() string {
+	return os.Args[0] + " audit [--max-age <days>] [--hide-acked] [--where <expr>] [--json]\n" +
+		"       " + os.Args[0] + " audit --misplaced-secrets [--fix | --json]\n" +
+		"       " + os.Args[0] + " audit ack <name> --reason <text> [--finding <finding>] [--until <date>]\n" +
+		"       " + os.Args[0] + " audit unack <name> [--finding <finding>]\n" +
+		"       " + os.Args[0] + " audit acks"
+}
+
+// auditOptions are the arguments of audit without a subcommand
+type auditOptions struct {
+	storage.AuditOptions
+	maxAgeDays                             int
+	whereExpr                              string
+	hideAcked, json, misplacedSecrets, fix bool
+	where                                  *query.Query
+}
+
+// auditFlags returns the flag set of audit, filling opts
+func auditFlags(opts *auditOptions) *flag.FlagSet {
+	fs := newFlagSet("audit")
+	fs.IntVar(&opts.maxAgeDays, "max-age", int(storage.DefaultAuditMaxAge/(24*time.Hour)), "report passwords unchanged for more than `days`; 0 leaves staleness unchecked")
+	fs.BoolVar(&opts.hideAcked, "hide-acked", false, "leave acknowledged findings out")
+	fs.StringVar(&opts.whereExpr, "where", "", "audit only the entries matching `expr`")
+	fs.BoolVar(&opts.json, "json", false, "print JSON to script against")
+	fs.BoolVar(&opts.misplacedSecrets, "misplaced-secrets", false, "find secrets kept outside the password instead")
+	fs.BoolVar(&opts.fix, "fix", false, "offer to move each misplaced secret to the password")
+	return fs
+}
+
+// parseAuditArgs reads the options of audit
+func parseAuditArgs(args []string) (*auditOptions, error) {
+	opts := &auditOptions{}
+	fs := auditFlags(opts)
+	rest, err := parseFlags(fs, args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	given := flagsGiven(fs)
+	if opts.where, err = parseWhere(opts.whereExpr, given["where"]); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.maxAgeDays < 0:
+		return nil, fmt.Errorf("--max-age must be a number of days, not %d", opts.maxAgeDays)
+	case opts.fix && !opts.misplacedSecrets:
+		return nil, fmt.Errorf("--fix needs --misplaced-secrets")
+	case opts.misplacedSecrets && (given["max-age"] || opts.hideAcked || opts.where != nil):
+		return nil, fmt.Errorf("--misplaced-secrets cannot be combined with --max-age, --hide-acked or --where")
+	case opts.fix && opts.json:
+		return nil, fmt.Errorf("--fix asks about each finding and cannot be combined with --json")
+	}
+	// 0 leaves staleness unchecked
+	opts.MaxAge = time.Duration(opts.maxAgeDays) * 24 * time.Hour
+	return opts, nil
+}
+
+// writeAuditReport prints the findings of report grouped by kind, with
+// counts, and the acknowledged findings after them, in gray if color is
+// set
+func writeAuditReport(w io.Writer, report *storage.AuditReport, opts storage.AuditOptions, color bool) {
+	if len(report.Weak) > 0 {
+		fmt.Fprintf(w, "Weak passwords (%d):\n", len(report.Weak))
+		for _, weak := range report.Weak {
+			fmt.Fprintf(w, "  %-30s %s\n", weak.Name, weak.Level)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Reused) > 0 {
+		fmt.Fprintf(w, "Reused passwords (%d groups):\n", len(report.Reused))
+		for _, group := range report.Reused {
+			fmt.Fprintf(w, "  %s\n", strings.Join(group.Names, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Stale) > 0 {
+		fmt.Fprintf(w, "Stale passwords, unchanged for over %d days (%d):\n", int(opts.MaxAge.Hours()/24), len(report.Stale))
+		for _, stale := range report.Stale {
+			fmt.Fprintf(w, "  %-30s last changed %s (%d days ago)\n", stale.Name, stale.UpdatedAt.Local().Format("2006-01-02"), stale.Days)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if problems := report.Problems(); problems == 0 {
+		fmt.Fprintf(w, "No problems found in %d entries.\n", report.Checked)
+	} else {
+		fmt.Fprintf(w, "%d weak, %d reused groups, %d stale in %d entries.\n",
+			len(report.Weak), len(report.Reused), len(report.Stale), report.Checked)
+	}
+	if len(report.Acknowledged) == 0 {
+		return
+	}
+
+	muted := func(text string) string {
+		if color {
+			return tui.Colorize(text, "gray")
+		}
+		return text
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, muted(fmt.Sprintf("Acknowledged (%d):", len(report.Acknowledged))))
+	for _, acked := range report.Acknowledged {
+		ack := &storage.Ack{Finding: acked.Finding, Reason: acked.Reason}
+		if acked.Until != nil {
+			ack.Until = *acked.Until
+		}
+		fmt.Fprintln(w, muted(fmt.Sprintf("  %-30s %s", acked.Name, describeAck(ack))))
+	}
+}
+
+// entryFindings returns the findings the audit has for the entry called
+// name, acknowledged or not
+func entryFindings(name string) ([]string, error) {
+	report, err := database.Audit(storage.AuditOptions{MaxAge: storage.DefaultAuditMaxAge})
+	if err != nil {
+		return nil, err
+	}
+	var findings []string
+	for _, weak := range report.Weak {
+		if weak.Name == name {
+			findings = append(findings, storage.FindingWeak)
+		}
+	}
+	for _, group := range report.Reused {
+		if slices.Contains(group.Names, name) {
+			findings = append(findings, storage.FindingReused)
+		}
+	}
+	for _, stale := range report.Stale {
+		if stale.Name == name {
+			findings = append(findings, storage.FindingStale)
+		}
+	}
+	for _, acked := range report.Acknowledged {
+		if acked.Name == name && !slices.Contains(findings, acked.Finding) {
+			findings = append(findings, acked.Finding)
+		}
+	}
+	return findings, nil
+}
+
+// describeAck summarizes an ack for listings
+func describeAck(ack *storage.Ack) string {
+	text := ack.Finding + ": " + ack.Reason
+	if !ack.Until.IsZero() {
+		text += " (until " + ack.Until.Format("2006-01-02") + ")"
+	}
+	return text
+}
+
+// handleAuditAck acknowledges the findings of an entry. Without --finding
+// every current finding of the entry is acknowledged.
+func handleAuditAck(args []string) {
+	opts, err := parseAuditAckArgs(args)
+	if err != nil {
+		failFlags(auditAckFlags(&auditAckOptions{}), err, os.Args[0]+" audit ack <name> --reason <text> [--finding <finding>] [--until <date>]")
+	}
+	name, reason, finding, untilValue := opts.name, opts.reason, opts.finding, opts.until
+
+	now := time.Now()
+	var until time.Time
+	if untilValue != "" {
+		spec, err := duration.Parse(untilValue, duration.Expiry)
+		if err == nil && !spec.After(now).After(now) {
+			err = fmt.Errorf("%s is in the past", untilValue)
+		}
+		if err != nil {
+			printError(fmt.Errorf("invalid --until: %w", err))
+			exit(1)
+		}
+		until = spec.After(now)
+	}
+
+	findings := []string{finding}
+	if finding == "" {
+		if _, err := database.GetPassword(name); err != nil {
+			printError(err)
+			exit(1)
+		}
+		var err error
+		if findings, err = entryFindings(name); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if len(findings) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: '%s' has no audit findings; pass --finding to acknowledge one (%s)\n",
+				name, strings.Join(storage.Findings, ", "))
+			exit(1)
+		}
+	}
+
+	for _, finding := range findings {
+		if err := database.AckFinding(name, finding, reason, until); err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Printf("Acknowledged %s for '%s' until its password changes", finding, name)
+		if !until.IsZero() {
+			fmt.Printf(" or %s", until.Format("2006-01-02"))
+		}
+		fmt.Println(".")
+	}
+}
+
+// auditAckOptions are the arguments of audit ack
+type auditAckOptions struct {
+	name, reason, finding, until string
+}
+
+// auditAckFlags returns the flag set of audit ack, filling opts
+func auditAckFlags(opts *auditAckOptions) *flag.FlagSet {
+	fs := newFlagSet("audit ack")
+	fs.StringVar(&opts.reason, "reason", "", "why the finding is accepted, as `text`")
+	fs.StringVar(&opts.finding, "finding", "", "the `finding` to acknowledge: "+strings.Join(storage.Findings, ", ")+"; all of the entry's by default")
+	fs.StringVar(&opts.until, "until", "", "let the acknowledgement lapse at a `date` or after a span such as 90d")
+	return fs
+}
+
+// parseAuditAckArgs reads the arguments of audit ack. All positional
+// arguments form the name, and a reason is needed.
+func parseAuditAckArgs(args []string) (*auditAckOptions, error) {
+	opts := &auditAckOptions{}
+	words, err := parseFlags(auditAckFlags(opts), args)
+	if err != nil {
+		return nil, err
+	}
+	opts.name = strings.Join(words, " ")
+	switch {
+	case opts.name == "":
+		return nil, fmt.Errorf("a name is needed")
+	case strings.TrimSpace(opts.reason) == "":
+		return nil, fmt.Errorf("--reason is needed")
+	}
+	return opts, nil
+}
+
+// handleAuditUnack withdraws the acks of an entry, or the one of a finding
+func handleAuditUnack(args []string) {
+	name, finding, err := parseAuditUnackArgs(args)
+	if err != nil {
+		failFlags(auditUnackFlags(new(string)), err, os.Args[0]+" audit unack <name> [--finding <finding>]")
+	}
+
+	removed, err := database.Unack(name, finding)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if removed == 0 {
+		fmt.Fprintf(os.Stderr, "Error: '%s' has no acknowledged findings to withdraw\n", name)
+		exit(1)
+	}
+	fmt.Printf("Withdrew %d acknowledgement(s) of '%s'.\n", removed, name)
+}
+
+// auditUnackFlags returns the flag set of audit unack, filling finding
+func auditUnackFlags(finding *string) *flag.FlagSet {
+	fs := newFlagSet("audit unack")
+	fs.StringVar(finding, "finding", "", "the `finding` whose acknowledgement to withdraw; all of the entry's by default")
+	return fs
+}
+
+// parseAuditUnackArgs reads the arguments of audit unack: the name, made
+// of all positional arguments, and the finding of --finding
+func parseAuditUnackArgs(args []string) (name, finding string, err error) {
+	words, err := parseFlags(auditUnackFlags(&finding), args)
+	if err != nil {
+		return "", "", err
+	}
+	if name = strings.Join(words, " "); name == "" {
+		return "", "", fmt.Errorf("a name is needed")
+	}
+	return name, finding, nil
+}
+
+// handleAuditAcks lists the acks still in force
+func handleAuditAcks(args []string) {
+	if err := parseNoArgs(args); err != nil {
+		failFlags(nil, err, os.Args[0]+" audit acks")
+	}
+	if database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+
+	acks, err := database.Acks(time.Now())
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if len(acks) == 0 {
+		fmt.Println("No acknowledged findings.")
+		return
+	}
+	for i := range acks {
+		fmt.Printf("%-30s %s\n", acks[i].Name, describeAck(&acks[i]))
+		fmt.Printf("%-30s acknowledged %s\n", "", formatTime(acks[i].AckedAt, false))
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"password-manager/internal/autotype"
+
+	"golang.org/x/term"
+)
+
+// autotypeDelay is how long the user has to focus the target window
+const autotypeDelay = 3
+
+// autotypeOptions are the arguments of autotype
+type autotypeOptions struct {
+	name, sequence      string
+	hasSequence, dryRun bool
+}
+
+// autotypeFlags returns the flag set of autotype, filling opts
+func autotypeFlags(opts *autotypeOptions) *flag.FlagSet {
+	fs := newFlagSet("autotype")
+	fs.StringVar(&opts.sequence, "sequence", "", "what to type, as a `sequence` such as '{username}{TAB}{password}{ENTER}'; kept as the entry's default")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "show what would be typed without typing it")
+	return fs
+}
+
+// parseAutotypeArgs reads the arguments of autotype. All positional
+// arguments form the name; a sequence given is checked before the vault
+// is opened.
+func parseAutotypeArgs(args []string) (*autotypeOptions, error) {
+	opts := &autotypeOptions{}
+	fs := autotypeFlags(opts)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if opts.name = strings.Join(words, " "); opts.name == "" {
+		return nil, fmt.Errorf("a name is needed")
+	}
+	if opts.hasSequence = flagsGiven(fs)["sequence"]; opts.hasSequence {
+		if _, err := autotype.Parse(opts.sequence); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// handleAutotype types an entry's credentials into the focused window
+func handleAutotype() {
+	opts, err := parseAutotypeArgs(os.Args[2:])
+	if err != nil {
+		failFlags(autotypeFlags(&autotypeOptions{}), err, os.Args[0]+" autotype [--sequence '<sequence>'] [--dry-run] [--] <name>")
+	}
+	name, sequence, hasSequence, dryRun := opts.name, opts.sequence, opts.hasSequence, opts.dryRun
+
+	entry, err := database.GetPassword(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	if !hasSequence {
+		if sequence, err = database.AutotypeSequence(entry.Name); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if sequence == "" {
+			sequence = autotype.DefaultSequence
+		}
+	}
+	steps, err := autotype.Parse(sequence)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if database.IsViewer() && autotype.UsesField(steps, "password") {
+		fmt.Fprintf(os.Stderr, "Error: passwords are redacted in viewer sessions\n")
+		exit(1)
+	}
+
+	// A sequence given on the command line becomes the entry's default
+	if hasSequence && !dryRun {
+		if err := database.SetAutotypeSequence(entry.Name, sequence); err != nil {
+			printError(fmt.Errorf("failed to save sequence: %w", err))
+			exit(1)
+		}
+	}
+
+	values := map[string]string{
+		"name":     entry.Name,
+		"username": entry.Username,
+		"password": entry.Password,
+		"url":      entry.URL,
+		"notes":    entry.Notes,
+	}
+
+	if dryRun {
+		var recorder autotype.DryRun
+		autotype.Run(&recorder, steps, values)
+		for _, event := range recorder.Events {
+			if event.Key != "" {
+				fmt.Printf("key  %s\n", event.Key)
+			} else {
+				fmt.Printf("type %d characters\n", len([]rune(event.Text)))
+			}
+		}
+		return
+	}
+
+	injector, err := autotype.NewInjector()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	abort, restore := watchEscape()
+	started := autotype.Countdown(autotypeDelay, func(remaining int) {
+		fmt.Printf("\rFocus the target window, typing in %d... (Esc to cancel) ", remaining)
+	}, abort)
+	restore()
+	if !started {
+		fmt.Println("\nAutotype cancelled.")
+		exit(1)
+	}
+	fmt.Println()
+
+	if err := autotype.Run(injector, steps, values); err != nil {
+		printError(err)
+		exit(1)
+	}
+}
+
+// watchEscape returns a channel closed when Esc (or Ctrl-C) is pressed in
+// the terminal, and a function restoring the terminal afterwards. Once
+// focus moves to another window the keypress goes there, so this only
+// works while the terminal still has focus.
+func watchEscape() (<-chan struct{}, func()) {
+	abort := make(chan struct{})
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return abort, func() {}
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return abort, func() {}
+	}
+
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				return
+			}
+			if buf[0] == 0x1b || buf[0] == 0x03 {
+				close(abort)
+				return
+			}
+		}
+	}()
+	return abort, func() { term.Restore(fd, state) }
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"password-manager/internal/backup"
+	"password-manager/internal/filter"
+	"password-manager/internal/query"
+	"password-manager/internal/storage"
+)
+
+// handleBackup dispatches the backup subcommands
+func handleBackup() {
+	switch {
+	case len(os.Args) > 2 && os.Args[2] == "create":
+		handleBackupCreate()
+	case len(os.Args) > 2 && os.Args[2] == "diff":
+		handleBackupDiff()
+	case len(os.Args) > 2 && os.Args[2] == "info":
+		handleBackupInfo()
+	default:
+		failFlags(nil, subcommandError("backup", os.Args[2:]), backupCreateUsage()+"\n       "+backupDiffUsage()+"\n       "+backupInfoUsage())
+	}
+}
+
+// handleBackupCreate writes an encrypted backup of the vault, or of the
+// entries matching --tag and --match filters, with a health summary of
+// the vault. --public-health also stores the summary in plaintext.
+func handleBackupCreate() {
+	opts, err := parseBackupCreateArgs(os.Args[3:])
+	if err != nil {
+		failFlags(backupCreateFlags(&backupCreateOptions{}), err, backupCreateUsage())
+	}
+	path, entryFilter, where := opts.path, opts.filter, opts.where
+
+	if database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+
+	passphrase, err := askNewPassphrase(newTerminalPrompter(), "Backup")
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	entries, err := database.ListPasswords()
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	entries = entryFilter.Apply(entries)
+	if entries, err = applyWhere(where, entries); err != nil {
+		printError(err)
+		exit(1)
+	}
+	description := entryFilter.String()
+	if where != nil {
+		if description != "" {
+			description += " AND "
+		}
+		description += "where " + where.String()
+	}
+	if len(entries) == 0 && description != "" {
+		fmt.Fprintf(os.Stderr, "Error: no entries match %s\n", description)
+		exit(1)
+	}
+	for _, entry := range entries {
+		if entry.Locked {
+			fmt.Fprintf(os.Stderr, "Warning: '%s' is encrypted to recipients you hold no identity for; its password is not in the backup\n", entry.Name)
+		}
+	}
+	grades, err := database.StrengthGrades()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	b := &backup.Backup{
+		Filter:       description,
+		Entries:      entries,
+		Health:       backup.NewHealth(entries, grades, version),
+		PublicHealth: opts.publicHealth,
+	}
+	if err := backup.Write(path, b, passphrase); err != nil {
+		printError(err)
+		exit(1)
+	}
+	// For the digest of other devices; the backup itself is done
+	if err := database.RecordBackup(time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if description == "" {
+		fmt.Printf("Backed up %d entries to %s\n", len(entries), path)
+	} else {
+		fmt.Printf("Backed up %d entries matching %s to %s (partial backup)\n", len(entries), description, path)
+	}
+}
+
+// backupCreateUsage returns the usage line of backup create
+func backupCreateUsage() string {
+	return os.Args[0] + " backup create <file> [--tag <tag>]... [--match <glob>]... [--ignore-case] [--where <expr>] [--public-health]"
+}
+
+// backupCreateOptions are the arguments of backup create
+type backupCreateOptions struct {
+	path, whereExpr          string
+	tags, patterns           []string
+	ignoreCase, publicHealth bool
+	filter                   *filter.Filter
+	where                    *query.Query
+}
+
+// backupCreateFlags returns the flag set of backup create, filling opts
+func backupCreateFlags(opts *backupCreateOptions) *flag.FlagSet {
+	fs := newFlagSet("backup create")
+	fs.Var(listFlag{&opts.tags}, "tag", "back up the entries tagged `tag`; may be repeated")
+	fs.Var(listFlag{&opts.patterns}, "match", "back up the entries whose name matches `glob`; may be repeated")
+	fs.BoolVar(&opts.ignoreCase, "ignore-case", false, "match tags and names ignoring case")
+	fs.StringVar(&opts.whereExpr, "where", "", "back up the entries matching `expr`")
+	fs.BoolVar(&opts.publicHealth, "public-health", false, "also store the health summary in plaintext")
+	return fs
+}
+
+// parseBackupCreateArgs reads the arguments of backup create: one file,
+// and the filters of the entries to back up
+func parseBackupCreateArgs(args []string) (*backupCreateOptions, error) {
+	opts := &backupCreateOptions{}
+	fs := backupCreateFlags(opts)
+	files, err := parseFlags(fs, args)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(files) == 0:
+		return nil, fmt.Errorf("a backup file is needed")
+	case len(files) > 1:
+		return nil, noArguments(files[1:])
+	}
+	opts.path = files[0]
+	if opts.where, err = parseWhere(opts.whereExpr, flagsGiven(fs)["where"]); err != nil {
+		return nil, err
+	}
+	if opts.filter, err = filter.New(opts.tags, opts.patterns, opts.ignoreCase); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// askNewPassphrase asks for a new passphrase and its confirmation. label
+// names what it protects, such as "Backup".
+func askNewPassphrase(prompter Prompter, label string) (string, error) {
+	passphrase, err := prompter.AskSecret(label + " passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("%s passphrase cannot be empty", strings.ToLower(label))
+	}
+	confirm, err := prompter.AskSecret("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// handleBackupDiff compares a backup with another backup or the live
+// vault. It never writes anything.
+func handleBackupDiff() {
+	files, live, asJSON, err := parseBackupDiffArgs(os.Args[3:])
+	if err != nil {
+		failFlags(backupDiffFlags(new(bool), new(bool)), err, backupDiffUsage())
+	}
+
+	prompter := newTerminalPrompter()
+	old, err := readBackup(prompter, files[0])
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	var newEntries []*storage.PasswordEntry
+	var newBackup *backup.Backup
+	newLabel := "live vault"
+	if live {
+		// Redacted passwords would all show up as changed
+		if database.IsViewer() {
+			fmt.Fprintf(os.Stderr, "Error: comparing against the live vault needs the master password\n")
+			exit(1)
+		}
+		newEntries, err = database.ListPasswords()
+	} else {
+		newBackup, err = readBackup(prompter, files[1])
+		if newBackup != nil {
+			newEntries = newBackup.Entries
+		}
+		newLabel = filepath.Base(files[1])
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	// A partial backup lacks entries on purpose; they would show up as
+	// added or removed
+	for _, side := range []struct {
+		label string
+		b     *backup.Backup
+	}{{filepath.Base(files[0]), old}, {newLabel, newBackup}} {
+		if side.b != nil && side.b.Partial() {
+			fmt.Fprintf(os.Stderr, "Warning: %s is a partial backup (%s)\n", side.label, side.b.Filter)
+		}
+	}
+
+	result := backup.Diff(old.Entries, newEntries)
+	if asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Comparing %s with %s\n\n", filepath.Base(files[0]), newLabel)
+	printBackupDiff(os.Stdout, result)
+}
+
+// backupDiffUsage returns the usage line of backup diff
+func backupDiffUsage() string {
+	return os.Args[0] + " backup diff <old-backup> [<new-backup>|--live] [--json]"
+}
+
+// backupDiffFlags returns the flag set of backup diff, filling live and
+// asJSON
+func backupDiffFlags(live, asJSON *bool) *flag.FlagSet {
+	fs := newFlagSet("backup diff")
+	fs.BoolVar(live, "live", false, "compare with the vault instead of a second backup")
+	fs.BoolVar(asJSON, "json", false, "print JSON to script against")
+	return fs
+}
+
+// parseBackupDiffArgs reads the arguments of backup diff: two backups,
+// or one and --live
+func parseBackupDiffArgs(args []string) (files []string, live, asJSON bool, err error) {
+	if files, err = parseFlags(backupDiffFlags(&live, &asJSON), args); err != nil {
+		return nil, false, false, err
+	}
+	switch {
+	case len(files) == 0:
+		return nil, false, false, fmt.Errorf("a backup file is needed")
+	case len(files) > 2 || (len(files) == 2 && live):
+		return nil, false, false, noArguments(files[len(files)-1:])
+	case len(files) == 1 && !live:
+		return nil, false, false, fmt.Errorf("a second backup, or --live, is needed")
+	}
+	return files, live, asJSON, nil
+}
+
+// backupInfoUsage returns the usage line of backup info
+func backupInfoUsage() string {
+	return os.Args[0] + " backup info <file>"
+}
+
+// parseBackupInfoArgs reads the arguments of backup info: one file
+func parseBackupInfoArgs(args []string) (string, error) {
+	files, err := parseFlags(newFlagSet("backup info"), args)
+	switch {
+	case err != nil:
+		return "", err
+	case len(files) == 0:
+		return "", fmt.Errorf("a backup file is needed")
+	case len(files) > 1:
+		return "", noArguments(files[1:])
+	}
+	return files[0], nil
+}
+
+// handleBackupInfo prints the health summary stored in a backup. A
+// public summary is shown without asking for the passphrase.
+func handleBackupInfo() {
+	path, err := parseBackupInfoArgs(os.Args[3:])
+	if err != nil {
+		failFlags(nil, err, backupInfoUsage())
+	}
+
+	info, err := backup.ReadInfo(path, "")
+	if errors.Is(err, backup.ErrPassphraseRequired) {
+		var passphrase string
+		passphrase, err = newTerminalPrompter().AskSecret(fmt.Sprintf("Passphrase for %s: ", filepath.Base(path)))
+		if err == nil {
+			info, err = backup.ReadInfo(path, passphrase)
+		}
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	if info.Health == nil {
+		fmt.Printf("%s has no health summary; it was made by an older version.\n", path)
+		return
+	}
+	info.Health.Print(os.Stdout)
+	if info.Public {
+		fmt.Println("\nThis summary is a plaintext header; it is only verified when the backup is read with its passphrase.")
+	}
+}
+
+// backupCommands are the read-only commands --from-backup works with
+var backupCommands = []string{"stats", "list", "search"}
+
+// openBackupVault reads the backup named by --from-backup and loads it
+// into an in-memory vault for command. The live vault is not opened.
+func openBackupVault(command string) error {
+	supported := false
+	for _, c := range backupCommands {
+		supported = supported || c == command
+	}
+	if !supported {
+		return fmt.Errorf("--from-backup works with %s only", strings.Join(backupCommands, ", "))
+	}
+
+	b, err := readBackup(newTerminalPrompter(), fromBackup)
+	if err != nil {
+		return err
+	}
+	if database, err = storage.OpenMemory(b.Each); err != nil {
+		return fmt.Errorf("failed to load %s: %w", fromBackup, err)
+	}
+	database.SetCollator(collator)
+	fromBackupMade = b.CreatedAt
+	if b.Partial() {
+		fmt.Fprintf(os.Stderr, "Partial backup: only entries matching %s.\n", b.Filter)
+	}
+	return nil
+}
+
+// readBackup prompts for the passphrase of the backup at path and reads it
+func readBackup(prompter Prompter, path string) (*backup.Backup, error) {
+	passphrase, err := prompter.AskSecret(fmt.Sprintf("Passphrase for %s: ", filepath.Base(path)))
+	if err != nil {
+		return nil, err
+	}
+	b, err := backup.Read(path, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// printBackupDiff renders a diff for people. Secret fields are reported
+// as changed, never with their values.
+func printBackupDiff(w io.Writer, result *backup.Result) {
+	if result.Empty() {
+		fmt.Fprintf(w, "No differences (%d entries).\n", result.Counts.Unchanged)
+		return
+	}
+
+	if len(result.Added) > 0 {
+		fmt.Fprintf(w, "Added (%d):\n", len(result.Added))
+		for _, name := range result.Added {
+			fmt.Fprintf(w, "  + %s\n", name)
+		}
+	}
+	if len(result.Removed) > 0 {
+		fmt.Fprintf(w, "Removed (%d):\n", len(result.Removed))
+		for _, name := range result.Removed {
+			fmt.Fprintf(w, "  - %s\n", name)
+		}
+	}
+	if len(result.Renamed) > 0 {
+		fmt.Fprintf(w, "Renamed (%d):\n", len(result.Renamed))
+		for _, rename := range result.Renamed {
+			fmt.Fprintf(w, "  ~ %s -> %s\n", rename.From, rename.To)
+		}
+	}
+	if len(result.Modified) > 0 {
+		fmt.Fprintf(w, "Modified (%d):\n", len(result.Modified))
+		for _, modified := range result.Modified {
+			fmt.Fprintf(w, "  * %s\n", modified.Name)
+			for _, change := range modified.Changes {
+				if change.Secret {
+					fmt.Fprintf(w, "      %s: changed\n", change.Field)
+				} else {
+					fmt.Fprintf(w, "      %s: %q -> %q\n", change.Field, change.Old, change.New)
+				}
+			}
+		}
+	}
+
+	c := result.Counts
+	fmt.Fprintf(w, "\n%d added, %d removed, %d renamed, %d modified, %d unchanged\n",
+		c.Added, c.Removed, c.Renamed, c.Modified, c.Unchanged)
+}
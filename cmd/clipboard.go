@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"password-manager/internal/clipboard"
+	"password-manager/internal/duration"
+	"password-manager/internal/storage"
+)
+
+// clearClipboardCommand is the hidden command of the process that clears
+// the clipboard once a copied password has been there long enough
+const clearClipboardCommand = "__clear-clipboard"
+
+// handleCopy copies an entry's password to the clipboard
+func handleCopy() {
+	opts, err := parseCopyArgs(os.Args[2:])
+	if err != nil {
+		failFlags(copyFlags(&copyOptions{}), err, os.Args[0]+" copy [--clear-after <duration>] [--no-touch] [--username <username>] [--] <name|site>")
+	}
+	if opts.clearAfter == "" {
+		opts.clearAfter = settings.ClipboardClear()
+	}
+
+	name, err := resolveAccount(opts.name, opts.username)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	entry, password, err := database.GetSecret(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if !opts.noTouch {
+		markAccessed(entry.Name)
+	}
+	copyPassword(entry, password, opts.clearAfter)
+}
+
+// copyOptions are the arguments of copy
+type copyOptions struct {
+	name, clearAfter, username string
+	noTouch                    bool
+}
+
+// copyFlags returns the flag set of copy, filling opts
+func copyFlags(opts *copyOptions) *flag.FlagSet {
+	fs := newFlagSet("copy")
+	fs.StringVar(&opts.clearAfter, "clear-after", "", "clear the clipboard after `duration` (default from the config)")
+	fs.BoolVar(&opts.noTouch, "no-touch", false, "do not record this read as the last access")
+	fs.StringVar(&opts.username, "username", "", "pick the account of `username` on a site")
+	return fs
+}
+
+// parseCopyArgs reads the arguments of copy. All positional arguments
+// form the name.
+func parseCopyArgs(args []string) (*copyOptions, error) {
+	opts := &copyOptions{}
+	words, err := parseFlags(copyFlags(opts), args)
+	if err != nil {
+		return nil, err
+	}
+	if opts.name = strings.Join(words, " "); opts.name == "" {
+		return nil, fmt.Errorf("a name is needed")
+	}
+	return opts, nil
+}
+
+// copyPassword puts the password of entry on the clipboard and has it
+// cleared after clearAfter. Without a clipboard the password is printed
+// instead, with a warning. The password is wiped either way.
+func copyPassword(entry *storage.PasswordEntry, password secret, clearAfter string) {
+	defer password.Wipe()
+	wait, err := parseClearAfter(clearAfter)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if database.IsViewer() {
+		fmt.Fprintf(os.Stderr, "Error: passwords are redacted in viewer sessions\n")
+		exit(1)
+	}
+	if len(password.Reveal()) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: '%s' has no password to copy\n", entry.Name)
+		exit(1)
+	}
+
+	board, err := clipboard.New()
+	if errors.Is(err, clipboard.ErrUnavailable) {
+		fmt.Fprintf(os.Stderr, "Warning: %v; printing the password instead\n", err)
+		os.Stdout.Write(password.Reveal())
+		fmt.Println()
+		return
+	}
+	var fingerprint string
+	if err == nil {
+		fingerprint, err = copySecret(board, password)
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	if wait == 0 {
+		fmt.Println("Password copied to clipboard.")
+		return
+	}
+	if err := startClipboardClearer(fingerprint, wait); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the clipboard will not be cleared: %v\n", err)
+		fmt.Println("Password copied to clipboard.")
+		return
+	}
+	fmt.Printf("Password copied to clipboard; it is cleared in %s.\n", wait)
+}
+
+// copySecret writes password to the clipboard and wipes it, returning
+// the fingerprint the clipboard is later cleared by
+func copySecret(board clipboard.Clipboard, password secret) (string, error) {
+	defer password.Wipe()
+	if err := board.Write(password.Reveal()); err != nil {
+		return "", err
+	}
+	return clipboard.Fingerprint(password.Reveal()), nil
+}
+
+// parseClearAfter reads --clear-after or clipboard_clear_after, where a
+// bare number is a count of seconds and 0 means never
+func parseClearAfter(value string) (time.Duration, error) {
+	spec, err := duration.Parse(value, duration.Short)
+	if err != nil || spec.IsAbsolute() {
+		return 0, fmt.Errorf("invalid clear-after duration %q (such as 30s or 2m, or 0 to keep the password)", value)
+	}
+	return spec.Duration(time.Now()), nil
+}
+
+// startClipboardClearer starts a process of this program that clears the
+// clipboard after wait, unless something else has been copied by then.
+// It outlives this one and is only told the fingerprint of the password,
+// through a pipe rather than its arguments.
+func startClipboardClearer(fingerprint string, wait time.Duration) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	defer w.Close()
+
+	cmd := exec.Command(executable, clearClipboardCommand, wait.String())
+	cmd.Stdin = r
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, fingerprint); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// runClipboardClearer is the process started by startClipboardClearer.
+// It reports nothing: nobody is waiting for it.
+func runClipboardClearer(args []string) {
+	// Closing the terminal the password was copied in does not stop it
+	signal.Ignore(syscall.SIGHUP)
+
+	if len(args) != 1 {
+		exit(2)
+	}
+	wait, err := time.ParseDuration(args[0])
+	if err != nil {
+		exit(2)
+	}
+	fingerprint, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		exit(2)
+	}
+
+	time.Sleep(wait)
+	board, err := clipboard.New()
+	if err != nil {
+		exit(1)
+	}
+	if _, err := clipboard.ClearIfUnchanged(board, strings.TrimSpace(fingerprint)); err != nil {
+		exit(1)
+	}
+}
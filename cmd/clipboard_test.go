@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"password-manager/internal/clipboard"
+)
+
+// memoryClipboard is a clipboard held in memory
+type memoryClipboard struct {
+	text []byte
+}
+
+func (m *memoryClipboard) Read() ([]byte, error) { return m.text, nil }
+
+func (m *memoryClipboard) Write(text []byte) error {
+	m.text = append([]byte(nil), text...)
+	return nil
+}
+
+func (m *memoryClipboard) Clear() error {
+	m.text = nil
+	return nil
+}
+
+func TestCopySecretWipesPassword(t *testing.T) {
+	board := &memoryClipboard{}
+	password := &countingSecret{value: []byte("hunter2")}
+
+	fingerprint, err := copySecret(board, password)
+	if err != nil {
+		t.Fatalf("copySecret failed: %v", err)
+	}
+	if string(board.text) != "hunter2" {
+		t.Errorf("Clipboard holds %q, want hunter2", board.text)
+	}
+	if fingerprint != clipboard.Fingerprint([]byte("hunter2")) {
+		t.Error("Expected the fingerprint of the copied password")
+	}
+	if password.wipes != 1 {
+		t.Errorf("Expected the password to be wiped once, got %d", password.wipes)
+	}
+}
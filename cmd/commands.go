@@ -0,0 +1,109 @@
+package main
+
+// argParsers holds the argument parser of each command, and of each
+// subcommand as "command subcommand". checkArgs runs it before the vault
+// is unlocked, so a mistyped command fails, and --help is answered,
+// without asking for the master password; the handler parses the same
+// arguments again to run. A command with subcommands has an entry of its
+// own for arguments naming none of them.
+var argParsers = map[string]func(args []string) error{
+	"init":          func(args []string) error { _, err := parseInitArgs(args); return err },
+	"generate":      parseGenerateOrPassphraseArgs,
+	"gen":           parseGenerateOrPassphraseArgs,
+	"save":          func(args []string) error { _, _, _, err := parseSaveArgs(args); return err },
+	"add":           parseNoArgs,
+	"update":        func(args []string) error { _, err := parseUpdateArgs(args); return err },
+	"edit":          func(args []string) error { _, err := parseUpdateArgs(args); return err },
+	"rename":        func(args []string) error { _, _, err := parseRenameArgs(args); return err },
+	"get":           func(args []string) error { _, err := parseGetArgs(args); return err },
+	"find":          func(args []string) error { _, err := parseGetArgs(args); return err },
+	"history":       func(args []string) error { _, _, _, err := parseHistoryArgs(args); return err },
+	"expiring":      func(args []string) error { _, _, _, err := parseExpiringArgs(args); return err },
+	"copy":          func(args []string) error { _, err := parseCopyArgs(args); return err },
+	"list":          func(args []string) error { _, err := parseListArgs(args); return err },
+	"delete":        func(args []string) error { _, err := parseDeleteArgs(args); return err },
+	"del":           func(args []string) error { _, err := parseDeleteArgs(args); return err },
+	"trash":         func(args []string) error { _, err := parseTrashArgs(args); return err },
+	"restore":       func(args []string) error { _, _, err := parseRestoreArgs(args); return err },
+	"search":        func(args []string) error { _, err := parseSearchArgs(args); return err },
+	"stats":         func(args []string) error { _, err := parseStatsArgs(args); return err },
+	"analyze":       func(args []string) error { _, err := parseAnalyzeArgs(args); return err },
+	"change-master": parseNoArgs,
+	"migrate-kdf":   parseNoArgs,
+	"upgrade":       parseNoArgs,
+	"split":         func(args []string) error { _, err := parseSplitArgs(args); return err },
+	"viewer":        parseViewerArgs,
+	"tag":           func(args []string) error { return subcommandError("tag", args) },
+	"tag style": func(args []string) error {
+		_, err := parseTagStyleArgs(args, &tagStyleChange{})
+		return err
+	},
+	"tag styles":    parseNoArgs,
+	"config":        func(args []string) error { _, err := parseConfigArgs(args); return err },
+	"backup":        func(args []string) error { return subcommandError("backup", args) },
+	"backup create": func(args []string) error { _, err := parseBackupCreateArgs(args); return err },
+	"backup diff":   func(args []string) error { _, _, _, err := parseBackupDiffArgs(args); return err },
+	"backup info":   func(args []string) error { _, err := parseBackupInfoArgs(args); return err },
+	"convert":       func(args []string) error { _, err := parseConvertArgs(args); return err },
+	"autotype":      func(args []string) error { _, err := parseAutotypeArgs(args); return err },
+	"recipients":    func(args []string) error { _, err := parseRecipientsArgs(args); return err },
+	"verify":        func(args []string) error { _, err := parseVerifyArgs(args); return err },
+	"note":          func(args []string) error { return subcommandError("note", args) },
+	"note add":      func(args []string) error { _, _, err := parseNoteAddArgs(args); return err },
+	"note show":     func(args []string) error { _, _, err := parseNoteShowArgs(args); return err },
+	"reminders":     func(args []string) error { _, err := parseRemindersArgs(args); return err },
+	"audit":         func(args []string) error { _, err := parseAuditArgs(args); return err },
+	"audit ack":     func(args []string) error { _, err := parseAuditAckArgs(args); return err },
+	"audit unack":   func(args []string) error { _, _, err := parseAuditUnackArgs(args); return err },
+	"audit acks":    parseNoArgs,
+	"comply":        func(args []string) error { _, _, err := parseComplyArgs(args); return err },
+	"put":           func(args []string) error { _, err := parsePutArgs(args); return err },
+	"export":        func(args []string) error { _, err := parseExportArgs(args); return err },
+	"import":        func(args []string) error { _, err := parseImportArgs(args); return err },
+	"import journal": func(args []string) error {
+		_, err := parseImportJournalArgs(args)
+		return err
+	},
+	"import rollback": func(args []string) error {
+		_, _, err := parseImportRollbackArgs(args)
+		return err
+	},
+	"report":      func(args []string) error { _, err := parseReportArgs(args); return err },
+	"checksum":    parseNoArgs,
+	"retag":       func(args []string) error { _, err := parseRetagArgs(args); return err },
+	"completion":  func(args []string) error { _, err := parseCompletionArgs(args); return err },
+	"totp":        func(args []string) error { _, err := parseTOTPArgs(args); return err },
+	"sync":        func(args []string) error { _, err := parseSyncArgs(args); return err },
+	"index":       parseIndexArgs,
+	"icon":        func(args []string) error { return subcommandError("icon", args) },
+	"icon fetch":  func(args []string) error { _, _, _, err := parseIconFetchArgs(args); return err },
+	"selftest":    parseNoArgs,
+	"demo":        func(args []string) error { _, err := parseDemoArgs(args); return err },
+	"interactive": func(args []string) error { _, err := parseLockAfter(args); return err },
+}
+
+// parseGenerateOrPassphraseArgs parses the arguments of generate, which
+// takes the flags of a passphrase with --passphrase
+func parseGenerateOrPassphraseArgs(args []string) error {
+	if hasFlag(args, "--passphrase") {
+		_, err := parsePassphraseArgs(args)
+		return err
+	}
+	_, _, _, err := parseGenerateArgs(args)
+	return err
+}
+
+// checkArgs catches argument errors, which need no vault, so they are
+// reported without asking for the master password. It gives flag.ErrHelp
+// for --help. Commands it does not know are left to their handler.
+func checkArgs(args []string) error {
+	if len(args) > 1 {
+		if parse, ok := argParsers[args[0]+" "+args[1]]; ok {
+			return parse(args[2:])
+		}
+	}
+	if parse, ok := argParsers[args[0]]; ok {
+		return parse(args[1:])
+	}
+	return nil
+}
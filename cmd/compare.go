@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/generator"
+)
+
+// comparison is the result of analyze --compare. It holds the two
+// analyses and never the passwords themselves.
+type comparison struct {
+	First  generator.PasswordAnalysis `json:"first"`
+	Second generator.PasswordAnalysis `json:"second"`
+	// Stronger is "first", "second" or empty when neither is
+	Stronger string `json:"stronger"`
+	Verdict  string `json:"verdict"`
+}
+
+// comparePasswords asks for two passwords without echo and writes their
+// analyses side by side, or as JSON, to w
+func comparePasswords(p Prompter, w io.Writer, asJSON bool) error {
+	first, err := p.AskSecret("First password: ")
+	if err != nil {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	second, err := p.AskSecret("Second password: ")
+	if err != nil {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+
+	c := compareAnalyses(generator.Analyze(first), generator.Analyze(second))
+	if crypto.SecretsEqual(first, second) {
+		c.Stronger, c.Verdict = "", "The two passwords are identical."
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	writeComparison(w, c)
+	return nil
+}
+
+// compareAnalyses ranks two analyses by score, then length, then unique
+// characters
+func compareAnalyses(first, second generator.PasswordAnalysis) *comparison {
+	c := &comparison{First: first, Second: second}
+	for _, rank := range []struct {
+		label string
+		a, b  int
+	}{
+		{"strength score", first.Score, second.Score},
+		{"length", first.Length, second.Length},
+		{"unique chars", first.UniqueChars, second.UniqueChars},
+	} {
+		a, b := rank.a, rank.b
+		if a == b {
+			continue
+		}
+		c.Stronger = "first"
+		if b > a {
+			c.Stronger = "second"
+		}
+		c.Verdict = fmt.Sprintf("The %s password is stronger (%s %d vs %d).",
+			c.Stronger, rank.label, max(a, b), min(a, b))
+		return c
+	}
+	c.Verdict = "Neither password is stronger by this analysis."
+	return c
+}
+
+// writeComparison prints the analyses in two columns
+func writeComparison(w io.Writer, c *comparison) {
+	row := func(label, first, second string) {
+		fmt.Fprintf(w, "%-20s %-14s %s\n", label, first, second)
+	}
+	yesNo := func(has bool) string {
+		if has {
+			return "yes"
+		}
+		return "no"
+	}
+
+	row("", "First", "Second")
+	row("Length", fmt.Sprint(c.First.Length), fmt.Sprint(c.Second.Length))
+	row("Unique characters", fmt.Sprint(c.First.UniqueChars), fmt.Sprint(c.Second.UniqueChars))
+	row("Character classes", fmt.Sprintf("%d/4", c.First.Classes()), fmt.Sprintf("%d/4", c.Second.Classes()))
+	for _, class := range []struct {
+		label         string
+		first, second bool
+	}{
+		{"  Uppercase", c.First.HasUpper, c.Second.HasUpper},
+		{"  Lowercase", c.First.HasLower, c.Second.HasLower},
+		{"  Numbers", c.First.HasDigits, c.Second.HasDigits},
+		{"  Symbols", c.First.HasSymbols, c.Second.HasSymbols},
+	} {
+		row(class.label, yesNo(class.first), yesNo(class.second))
+	}
+	row("Strength score", fmt.Sprint(c.First.Score), fmt.Sprint(c.Second.Score))
+	row("Strength level", c.First.Level, c.Second.Level)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, c.Verdict)
+}
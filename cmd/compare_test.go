@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestComparePasswordsGolden drives analyze --compare through a scripted
+// prompter and compares the output with testdata/analyze_compare
+func TestComparePasswordsGolden(t *testing.T) {
+	tests := []struct {
+		golden  string
+		answers []string
+		asJSON  bool
+	}{
+		{"second_stronger.golden", []string{"password1", "V9#kq!Lz2@xW7$mR"}, false},
+		{"first_stronger.golden", []string{"Tr0ub4dor&3xyz", "tr0ub4dor"}, false},
+		{"identical.golden", []string{"hunter2", "hunter2"}, false},
+		{"second_stronger_json.golden", []string{"password1", "V9#kq!Lz2@xW7$mR"}, true},
+	}
+
+	for _, tt := range tests {
+		prompter := &scriptedPrompter{answers: tt.answers}
+		var out bytes.Buffer
+		if err := comparePasswords(prompter, &out, tt.asJSON); err != nil {
+			t.Fatalf("%s: comparePasswords failed: %v", tt.golden, err)
+		}
+		if len(prompter.asked) != 2 {
+			t.Errorf("%s: expected two prompts, got %q", tt.golden, prompter.asked)
+		}
+		for _, password := range tt.answers {
+			if strings.Contains(out.String(), password) {
+				t.Errorf("%s: output echoes a password:\n%s", tt.golden, out.String())
+			}
+		}
+
+		want, err := os.ReadFile(filepath.Join("testdata", "analyze_compare", tt.golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.golden, out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"password-manager/internal/config"
+	"password-manager/internal/storage"
+)
+
+// completionCommands are the commands offered for the first word
+var completionCommands = []string{
+	"init", "generate", "save", "add", "put", "update", "rename", "get", "history", "copy", "list", "delete", "trash", "restore", "search",
+	"stats", "analyze", "change-master", "migrate-kdf", "upgrade", "split", "viewer", "tag", "config", "backup", "convert", "autotype",
+	"recipients", "verify", "totp", "note", "reminders", "expiring", "audit", "comply", "export", "import", "report", "retag", "sync", "index",
+	"icon", "checksum", "selftest", "interactive", "demo", "completion", "help", "version",
+}
+
+// bashCompletion completes commands, and entry names for the commands
+// taking one. Names come from "completion names", which never prompts.
+const bashCompletion = `_%[1]s() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "%[2]s" -- "$cur"))
+		return
+	fi
+	case ${COMP_WORDS[1]} in
+	get|find|history|copy|update|edit|rename|delete|del|autotype|recipients|verify|totp)
+		local IFS=$'\n'
+		COMPREPLY=($(compgen -W "$(%[3]s completion names 2>/dev/null)" -- "$cur"))
+		;;
+	esac
+}
+complete -F _%[1]s %[3]s
+`
+
+// handleCompletion prints the bash completion script, or the entry names
+// it completes. Listing names never asks for the master password: when
+// they cannot be read without it, nothing is printed and completion of
+// names is simply unavailable.
+func handleCompletion() {
+	kind, err := parseCompletionArgs(os.Args[2:])
+	if err != nil {
+		failFlags(nil, err, os.Args[0]+" completion bash|names")
+	}
+
+	switch kind {
+	case "bash":
+		program := filepath.Base(os.Args[0])
+		function := strings.NewReplacer("-", "_", ".", "_").Replace(program)
+		fmt.Printf(bashCompletion, function, strings.Join(completionCommands, " "), program)
+	case "names":
+		names, err := completionNames(dbPath, configPath)
+		if errors.Is(err, storage.ErrRequiresUnlock) {
+			return
+		}
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	}
+}
+
+// parseCompletionArgs reads what completion is asked to print: bash or
+// names
+func parseCompletionArgs(args []string) (string, error) {
+	rest, err := parseFlags(newFlagSet("completion"), args)
+	switch {
+	case err != nil:
+		return "", err
+	case len(rest) == 0:
+		return "", fmt.Errorf("completion needs bash or names")
+	case rest[0] != "bash" && rest[0] != "names":
+		return "", fmt.Errorf("unknown completion command %s", rest[0])
+	}
+	return rest[0], noArguments(rest[1:])
+}
+
+// completionNames lists the names of the vault at path without unlocking
+// it, in the order of the collation setting, unless the config turns that off with allow_unauthenticated_names,
+// in which case it gives storage.ErrRequiresUnlock as for a fully
+// encrypted vault
+func completionNames(path, configPath string) ([]string, error) {
+	c, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if !c.NamesWithoutUnlock() {
+		return nil, storage.ErrRequiresUnlock
+	}
+	// A bad locale is reported when the vault is opened, not on every Tab
+	collator, _ := c.Collator()
+	return storage.ListNamesUnauthenticated(path, collator)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"password-manager/internal/config"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+func TestCompletionNames(t *testing.T) {
+	defer tmpfile.Cleanup()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, config.FileName)
+
+	standard := filepath.Join(dir, "standard.db")
+	db, err := storage.CreateDatabase(standard, "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	if err := db.SavePassword(&storage.PasswordEntry{Name: "bank", Password: "secret"}); err != nil {
+		t.Fatalf("SavePassword failed: %v", err)
+	}
+	db.Close()
+
+	sealed := filepath.Join(dir, "sealed.db")
+	db, err = storage.CreateDatabase(sealed, "master", storage.InitOptions{FullEncryption: true})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	db.Close()
+
+	names, err := completionNames(standard, configFile)
+	if err != nil || !reflect.DeepEqual(names, []string{"bank"}) {
+		t.Errorf("Expected [bank] from a standard vault, got %v, %v", names, err)
+	}
+	if _, err := completionNames(sealed, configFile); !errors.Is(err, storage.ErrRequiresUnlock) {
+		t.Errorf("Expected ErrRequiresUnlock for a fully encrypted vault, got %v", err)
+	}
+
+	if err := os.WriteFile(configFile, []byte("allow_unauthenticated_names = false\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := completionNames(standard, configFile); !errors.Is(err, storage.ErrRequiresUnlock) {
+		t.Errorf("Expected ErrRequiresUnlock when the config disallows it, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/policy"
+	"password-manager/internal/storage"
+)
+
+// complyFlags returns the flag set of comply, filling path and asJSON
+func complyFlags(path *string, asJSON *bool) *flag.FlagSet {
+	fs := newFlagSet("comply")
+	fs.StringVar(path, "policy", "", "the policy `file` to check against")
+	fs.BoolVar(asJSON, "json", false, "print JSON to script against")
+	return fs
+}
+
+// parseComplyArgs reads the arguments of comply and loads its policy
+func parseComplyArgs(args []string) (*policy.Policy, bool, error) {
+	var path string
+	var asJSON bool
+	rest, err := parseFlags(complyFlags(&path, &asJSON), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if path == "" {
+		return nil, false, fmt.Errorf("--policy is required")
+	}
+	p, err := policy.Load(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return p, asJSON, nil
+}
+
+// handleComply checks the vault against the rules of a policy file and
+// exits with status 1 if any rule fails, for use in CI
+func handleComply() {
+	p, asJSON, err := parseComplyArgs(os.Args[2:])
+	if err != nil {
+		failFlags(complyFlags(new(string), new(bool)), err, os.Args[0]+" comply --policy <policy.yaml> [--json]")
+	}
+	// Lengths and notes need the secrets a viewer session cannot read
+	if database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+
+	entries, err := database.ListPasswords()
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	grades, err := database.StrengthGrades()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	totpNames, err := database.TOTPNames()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	report := p.Evaluate(policy.Vault{Entries: entries, Grades: grades, TOTP: totpNames}, time.Now())
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		writeComplianceReport(os.Stdout, report)
+	}
+	if !report.Passed {
+		exit(1)
+	}
+}
+
+// writeComplianceReport prints a line for each rule and, under a failed
+// rule, the entries failing it with their reasons
+func writeComplianceReport(w io.Writer, report *policy.Report) {
+	width := 0
+	for _, rule := range report.Rules {
+		width = max(width, len(rule.Name))
+	}
+
+	failed := 0
+	for _, rule := range report.Rules {
+		if rule.Passed {
+			fmt.Fprintf(w, "PASS  %-*s  %d entries\n", width, rule.Name, rule.Checked)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL  %-*s  %d of %d entries fail\n", width, rule.Name, len(rule.Failures), rule.Checked)
+		for _, failure := range rule.Failures {
+			fmt.Fprintf(w, "        %s: %s\n", failure.Entry, strings.Join(failure.Reasons, "; "))
+		}
+	}
+
+	fmt.Fprintln(w)
+	if failed == 0 {
+		fmt.Fprintf(w, "All %d rules pass.\n", len(report.Rules))
+	} else {
+		fmt.Fprintf(w, "%d of %d rules fail.\n", failed, len(report.Rules))
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"password-manager/internal/autotag"
+	"password-manager/internal/config"
+	"password-manager/internal/tui"
+)
+
+// configOptions are the arguments of a config subcommand
+type configOptions struct {
+	// command is "export" or "import"
+	command string
+	out     string
+	file    string
+}
+
+// configFlags returns the flag set of a config subcommand, filling opts
+func configFlags(command string, opts *configOptions) *flag.FlagSet {
+	fs := newFlagSet("config " + command)
+	if command == "export" {
+		fs.StringVar(&opts.out, "out", "", "write to `file` instead of standard output")
+	}
+	return fs
+}
+
+// parseConfigArgs reads the subcommand of config and its arguments. opts
+// is returned with the subcommand set even when the rest does not parse.
+func parseConfigArgs(args []string) (*configOptions, error) {
+	opts := &configOptions{}
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		return opts, subcommandError("config", args)
+	}
+	opts.command = args[0]
+	rest, err := parseFlags(configFlags(opts.command, opts), args[1:])
+	if err != nil {
+		return opts, err
+	}
+	if opts.command == "export" {
+		return opts, noArguments(rest)
+	}
+	if len(rest) != 1 {
+		return opts, fmt.Errorf("one config file is needed")
+	}
+	opts.file = rest[0]
+	return opts, nil
+}
+
+// handleConfig copies the config file, with the tag styles and every
+// other setting, to and from another machine. It needs no vault.
+func handleConfig() {
+	opts, err := parseConfigArgs(os.Args[2:])
+	if err != nil {
+		usage := os.Args[0] + " config export [--out <file>]\n" +
+			"       " + os.Args[0] + " config import <file>"
+		failFlags(configFlags(opts.command, &configOptions{}), err, usage)
+	}
+
+	switch opts.command {
+	case "export":
+		configExport(opts.out)
+	case "import":
+		configImport(opts.file)
+	}
+}
+
+// configExport writes the config file as it is, comments included, to
+// out or to stdout. Without a config file there is nothing but the
+// defaults, which an empty file stands for.
+func configExport(out string) {
+	data, err := os.ReadFile(configPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		printError(fmt.Errorf("failed to read config %s: %w", configPath, err))
+		exit(1)
+	}
+	if out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}
+	if err != nil {
+		printError(fmt.Errorf("failed to write %s: %w", out, err))
+		exit(1)
+	}
+	fmt.Printf("Config exported to %s\n", out)
+}
+
+// configImport replaces the config file with file, once it has been
+// checked the way commands check the config they load
+func configImport(file string) {
+	c, err := config.Load(file)
+	if err == nil {
+		_, err = compileSettings(c)
+	}
+	if err == nil {
+		err = checkTagStyles(c.TagStyles)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: config not imported: %v\n", err)
+		exit(1)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		printError(fmt.Errorf("failed to read %s: %w", file, err))
+		exit(1)
+	}
+	if err := config.Write(configPath, data); err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf("Config imported from %s to %s\n", file, configPath)
+}
+
+// compileSettings checks the settings of c that stop commands from
+// running and compiles its auto_tag rules
+func compileSettings(c *config.Config) (autotag.Rules, error) {
+	rules, err := autotag.Compile(c.AutoTag)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Quota.Check(); err != nil {
+		return nil, err
+	}
+	if _, err := c.HistoryLimit(); err != nil {
+		return nil, err
+	}
+	if _, err := c.Tuning(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// checkTagStyles reports the first tag style with a color or icon that
+// tag style would refuse
+func checkTagStyles(styles map[string]config.TagStyle) error {
+	tags := make([]string, 0, len(styles))
+	for tag := range styles {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		style := styles[tag]
+		if style.Color != "" && !tui.ValidColor(style.Color) {
+			return fmt.Errorf("tag_styles.%s: unknown color %q (choose from %s)", tag, style.Color, strings.Join(tui.ColorNames(), ", "))
+		}
+		if style.Icon != "" && !tui.ValidIcon(style.Icon) {
+			return fmt.Errorf("tag_styles.%s: icon must be a single printable character", tag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultConfigDir returns where the vault and identity live by default
+func defaultConfigDir(homeDir string) string {
+	return filepath.Join(homeDir, ".password-manager")
+}
+
+// defaultStateDir returns where the interactive shell keeps its command
+// history: $XDG_STATE_HOME/password-manager, by default under
+// ~/.local/state
+func defaultStateDir(homeDir string) string {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "password-manager")
+	}
+	return filepath.Join(homeDir, ".local", "state", "password-manager")
+}
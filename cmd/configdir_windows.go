@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultConfigDir returns where the vault and identity live by default:
+// %APPDATA%\password-manager, or the home directory if APPDATA is unset
+func defaultConfigDir(homeDir string) string {
+	if dir := os.Getenv("APPDATA"); dir != "" {
+		return filepath.Join(dir, "password-manager")
+	}
+	return filepath.Join(homeDir, ".password-manager")
+}
+
+// defaultStateDir returns where the interactive shell keeps its command
+// history: %LOCALAPPDATA%\password-manager, or the config directory if
+// LOCALAPPDATA is unset
+func defaultStateDir(homeDir string) string {
+	if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+		return filepath.Join(dir, "password-manager")
+	}
+	return defaultConfigDir(homeDir)
+}
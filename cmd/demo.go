@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"password-manager/internal/demo"
+)
+
+// demoCommands are the commands the demo shell runs. They only read and
+// change the vault in memory; commands writing files elsewhere, such as
+// backup and export, or needing a master password are left out.
+var demoCommands = []string{
+	"list", "search", "get", "history", "copy", "stats", "analyze", "generate", "gen",
+	"save", "add", "update", "edit", "delete", "del", "trash", "restore", "verify", "note", "audit", "expiring",
+}
+
+// demoFlags returns the flag set of demo, filling seed
+func demoFlags(seed *int64) *flag.FlagSet {
+	fs := newFlagSet("demo")
+	fs.Int64Var(seed, "seed", *seed, "make up the same entries each time from `n`")
+	return fs
+}
+
+// parseDemoArgs reads the arguments of demo and returns the seed of the
+// entries, from the clock unless --seed is given
+func parseDemoArgs(args []string) (int64, error) {
+	seed := time.Now().UnixNano()
+	rest, err := parseFlags(demoFlags(&seed), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	return seed, err
+}
+
+// handleDemo opens a throwaway vault of made-up entries in memory and
+// runs a shell on it. The vault on disk is never opened: the commands
+// run against the demo vault only, and it is gone once the shell ends.
+func handleDemo() {
+	seed, err := parseDemoArgs(os.Args[2:])
+	if err != nil {
+		failFlags(demoFlags(new(int64)), err, os.Args[0]+" demo [--seed <n>]")
+	}
+
+	db, err := demo.Open(seed, time.Now())
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	// Nothing may reach the real vault, its hooks or its identity
+	database, dbPath, identityFile, noHooks = db, "", "", true
+	defer closeDatabase()
+
+	entries, err := database.ListMetadata()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf(`Demo vault: %d made-up entries, held in memory and gone when you quit.
+Your own vault is not touched. Some things to try:
+
+  list                             every entry
+  list --where "strength<Good"     the weak passwords
+  list --where "tag=todo-rotate"   entries waiting to be rotated
+  search example.com               match names, usernames and URLs
+  get %-28s a password found in breach lists
+  get %-28s one of three entries sharing a password
+  stats                            what the vault holds
+  audit                            weak, reused and stale passwords at once
+  generate --length 20            a strong replacement
+
+Type help for the commands available here, quit or Ctrl-D to leave.
+`, len(entries), demo.Breached, demo.Reused[0])
+	sh := &shell{prompt: "demo> ", commands: demoCommands}
+	sh.run()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/dictation"
+	"password-manager/internal/storage"
+)
+
+// writeDictation prints the dictation sheet of the password of entry, or
+// writes it to a new file at output readable by the owner only. The caller
+// has checked that the sheet goes to a terminal or a file. The password is
+// wiped either way.
+func writeDictation(entry *storage.PasswordEntry, password secret, output string) {
+	defer password.Wipe()
+	if database.IsViewer() {
+		fmt.Fprintf(os.Stderr, "Error: passwords are redacted in viewer sessions\n")
+		exit(1)
+	}
+	if len(password.Reveal()) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: '%s' has no password to read out\n", entry.Name)
+		exit(1)
+	}
+
+	sheet := dictation.New(password.Reveal())
+	if output == "" {
+		if err := sheet.Write(os.Stdout); err != nil {
+			printError(err)
+			exit(1)
+		}
+		return
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		printError(fmt.Errorf("failed to create dictation sheet: %w", err))
+		exit(1)
+	}
+	err = sheet.Write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		printError(fmt.Errorf("failed to write dictation sheet: %w", err))
+		exit(1)
+	}
+	fmt.Printf("Wrote the dictation sheet to %s.\n", output)
+	fmt.Fprintf(os.Stderr, "Warning: %s holds the password in plain text; delete it as soon as the call is over.\n", output)
+}
+
+// handleChecksum prints the checksum word of a password that was read
+// aloud from a dictation sheet, for the listener to compare. It needs no
+// vault.
+func handleChecksum() {
+	if err := parseNoArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" checksum")
+	}
+	secret, err := readSecretBytes("Password as written down: ")
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	password := crypto.NewSecretString(secret)
+	defer password.Wipe()
+	fmt.Printf("Checksum word: %s\n", dictation.Checksum(password.Reveal()))
+}
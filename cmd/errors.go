@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"password-manager/internal/autotype"
+	"password-manager/internal/backup"
+	"password-manager/internal/clipboard"
+	"password-manager/internal/crypto"
+	"password-manager/internal/favicon"
+	"password-manager/internal/filelock"
+	"password-manager/internal/generator"
+	"password-manager/internal/recipient"
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+)
+
+// issuesURL is where bugs are reported
+const issuesURL = "https://github.com/Thanhhuong0209/Advanced-Password-Manager/issues"
+
+// errorInfo is how an error is shown: a short message, a hint on what to
+// do about it and a stable code for --json output. {program} in a hint is
+// replaced by the name the program was run as.
+type errorInfo struct {
+	code    string
+	message string
+	hint    string
+}
+
+// knownErrors maps the sentinel errors of the internal packages to how
+// they are shown. The first match wins, so an error wrapping another, as
+// ErrUpgradeRequired wraps ErrReadOnly, comes before it.
+var knownErrors = []struct {
+	err  error
+	info errorInfo
+}{
+	{storage.ErrUpgradeRequired, errorInfo{"upgrade_required",
+		"This vault is in an older format and stays read-only until it is upgraded.",
+		"Run '{program} upgrade' to move it to this version's format. Older versions\ncannot open it afterwards, so make a backup first if you may need them."}},
+	{storage.ErrReadOnly, errorInfo{"read_only",
+		"The vault is open read-only.",
+		"Viewer sessions cannot change the vault or read passwords and notes.\nUnlock it with the master password instead."}},
+	{storage.ErrPasswordForm, errorInfo{"invalid_master_password_form",
+		"The master password is not correct.",
+		"Passwords are case-sensitive; check Caps Lock and the keyboard layout. This vault also\ntakes accented and other non-ASCII characters only as typed when it was created, which\nanother system may compose differently: unlock it there and run '{program} change-master'\nwith the same password to make it work everywhere."}},
+	{storage.ErrInvalidPassword, errorInfo{"invalid_master_password",
+		"The master password is not correct.",
+		"Passwords are case-sensitive; check Caps Lock and the keyboard layout.\nIf you recently restored a backup, use the master password from the time it was made."}},
+	{crypto.ErrDecrypt, errorInfo{"decrypt_failed",
+		"The data could not be decrypted.",
+		"This usually means the master password is wrong. If you recently restored a backup,\nmake sure you're using the password from that time. Otherwise the vault may be damaged."}},
+	{storage.ErrVaultTooNew, errorInfo{"vault_too_new",
+		"This vault needs a newer version of the app.",
+		"Update the app to open it. Run '{program} version' to see which version this is."}},
+	{storage.ErrNoVault, errorInfo{"no_vault",
+		"No vault was found.",
+		"Create one with '{program} init', or point --db at an existing vault."}},
+	{errVaultPath, errorInfo{"vault_path",
+		"The vault path cannot be used.",
+		"--db and PM_DB take the path of the vault file itself, in a directory that\nexists or can be created."}},
+	{storage.ErrVaultExists, errorInfo{"vault_exists",
+		"A vault already exists there.",
+		"Pass --db to create another vault elsewhere."}},
+	{storage.ErrVaultReplaced, errorInfo{"vault_replaced",
+		"The vault file was replaced while it was open.",
+		"Nothing was written to the new file. Run the command again, or type 'reload' in\nthe interactive shell, to open it as it is now."}},
+	{storage.ErrVaultUnavailable, errorInfo{"vault_unavailable",
+		"The vault file cannot be reached.",
+		"The drive holding it may have been removed. Reinsert it and run the command again,\nor type 'reload' in the interactive shell. Nothing was written in the meantime."}},
+	{storage.ErrVaultInUse, errorInfo{"vault_in_use",
+		"The vault is open in another session.",
+		"A fully encrypted vault can be open in one session at a time. Finish the other\nsession, such as an interactive shell, and try again."}},
+	{filelock.ErrLocked, errorInfo{"file_locked",
+		"The file is in use by another process.",
+		"Wait for the other process to finish and try again."}},
+	{storage.ErrFullEncryption, errorInfo{"full_encryption",
+		"This is not supported for fully encrypted vaults.",
+		"Turn whole-file encryption off with '{program} convert --plain' first."}},
+	{storage.ErrRequiresUnlock, errorInfo{"requires_unlock",
+		"Entry names can only be read after unlocking the vault.",
+		""}},
+	{storage.ErrEntryNotFound, errorInfo{"entry_not_found",
+		"There is no entry by that name.",
+		"Names are case-sensitive. '{program} list' shows them all, and '{program} search <text>'\nfinds entries by name, username or URL."}},
+	{storage.ErrEntryExists, errorInfo{"entry_exists",
+		"An entry by that name already exists.",
+		"Change it with '{program} update <name>', or pick another name."}},
+	{storage.ErrNotInTrash, errorInfo{"not_in_trash",
+		"There is no entry by that name in the trash.",
+		"'{program} trash list' shows what the trash holds."}},
+	{storage.ErrRestoreConflict, errorInfo{"restore_conflict",
+		"Another entry has taken that name since it was deleted.",
+		"Restore it under another name with '{program} restore <name> --as <new name>'."}},
+	{storage.ErrOperationNotFound, errorInfo{"operation_not_found",
+		"There is no import with that ID in the journal.",
+		"'{program} import journal' lists the imports that can be rolled back."}},
+	{storage.ErrJournalPruned, errorInfo{"journal_pruned",
+		"That import is too old to roll back.",
+		"The journal keeps the state before an import for import_journal_retention (90d by default).\nRestore a backup from before the import instead."}},
+	{storage.ErrRolledBack, errorInfo{"rolled_back",
+		"That import was already rolled back.",
+		""}},
+	{storage.ErrNoteRecipients, errorInfo{"note_recipients",
+		"Notes cannot be encrypted to recipients.",
+		"Keep the secret in the password of a login entry to share it with recipients."}},
+	{storage.ErrUnknownFinding, errorInfo{"unknown_finding",
+		"That is not an audit finding.",
+		"Known findings: " + strings.Join(storage.Findings, ", ") + "."}},
+	{backup.ErrInvalidPassphrase, errorInfo{"invalid_backup_passphrase",
+		"The backup passphrase is not correct.",
+		"A backup is encrypted with the passphrase given when it was created,\nwhich need not be the master password."}},
+	{backup.ErrPassphraseRequired, errorInfo{"backup_passphrase_required",
+		"The backup's health summary is encrypted.",
+		"Enter the backup passphrase to read it."}},
+	{backup.ErrHeaderMismatch, errorInfo{"backup_header_mismatch",
+		"The backup's public summary does not match its encrypted contents.",
+		"The file was changed after it was made; do not rely on its summary."}},
+	{recipient.ErrNoIdentity, errorInfo{"identity_required",
+		"This entry is encrypted to recipients.",
+		"Pass --identity with the age identity file of one of its recipients."}},
+	{recipient.ErrNotARecipient, errorInfo{"not_a_recipient",
+		"None of your identities is a recipient of this entry.",
+		"'{program} recipients <name>' lists who can read it."}},
+	{generator.ErrInvalidConfig, errorInfo{"invalid_generator_options",
+		"Nothing can be generated with these options.",
+		"Passwords take 8 to 128 characters, and --exclude must leave some of every selected\nset. '{program} generate --help' lists the options and their limits."}},
+	{errNoTerminal, errorInfo{"no_terminal",
+		"No password could be read, as input is not a terminal.",
+		"Run the command in a terminal. Scripts pipe the master password in on a line\nof its own, and give entry passwords with --password."}},
+	{clipboard.ErrUnavailable, errorInfo{"clipboard_unavailable",
+		"No clipboard is available.",
+		"On Linux, install xclip, xsel or wl-clipboard. '{program} get' prints the password instead."}},
+	{autotype.ErrUnsupported, errorInfo{"autotype_unsupported",
+		"Autotype is not supported here.",
+		""}},
+	{favicon.ErrNotFound, errorInfo{"icon_not_found",
+		"No icon was found for the site.",
+		""}},
+	{tui.ErrAborted, errorInfo{"aborted",
+		"Cancelled.",
+		""}},
+}
+
+// describeError returns how err is shown, and the sentinel error it was
+// matched to. Errors that map to none of knownErrors are shown as they
+// are, with a hint to report them.
+func describeError(err error) (errorInfo, error) {
+	// I/O errors of the driver are told apart from bugs here
+	err = storage.Unavailable(err)
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			return known.info, known.err
+		}
+	}
+	return errorInfo{
+		code:    "unknown",
+		message: err.Error(),
+		hint:    "If this looks like a bug, please report it at\n" + issuesURL + "\nwith the command you ran, leaving out any secrets.",
+	}, nil
+}
+
+// printError prints err to stderr with its hint, or as JSON when the
+// command was given --json
+func printError(err error) {
+	asJSON := hasFlag(os.Args[1:], "--json")
+	renderError(os.Stderr, err, os.Args[0], asJSON, !asJSON && tui.ColorEnabledOn(os.Stderr, false))
+}
+
+// jsonError is the --json form of an error
+type jsonError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Detail  string `json:"detail,omitempty"`
+		Hint    string `json:"hint,omitempty"`
+	} `json:"error"`
+}
+
+// renderError writes err to w. The error text itself follows the message
+// as a detail when the message does not already say all it does.
+func renderError(w io.Writer, err error, program string, asJSON, color bool) {
+	info, sentinel := describeError(err)
+	hint := strings.ReplaceAll(info.hint, "{program}", program)
+	var detail string
+	if sentinel != nil && err.Error() != sentinel.Error() {
+		detail = err.Error()
+	}
+
+	if asJSON {
+		var out jsonError
+		out.Error.Code = info.code
+		out.Error.Message = info.message
+		out.Error.Detail = detail
+		out.Error.Hint = hint
+		data, _ := json.Marshal(out)
+		fmt.Fprintf(w, "%s\n", data)
+		return
+	}
+
+	paint := func(text, colorName string) string {
+		if color {
+			return tui.Colorize(text, colorName)
+		}
+		return text
+	}
+	fmt.Fprintf(w, "%s %s\n", paint("Error:", "red"), info.message)
+	if detail != "" {
+		fmt.Fprintf(w, "       %s\n", paint(detail, "gray"))
+	}
+	if hint != "" {
+		fmt.Fprintf(w, "%s  %s\n", paint("Hint:", "yellow"), strings.ReplaceAll(hint, "\n", "\n       "))
+	}
+}
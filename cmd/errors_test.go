@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+)
+
+// TestRenderErrorGolden renders the common failures and compares them
+// with testdata/errors
+func TestRenderErrorGolden(t *testing.T) {
+	authFailed := errors.New("cipher: message authentication failed")
+	tests := []struct {
+		golden string
+		err    error
+		asJSON bool
+	}{
+		{"wrong_master_password.golden", fmt.Errorf("failed to open vault: %w", storage.ErrInvalidPassword), false},
+		{"wrong_master_password_json.golden", fmt.Errorf("failed to open vault: %w", storage.ErrInvalidPassword), true},
+		{"wrong_master_password_form.golden", fmt.Errorf("failed to open vault: %w: %w", storage.ErrInvalidPassword, storage.ErrPasswordForm), false},
+		{"decrypt_failed.golden", fmt.Errorf("%w: %w", crypto.ErrDecrypt, authFailed), false},
+		{"entry_not_found.golden", fmt.Errorf("%w: bank", storage.ErrEntryNotFound), false},
+		{"read_only.golden", storage.ErrReadOnly, false},
+		{"upgrade_required.golden", storage.ErrUpgradeRequired, false},
+		{"vault_in_use.golden", storage.ErrVaultInUse, false},
+		{"invalid_generator_options.golden", fmt.Errorf("failed to generate password: %w: password length must be at least 8 characters", generator.ErrInvalidConfig), false},
+		{"no_terminal.golden", fmt.Errorf("failed to read password: %w", errNoTerminal), false},
+		{"unknown.golden", errors.New("disk I/O error"), false},
+		{"unknown_json.golden", errors.New("disk I/O error"), true},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		renderError(&out, tt.err, "pm", tt.asJSON, false)
+		want, err := os.ReadFile(filepath.Join("testdata", "errors", tt.golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.golden, out.String(), want)
+		}
+	}
+}
+
+func TestKnownErrorsDistinct(t *testing.T) {
+	codes := make(map[string]bool)
+	for _, known := range knownErrors {
+		if known.info.code == "" || known.info.message == "" || codes[known.info.code] {
+			t.Errorf("%v: missing or repeated code or message: %+v", known.err, known.info)
+		}
+		codes[known.info.code] = true
+		if info, _ := describeError(fmt.Errorf("wrapped: %w", known.err)); info.code != known.info.code {
+			t.Errorf("%v: matched %s, want %s", known.err, info.code, known.info.code)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/reminder"
+	"password-manager/internal/storage"
+)
+
+// defaultExpiringWithin is how far ahead expiring looks without --within
+const defaultExpiringWithin = "30d"
+
+// parseExpires reads the value of --expires: a span from now such as
+// 90d, 6m or 1y, a date, or never, which gives nil to clear the expiry
+func parseExpires(value string, now time.Time) (*time.Time, error) {
+	if strings.EqualFold(strings.TrimSpace(value), "never") {
+		return nil, nil
+	}
+	spec, err := duration.Parse(value, duration.Expiry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --expires %q: give a span such as 90d, 6m or 1y, a date such as 2025-01-31, or never", value)
+	}
+	expiresAt := spec.After(now)
+	return &expiresAt, nil
+}
+
+// expiryMarker is shown after the name of an expired entry in listings
+func expiryMarker(entry *storage.PasswordEntry, now time.Time) string {
+	if entry.Expired(now) {
+		return " [expired]"
+	}
+	return ""
+}
+
+// warnExpired warns on stderr when entry is past its expiry date
+func warnExpired(entry *storage.PasswordEntry) {
+	now := time.Now()
+	if !entry.Expired(now) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: '%s' expired %s; rotate it and set the next date with '%s update %s --password --expires <when>'\n",
+		entry.Name, duration.Humanize(*entry.ExpiresAt, now), os.Args[0], entry.Name)
+}
+
+// handleExpiring lists the entries that expire within --within, 30 days
+// by default, and those already expired
+func handleExpiring() {
+	within, spec, asJSON, err := parseExpiringArgs(os.Args[2:])
+	if err != nil {
+		failFlags(expiringFlags(new(string), new(bool)), err, os.Args[0]+" expiring [--within <span or date>] [--json]")
+	}
+
+	now := time.Now()
+	entries, err := database.ListExpiring(spec.After(now))
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if asJSON {
+		if err := writeEntriesJSON(os.Stdout, entries, false); err != nil {
+			printError(err)
+			exit(1)
+		}
+		return
+	}
+	writeExpiring(os.Stdout, entries, within, now)
+}
+
+// expiringFlags returns the flag set of expiring, filling within and
+// asJSON
+func expiringFlags(within *string, asJSON *bool) *flag.FlagSet {
+	fs := newFlagSet("expiring")
+	fs.StringVar(within, "within", defaultExpiringWithin, "list the entries expiring within a `span` such as 14d or 3m, or by a date")
+	fs.BoolVar(asJSON, "json", false, "print JSON to script against")
+	return fs
+}
+
+// parseExpiringArgs reads the arguments of expiring: the span of
+// --within, as given and parsed, and --json
+func parseExpiringArgs(args []string) (within string, spec duration.Spec, asJSON bool, err error) {
+	within = defaultExpiringWithin
+	rest, err := parseFlags(expiringFlags(&within, &asJSON), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return "", spec, false, err
+	}
+	if spec, err = duration.Parse(within, duration.Expiry); err != nil {
+		return "", spec, false, fmt.Errorf("invalid --within %q: give a span such as 14d or 3m, or a date", within)
+	}
+	return within, spec, asJSON, nil
+}
+
+// writeExpiring prints the entries expiring within the span given as
+// within, soonest first
+func writeExpiring(w io.Writer, entries []*storage.PasswordEntry, within string, now time.Time) {
+	if len(entries) == 0 {
+		fmt.Fprintf(w, "No entries expire within %s.\n", within)
+		return
+	}
+	width := 0
+	for _, entry := range entries {
+		width = max(width, len(entry.Name))
+	}
+	fmt.Fprintf(w, "Expiring within %s (%d):\n", within, len(entries))
+	for _, entry := range entries {
+		when := duration.Humanize(*entry.ExpiresAt, now)
+		if entry.Expired(now) {
+			when = "expired " + when
+		}
+		fmt.Fprintf(w, "  %-*s  %s (%s)\n", width, entry.Name, when, entry.ExpiresAt.Local().Format("2006-01-02"))
+	}
+}
+
+// expiringSummary counts the entries expiring within the reminder window
+// and the time until the first of them expires
+func expiringSummary(summary *reminder.Summary, now time.Time) error {
+	entries, err := database.ListExpiring(now.Add(reminder.DigestExpiryWindow))
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	summary.Expiring = len(entries)
+	summary.NextExpiry = entries[0].ExpiresAt.Sub(now)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+func TestParseExpires(t *testing.T) {
+	now := time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"90d", now.AddDate(0, 0, 90)},
+		{"6m", now.AddDate(0, 6, 0)},
+		{"1y", now.AddDate(1, 0, 0)},
+		{"2025-03-01T00:00:00Z", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseExpires(tt.value, now)
+		if err != nil {
+			t.Fatalf("%s: parseExpires failed: %v", tt.value, err)
+		}
+		if got == nil || !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.value, tt.want, got)
+		}
+	}
+
+	if got, err := parseExpires("never", now); err != nil || got != nil {
+		t.Errorf("never: expected no expiry, got %v, %v", got, err)
+	}
+	if _, err := parseExpires("soon", now); err == nil {
+		t.Error("Expected an error for an invalid --expires")
+	}
+}
+
+func TestWriteExpiring(t *testing.T) {
+	now := time.Date(2025, 1, 31, 12, 0, 0, 0, time.Local)
+	past, soon := now.AddDate(0, 0, -3), now.AddDate(0, 0, 10)
+	entries := []*storage.PasswordEntry{
+		{Name: "bank", ExpiresAt: &past},
+		{Name: "email", ExpiresAt: &soon},
+	}
+
+	var out bytes.Buffer
+	writeExpiring(&out, entries, "14d", now)
+	want := "Expiring within 14d (2):\n" +
+		"  bank   expired 3 days ago (2025-01-28)\n" +
+		"  email  in 10 days (2025-02-10)\n"
+	if out.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	out.Reset()
+	writeExpiring(&out, nil, "14d", now)
+	if out.String() != "No entries expire within 14d.\n" {
+		t.Errorf("Unexpected output for no entries: %q", out.String())
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"password-manager/internal/backup"
+	"password-manager/internal/passstore"
+	"password-manager/internal/query"
+	"password-manager/internal/recipient"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+// encryptWithPassphrase is the --encrypt-with value that asks for a
+// passphrase instead of naming an age recipient
+const encryptWithPassphrase = "passphrase"
+
+// handleExport writes entries out in another tool's format: a pass store,
+// whose files are encrypted with gpg, or a JSON or CSV file. JSON and CSV
+// exports leave passwords and notes out unless --include-secrets is given,
+// or --encrypt-with wraps the whole file in the backup envelope.
+func handleExport() {
+	opts, err := parseExportArgs(os.Args[2:])
+	if err != nil {
+		failFlags(exportFlags(&exportOptions{}), err, exportUsage())
+	}
+	switch {
+	case opts.decrypt != "":
+		decryptExport(opts.decrypt, opts.out)
+	case opts.format == "pass":
+		exportPass(opts.where, opts.dir, opts.gpgIDs)
+	default:
+		exportFile(opts.where, opts.format, opts.out, opts.includeSecrets, opts.encryptWith)
+	}
+}
+
+// exportUsage returns the usage lines of export
+func exportUsage() string {
+	return os.Args[0] + " export --format=pass --dir <store> [--gpg-id <key-id>]... [--where <expr>]\n" +
+		"       " + os.Args[0] + " export --format=json|csv --out <file> [--include-secrets | --encrypted | --encrypt-with passphrase|<age-recipient>...] [--where <expr>]\n" +
+		"       " + os.Args[0] + " export --decrypt <file> --out <file>"
+}
+
+// exportOptions are the arguments of export
+type exportOptions struct {
+	format, dir, out, decrypt, whereExpr string
+	gpgIDs, encryptWith                  []string
+	includeSecrets, encrypted            bool
+	where                                *query.Query
+}
+
+// exportFlags returns the flag set of export, filling opts.
+// --insecure-plaintext is another name for --include-secrets, and
+// --encrypted for --encrypt-with passphrase.
+func exportFlags(opts *exportOptions) *flag.FlagSet {
+	fs := newFlagSet("export")
+	fs.StringVar(&opts.format, "format", "", "write a pass store, json or csv as `format`")
+	fs.StringVar(&opts.dir, "dir", "", "the pass store `dir` to write")
+	fs.Var(listFlag{&opts.gpgIDs}, "gpg-id", "encrypt the pass store to `key-id`; may be repeated")
+	fs.StringVar(&opts.out, "out", "", "the `file` to write")
+	fs.BoolVar(&opts.includeSecrets, "include-secrets", false, "write passwords and notes in plain text")
+	fs.BoolVar(&opts.includeSecrets, "insecure-plaintext", false, "the same as --include-secrets")
+	fs.Var(listFlag{&opts.encryptWith}, "encrypt-with", "encrypt the file with a passphrase, or to an age `recipient`; may be repeated")
+	fs.BoolVar(&opts.encrypted, "encrypted", false, "the same as --encrypt-with passphrase")
+	fs.StringVar(&opts.decrypt, "decrypt", "", "decrypt an encrypted export `file` instead, to --out")
+	fs.StringVar(&opts.whereExpr, "where", "", "export only the entries matching `expr`")
+	return fs
+}
+
+// parseExportArgs reads the arguments of export, refusing flags that do
+// not go with its format
+func parseExportArgs(args []string) (*exportOptions, error) {
+	opts := &exportOptions{}
+	fs := exportFlags(opts)
+	rest, err := parseFlags(fs, args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.where, err = parseWhere(opts.whereExpr, flagsGiven(fs)["where"]); err != nil {
+		return nil, err
+	}
+	if opts.encrypted {
+		opts.encryptWith = append(opts.encryptWith, encryptWithPassphrase)
+	}
+
+	switch {
+	case opts.decrypt != "":
+		if opts.out == "" || opts.format != "" {
+			return nil, fmt.Errorf("--decrypt needs --out and no --format")
+		}
+	case opts.format == "pass":
+		if opts.dir == "" || opts.out != "" || opts.includeSecrets || len(opts.encryptWith) > 0 {
+			return nil, fmt.Errorf("--format=pass needs --dir and takes no --out, --include-secrets or --encrypt-with")
+		}
+	case opts.format == storage.ExportJSON || opts.format == storage.ExportCSV:
+		if opts.out == "" || opts.dir != "" || len(opts.gpgIDs) > 0 {
+			return nil, fmt.Errorf("--format=%s needs --out and takes no --dir or --gpg-id", opts.format)
+		}
+		if opts.includeSecrets && len(opts.encryptWith) > 0 {
+			return nil, fmt.Errorf("--include-secrets and --encrypt-with cannot be combined")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported export format %q (supported: pass, json, csv)", opts.format)
+	}
+	return opts, nil
+}
+
+// exportPass writes entries to a pass store, encrypted to its gpg keys
+func exportPass(where *query.Query, dir string, ids []string) {
+	// An existing store keeps its own keys
+	var err error
+	if len(ids) == 0 {
+		if ids, err = passstore.ReadIDs(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s has no %s; pass --gpg-id\n", dir, passstore.IDFile)
+			exit(1)
+		}
+	}
+
+	if database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+	entries, err := database.ListPasswords()
+	if err == nil {
+		entries, err = applyWhere(where, entries)
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	failed, err := passstore.Export(dir, ids, entries, &passstore.GPG{})
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	for _, entryErr := range failed {
+		fmt.Fprintf(os.Stderr, "Skipped %v\n", entryErr)
+	}
+	fmt.Printf("Exported %d of %d entries to %s\n", len(entries)-len(failed), len(entries), dir)
+	if len(failed) > 0 {
+		exit(1)
+	}
+}
+
+// exportFile writes entries to a JSON or CSV file. Plaintext secrets need
+// includeSecrets; with encryptWith the export holds them but is encrypted
+// under a passphrase or to age recipients.
+func exportFile(where *query.Query, format, out string, includeSecrets bool, encryptWith []string) {
+	var passphrase string
+	var recipients []string
+	for _, value := range encryptWith {
+		if value != encryptWithPassphrase {
+			recipients = append(recipients, value)
+		}
+	}
+	usePassphrase := len(recipients) < len(encryptWith)
+	if usePassphrase && len(recipients) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --encrypt-with %s cannot be combined with recipients\n", encryptWithPassphrase)
+		exit(1)
+	}
+	if len(recipients) > 0 {
+		var err error
+		if recipients, err = recipient.NormalizeKeys(recipients); err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+	encrypted := len(encryptWith) > 0
+	secrets := includeSecrets || encrypted
+
+	if secrets && database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+	if usePassphrase {
+		var err error
+		if passphrase, err = askNewPassphrase(newTerminalPrompter(), "Export"); err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+
+	// Entries are streamed from the vault a batch at a time; an interrupt
+	// stops the export between entries instead of killing the process
+	// mid-write
+	tmpfile.StopSignals()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	source, err := exportSource(where, secrets)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	if encrypted {
+		var buf bytes.Buffer
+		ew, err := storage.NewExportWriter(&buf, format, true)
+		if err == nil {
+			err = source(ctx, ew.Write)
+		}
+		if err == nil {
+			err = ew.Close()
+		}
+		if err == nil {
+			err = backup.WriteExport(out, format, buf.Bytes(), passphrase, recipients)
+		}
+		buf.Reset()
+		if err != nil {
+			printError(err)
+			exitExport(err)
+		}
+		fmt.Printf("Exported %d entries to %s (encrypted %s)\n", ew.Count(), out, format)
+		return
+	}
+
+	if includeSecrets {
+		warnPlaintextSecrets(out)
+		fmt.Fprintln(os.Stderr, "Use --encrypt-with for an encrypted export instead.")
+	}
+	count, partial, err := streamExport(ctx, out, format, includeSecrets, source)
+	if err != nil {
+		printError(err)
+		if partial != "" {
+			fmt.Fprintf(os.Stderr, "The export stopped after %d entries; the incomplete output was kept as %s.\n", count, partial)
+			if includeSecrets {
+				remindSecureDelete(partial)
+			}
+		}
+		exitExport(err)
+	}
+	fmt.Printf("Exported %d entries to %s\n", count, out)
+	if includeSecrets {
+		remindSecureDelete(out)
+	} else {
+		fmt.Println("Passwords and notes were left out; pass --include-secrets to export them in plaintext.")
+	}
+}
+
+// entrySource calls fn with each entry to export
+type entrySource func(ctx context.Context, fn func(*storage.PasswordEntry) error) error
+
+// exportSource streams the vault entries matching where, warning about
+// entries whose password cannot be included
+func exportSource(where *query.Query, secrets bool) (entrySource, error) {
+	var grades map[int64]storage.StrengthGrade
+	opts := storage.ForEachOptions{Secrets: secrets}
+	if where != nil && where.NeedsPasswords() {
+		var err error
+		if grades, err = database.StrengthGrades(); err != nil {
+			return nil, err
+		}
+		opts.Secrets = true
+	}
+
+	return func(ctx context.Context, fn func(*storage.PasswordEntry) error) error {
+		return database.ForEachEntry(ctx, opts, func(entry *storage.PasswordEntry) error {
+			if where != nil && !where.Match(entry, grades) {
+				return nil
+			}
+			if secrets && entry.Locked {
+				fmt.Fprintf(os.Stderr, "Warning: '%s' is encrypted to recipients you hold no identity for; its password is not in the export\n", entry.Name)
+			}
+			return fn(entry)
+		})
+	}, nil
+}
+
+// streamExport writes the entries from source to a new file readable by
+// the owner only. If writing stops partway, because ctx was cancelled or
+// on an error, the truncated file is renamed to path + ".partial" so it
+// cannot pass for a complete export, and that name is returned along
+// with the count of entries it holds.
+func streamExport(ctx context.Context, path, format string, includeSecrets bool, source entrySource) (int, string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create export: %w", err)
+	}
+	buffered := bufio.NewWriter(f)
+	ew, err := storage.NewExportWriter(buffered, format, includeSecrets)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return 0, "", err
+	}
+
+	err = source(ctx, ew.Write)
+	if err == nil {
+		err = ew.Close()
+	}
+	if flushErr := buffered.Flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("failed to write export: %w", flushErr)
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export: %w", closeErr)
+	}
+	if err == nil {
+		return ew.Count(), "", nil
+	}
+
+	partial := path + ".partial"
+	if renameErr := os.Rename(path, partial); renameErr != nil {
+		partial = path
+	}
+	return ew.Count(), partial, err
+}
+
+// exitExport exits after a failed export, with the shell's status for
+// an interrupt when the export was cancelled
+func exitExport(err error) {
+	tmpfile.Cleanup()
+	if errors.Is(err, context.Canceled) {
+		exit(130)
+	}
+	exit(1)
+}
+
+// warnPlaintextSecrets warns on stderr that path is about to hold every
+// secret in the clear
+func warnPlaintextSecrets(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	fmt.Fprintln(os.Stderr, "!!! WARNING: DANGER ZONE !!!")
+	fmt.Fprintf(os.Stderr, "Every password and note in the export is written in PLAINTEXT to %s.\n", path)
+	fmt.Fprintln(os.Stderr, "Anyone who can read that file, or the disk it is on, can read them.")
+}
+
+// remindSecureDelete suggests removing a plaintext export once it is no
+// longer needed
+func remindSecureDelete(path string) {
+	fmt.Fprintf(os.Stderr, "Reminder: delete %s securely once it has been imported elsewhere (e.g. shred -u %s).\n", path, path)
+}
+
+// decryptExport writes the contents of an encrypted export to out in
+// plaintext, asking for the passphrase or using the identity file
+func decryptExport(path, out string) {
+	sealed, err := backup.IsSealedExport(path)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	var format string
+	var data []byte
+	if sealed {
+		if identityFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: %s is encrypted to age recipients; pass --identity\n", path)
+			exit(1)
+		}
+		identities, err := recipient.LoadIdentities(identityFile)
+		if err == nil {
+			format, data, err = backup.ReadExport(path, "", identities)
+		}
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+	} else {
+		var passphrase string
+		passphrase, err = newTerminalPrompter().AskSecret(fmt.Sprintf("Passphrase for %s: ", filepath.Base(path)))
+		if err == nil {
+			format, data, err = backup.ReadExport(path, passphrase, nil)
+		}
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+
+	warnPlaintextSecrets(out)
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}
+	if err != nil {
+		printError(fmt.Errorf("failed to write %s: %w", out, err))
+		exit(1)
+	}
+	fmt.Printf("Decrypted %s export to %s\n", format, out)
+	remindSecureDelete(out)
+}
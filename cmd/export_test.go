@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+// sliceSource streams entries, honouring ctx between them as the vault does
+func sliceSource(entries []*storage.PasswordEntry) entrySource {
+	return func(ctx context.Context, fn func(*storage.PasswordEntry) error) error {
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestStreamExport(t *testing.T) {
+	entries := []*storage.PasswordEntry{
+		{Name: "a", Password: "one"},
+		{Name: "b", Password: "two"},
+		{Name: "c", Password: "three"},
+	}
+	path := filepath.Join(t.TempDir(), "export.json")
+
+	count, partial, err := streamExport(context.Background(), path, storage.ExportJSON, true, sliceSource(entries))
+	if err != nil || count != 3 || partial != "" {
+		t.Fatalf("streamExport returned %d, %q, %v", count, partial, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.HasSuffix(string(data), "\n]\n") || !strings.Contains(string(data), `"three"`) {
+		t.Errorf("Unexpected export:\n%s", data)
+	}
+	if _, _, err := streamExport(context.Background(), path, storage.ExportJSON, true, sliceSource(entries)); err == nil {
+		t.Error("Expected an existing file not to be overwritten")
+	}
+}
+
+func TestStreamExportCancelled(t *testing.T) {
+	entries := []*storage.PasswordEntry{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	path := filepath.Join(t.TempDir(), "export.csv")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	source := func(ctx context.Context, fn func(*storage.PasswordEntry) error) error {
+		return sliceSource(entries)(ctx, func(entry *storage.PasswordEntry) error {
+			if entry.Name == "b" {
+				cancel()
+			}
+			return fn(entry)
+		})
+	}
+
+	count, partial, err := streamExport(ctx, path, storage.ExportCSV, false, source)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected cancellation, got %v", err)
+	}
+	if count != 2 || partial != path+".partial" {
+		t.Errorf("Expected 2 entries in %s.partial, got %d in %q", path, count, partial)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no complete export at %s, got %v", path, err)
+	}
+	data, err := os.ReadFile(partial)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if want := "name,url,username,password,notes\na,,,,\nb,,,,\n"; string(data) != want {
+		t.Errorf("Expected the entries written before the cancel, got:\n%s", data)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newFlagSet returns the flag set of a subcommand. Flags are written
+// --name value or --name=value, and --help lists them. Errors are
+// returned rather than printed, so the caller reports them the way the
+// other commands do.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags parses args with fs and returns the positional arguments.
+// Unlike fs.Parse, flags may come after positional arguments, as in
+// "save gmail --username me"; everything after "--" is positional.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, flagError(err)
+		}
+		rest := fs.Args()
+		// Parse stops at the first positional argument, or after "--"
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// flagError rewords the errors of the flag package, which name flags with
+// a single dash, the way the other commands word them
+func flagError(err error) error {
+	msg := err.Error()
+	if name, ok := strings.CutPrefix(msg, "flag provided but not defined: -"); ok {
+		return fmt.Errorf("unknown flag --%s", name)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	msg = strings.Replace(msg, "for flag -", "for --", 1)
+	msg = strings.Replace(msg, "flag needs an argument: -", "a value is needed for --", 1)
+	return errors.New(msg)
+}
+
+// failFlags ends a subcommand whose flags did not parse. --help prints
+// the usage line and the flags of fs to stdout and exits 0; any other
+// error is printed with the usage line to stderr and exits 1. fs is nil
+// for commands that take no flags.
+func failFlags(fs *flag.FlagSet, err error, usage string) {
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Printf("Usage: %s\n", usage)
+		if fs != nil {
+			writeFlags(os.Stdout, fs)
+		}
+		exit(0)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	fmt.Fprintf(os.Stderr, "Usage: %s\n", usage)
+	exit(1)
+}
+
+// noArguments returns the error for positional arguments given to a
+// command that takes none, nil when there are none
+func noArguments(rest []string) error {
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %s", rest[0])
+	}
+	return nil
+}
+
+// parseNoArgs parses the arguments of a command that takes none, which
+// is still asked for --help
+func parseNoArgs(args []string) error {
+	rest, err := parseFlags(newFlagSet(""), args)
+	if err != nil {
+		return err
+	}
+	return noArguments(rest)
+}
+
+// subcommandError is the error of a command that was not given one of
+// its subcommands: flag.ErrHelp when it was asked for --help
+func subcommandError(command string, args []string) error {
+	switch {
+	case len(args) == 0:
+		return fmt.Errorf("%s needs a subcommand", command)
+	case args[0] == "--help" || args[0] == "-h":
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("unknown %s command %s", command, args[0])
+}
+
+// flagsGiven returns the names of the flags of fs that were set
+func flagsGiven(fs *flag.FlagSet) map[string]bool {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	return given
+}
+
+// writeFlags lists the flags of fs with their descriptions and defaults
+func writeFlags(w io.Writer, fs *flag.FlagSet) {
+	defined := false
+	fs.VisitAll(func(*flag.Flag) { defined = true })
+	if !defined {
+		return
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	fs.VisitAll(func(f *flag.Flag) {
+		value, usage := flag.UnquoteUsage(f)
+		spec := "--" + f.Name
+		if value != "" {
+			spec += " <" + value + ">"
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(w, "  %-26s %s\n", spec, usage)
+	})
+}
+
+// notFlag is a boolean flag clearing the bool it points to, for the --no-
+// flags of options that are on by default
+type notFlag struct{ value *bool }
+
+func (f notFlag) String() string {
+	if f.value == nil {
+		return "false"
+	}
+	return strconv.FormatBool(!*f.value)
+}
+
+func (f notFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.value = !v
+	return nil
+}
+
+func (f notFlag) IsBoolFlag() bool { return true }
+
+// secretFlag is a string flag whose value is a secret, such as a
+// password. The interactive shell keeps lines giving one out of its
+// command history.
+type secretFlag struct{ value *string }
+
+func (f secretFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f secretFlag) Set(s string) error {
+	*f.value = s
+	return nil
+}
+
+// secretFlags returns the names of the flags of fs that take secrets
+func secretFlags(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(secretFlag); ok {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// listFlag is a flag that may be given more than once, collecting its
+// values in order
+type listFlag struct{ values *[]string }
+
+func (f listFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f listFlag) Set(s string) error {
+	*f.values = append(*f.values, s)
+	return nil
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/config"
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		name       string
+		long       bool
+	}{
+		{[]string{"--name", "x", "a", "b"}, []string{"a", "b"}, "x", false},
+		{[]string{"a", "--name=x", "b", "--long"}, []string{"a", "b"}, "x", true},
+		{[]string{"-name", "x", "a"}, []string{"a"}, "x", false},
+		{[]string{"a", "--", "--long", "-b"}, []string{"a", "--long", "-b"}, "", false},
+		{[]string{"--long", "--", "--name"}, []string{"--name"}, "", true},
+		{[]string{"-"}, []string{"-"}, "", false},
+		{nil, nil, "", false},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test")
+		name := fs.String("name", "", "")
+		long := fs.Bool("long", false, "")
+		positional, err := parseFlags(fs, tt.args)
+		if err != nil || !reflect.DeepEqual(positional, tt.positional) || *name != tt.name || *long != tt.long {
+			t.Errorf("parseFlags(%q) = %q, %q, %t, %v; want %q, %q, %t", tt.args, positional, *name, *long, err, tt.positional, tt.name, tt.long)
+		}
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--nmae", "x"}, "unknown flag --nmae"},
+		{[]string{"a", "--count", "many"}, `invalid value "many" for --count`},
+		{[]string{"--count"}, "a value is needed for --count"},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test")
+		fs.Int("count", 0, "")
+		if _, err := parseFlags(fs, tt.args); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("parseFlags(%q): expected %q, got %v", tt.args, tt.want, err)
+		}
+	}
+	for _, help := range []string{"--help", "-h"} {
+		if _, err := parseFlags(newFlagSet("test"), []string{"a", help}); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("Expected flag.ErrHelp for %s, got %v", help, err)
+		}
+	}
+}
+
+func TestParseGenerateArgs(t *testing.T) {
+	config, rules, lengthGiven, err := parseGenerateArgs([]string{"--length", "20", "--symbols=false", "--exclude=0O", "--no-require-all-classes", "--chunk", "5", "--chunk-sep", "_", "--verify", "min=12"})
+	if err != nil {
+		t.Fatalf("parseGenerateArgs failed: %v", err)
+	}
+	want := generator.DefaultConfig()
+	want.Length, want.Symbols, want.Exclude, want.RequireEachClass = 20, false, "0O", false
+	want.ChunkSize, want.ChunkSeparator = 5, "_"
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("Expected %+v, got %+v", want, config)
+	}
+	if !lengthGiven || rules == nil || rules.Min != 12 {
+		t.Errorf("Expected --length given and min=12, got %t and %v", lengthGiven, rules)
+	}
+
+	// The example of the help text
+	config, rules, lengthGiven, err = parseGenerateArgs([]string{"--length", "20", "--no-symbols"})
+	if err != nil || config.Length != 20 || config.Symbols || rules != nil || !lengthGiven {
+		t.Errorf("Unexpected %+v, %v, %t, %v", config, rules, lengthGiven, err)
+	}
+	if config, _, _, err := parseGenerateArgs([]string{"--mobile"}); err != nil || !config.MobileFriendly {
+		t.Errorf("Expected --mobile to ask for mobile-friendly symbols, got %+v, %v", config, err)
+	}
+	if config, _, lengthGiven, err := parseGenerateArgs(nil); err != nil || !reflect.DeepEqual(config, generator.DefaultConfig()) || lengthGiven {
+		t.Errorf("Expected the defaults, got %+v, %t, %v", config, lengthGiven, err)
+	}
+
+	for _, args := range [][]string{
+		{"--length", "twenty"},
+		{"--lenght=20"},
+		{"20"},
+		{"--chunk-sep", "-"},
+		{"--verify", "min=0"},
+		{"--numbers", "--no-numbers"},
+		{"--no-uppercase", "--no-lowercase", "--no-numbers", "--no-symbols"},
+		{"--symbols", "--no-symbols"},
+	} {
+		if _, _, _, err := parseGenerateArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
+
+func TestParseGenerateClasses(t *testing.T) {
+	// upper, lower, numbers and symbols as the configuration has them
+	tests := []struct {
+		args []string
+		want [4]bool
+	}{
+		{nil, [4]bool{true, true, true, true}},
+		{[]string{"--numbers"}, [4]bool{false, false, true, false}},
+		{[]string{"--uppercase", "--numbers"}, [4]bool{true, false, true, false}},
+		{[]string{"--uppercase", "--lowercase", "--numbers", "--symbols"}, [4]bool{true, true, true, true}},
+		{[]string{"--no-symbols"}, [4]bool{true, true, true, false}},
+		{[]string{"--no-uppercase", "--no-numbers"}, [4]bool{false, true, false, true}},
+		{[]string{"--symbols=false"}, [4]bool{true, true, true, false}},
+		{[]string{"--lowercase", "--numbers", "--no-symbols"}, [4]bool{false, true, true, false}},
+		{[]string{"--numbers", "--uppercase=false"}, [4]bool{false, false, true, false}},
+		{[]string{"--length", "12", "--symbols", "--mobile"}, [4]bool{false, false, false, true}},
+	}
+	for _, tt := range tests {
+		config, _, _, err := parseGenerateArgs(tt.args)
+		if err != nil {
+			t.Errorf("parseGenerateArgs(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if got := [4]bool{config.Uppercase, config.Lowercase, config.Numbers, config.Symbols}; got != tt.want {
+			t.Errorf("parseGenerateArgs(%q): expected classes %v, got %v", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestParsePassphraseArgs(t *testing.T) {
+	config, err := parsePassphraseArgs([]string{"--passphrase", "--words", "8", "--separator=.", "--capitalize", "first", "--digit"})
+	want := &generator.PassphraseConfig{Words: 8, Separator: ".", Capitalize: "first", Digit: true}
+	if err != nil || !reflect.DeepEqual(config, want) {
+		t.Errorf("Expected %+v, got %+v, %v", want, config, err)
+	}
+	for _, args := range [][]string{{"--words", "many"}, {"--length", "20"}, {"extra"}} {
+		if _, err := parsePassphraseArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
+
+func TestParseSaveArgs(t *testing.T) {
+	entry, autoName, force, err := parseSaveArgs([]string{"My", "--username=me", "Bank", "--password", "s3cret", "--url", "https://bank.example", "--notes", "n", "--tags", "a, b", "--icon", "$", "--force"})
+	want := &storage.PasswordEntry{Name: "My Bank", Username: "me", Password: "s3cret", URL: "https://bank.example", Notes: "n", Tags: []string{"a", "b"}, Icon: "$"}
+	if err != nil || !reflect.DeepEqual(entry, want) || autoName || !force {
+		t.Errorf("Expected %+v and --force, got %+v, %t, %t, %v", want, entry, autoName, force, err)
+	}
+
+	entry, autoName, _, err = parseSaveArgs([]string{"--url", "https://mail.example.com", "--auto-name"})
+	if err != nil || entry.Name != "" || !autoName {
+		t.Errorf("Expected no name and --auto-name, got %+v, %t, %v", entry, autoName, err)
+	}
+	if entry, _, _, err := parseSaveArgs([]string{"--username", "me", "--", "-legacy"}); err != nil || entry.Name != "-legacy" {
+		t.Errorf("Expected the name after --, got %+v, %v", entry, err)
+	}
+
+	for _, args := range [][]string{{"bank", "--user", "me"}, {"bank", "--password"}, {"bank", "--recipients", "not-a-key"}} {
+		if _, _, _, err := parseSaveArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
+
+func TestParseTagStyleArgs(t *testing.T) {
+	var change tagStyleChange
+	tag, err := parseTagStyleArgs([]string{"work", "--color=red", "--icon", "★"}, &change)
+	if err != nil || tag != "work" || change != (tagStyleChange{color: "red", icon: "★"}) {
+		t.Errorf("Unexpected %q, %+v, %v", tag, change, err)
+	}
+	if got := change.apply(config.TagStyle{Color: "blue"}); got != (config.TagStyle{Color: "red", Icon: "★"}) {
+		t.Errorf("Unexpected style %+v", got)
+	}
+	// --reset clears what the other flags do not set, wherever it is given
+	change = tagStyleChange{}
+	if _, err := parseTagStyleArgs([]string{"--icon", "★", "work", "--reset"}, &change); err != nil {
+		t.Fatalf("parseTagStyleArgs failed: %v", err)
+	}
+	if got := change.apply(config.TagStyle{Color: "blue", Icon: "x"}); got != (config.TagStyle{Icon: "★"}) {
+		t.Errorf("Unexpected style %+v", got)
+	}
+
+	for _, args := range [][]string{nil, {"a", "b"}, {"work", "--colour", "red"}, {"work", "--color"}} {
+		if _, err := parseTagStyleArgs(args, &tagStyleChange{}); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
+
+func TestArgParsersFlags(t *testing.T) {
+	for command, parse := range argParsers {
+		if err := parse([]string{"--bogus"}); err == nil || errors.Is(err, flag.ErrHelp) {
+			t.Errorf("%s --bogus: expected an error, got %v", command, err)
+		}
+		if err := parse([]string{"--help"}); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("%s --help: expected flag.ErrHelp, got %v", command, err)
+		}
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	valid := [][]string{
+		{"init", "--kdf", "argon2id", "--full-encryption"},
+		{"list", "--long", "--where", "name=bank"},
+		{"stats", "--json"},
+		{"get", "My", "Bank", "--show"},
+		{"find", "bank", "--copy"},
+		{"delete", "--where", "name=bank", "--permanent"},
+		{"history", "gmail", "--show", "2"},
+		{"rename", "old", "new"},
+		{"rename", "--", "-old", "new"},
+		{"note", "add", "--tags", "a,b", "memo"},
+		{"note", "show", "memo", "--no-touch"},
+		{"report", "show", "report.json"},
+		{"retag", "--apply-rules", "--dry-run"},
+		{"reminders"},
+		{"reminders", "off"},
+		{"split", "--where", "name=bank", "--into", "bank.db", "--keep-tombstones"},
+		{"put", "--json", "-"},
+		{"put", "--json-file", "entry.json"},
+		{"sync", "import", "--prefer", "local", "--report", "r.json", "other.db"},
+		{"sync", "conflicts", "--long"},
+		{"sync", "conflicts", "restore", "--as", "copy", "3"},
+		{"totp", "gmail", "--at", "2025-01-01T00:00:00Z"},
+		{"totp", "set", "--secret", "JBSWY3DPEHPK3PXP", "--digits", "8", "gmail"},
+		{"totp", "verify", "My", "Bank", "123456"},
+		{"totp", "remove", "gmail"},
+		{"trash"},
+		{"trash", "--long"},
+		{"trash", "list", "--long"},
+		{"trash", "empty", "--older-than", "30d"},
+		{"restore", "gmail", "--as", "gmail (old)"},
+		{"update", "gmail", "--password"},
+		{"edit", "gmail", "--add-tags", "work", "--expires", "never"},
+		{"completion", "bash"},
+		{"interactive", "--lock-after", "10m"},
+		{"audit", "--max-age", "30", "--hide-acked"},
+		{"audit", "ack", "gmail", "--reason", "shared account"},
+		{"audit", "acks"},
+		{"backup", "create", "--tag", "work", "--tag", "home", "b.pmb"},
+		{"icon", "fetch", "--all", "--missing"},
+		{"import", "journal", "--long"},
+		{"import", "rollback", "--force", "op-1"},
+		{"export", "--format=json", "--out", "x.json", "--encrypted"},
+		{"viewer", "status"},
+		{"tag", "styles"},
+		{"change-master"},
+		{"unknown-to-checkArgs", "--anything"},
+	}
+	for _, args := range valid {
+		if err := checkArgs(args); err != nil {
+			t.Errorf("checkArgs(%q) failed: %v", args, err)
+		}
+	}
+
+	invalid := [][]string{
+		{"list", "--bogus"},
+		{"list", "--tag"},
+		{"list", "gmail"},
+		{"stats", "--bogus"},
+		{"stats", "extra"},
+		{"get"},
+		{"rename", "one"},
+		{"rename", "a", "b", "c"},
+		{"note"},
+		{"note", "edit", "memo"},
+		{"note", "add"},
+		{"report"},
+		{"report", "show"},
+		{"report", "show", "a.json", "b.json"},
+		{"retag"},
+		{"retag", "--dry-run"},
+		{"reminders", "sometimes"},
+		{"reminders", "on", "off"},
+		{"split", "--into", "bank.db"},
+		{"split", "--where", "name=", "--into", "bank.db"},
+		{"put"},
+		{"put", "--json", "entry.json"},
+		{"put", "--json", "-", "--json-file", "entry.json"},
+		{"sync"},
+		{"sync", "import"},
+		{"sync", "import", "--prefer", "first", "other.db"},
+		{"sync", "import", "--report-redact", "other.db"},
+		{"sync", "conflicts", "extra"},
+		{"sync", "conflicts", "restore", "three"},
+		{"totp"},
+		{"totp", "set", "gmail"},
+		{"totp", "set", "--uri", "otpauth://totp/x?secret=A", "--secret", "A", "gmail"},
+		{"totp", "set", "--digits", "six", "--secret", "A", "gmail"},
+		{"totp", "verify", "gmail"},
+		{"totp", "gmail", "--at", "tomorrow"},
+		{"trash", "purge"},
+		{"trash", "list", "extra"},
+		{"trash", "empty", "--older-than", "soon"},
+		{"trash", "--older-than", "30d"},
+		{"restore"},
+		{"restore", "gmail", "--as", " padded"},
+		{"update", "gmail"},
+		{"update", "gmail", "--password", "a", "--password", "b"},
+		{"update", "gmail", "--bogus", "x"},
+		{"completion"},
+		{"completion", "zsh"},
+		{"completion", "bash", "extra"},
+		{"interactive", "--lock-after", "soon"},
+		{"add", "extra"},
+		{"selftest", "--verbose"},
+		{"checksum", "word"},
+		{"change-master", "now"},
+		{"tag"},
+		{"tag", "colors"},
+		{"backup"},
+		{"icon", "fetch"},
+		{"audit", "--max-age", "-1"},
+		{"audit", "ack", "gmail"},
+	}
+	for _, args := range invalid {
+		if err := checkArgs(args); err == nil || errors.Is(err, flag.ErrHelp) {
+			t.Errorf("checkArgs(%q) = %v, want an error", args, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"get", "--help"},
+		{"note", "--help"},
+		{"note", "add", "--help"},
+		{"totp", "set", "--help"},
+		{"sync", "conflicts", "restore", "-h"},
+		{"tag", "--help"},
+		{"history", "gmail", "--help"},
+	} {
+		if err := checkArgs(args); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("checkArgs(%q) = %v, want flag.ErrHelp", args, err)
+		}
+	}
+}
+
+func TestParseTOTPArgs(t *testing.T) {
+	opts, err := parseTOTPArgs([]string{"verify", "--at", "2025-01-01T00:00:00Z", "My", "Bank", "123456"})
+	if err != nil || opts.command != "verify" || opts.name != "My Bank" || opts.code != "123456" || opts.at.Year() != 2025 {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	opts, err = parseTOTPArgs([]string{"set", "gmail", "--secret", "JBSWY3DPEHPK3PXP", "--algorithm", "SHA256", "--period", "60"})
+	if err != nil || opts.command != "set" || opts.name != "gmail" || opts.secret != "JBSWY3DPEHPK3PXP" || opts.algorithm != "SHA256" || opts.period != 60 || opts.digits != 0 {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	// A name may be a subcommand after "--"
+	if opts, err := parseTOTPArgs([]string{"--", "set"}); err != nil || opts.command != "" || opts.name != "set" {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+}
+
+func TestParseSyncArgs(t *testing.T) {
+	opts, err := parseSyncArgs([]string{"import", "other.db", "--report", "r.json", "--report-redact"})
+	if err != nil || opts.command != "import" || opts.file != "other.db" || opts.prefer != "newer" || opts.report != (reportOptions{"r.json", true}) {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	opts, err = parseSyncArgs([]string{"conflicts", "restore", "12", "--as", "copy"})
+	if err != nil || opts.command != "conflicts restore" || opts.id != 12 || opts.as != "copy" {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+}
+
+func TestParseTrashArgs(t *testing.T) {
+	opts, err := parseTrashArgs([]string{"--long"})
+	if err != nil || opts.command != "list" || !opts.long {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	opts, err = parseTrashArgs([]string{"empty", "--older-than", "7d"})
+	if err != nil || opts.command != "empty" || opts.olderThan < 6*24*time.Hour || opts.olderThan > 8*24*time.Hour {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	if opts, err := parseTrashArgs([]string{"empty"}); err != nil || opts.olderThan != 0 {
+		t.Errorf("Expected the whole trash to be emptied, got %+v, %v", opts, err)
+	}
+}
+
+func TestParseAuditArgsWhere(t *testing.T) {
+	opts, err := parseAuditArgs([]string{"--where", "tag=work", "--max-age", "90"})
+	if err != nil || opts.where == nil || opts.MaxAge != 90*24*time.Hour {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	if opts, err := parseAuditArgs(nil); err != nil || opts.where != nil {
+		t.Errorf("Expected no query without --where, got %+v, %v", opts, err)
+	}
+	for _, args := range [][]string{{"--where", "tag="}, {"--where", "tag=work", "--misplaced-secrets"}} {
+		if _, err := parseAuditArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
+
+func TestParseConfigArgs(t *testing.T) {
+	opts, err := parseConfigArgs([]string{"export", "--out", "pm.toml"})
+	if err != nil || opts.command != "export" || opts.out != "pm.toml" {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	opts, err = parseConfigArgs([]string{"import", "pm.toml"})
+	if err != nil || opts.command != "import" || opts.file != "pm.toml" {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+
+	for _, args := range [][]string{nil, {"show"}, {"export", "pm.toml"}, {"import"}, {"import", "--out", "x", "pm.toml"}} {
+		if _, err := parseConfigArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
+
+func TestCheckTagStyles(t *testing.T) {
+	if err := checkTagStyles(map[string]config.TagStyle{"work": {Color: "blue", Icon: "W"}, "home": {}}); err != nil {
+		t.Errorf("Expected valid styles, got %v", err)
+	}
+	for _, style := range []config.TagStyle{{Color: "purple"}, {Icon: "WW"}} {
+		if err := checkTagStyles(map[string]config.TagStyle{"work": style}); err == nil {
+			t.Errorf("Expected %+v to be refused", style)
+		}
+	}
+}
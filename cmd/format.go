@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+// loginFormat is the template behind --login-format: username then
+// password, one per line, without labels
+const loginFormat = `{username}\n{password}\n`
+
+// entryFields lists the placeholders a --format template may use
+var entryFields = map[string]func(*storage.PasswordEntry) string{
+	"name":     func(e *storage.PasswordEntry) string { return e.Name },
+	"username": func(e *storage.PasswordEntry) string { return e.Username },
+	"password": func(e *storage.PasswordEntry) string { return e.Password },
+	"url":      func(e *storage.PasswordEntry) string { return e.URL },
+	"notes":    func(e *storage.PasswordEntry) string { return e.Notes },
+	"tags":     func(e *storage.PasswordEntry) string { return strings.Join(e.Tags, ",") },
+	"type":     func(e *storage.PasswordEntry) string { return entryTypeName(e) },
+	"created":  func(e *storage.PasswordEntry) string { return e.CreatedAt.Format("2006-01-02 15:04:05") },
+	"updated":  func(e *storage.PasswordEntry) string { return e.UpdatedAt.Format("2006-01-02 15:04:05") },
+}
+
+// formatNow is the time {totp} gives the code of; tests fix it
+var formatNow = time.Now
+
+// formatTOTP returns the current one-time code of entry for {totp}, read
+// from the vault as it is not a field of the entry
+func formatTOTP(entry *storage.PasswordEntry) (string, error) {
+	params, err := database.TOTP(entry.Name)
+	if err != nil {
+		return "", err
+	}
+	if params == nil {
+		return "", fmt.Errorf("{totp} is not available: '%s' has no TOTP; add it with '%s totp set'", entry.Name, os.Args[0])
+	}
+	return params.Code(formatNow())
+}
+
+// formatEntry renders entry through a template such as
+// '{username}\t{password}\n'. Placeholders name entry fields; \n, \t and
+// \\ are escapes and {{ / }} produce literal braces. The whole template is
+// checked before anything is rendered, so an unknown placeholder never
+// leaves partial output. {totp} is the current one-time code, an error
+// for an entry without TOTP. With redacted set (viewer sessions)
+// {password}, {totp} and {notes} of a note are refused rather than
+// printed as empty lines.
+func formatEntry(template string, entry *storage.PasswordEntry, redacted bool) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '\\' && i+1 < len(template):
+			i++
+			switch template[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case '\\':
+				out.WriteByte('\\')
+			default:
+				return "", fmt.Errorf("unknown escape \\%c in format", template[i])
+			}
+		case c == '{' && strings.HasPrefix(template[i:], "{{"):
+			out.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(template[i:], "}}"):
+			out.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated placeholder in format: %s", template[i:])
+			}
+			field := template[i+1 : i+end]
+			value, ok := entryFields[field]
+			if !ok && field != "totp" {
+				return "", fmt.Errorf("unknown placeholder {%s} in format", field)
+			}
+			if redacted && (field == "password" || field == "totp" || (field == "notes" && entry.IsNote())) {
+				return "", fmt.Errorf("{%s} is not available: %w", field, storage.ErrReadOnly)
+			}
+			if field == "totp" {
+				code, err := formatTOTP(entry)
+				if err != nil {
+					return "", err
+				}
+				out.WriteString(code)
+			} else {
+				out.WriteString(value(entry))
+			}
+			i += end
+		case c == '}':
+			return "", fmt.Errorf("unmatched } in format (use }} for a literal brace)")
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+	"password-manager/internal/totp"
+)
+
+func testEntry() *storage.PasswordEntry {
+	return &storage.PasswordEntry{
+		Name:      "bank",
+		Username:  "john",
+		Password:  "hunter2",
+		URL:       "https://bank.example",
+		Tags:      []string{"finance", "home"},
+		CreatedAt: time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestFormatEntry(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{loginFormat, "john\nhunter2\n"},
+		{`{username}\t{password}\n`, "john\thunter2\n"},
+		{`{name} <{url}>`, "bank <https://bank.example>"},
+		{`{tags}`, "finance,home"},
+		{`{notes}`, ""},
+		{`{created}`, "2025-01-31 12:00:00"},
+		{`{{username}} \\n`, "{username} \\n"},
+		{"plain text", "plain text"},
+	}
+
+	for _, tt := range tests {
+		got, err := formatEntry(tt.template, testEntry(), false)
+		if err != nil {
+			t.Errorf("formatEntry(%q) failed: %v", tt.template, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("formatEntry(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestFormatEntryErrors(t *testing.T) {
+	for _, template := range []string{`{username}{pasword}`, `{username`, `user}`, `\x`, `{}`} {
+		if got, err := formatEntry(template, testEntry(), false); err == nil {
+			t.Errorf("Expected error for %q, got %q", template, got)
+		}
+	}
+}
+
+func TestFormatEntryRedacted(t *testing.T) {
+	if _, err := formatEntry(loginFormat, testEntry(), true); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Expected {password} to be refused in viewer sessions, got %v", err)
+	}
+	if got, err := formatEntry(`{username}`, testEntry(), true); err != nil || got != "john" {
+		t.Errorf("Expected other fields to render in viewer sessions, got %q (%v)", got, err)
+	}
+}
+
+func TestFormatEntryTOTP(t *testing.T) {
+	db, err := storage.CreateDatabase(filepath.Join(t.TempDir(), "vault.db"), "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	defer db.Close()
+	defer func(saved *storage.Database) { database = saved }(database)
+	database = db
+	defer func(saved func() time.Time) { formatNow = saved }(formatNow)
+	formatNow = func() time.Time { return time.Unix(59, 0) }
+
+	entry := testEntry()
+	if err := db.SavePassword(entry); err != nil {
+		t.Fatalf("SavePassword failed: %v", err)
+	}
+	// The SHA-1 secret of RFC 6238, whose 8-digit code at 59s is 94287082
+	params := &totp.Params{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", Digits: 8}
+	if err := db.SetTOTP(entry.Name, params); err != nil {
+		t.Fatalf("SetTOTP failed: %v", err)
+	}
+
+	got, err := formatEntry(`{username}\t{totp}\n`, entry, false)
+	if err != nil || got != "john\t94287082\n" {
+		t.Errorf("Expected the current code, got %q (%v)", got, err)
+	}
+	if _, err := formatEntry(`{totp}`, entry, true); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Expected {totp} to be refused in viewer sessions, got %v", err)
+	}
+
+	other := &storage.PasswordEntry{Name: "mail", Password: "x"}
+	if got, err := formatEntry(`{username}{totp}`, other, false); err == nil || !strings.Contains(err.Error(), "has no TOTP") || got != "" {
+		t.Errorf("Expected an error for an entry without TOTP, got %q (%v)", got, err)
+	}
+}
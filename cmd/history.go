@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// handleHistory lists when the earlier passwords of an entry were
+// replaced, and with --show <n> prints the nth of them, counting back
+// from the current one
+func handleHistory() {
+	name, version, long, err := parseHistoryArgs(os.Args[2:])
+	if err != nil {
+		failFlags(historyFlags(new(int), new(bool)), err, os.Args[0]+" history <name> [--show <n>] [--long]")
+	}
+
+	items, err := database.GetPasswordHistory(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	if version > 0 {
+		if version > len(items) {
+			fmt.Fprintf(os.Stderr, "Error: '%s' has no version %d; see '%s history %s'\n", name, version, os.Args[0], name)
+			exit(1)
+		}
+		item := items[version-1]
+		if item.Locked {
+			printError(fmt.Errorf("version %d of '%s' is encrypted to recipients you hold no identity for", version, name))
+			exit(1)
+		}
+		fmt.Printf("Password of '%s' replaced %s: %s\n", name, formatTime(item.ReplacedAt, long), item.Password)
+		return
+	}
+
+	if len(items) == 0 {
+		fmt.Printf("'%s' has no earlier passwords.\n", name)
+		return
+	}
+	fmt.Printf("Earlier passwords of '%s', newest first:\n", name)
+	for _, item := range items {
+		locked := ""
+		if item.Locked {
+			locked = " (encrypted to recipients)"
+		}
+		fmt.Printf("  %d  replaced %s%s\n", item.Version, formatTime(item.ReplacedAt, long), locked)
+	}
+	fmt.Printf("Show one with '%s history %s --show <n>'.\n", os.Args[0], name)
+}
+
+// historyFlags returns the flag set of history, filling version and long
+func historyFlags(version *int, long *bool) *flag.FlagSet {
+	fs := newFlagSet("history")
+	fs.IntVar(version, "show", 0, "print the password of version `n`, 1 for the one replaced last")
+	fs.BoolVar(long, "long", false, "show exact times")
+	return fs
+}
+
+// parseHistoryArgs reads the arguments of history: the name, made of all
+// positional arguments, the version of --show, 0 without it, and --long
+func parseHistoryArgs(args []string) (name string, version int, long bool, err error) {
+	fs := historyFlags(&version, &long)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if name = strings.Join(words, " "); name == "" {
+		return "", 0, false, fmt.Errorf("a name is needed")
+	}
+	if flagsGiven(fs)["show"] && version < 1 {
+		return "", 0, false, fmt.Errorf("--show takes a version number, 1 for the password replaced last")
+	}
+	return name, version, long, nil
+}
+
+// historyMatch returns the newest earlier password in items that
+// candidate matches, or nil. Every item is compared in constant time, so
+// how long it takes tells nothing of which matched.
+func historyMatch(candidate string, items []storage.HistoryItem) *storage.HistoryItem {
+	var match *storage.HistoryItem
+	for i := len(items) - 1; i >= 0; i-- {
+		if !items[i].Locked && subtle.ConstantTimeCompare([]byte(candidate), []byte(items[i].Password)) == 1 {
+			match = &items[i]
+		}
+	}
+	return match
+}
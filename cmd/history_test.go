@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+func TestHistoryMatch(t *testing.T) {
+	replaced := time.Now().AddDate(0, -3, 0)
+	items := []storage.HistoryItem{
+		{Version: 1, Password: "newer", ReplacedAt: replaced},
+		{Version: 2, Password: "reused"},
+		{Version: 3, Locked: true},
+		{Version: 4, Password: "reused"},
+	}
+	if item := historyMatch("newer", items); item == nil || item.Version != 1 || !item.ReplacedAt.Equal(replaced) {
+		t.Errorf("Expected version 1 to match, got %+v", item)
+	}
+	// A password used twice is reported by its latest use
+	if item := historyMatch("reused", items); item == nil || item.Version != 2 {
+		t.Errorf("Expected version 2 to match, got %+v", item)
+	}
+	for _, candidate := range []string{"", "newe", "newer ", "current"} {
+		if item := historyMatch(candidate, items); item != nil {
+			t.Errorf("Expected %q to match nothing, got %+v", candidate, item)
+		}
+	}
+}
+
+func TestParseVerifyArgs(t *testing.T) {
+	opts, err := parseVerifyArgs([]string{"My", "Bank", "--against", "history", "--stdin"})
+	if err != nil || opts.name != "My Bank" || !opts.history || !opts.stdin {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+	if opts, err := parseVerifyArgs([]string{"bank"}); err != nil || opts.history {
+		t.Errorf("Expected the current password only, got %+v, %v", opts, err)
+	}
+	for _, args := range [][]string{{"bank", "--against", "backup"}, {"bank", "--against"}} {
+		if _, err := parseVerifyArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
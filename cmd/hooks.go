@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"password-manager/internal/hooks"
+)
+
+var (
+	// noHooks is set by --no-hooks to skip the hooks of the config file
+	noHooks bool
+	// pendingHooks are the events of this run, whose hooks run once the
+	// vault is closed and a fully encrypted one has been sealed
+	pendingHooks []hooks.Event
+)
+
+// queueHook records a committed change for its hook to run at exit
+func queueHook(event, entry string) {
+	if noHooks || settings.Hooks.Command(event) == "" {
+		return
+	}
+	pendingHooks = append(pendingHooks, hooks.Event{Name: event, Entry: entry, VaultPath: dbPath})
+}
+
+// runHooks runs the queued hooks in order. A failing hook is reported
+// but does not undo the change, which is already on disk.
+func runHooks() {
+	runner := &hooks.Runner{Timeout: hooks.DefaultTimeout, Output: os.Stderr}
+	for _, event := range pendingHooks {
+		command := settings.Hooks.Command(event.Name)
+		if err := runner.Run(command, event); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: post_%s hook %s: %v\n", event.Name, command, err)
+		}
+	}
+	pendingHooks = nil
+}
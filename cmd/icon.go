@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"password-manager/internal/favicon"
+	"password-manager/internal/storage"
+)
+
+// handleIcon manages the site icons stored for entries. Icons are only
+// ever downloaded here, when asked for, so the sites an entry is for are
+// not contacted otherwise.
+func handleIcon() {
+	usage := os.Args[0] + " icon fetch <name>\n" +
+		"       " + os.Args[0] + " icon fetch --all [--missing]"
+	if len(os.Args) < 3 || os.Args[2] != "fetch" {
+		failFlags(nil, subcommandError("icon", os.Args[2:]), usage)
+	}
+	name, all, missing, err := parseIconFetchArgs(os.Args[3:])
+	if err != nil {
+		failFlags(iconFetchFlags(new(bool), new(bool)), err, usage)
+	}
+
+	var names, urls []string
+	if all {
+		names, urls, err = database.FaviconTargets(missing)
+	} else {
+		var entry *storage.PasswordEntry
+		if entry, err = database.GetPassword(name); err == nil {
+			if entry.URL == "" {
+				err = fmt.Errorf("'%s' has no URL to fetch an icon from", entry.Name)
+			}
+			names, urls = []string{entry.Name}, []string{entry.URL}
+		}
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fetcher := favicon.NewFetcher()
+	fetched, failed := 0, 0
+	for i, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		icon, err := fetcher.Fetch(ctx, urls[i])
+		if err == nil {
+			err = database.SetFavicon(name, &storage.Favicon{ContentType: icon.ContentType, Data: icon.Data})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: %s, %d bytes\n", name, icon.ContentType, len(icon.Data))
+		fetched++
+	}
+	if all {
+		fmt.Printf("%d fetched, %d failed\n", fetched, failed)
+	}
+	if failed > 0 || ctx.Err() != nil {
+		exit(1)
+	}
+}
+
+// iconFetchFlags returns the flag set of icon fetch, filling all and
+// missing
+func iconFetchFlags(all, missing *bool) *flag.FlagSet {
+	fs := newFlagSet("icon fetch")
+	fs.BoolVar(all, "all", false, "fetch the icons of every entry with a URL")
+	fs.BoolVar(missing, "missing", false, "with --all, only those of entries without one")
+	return fs
+}
+
+// parseIconFetchArgs reads the arguments of icon fetch: a name, made of
+// all positional arguments, or --all
+func parseIconFetchArgs(args []string) (name string, all, missing bool, err error) {
+	words, err := parseFlags(iconFetchFlags(&all, &missing), args)
+	if err != nil {
+		return "", false, false, err
+	}
+	name = strings.Join(words, " ")
+	switch {
+	case name != "" && all:
+		return "", false, false, fmt.Errorf("a name and --all cannot be combined")
+	case name == "" && !all:
+		return "", false, false, fmt.Errorf("a name or --all is needed")
+	case missing && !all:
+		return "", false, false, fmt.Errorf("--missing needs --all")
+	}
+	return name, all, missing, nil
+}
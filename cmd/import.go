@@ -0,0 +1,554 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/generator"
+	"password-manager/internal/hooks"
+	"password-manager/internal/importer"
+	"password-manager/internal/importreport"
+	"password-manager/internal/passstore"
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+
+	"golang.org/x/term"
+)
+
+// Conflict policies for entries that exist with different content
+const (
+	conflictSkip        = "skip"
+	conflictOverwrite   = "overwrite"
+	conflictInteractive = "interactive"
+	conflictRename      = "rename"
+)
+
+// handleImport reads entries from another tool: a pass store, the CSV
+// export of Bitwarden, LastPass or Chrome, or a KeePass XML export. Rows already stored with the
+// same content are skipped silently; rows whose name exists with a
+// different secret, username or URL follow --on-conflict, which may ask
+// about each one. Nothing is written until every conflict is resolved.
+// --report records the outcome of every row in a file. Every import is
+// recorded in the operations journal, so "import rollback" can undo it.
+func handleImport() {
+	if len(os.Args) > 2 {
+		switch os.Args[2] {
+		case "journal":
+			long, err := parseImportJournalArgs(os.Args[3:])
+			if err != nil {
+				failFlags(importJournalFlags(new(bool)), err, os.Args[0]+" import journal [--long]")
+			}
+			listImportJournal(long)
+			return
+		case "rollback":
+			importRollback(os.Args[3:])
+			return
+		}
+	}
+	opts, err := parseImportArgs(os.Args[2:])
+	if err != nil {
+		failFlags(importFlags(&importOptions{}), err, importUsage())
+	}
+	format, dir, onConflict, touchIdentical := opts.format, opts.dir, opts.onConflict, opts.touchIdentical
+	reportPath, redact := opts.report.path, opts.report.redact
+
+	// The retention setting is checked before anything is written
+	retention, err := duration.Parse(settings.JournalRetention(), duration.Expiry)
+	if err != nil {
+		printError(fmt.Errorf("config %s: import_journal_retention: %w", configPath, err))
+		exit(1)
+	}
+
+	start := time.Now()
+	var rows []importer.Row
+	var unreadable []*passstore.EntryError
+	source := dir
+	switch {
+	case format == "pass":
+		var entries []*storage.PasswordEntry
+		if entries, unreadable, err = passstore.Import(dir, &passstore.GPG{}); err != nil {
+			printError(err)
+			exit(1)
+		}
+		for _, entryErr := range unreadable {
+			fmt.Fprintf(os.Stderr, "Skipped %v\n", entryErr)
+		}
+		for _, entry := range entries {
+			rows = append(rows, importer.Row{Entry: entry})
+		}
+	default:
+		source = opts.file
+		if rows, err = readFileImport(format, source, opts.Options); err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+
+	var report *importreport.Report
+	if reportPath != "" {
+		if err := checkReportPath(reportPath, source); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if report, err = importreport.New("import", source, format, onConflict, start); err != nil {
+			printError(err)
+			exit(1)
+		}
+		for _, entryErr := range unreadable {
+			report.Add(importreport.Row{Name: entryErr.Name, Outcome: storage.OutcomeFailed, Reason: entryErr.Err.Error()})
+		}
+	}
+
+	outcomes := make([]storage.ImportOutcome, len(rows))
+	valid, index := validateRows(rows, outcomes)
+	for _, outcome := range outcomes {
+		if outcome.Outcome == storage.OutcomeFailed {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", outcome.Name, outcome.Reason)
+		}
+	}
+	failed := len(unreadable) + len(rows) - len(valid)
+	// finish writes the report, if asked for, once the rows have their
+	// outcomes
+	finish := func(imported []storage.ImportOutcome) {
+		for i, outcome := range imported {
+			outcomes[index[i]] = outcome
+		}
+		if report == nil {
+			return
+		}
+		addRows(report, rows, outcomes)
+		report.Finish(time.Now(), redact)
+		if err := importreport.Write(reportPath, report); err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+
+	if onConflict != conflictInteractive && !touchIdentical {
+		strategy := map[string]storage.ConflictStrategy{
+			conflictSkip:      storage.ConflictSkip,
+			conflictOverwrite: storage.ConflictOverwrite,
+			conflictRename:    storage.ConflictRename,
+		}[onConflict]
+		result, err := database.ImportEntries(valid, strategy)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		finish(result.Outcomes)
+		printImportReport(result, failed)
+		printOperation(result.Operation)
+		pruneJournal(retention)
+		queueHook(hooks.Import, "")
+		return
+	}
+
+	var resolve conflictResolver
+	restore := func() {}
+	if onConflict == conflictInteractive {
+		var resolver *tui.Resolver
+		resolver, restore = newTerminalResolver()
+		resolve = newConflictResolver(resolver)
+	}
+	counts, resolved, imported, operation, err := importEntries(valid, onConflict, touchIdentical, resolve)
+	restore()
+	if err == tui.ErrAborted {
+		fmt.Fprintln(os.Stderr, "Import aborted; the vault was not changed.")
+		exit(1)
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	finish(imported)
+
+	action := "skipped"
+	switch onConflict {
+	case conflictOverwrite:
+		action = "overwritten"
+	case conflictInteractive:
+		action = fmt.Sprintf("%d kept, %d taken, %d merged, %d skipped",
+			resolved[tui.Keep], resolved[tui.Take], resolved[tui.Merge], resolved[tui.Skip])
+	}
+	fmt.Printf("%d new, %d changed (%s), %d identical\n", counts.New, counts.Changed, action, counts.Identical)
+	printOperation(operation)
+	pruneJournal(retention)
+	queueHook(hooks.Import, "")
+}
+
+// validateRows checks the entry of each row, noting those that cannot be
+// imported in outcomes, and returns the valid entries with the index of
+// the row each came from. Rows holding only notes come in as secure
+// notes.
+func validateRows(rows []importer.Row, outcomes []storage.ImportOutcome) ([]*storage.PasswordEntry, []int) {
+	var valid []*storage.PasswordEntry
+	var index []int
+	for i, row := range rows {
+		entry := row.Entry
+		if entry.Password == "" && entry.Notes != "" {
+			entry.Type = storage.EntryTypeNote
+		}
+		if err := validateEntry(entry); err != nil {
+			outcomes[i] = storage.ImportOutcome{Name: entry.Name, Username: entry.Username, Outcome: storage.OutcomeFailed, Reason: err.Error()}
+			continue
+		}
+		valid = append(valid, entry)
+		index = append(index, i)
+	}
+	return valid, index
+}
+
+// addRows records the outcome of each row in report
+func addRows(report *importreport.Report, rows []importer.Row, outcomes []storage.ImportOutcome) {
+	for i, outcome := range outcomes {
+		report.Add(importreport.Row{
+			Line:     rows[i].Line,
+			Name:     outcome.Name,
+			Username: outcome.Username,
+			Outcome:  outcome.Outcome,
+			Reason:   outcome.Reason,
+		})
+	}
+}
+
+// importUsage returns the usage lines of import and its subcommands
+func importUsage() string {
+	return os.Args[0] + " import --format=pass --dir <store> [--on-conflict skip|overwrite|rename|interactive] [--treat-identical-as-update] [--report <file> [--report-redact]]\n" +
+		"       " + os.Args[0] + " import --format=" + strings.Join(importer.Formats, "|") + " <file> [--include-trash] [--on-conflict skip|overwrite|rename|interactive] [--treat-identical-as-update] [--report <file> [--report-redact]]\n" +
+		"       " + os.Args[0] + " import journal [--long]\n" +
+		"       " + os.Args[0] + " import rollback [--force] <operation-id>"
+}
+
+// importOptions are the arguments of import
+type importOptions struct {
+	importer.Options
+	format, dir, onConflict, file string
+	touchIdentical                bool
+	report                        reportOptions
+}
+
+// importFlags returns the flag set of import, filling opts
+func importFlags(opts *importOptions) *flag.FlagSet {
+	fs := newFlagSet("import")
+	fs.StringVar(&opts.format, "format", "", "read a pass store or one of "+strings.Join(importer.Formats, ", ")+" as `format`")
+	fs.StringVar(&opts.dir, "dir", "", "the pass store `dir` to read")
+	fs.StringVar(&opts.onConflict, "on-conflict", conflictSkip, "what to do with entries that exist with different content: skip, overwrite, rename or interactive, as `policy`")
+	fs.BoolVar(&opts.touchIdentical, "treat-identical-as-update", false, "count identical entries as updated, refreshing their change time")
+	fs.BoolVar(&opts.IncludeTrash, "include-trash", false, "import the entries of the KeePass recycle bin too")
+	opts.report.addFlags(fs)
+	return fs
+}
+
+// parseImportArgs reads the arguments of import: a pass store, or one
+// file of another format, and how to import it
+func parseImportArgs(args []string) (*importOptions, error) {
+	opts := &importOptions{}
+	fs := importFlags(opts)
+	files, err := parseFlags(fs, args)
+	if err == nil {
+		err = opts.report.check(flagsGiven(fs))
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.format == "pass":
+		if opts.dir == "" || len(files) > 0 {
+			return nil, fmt.Errorf("--format=pass needs --dir and no file")
+		}
+	case hasFlag(importer.Formats, opts.format):
+		if opts.dir != "" || len(files) != 1 {
+			return nil, fmt.Errorf("--format=%s needs one file and no --dir", opts.format)
+		}
+		opts.file = files[0]
+	default:
+		return nil, fmt.Errorf("unsupported import format %q (supported: pass, %s)", opts.format, strings.Join(importer.Formats, ", "))
+	}
+	if opts.IncludeTrash && opts.format != importer.FormatKeePassXML {
+		return nil, fmt.Errorf("--include-trash only applies to --format=%s", importer.FormatKeePassXML)
+	}
+	switch opts.onConflict {
+	case conflictSkip, conflictOverwrite, conflictInteractive:
+	case conflictRename:
+		if opts.touchIdentical {
+			return nil, fmt.Errorf("--on-conflict rename cannot be combined with --treat-identical-as-update")
+		}
+	default:
+		return nil, fmt.Errorf("--on-conflict must be skip, overwrite, rename or interactive")
+	}
+	return opts, nil
+}
+
+// importJournalFlags returns the flag set of import journal, filling long
+func importJournalFlags(long *bool) *flag.FlagSet {
+	fs := newFlagSet("import journal")
+	fs.BoolVar(long, "long", false, "show exact times")
+	return fs
+}
+
+// parseImportJournalArgs reads the arguments of import journal
+func parseImportJournalArgs(args []string) (long bool, err error) {
+	rest, err := parseFlags(importJournalFlags(&long), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	return long, err
+}
+
+// reportOptions are the --report flags of import and sync import
+type reportOptions struct {
+	path   string
+	redact bool
+}
+
+// addFlags adds --report and --report-redact to fs
+func (o *reportOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.path, "report", "", "record the outcome of every row in `file`")
+	fs.BoolVar(&o.redact, "report-redact", false, "leave the usernames out of the report")
+}
+
+// check reports a misuse of the report flags, given the flags set
+func (o reportOptions) check(given map[string]bool) error {
+	switch {
+	case given["report"] && o.path == "":
+		return fmt.Errorf("--report needs a file name")
+	case o.redact && o.path == "":
+		return fmt.Errorf("--report-redact needs --report")
+	}
+	return nil
+}
+
+// checkReportPath refuses a report path naming the vault or the source
+// being imported, which writing the report would destroy
+func checkReportPath(path, source string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	for _, other := range []string{dbPath, source} {
+		if otherInfo, err := os.Stat(other); err == nil && os.SameFile(info, otherInfo) {
+			return fmt.Errorf("--report %s would overwrite %s", path, other)
+		}
+	}
+	return nil
+}
+
+// readFileImport parses the export at path in format
+func readFileImport(format, path string, opts importer.Options) ([]importer.Row, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return importer.ParseRows(format, f, opts)
+}
+
+// printImportReport prints the summary of an import, with the count of
+// rows that could not be imported at all
+func printImportReport(report storage.ImportReport, failed int) {
+	fmt.Printf("%d created, %d skipped, %d failed", report.Created, report.Skipped, failed)
+	if report.Overwritten > 0 {
+		fmt.Printf(", %d overwritten", report.Overwritten)
+	}
+	if len(report.Renamed) > 0 {
+		fmt.Printf(", %d renamed", len(report.Renamed))
+	}
+	fmt.Println()
+	for _, name := range report.Renamed {
+		fmt.Printf("  stored as %s\n", name)
+	}
+}
+
+// conflictResolver decides what to store for an incoming entry whose name
+// exists with different content: the entry to write, or nil to leave the
+// stored one, and the action taken
+type conflictResolver func(existing, incoming *storage.PasswordEntry) (*storage.PasswordEntry, tui.Action, error)
+
+// newTerminalResolver asks on the terminal, with single keypresses unless
+// it is dumb or not a terminal. The returned function restores the
+// terminal and must run before anything else is printed.
+func newTerminalResolver() (*tui.Resolver, func()) {
+	fd := int(os.Stdin.Fd())
+	if stdinIsTerminal() && !tui.DumbTerminal() {
+		if state, err := term.MakeRaw(fd); err == nil {
+			return tui.NewResolver(stdin, os.Stdout, true), func() {
+				term.Restore(fd, state)
+			}
+		}
+	}
+	return tui.NewResolver(stdin, os.Stdout, false), func() {}
+}
+
+// conflictFieldNames are the fields compared side by side, in order
+var conflictFieldNames = []string{"type", "username", "password", "url", "notes", "tags"}
+
+// newConflictResolver resolves conflicts with r. Passwords and note
+// bodies are shown only as a fingerprint and strength; the fingerprint is
+// keyed per import, so it tells values apart without being reusable.
+func newConflictResolver(r *tui.Resolver) conflictResolver {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return func(existing, incoming *storage.PasswordEntry) (*storage.PasswordEntry, tui.Action, error) {
+			return nil, 0, fmt.Errorf("failed to generate fingerprint key: %w", err)
+		}
+	}
+
+	return func(existing, incoming *storage.PasswordEntry) (*storage.PasswordEntry, tui.Action, error) {
+		secretNotes := existing.IsNote() || incoming.IsNote()
+		before, after := conflictValues(existing), conflictValues(incoming)
+		conflict := &tui.Conflict{Name: incoming.Name}
+		for i, name := range conflictFieldNames {
+			field := tui.ConflictField{Name: name, Existing: before[i], Incoming: after[i]}
+			if name == "password" || (name == "notes" && secretNotes) {
+				field.Existing = maskSecret(key, before[i])
+				field.Incoming = maskSecret(key, after[i])
+			}
+			conflict.Fields = append(conflict.Fields, field)
+		}
+
+		resolution, err := r.Resolve(conflict)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch resolution.Action {
+		case tui.Take:
+			return incoming, tui.Take, nil
+		case tui.Merge:
+			merged := mergeEntries(existing, incoming, resolution.TakeField)
+			if err := validateEntry(merged); err != nil {
+				return nil, 0, fmt.Errorf("%s: merged entry is invalid: %w", merged.Name, err)
+			}
+			return merged, tui.Merge, nil
+		}
+		return nil, resolution.Action, nil
+	}
+}
+
+// conflictValues returns the fields of conflictFieldNames of an entry
+func conflictValues(entry *storage.PasswordEntry) []string {
+	entryType := entry.Type
+	if entryType == "" {
+		entryType = storage.EntryTypeLogin
+	}
+	return []string{entryType, entry.Username, entry.Password, entry.URL, entry.Notes, strings.Join(entry.Tags, ", ")}
+}
+
+// mergeEntries returns existing with the fields chosen in take, indexed
+// like conflictFieldNames, copied from incoming
+func mergeEntries(existing, incoming *storage.PasswordEntry, take []bool) *storage.PasswordEntry {
+	merged := *existing
+	for i, name := range conflictFieldNames {
+		if i >= len(take) || !take[i] {
+			continue
+		}
+		switch name {
+		case "type":
+			merged.Type = incoming.Type
+		case "username":
+			merged.Username = incoming.Username
+		case "password":
+			merged.Password = incoming.Password
+		case "url":
+			merged.URL = incoming.URL
+		case "notes":
+			merged.Notes = incoming.Notes
+		case "tags":
+			merged.Tags = incoming.Tags
+		}
+	}
+	return &merged
+}
+
+// maskSecret describes a secret by a keyed fingerprint and its strength
+func maskSecret(key []byte, secret string) string {
+	if secret == "" {
+		return "(empty)"
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(secret))
+	level := generator.Analyze(secret).Level
+	return fmt.Sprintf("#%s, %s", hex.EncodeToString(mac.Sum(nil)[:4]), level)
+}
+
+// importEntries stores the entries according to how they compare with
+// the vault and returns the counts of each class, of each action resolve
+// took, the outcome of each entry and the ID of the import in the
+// operations journal. Conflicts are all resolved first and the result
+// written in one transaction, so an error or abort leaves the vault
+// unchanged.
+func importEntries(entries []*storage.PasswordEntry, onConflict string, touchIdentical bool, resolve conflictResolver) (storage.ImportCounts, map[tui.Action]int, []storage.ImportOutcome, string, error) {
+	classes, err := database.ClassifyImport(entries)
+	if err != nil {
+		return storage.ImportCounts{}, nil, nil, "", err
+	}
+
+	plan := &storage.ImportPlan{}
+	resolved := make(map[tui.Action]int)
+	outcomes := make([]storage.ImportOutcome, len(entries))
+	// A name is written once; later rows repeating it are skipped
+	planned := make(map[string]bool)
+	for i, entry := range entries {
+		outcome := storage.ImportOutcome{Name: entry.Name, Username: entry.Username, Outcome: storage.OutcomeSkipped}
+		if planned[entry.Name] {
+			outcome.Reason = "repeats an earlier entry"
+			outcomes[i] = outcome
+			continue
+		}
+		switch classes[i] {
+		case storage.ImportIdentical:
+			outcome.Reason = "already stored with the same content"
+			if touchIdentical {
+				plan.Touch = append(plan.Touch, entry.Name)
+				outcome.Outcome, outcome.Reason = storage.OutcomeUpdated, "identical; marked as updated"
+			}
+		case storage.ImportChanged:
+			outcome.Reason = "name taken by an entry with different content"
+			if onConflict == conflictOverwrite {
+				plan.Update = append(plan.Update, entry)
+				outcome.Outcome, outcome.Reason = storage.OutcomeUpdated, "replaced the stored entry"
+			}
+			if onConflict != conflictInteractive {
+				break
+			}
+			existing, err := database.GetPassword(entry.Name)
+			if err != nil {
+				return storage.ImportCounts{}, nil, nil, "", fmt.Errorf("%s: %w", entry.Name, err)
+			}
+			chosen, action, err := resolve(existing, entry)
+			if err != nil {
+				return storage.ImportCounts{}, nil, nil, "", err
+			}
+			resolved[action]++
+			outcome.Reason = "kept the stored entry when asked"
+			if action == tui.Skip {
+				outcome.Reason = "skipped when asked"
+			}
+			if chosen != nil {
+				plan.Update = append(plan.Update, chosen)
+				outcome.Outcome, outcome.Reason = storage.OutcomeUpdated, "took the imported entry when asked"
+				if action == tui.Merge {
+					outcome.Reason = "merged with the stored entry when asked"
+				}
+			}
+		default:
+			plan.Save = append(plan.Save, entry)
+			outcome.Outcome = storage.OutcomeImported
+		}
+		planned[entry.Name] = outcome.Outcome != storage.OutcomeSkipped
+		outcomes[i] = outcome
+	}
+
+	operation, err := database.ApplyImport(plan)
+	if err != nil {
+		return storage.ImportCounts{}, nil, nil, "", err
+	}
+	return storage.CountImport(classes), resolved, outcomes, operation, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"password-manager/internal/importreport"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+func TestImportReport(t *testing.T) {
+	defer tmpfile.Cleanup()
+	defer func(saved []string) { os.Args = saved }(os.Args)
+	defer func(saved func(int)) { exit = saved }(exit)
+	exit = func(code int) { panic(exitStatus(code)) }
+
+	dir := t.TempDir()
+	db, err := storage.CreateDatabase(filepath.Join(dir, "vault.db"), "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	defer db.Close()
+	for _, entry := range []*storage.PasswordEntry{
+		{Name: "same", Username: "bob", Password: "Same-Secret-2"},
+		{Name: "changed", Username: "carol", Password: "Old-Secret-3"},
+	} {
+		if err := db.SavePassword(entry); err != nil {
+			t.Fatalf("SavePassword failed: %v", err)
+		}
+	}
+	defer func(saved *storage.Database) { database = saved }(database)
+	database = db
+
+	// The fixture has a row for every outcome
+	fixture := filepath.Join("testdata", "import_report", "bitwarden.csv")
+	out := filepath.Join(dir, "report.json")
+	if status := runShellCommand("pm", []string{"import", "--format=bitwarden", fixture, "--on-conflict", "overwrite", "--report", out}); status != 0 {
+		t.Fatalf("Expected the import to succeed, got status %d", status)
+	}
+	report, err := importreport.Read(out)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	want := []importreport.Row{
+		{Line: 2, Name: "fresh", Username: "alice", Outcome: storage.OutcomeImported},
+		{Line: 3, Name: "same", Username: "bob", Outcome: storage.OutcomeSkipped, Reason: "already stored with the same content"},
+		{Line: 4, Name: "changed", Username: "carol", Outcome: storage.OutcomeUpdated, Reason: "replaced the stored entry"},
+		{Line: 6, Name: "blank", Username: "dave", Outcome: storage.OutcomeFailed, Reason: "password cannot be empty"},
+	}
+	if !reflect.DeepEqual(report.Rows, want) {
+		t.Errorf("Expected rows\n%+v\ngot\n%+v", want, report.Rows)
+	}
+	if (report.Counts != importreport.Counts{Imported: 1, Updated: 1, Skipped: 1, Failed: 1}) {
+		t.Errorf("Unexpected counts %+v", report.Counts)
+	}
+	if report.Schema != importreport.SchemaVersion || report.Command != "import" || report.ConflictPolicy != "overwrite" ||
+		report.Source.Format != "bitwarden" || len(report.Source.SHA256) != 64 || report.AppVersion == "" {
+		t.Errorf("Unexpected report header %+v", report)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"Fresh-Secret-1", "Same-Secret-2", "New-Secret-3", "new server"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("Expected the report to leave out %q", secret)
+		}
+	}
+	if info, err := os.Stat(out); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the report to be private, got %v, %v", info.Mode(), err)
+	}
+
+	// Again with usernames redacted, every row is now stored
+	if status := runShellCommand("pm", []string{"import", "--format=bitwarden", fixture, "--report", out, "--report-redact"}); status != 0 {
+		t.Fatalf("Expected the import to succeed, got status %d", status)
+	}
+	if report, err = importreport.Read(out); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !report.UsernamesRedacted || report.Counts.Skipped != 3 || report.Counts.Failed != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	for _, row := range report.Rows {
+		if row.Username != importreport.Redacted {
+			t.Errorf("Expected the username of %s redacted, got %q", row.Name, row.Username)
+		}
+	}
+
+	var shown bytes.Buffer
+	report.Print(&shown)
+	for _, line := range []string{"0 imported, 0 updated, 3 skipped, 1 failed", "failed   line 6: blank ([redacted]): password cannot be empty"} {
+		if !strings.Contains(shown.String(), line) {
+			t.Errorf("Expected %q in\n%s", line, shown.String())
+		}
+	}
+}
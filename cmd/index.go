@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// handleIndex maintains the derived indexes of the vault
+func handleIndex() {
+	if err := parseIndexArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" index rebuild-reuse")
+	}
+
+	n, err := database.RebuildReuseIndex()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf("Reuse index rebuilt: %d passwords indexed.\n", n)
+}
+
+// parseIndexArgs checks the arguments of index: its one subcommand,
+// which takes no arguments
+func parseIndexArgs(args []string) error {
+	if len(args) == 0 || args[0] != "rebuild-reuse" {
+		return subcommandError("index", args)
+	}
+	return parseNoArgs(args[1:])
+}
+
+// warnReuse warns when password is already used by entries other than
+// the one with ID self. The check never stops the save.
+func warnReuse(password string, self int64) {
+	if database.IsViewer() || database.NeedsUpgrade() {
+		return
+	}
+	names, err := database.ReusedBy(password, self)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not check for password reuse: %v\n", err)
+		return
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: this password is already used by %s\n", quoteNames(names))
+	}
+}
+
+// quoteNames lists entry names for a message
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	if len(names) == 1 {
+		return "entry " + quoted[0]
+	}
+	return "entries " + strings.Join(quoted, ", ")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+)
+
+// weakLevels are the strength levels init asks about before accepting a
+// master password
+var weakLevels = map[string]bool{
+	"Empty":     true,
+	"Very Weak": true,
+	"Weak":      true,
+}
+
+// initFlags returns the flag set of init, filling options
+func initFlags(options *storage.InitOptions) *flag.FlagSet {
+	fs := newFlagSet("init")
+	fs.StringVar(&options.KDF, "kdf", "", "derive keys with `kdf`: "+strings.Join(storage.KDFs, " or ")+" (default "+storage.KDFs[0]+")")
+	fs.StringVar(&options.Cipher, "cipher", "", "encrypt with `cipher`: "+strings.Join(storage.Ciphers, " or ")+" (default "+storage.Ciphers[0]+")")
+	fs.BoolVar(&options.FullEncryption, "full-encryption", false, "encrypt the whole file, not only the secrets")
+	return fs
+}
+
+// parseInitArgs reads the arguments of init into the options of the new
+// vault
+func parseInitArgs(args []string) (storage.InitOptions, error) {
+	var options storage.InitOptions
+	rest, err := parseFlags(initFlags(&options), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return options, err
+	}
+	options.KDF = strings.ToLower(options.KDF)
+	options.Cipher = strings.ToLower(options.Cipher)
+	return options, options.Validate()
+}
+
+// handleInit creates a new vault. It is the only command that creates
+// one; every other command refuses to run without a vault.
+func handleInit() {
+	options, err := parseInitArgs(os.Args[2:])
+	if err != nil {
+		usage := fmt.Sprintf("%s init [--db <path>] [--kdf %s] [--cipher %s] [--full-encryption]",
+			os.Args[0], strings.Join(storage.KDFs, "|"), strings.Join(storage.Ciphers, "|"))
+		failFlags(initFlags(&storage.InitOptions{}), err, usage)
+	}
+
+	if err := checkDBPath(dbPath); err != nil {
+		printError(err)
+		exit(1)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		fmt.Fprintf(os.Stderr, "Error: a vault already exists at %s\n", dbPath)
+		exit(1)
+	}
+
+	password, err := chooseMasterPassword("vault not created")
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	// One derivation is what every unlock costs on this machine
+	start := time.Now()
+	if _, err := crypto.DeriveKey(password, make([]byte, crypto.SaltLength)); err != nil {
+		printError(err)
+		exit(1)
+	}
+	elapsed := time.Since(start)
+
+	db, err := storage.CreateDatabase(dbPath, password, options)
+	if err != nil {
+		printError(fmt.Errorf("failed to create vault: %w", err))
+		exit(1)
+	}
+	if err := db.Close(); err != nil {
+		printError(fmt.Errorf("failed to close vault: %w", err))
+		exit(1)
+	}
+
+	fmt.Printf("Vault created at %s\n", dbPath)
+	fmt.Printf("Key derivation: %s, %s per key on this machine\n",
+		crypto.DefaultKDF, elapsed.Round(time.Millisecond))
+	if options.FullEncryption {
+		fmt.Println("Whole-file encryption: on")
+	}
+}
+
+// chooseMasterPassword asks for a new master password twice and asks for
+// confirmation before accepting a weak one; declining it is an error
+// saying declined
+func chooseMasterPassword(declined string) (string, error) {
+	password, err := readSecret("Choose a master password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("master password cannot be empty")
+	}
+	repeated, err := readSecret("Repeat the master password: ")
+	if err != nil {
+		return "", err
+	}
+	if !crypto.SecretsEqual(password, repeated) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+
+	level := generator.Analyze(password).Level
+	if weakLevels[level] {
+		fmt.Printf("Warning: this master password is %s and protects every entry.\n", strings.ToLower(level))
+		fmt.Print("Use it anyway? (y/N): ")
+		answer, err := readLine()
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return "", errors.New(declined)
+		}
+	}
+	return password, nil
+}
+
+// handleChangeMaster replaces the master password the vault was just
+// unlocked with, re-encrypting every entry
+func handleChangeMaster() {
+	if err := parseNoArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" change-master")
+	}
+	if database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+
+	password, err := chooseMasterPassword("master password not changed")
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	next := []byte(password)
+	hadViewer, err := database.ChangeMasterPassword(masterSecret.Reveal(), next)
+	if err != nil {
+		printError(fmt.Errorf("failed to change master password: %w", err))
+		exit(1)
+	}
+	masterSecret.Wipe()
+	masterSecret = crypto.NewSecretString(next)
+
+	fmt.Println("Master password changed; every entry is re-encrypted under a new key.")
+	if hadViewer {
+		fmt.Printf("The viewer credential was removed; issue a new one with '%s viewer enable'.\n", os.Args[0])
+	}
+}
+
+// handleMigrateKDF re-encrypts what older versions derived with PBKDF2
+// under Argon2id keys
+func handleMigrateKDF() {
+	if err := parseNoArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" migrate-kdf")
+	}
+
+	n, err := database.MigrateKDF(masterSecret.Reveal())
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf("Key derivation migrated to Argon2id: %d entries re-encrypted.\n", n)
+}
+
+// handleUpgrade moves a vault written by an older version to the format
+// of this one, making it writable again
+func handleUpgrade() {
+	if err := parseNoArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" upgrade")
+	}
+
+	from, err := database.MinAppVersion()
+	if err == nil && !database.NeedsUpgrade() {
+		fmt.Printf("The vault is already in the format of v%s; nothing to upgrade.\n", from)
+		return
+	}
+	var applied []string
+	if err == nil {
+		applied, err = database.Upgrade()
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	to, _ := database.MinAppVersion()
+	fmt.Printf("Vault upgraded from the format of v%s to v%s:\n", from, to)
+	for _, change := range applied {
+		fmt.Printf("  - %s\n", change)
+	}
+	fmt.Printf("Versions before v%s can no longer open it.\n", to)
+}
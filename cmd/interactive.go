@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+)
+
+// interactiveCommands are the commands the interactive shell runs.
+// Commands that reopen or replace the vault, such as change-master,
+// convert and sync, and put, which reads stdin to its end, stay one-shot.
+var interactiveCommands = []string{
+	"get", "find", "history", "copy", "save", "add", "update", "edit", "rename", "list", "search",
+	"delete", "del", "trash", "restore", "generate", "gen", "stats", "analyze", "verify", "totp",
+	"note", "tag", "recipients", "reminders", "expiring", "audit", "comply", "report", "checksum",
+}
+
+// handleInteractive runs a shell on the vault main has unlocked, so the
+// master password is entered and the key derived once for many commands.
+// After the idle time without a command the vault is closed and the
+// master password overwritten; the next command that needs the vault
+// asks for it again. The same happens when the system sleeps or the
+// screen locks, which the idle timer alone would miss, as it stops while
+// the machine sleeps. Hooks of the session run whenever the vault closes.
+func handleInteractive() {
+	idle, err := parseLockAfter(os.Args[2:])
+	if err != nil {
+		failFlags(interactiveFlags(new(string)), err, os.Args[0]+" interactive [--lock-after <duration>]")
+	}
+
+	// Command lines are kept across sessions at a terminal only, so piped
+	// scripts leave no history
+	var history *tui.History
+	if stdinIsTerminal() {
+		if history, err = tui.LoadHistory(historyPath, keepInHistory); err != nil {
+			printError(err)
+			history, _ = tui.LoadHistory("", keepInHistory)
+		}
+	}
+
+	fmt.Printf("%s v%s. Type help for the commands, quit or Ctrl-D to leave.\n", appName, version)
+	sh := &shell{
+		history:  history,
+		prompt:   "pm> ",
+		commands: interactiveCommands,
+		idle:     idle,
+		onIdle: func() {
+			if database == nil {
+				return
+			}
+			lockVault()
+			fmt.Printf("Locked after %s without a command; the next one asks for the master password.\n", idle)
+		},
+		onSuspend: func() {
+			if database == nil {
+				return
+			}
+			lockVault()
+			fmt.Println("Locked as the system slept or the screen locked; the next command asks for the master password.")
+		},
+		before: func(args []string) error {
+			if err := openForCommand(args); err != nil {
+				return err
+			}
+			// The refresh waits while a command runs
+			if refresher != nil {
+				refresher.Begin()
+			}
+			return nil
+		},
+		after: func() {
+			if refresher != nil {
+				refresher.End()
+			}
+		},
+		builtins: map[string]func(){
+			"reload": reloadVault,
+			"status": func() { showShellStatus(idle) },
+		},
+	}
+	if database != nil {
+		startRefresh()
+	}
+	sh.run()
+	stopRefresh()
+}
+
+// openForCommand opens the vault for a command of the shell that needs
+// it, if it is locked
+func openForCommand(args []string) error {
+	// Nothing runs on a vault whose drive has gone until reload
+	if database != nil {
+		return database.CheckFile()
+	}
+	if !needsVault(args) {
+		return nil
+	}
+	if err := initializeDatabase(); err != nil {
+		return err
+	}
+	if err := setupDatabase(); err != nil {
+		return err
+	}
+	showDigest(args)
+	startRefresh()
+	return nil
+}
+
+// reloadVault picks the vault up again once the drive holding it is back.
+// When another file has taken its place, the vault is locked instead, and
+// the next command opens the file now there.
+func reloadVault() {
+	if database == nil {
+		fmt.Println("The vault is locked; the next command opens it.")
+		return
+	}
+	err := database.Reload()
+	switch {
+	case errors.Is(err, storage.ErrVaultReplaced):
+		lockVault()
+		fmt.Printf("%s is not the file that was open; the vault is locked, and the next command opens it as it is now.\n", dbPath)
+	case err != nil:
+		printError(err)
+	default:
+		fmt.Println("The vault file is back.")
+	}
+}
+
+// lockVault closes the vault, sealing a fully encrypted one, runs the
+// hooks queued so far and overwrites the master password. The keys the
+// closed vault derived from it are strings, which cannot be overwritten;
+// they are dropped with it.
+func lockVault() {
+	stopRefresh()
+	if err := shutDatabase(); err != nil {
+		printError(fmt.Errorf("failed to close database: %w", err))
+	}
+	runHooks()
+	masterSecret.Wipe()
+	masterSecret = nil
+}
+
+// interactiveFlags returns the flag set of interactive, filling lockAfter
+func interactiveFlags(lockAfter *string) *flag.FlagSet {
+	fs := newFlagSet("interactive")
+	fs.StringVar(lockAfter, "lock-after", "", "lock after `duration` without a command, 0 for never (default idle_lock_after of the config)")
+	return fs
+}
+
+// parseLockAfter reads --lock-after, or idle_lock_after from the config,
+// as the idle time of the interactive shell; 0 means it never locks
+func parseLockAfter(args []string) (time.Duration, error) {
+	var value string
+	fs := interactiveFlags(&value)
+	rest, err := parseFlags(fs, args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !flagsGiven(fs)["lock-after"] {
+		value = settings.IdleLock()
+	}
+	spec, err := duration.Parse(value, duration.Short)
+	if err != nil || spec.IsAbsolute() {
+		return 0, fmt.Errorf("invalid lock-after duration %q (such as 5m or 1h, or 0 to never lock)", value)
+	}
+	return spec.Duration(time.Now()), nil
+}
+
+// flagSets returns the flag sets of the shell commands with flags
+// taking secrets, from which those flags are read
+var flagSets = map[string]func() *flag.FlagSet{
+	"save": func() *flag.FlagSet { return saveFlags(&storage.PasswordEntry{}, &saveOptions{}) },
+	"generate": func() *flag.FlagSet {
+		return generateFlags(generator.DefaultConfig(), &generateOptions{})
+	},
+	"update": func() *flag.FlagSet { return updateFlags(&updateOptions{}) },
+	"edit":   func() *flag.FlagSet { return updateFlags(&updateOptions{}) },
+	"totp":   func() *flag.FlagSet { return totpFlags("set", &totpOptions{}) },
+}
+
+// keepInHistory reports whether the shell may keep a command line in its
+// history: not when it gives a secret in a flag, nor when it passes
+// analyze a password or searches passwords for its query. Lines that do
+// not split into words are not kept either, as what they hold cannot be
+// told.
+func keepInHistory(line string) bool {
+	args, err := shellWords(line)
+	if err != nil || len(args) == 0 {
+		return false
+	}
+	if args[0] == "search" && hasFlag(args, "--include-passwords") {
+		return false
+	}
+	command := args[0]
+	if command == "gen" {
+		command = "generate"
+	}
+	secret := make(map[string]bool)
+	if newFlags := flagSets[command]; newFlags != nil {
+		for _, name := range secretFlags(newFlags()) {
+			secret[name] = true
+		}
+	}
+
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			// Only analyze takes a secret after the flags
+			return command != "analyze"
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if command == "analyze" {
+				return false
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if secret[name] {
+			return false
+		}
+	}
+	return true
+}
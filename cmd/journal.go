@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/hooks"
+	"password-manager/internal/storage"
+)
+
+// printOperation tells how to undo the import recorded as operation
+func printOperation(operation string) {
+	if operation == "" {
+		return
+	}
+	fmt.Printf("Recorded as import %s; undo it with '%s import rollback %s'.\n", operation, os.Args[0], operation)
+}
+
+// pruneJournal drops the before-images of imports older than retention
+func pruneJournal(retention duration.Spec) {
+	pruned, err := database.PruneOperations(retention.Before(time.Now()))
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if pruned > 0 {
+		fmt.Printf("Pruned the journal of %d imports older than %s; they can no longer be rolled back.\n", pruned, settings.JournalRetention())
+	}
+}
+
+// listImportJournal prints the imports of the operations journal, newest
+// first
+func listImportJournal(long bool) {
+	operations, err := database.Operations()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if len(operations) == 0 {
+		fmt.Println("No imports in the journal.")
+		return
+	}
+
+	for _, op := range operations {
+		fmt.Printf("%s  %s  %s  %d created, %d updated", op.ID, formatTime(op.CreatedAt, long), op.Kind, op.Created, op.Updated)
+		switch {
+		case op.Pending == 0:
+			fmt.Print("  rolled back")
+		case op.Pending < op.Created+op.Updated:
+			fmt.Printf("  partly rolled back, %d pending", op.Pending)
+		}
+		if op.Pruned {
+			fmt.Print("  (pruned)")
+		}
+		fmt.Println()
+	}
+}
+
+// rollbackVerbs describe the outcomes of a rollback in its report
+var rollbackVerbs = map[string]string{
+	storage.RollbackTrashed:  "moved to the trash",
+	storage.RollbackRestored: "restored to its state before the import",
+	storage.RollbackGone:     "already deleted",
+	storage.RollbackConflict: "left as it is",
+}
+
+// importRollback undoes an import recorded in the operations journal and
+// prints what became of each entry
+func importRollback(args []string) {
+	id, force, err := parseImportRollbackArgs(args)
+	if err != nil {
+		failFlags(importRollbackFlags(new(bool)), err, os.Args[0]+" import rollback [--force] <operation-id>")
+		return
+	}
+
+	report, err := database.RollbackOperation(id, force)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	fmt.Printf("Rolled back import %s:\n", id)
+	conflicts := 0
+	for _, entry := range report {
+		line := fmt.Sprintf("  %s: %s", entry.Name, rollbackVerbs[entry.Outcome])
+		if entry.Reason != "" {
+			line += " (" + entry.Reason + ")"
+		}
+		fmt.Println(line)
+		if entry.Outcome == storage.RollbackConflict {
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		fmt.Printf("\n%d entries changed after the import were left as they are. Choose for each: keep it, or\n", conflicts)
+		fmt.Printf("run '%s import rollback --force %s' to roll the changed ones back too.\n", os.Args[0], id)
+	}
+	queueHook(hooks.Import, "")
+}
+
+// importRollbackFlags returns the flag set of import rollback, filling
+// force
+func importRollbackFlags(force *bool) *flag.FlagSet {
+	fs := newFlagSet("import rollback")
+	fs.BoolVar(force, "force", false, "roll back entries changed since the import too, losing those changes")
+	return fs
+}
+
+// parseImportRollbackArgs reads the arguments of import rollback: one
+// operation ID, and --force
+func parseImportRollbackArgs(args []string) (id string, force bool, err error) {
+	rest, err := parseFlags(importRollbackFlags(&force), args)
+	if err == nil && len(rest) != 1 {
+		err = fmt.Errorf("one operation ID is needed")
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return rest[0], force, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"password-manager/internal/storage"
+)
+
+// jsonOptions are the flags get, list, search and stats take for JSON
+// output
+type jsonOptions struct {
+	json, includeSecrets bool
+}
+
+// addFlags adds --json and --include-secrets to fs
+func (o *jsonOptions) addFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.json, "json", false, "print JSON to script against")
+	fs.BoolVar(&o.includeSecrets, "include-secrets", false, "include passwords and notes in the JSON")
+}
+
+// check reports a misuse of the JSON flags: --include-secrets only means
+// something with --json, and needs the master password
+func (o jsonOptions) check() error {
+	switch {
+	case o.includeSecrets && !o.json:
+		return fmt.Errorf("--include-secrets needs --json")
+	case o.includeSecrets && database != nil && database.IsViewer():
+		return fmt.Errorf("secrets are redacted in viewer sessions")
+	}
+	return nil
+}
+
+// entryJSON returns a copy of entry as written to JSON output: the fields
+// of its json tags, with the password, notes and acknowledged findings
+// left empty unless includeSecrets, as an export leaves them. Tags are an
+// empty array rather than null, so scripts can always iterate them.
+func entryJSON(entry *storage.PasswordEntry, includeSecrets bool) *storage.PasswordEntry {
+	out := *entry
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	if !includeSecrets {
+		out.Password = ""
+		out.Notes = ""
+		out.Acks = nil
+	}
+	return &out
+}
+
+// writeEntriesJSON writes entries to w as a JSON array, empty rather than
+// null when there are none
+func writeEntriesJSON(w io.Writer, entries []*storage.PasswordEntry, includeSecrets bool) error {
+	out := make([]*storage.PasswordEntry, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entryJSON(entry, includeSecrets))
+	}
+	return writeJSON(w, out)
+}
+
+// matchJSON is a search match as written to JSON output: the entry as
+// entryJSON writes it, with the fields that matched
+type matchJSON struct {
+	*storage.PasswordEntry
+	Matched []string `json:"matched"`
+}
+
+// writeMatchesJSON writes the entries of search matches to w as a JSON
+// array, each with the fields that matched, empty rather than null when
+// there are none
+func writeMatchesJSON(w io.Writer, matches []storage.SearchMatch, includeSecrets bool) error {
+	out := make([]matchJSON, 0, len(matches))
+	for _, match := range matches {
+		out = append(out, matchJSON{entryJSON(match.Entry, includeSecrets), match.Fields})
+	}
+	return writeJSON(w, out)
+}
+
+// writeJSON writes v to w indented, on lines of its own
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// printJSON writes v to stdout, exiting on failure
+func printJSON(v interface{}) {
+	if err := writeJSON(os.Stdout, v); err != nil {
+		printError(err)
+		exit(1)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+// TestJSONOutputGolden compares the --json output of get, list, search and
+// stats with the .golden files of testdata, the shape scripts rely on
+func TestJSONOutputGolden(t *testing.T) {
+	stats := map[string]interface{}{
+		"total_passwords": 3,
+		"database_size":   int64(40960),
+		"full_encryption": false,
+		"created_at":      time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		golden string
+		write  func(w *bytes.Buffer) error
+	}{
+		{"get.golden", func(w *bytes.Buffer) error { return writeJSON(w, entryJSON(testEntry(), false)) }},
+		{"get_secrets.golden", func(w *bytes.Buffer) error { return writeJSON(w, entryJSON(testEntry(), true)) }},
+		{"list.golden", func(w *bytes.Buffer) error { return writeEntriesJSON(w, listEntries(), false) }},
+		{"list_secrets.golden", func(w *bytes.Buffer) error { return writeEntriesJSON(w, listEntries(), true) }},
+		{"search.golden", func(w *bytes.Buffer) error {
+			return writeMatchesJSON(w, []storage.SearchMatch{{Entry: testEntry(), Fields: []string{"name", "url"}}}, false)
+		}},
+		{"search_none.golden", func(w *bytes.Buffer) error { return writeMatchesJSON(w, nil, false) }},
+		{"stats.golden", func(w *bytes.Buffer) error { return writeJSON(w, statsJSON(stats)) }},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := tt.write(&out); err != nil {
+			t.Errorf("%s: %v", tt.golden, err)
+			continue
+		}
+		want, err := os.ReadFile(filepath.Join("testdata", "json_output", tt.golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.golden, out.String(), want)
+		}
+	}
+}
+
+func TestEntryJSONLeavesEntryAlone(t *testing.T) {
+	entry := testEntry()
+	if redacted := entryJSON(entry, false); redacted.Password != "" || entry.Password != "hunter2" {
+		t.Errorf("Expected a redacted copy, got %q and the entry %q", redacted.Password, entry.Password)
+	}
+}
+
+func TestJSONOptions(t *testing.T) {
+	if err := (jsonOptions{includeSecrets: true}).check(); err == nil {
+		t.Error("Expected --include-secrets without --json to be refused")
+	}
+	var opts jsonOptions
+	fs := newFlagSet("test")
+	opts.addFlags(fs)
+	if _, err := parseFlags(fs, []string{"--json", "--include-secrets"}); err != nil || opts.check() != nil || !opts.json || !opts.includeSecrets {
+		t.Errorf("Unexpected %+v, %v", opts, err)
+	}
+}
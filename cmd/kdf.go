@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/storage"
+)
+
+// upgradeKDF re-encrypts the vault under crypto.DefaultKDF right after
+// unlock when the key of its master password is derived with weaker
+// parameters: without asking if auto_upgrade_kdf is set, otherwise once
+// confirmed at a terminal. Read-only sessions never get here, as
+// KDFStatus reports nothing for them.
+func upgradeKDF(args []string) {
+	switch args[0] {
+	case "migrate-kdf", "change-master":
+		return
+	}
+	record, outdated, err := database.KDFStatus()
+	if err != nil || !outdated {
+		return
+	}
+
+	if !settings.AutoUpgradeKDF {
+		if !atTerminal(args) || !stdinIsTerminal() {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "The key of this vault is derived with %s, weaker than the %s new vaults get.\n",
+			describeKDF(record), crypto.DefaultKDF)
+		fmt.Fprint(os.Stderr, "Re-encrypt it now? (y/N): ")
+		answer, err := readLine()
+		if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || (answer != "y" && answer != "yes") {
+			fmt.Fprintf(os.Stderr, "Skipped; set auto_upgrade_kdf = true in %s to do it on unlock.\n", configPath)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Re-encrypting the vault under %s...\n", crypto.DefaultKDF)
+	snapshot, err := database.UpgradeKDF(masterSecret.Reveal(), kdfProgress())
+	if err != nil {
+		printError(fmt.Errorf("failed to upgrade key derivation: %w", err))
+		if snapshot != "" {
+			fmt.Fprintf(os.Stderr, "The vault as it was is kept in %s.\n", snapshot)
+		}
+		exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Done. A copy of the vault from before is kept in %s; delete it once you no longer need it.\n", snapshot)
+}
+
+// describeKDF describes the key derivation of a KDFRecord for upgradeKDF
+func describeKDF(record storage.KDFRecord) string {
+	switch {
+	case record.Algorithm == "":
+		return "a key per field, as in vaults from before data keys"
+	case record.Since.IsZero():
+		return record.KDFParams.String()
+	default:
+		return fmt.Sprintf("%s since %s", record.KDFParams, record.Since.Local().Format("2006-01-02"))
+	}
+}
+
+// kdfProgress returns the progress function of UpgradeKDF: a counter
+// rewritten in place on a terminal, nothing otherwise
+func kdfProgress() func(done, total int) {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	// loadSettings has checked the profile
+	tuning, _ := settings.Tuning()
+	return throttleProgress(tuning.ProgressInterval, time.Now, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\r  %d of %d entries", done, total)
+		if done == total {
+			fmt.Fprintln(os.Stderr)
+		}
+	})
+}
+
+// throttleProgress returns render, called at most once per interval. The
+// last step is always rendered, so the counter ends complete.
+func throttleProgress(interval time.Duration, now func() time.Time, render func(done, total int)) func(done, total int) {
+	var last time.Time
+	return func(done, total int) {
+		if t := now(); done == total || last.IsZero() || t.Sub(last) >= interval {
+			last = t
+			render(done, total)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+// errSecretHidden is returned when a list template reads a password, or
+// the body of a note, without --show-passwords
+var errSecretHidden = errors.New("secrets are hidden; add --show-passwords to use them")
+
+// listTemplateFuncs are the helpers a list --template may call
+var listTemplateFuncs = template.FuncMap{
+	// join joins a list such as .Tags: {{join .Tags ","}}
+	"join": func(elems []string, sep string) string { return strings.Join(elems, sep) },
+	// date formats a time with a Go layout: {{date "2006-01-02" .Updated}}
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	// truncate shortens a string to n characters, ending it with "…" if
+	// anything was cut: {{truncate 20 .URL}}
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if n < 1 || len(runes) <= n {
+			return s
+		}
+		return string(runes[:n-1]) + "…"
+	},
+}
+
+// listedEntry is what a list template sees of an entry. The password and
+// a note's body are only filled in with --show-passwords; otherwise
+// reading them fails the whole listing.
+type listedEntry struct {
+	Name     string
+	Username string
+	URL      string
+	Icon     string
+	Tags     []string
+	Type     string
+	Created  time.Time
+	Updated  time.Time
+
+	shown    bool
+	password string
+	notes    string
+}
+
+// newListedEntry copies the fields of entry a template may use, leaving
+// out the secrets unless show is set
+func newListedEntry(entry *storage.PasswordEntry, show bool) *listedEntry {
+	listed := &listedEntry{
+		Name:     entry.Name,
+		Username: entry.Username,
+		URL:      entry.URL,
+		Icon:     entry.Icon,
+		Tags:     entry.Tags,
+		Type:     entryTypeName(entry),
+		Created:  entry.CreatedAt,
+		Updated:  entry.UpdatedAt,
+		shown:    show,
+	}
+	if show {
+		listed.password = entry.Password
+	}
+	if show || !entry.IsNote() {
+		listed.notes = entry.Notes
+	}
+	return listed
+}
+
+// Password is the entry's password, with --show-passwords
+func (e *listedEntry) Password() (string, error) {
+	if !e.shown {
+		return "", errSecretHidden
+	}
+	return e.password, nil
+}
+
+// Notes are the entry's notes; the body of a note needs --show-passwords
+func (e *listedEntry) Notes() (string, error) {
+	if !e.shown && e.Type == storage.EntryTypeNote {
+		return "", errSecretHidden
+	}
+	return e.notes, nil
+}
+
+// parseListTemplate compiles a list --template. As in --format, \n, \t
+// and \\ in the text between actions are escapes.
+func parseListTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("list").Funcs(listTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("--template: %w", err)
+	}
+	if tmpl.Tree != nil {
+		if err := unescapeText(tmpl.Tree.Root); err != nil {
+			return nil, fmt.Errorf("--template: %w", err)
+		}
+	}
+	return tmpl, nil
+}
+
+// unescapeText replaces the escapes in the text nodes under node
+func unescapeText(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := unescapeText(child); err != nil {
+				return err
+			}
+		}
+	case *parse.TextNode:
+		text, err := unescape(string(n.Text))
+		if err != nil {
+			return err
+		}
+		n.Text = []byte(text)
+	case *parse.IfNode:
+		return unescapeBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return unescapeBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return unescapeBranch(&n.BranchNode)
+	}
+	return nil
+}
+
+func unescapeBranch(n *parse.BranchNode) error {
+	if err := unescapeText(n.List); err != nil {
+		return err
+	}
+	return unescapeText(n.ElseList)
+}
+
+// unescape turns \n, \t and \\ into the characters they stand for
+func unescape(s string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case '\\':
+			out.WriteByte('\\')
+		default:
+			return "", fmt.Errorf("unknown escape \\%c", s[i])
+		}
+	}
+	return out.String(), nil
+}
+
+// renderList renders every entry through tmpl, one per line. Nothing is
+// returned unless all entries render, so an error never leaves a partial
+// listing behind.
+func renderList(tmpl *template.Template, entries []*storage.PasswordEntry, show bool) ([]byte, error) {
+	var out bytes.Buffer
+	for _, entry := range entries {
+		if err := tmpl.Execute(&out, newListedEntry(entry, show)); err != nil {
+			if errors.Is(err, errSecretHidden) {
+				return nil, errSecretHidden
+			}
+			return nil, fmt.Errorf("--template: %w", err)
+		}
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+func listEntries() []*storage.PasswordEntry {
+	updated := time.Date(2025, 3, 9, 8, 30, 0, 0, time.UTC)
+	bank := testEntry()
+	bank.UpdatedAt = bank.CreatedAt
+	return []*storage.PasswordEntry{
+		bank,
+		{Name: "personal-mail-account", Username: "jane@example.com", Password: "s3cret", URL: "https://mail.example.com/inbox", UpdatedAt: updated},
+		{Name: "safe", Type: storage.EntryTypeNote, Notes: "12-34-56", Tags: []string{"home"}, UpdatedAt: updated},
+	}
+}
+
+// TestListTemplateGolden renders the example templates of testdata,
+// documented in the README, and compares the output with the .golden files
+func TestListTemplateGolden(t *testing.T) {
+	templates, err := filepath.Glob(filepath.Join("testdata", "list_templates", "*.tmpl"))
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("no templates found: %v", err)
+	}
+
+	for _, path := range templates {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(strings.TrimSuffix(path, ".tmpl") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := parseListTemplate(string(text))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		got, err := renderList(tmpl, listEntries(), false)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", path, got, want)
+		}
+	}
+}
+
+func TestListTemplateErrors(t *testing.T) {
+	for _, text := range []string{`{{.Name`, `{{nosuchfunc .Name}}`, `{{.Name}}\x`} {
+		if _, err := parseListTemplate(text); err == nil {
+			t.Errorf("Expected %q not to compile", text)
+		}
+	}
+
+	tmpl, err := parseListTemplate(`{{.Nmae}}`)
+	if err == nil {
+		_, err = renderList(tmpl, listEntries(), false)
+	}
+	if err == nil {
+		t.Error("Expected an unknown field to fail")
+	}
+}
+
+func TestListTemplateSecrets(t *testing.T) {
+	for _, text := range []string{`{{.Name}} {{.Password}}`, `{{.Notes}}`} {
+		tmpl, err := parseListTemplate(text)
+		if err != nil {
+			t.Fatalf("parseListTemplate(%q) failed: %v", text, err)
+		}
+		if out, err := renderList(tmpl, listEntries(), false); !errors.Is(err, errSecretHidden) || out != nil {
+			t.Errorf("%q without --show-passwords = %q, %v", text, out, err)
+		}
+	}
+
+	tmpl, _ := parseListTemplate(`{{.Name}}={{.Password}}{{with .Notes}} ({{.}}){{end}}`)
+	got, err := renderList(tmpl, listEntries(), true)
+	if err != nil {
+		t.Fatalf("renderList failed: %v", err)
+	}
+	want := "bank=hunter2\npersonal-mail-account=s3cret\nsafe= (12-34-56)\n"
+	if string(got) != want {
+		t.Errorf("renderList = %q, want %q", got, want)
+	}
+}
@@ -1,74 +1,305 @@
 package main
 
 import (
-	"bufio"
+	"encoding/base32"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strconv"
+	"regexp"
+	"sort"
 	"strings"
-	"syscall"
+	"text/template"
+	"time"
 
+	"password-manager/internal/appversion"
+	"password-manager/internal/autotag"
+	"password-manager/internal/collation"
+	"password-manager/internal/config"
 	"password-manager/internal/crypto"
+	"password-manager/internal/duration"
 	"password-manager/internal/generator"
+	"password-manager/internal/hooks"
+	"password-manager/internal/policy"
+	"password-manager/internal/query"
+	"password-manager/internal/recipient"
 	"password-manager/internal/storage"
+	"password-manager/internal/suggest"
+	"password-manager/internal/tmpfile"
+	"password-manager/internal/tui"
 
 	"golang.org/x/term"
 )
 
 const (
 	appName = "Advanced Password Manager"
-	version = "1.0.0"
+	version = appversion.Current
 )
 
 var (
-	dbPath         string
-	masterPassword string
-	database       *storage.Database
+	dbPath string
+	// masterSecret holds the master password as it was read, so the
+	// interactive shell can overwrite it when it locks
+	masterSecret *crypto.SecretString
+	database     *storage.Database
+	// identityFile is the age identity file for entries and exports
+	// encrypted to recipients
+	identityFile string
+	// configPath is the config file, read by commands that open the vault
+	configPath string
+	settings   = &config.Config{}
+	// tagRules are the auto_tag rules of the config file
+	tagRules autotag.Rules
+	// collator orders entry names as the collation setting says
+	collator *collation.Collator
+	// fromBackup is the backup read-only commands run on instead of the
+	// vault, and fromBackupMade when it was made
+	fromBackup     string
+	fromBackupMade time.Time
+	// historyPath is where the interactive shell keeps its command history
+	historyPath string
+	// exit ends the program with a status code. The shell replaces it so
+	// that a failing command ends only that command.
+	exit = exitProgram
 )
 
+// exitProgram ends the program with a status code after what main defers
+// on a normal exit: the vault is closed, sealing a fully encrypted one
+// again, the hooks queued so far run and temporary files are removed.
+// Otherwise a failing command would leave the decrypted working copy of
+// a fully encrypted vault behind.
+func exitProgram(code int) {
+	if database != nil {
+		// A failed close is reported, but the status stays code
+		if err := shutDatabase(); err != nil {
+			printError(fmt.Errorf("failed to close database: %w", err))
+		}
+		runHooks()
+	}
+	tmpfile.Cleanup()
+	os.Exit(code)
+}
+
 func main() {
-	// Set default database path
+	// Temporary files may hold secrets; remove them on exit and on Ctrl-C
+	tmpfile.HandleSignals()
+	defer tmpfile.Cleanup()
+	// and those of runs that could not, such as after a crash
+	tmpfile.RemoveStale("")
+
+	if len(os.Args) > 1 && os.Args[1] == clearClipboardCommand {
+		runClipboardClearer(os.Args[2:])
+		return
+	}
+
+	// Set default database path; PM_DB and --db override it
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		printError(err)
+		exit(1)
 	}
 	
-	dbPath = filepath.Join(homeDir, ".password-manager", "passwords.db")
+	configDir := defaultConfigDir(homeDir)
+	dbPath = filepath.Join(configDir, "passwords.db")
+	historyPath = filepath.Join(defaultStateDir(homeDir), "history")
+
+	// --identity may appear anywhere; it names the age identity file used
+	// for entries encrypted to recipients. --db selects another vault, ahead
+	// of $PM_DB, and --from-backup a backup to inspect instead.
+	var args []string
+	identityFile, args, _, err = takeFlagValue(os.Args[1:], "--identity")
+	var path string
+	var pathGiven bool
+	if err == nil {
+		path, args, pathGiven, err = takeFlagValue(args, "--db")
+	}
+	if err == nil && pathGiven && path == "" {
+		err = fmt.Errorf("--db needs a value")
+	}
+	if err == nil {
+		fromBackup, args, _, err = takeFlagValue(args, "--from-backup")
+	}
+	// --no-hooks skips the hooks of the config file
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--no-hooks" {
+			noHooks, args = true, append(args[:i:i], args[i+1:]...)
+			break
+		}
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	os.Args = append(os.Args[:1], args...)
+	if dbPath, err = resolveDBPath(path, os.Getenv("PM_DB"), dbPath, homeDir); err != nil {
+		printError(err)
+		exit(1)
+	}
+	if identityFile == "" {
+		identityFile = defaultIdentityFile(configDir)
+	}
 
-	// Parse command line arguments
+	// Parse command line arguments; at a terminal, no command starts the
+	// interactive shell
 	if len(os.Args) < 2 {
-		showHelp()
-		os.Exit(1)
+		if !stdinIsTerminal() {
+			showHelp()
+			exit(1)
+		}
+		os.Args = append(os.Args, "interactive")
+	}
+
+	// Mistakes in the arguments are reported before the vault is unlocked,
+	// and --help is answered without it
+	err = checkArgs(os.Args[1:])
+	helpOnly := errors.Is(err, flag.ErrHelp)
+	if err != nil && !helpOnly {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
 	}
 
 	// Initialize database connection
-	if err := initializeDatabase(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", err)
-		os.Exit(1)
+	configPath = filepath.Join(configDir, config.FileName)
+	if fromBackup != "" {
+		if err := loadSettings(); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if err := openBackupVault(os.Args[1]); err != nil {
+			printError(err)
+			exit(1)
+		}
+		defer closeDatabase()
+	} else if needsVault(os.Args[1:]) && !helpOnly {
+		if err := loadSettings(); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if err := initializeDatabase(); err != nil {
+			printError(err)
+			exit(1)
+		}
+		defer func() {
+			closeDatabase()
+			runHooks()
+		}()
+
+		if err := setupDatabase(); err != nil {
+			printError(err)
+			exit(1)
+		}
+
+		upgradeKDF(os.Args[1:])
+		showDigest(os.Args[1:])
+		remind(os.Args[1:], configDir)
+		warnQuota(os.Args[1:])
 	}
-	defer database.Close()
 
-	// Handle commands
-	command := os.Args[1]
+	runCommand(os.Args[1])
+}
+
+// runCommand runs command with the arguments in os.Args
+func runCommand(command string) {
 	switch command {
+	case "init":
+		handleInit()
 	case "generate", "gen":
 		handleGenerate()
 	case "save":
 		handleSave()
+	case "add":
+		handleAdd()
+	case "update", "edit":
+		handleUpdate()
+	case "rename":
+		handleRename()
 	case "get", "find":
 		handleGet()
+	case "history":
+		handleHistory()
+	case "expiring":
+		handleExpiring()
+	case "copy":
+		handleCopy()
 	case "list":
 		handleList()
 	case "delete", "del":
 		handleDelete()
+	case "trash":
+		handleTrash()
+	case "restore":
+		handleRestore()
 	case "search":
 		handleSearch()
 	case "stats":
 		handleStats()
 	case "analyze":
 		handleAnalyze()
+	case "change-master":
+		handleChangeMaster()
+	case "migrate-kdf":
+		handleMigrateKDF()
+	case "upgrade":
+		handleUpgrade()
+	case "split":
+		handleSplit()
+	case "viewer":
+		handleViewer()
+	case "tag":
+		handleTag()
+	case "config":
+		handleConfig()
+	case "backup":
+		handleBackup()
+	case "convert":
+		handleConvert()
+	case "autotype":
+		handleAutotype()
+	case "recipients":
+		handleRecipients()
+	case "verify":
+		handleVerify()
+	case "note":
+		handleNote()
+	case "reminders":
+		handleReminders()
+	case "audit":
+		handleAudit()
+	case "comply":
+		handleComply()
+	case "put":
+		handlePut()
+	case "export":
+		handleExport()
+	case "import":
+		handleImport()
+	case "report":
+		handleReport()
+	case "checksum":
+		handleChecksum()
+	case "retag":
+		handleRetag()
+	case "completion":
+		handleCompletion()
+	case "totp":
+		handleTOTP()
+	case "sync":
+		handleSync()
+	case "index":
+		handleIndex()
+	case "icon":
+		handleIcon()
+	case "selftest":
+		handleSelftest()
+	case "demo":
+		handleDemo()
+	case "interactive":
+		handleInteractive()
 	case "help", "-h", "--help":
 		showHelp()
 	case "version", "-v", "--version":
@@ -76,298 +307,1937 @@ func main() {
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		showHelp()
-		os.Exit(1)
+		exit(1)
+	}
+}
+
+// loadSettings reads the config file and compiles its auto_tag rules
+func loadSettings() error {
+	var err error
+	if settings, err = config.Load(configPath); err != nil {
+		return err
+	}
+	if tagRules, err = compileSettings(settings); err != nil {
+		return fmt.Errorf("config %s: %w", configPath, err)
+	}
+	// Neither sorting nor tag colors are worth refusing to run over
+	if collator, err = settings.Collator(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: config %s: %v; names are sorted in the default order\n", configPath, err)
+	}
+	if err := checkTagStyles(settings.TagStyles); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: config %s: %v\n", configPath, err)
 	}
+	return nil
 }
 
 // initializeDatabase initializes the database connection
 func initializeDatabase() error {
-	// Get master password
-	fmt.Print("Enter master password: ")
-	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	// Fail before asking for a password when there is nothing to unlock
+	if err := checkDBPath(dbPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("%w at %s", storage.ErrNoVault, dbPath)
+	}
+
+	secret, err := readSecretBytes("Enter master password: ")
 	if err != nil {
-		return fmt.Errorf("failed to read password: %w", err)
+		return err
 	}
-	fmt.Println() // New line after password input
-	
-	masterPassword = string(bytePassword)
-	if masterPassword == "" {
+	if len(secret) == 0 {
 		return fmt.Errorf("master password cannot be empty")
 	}
+	masterSecret = crypto.NewSecretString(secret)
 
-	// Create database
-	database, err = storage.NewDatabase(dbPath, masterPassword)
+	database, err = storage.NewDatabase(dbPath, masterSecret.Reveal())
+	if errors.Is(err, storage.ErrNoVault) {
+		return err // The hint tells how to create one
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if database.IsViewer() {
+		fmt.Fprintln(os.Stderr, "Opened with the viewer credential: read-only, passwords are redacted.")
+	} else if database.NeedsUpgrade() && os.Args[1] != "upgrade" {
+		minimum, _ := database.MinAppVersion()
+		fmt.Fprintf(os.Stderr, "Warning: this vault is in the format of v%s and open read-only; run '%s upgrade' to write to it.\n", minimum, os.Args[0])
+	}
+	if database.LegacyPasswordForm() && os.Args[1] != "change-master" {
+		fmt.Fprintf(os.Stderr, "Warning: this vault takes the master password only as typed when it was created; with its\n"+
+			"accented characters composed differently, as on another system, it is rejected. Run\n"+
+			"'%s change-master' with the same password to fix this.\n", os.Args[0])
 	}
 
 	return nil
 }
 
-// handleGenerate handles password generation
-func handleGenerate() {
-	config := generator.DefaultConfig()
-	
-	// Parse flags
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		switch {
-		case strings.HasPrefix(arg, "--length="):
-			if length, err := strconv.Atoi(strings.TrimPrefix(arg, "--length=")); err == nil {
-				config.Length = length
+// setupDatabase gives the open vault the age identities, the tagging
+// rules, the password history limit and the name order of the config
+func setupDatabase() error {
+	if identityFile != "" {
+		identities, err := recipient.LoadIdentities(identityFile)
+		if err != nil {
+			return err
+		}
+		database.SetIdentities(identities)
+	}
+	if len(tagRules) > 0 {
+		database.SetTagger(tagRules)
+	}
+	// loadSettings has checked the limit
+	limit, _ := settings.HistoryLimit()
+	database.SetHistoryLimit(limit)
+	database.SetCollator(collator)
+	return nil
+}
+
+// defaultIdentityFile returns the configured age identity file: $PM_IDENTITY,
+// or identity.txt in the default vault directory if it exists
+func defaultIdentityFile(configDir string) string {
+	if path := os.Getenv("PM_IDENTITY"); path != "" {
+		return path
+	}
+	path := filepath.Join(configDir, "identity.txt")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return ""
+}
+
+// resolveDBPath returns the vault to open: the --db flag if given, else
+// $PM_DB, else the default. A leading ~ stands for the home directory, as
+// a quoted path or an environment variable does not get it expanded by
+// the shell, and relative paths are taken from the working directory.
+func resolveDBPath(flag, env, fallback, homeDir string) (string, error) {
+	path := fallback
+	switch {
+	case flag != "":
+		path = flag
+	case env != "":
+		path = env
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		path = filepath.Join(homeDir, path[1:])
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve vault path %s: %w", path, err)
+	}
+	return abs, nil
+}
+
+// errVaultPath is returned by checkDBPath
+var errVaultPath = errors.New("unusable vault path")
+
+// checkDBPath reports why path cannot hold a vault: it is a directory, or
+// the directory it would be created in is blocked by a file
+func checkDBPath(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%w: %s is a directory; name the vault file, such as %s",
+			errVaultPath, path, filepath.Join(path, "passwords.db"))
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		// Below a file, stat fails with "not a directory"; keep going up
+		// to the file itself
+		if info, err := os.Stat(dir); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%w: cannot create %s, as %s is not a directory", errVaultPath, path, dir)
 			}
-		case arg == "--uppercase":
-			config.Uppercase = true
-		case arg == "--lowercase":
-			config.Lowercase = true
-		case arg == "--numbers":
-			config.Numbers = true
-		case arg == "--symbols":
-			config.Symbols = true
-		case arg == "--no-repeating":
-			config.NoRepeating = true
-		case strings.HasPrefix(arg, "--exclude="):
-			config.Exclude = strings.TrimPrefix(arg, "--exclude=")
+			return nil
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil
 		}
 	}
+}
+
+// closeDatabase closes the vault, reporting changes that could not be
+// written back to a fully encrypted vault
+func closeDatabase() {
+	if err := shutDatabase(); err != nil {
+		printError(fmt.Errorf("failed to close database: %w", err))
+		exit(1)
+	}
+}
 
-	// Generate password
-	password, err := generator.GeneratePassword(config)
+// shutDatabase records this device as having seen the vault and closes
+// it, if it is open
+func shutDatabase() error {
+	if database == nil {
+		return nil
+	}
+	markSeen()
+	db := database
+	database = nil
+	return db.Close()
+}
+
+// handleGenerate handles password generation
+func handleGenerate() {
+	if hasFlag(os.Args[2:], "--passphrase") {
+		handleGeneratePassphrase(os.Args[2:])
+		return
+	}
+	config, rules, lengthGiven, err := parseGenerateArgs(os.Args[2:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating password: %v\n", err)
-		os.Exit(1)
+		failFlags(generateFlags(generator.DefaultConfig(), &generateOptions{}), err, generateUsage())
+	}
+	if rules != nil {
+		fitSiteRules(config, rules, lengthGiven)
+	}
+
+	// Generate password, again until it meets --verify
+	var password string
+	var violations []policy.Violation
+	for attempt := 0; attempt < verifyAttempts; attempt++ {
+		password, err = generator.GeneratePassword(config)
+		if err != nil {
+			printError(fmt.Errorf("failed to generate password: %w", err))
+			exit(1)
+		}
+		if rules == nil {
+			break
+		}
+		if violations = rules.Check(password); len(violations) == 0 {
+			break
+		}
+	}
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: none of %d passwords met %s; the last one broke:\n", verifyAttempts, rules)
+		for _, v := range violations {
+			fmt.Fprintf(os.Stderr, "  %s\n", v)
+		}
+		fmt.Fprintln(os.Stderr, "Adjust --length or the character classes to fit the rules.")
+		exit(1)
 	}
 
 	fmt.Printf("Generated password: %s\n", password)
+	if rules != nil {
+		fmt.Printf("Meets: %s\n", rules)
+	}
 	
 	// Analyze strength
-	analysis := generator.AnalyzePasswordStrength(password)
-	fmt.Printf("Strength: %s (Score: %d/7)\n", 
-		analysis["strength_level"], analysis["strength_score"])
+	analysis := generator.Analyze(password)
+	fmt.Printf("Strength: %s (Score: %d/%d)\n", 
+		analysis.Level, analysis.Score, generator.MaxScore)
+	if missing := generator.MissingClasses(password, config); len(missing) > 0 {
+		fmt.Printf("Info: no %s in this password; every character was drawn uniformly\n", strings.Join(missing, " or "))
+	}
+}
+
+// generateUsage returns the usage line of generate for passwords
+func generateUsage() string {
+	return os.Args[0] + " generate [--length <n>] [--uppercase] [--lowercase] [--numbers] [--symbols] [--no-uppercase] [--no-lowercase] [--no-numbers] [--no-symbols] [--mobile] [--exclude <chars>] [--no-repeating] [--no-require-all-classes] [--chunk <n> [--chunk-sep <text>]] [--separator-counts] [--verify <rules>]"
+}
+
+// classNames are the character classes generate takes flags for, in the
+// order of classFields
+var classNames = [4]string{"uppercase", "lowercase", "numbers", "symbols"}
+
+// classFields returns the fields of config selecting the classes of
+// classNames
+func classFields(config *generator.PasswordConfig) [4]*bool {
+	return [4]*bool{&config.Uppercase, &config.Lowercase, &config.Numbers, &config.Symbols}
+}
+
+// generateOptions are the flags of generate that are not fields of the
+// configuration
+type generateOptions struct {
+	verify string
+	// only are the classes asked for with --uppercase and the like, and
+	// without those left out with --no-uppercase and the like, in the
+	// order of classNames
+	only, without [4]bool
+}
+
+// generateFlags returns the flag set of generate for passwords, filling
+// config and opts
+func generateFlags(config *generator.PasswordConfig, opts *generateOptions) *flag.FlagSet {
+	fs := newFlagSet("generate")
+	fs.IntVar(&config.Length, "length", config.Length, "`n` characters in the password")
+	for i, name := range classNames {
+		fs.BoolVar(&opts.only[i], name, false, "draw from "+name+"; once any class is named, only those named are drawn from")
+	}
+	for i, name := range classNames {
+		fs.BoolVar(&opts.without[i], "no-"+name, false, "leave "+name+" out of the default classes")
+	}
+	fs.StringVar(&config.Exclude, "exclude", config.Exclude, "`chars` never to draw")
+	fs.BoolVar(&config.MobileFriendly, "mobile", false, "only symbols one tap away on a phone keyboard: "+generator.MobileSymbols)
+	fs.BoolVar(&config.NoRepeating, "no-repeating", config.NoRepeating, "no character twice in a row")
+	fs.Var(notFlag{&config.RequireEachClass}, "no-require-all-classes", "let a class be missing from the password")
+	fs.IntVar(&config.ChunkSize, "chunk", 0, "group the characters by `n`")
+	fs.StringVar(&config.ChunkSeparator, "chunk-sep", "", "`text` between the groups (default -)")
+	fs.BoolVar(&config.SeparatorCounts, "separator-counts", false, "count the separators in --length")
+	fs.StringVar(&opts.verify, "verify", "", "site `rules` to meet, such as min=12,classes=3")
+	return fs
+}
+
+// parseGenerateArgs reads the flags of generate into a configuration and
+// the rules of --verify, nil without it. lengthGiven reports whether
+// --length was given, which --verify leaves alone.
+//
+// Without class flags all four classes are drawn from. Naming classes,
+// as --numbers does, draws from those alone; --no-symbols and the like
+// leave one out of the rest. --symbols=false is the same as --no-symbols.
+func parseGenerateArgs(args []string) (config *generator.PasswordConfig, rules *policy.SiteRules, lengthGiven bool, err error) {
+	config = generator.DefaultConfig()
+	var opts generateOptions
+	fs := generateFlags(config, &opts)
+	rest, err := parseFlags(fs, args)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("unexpected argument %s", rest[0])
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if config.ChunkSeparator != "" && config.ChunkSize == 0 {
+		return nil, nil, false, fmt.Errorf("--chunk-sep needs --chunk")
+	}
+	given := flagsGiven(fs)
+	lengthGiven = given["length"]
+
+	named := false
+	for i, name := range classNames {
+		if given[name] && !opts.only[i] {
+			opts.only[i], opts.without[i] = false, true
+		}
+		if opts.only[i] && opts.without[i] {
+			return nil, nil, false, fmt.Errorf("--%s and --no-%s cannot be combined", name, name)
+		}
+		named = named || opts.only[i]
+	}
+	enabled := 0
+	for i, field := range classFields(config) {
+		if named {
+			*field = opts.only[i]
+		}
+		if opts.without[i] {
+			*field = false
+		}
+		if *field {
+			enabled++
+		}
+	}
+	if enabled == 0 {
+		return nil, nil, false, fmt.Errorf("every character class is left out")
+	}
+
+	if opts.verify != "" {
+		if rules, err = policy.ParseSiteRules(opts.verify); err != nil {
+			return nil, nil, false, fmt.Errorf("invalid --verify rules: %w", err)
+		}
+	}
+	return config, rules, lengthGiven, nil
+}
+
+// verifyAttempts is how many passwords generate --verify tries before
+// giving up on the rules
+const verifyAttempts = 100
+
+// fitSiteRules adjusts config toward the site rules of generate --verify:
+// forbidden characters are never drawn, and without --length the length
+// is brought within min and max. The rest is left to regenerating.
+func fitSiteRules(config *generator.PasswordConfig, rules *policy.SiteRules, lengthGiven bool) {
+	config.Exclude += rules.Forbid
+	if lengthGiven {
+		return
+	}
+	if rules.Min > 0 && config.Length < rules.Min {
+		config.Length = rules.Min
+	}
+	if rules.Max > 0 && config.Length > rules.Max {
+		config.Length = rules.Max
+	}
 }
 
 // handleSave handles saving a password
 func handleSave() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s save <name> [--username <username>] [--password <password>] [--url <url>] [--notes <notes>] [--tags <tag1,tag2>]\n", os.Args[0])
-		os.Exit(1)
-	}
-
-	entry := &storage.PasswordEntry{
-		Name: os.Args[2],
-	}
-
-	// Parse optional flags
-	for i := 3; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		switch {
-		case arg == "--username" && i+1 < len(os.Args):
-			entry.Username = os.Args[i+1]
-			i++
-		case arg == "--password" && i+1 < len(os.Args):
-			entry.Password = os.Args[i+1]
-			i++
-		case arg == "--url" && i+1 < len(os.Args):
-			entry.URL = os.Args[i+1]
-			i++
-		case arg == "--notes" && i+1 < len(os.Args):
-			entry.Notes = os.Args[i+1]
-			i++
-		case arg == "--tags" && i+1 < len(os.Args):
-			tags := strings.Split(os.Args[i+1], ",")
-			for j, tag := range tags {
-				tags[j] = strings.TrimSpace(tag)
-			}
-			entry.Tags = tags
-			i++
+	entry, autoName, force, err := parseSaveArgs(os.Args[2:])
+	if err == nil && entry.Name == "" && entry.URL == "" {
+		err = fmt.Errorf("a name, or --url to suggest one from, is needed")
+	}
+	if err != nil {
+		failFlags(saveFlags(&storage.PasswordEntry{}, &saveOptions{}), err, saveUsage())
+	}
+
+	// The name may be left out when --url is given; it is then suggested
+	if entry.Name == "" {
+		entry.Name = suggestName(entry, autoName)
+	}
+
+	// Saving under a taken name replaces that entry, once confirmed
+	existingID, err := entryID(entry.Name)
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	if existingID != 0 && !force {
+		fmt.Printf("Entry '%s' exists, overwrite? (y/N): ", entry.Name)
+		response, err := readLine()
+		if err != nil {
+			printError(fmt.Errorf("failed to read input: %w", err))
+			exit(1)
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response != "y" && response != "yes" {
+			fmt.Printf("Entry not saved; use '%s update' to change some of its fields.\n", os.Args[0])
+			return
 		}
 	}
 
 	// If password not provided, prompt for it
 	if entry.Password == "" {
+		if !stdinIsTerminal() {
+			printError(fmt.Errorf("failed to read password: %w", errNoTerminal))
+			exit(1)
+		}
 		fmt.Print("Enter password: ")
-		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+		bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
-			os.Exit(1)
+			printError(fmt.Errorf("failed to read password: %w", err))
+			exit(1)
 		}
 		fmt.Println()
 		entry.Password = string(bytePassword)
 	}
 
+	if err := validateEntry(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	warnReuse(entry.Password, existingID)
+
 	// Save to database
-	if err := database.SavePassword(entry); err != nil {
-		fmt.Fprintf(os.Stderr, "Error saving password: %v\n", err)
-		os.Exit(1)
+	before := entry.Tags
+	switch {
+	case force:
+		// Scripts saving one name at once: the last save wins
+		err = database.SaveOrUpdate(entry)
+	case existingID != 0:
+		entry.ID = existingID
+		err = database.UpdatePassword(entry)
+	default:
+		err = database.SavePassword(entry)
+	}
+	if err != nil {
+		printError(fmt.Errorf("failed to save password: %w", err))
+		exit(1)
 	}
 
 	fmt.Printf("Password '%s' saved successfully!\n", entry.Name)
+	reportAutoTags(before, entry)
+	warnMisplacedSecrets(entry)
+	queueHook(hooks.Save, entry.Name)
 }
 
-// handleGet handles retrieving a password
-func handleGet() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s get <name>\n", os.Args[0])
-		os.Exit(1)
-	}
+// saveUsage returns the usage line of save
+func saveUsage() string {
+	return os.Args[0] + " save <name> [--username <username>] [--password <password>] [--url <url>] [--notes <notes>] [--tags <tag1,tag2>] [--icon <char>] [--recipients <age1...,age1...>] [--expires <span or date>] [--force]\n" +
+		"       " + os.Args[0] + " save --url <url> [--auto-name] [options]"
+}
 
-	name := os.Args[2]
-	entry, err := database.GetPassword(name)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+// saveOptions are the flags of save that are not fields of the entry.
+// --tags and --recipients are lists, read once parsing is done.
+type saveOptions struct {
+	tags, recipients, expires string
+	autoName, force           bool
+}
 
-	displayPasswordEntry(entry)
+// saveFlags returns the flag set of save, filling entry and opts
+func saveFlags(entry *storage.PasswordEntry, opts *saveOptions) *flag.FlagSet {
+	fs := newFlagSet("save")
+	fs.StringVar(&entry.Username, "username", "", "the `username`")
+	fs.Var(secretFlag{&entry.Password}, "password", "the `password`; asked for without echo when left out")
+	fs.StringVar(&entry.URL, "url", "", "the `url` of the site")
+	fs.StringVar(&entry.Notes, "notes", "", "free-form `notes`")
+	fs.StringVar(&opts.tags, "tags", "", "comma-separated `tags`")
+	fs.StringVar(&entry.Icon, "icon", "", "a single `char` shown before the name")
+	fs.StringVar(&opts.recipients, "recipients", "", "comma-separated age `keys` that can also decrypt the entry")
+	fs.StringVar(&opts.expires, "expires", "", "when the entry is due to be rotated: a `span` such as 90d, 6m or 1y, a date, or never")
+	fs.BoolVar(&opts.autoName, "auto-name", false, "take the name suggested from --url without asking")
+	fs.BoolVar(&opts.force, "force", false, "replace an entry of the same name without asking")
+	return fs
 }
 
-// handleList handles listing all passwords
-func handleList() {
-	entries, err := database.ListPasswords()
+// parseSaveArgs reads the arguments of save into an entry. All positional
+// arguments form the name, as with get; it may be left out when --url is
+// given, and is then suggested.
+func parseSaveArgs(args []string) (entry *storage.PasswordEntry, autoName, force bool, err error) {
+	entry = &storage.PasswordEntry{}
+	var opts saveOptions
+	words, err := parseFlags(saveFlags(entry, &opts), args)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing passwords: %v\n", err)
-		os.Exit(1)
+		return nil, false, false, err
 	}
-
-	if len(entries) == 0 {
-		fmt.Println("No passwords found.")
-		return
+	entry.Name = strings.Join(words, " ")
+	if opts.tags != "" {
+		entry.Tags = parseTags(opts.tags)
 	}
-
-	fmt.Printf("Found %d passwords:\n\n", len(entries))
-	for _, entry := range entries {
-		fmt.Printf("Name: %s\n", entry.Name)
-		if entry.Username != "" {
-			fmt.Printf("Username: %s\n", entry.Username)
+	if opts.recipients != "" {
+		if entry.Recipients, err = recipient.NormalizeKeys(parseTags(opts.recipients)); err != nil {
+			return nil, false, false, err
 		}
-		if entry.URL != "" {
-			fmt.Printf("URL: %s\n", entry.URL)
+	}
+	if opts.expires != "" {
+		if entry.ExpiresAt, err = parseExpires(opts.expires, time.Now()); err != nil {
+			return nil, false, false, err
 		}
-		if len(entry.Tags) > 0 {
-			fmt.Printf("Tags: %s\n", strings.Join(entry.Tags, ", "))
+	}
+	return entry, opts.autoName, opts.force, nil
+}
+
+// entryID returns the ID of the entry called name, 0 if there is none
+func entryID(name string) (int64, error) {
+	entries, err := database.ListMetadata()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry.ID, nil
 		}
-		fmt.Printf("Updated: %s\n", entry.UpdatedAt.Format("2006-01-02 15:04:05"))
-		fmt.Println("---")
 	}
+	return 0, nil
 }
 
-// handleDelete handles deleting a password
-func handleDelete() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s delete <name>\n", os.Args[0])
-		os.Exit(1)
+// suggestName derives a name for entry from its URL and username, unique
+// in the vault. It is used as is with --auto-name, and otherwise offered
+// for confirmation on a terminal.
+func suggestName(entry *storage.PasswordEntry, autoName bool) string {
+	name := suggest.Name(entry.URL, entry.Username)
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "Error: cannot derive a name from URL %s; give one\n", entry.URL)
+		exit(1)
+	}
+	existing, err := database.ListMetadata()
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		taken[e.Name] = true
+	}
+	name = suggest.Unique(name, func(candidate string) bool { return taken[candidate] })
+	if autoName {
+		return name
 	}
 
-	name := os.Args[2]
-	
-	// Confirm deletion
-	fmt.Printf("Are you sure you want to delete password '%s'? (y/N): ", name)
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
+	if !stdinIsTerminal() {
+		fmt.Fprintf(os.Stderr, "Error: no name given; pass one, or --auto-name to use '%s'\n", name)
+		exit(1)
+	}
+	fmt.Printf("Name [%s]: ", name)
+	answer, err := readLine()
+	if err != nil {
+		printError(fmt.Errorf("failed to read input: %w", err))
+		exit(1)
+	}
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return name
+}
+
+// handleAdd creates an entry through the interactive wizard
+func handleAdd() {
+	if err := parseNoArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" add")
+	}
+	if !stdinIsTerminal() {
+		fmt.Fprintf(os.Stderr, "Error: add is interactive only; use '%s save' in scripts\n", os.Args[0])
+		exit(1)
+	}
+
+	existing, err := database.ListPasswords()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
 	}
 
-	response = strings.ToLower(strings.TrimSpace(response))
-	if response != "y" && response != "yes" {
-		fmt.Println("Deletion cancelled.")
+	entry, err := newWizard(newTerminalPrompter(), os.Stdout, existing).run()
+	if err == errWizardAborted {
+		fmt.Println("Entry not saved.")
 		return
 	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
 
-	if err := database.DeletePassword(name); err != nil {
-		fmt.Fprintf(os.Stderr, "Error deleting password: %v\n", err)
-		os.Exit(1)
+	warnReuse(entry.Password, 0)
+	before := entry.Tags
+	if err := database.SavePassword(entry); err != nil {
+		printError(fmt.Errorf("failed to save password: %w", err))
+		exit(1)
 	}
 
-	fmt.Printf("Password '%s' deleted successfully!\n", name)
+	fmt.Printf("Password '%s' saved successfully!\n", entry.Name)
+	reportAutoTags(before, entry)
+	warnMisplacedSecrets(entry)
+	queueHook(hooks.Save, entry.Name)
 }
 
-// handleSearch handles searching passwords
-func handleSearch() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s search <query>\n", os.Args[0])
-		os.Exit(1)
+// handleGet handles retrieving a password
+func handleGet() {
+	opts, err := parseGetArgs(os.Args[2:])
+	if err != nil {
+		failFlags(getFlags(&getOptions{}), err, getUsage())
+	}
+	if opts.dictation && opts.output == "" && !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintf(os.Stderr, "Error: the dictation sheet is only shown on a terminal; write it to a file with --output <file>\n")
+		exit(1)
+	}
+	if opts.clearAfter == "" {
+		opts.clearAfter = settings.ClipboardClear()
+	}
+	if opts.loginFormat {
+		opts.format, opts.hasFormat = loginFormat, true
 	}
 
-	query := os.Args[2]
-	entries, err := database.SearchPasswords(query)
+	name, err := resolveAccount(opts.name, opts.username)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	entry, password, err := database.GetSecret(name)
+	if errors.Is(err, storage.ErrEntryNotFound) && !opts.exact {
+		if name, err = findSimilar(name); err == nil {
+			entry, password, err = database.GetSecret(name)
+		}
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error searching passwords: %v\n", err)
-		os.Exit(1)
+		printError(err)
+		exit(1)
 	}
+	if !opts.noTouch {
+		markAccessed(entry.Name)
+	}
+	warnExpired(entry)
 
-	if len(entries) == 0 {
-		fmt.Printf("No passwords found matching '%s'.\n", query)
+	if opts.dictation {
+		writeDictation(entry, password, opts.output)
 		return
 	}
 
-	fmt.Printf("Found %d passwords matching '%s':\n\n", len(entries), query)
-	for _, entry := range entries {
-		fmt.Printf("Name: %s\n", entry.Name)
-		if entry.Username != "" {
-			fmt.Printf("Username: %s\n", entry.Username)
+	// Only the password goes to the clipboard, and nothing to the terminal
+	if opts.copy {
+		copyPassword(entry, password, opts.clearAfter)
+		return
+	}
+
+	if opts.json {
+		if opts.includeSecrets {
+			entry.Password = string(password.Reveal())
 		}
-		if entry.URL != "" {
-			fmt.Printf("URL: %s\n", entry.URL)
+		password.Wipe()
+		printJSON(entryJSON(entry, opts.includeSecrets))
+		return
+	}
+
+	if opts.hasFormat {
+		// Templates work on strings, so the password cannot be wiped here
+		entry.Password = string(password.Reveal())
+		password.Wipe()
+		output, err := formatEntry(opts.format, entry, database.IsViewer())
+		if err != nil {
+			printError(err)
+			exit(1)
 		}
-		fmt.Println("---")
+		fmt.Print(output)
+		return
 	}
-}
 
-// handleStats handles displaying database statistics
-func handleStats() {
-	stats, err := database.GetStats()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting stats: %v\n", err)
-		os.Exit(1)
+	display := secretsMasked
+	switch {
+	case database.IsViewer():
+		display = secretsRedacted
+	case opts.show:
+		display = secretsShown
+	}
+	displayPasswordEntry(os.Stdout, entry, password, display, opts.long)
+	if opts.show && opts.clear {
+		clearAfterKeypress()
 	}
+}
 
-	fmt.Println("Database Statistics:")
-	fmt.Printf("Total passwords: %d\n", stats["total_passwords"])
-	fmt.Printf("Database size: %d bytes\n", stats["database_size"])
-	fmt.Printf("Created: %s\n", stats["created_at"])
+// getUsage returns the usage line of get
+func getUsage() string {
+	return os.Args[0] + " get [--show [--clear]|--long|--login-format|--format <template>|--json [--include-secrets]|--copy [--clear-after <duration>]|--dictation [--output <file>]] [--no-touch] [--exact] [--username <username>] [--] <name|site>"
 }
 
-// handleAnalyze handles password strength analysis
-func handleAnalyze() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s analyze <password>\n", os.Args[0])
-		os.Exit(1)
-	}
+// getOptions are the arguments of get
+type getOptions struct {
+	jsonOptions
+	name, format, clearAfter, username, output                      string
+	hasFormat                                                       bool
+	long, loginFormat, noTouch, copy, show, clear, dictation, exact bool
+}
 
-	password := os.Args[2]
-	analysis := generator.AnalyzePasswordStrength(password)
+// getFlags returns the flag set of get, filling opts
+func getFlags(opts *getOptions) *flag.FlagSet {
+	fs := newFlagSet("get")
+	fs.BoolVar(&opts.show, "show", false, "print the password")
+	fs.BoolVar(&opts.clear, "clear", false, "clear the screen once Enter is pressed after --show")
+	fs.BoolVar(&opts.long, "long", false, "show exact times and when the entry was last read")
+	fs.BoolVar(&opts.loginFormat, "login-format", false, "print the username and password on two lines")
+	fs.StringVar(&opts.format, "format", "", "print the entry through a `template` such as {username}:{password}")
+	opts.jsonOptions.addFlags(fs)
+	fs.BoolVar(&opts.copy, "copy", false, "copy the password to the clipboard instead of printing anything")
+	fs.StringVar(&opts.clearAfter, "clear-after", "", "clear the clipboard after `duration` (default from the config)")
+	fs.BoolVar(&opts.dictation, "dictation", false, "spell the password out to read aloud")
+	fs.StringVar(&opts.output, "output", "", "write the dictation sheet to `file`")
+	fs.BoolVar(&opts.noTouch, "no-touch", false, "do not record this read as the last access")
+	fs.BoolVar(&opts.exact, "exact", false, "do not fall back to a similar name")
+	fs.StringVar(&opts.username, "username", "", "pick the account of `username` on a site")
+	return fs
+}
 
-	fmt.Println("Password Strength Analysis:")
-	fmt.Printf("Length: %d characters\n", analysis["length"])
-	fmt.Printf("Has uppercase: %t\n", analysis["has_uppercase"])
-	fmt.Printf("Has lowercase: %t\n", analysis["has_lowercase"])
-	fmt.Printf("Has numbers: %t\n", analysis["has_numbers"])
-	fmt.Printf("Has symbols: %t\n", analysis["has_symbols"])
-	fmt.Printf("Unique characters: %d\n", analysis["unique_chars"])
-	fmt.Printf("Strength score: %d/7\n", analysis["strength_score"])
-	fmt.Printf("Strength level: %s\n", analysis["strength_level"])
-}
-
-// displayPasswordEntry displays a password entry
-func displayPasswordEntry(entry *storage.PasswordEntry) {
-	fmt.Printf("Name: %s\n", entry.Name)
-	if entry.Username != "" {
-		fmt.Printf("Username: %s\n", entry.Username)
-	}
-	fmt.Printf("Password: %s\n", entry.Password)
-	if entry.URL != "" {
-		fmt.Printf("URL: %s\n", entry.URL)
-	}
-	if entry.Notes != "" {
-		fmt.Printf("Notes: %s\n", entry.Notes)
+// parseGetArgs reads the arguments of get. All positional arguments form
+// the name, so "get My Bank" looks up "My Bank". The output flags are
+// refused in combinations that print the password more than one way.
+func parseGetArgs(args []string) (*getOptions, error) {
+	opts := &getOptions{}
+	fs := getFlags(opts)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
 	}
-	if len(entry.Tags) > 0 {
-		fmt.Printf("Tags: %s\n", strings.Join(entry.Tags, ", "))
+	opts.name = strings.Join(words, " ")
+	given := flagsGiven(fs)
+	opts.hasFormat = given["format"]
+	switch {
+	case opts.name == "":
+		return nil, fmt.Errorf("a name is needed")
+	case opts.copy && (opts.long || opts.hasFormat || opts.loginFormat):
+		return nil, fmt.Errorf("--copy cannot be combined with --long, --login-format or --format")
+	case opts.json && (opts.copy || opts.long || opts.hasFormat || opts.loginFormat):
+		return nil, fmt.Errorf("--json cannot be combined with --copy, --long, --login-format or --format")
+	case given["clear-after"] && !opts.copy:
+		return nil, fmt.Errorf("--clear-after needs --copy")
+	case opts.show && (opts.copy || opts.json || opts.hasFormat || opts.loginFormat):
+		return nil, fmt.Errorf("--show cannot be combined with --copy, --json, --login-format or --format, which print the password as asked")
+	case opts.clear && !opts.show:
+		return nil, fmt.Errorf("--clear needs --show")
+	case opts.dictation && (opts.show || opts.long || opts.copy || opts.json || opts.hasFormat || opts.loginFormat):
+		return nil, fmt.Errorf("--dictation cannot be combined with --show, --long, --copy, --json, --login-format or --format")
+	case given["output"] && !opts.dictation:
+		return nil, fmt.Errorf("--output needs --dictation")
+	case opts.loginFormat && opts.hasFormat:
+		return nil, fmt.Errorf("--login-format and --format cannot be combined")
 	}
-	fmt.Printf("Created: %s\n", entry.CreatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Printf("Updated: %s\n", entry.UpdatedAt.Format("2006-01-02 15:04:05"))
+	return opts, opts.jsonOptions.check()
+}
+
+// handleList handles listing all passwords
+func handleList() {
+	opts, err := parseListArgs(os.Args[2:])
+	if err != nil {
+		failFlags(listFlags(&listOptions{}), err, listUsage())
+	}
+	renderTags := tagRenderer(opts.a11y)
+	color := tui.ColorEnabled(opts.a11y)
+	if opts.show && database.IsViewer() {
+		fmt.Fprintf(os.Stderr, "Error: passwords are redacted in viewer sessions\n")
+		exit(1)
+	}
+
+	entries, err := database.ListPasswords()
+	if err == nil {
+		entries, err = applyWhere(opts.where, entries)
+	}
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+
+	if opts.json {
+		if err := writeEntriesJSON(os.Stdout, entries, opts.includeSecrets); err != nil {
+			printError(err)
+			exit(1)
+		}
+		return
+	}
+	if opts.template != nil {
+		out, err := renderList(opts.template, entries, opts.show)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No passwords found.")
+		return
+	}
+
+	if opts.groupBy != "" {
+		printGroupedByHost(entries, color)
+		return
+	}
+
+	fmt.Printf("Found %d passwords:\n\n", len(entries))
+	now := time.Now()
+	for _, entry := range entries {
+		fmt.Printf("Name: %s%s%s%s\n", tui.EntryIcon(entry.Name, entry.Icon, color), entry.Name, recipientMarker(entry), expiryMarker(entry, now))
+		if entry.IsNote() {
+			fmt.Println("Type: note")
+			fmt.Println("Note: ********")
+		}
+		if entry.Username != "" {
+			fmt.Printf("Username: %s\n", entry.Username)
+		}
+		if entry.URL != "" {
+			fmt.Printf("URL: %s\n", entry.URL)
+		}
+		if len(entry.Tags) > 0 {
+			fmt.Printf("Tags: %s\n", renderTags(entry.Tags))
+		}
+		fmt.Printf("Updated: %s\n", formatTime(entry.UpdatedAt, opts.long))
+		if entry.ExpiresAt != nil {
+			fmt.Printf("Expires: %s\n", formatTime(*entry.ExpiresAt, opts.long))
+		}
+		fmt.Println("---")
+	}
+}
+
+// listUsage returns the usage line of list
+func listUsage() string {
+	return os.Args[0] + " list [--where <expr>] [--long] [--a11y] [--template <template> [--show-passwords] | --group-by url | --json [--include-secrets]]"
+}
+
+// listOptions are the arguments of list
+type listOptions struct {
+	jsonOptions
+	whereExpr, templateText, groupBy string
+	long, a11y, show                 bool
+	where                            *query.Query
+	template                         *template.Template
+}
+
+// listFlags returns the flag set of list, filling opts
+func listFlags(opts *listOptions) *flag.FlagSet {
+	fs := newFlagSet("list")
+	fs.StringVar(&opts.whereExpr, "where", "", "list only the entries matching `expr`")
+	fs.BoolVar(&opts.long, "long", false, "show exact times")
+	fs.BoolVar(&opts.a11y, "a11y", false, "plain text without colors or icons")
+	fs.StringVar(&opts.templateText, "template", "", "print each entry through a Go `template`")
+	fs.BoolVar(&opts.show, "show-passwords", false, "let --template print .Password")
+	fs.StringVar(&opts.groupBy, "group-by", "", "group the entries by `url`, the only grouping there is")
+	opts.jsonOptions.addFlags(fs)
+	return fs
+}
+
+// parseListArgs reads the arguments of list, compiling its query and
+// template
+func parseListArgs(args []string) (*listOptions, error) {
+	opts := &listOptions{}
+	fs := listFlags(opts)
+	rest, err := parseFlags(fs, args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	given := flagsGiven(fs)
+	if opts.where, err = parseWhere(opts.whereExpr, given["where"]); err != nil {
+		return nil, err
+	}
+	if given["template"] {
+		if opts.template, err = parseListTemplate(opts.templateText); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case given["group-by"] && opts.groupBy != "url":
+		return nil, fmt.Errorf("--group-by must be url")
+	case opts.groupBy != "" && opts.template != nil:
+		return nil, fmt.Errorf("--group-by cannot be combined with --template")
+	case opts.json && (opts.template != nil || opts.groupBy != ""):
+		return nil, fmt.Errorf("--json cannot be combined with --template or --group-by")
+	}
+	return opts, opts.jsonOptions.check()
+}
+
+// handleDelete handles deleting a password
+func handleDelete() {
+	opts, err := parseDeleteArgs(os.Args[2:])
+	if err != nil {
+		failFlags(deleteFlags(&deleteOptions{}), err, deleteUsage())
+	}
+	if opts.where != nil {
+		deleteWhere(opts.where, opts.permanent)
+		return
+	}
+	name, permanent := opts.name, opts.permanent
+	id, err := entryID(name)
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	if id == 0 && !opts.exact {
+		if name, err = findSimilar(name); err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+
+	// Confirm deletion
+	if permanent {
+		fmt.Printf("Are you sure you want to permanently delete password '%s'? (y/N): ", name)
+	} else {
+		fmt.Printf("Are you sure you want to delete password '%s'? (y/N): ", name)
+	}
+	response, err := stdin.ReadString('\n')
+	if err != nil {
+		printError(fmt.Errorf("failed to read input: %w", err))
+		exit(1)
+	}
+
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response != "y" && response != "yes" {
+		fmt.Println("Deletion cancelled.")
+		return
+	}
+
+	if err := deleteEntry(name, permanent); err != nil {
+		printError(fmt.Errorf("failed to delete password: %w", err))
+		exit(1)
+	}
+
+	if permanent {
+		fmt.Printf("Password '%s' deleted permanently.\n", name)
+	} else {
+		fmt.Printf("Password '%s' moved to the trash; '%s restore %s' brings it back.\n", name, os.Args[0], name)
+	}
+	queueHook(hooks.Delete, name)
+}
+
+// deleteUsage returns the usage lines of delete
+func deleteUsage() string {
+	return os.Args[0] + " delete [--permanent] [--exact] [--] <name>\n" +
+		"       " + os.Args[0] + " delete [--permanent] --where <expr>"
+}
+
+// deleteOptions are the arguments of delete
+type deleteOptions struct {
+	name, whereExpr  string
+	permanent, exact bool
+	where            *query.Query
+}
+
+// deleteFlags returns the flag set of delete, filling opts
+func deleteFlags(opts *deleteOptions) *flag.FlagSet {
+	fs := newFlagSet("delete")
+	fs.StringVar(&opts.whereExpr, "where", "", "delete every entry matching `expr` instead of one by name")
+	fs.BoolVar(&opts.permanent, "permanent", false, "delete for good instead of moving to the trash")
+	fs.BoolVar(&opts.exact, "exact", false, "do not fall back to a similar name")
+	return fs
+}
+
+// parseDeleteArgs reads the arguments of delete: a name, made of all
+// positional arguments, or a query, but not both
+func parseDeleteArgs(args []string) (*deleteOptions, error) {
+	opts := &deleteOptions{}
+	fs := deleteFlags(opts)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	opts.name = strings.Join(words, " ")
+	if opts.where, err = parseWhere(opts.whereExpr, flagsGiven(fs)["where"]); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.where != nil && opts.name != "":
+		return nil, fmt.Errorf("a name and --where cannot be combined")
+	case opts.where == nil && opts.name == "":
+		return nil, fmt.Errorf("a name or --where is needed")
+	}
+	return opts, nil
+}
+
+// deleteEntry moves the entry called name to the trash, or deletes it
+// for good if permanent
+func deleteEntry(name string, permanent bool) error {
+	if permanent {
+		return database.DeletePermanently(name)
+	}
+	return database.DeletePassword(name)
+}
+
+// deleteWhere deletes every entry matching a query after confirmation
+func deleteWhere(where *query.Query, permanent bool) {
+	entries, err := queryEntries(where)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No passwords match.")
+		return
+	}
+
+	fmt.Printf("This deletes %d entries:\n", len(entries))
+	for _, entry := range entries {
+		fmt.Printf("  %s\n", entry.Name)
+	}
+	fmt.Print("Are you sure? (y/N): ")
+	response, err := readLine()
+	if err != nil {
+		printError(fmt.Errorf("failed to read input: %w", err))
+		exit(1)
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response != "y" && response != "yes" {
+		fmt.Println("Deletion cancelled.")
+		return
+	}
+
+	for _, entry := range entries {
+		if err := deleteEntry(entry.Name, permanent); err != nil {
+			printError(fmt.Errorf("failed to delete password: %w", err))
+			exit(1)
+		}
+		queueHook(hooks.Delete, entry.Name)
+	}
+	if permanent {
+		fmt.Printf("Deleted %d entries permanently.\n", len(entries))
+	} else {
+		fmt.Printf("Moved %d entries to the trash.\n", len(entries))
+	}
+}
+
+// handleSearch handles searching passwords
+func handleSearch() {
+	opts, err := parseSearchArgs(os.Args[2:])
+	if err != nil {
+		failFlags(searchFlags(&searchOptions{}), err, searchUsage())
+	}
+	if hasField(opts.search.Fields, storage.FieldPassword) && database.IsViewer() {
+		fmt.Fprintf(os.Stderr, "Error: passwords are redacted in viewer sessions\n")
+		exit(1)
+	}
+	text := opts.text
+
+	renderTags := tagRenderer(opts.a11y)
+	color := tui.ColorEnabled(opts.a11y)
+
+	matches, err := database.SearchPasswordsAdvanced(text, opts.search)
+	if err == nil {
+		matches, err = applyWhereMatches(opts.where, matches)
+	}
+	if err != nil {
+		printError(fmt.Errorf("failed to search passwords: %w", err))
+		exit(1)
+	}
+	if opts.json {
+		if err := writeMatchesJSON(os.Stdout, matches, opts.includeSecrets); err != nil {
+			printError(err)
+			exit(1)
+		}
+		return
+	}
+
+	if len(matches) == 0 {
+		fmt.Printf("No passwords found matching '%s'.\n", text)
+		return
+	}
+
+	fmt.Printf("Found %d passwords matching '%s':\n\n", len(matches), text)
+	for _, match := range matches {
+		entry := match.Entry
+		fmt.Printf("Name: %s%s%s\n", tui.EntryIcon(entry.Name, entry.Icon, color), entry.Name, recipientMarker(entry))
+		if entry.IsNote() {
+			fmt.Println("Type: note")
+			fmt.Println("Note: ********")
+		}
+		if entry.Username != "" {
+			fmt.Printf("Username: %s\n", entry.Username)
+		}
+		if entry.URL != "" {
+			fmt.Printf("URL: %s\n", entry.URL)
+		}
+		if len(entry.Tags) > 0 {
+			fmt.Printf("Tags: %s\n", renderTags(entry.Tags))
+		}
+		fmt.Printf("Matched: %s\n", strings.Join(match.Fields, ", "))
+		fmt.Println("---")
+	}
+}
+
+// searchUsage returns the usage line of search
+func searchUsage() string {
+	return os.Args[0] + " search <query> [--in <field1,field2>] [--include-passwords] [--regex] [--case-sensitive] [--where <expr>] [--a11y] [--json [--include-secrets]]"
+}
+
+// searchOptions are the arguments of search
+type searchOptions struct {
+	jsonOptions
+	text, in, whereExpr    string
+	includePasswords, a11y bool
+	search                 storage.SearchOptions
+	where                  *query.Query
+}
+
+// searchFlags returns the flag set of search, filling opts
+func searchFlags(opts *searchOptions) *flag.FlagSet {
+	fs := newFlagSet("search")
+	fs.StringVar(&opts.in, "in", "", "comma-separated `fields` to match: "+strings.Join(storage.DefaultSearchFields, ", "))
+	fs.BoolVar(&opts.includePasswords, "include-passwords", false, "match passwords too")
+	fs.BoolVar(&opts.search.Regex, "regex", false, "take the query as a regular expression")
+	fs.BoolVar(&opts.search.CaseSensitive, "case-sensitive", false, "match case")
+	fs.StringVar(&opts.whereExpr, "where", "", "only the entries matching `expr`")
+	fs.BoolVar(&opts.a11y, "a11y", false, "plain text without colors or icons")
+	opts.jsonOptions.addFlags(fs)
+	return fs
+}
+
+// parseSearchArgs reads the arguments of search: the query, made of all
+// positional arguments as a name is, the fields to match from --in, with
+// the password added by --include-passwords, and --regex and
+// --case-sensitive
+func parseSearchArgs(args []string) (*searchOptions, error) {
+	opts := &searchOptions{}
+	fs := searchFlags(opts)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	opts.text = strings.Join(words, " ")
+	if opts.text == "" {
+		return nil, fmt.Errorf("a query is needed")
+	}
+	given := flagsGiven(fs)
+	if opts.where, err = parseWhere(opts.whereExpr, given["where"]); err != nil {
+		return nil, err
+	}
+
+	if given["in"] {
+		for _, field := range parseTags(strings.ToLower(opts.in)) {
+			if field == storage.FieldPassword {
+				return nil, fmt.Errorf("passwords are searched with --include-passwords")
+			}
+			if !hasField(storage.DefaultSearchFields, field) {
+				return nil, fmt.Errorf("--in takes %s", strings.Join(storage.DefaultSearchFields, ", "))
+			}
+			if !hasField(opts.search.Fields, field) {
+				opts.search.Fields = append(opts.search.Fields, field)
+			}
+		}
+		if len(opts.search.Fields) == 0 {
+			return nil, fmt.Errorf("--in needs at least one field")
+		}
+	}
+	if opts.includePasswords {
+		if len(opts.search.Fields) == 0 {
+			opts.search.Fields = append(opts.search.Fields, storage.DefaultSearchFields...)
+		}
+		opts.search.Fields = append(opts.search.Fields, storage.FieldPassword)
+	}
+	if opts.search.Regex {
+		if _, err := regexp.Compile(opts.text); err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+	}
+	return opts, opts.jsonOptions.check()
+}
+
+// hasField reports whether field is one of fields
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// handleStats handles displaying database statistics
+func handleStats() {
+	opts, err := parseStatsArgs(os.Args[2:])
+	if err != nil {
+		failFlags(statsFlags(&statsOptions{}), err, os.Args[0]+" stats [--long | --json]")
+	}
+	long := opts.long
+
+	stats, err := database.GetStats()
+	if err != nil {
+		printError(fmt.Errorf("failed to get stats: %w", err))
+		exit(1)
+	}
+	if opts.json {
+		printJSON(statsJSON(stats))
+		return
+	}
+
+	if fromBackup != "" {
+		fmt.Printf("Backup Statistics (%s):\n", fromBackup)
+		fmt.Printf("Total passwords: %d\n", stats["total_passwords"])
+		fmt.Printf("Database size: %d bytes in memory\n", stats["database_size"])
+		fmt.Printf("Backup made: %s\n", formatTime(fromBackupMade, long))
+		return
+	}
+
+	fmt.Println("Database Statistics:")
+	fmt.Printf("Total passwords: %d\n", stats["total_passwords"])
+	fmt.Printf("Database size: %d bytes\n", stats["database_size"])
+	fmt.Printf("Full-file encryption: %t\n", stats["full_encryption"])
+	fmt.Printf("Created: %s\n", formatTime(stats["created_at"].(time.Time), long))
+	for _, warning := range quotaWarnings(stats) {
+		fmt.Printf("Warning: %s; '%s split' can move entries to another vault\n", warning, os.Args[0])
+	}
+}
+
+// statsOptions are the arguments of stats
+type statsOptions struct {
+	json, long bool
+}
+
+// statsFlags returns the flag set of stats, filling opts
+func statsFlags(opts *statsOptions) *flag.FlagSet {
+	fs := newFlagSet("stats")
+	fs.BoolVar(&opts.json, "json", false, "print JSON to script against")
+	fs.BoolVar(&opts.long, "long", false, "show exact times")
+	return fs
+}
+
+// parseStatsArgs reads the arguments of stats
+func parseStatsArgs(args []string) (*statsOptions, error) {
+	opts := &statsOptions{}
+	rest, err := parseFlags(statsFlags(opts), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// statsJSON is the --json form of the stats of the vault: those of
+// GetStats, with the warnings the text form shows, or for a backup when
+// it was made
+func statsJSON(stats map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(stats)+1)
+	for key, value := range stats {
+		out[key] = value
+	}
+	if fromBackup != "" {
+		out["backup_made"] = fromBackupMade
+		return out
+	}
+	warnings := quotaWarnings(stats)
+	if warnings == nil {
+		warnings = []string{}
+	}
+	out["warnings"] = warnings
+	return out
+}
+
+// handleAnalyze handles password strength analysis
+func handleAnalyze() {
+	opts, err := parseAnalyzeArgs(os.Args[2:])
+	if err != nil {
+		failFlags(analyzeFlags(&analyzeOptions{}), err, analyzeUsage())
+	}
+	if opts.compare {
+		if err := comparePasswords(newTerminalPrompter(), os.Stdout, opts.json); err != nil {
+			printError(err)
+			exit(1)
+		}
+		return
+	}
+
+	password, rules := opts.password, opts.rules
+	analysis := generator.Analyze(password)
+
+	fmt.Println("Password Strength Analysis:")
+	fmt.Printf("Length: %d characters\n", analysis.Length)
+	fmt.Printf("Has uppercase: %t\n", analysis.HasUpper)
+	fmt.Printf("Has lowercase: %t\n", analysis.HasLower)
+	fmt.Printf("Has numbers: %t\n", analysis.HasDigits)
+	fmt.Printf("Has symbols: %t\n", analysis.HasSymbols)
+	fmt.Printf("Unique characters: %d\n", analysis.UniqueChars)
+	fmt.Printf("Strength score: %d/%d\n", analysis.Score, generator.MaxScore)
+	fmt.Printf("Strength level: %s\n", analysis.Level)
+	fmt.Printf("Entropy: %.1f bits\n", analysis.EntropyBits)
+	fmt.Printf("Estimated crack time: %s (offline, %.0f billion guesses per second)\n", analysis.EstimatedCrackTime, generator.GuessesPerSecond/1e9)
+
+	if rules == nil {
+		return
+	}
+	violations := rules.Check(password)
+	if len(violations) == 0 {
+		fmt.Printf("Meets: %s\n", rules)
+		return
+	}
+	fmt.Printf("Does not meet: %s\n", rules)
+	for _, v := range violations {
+		fmt.Printf("  %s\n", v)
+	}
+	exit(2)
+}
+
+// analyzeUsage returns the usage lines of analyze
+func analyzeUsage() string {
+	return os.Args[0] + " analyze [--verify <rules>] [--] <password>\n" +
+		"       " + os.Args[0] + " analyze --compare [--json]"
+}
+
+// analyzeOptions are the arguments of analyze
+type analyzeOptions struct {
+	password, verify string
+	compare, json    bool
+	rules            *policy.SiteRules
+}
+
+// analyzeFlags returns the flag set of analyze, filling opts
+func analyzeFlags(opts *analyzeOptions) *flag.FlagSet {
+	fs := newFlagSet("analyze")
+	fs.StringVar(&opts.verify, "verify", "", "site `rules` to check the password against, such as min=12,classes=3")
+	fs.BoolVar(&opts.compare, "compare", false, "compare passwords typed at the prompt instead")
+	fs.BoolVar(&opts.json, "json", false, "print the comparison as JSON")
+	return fs
+}
+
+// parseAnalyzeArgs reads the arguments of analyze: one password, or
+// --compare to be asked for them. A password starting with a dash comes
+// after "--".
+func parseAnalyzeArgs(args []string) (*analyzeOptions, error) {
+	opts := &analyzeOptions{}
+	fs := analyzeFlags(opts)
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	given := flagsGiven(fs)
+	if opts.compare {
+		if given["verify"] {
+			return nil, fmt.Errorf("--verify cannot be combined with --compare")
+		}
+		return opts, noArguments(rest)
+	}
+	switch {
+	case opts.json:
+		return nil, fmt.Errorf("--json needs --compare")
+	case len(rest) == 0:
+		return nil, fmt.Errorf("a password is needed")
+	case len(rest) > 1:
+		return nil, fmt.Errorf("unexpected argument %s (quote a password with spaces)", rest[1])
+	}
+	opts.password = rest[0]
+	if given["verify"] {
+		if opts.rules, err = policy.ParseSiteRules(opts.verify); err != nil {
+			return nil, fmt.Errorf("invalid --verify rules: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// handleViewer manages the read-only viewer credential
+func handleViewer() {
+	if err := parseViewerArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" viewer <enable|rotate|disable|status>")
+	}
+
+	enabled, err := database.HasViewer()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	switch os.Args[2] {
+	case "status":
+		if enabled {
+			fmt.Println("Viewer credential: enabled")
+		} else {
+			fmt.Println("Viewer credential: disabled")
+		}
+	case "enable", "rotate":
+		if os.Args[2] == "enable" && enabled {
+			fmt.Fprintf(os.Stderr, "Error: viewer credential already enabled, use 'viewer rotate' to replace it\n")
+			exit(1)
+		}
+		if os.Args[2] == "rotate" && !enabled {
+			fmt.Fprintf(os.Stderr, "Error: no viewer credential enabled, use 'viewer enable'\n")
+			exit(1)
+		}
+
+		viewerPassword, err := generateViewerPassword()
+		if err != nil {
+			printError(fmt.Errorf("failed to generate viewer password: %w", err))
+			exit(1)
+		}
+		if err := database.EnableViewer(masterSecret.Reveal(), viewerPassword); err != nil {
+			printError(fmt.Errorf("failed to enable viewer credential: %w", err))
+			exit(1)
+		}
+
+		fmt.Println("Viewer password (shown only once, store it now):")
+		fmt.Println(viewerPassword)
+		fmt.Println()
+		fmt.Println("Unlocking with it opens the vault read-only with all passwords redacted.")
+	case "disable":
+		if !enabled {
+			fmt.Println("Viewer credential is not enabled.")
+			return
+		}
+		if err := database.DisableViewer(masterSecret.Reveal()); err != nil {
+			printError(fmt.Errorf("failed to disable viewer credential: %w", err))
+			exit(1)
+		}
+		fmt.Println("Viewer credential disabled.")
+	}
+}
+
+// parseViewerArgs checks the arguments of viewer: one of its
+// subcommands, which take no arguments
+func parseViewerArgs(args []string) error {
+	if len(args) == 0 || !hasFlag([]string{"enable", "rotate", "disable", "status"}, args[0]) {
+		return subcommandError("viewer", args)
+	}
+	return parseNoArgs(args[1:])
+}
+
+// handleConvert switches the vault file between plain SQLite with
+// per-field encryption and whole-file encryption
+func handleConvert() {
+	enable, err := parseConvertArgs(os.Args[2:])
+	if err != nil {
+		failFlags(convertFlags(new(bool), new(bool)), err, os.Args[0]+" convert <--full-encryption|--plain>")
+	}
+
+	if enable == database.IsFullyEncrypted() {
+		fmt.Println("Vault is already in that format.")
+		return
+	}
+	if err := database.SetFullEncryption(masterSecret.Reveal(), enable); err != nil {
+		printError(fmt.Errorf("failed to convert vault: %w", err))
+		exit(1)
+	}
+
+	if enable {
+		fmt.Println("Vault converted: the whole file is now encrypted.")
+	} else {
+		fmt.Println("Vault converted: plain SQLite file with encrypted fields.")
+	}
+}
+
+// convertFlags returns the flag set of convert, filling full and plain
+func convertFlags(full, plain *bool) *flag.FlagSet {
+	fs := newFlagSet("convert")
+	fs.BoolVar(full, "full-encryption", false, "encrypt the whole file")
+	fs.BoolVar(plain, "plain", false, "go back to a plain SQLite file with encrypted fields")
+	return fs
+}
+
+// parseConvertArgs reads the arguments of convert and reports whether
+// they ask for whole-file encryption. One of its flags is needed.
+func parseConvertArgs(args []string) (bool, error) {
+	var full, plain bool
+	rest, err := parseFlags(convertFlags(&full, &plain), args)
+	switch {
+	case err != nil:
+		return false, err
+	case len(rest) > 0:
+		return false, noArguments(rest)
+	case full == plain:
+		return false, fmt.Errorf("one of --full-encryption and --plain is needed")
+	}
+	return full, nil
+}
+
+// handleRecipients shows and changes the age recipients of an entry. The
+// password is re-wrapped, never changed.
+func handleRecipients() {
+	opts, err := parseRecipientsArgs(os.Args[2:])
+	if err != nil {
+		failFlags(recipientsFlags(&recipientsOptions{}), err, os.Args[0]+" recipients <name> [--add-recipient <age1...>]... [--remove-recipient <age1...>]...")
+	}
+	name, added, removed := opts.name, opts.added, opts.removed
+
+	recipients, err := database.Recipients(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		drop := make(map[string]bool)
+		for _, key := range removed {
+			drop[strings.TrimSpace(key)] = true
+		}
+		var kept []string
+		for _, key := range append(append([]string{}, recipients...), added...) {
+			if !drop[strings.TrimSpace(key)] {
+				kept = append(kept, key)
+			}
+		}
+		if recipients, err = recipient.NormalizeKeys(kept); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if err := database.SetRecipients(name, recipients); err != nil {
+			printError(fmt.Errorf("failed to update recipients: %w", err))
+			exit(1)
+		}
+	}
+
+	if len(recipients) == 0 {
+		fmt.Printf("'%s' is readable by anyone who can unlock the vault.\n", name)
+		return
+	}
+	fmt.Printf("Recipients of '%s':\n", name)
+	for _, key := range recipients {
+		fmt.Printf("  %s\n", key)
+	}
+}
+
+// recipientsOptions are the arguments of recipients
+type recipientsOptions struct {
+	name           string
+	added, removed []string
+}
+
+// recipientsFlags returns the flag set of recipients, filling opts
+func recipientsFlags(opts *recipientsOptions) *flag.FlagSet {
+	fs := newFlagSet("recipients")
+	fs.Var(listFlag{&opts.added}, "add-recipient", "an age `key` to add; may be repeated")
+	fs.Var(listFlag{&opts.removed}, "remove-recipient", "an age `key` to remove; may be repeated")
+	return fs
+}
+
+// parseRecipientsArgs reads the arguments of recipients. All positional
+// arguments form the name.
+func parseRecipientsArgs(args []string) (*recipientsOptions, error) {
+	opts := &recipientsOptions{}
+	words, err := parseFlags(recipientsFlags(opts), args)
+	if err != nil {
+		return nil, err
+	}
+	if opts.name = strings.Join(words, " "); opts.name == "" {
+		return nil, fmt.Errorf("a name is needed")
+	}
+	return opts, nil
+}
+
+// handleVerify checks whether a candidate matches the stored password
+// without ever printing it. Exits 0 on a match and 2 otherwise. With
+// --against history a candidate matching an earlier password is told by
+// when that was replaced, and exits 3.
+func handleVerify() {
+	opts, err := parseVerifyArgs(os.Args[2:])
+	if err != nil {
+		failFlags(verifyFlags(&verifyOptions{}), err, os.Args[0]+" verify [--stdin] [--no-touch] [--against history] [--] <name>")
+	}
+	name := opts.name
+
+	if database.IsViewer() {
+		fmt.Fprintf(os.Stderr, "Error: passwords are redacted in viewer sessions\n")
+		exit(1)
+	}
+	entry, err := database.GetPassword(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	var candidate string
+	if opts.stdin {
+		if candidate, err = readLine(); err != nil {
+			printError(fmt.Errorf("failed to read candidate: %w", err))
+			exit(1)
+		}
+	} else {
+		candidate, err = newTerminalPrompter().AskSecret("Candidate password: ")
+		if err != nil {
+			printError(fmt.Errorf("failed to read candidate: %w", err))
+			exit(1)
+		}
+	}
+
+	if !opts.noTouch {
+		markAccessed(entry.Name)
+	}
+
+	if crypto.SecretsEqual(candidate, entry.Password) {
+		fmt.Println("match")
+		return
+	}
+	if opts.history {
+		items, err := database.GetPasswordHistory(entry.Name)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		if item := historyMatch(candidate, items); item != nil {
+			fmt.Printf("no match; it is the password replaced %s\n", formatTime(item.ReplacedAt, false))
+			closeDatabase()
+			exit(3)
+		}
+	}
+	fmt.Println("no match")
+	closeDatabase()
+	exit(2)
+}
+
+// verifyOptions are the arguments of verify
+type verifyOptions struct {
+	name, against           string
+	stdin, noTouch, history bool
+}
+
+// verifyFlags returns the flag set of verify, filling opts
+func verifyFlags(opts *verifyOptions) *flag.FlagSet {
+	fs := newFlagSet("verify")
+	fs.BoolVar(&opts.stdin, "stdin", false, "read the candidate from a line of stdin instead of asking")
+	fs.BoolVar(&opts.noTouch, "no-touch", false, "do not record this read as the last access")
+	fs.StringVar(&opts.against, "against", "", "with `history`, also tell whether the candidate is an earlier password")
+	return fs
+}
+
+// parseVerifyArgs reads the arguments of verify. All positional
+// arguments form the name.
+func parseVerifyArgs(args []string) (*verifyOptions, error) {
+	opts := &verifyOptions{}
+	words, err := parseFlags(verifyFlags(opts), args)
+	if err != nil {
+		return nil, err
+	}
+	if opts.name = strings.Join(words, " "); opts.name == "" {
+		return nil, fmt.Errorf("a name is needed")
+	}
+	switch opts.against {
+	case "", "current":
+	case "history":
+		opts.history = true
+	default:
+		return nil, fmt.Errorf("--against must be current or history")
+	}
+	return opts, nil
+}
+
+// handleTag manages tag display styles, which are kept in the config
+// file rather than the vault
+func handleTag() {
+	usage := os.Args[0] + " tag style <tag> [options]\n" +
+		"       " + os.Args[0] + " tag styles"
+	switch {
+	case len(os.Args) > 2 && os.Args[2] == "style":
+		handleTagStyle()
+	case len(os.Args) > 2 && os.Args[2] == "styles":
+		if err := parseNoArgs(os.Args[3:]); err != nil {
+			failFlags(nil, err, usage)
+		}
+		c, err := config.Load(configPath)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		styles := c.TagStyles
+		if len(styles) == 0 {
+			fmt.Println("No tag styles set.")
+			return
+		}
+		tags := make([]string, 0, len(styles))
+		for tag := range styles {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		color := tui.ColorEnabled(false)
+		for _, tag := range tags {
+			style := styles[tag]
+			fmt.Printf("%s  color=%s icon=%s\n", tui.TagChip(tag, style.Color, style.Icon, color), style.Color, style.Icon)
+		}
+	default:
+		failFlags(nil, subcommandError("tag", os.Args[2:]), usage)
+	}
+}
+
+// handleTagStyle assigns a color and icon to a tag
+func handleTagStyle() {
+	usage := fmt.Sprintf("%s tag style <tag> [--color <%s>] [--icon <char>] [--reset]",
+		os.Args[0], strings.Join(tui.ColorNames(), "|"))
+	var change tagStyleChange
+	tag, err := parseTagStyleArgs(os.Args[3:], &change)
+	if err != nil {
+		failFlags(tagStyleFlags(&tagStyleChange{}), err, usage)
+	}
+
+	c, err := config.Load(configPath)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	style := change.apply(c.TagStyles[tag])
+
+	if style.Color != "" && !tui.ValidColor(style.Color) {
+		fmt.Fprintf(os.Stderr, "Error: unknown color %q (choose from %s)\n", style.Color, strings.Join(tui.ColorNames(), ", "))
+		exit(1)
+	}
+	if style.Icon != "" && !tui.ValidIcon(style.Icon) {
+		fmt.Fprintf(os.Stderr, "Error: icon must be a single printable character\n")
+		exit(1)
+	}
+
+	if err := config.SetTagStyle(configPath, tag, style); err != nil {
+		printError(fmt.Errorf("failed to save tag style: %w", err))
+		exit(1)
+	}
+	// The interactive shell renders tags with the settings it loaded
+	if c, err := config.Load(configPath); err == nil {
+		settings.TagStyles = c.TagStyles
+	}
+	fmt.Printf("Style for tag '%s' saved in %s.\n", tag, configPath)
+}
+
+// tagStyleChange is what tag style changes in the style of a tag
+type tagStyleChange struct {
+	color, icon string
+	reset       bool
+}
+
+// apply returns style changed: cleared first with --reset, then given
+// the color and icon that were set
+func (c tagStyleChange) apply(style config.TagStyle) config.TagStyle {
+	if c.reset {
+		style = config.TagStyle{}
+	}
+	if c.color != "" {
+		style.Color = c.color
+	}
+	if c.icon != "" {
+		style.Icon = c.icon
+	}
+	return style
+}
+
+// tagStyleFlags returns the flag set of tag style, filling change
+func tagStyleFlags(change *tagStyleChange) *flag.FlagSet {
+	fs := newFlagSet("tag style")
+	fs.StringVar(&change.color, "color", "", "the `color` of the tag")
+	fs.StringVar(&change.icon, "icon", "", "a single `char` shown before the tag")
+	fs.BoolVar(&change.reset, "reset", false, "go back to the default style")
+	return fs
+}
+
+// parseTagStyleArgs reads the arguments of tag style into change and
+// returns the tag
+func parseTagStyleArgs(args []string, change *tagStyleChange) (string, error) {
+	rest, err := parseFlags(tagStyleFlags(change), args)
+	switch {
+	case err != nil:
+		return "", err
+	case len(rest) == 0:
+		return "", fmt.Errorf("a tag is needed")
+	case len(rest) > 1:
+		return "", fmt.Errorf("unexpected argument %s", rest[1])
+	}
+	return rest[0], nil
+}
+
+// tagRenderer returns a function rendering tag lists as colored chips when
+// stdout is a terminal, or as plain text under NO_COLOR or --a11y
+func tagRenderer(a11y bool) func([]string) string {
+	color := tui.ColorEnabled(a11y)
+	return func(tags []string) string {
+		chips := make([]string, len(tags))
+		for i, tag := range tags {
+			style := settings.TagStyles[tag]
+			chips[i] = tui.TagChip(tag, style.Color, style.Icon, color)
+		}
+		return strings.Join(chips, ", ")
+	}
+}
+
+// generateViewerPassword returns a random viewer password that is easy to
+// transcribe (base32, grouped in blocks of four)
+func generateViewerPassword() (string, error) {
+	raw, err := crypto.GenerateRandomBytes(20)
+	if err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+
+	var groups []string
+	for len(encoded) > 4 {
+		groups = append(groups, encoded[:4])
+		encoded = encoded[4:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-"), nil
+}
+
+// recipientMarker describes an entry encrypted to recipients in listings,
+// e.g. " [locked, 2 recipients]" when no loaded identity can read it
+func recipientMarker(entry *storage.PasswordEntry) string {
+	n := len(entry.Recipients)
+	if n == 0 {
+		return ""
+	}
+	noun := "recipients"
+	if n == 1 {
+		noun = "recipient"
+	}
+	if entry.Locked {
+		return fmt.Sprintf(" [locked, %d %s]", n, noun)
+	}
+	return fmt.Sprintf(" [%d %s]", n, noun)
+}
+
+// secret is a password held as GetSecret returns it
+type secret interface {
+	Reveal() []byte
+	Wipe()
+}
+
+// secretDisplay is how displayPasswordEntry shows the password of an
+// entry and the content of a note
+type secretDisplay int
+
+const (
+	// secretsMasked prints asterisks, so get leaves nothing usable in
+	// the scrollback unless asked
+	secretsMasked secretDisplay = iota
+	// secretsShown prints them, for get --show
+	secretsShown
+	// secretsRedacted marks them as withheld from a viewer session
+	secretsRedacted
+)
+
+// masked stands in for a secret that is not shown. Its length is fixed,
+// so it gives away nothing of the secret's.
+const masked = "********"
+
+// displayPasswordEntry displays a password entry with its password, which
+// it wipes once written. The password goes to w as bytes, never through
+// a string or a formatting buffer.
+func displayPasswordEntry(w io.Writer, entry *storage.PasswordEntry, password secret, display secretDisplay, long bool) {
+	fmt.Fprintf(w, "Name: %s%s\n", entry.Name, recipientMarker(entry))
+	if entry.IsNote() {
+		fmt.Fprintln(w, "Type: note")
+	}
+	if entry.Username != "" {
+		fmt.Fprintf(w, "Username: %s\n", entry.Username)
+	}
+	switch {
+	case display == secretsRedacted:
+		fmt.Fprintln(w, "Password: [redacted]")
+	case len(password.Reveal()) == 0 && entry.IsNote():
+	case display == secretsMasked:
+		fmt.Fprintf(w, "Password: %s\n", masked)
+	default:
+		io.WriteString(w, "Password: ")
+		w.Write(password.Reveal())
+		io.WriteString(w, "\n")
+	}
+	password.Wipe()
+	if entry.URL != "" {
+		fmt.Fprintf(w, "URL: %s\n", entry.URL)
+	}
+	// The content of a note is its secret; the notes of a login are not
+	if entry.IsNote() && display == secretsRedacted {
+		fmt.Fprintln(w, "Note: [redacted]")
+	} else if entry.IsNote() && display == secretsMasked && entry.Notes != "" {
+		fmt.Fprintf(w, "Note: %s\n", masked)
+	} else if entry.Notes != "" {
+		fmt.Fprintf(w, "Notes: %s\n", entry.Notes)
+	}
+	if len(entry.Tags) > 0 {
+		fmt.Fprintf(w, "Tags: %s\n", strings.Join(entry.Tags, ", "))
+	}
+	fmt.Fprintf(w, "Created: %s\n", formatTime(entry.CreatedAt, long))
+	fmt.Fprintf(w, "Updated: %s\n", formatTime(entry.UpdatedAt, long))
+	if entry.ExpiresAt != nil {
+		fmt.Fprintf(w, "Expires: %s\n", formatTime(*entry.ExpiresAt, long))
+	}
+	if long && !entry.LastAccessedAt.IsZero() {
+		fmt.Fprintf(w, "Last accessed: %s\n", formatTime(entry.LastAccessedAt, long))
+	}
+}
+
+// clearAfterKeypress waits for Enter and clears the screen and its
+// scrollback, so a password printed by get --show does not linger. Output
+// that is not a terminal has nothing to clear.
+func clearAfterKeypress() {
+	if !term.IsTerminal(int(os.Stdout.Fd())) || !stdinIsTerminal() {
+		return
+	}
+	fmt.Fprint(os.Stderr, "Press Enter to clear the screen.")
+	readLine()
+	fmt.Print("\x1b[H\x1b[2J\x1b[3J")
+}
+
+// markAccessed records a read of an entry's password. Failing to record
+// it is not worth failing the command over.
+func markAccessed(name string) {
+	if err := database.MarkAccessed(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// formatTime renders a timestamp relative to now ("3 months ago"), or
+// exactly when long output was requested
+func formatTime(t time.Time, long bool) string {
+	if long {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return duration.Humanize(t, time.Now())
+}
+
+// needsVault reports whether the command in args has to unlock the vault.
+// Help, version, init, the self-test, the demo, reading backup info or an
+// import report, comparing two backup files and decrypting an export
+// work without it.
+func needsVault(args []string) bool {
+	switch args[0] {
+	case "help", "-h", "--help", "version", "-v", "--version", "init", "completion", "selftest", "demo", "report", "checksum", "tag", "config":
+		return false
+	case "backup":
+		if len(args) > 1 && args[1] == "info" {
+			return false
+		}
+		return !(len(args) > 1 && args[1] == "diff" && !hasFlag(args, "--live"))
+	case "export":
+		_, _, decrypt, _ := takeFlagValue(args, "--decrypt")
+		return !decrypt
+	}
+	return true
+}
+
+// takeFlagValue removes "flag <value>" or "flag=<value>" from args,
+// stopping at "--", and returns the value and the remaining arguments
+func takeFlagValue(args []string, flag string) (string, []string, bool, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"="), rest, true, nil
+		}
+		if arg == flag {
+			if i+1 >= len(args) {
+				return "", nil, false, fmt.Errorf("%s needs a value", flag)
+			}
+			return args[i+1], append(append([]string{}, args[:i]...), args[i+2:]...), true, nil
+		}
+	}
+	return "", args, false, nil
+}
+
+// hasFlag reports whether the boolean flag is present in args
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag {
+			return true
+		}
+	}
+	return false
 }
 
 // showHelp displays help information
@@ -376,19 +2246,84 @@ func showHelp() {
 	fmt.Println("Usage:")
 	fmt.Printf("  %s <command> [options]\n\n", os.Args[0])
 	fmt.Println("Commands:")
-	fmt.Println("  generate, gen     Generate a new password")
+	fmt.Println("  init              Create a new vault")
+	fmt.Println("  generate, gen     Generate a new password, or a passphrase with --passphrase")
 	fmt.Println("  save              Save a password")
+	fmt.Println("  add               Create an entry with an interactive wizard")
+	fmt.Println("  put               Create or update an entry from a JSON document")
+	fmt.Println("  update, edit      Change some fields of an entry")
+	fmt.Println("  rename            Give an entry another name, keeping its history")
 	fmt.Println("  get, find         Retrieve a password")
+	fmt.Println("  history           List or show the earlier passwords of an entry")
+	fmt.Println("  copy              Copy a password to the clipboard for 30s")
 	fmt.Println("  list              List all passwords")
-	fmt.Println("  delete, del       Delete a password")
-	fmt.Println("  search            Search passwords")
+	fmt.Println("  delete, del       Move an entry to the trash, or delete it for good with --permanent")
+	fmt.Println("  trash             List or empty the entries in the trash")
+	fmt.Println("  restore           Bring an entry back from the trash")
+	fmt.Println("  search            Search names, usernames, URLs, notes and tags")
 	fmt.Println("  stats             Show database statistics")
 	fmt.Println("  analyze           Analyze password strength")
+	fmt.Println("  change-master     Change the master password")
+	fmt.Println("  migrate-kdf       Re-encrypt entries from older versions under Argon2id")
+	fmt.Println("  upgrade           Move a vault from an older version to this version's format")
+	fmt.Println("  split             Move the entries matching --where into another vault")
+	fmt.Println("  viewer            Manage the read-only viewer credential")
+	fmt.Println("  tag               Manage tag colors and icons")
+	fmt.Println("  config            Export the config file, or import one from another machine")
+	fmt.Println("  backup            Create, inspect and compare encrypted backups")
+	fmt.Println("  convert           Turn whole-file encryption on or off")
+	fmt.Println("  autotype          Type username and password into the focused window")
+	fmt.Println("  recipients        Show or change who can read an entry's password")
+	fmt.Println("  verify            Check a candidate password against an entry")
+	fmt.Println("  totp              Show, set or verify an entry's one-time codes")
+	fmt.Println("  note              Add or show secure notes")
+	fmt.Println("  reminders         Turn the daily todo-rotate reminder on or off")
+	fmt.Println("  expiring          List the entries expiring within --within (30d by default)")
+	fmt.Println("  audit             Report weak, reused and stale passwords; ack, unack or list acknowledged findings;")
+	fmt.Println("                    audit --misplaced-secrets finds secrets kept outside the password")
+	fmt.Println("  comply            Check the vault against the rules of a policy file")
+	fmt.Println("  export            Write entries to a pass(1) store, JSON or CSV")
+	fmt.Println("  import            Read entries from a pass(1) store or another manager's export;")
+	fmt.Println("                    import journal and import rollback <id> undo one")
+	fmt.Println("  report            Show an import report written with --report")
+	fmt.Println("  checksum          Check a password read aloud from 'get --dictation'")
+	fmt.Println("  retag             Apply the auto_tag rules of the config to every entry")
+	fmt.Println("  sync              Merge another copy of the vault and review its conflicts")
+	fmt.Println("  index             Rebuild the password reuse index")
+	fmt.Println("  icon              Download the site icons of entries")
+	fmt.Println("  selftest          Check encryption, storage and randomness without the vault")
+	fmt.Println("  interactive       Unlock once and run commands from a prompt (also: no command)")
+	fmt.Println("  demo              Try the commands on a throwaway vault of made-up entries")
+	fmt.Println("  completion        Print the bash completion script")
 	fmt.Println("  help              Show this help message")
 	fmt.Println("  version           Show version information")
 	fmt.Println()
+	fmt.Println("Timestamps are shown relative to now; pass --long to get, list or stats")
+	fmt.Println("for exact values.")
+	fmt.Println()
+	fmt.Println("list --template '{{.Name}}\\t{{.Username}}' prints each entry through a Go")
+	fmt.Println("template; .Password also needs --show-passwords.")
+	fmt.Println()
+	fmt.Println("get and copy also take a site such as google.com, and --username picks")
+	fmt.Println("one of several accounts on a site; list --group-by url shows them together.")
+	fmt.Println()
+	fmt.Println("Every command takes --help for its usage and a list of its flags.")
+	fmt.Println()
+	fmt.Println("get masks the password; --show prints it, and --clear then clears the")
+	fmt.Println("screen once Enter is pressed. --dictation spells it out to read aloud.")
+	fmt.Println()
+	fmt.Println("get, list, search and stats take --json for output to script against;")
+	fmt.Println("passwords and notes are left out unless --include-secrets is given too.")
+	fmt.Println()
+	fmt.Println("stats, list and search take --from-backup <file> to run on a backup,")
+	fmt.Println("loaded into memory, instead of the vault.")
+	fmt.Println()
+	fmt.Println("Commands that change the vault run the [hooks] of the config file;")
+	fmt.Println("--no-hooks skips them.")
+	fmt.Println()
 	fmt.Println("Examples:")
-	fmt.Printf("  %s generate --length 20 --uppercase --numbers --symbols\n", os.Args[0])
+	fmt.Printf("  %s generate --length 20 --no-symbols\n", os.Args[0])
+	fmt.Printf("  %s generate --passphrase --words=6 --separator=-\n", os.Args[0])
 	fmt.Printf("  %s save gmail --username user@example.com --password mypass\n", os.Args[0])
 	fmt.Printf("  %s get gmail\n", os.Args[0])
 	fmt.Printf("  %s analyze mypassword123\n", os.Args[0])
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/backup"
+	"password-manager/internal/generator"
+	"password-manager/internal/policy"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+func TestParseGetArgsName(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantLong bool
+	}{
+		{[]string{"gmail"}, "gmail", false},
+		{[]string{"My", "Bank"}, "My Bank", false},
+		{[]string{"My Bank"}, "My Bank", false},
+		{[]string{"My", "Bank", "--long"}, "My Bank", true},
+		{[]string{"--long", "My", "Bank"}, "My Bank", true},
+		{[]string{"--", "-weird"}, "-weird", false},
+		{[]string{"--long", "--", "--long"}, "--long", true},
+		{[]string{"--", "a", "--", "b"}, "a -- b", false},
+		{[]string{"Café", "Zürich"}, "Café Zürich", false},
+		{[]string{"銀行", "口座"}, "銀行 口座", false},
+		{[]string{"-"}, "-", false},
+	}
+
+	for _, tt := range tests {
+		opts, err := parseGetArgs(tt.args)
+		if err != nil {
+			t.Errorf("parseGetArgs(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if opts.name != tt.wantName || opts.long != tt.wantLong {
+			t.Errorf("parseGetArgs(%q) = %q, %t; want %q, %t", tt.args, opts.name, opts.long, tt.wantName, tt.wantLong)
+		}
+	}
+}
+
+func TestParseNameArgsErrors(t *testing.T) {
+	// A leading dash without "--" is taken as a flag and rejected
+	if _, err := parseGetArgs([]string{"-weird"}); err == nil {
+		t.Error("Expected error for unknown flag")
+	}
+	if _, err := parseVerifyArgs([]string{"gmail", "--show"}); err == nil {
+		t.Error("Expected error for flag not accepted by the command")
+	}
+	if _, err := parseGetArgs(nil); err == nil || err.Error() != "a name is needed" {
+		t.Errorf("Expected a name to be asked for, got %v", err)
+	}
+}
+
+func TestTakeFlagValue(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantValue string
+		wantRest  []string
+		wantFound bool
+	}{
+		{[]string{"bank", "--format", "{username}"}, "{username}", []string{"bank"}, true},
+		{[]string{"--format={password}", "My", "Bank"}, "{password}", []string{"My", "Bank"}, true},
+		{[]string{"bank"}, "", []string{"bank"}, false},
+		{[]string{"--", "--format", "x"}, "", []string{"--", "--format", "x"}, false},
+	}
+
+	for _, tt := range tests {
+		value, rest, found, err := takeFlagValue(tt.args, "--format")
+		if err != nil {
+			t.Errorf("takeFlagValue(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if value != tt.wantValue || found != tt.wantFound || strings.Join(rest, " ") != strings.Join(tt.wantRest, " ") {
+			t.Errorf("takeFlagValue(%q) = %q, %q, %t", tt.args, value, rest, found)
+		}
+	}
+
+	if _, _, _, err := takeFlagValue([]string{"bank", "--format"}, "--format"); err == nil {
+		t.Error("Expected error for a missing value")
+	}
+}
+
+func TestParseSearchArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantText string
+		wantOpts storage.SearchOptions
+	}{
+		{[]string{"recovery", "codes"}, "recovery codes", storage.SearchOptions{}},
+		{[]string{"--in=Notes,tags,notes", "recovery"}, "recovery", storage.SearchOptions{Fields: []string{"notes", "tags"}}},
+		{[]string{"hunter2", "--include-passwords"}, "hunter2", storage.SearchOptions{Fields: append(append([]string{}, storage.DefaultSearchFields...), "password")}},
+		{[]string{"--in", "name", "--include-passwords", "x"}, "x", storage.SearchOptions{Fields: []string{"name", "password"}}},
+		{[]string{"^b.b$", "--regex", "--case-sensitive", "--json"}, "^b.b$", storage.SearchOptions{Regex: true, CaseSensitive: true}},
+	}
+	for _, tt := range tests {
+		opts, err := parseSearchArgs(tt.args)
+		if err != nil {
+			t.Errorf("parseSearchArgs(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if opts.text != tt.wantText || !reflect.DeepEqual(opts.search, tt.wantOpts) {
+			t.Errorf("parseSearchArgs(%q) = %q, %+v; want %q, %+v", tt.args, opts.text, opts.search, tt.wantText, tt.wantOpts)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--in=password", "x"},
+		{"--in=icon", "x"},
+		{"--in=", "x"},
+		{"(", "--regex"},
+		{"x", "--bogus"},
+		{"--include-secrets", "x"},
+	} {
+		if _, err := parseSearchArgs(args); err == nil {
+			t.Errorf("Expected parseSearchArgs(%q) to fail", args)
+		}
+	}
+}
+
+func TestNeedsVault(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"list"}, true},
+		{[]string{"help"}, false},
+		{[]string{"--version"}, false},
+		{[]string{"init", "--full-encryption"}, false},
+		{[]string{"backup", "create", "out.pmbackup"}, true},
+		{[]string{"backup", "diff", "a.pmbackup", "b.pmbackup"}, false},
+		{[]string{"backup", "diff", "a.pmbackup", "--live"}, true},
+		{[]string{"backup", "info", "a.pmbackup"}, false},
+		{[]string{"export", "--decrypt", "vault.pmexport", "--out", "vault.csv"}, false},
+		{[]string{"export", "--format=csv", "--out", "vault.csv"}, true},
+		{[]string{"completion", "names"}, false},
+		{[]string{"report", "show", "import.json"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := needsVault(tt.args); got != tt.want {
+			t.Errorf("needsVault(%q) = %t, want %t", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestPrintBackupDiffHidesSecrets(t *testing.T) {
+	old := []*storage.PasswordEntry{{Name: "github", Username: "alice", Password: "old-secret"}}
+	new := []*storage.PasswordEntry{{Name: "github", Username: "bob", Password: "new-secret"}}
+
+	var out bytes.Buffer
+	printBackupDiff(&out, backup.Diff(old, new))
+
+	text := out.String()
+	if strings.Contains(text, "secret") {
+		t.Errorf("Diff output leaked a password:\n%s", text)
+	}
+	for _, want := range []string{"password: changed", `username: "alice" -> "bob"`, "1 modified"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in diff output:\n%s", want, text)
+		}
+	}
+}
+
+// countingSecret is a secret that counts how often it is wiped
+type countingSecret struct {
+	value []byte
+	wipes int
+}
+
+func (s *countingSecret) Reveal() []byte { return s.value }
+
+func (s *countingSecret) Wipe() {
+	for i := range s.value {
+		s.value[i] = 0
+	}
+	s.value = nil
+	s.wipes++
+}
+
+func TestDisplayPasswordEntryWipesPassword(t *testing.T) {
+	entry := &storage.PasswordEntry{Name: "github", Username: "alice"}
+	password := &countingSecret{value: []byte("hunter2")}
+
+	var out bytes.Buffer
+	displayPasswordEntry(&out, entry, password, secretsShown, false)
+
+	if !strings.Contains(out.String(), "Password: hunter2\n") {
+		t.Errorf("Expected the password in the output:\n%s", out.String())
+	}
+	if password.wipes != 1 {
+		t.Errorf("Expected the password to be wiped once, got %d", password.wipes)
+	}
+}
+
+func TestDisplayPasswordEntryRedacted(t *testing.T) {
+	entry := &storage.PasswordEntry{Name: "github"}
+	password := &countingSecret{}
+
+	var out bytes.Buffer
+	displayPasswordEntry(&out, entry, password, secretsRedacted, false)
+
+	if !strings.Contains(out.String(), "Password: [redacted]\n") {
+		t.Errorf("Expected a redacted password:\n%s", out.String())
+	}
+	if password.wipes != 1 {
+		t.Errorf("Expected the password to be wiped once, got %d", password.wipes)
+	}
+}
+
+func TestDisplayPasswordEntryMasked(t *testing.T) {
+	for _, tt := range []struct {
+		entry *storage.PasswordEntry
+		want  string
+	}{
+		{&storage.PasswordEntry{Name: "github", Notes: "recovery codes in the safe"}, "Password: ********\n"},
+		{&storage.PasswordEntry{Name: "wifi", Type: storage.EntryTypeNote, Notes: "key: 1234"}, "Note: ********\n"},
+	} {
+		password := &countingSecret{value: []byte("hunter2")}
+		if tt.entry.IsNote() {
+			password.value = nil
+		}
+		var out bytes.Buffer
+		displayPasswordEntry(&out, tt.entry, password, secretsMasked, false)
+
+		if !strings.Contains(out.String(), tt.want) || strings.Contains(out.String(), "hunter2") || strings.Contains(out.String(), "key: 1234") {
+			t.Errorf("Expected %q and nothing secret:\n%s", tt.want, out.String())
+		}
+		if !tt.entry.IsNote() && !strings.Contains(out.String(), "Notes: recovery codes in the safe\n") {
+			t.Errorf("Expected the notes of a login to be shown:\n%s", out.String())
+		}
+		if password.wipes != 1 {
+			t.Errorf("Expected the password to be wiped once, got %d", password.wipes)
+		}
+	}
+}
+
+// TestGetShow runs get with and without --show and reads what it printed
+func TestGetShow(t *testing.T) {
+	defer tmpfile.Cleanup()
+	defer func(saved func(int)) { exit = saved }(exit)
+	exit = func(code int) { panic(exitStatus(code)) }
+
+	dir := t.TempDir()
+	db, err := storage.CreateDatabase(filepath.Join(dir, "vault.db"), "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	defer db.Close()
+	if err := db.SavePassword(&storage.PasswordEntry{Name: "bank", Username: "alice", Password: "Bank-Secret-1"}); err != nil {
+		t.Fatalf("SavePassword failed: %v", err)
+	}
+	defer func(saved *storage.Database) { database = saved }(database)
+	database = db
+
+	get := func(args ...string) string {
+		t.Helper()
+		out, err := os.CreateTemp(dir, "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		defer func(saved *os.File) { os.Stdout = saved }(os.Stdout)
+		os.Stdout = out
+		if status := runShellCommand("pm", append([]string{"get"}, args...)); status != 0 {
+			t.Fatalf("Expected get %v to succeed, got status %d", args, status)
+		}
+		data, err := os.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if out := get("bank"); !strings.Contains(out, "Password: ********\n") || strings.Contains(out, "Bank-Secret-1") {
+		t.Errorf("Expected the password masked:\n%s", out)
+	}
+	// --clear does nothing when the output is not a terminal
+	for _, args := range [][]string{{"bank", "--show"}, {"bank", "--show", "--clear"}} {
+		if out := get(args...); !strings.Contains(out, "Password: Bank-Secret-1\n") {
+			t.Errorf("Expected get %v to print the password:\n%s", args, out)
+		}
+	}
+}
+
+func TestThrottleProgress(t *testing.T) {
+	clock := time.Unix(0, 0)
+	var rendered []int
+	progress := throttleProgress(time.Second, func() time.Time { return clock }, func(done, total int) {
+		rendered = append(rendered, done)
+	})
+	for done := 1; done <= 5; done++ {
+		progress(done, 5)
+		clock = clock.Add(400 * time.Millisecond)
+	}
+	// The first step, the first one a second later, and the last
+	if want := []int{1, 4, 5}; !reflect.DeepEqual(rendered, want) {
+		t.Errorf("Expected steps %v rendered, got %v", want, rendered)
+	}
+
+	rendered = nil
+	progress = throttleProgress(0, func() time.Time { return clock }, func(done, total int) {
+		rendered = append(rendered, done)
+	})
+	for done := 1; done <= 3; done++ {
+		progress(done, 3)
+	}
+	if len(rendered) != 3 {
+		t.Errorf("Expected every step rendered without an interval, got %v", rendered)
+	}
+}
+
+func TestResolveDBPath(t *testing.T) {
+	home := t.TempDir()
+	fallback := filepath.Join(home, ".password-manager", "passwords.db")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		flag, env, want string
+	}{
+		{"", "", fallback},
+		{"", "/env/vault.db", "/env/vault.db"},
+		{"/flag/vault.db", "/env/vault.db", "/flag/vault.db"},
+		{"/flag/vault.db", "", "/flag/vault.db"},
+		{"~/work.db", "", filepath.Join(home, "work.db")},
+		{"", "rel/vault.db", filepath.Join(wd, "rel", "vault.db")},
+	}
+	for _, c := range cases {
+		got, err := resolveDBPath(c.flag, c.env, fallback, home)
+		if err != nil || got != c.want {
+			t.Errorf("resolveDBPath(%q, %q) = %q, %v; expected %q", c.flag, c.env, got, err, c.want)
+		}
+	}
+}
+
+func TestCheckDBPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkDBPath(filepath.Join(dir, "new", "deeper", "vault.db")); err != nil {
+		t.Errorf("Expected a path under missing directories to be usable, got %v", err)
+	}
+
+	err := checkDBPath(dir)
+	if err == nil || !strings.Contains(err.Error(), "is a directory") ||
+		!strings.Contains(err.Error(), filepath.Join(dir, "passwords.db")) {
+		t.Errorf("Expected a directory to be refused with a suggested file, got %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = checkDBPath(filepath.Join(file, "vault.db"))
+	if err == nil || !strings.Contains(err.Error(), file+" is not a directory") {
+		t.Errorf("Expected a file in the way to be reported, got %v", err)
+	}
+}
+
+func TestFitSiteRules(t *testing.T) {
+	rules, err := policy.ParseSiteRules("min=8,max=12,forbid=<>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := generator.DefaultConfig()
+	config.Exclude = "l1"
+	fitSiteRules(config, rules, false)
+	if config.Length != 12 || config.Exclude != "l1<>" {
+		t.Errorf("Expected length 12 excluding l1<>, got %d excluding %q", config.Length, config.Exclude)
+	}
+
+	config = generator.DefaultConfig()
+	config.Length = 30
+	fitSiteRules(config, rules, true)
+	if config.Length != 30 {
+		t.Errorf("Expected --length to be kept, got %d", config.Length)
+	}
+
+	if _, err := parseAnalyzeArgs([]string{"--verify", "min=0", "hunter2"}); err == nil {
+		t.Error("Expected invalid rules to be refused")
+	}
+}
+
+// TestFailingCommandRemovesWorkingCopy runs the program, in a process of
+// its own, against a fully encrypted vault with a command that fails,
+// and checks that no decrypted working copy is left behind
+func TestFailingCommandRemovesWorkingCopy(t *testing.T) {
+	if args := os.Getenv("PM_TEST_MAIN_ARGS"); args != "" {
+		os.Args = append([]string{"pm"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+
+	// Other tests leave os.Args changed
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable failed: %v", err)
+	}
+	home, tmp := t.TempDir(), t.TempDir()
+	run := func(input, args string) int {
+		t.Helper()
+		cmd := exec.Command(binary, "-test.run=^TestFailingCommandRemovesWorkingCopy$")
+		cmd.Env = append(os.Environ(), "PM_TEST_MAIN_ARGS="+args, "HOME="+home, "PM_DB="+filepath.Join(home, "vault.db"),
+			tmpfile.EnvDir+"="+tmp, "XDG_STATE_HOME="+home)
+		cmd.Stdin = strings.NewReader(input)
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatalf("Running %s failed: %v", args, err)
+		}
+		return 0
+	}
+	if status := run("master123!A\nmaster123!A\n", "init --full-encryption"); status != 0 {
+		t.Fatalf("Expected init to succeed, got status %d", status)
+	}
+	if status := run("master123!A\n", "save gmail --password Gmail-Secret-1"); status != 0 {
+		t.Fatalf("Expected save to succeed, got status %d", status)
+	}
+
+	// What a run that was killed left behind is removed by the next one
+	stale := filepath.Join(tmp, "pm-run-999999999-1")
+	os.Mkdir(stale, 0700)
+	os.WriteFile(filepath.Join(stale, "pm-vault-1.db"), []byte("gmail"), 0600)
+
+	if status := run("master123!A\n", "get nonexistent --exact"); status != 1 {
+		t.Fatalf("Expected get of a missing entry to fail with status 1, got %d", status)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Expected the temporary directory to be empty, found %v", entries)
+	}
+
+	// The vault is sealed again, with nothing lost
+	if status := run("master123!A\n", "get gmail"); status != 0 {
+		t.Errorf("Expected get gmail to succeed on the vault as sealed, got status %d", status)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/hooks"
+	"password-manager/internal/secretscan"
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+)
+
+// warnMisplacedSecrets warns about what looks like a secret in the
+// username, URL or notes of entry, which are shown wherever the entry is
+// listed. Only the field and the kind of secret are printed.
+func warnMisplacedSecrets(entry *storage.PasswordEntry) {
+	for _, f := range secretscan.Entry(entry) {
+		fmt.Fprintf(os.Stderr, "Warning: what looks like a %s is in the %s of '%s'; '%s audit --misplaced-secrets --fix' moves it to the password\n",
+			f.Kind, f.Field, entry.Name, os.Args[0])
+	}
+}
+
+// misplacedSecret is a finding of audit --misplaced-secrets, without the
+// secret
+type misplacedSecret struct {
+	Name  string `json:"name"`
+	Field string `json:"field"`
+	Kind  string `json:"kind"`
+}
+
+// handleMisplacedSecrets scans every entry for secrets outside the
+// password and lists them, or with --fix offers to move each to the
+// password. It exits with status 1 when it lists any.
+func handleMisplacedSecrets(fix, asJSON bool) {
+	if fix && database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+
+	entries, err := database.ListPasswords()
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	if fix {
+		if err := fixMisplacedSecrets(entries); err != nil {
+			printError(err)
+			exit(1)
+		}
+		return
+	}
+
+	found := []misplacedSecret{}
+	for _, entry := range entries {
+		for _, f := range secretscan.Entry(entry) {
+			found = append(found, misplacedSecret{Name: entry.Name, Field: f.Field, Kind: f.Kind})
+		}
+	}
+	if asJSON {
+		if err := writeJSON(os.Stdout, found); err != nil {
+			printError(err)
+			exit(1)
+		}
+	} else {
+		writeMisplacedSecrets(os.Stdout, found, len(entries))
+	}
+	if len(found) > 0 {
+		exit(1)
+	}
+}
+
+// writeMisplacedSecrets prints the findings of audit --misplaced-secrets
+func writeMisplacedSecrets(w io.Writer, found []misplacedSecret, checked int) {
+	if len(found) == 0 {
+		fmt.Fprintf(w, "No misplaced secrets in %d entries.\n", checked)
+		return
+	}
+	fmt.Fprintf(w, "Misplaced secrets (%d):\n", len(found))
+	for _, f := range found {
+		fmt.Fprintf(w, "  '%s' %s: %s\n", f.Name, f.Field, f.Kind)
+	}
+	fmt.Fprintf(w, "Run '%s audit --misplaced-secrets --fix' to move them to the password.\n", os.Args[0])
+}
+
+// fixMisplacedSecrets asks about each misplaced secret, with single
+// keypresses at a terminal, and moves those it is told to into the
+// password of their entry. The password they replace goes to the history
+// of the entry like any other change of password.
+func fixMisplacedSecrets(entries []*storage.PasswordEntry) error {
+	resolver, restore := newTerminalResolver()
+	moved, skipped, locked, err := promptMisplacedSecrets(resolver, entries)
+	restore()
+	if errors.Is(err, tui.ErrAborted) {
+		fmt.Printf("Stopped after moving %d; the rest were left where they are.\n", moved)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d moved to the password, %d left where they were.\n", moved, skipped)
+	for _, name := range locked {
+		fmt.Fprintf(os.Stderr, "Warning: '%s' is encrypted to recipients you hold no identity for, so its secrets were not moved\n", name)
+	}
+	return nil
+}
+
+// promptMisplacedSecrets does the asking and moving of
+// fixMisplacedSecrets, saving each entry as soon as a secret is moved.
+// It returns how many secrets were moved and left, and the entries it
+// could not change because their password cannot be read.
+func promptMisplacedSecrets(r *tui.Resolver, entries []*storage.PasswordEntry) (moved, skipped int, locked []string, err error) {
+	limit, _ := settings.HistoryLimit()
+	for _, entry := range entries {
+		findings := secretscan.Entry(entry)
+		if len(findings) == 0 {
+			continue
+		}
+		if entry.Locked {
+			locked = append(locked, entry.Name)
+			skipped += len(findings)
+			continue
+		}
+
+		// From the last so that moving one leaves the others in place
+		for i := len(findings) - 1; i >= 0; i-- {
+			f := findings[i]
+			move := tui.Option{Key: 'm', Label: "move it to the password"}
+			switch {
+			case crypto.SecretsEqual(f.Secret(entry), entry.Password):
+				move = tui.Option{Key: 'r', Label: "remove it, it is the password already"}
+			case entry.Password != "" && limit > 0:
+				move.Label += ", keeping the current one in the history"
+			case entry.Password != "":
+				move.Label += ", replacing the current one"
+			}
+			key, err := r.Choose(fmt.Sprintf("'%s' %s: %s", entry.Name, f.Field, f.Kind), []tui.Option{move, {Key: 's', Label: "skip"}})
+			if err != nil {
+				return moved, skipped, locked, err
+			}
+			if key == 's' {
+				skipped++
+				continue
+			}
+
+			rotated := key == 'm'
+			secretscan.Move(entry, f)
+			if err := database.UpdatePassword(entry); err != nil {
+				return moved, skipped, locked, fmt.Errorf("failed to update '%s': %w", entry.Name, err)
+			}
+			moved++
+			if rotated {
+				queueHook(hooks.Rotate, entry.Name)
+			} else {
+				queueHook(hooks.Save, entry.Name)
+			}
+		}
+	}
+	return moved, skipped, locked, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"password-manager/internal/hooks"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+// handleNote dispatches the note subcommands
+func handleNote() {
+	switch {
+	case len(os.Args) > 2 && os.Args[2] == "add":
+		handleNoteAdd()
+	case len(os.Args) > 2 && os.Args[2] == "show":
+		handleNoteShow()
+	default:
+		failFlags(nil, subcommandError("note", os.Args[2:]), os.Args[0]+" note <add|show> ...")
+	}
+}
+
+// noteAddFlags returns the flag set of note add, filling tags
+func noteAddFlags(tags *string) *flag.FlagSet {
+	fs := newFlagSet("note add")
+	fs.StringVar(tags, "tags", "", "comma-separated `tags` of the note")
+	return fs
+}
+
+// parseNoteAddArgs reads the arguments of note add. All positional
+// arguments form the name.
+func parseNoteAddArgs(args []string) (name, tags string, err error) {
+	words, err := parseFlags(noteAddFlags(&tags), args)
+	if err != nil {
+		return "", "", err
+	}
+	if name = strings.Join(words, " "); name == "" {
+		return "", "", fmt.Errorf("a name is needed")
+	}
+	return name, tags, nil
+}
+
+// handleNoteAdd creates a secure note. The body is written in $EDITOR, or
+// read from stdin when it is not a terminal.
+func handleNoteAdd() {
+	name, tags, err := parseNoteAddArgs(os.Args[3:])
+	if err != nil {
+		failFlags(noteAddFlags(new(string)), err, os.Args[0]+" note add [--tags <tag1,tag2>] [--] <name>")
+	}
+
+	var body string
+	if stdinIsTerminal() {
+		body, err = editNote("")
+	} else {
+		var data []byte
+		data, err = io.ReadAll(stdin)
+		body = string(data)
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	entry := &storage.PasswordEntry{
+		Name:  name,
+		Type:  storage.EntryTypeNote,
+		Notes: strings.TrimRight(body, "\r\n"),
+		Tags:  parseTags(tags),
+	}
+	if err := validateEntry(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	before := entry.Tags
+	if err := database.SavePassword(entry); err != nil {
+		printError(fmt.Errorf("failed to save note: %w", err))
+		exit(1)
+	}
+
+	fmt.Printf("Note '%s' saved successfully!\n", entry.Name)
+	reportAutoTags(before, entry)
+	queueHook(hooks.Save, entry.Name)
+}
+
+// noteShowFlags returns the flag set of note show, filling noTouch
+func noteShowFlags(noTouch *bool) *flag.FlagSet {
+	fs := newFlagSet("note show")
+	fs.BoolVar(noTouch, "no-touch", false, "do not record this read as the last access")
+	return fs
+}
+
+// parseNoteShowArgs reads the arguments of note show. All positional
+// arguments form the name.
+func parseNoteShowArgs(args []string) (name string, noTouch bool, err error) {
+	words, err := parseFlags(noteShowFlags(&noTouch), args)
+	if err != nil {
+		return "", false, err
+	}
+	if name = strings.Join(words, " "); name == "" {
+		return "", false, fmt.Errorf("a name is needed")
+	}
+	return name, noTouch, nil
+}
+
+// handleNoteShow prints the body of a secure note
+func handleNoteShow() {
+	name, noTouch, err := parseNoteShowArgs(os.Args[3:])
+	if err != nil {
+		failFlags(noteShowFlags(new(bool)), err, os.Args[0]+" note show [--no-touch] [--] <name>")
+	}
+
+	if database.IsViewer() {
+		fmt.Fprintf(os.Stderr, "Error: notes are redacted in viewer sessions\n")
+		exit(1)
+	}
+
+	entry, err := database.GetPassword(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if !entry.IsNote() {
+		fmt.Fprintf(os.Stderr, "Error: '%s' is not a note; use '%s get'\n", entry.Name, os.Args[0])
+		exit(1)
+	}
+	if !noTouch {
+		markAccessed(entry.Name)
+	}
+
+	fmt.Println(entry.Notes)
+}
+
+// editNote opens initial in the user's editor and returns the saved text.
+// The temporary file is readable by the owner only and wiped afterwards.
+func editNote(initial string) (string, error) {
+	file, err := tmpfile.Create("pm-note-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+	defer tmpfile.Remove(path)
+
+	_, err = file.WriteString(initial)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	editor := strings.Fields(noteEditor())
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	return string(data), nil
+}
+
+// noteEditor returns the editor command from $VISUAL or $EDITOR, falling
+// back to the platform default
+func noteEditor() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(name)); editor != "" {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// entryTypeName returns the type of an entry for display
+func entryTypeName(entry *storage.PasswordEntry) string {
+	if entry.Type == "" {
+		return storage.EntryTypeLogin
+	}
+	return entry.Type
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"password-manager/internal/generator"
+)
+
+// passphraseUsage returns the usage line of generate --passphrase
+func passphraseUsage() string {
+	return fmt.Sprintf("%s generate --passphrase [--words <%d-%d>] [--separator <text>] [--capitalize none|first|random] [--digit]",
+		os.Args[0], generator.MinPassphraseWords, generator.MaxPassphraseWords)
+}
+
+// handleGeneratePassphrase handles generate --passphrase
+func handleGeneratePassphrase(args []string) {
+	config, err := parsePassphraseArgs(args)
+	if err != nil {
+		failFlags(passphraseFlags(generator.DefaultPassphraseConfig()), err, passphraseUsage())
+	}
+
+	// The configuration comes from the flags, so its errors are theirs
+	passphrase, err := generator.GeneratePassphrase(config)
+	if err != nil {
+		printError(fmt.Errorf("failed to generate passphrase: %w", err))
+		exit(1)
+	}
+	fmt.Printf("Generated passphrase: %s\n", passphrase)
+
+	analysis := generator.Analyze(passphrase)
+	fmt.Printf("Strength: %s (Score: %d/%d)\n", analysis.Level, analysis.Score, generator.MaxScore)
+	fmt.Printf("Entropy: %.1f bits (%d words)\n", analysis.EntropyBits, config.Words)
+}
+
+// passphraseFlags returns the flag set of generate --passphrase, filling
+// config
+func passphraseFlags(config *generator.PassphraseConfig) *flag.FlagSet {
+	fs := newFlagSet("generate --passphrase")
+	fs.Bool("passphrase", false, "generate a passphrase of words")
+	fs.IntVar(&config.Words, "words", config.Words, "`n` words in the passphrase")
+	fs.StringVar(&config.Separator, "separator", config.Separator, "`text` between the words")
+	fs.StringVar(&config.Capitalize, "capitalize", config.Capitalize, "`which` words to capitalize: none, first or random")
+	fs.BoolVar(&config.Digit, "digit", config.Digit, "add a digit")
+	return fs
+}
+
+// parsePassphraseArgs reads the passphrase flags of generate into a
+// configuration
+func parsePassphraseArgs(args []string) (*generator.PassphraseConfig, error) {
+	config := generator.DefaultPassphraseConfig()
+	rest, err := parseFlags(passphraseFlags(config), args)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("unexpected argument %s", rest[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
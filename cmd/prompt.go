@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"password-manager/internal/crypto"
+)
+
+// Prompter asks the user for input. The terminal implementation reads
+// from stdin; tests drive interactive flows with a scripted one.
+type Prompter interface {
+	// Ask shows label and returns the line typed, without the newline
+	Ask(label string) (string, error)
+	// AskSecret is like Ask but does not echo the input
+	AskSecret(label string) (string, error)
+}
+
+// stdin is shared by everything reading lines from standard input, so
+// that data buffered by one reader is not lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// errNoTerminal is returned when a password is to be typed but standard
+// input is not a terminal, nor has a line left to read it from
+var errNoTerminal = errors.New("standard input is not a terminal")
+
+// readLine reads one line from standard input without the newline
+func readLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readSecret shows label and reads a secret without echo on a terminal.
+// Scripts piping stdin send it as the next line instead.
+func readSecret(label string) (string, error) {
+	secret, err := readSecretBytes(label)
+	return string(secret), err
+}
+
+// readSecretBytes is readSecret returning the secret as bytes the caller
+// can overwrite once done
+func readSecretBytes(label string) ([]byte, error) {
+	if !stdinIsTerminal() {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil, fmt.Errorf("failed to read password: %w: %w", errNoTerminal, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		return []byte(line), nil
+	}
+	// On stderr, so output piped elsewhere, such as JSON, stays clean
+	fmt.Fprint(os.Stderr, label)
+	secret, err := readTerminalSecret(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password: %w", err)
+	}
+	return secret, nil
+}
+
+// readTerminalSecret reads a line from the terminal at fd without echo. It
+// reads a byte at a time in raw mode rather than leaving line editing to
+// the terminal, which on some systems, macOS among them, silently cuts a
+// line off at 1024 bytes. Backspace, Ctrl-U and Ctrl-C work as they would
+// in a normal line; a secret over crypto.MaxPasswordLength is refused.
+func readTerminalSecret(fd int) ([]byte, error) {
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return term.ReadPassword(fd)
+	}
+	defer term.Restore(fd, state)
+
+	// The secret is never grown, so no stray copies of it are left behind
+	secret := make([]byte, 0, crypto.MaxPasswordLength)
+	wipe := func() { crypto.NewSecretString(secret[:cap(secret)]).Wipe() }
+	tooLong := false
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			wipe()
+			return nil, err
+		}
+		switch c := buf[0]; c {
+		case '\r', '\n':
+			if tooLong {
+				wipe()
+				return nil, fmt.Errorf("the password is longer than %d bytes", crypto.MaxPasswordLength)
+			}
+			return secret, nil
+		case 0x03: // Ctrl-C
+			wipe()
+			return nil, fmt.Errorf("interrupted")
+		case 0x04: // Ctrl-D
+			if len(secret) == 0 && !tooLong {
+				return nil, io.EOF
+			}
+		case 0x7f, '\b':
+			// A character may take several bytes
+			_, size := utf8.DecodeLastRune(secret)
+			secret = secret[:len(secret)-size]
+		case 0x15: // Ctrl-U
+			secret, tooLong = secret[:0], false
+		default:
+			if len(secret) == cap(secret) {
+				tooLong = true
+				continue
+			}
+			secret = append(secret, c)
+		}
+	}
+}
+
+// terminalPrompter prompts on stdout and reads from stdin
+type terminalPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// newTerminalPrompter returns a Prompter for the controlling terminal
+func newTerminalPrompter() *terminalPrompter {
+	return &terminalPrompter{
+		in:  stdin,
+		out: os.Stdout,
+	}
+}
+
+func (p *terminalPrompter) Ask(label string) (string, error) {
+	fmt.Fprint(p.out, label)
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// AskSecret reads without echo on a terminal; like readSecret, piped input
+// is read as the next line instead
+func (p *terminalPrompter) AskSecret(label string) (string, error) {
+	if !stdinIsTerminal() {
+		return readLine()
+	}
+	fmt.Fprint(p.out, label)
+	secret, err := readTerminalSecret(int(os.Stdin.Fd()))
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// stdinIsTerminal reports whether stdin is an interactive terminal
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/hooks"
+	"password-manager/internal/recipient"
+	"password-manager/internal/storage"
+)
+
+// patchField is one field of an entry patch: untouched unless Set, and
+// cleared when Null
+type patchField[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// entryPatch is a partial entry read from JSON. Only the fields present
+// in the document are applied; null clears a field. The name selects the
+// entry and is required.
+type entryPatch struct {
+	Name       string
+	Type       patchField[string]
+	Username   patchField[string]
+	Password   patchField[string]
+	URL        patchField[string]
+	Notes      patchField[string]
+	Icon       patchField[string]
+	Tags       patchField[[]string]
+	Recipients patchField[[]string]
+	ExpiresAt  patchField[string]
+}
+
+// readOnlyFields are entry fields a patch cannot set
+var readOnlyFields = map[string]bool{
+	"id":               true,
+	"created_at":       true,
+	"updated_at":       true,
+	"last_accessed_at": true,
+}
+
+// UnmarshalJSON parses a patch, rejecting unknown and read-only fields and
+// values of the wrong type. Errors name the JSON path of the offending
+// value, such as $.tags[1].
+func (p *entryPatch) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("$: expected an object")
+		}
+		return err
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := fields[key]
+		path := "$." + key
+		var err error
+		switch key {
+		case "name":
+			err = json.Unmarshal(raw, &p.Name)
+			if err != nil || isNull(raw) {
+				err = fmt.Errorf("%s: expected a string", path)
+			}
+		case "type":
+			err = decodeString(path, raw, &p.Type)
+		case "username":
+			err = decodeString(path, raw, &p.Username)
+		case "password":
+			err = decodeString(path, raw, &p.Password)
+		case "url":
+			err = decodeString(path, raw, &p.URL)
+		case "notes":
+			err = decodeString(path, raw, &p.Notes)
+		case "icon":
+			err = decodeString(path, raw, &p.Icon)
+		case "tags":
+			err = decodeStrings(path, raw, &p.Tags)
+		case "recipients":
+			err = decodeStrings(path, raw, &p.Recipients)
+		case "expires_at":
+			err = decodeString(path, raw, &p.ExpiresAt)
+		default:
+			if readOnlyFields[key] {
+				err = fmt.Errorf("%s: field is read-only", path)
+			} else {
+				err = fmt.Errorf("%s: unknown field", path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Name == "" {
+		return fmt.Errorf("$.name: required")
+	}
+	return nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+func decodeString(path string, raw json.RawMessage, field *patchField[string]) error {
+	field.Set = true
+	if isNull(raw) {
+		field.Null = true
+		return nil
+	}
+	if err := json.Unmarshal(raw, &field.Value); err != nil {
+		return fmt.Errorf("%s: expected a string", path)
+	}
+	return nil
+}
+
+func decodeStrings(path string, raw json.RawMessage, field *patchField[[]string]) error {
+	field.Set = true
+	if isNull(raw) {
+		field.Null = true
+		return nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return fmt.Errorf("%s: expected an array of strings", path)
+	}
+	field.Value = make([]string, len(items))
+	for i, item := range items {
+		if isNull(item) || json.Unmarshal(item, &field.Value[i]) != nil {
+			return fmt.Errorf("%s[%d]: expected a string", path, i)
+		}
+	}
+	return nil
+}
+
+// apply merges the patch into entry
+func (p *entryPatch) apply(entry *storage.PasswordEntry) error {
+	entry.Name = p.Name
+	setString(&entry.Type, p.Type)
+	setString(&entry.Username, p.Username)
+	setString(&entry.Password, p.Password)
+	setString(&entry.URL, p.URL)
+	setString(&entry.Notes, p.Notes)
+	setString(&entry.Icon, p.Icon)
+	if p.Tags.Set {
+		entry.Tags = nil
+		for _, tag := range p.Tags.Value {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+	}
+	if p.Recipients.Set {
+		entry.Recipients = nil
+		if len(p.Recipients.Value) > 0 {
+			recipients, err := recipient.NormalizeKeys(p.Recipients.Value)
+			if err != nil {
+				return fmt.Errorf("$.recipients: %w", err)
+			}
+			entry.Recipients = recipients
+		}
+	}
+	if p.ExpiresAt.Set {
+		entry.ExpiresAt = nil
+		if !p.ExpiresAt.Null {
+			// The RFC 3339 time get --json writes, or what --expires takes
+			expiresAt, err := parseExpires(p.ExpiresAt.Value, time.Now())
+			if err != nil {
+				return fmt.Errorf("$.expires_at: expected a time, a span such as 90d, or never")
+			}
+			entry.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func setString(value *string, field patchField[string]) {
+	if field.Set {
+		*value = field.Value
+	}
+}
+
+// readPatch reads one patch document, refusing trailing content
+func readPatch(r io.Reader) (*entryPatch, error) {
+	decoder := json.NewDecoder(r)
+	var patch entryPatch
+	if err := decoder.Decode(&patch); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty document")
+		}
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("$: unexpected content after the object")
+	}
+	return &patch, nil
+}
+
+// putResult is what put prints: the entry's metadata, never its secrets
+type putResult struct {
+	Created   bool       `json:"created"`
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Username  string     `json:"username,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	Icon      string     `json:"icon,omitempty"`
+	Tags      []string   `json:"tags"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// rotated is set when the password of an existing entry changed
+	rotated bool
+}
+
+// putFlags returns the flag set of put, filling source and file
+func putFlags(source, file *string) *flag.FlagSet {
+	fs := newFlagSet("put")
+	fs.StringVar(source, "json", "", "read the entry document from stdin; the `source` must be -")
+	fs.StringVar(file, "json-file", "", "read the entry document from `file`")
+	return fs
+}
+
+// parsePutArgs reads the arguments of put: the file holding the entry
+// document, empty for stdin
+func parsePutArgs(args []string) (file string, err error) {
+	var source string
+	fs := putFlags(&source, &file)
+	rest, err := parseFlags(fs, args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return "", err
+	}
+	given := flagsGiven(fs)
+	switch {
+	case given["json"] == given["json-file"]:
+		return "", fmt.Errorf("one of --json - and --json-file is needed")
+	case given["json"] && source != "-":
+		return "", fmt.Errorf("--json reads only stdin; give it -")
+	case given["json-file"] && file == "":
+		return "", fmt.Errorf("--json-file needs a file")
+	}
+	return file, nil
+}
+
+// handlePut creates or updates one entry from a JSON document on stdin
+// (--json -) or in a file (--json-file <path>)
+func handlePut() {
+	file, err := parsePutArgs(os.Args[2:])
+	if err != nil {
+		failFlags(putFlags(new(string), new(string)), err, os.Args[0]+" put --json - | --json-file <file>")
+	}
+
+	var input io.Reader = stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	patch, err := readPatch(input)
+	if err != nil {
+		printError(fmt.Errorf("invalid entry document: %w", err))
+		exit(1)
+	}
+
+	result, err := putEntry(patch)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	data, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(data))
+	if result.rotated {
+		queueHook(hooks.Rotate, result.Name)
+	} else {
+		queueHook(hooks.Save, result.Name)
+	}
+}
+
+// putEntry merges a patch into the entry of the same name, or creates it
+func putEntry(patch *entryPatch) (*putResult, error) {
+	if database.IsViewer() {
+		return nil, storage.ErrReadOnly
+	}
+
+	entries, err := database.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	entry := &storage.PasswordEntry{}
+	created := true
+	var oldPassword string
+	for _, existing := range entries {
+		if existing.Name == patch.Name {
+			if entry, err = database.GetPassword(patch.Name); err != nil {
+				return nil, err
+			}
+			created = false
+			oldPassword = entry.Password
+			break
+		}
+	}
+
+	if err := patch.apply(entry); err != nil {
+		return nil, err
+	}
+	if err := validateEntry(entry); err != nil {
+		return nil, err
+	}
+	if created || !crypto.SecretsEqual(oldPassword, entry.Password) {
+		warnReuse(entry.Password, entry.ID)
+	}
+	if created {
+		err = database.SavePassword(entry)
+	} else {
+		err = database.UpdatePassword(entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	warnMisplacedSecrets(entry)
+
+	saved, err := database.GetPassword(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	tags := saved.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return &putResult{
+		Created:   created,
+		ID:        saved.ID,
+		Name:      saved.Name,
+		Type:      entryTypeName(saved),
+		Username:  saved.Username,
+		URL:       saved.URL,
+		Icon:      saved.Icon,
+		Tags:      tags,
+		UpdatedAt: saved.UpdatedAt,
+		ExpiresAt: saved.ExpiresAt,
+		rotated:   !created && !crypto.SecretsEqual(oldPassword, saved.Password),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+func TestReadPatch(t *testing.T) {
+	patch, err := readPatch(strings.NewReader(`{"name": "bank", "username": null, "password": "s3cret", "tags": ["a", " b "]}`))
+	if err != nil {
+		t.Fatalf("readPatch failed: %v", err)
+	}
+	if patch.Name != "bank" || !patch.Username.Set || !patch.Username.Null || patch.URL.Set {
+		t.Errorf("Expected username cleared and url untouched, got %+v", patch)
+	}
+
+	entry := &storage.PasswordEntry{Name: "bank", Username: "john", Password: "old", URL: "https://bank.example", Notes: "kept", Tags: []string{"x"}}
+	if err := patch.apply(entry); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	want := &storage.PasswordEntry{Name: "bank", Password: "s3cret", URL: "https://bank.example", Notes: "kept", Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("apply = %+v, want %+v", entry, want)
+	}
+
+	patch, _ = readPatch(strings.NewReader(`{"name": "bank", "tags": null}`))
+	patch.apply(entry)
+	if entry.Tags != nil || entry.Password != "s3cret" {
+		t.Errorf("Expected only the tags to be cleared, got %+v", entry)
+	}
+}
+
+func TestReadPatchErrors(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{`{"name": "bank", "pasword": "x"}`, "$.pasword: unknown field"},
+		{`{"name": "bank", "created_at": "2024-01-01"}`, "$.created_at: field is read-only"},
+		{`{"name": "bank", "tags": ["a", 2]}`, "$.tags[1]: expected a string"},
+		{`{"name": "bank", "tags": "a,b"}`, "$.tags: expected an array of strings"},
+		{`{"name": "bank", "url": 5}`, "$.url: expected a string"},
+		{`{"name": null}`, "$.name: expected a string"},
+		{`{"username": "john"}`, "$.name: required"},
+		{`["bank"]`, "$: expected an object"},
+		{`{"name": "bank"} {"name": "mail"}`, "$: unexpected content after the object"},
+		{``, "empty document"},
+	}
+
+	for _, tt := range tests {
+		_, err := readPatch(strings.NewReader(tt.doc))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("readPatch(%s) error = %v, want %q", tt.doc, err, tt.want)
+		}
+	}
+}
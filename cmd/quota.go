@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// quotaWarnings describes each soft quota of the config the vault is
+// over, given its stats
+func quotaWarnings(stats map[string]interface{}) []string {
+	var warnings []string
+	quota := settings.Quota
+	if count, _ := stats["total_passwords"].(int); quota.Entries > 0 && count > quota.Entries {
+		warnings = append(warnings, fmt.Sprintf("the vault holds %d entries, over its quota of %d", count, quota.Entries))
+	}
+	limit, _ := quota.SizeBytes()
+	if size, _ := stats["database_size"].(int64); limit > 0 && size > limit {
+		warnings = append(warnings, fmt.Sprintf("the vault file is %d bytes, over its quota of %s", size, quota.Size))
+	}
+	return warnings
+}
+
+// warnQuota prints the quota warnings of the open vault to stderr when a
+// person is at the terminal. stats prints them itself.
+func warnQuota(args []string) {
+	if args[0] == "stats" || !atTerminal(args) {
+		return
+	}
+	stats, err := database.GetStats()
+	if err != nil {
+		return
+	}
+	for _, warning := range quotaWarnings(stats) {
+		fmt.Fprintf(os.Stderr, "Warning: %s; '%s split' can move entries to another vault\n", warning, os.Args[0])
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/refresh"
+)
+
+var (
+	// refresher refreshes the cached strength grades of the vault the
+	// interactive shell has open. Once the vault is locked it is kept,
+	// stopped, for status.
+	refresher *refresh.Refresher
+	// stopRefresher ends the run of refresher and waits for it; nil when
+	// it is not running
+	stopRefresher func()
+)
+
+// startRefresh starts refreshing the cached strength grades of the open
+// vault in the background, unless strength_refresh is off
+func startRefresh() {
+	config := refresh.DefaultConfig()
+	// A viewer cannot write the grades
+	config.Enabled = settings.RefreshStrength() && !database.IsViewer()
+	r := refresh.New(database, config)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	refresher = r
+	stopRefresher = func() {
+		r.Lock()
+		cancel()
+		<-done
+	}
+}
+
+// stopRefresh stops the refresh before the vault it reads is closed,
+// letting a batch under way end after the entry it is on
+func stopRefresh() {
+	if stopRefresher != nil {
+		stopRefresher()
+		stopRefresher = nil
+	}
+}
+
+// showShellStatus prints whether the vault of the shell is open and what
+// the strength refresh has done
+func showShellStatus(idle time.Duration) {
+	switch {
+	case database == nil:
+		fmt.Println("Vault: locked; the next command asks for the master password")
+	case idle > 0:
+		fmt.Printf("Vault: unlocked; locks after %s without a command, or when the system sleeps\n", idle)
+	default:
+		fmt.Println("Vault: unlocked; locks when the system sleeps")
+	}
+	fmt.Printf("Strength refresh: %s\n", refreshStatus(refresher, database == nil, time.Now()))
+}
+
+// refreshStatus describes what r has done, r being nil before the vault
+// is first unlocked
+func refreshStatus(r *refresh.Refresher, locked bool, now time.Time) string {
+	if !settings.RefreshStrength() {
+		return "off (strength_refresh = false in config.toml)"
+	}
+	if r == nil {
+		return "starts once the vault is unlocked"
+	}
+	state := fmt.Sprintf("on, every %d minutes while the shell waits", int(refresh.DefaultConfig().Interval/time.Minute))
+	if locked {
+		state = "stopped while the vault is locked"
+	}
+	status := r.Status()
+	if !status.Enabled {
+		return "off, as a viewer cannot write the grades"
+	}
+	switch {
+	case status.LastRun.IsZero():
+		return state + "; not run yet"
+	case status.LastError != nil:
+		return fmt.Sprintf("%s; %d grades refreshed, the last run %s failed: %v",
+			state, status.Refreshed, duration.Humanize(status.LastRun, now), status.LastError)
+	}
+	return fmt.Sprintf("%s; %d grades refreshed, %d by the last run %s",
+		state, status.Refreshed, status.LastBatch, duration.Humanize(status.LastRun, now))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"password-manager/internal/reminder"
+
+	"golang.org/x/term"
+)
+
+// parseRemindersArgs reads the action of reminders, status when none is
+// given
+func parseRemindersArgs(args []string) (string, error) {
+	rest, err := parseFlags(newFlagSet("reminders"), args)
+	switch {
+	case err != nil:
+		return "", err
+	case len(rest) == 0:
+		return "status", nil
+	case len(rest) > 1:
+		return "", noArguments(rest[1:])
+	case rest[0] != "on" && rest[0] != "off" && rest[0] != "status":
+		return "", fmt.Errorf("unknown reminders command %s", rest[0])
+	}
+	return rest[0], nil
+}
+
+// handleReminders shows or changes whether startup reminders are shown
+func handleReminders() {
+	action, err := parseRemindersArgs(os.Args[2:])
+	if err != nil {
+		failFlags(nil, err, os.Args[0]+" reminders [on|off|status]")
+	}
+
+	switch action {
+	case "status":
+		enabled, err := database.RemindersEnabled()
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		if enabled {
+			fmt.Println("Reminders are on.")
+		} else {
+			fmt.Println("Reminders are off.")
+		}
+	case "on", "off":
+		if err := database.SetRemindersEnabled(action == "on"); err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Printf("Reminders turned %s.\n", action)
+	}
+}
+
+// remind prints the daily reminder for the open vault to stderr. It only
+// speaks to a person at a terminal: never when output is piped or JSON
+// was asked for, and at most once a day per vault.
+func remind(args []string, configDir string) {
+	if args[0] == "reminders" || !atTerminal(args) {
+		return
+	}
+	if enabled, err := database.RemindersEnabled(); err != nil || !enabled {
+		return
+	}
+
+	now := time.Now()
+	tracker := reminder.NewTracker(filepath.Join(configDir, "reminders"))
+	if !tracker.Due(dbPath, now) {
+		return
+	}
+
+	summary, err := reminderSummary()
+	if err != nil || summary.Empty() {
+		return
+	}
+	if summary.TodoRotate > 0 {
+		fmt.Fprintf(os.Stderr, "Reminder: %s — run '%s list --where \"tag=%s\"'\n",
+			reminder.Message(summary), os.Args[0], reminder.RotateTag)
+	} else {
+		fmt.Fprintf(os.Stderr, "Reminder: %s — run '%s expiring'\n", reminder.Message(summary), os.Args[0])
+	}
+	if err := tracker.MarkShown(dbPath, now); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// atTerminal reports whether a person is reading the output: both stdout
+// and stderr are terminals and no JSON was asked for
+func atTerminal(args []string) bool {
+	return !hasFlag(args, "--json") &&
+		term.IsTerminal(int(os.Stdout.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// reminderSummary counts the pending items from entry metadata
+func reminderSummary() (reminder.Summary, error) {
+	var summary reminder.Summary
+	entries, err := database.ListMetadata()
+	if err != nil {
+		return summary, err
+	}
+	for _, entry := range entries {
+		if hasFlag(entry.Tags, reminder.RotateTag) {
+			summary.TodoRotate++
+		}
+	}
+	return summary, expiringSummary(&summary, time.Now())
+}
+
+// deviceID identifies this device in the vault metadata by a hash of its
+// host name, so the name itself is not stored in plaintext
+func deviceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	sum := sha256.Sum256([]byte(host))
+	return hex.EncodeToString(sum[:8])
+}
+
+// showDigest prints to stderr what happened to the vault since this
+// device last had it open, right after unlock. Like reminders it only
+// speaks to a person at a terminal; unlock_digest = false silences it.
+func showDigest(args []string) {
+	if !settings.ShowUnlockDigest() || !atTerminal(args) {
+		return
+	}
+	digest, err := unlockDigest()
+	if err != nil {
+		return
+	}
+	fmt.Fprint(os.Stderr, reminder.DigestMessage(digest))
+}
+
+// unlockDigest counts the changes and backups since this device last had
+// the vault open
+func unlockDigest() (reminder.Digest, error) {
+	digest := reminder.Digest{Now: time.Now()}
+	var err error
+	if digest.LastSeen, err = database.LastSeen(deviceID()); err != nil || digest.LastSeen.IsZero() {
+		return digest, err
+	}
+	if digest.Changed, err = database.ChangedSince(digest.LastSeen); err != nil {
+		return digest, err
+	}
+	if digest.Backups, err = database.BackupsSince(digest.LastSeen); err != nil {
+		return digest, err
+	}
+	expiring, err := database.ListExpiring(digest.Now.Add(reminder.DigestExpiryWindow))
+	digest.Expiring = len(expiring)
+	return digest, err
+}
+
+// markSeen records that this device had the vault open until now, so the
+// next digest leaves out the changes made here. A backup loaded with
+// --from-backup is not the vault.
+func markSeen() {
+	if fromBackup != "" {
+		return
+	}
+	if err := database.MarkSeen(deviceID(), time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
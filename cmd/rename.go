@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"password-manager/internal/hooks"
+)
+
+// parseRenameArgs reads the old and the new name rename is given
+func parseRenameArgs(args []string) (oldName, newName string, err error) {
+	names, err := parseFlags(newFlagSet("rename"), args)
+	if err != nil {
+		return "", "", err
+	}
+	if len(names) != 2 {
+		return "", "", fmt.Errorf("an old and a new name are needed; quote names that contain spaces")
+	}
+	return names[0], names[1], nil
+}
+
+// handleRename gives an entry another name, keeping its history and
+// timestamps. A new name that differs from the old one only in case is
+// easily a typo, so it is confirmed first.
+func handleRename() {
+	oldName, newName, err := parseRenameArgs(os.Args[2:])
+	if err != nil {
+		failFlags(nil, err, os.Args[0]+" rename [--] <old name> <new name>")
+	}
+	if err := validateName(newName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if oldName == newName {
+		fmt.Fprintf(os.Stderr, "Error: '%s' already has that name\n", oldName)
+		exit(1)
+	}
+
+	if strings.EqualFold(oldName, newName) {
+		fmt.Printf("'%s' and '%s' differ only in case. Rename anyway? (y/N): ", oldName, newName)
+		response, err := stdin.ReadString('\n')
+		if err != nil {
+			printError(fmt.Errorf("failed to read input: %w", err))
+			exit(1)
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response != "y" && response != "yes" {
+			fmt.Println("Rename cancelled.")
+			return
+		}
+	}
+
+	if err := database.RenamePassword(oldName, newName); err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf("Renamed '%s' to '%s'.\n", oldName, newName)
+	queueHook(hooks.Delete, oldName)
+	queueHook(hooks.Save, newName)
+}
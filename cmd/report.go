@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"password-manager/internal/importreport"
+)
+
+// parseReportArgs reads the file report show is given
+func parseReportArgs(args []string) (string, error) {
+	if len(args) == 0 || args[0] != "show" {
+		return "", subcommandError("report", args)
+	}
+	files, err := parseFlags(newFlagSet("report show"), args[1:])
+	if err != nil {
+		return "", err
+	}
+	if len(files) != 1 {
+		return "", fmt.Errorf("one report file is needed")
+	}
+	return files[0], nil
+}
+
+// handleReport shows an import report written by import or sync import
+// with --report. It needs no vault: reports hold no secrets.
+func handleReport() {
+	path, err := parseReportArgs(os.Args[2:])
+	if err != nil {
+		failFlags(nil, err, os.Args[0]+" report show <report.json>")
+	}
+	report, err := importreport.Read(path)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	report.Print(os.Stdout)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"password-manager/internal/autotag"
+	"password-manager/internal/storage"
+)
+
+// retagFlags returns the flag set of retag, filling apply and dryRun
+func retagFlags(apply, dryRun *bool) *flag.FlagSet {
+	fs := newFlagSet("retag")
+	fs.BoolVar(apply, "apply-rules", false, "apply the auto_tag rules (required)")
+	fs.BoolVar(dryRun, "dry-run", false, "print the changes without saving them")
+	return fs
+}
+
+// parseRetagArgs reads the arguments of retag, which insists on
+// --apply-rules so that it is never run by accident
+func parseRetagArgs(args []string) (dryRun bool, err error) {
+	var apply bool
+	rest, err := parseFlags(retagFlags(&apply, &dryRun), args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err == nil && !apply {
+		err = fmt.Errorf("--apply-rules is needed")
+	}
+	return dryRun, err
+}
+
+// handleRetag applies the auto_tag rules of the config file to every
+// entry already in the vault
+func handleRetag() {
+	dryRun, err := parseRetagArgs(os.Args[2:])
+	if err != nil {
+		failFlags(retagFlags(new(bool), new(bool)), err, os.Args[0]+" retag --apply-rules [--dry-run]")
+	}
+	if len(tagRules) == 0 {
+		fmt.Printf("No auto_tag rules in %s\n", configPath)
+		return
+	}
+	if !dryRun && database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+
+	changes, failed, err := tagRules.Retag(database, dryRun)
+	for _, change := range changes {
+		fmt.Printf("%s: %s\n", change.Name, change)
+	}
+	for _, ruleErr := range failed {
+		fmt.Fprintf(os.Stderr, "Skipped %v\n", ruleErr)
+	}
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	verb := "Retagged"
+	if dryRun {
+		verb = "Would retag"
+	}
+	fmt.Printf("%s %d entries\n", verb, len(changes))
+	if len(failed) > 0 {
+		exit(1)
+	}
+}
+
+// reportAutoTags tells what the auto_tag rules changed on an entry that
+// was just saved with the tags before
+func reportAutoTags(before []string, entry *storage.PasswordEntry) {
+	if change := autotag.Diff(entry.Name, before, entry.Tags); change.Changed() {
+		fmt.Printf("Tags set by rules: %s\n", change)
+	}
+}
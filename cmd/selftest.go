@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"password-manager/internal/selftest"
+)
+
+// handleSelftest checks that encryption, storage and the random source
+// work, without touching the vault, and exits nonzero if any check fails
+func handleSelftest() {
+	if err := parseNoArgs(os.Args[2:]); err != nil {
+		failFlags(nil, err, os.Args[0]+" selftest")
+	}
+	if !selftest.Run(os.Stdout) {
+		fmt.Println("Self-test failed.")
+		exit(1)
+	}
+	fmt.Println("Self-test passed.")
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"password-manager/internal/suspend"
+	"password-manager/internal/tmpfile"
+	"password-manager/internal/tui"
+
+	"golang.org/x/term"
+)
+
+// exitStatus carries the status code passed to exit out of a command the
+// shell runs
+type exitStatus int
+
+var (
+	// errInterrupted cuts short a read when Ctrl-C is pressed in the
+	// shell; the line editor gives it too, as Ctrl-C sends no signal in
+	// raw mode
+	errInterrupted = tui.ErrInterrupted
+	// errIdle cuts short the read of a command line when the shell has
+	// waited for one for its idle time
+	errIdle = errors.New("idle")
+	// errSuspended cuts short a read when the system sleeps or the screen
+	// locks
+	errSuspended = errors.New("the system slept or the screen locked")
+)
+
+// suspendCheckInterval is how often the shell looks for a gap in the
+// clock left by a sleep, where the system does not report sleeps
+const suspendCheckInterval = 5 * time.Second
+
+// monitorSuspend starts watching for sleeps and screen locks; tests
+// replace it
+var monitorSuspend = suspend.Monitor
+
+// shell reads command lines from stdin and runs them one at a time, with
+// the arguments they would have on the command line, until quit or the
+// end of input. Ctrl-C cancels the line or the prompt being read instead
+// of ending the program.
+type shell struct {
+	prompt string
+	// commands are the commands the shell runs; help lists them
+	commands []string
+	// idle, if not zero, is how long the shell waits for a command line
+	// before calling onIdle
+	idle   time.Duration
+	onIdle func()
+	// onSuspend, if set, is called once the system has slept or the
+	// screen has locked, before the next command line is read. Unlike
+	// the idle timer, this holds when the machine sleeps for the night.
+	onSuspend func()
+	// suspended is set when the system has slept or the screen has locked
+	// since onSuspend was last called
+	suspended atomic.Bool
+	// before, if set, runs before each command and stops it by failing
+	before func(args []string) error
+	// after, if set, runs after each command before let run
+	after func()
+	// builtins are commands of the shell itself, such as reload, which
+	// take no arguments and run without before
+	builtins map[string]func()
+	// history, if set, keeps the command lines read, and "history clear"
+	// empties it. At a terminal the lines are read with a line editor
+	// that recalls them.
+	history *tui.History
+	// raw is the terminal state to restore while the line editor has the
+	// terminal in raw mode
+	raw atomic.Pointer[term.State]
+}
+
+// run runs the shell until quit or the end of input
+func (sh *shell) run() {
+	program := os.Args[0]
+	defer func(saved func(int)) { exit = saved }(exit)
+	exit = func(code int) { panic(exitStatus(code)) }
+
+	// Reads go through a lineReader that Ctrl-C and the idle timer can
+	// cut short. SIGTERM still cleans up and ends the program.
+	reader := &lineReader{r: stdin, cancel: make(chan error, 1)}
+	saved := stdin
+	stdin = bufio.NewReader(reader)
+	defer func() { stdin = saved }()
+	tmpfile.StopSignals()
+	defer tmpfile.HandleSignals()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGTERM {
+				if state := sh.raw.Load(); state != nil {
+					term.Restore(int(os.Stdin.Fd()), state)
+				}
+				tmpfile.Cleanup()
+				os.Exit(143)
+			}
+			reader.interrupt(errInterrupted)
+		}
+	}()
+	if sh.onSuspend != nil {
+		stop := monitorSuspend(suspendLocker{sh, reader}, suspendCheckInterval)
+		defer stop()
+	}
+	var editor *tui.LineEditor
+	if sh.history != nil && stdinIsTerminal() && term.IsTerminal(int(os.Stdout.Fd())) {
+		editor = tui.NewLineEditor(stdin, os.Stdout, sh.history)
+	}
+
+	for {
+		// Drained first, so that a sleep told of after the check still
+		// cuts short the read that follows
+		reader.drain()
+		if sh.suspended.Swap(false) {
+			sh.onSuspend()
+		}
+		var timer *time.Timer
+		if sh.idle > 0 {
+			timer = time.AfterFunc(sh.idle, func() { reader.interrupt(errIdle) })
+		}
+		line, err := sh.readLine(editor)
+		if timer != nil {
+			timer.Stop()
+		}
+		switch {
+		case errors.Is(err, errInterrupted):
+			fmt.Println()
+			continue
+		case errors.Is(err, errIdle):
+			fmt.Println()
+			sh.onIdle()
+			continue
+		case errors.Is(err, errSuspended):
+			// onSuspend is called before the next line is read
+			fmt.Println()
+			continue
+		case err != nil && (err != io.EOF || line == ""):
+			fmt.Println()
+			return
+		}
+
+		args, err := shellWords(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if sh.history != nil {
+			if err := sh.history.Add(strings.TrimRight(line, "\r\n")); err != nil {
+				printError(fmt.Errorf("%w; the command history is no longer kept", err))
+				sh.history, editor = nil, nil
+			}
+		}
+		switch command := args[0]; {
+		case command == "quit" || command == "exit":
+			return
+		case command == "history" && len(args) == 2 && args[1] == "clear" && sh.history != nil:
+			if err := sh.history.Clear(); err != nil {
+				printError(err)
+			} else {
+				fmt.Println("Command history cleared.")
+			}
+		case command == "help":
+			fmt.Printf("Commands: %s\n", strings.Join(sh.commands, ", "))
+			fmt.Println("Each takes the options it takes on the command line. quit or Ctrl-D leaves.")
+			if len(sh.builtins) > 0 {
+				names := make([]string, 0, len(sh.builtins))
+				for name := range sh.builtins {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				fmt.Printf("Also: %s\n", strings.Join(names, ", "))
+			}
+			if sh.history != nil {
+				fmt.Println("history clear forgets the command lines kept; up, down and Ctrl-R recall them.")
+			}
+		case sh.builtins[command] != nil:
+			sh.builtins[command]()
+		case !hasCommand(sh.commands, command):
+			fmt.Fprintf(os.Stderr, "Error: %s is not available here; type help for the commands that are\n", command)
+		default:
+			if sh.before != nil {
+				if err := sh.before(args); err != nil {
+					printError(err)
+					continue
+				}
+			}
+			runShellCommand(program, args)
+			if sh.after != nil {
+				sh.after()
+			}
+		}
+	}
+}
+
+// suspendLocker is told by the suspend monitor of the shell that the
+// system slept or the screen locked. It cuts short the read of a command
+// line, if one is under way; a command that is running finishes first.
+type suspendLocker struct {
+	sh     *shell
+	reader *lineReader
+}
+
+func (l suspendLocker) Lock() {
+	l.sh.suspended.Store(true)
+	l.reader.interrupt(errSuspended)
+}
+
+// readLine reads a command line: through editor, with the terminal in
+// raw mode for the while, or as it comes when editor is nil
+func (sh *shell) readLine(editor *tui.LineEditor) (string, error) {
+	if editor != nil {
+		fd := int(os.Stdin.Fd())
+		if state, err := term.MakeRaw(fd); err == nil {
+			sh.raw.Store(state)
+			defer func() {
+				term.Restore(fd, state)
+				sh.raw.Store(nil)
+			}()
+			return editor.ReadLine(sh.prompt)
+		}
+	}
+	fmt.Print(sh.prompt)
+	return stdin.ReadString('\n')
+}
+
+// lineReader reads from r until a read is cut short through cancel. The
+// read underneath carries on, and the next Read returns what it got, so
+// no input is lost.
+type lineReader struct {
+	r       io.Reader
+	cancel  chan error
+	pending chan readResult
+	rest    []byte
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	if len(lr.rest) > 0 {
+		n := copy(p, lr.rest)
+		lr.rest = lr.rest[n:]
+		return n, nil
+	}
+	if lr.pending == nil {
+		pending := make(chan readResult, 1)
+		size := len(p)
+		go func() {
+			buf := make([]byte, size)
+			n, err := lr.r.Read(buf)
+			pending <- readResult{buf[:n], err}
+		}()
+		lr.pending = pending
+	}
+
+	select {
+	case result := <-lr.pending:
+		lr.pending = nil
+		n := copy(p, result.data)
+		lr.rest = result.data[n:]
+		return n, result.err
+	case err := <-lr.cancel:
+		return 0, err
+	}
+}
+
+// interrupt cuts short the current or next Read with err
+func (lr *lineReader) interrupt(err error) {
+	select {
+	case lr.cancel <- err:
+	default:
+	}
+}
+
+// drain forgets an interrupt no Read has taken, such as Ctrl-C pressed
+// while a command was not reading
+func (lr *lineReader) drain() {
+	select {
+	case <-lr.cancel:
+	default:
+	}
+}
+
+// runShellCommand runs one command line of the shell and returns its
+// status code
+func runShellCommand(program string, args []string) (status int) {
+	defer func() {
+		if r := recover(); r != nil {
+			code, ok := r.(exitStatus)
+			if !ok {
+				panic(r)
+			}
+			status = int(code)
+		}
+	}()
+
+	os.Args = append([]string{program}, args...)
+	if err := checkArgs(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	runCommand(args[0])
+	return 0
+}
+
+// hasCommand reports whether command is one of commands
+func hasCommand(commands []string, command string) bool {
+	for _, c := range commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// shellWords splits a command line into words as a POSIX shell does,
+// honouring single and double quotes and backslash escapes, but without
+// expanding anything
+func shellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			// Within double quotes a backslash only escapes what is
+			// special there
+			if quote == '"' && !strings.ContainsRune(`"\$`+"`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("line ends with a backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/suspend"
+	"password-manager/internal/tui"
+)
+
+func TestShellWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  list  ", []string{"list"}},
+		{`list --where "tag=work and name~git"`, []string{"list", "--where", "tag=work and name~git"}},
+		{`get 'my bank'`, []string{"get", "my bank"}},
+		{`get my\ bank`, []string{"get", "my bank"}},
+		{`save x --password 'it''s'`, []string{"save", "x", "--password", "its"}},
+		{`save x --password "a\"b\c"`, []string{"save", "x", "--password", `a"b\c`}},
+		{`get ''`, []string{"get", ""}},
+	}
+	for _, tt := range tests {
+		got, err := shellWords(tt.line)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shellWords(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+
+	for _, line := range []string{`get "bank`, `get 'bank`, `get bank\`} {
+		if _, err := shellWords(line); err == nil {
+			t.Errorf("shellWords(%q) succeeded, want an error", line)
+		}
+	}
+}
+
+func TestRunShellCommandExit(t *testing.T) {
+	defer func(saved []string) { os.Args = saved }(os.Args)
+	defer func(saved func(int)) { exit = saved }(exit)
+	exit = func(code int) { panic(exitStatus(code)) }
+
+	if status := runShellCommand("pm", []string{"no-such-command"}); status != 1 {
+		t.Errorf("Expected status 1 for an unknown command, got %d", status)
+	}
+	if status := runShellCommand("pm", []string{"version"}); status != 0 {
+		t.Errorf("Expected status 0, got %d", status)
+	}
+}
+
+func TestLineReaderInterrupt(t *testing.T) {
+	pr, pw := io.Pipe()
+	reader := &lineReader{r: pr, cancel: make(chan error, 1)}
+	lines := bufio.NewReader(reader)
+
+	// Cut short while nothing has been typed; the read underneath goes on
+	reader.interrupt(errInterrupted)
+	if _, err := lines.ReadString('\n'); !errors.Is(err, errInterrupted) {
+		t.Fatalf("Expected errInterrupted, got %v", err)
+	}
+	go pw.Write([]byte("list --tag work\n"))
+	if line, err := lines.ReadString('\n'); err != nil || line != "list --tag work\n" {
+		t.Errorf("Expected the line typed after the interrupt, got %q, %v", line, err)
+	}
+
+	// An interrupt nobody read is forgotten
+	reader.interrupt(errIdle)
+	reader.drain()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pw.Close()
+	}()
+	if _, err := lines.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestParseLockAfter(t *testing.T) {
+	if idle, err := parseLockAfter(nil); err != nil || idle != 5*time.Minute {
+		t.Errorf("Expected the default of 5m, got %v, %v", idle, err)
+	}
+	if idle, err := parseLockAfter([]string{"--lock-after", "90s"}); err != nil || idle != 90*time.Second {
+		t.Errorf("Expected 90s, got %v, %v", idle, err)
+	}
+	if idle, err := parseLockAfter([]string{"--lock-after=0"}); err != nil || idle != 0 {
+		t.Errorf("Expected 0 to never lock, got %v, %v", idle, err)
+	}
+	for _, args := range [][]string{{"--lock-after", "soon"}, {"--lock-after", "2030-01-01"}, {"extra"}, {"--bogus"}} {
+		if _, err := parseLockAfter(args); err == nil {
+			t.Errorf("parseLockAfter(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestKeepInHistory(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"list --tag work", true},
+		{"get bank --show", true},
+		{"save x --username me", true},
+		{"save x --password hunter2", false},
+		{"save x --password=hunter2", false},
+		{"save x -password hunter2", false},
+		{"save --password hunter2 -- x", false},
+		{"save -- --password", true},
+		{"update bank --password hunter2", false},
+		{"edit bank --password", false},
+		{"totp set --secret JBSWY3DPEHPK3PXP bank", false},
+		{"totp set --uri otpauth://totp/x bank", false},
+		{"generate --length 20", true},
+		{"gen --length 20 --no-symbols", true},
+		{"analyze hunter2", false},
+		{"analyze -- -hunter2", false},
+		{"analyze --compare", true},
+		{"search recovery --in notes", true},
+		{"search hunter2 --include-passwords", false},
+		{`save "x --password`, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := keepInHistory(tt.line); got != tt.want {
+			t.Errorf("keepInHistory(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestShellHistory(t *testing.T) {
+	defer func(saved *bufio.Reader) { stdin = saved }(stdin)
+	path := filepath.Join(t.TempDir(), "history")
+	history, err := tui.LoadHistory(path, keepInHistory)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+
+	run := func(script string) {
+		stdin = bufio.NewReader(strings.NewReader(script))
+		(&shell{history: history}).run()
+	}
+	run("save x --password hunter2\nlist --tag work\nquit\n")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "list --tag work\nquit\n" {
+		t.Errorf("Unexpected history file %q", data)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("The password was written to the history")
+	}
+
+	run("history clear\n")
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("Expected history clear to empty the file, got %q", data)
+	}
+}
+
+func TestShellLocksOnSuspend(t *testing.T) {
+	defer func(saved *bufio.Reader) { stdin = saved }(stdin)
+	defer func(saved func(suspend.Locker, time.Duration) func()) { monitorSuspend = saved }(monitorSuspend)
+
+	lockers := make(chan suspend.Locker, 1)
+	stopped := make(chan bool, 1)
+	monitorSuspend = func(l suspend.Locker, interval time.Duration) func() {
+		lockers <- l
+		return func() { stopped <- true }
+	}
+
+	pr, pw := io.Pipe()
+	stdin = bufio.NewReader(pr)
+	locked := make(chan bool, 1)
+	done := make(chan bool)
+	go func() {
+		(&shell{onSuspend: func() { locked <- true }}).run()
+		close(done)
+	}()
+
+	// A sleep while the shell waits for a command line locks at once
+	(<-lockers).Lock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected onSuspend to be called while waiting for a command")
+	}
+	pw.Write([]byte("quit\n"))
+	<-done
+	if len(stopped) != 1 {
+		t.Error("Expected the monitor to be stopped when the shell ends")
+	}
+	if len(locked) != 0 {
+		t.Error("Expected onSuspend to be called once")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// maxSimilar is how many entries with similar names are offered for a
+// name no entry has
+const maxSimilar = 9
+
+// findSimilar is called with a name no entry has, by get, update and
+// delete unless given --exact. At a terminal it offers the entries named
+// like it and returns the one picked. Otherwise, or when none is picked,
+// it returns ErrEntryNotFound, naming the similar entries when it could
+// not ask.
+func findSimilar(name string) (string, error) {
+	similar, err := database.FindSimilar(name, maxSimilar)
+	if err != nil {
+		return "", fmt.Errorf("failed to list passwords: %w", err)
+	}
+	notFound := fmt.Errorf("%w: %s", storage.ErrEntryNotFound, name)
+	if len(similar) == 0 {
+		return "", notFound
+	}
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("%w; did you mean %s?", notFound, quoteNames(similar))
+	}
+
+	// Prompts go to stderr so that the output of get --json stays JSON
+	picked, err := pickSimilar(&terminalPrompter{in: stdin, out: os.Stderr}, os.Stderr, name, similar)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	if picked == "" {
+		return "", notFound
+	}
+	return picked, nil
+}
+
+// pickSimilar asks whether the entry meant by name is the one in similar,
+// or which of them it is, and returns it, or "" for none
+func pickSimilar(p Prompter, w io.Writer, name string, similar []string) (string, error) {
+	if len(similar) == 1 {
+		answer, err := p.Ask(fmt.Sprintf("No entry '%s'. Did you mean '%s'? (Y/n): ", name, similar[0]))
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "y", "yes":
+			return similar[0], nil
+		}
+		return "", nil
+	}
+
+	fmt.Fprintf(w, "No entry '%s'. Did you mean:\n", name)
+	for i, candidate := range similar {
+		fmt.Fprintf(w, "  %d) %s\n", i+1, candidate)
+	}
+	for {
+		answer, err := p.Ask(fmt.Sprintf("Pick one (1-%d, Enter for none): ", len(similar)))
+		if err != nil {
+			return "", err
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return "", nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(similar) {
+			return similar[n-1], nil
+		}
+		fmt.Fprintf(w, "Enter a number from 1 to %d.\n", len(similar))
+	}
+}
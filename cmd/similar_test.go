@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPickSimilar(t *testing.T) {
+	tests := []struct {
+		similar []string
+		answers []string
+		want    string
+	}{
+		{[]string{"gmail"}, []string{""}, "gmail"},
+		{[]string{"gmail"}, []string{"Y"}, "gmail"},
+		{[]string{"gmail"}, []string{"n"}, ""},
+		{[]string{"bank-new", "bank-old"}, []string{"2"}, "bank-old"},
+		{[]string{"bank-new", "bank-old"}, []string{""}, ""},
+		// Anything but a listed number asks again
+		{[]string{"bank-new", "bank-old"}, []string{"3", "bank", "1"}, "bank-new"},
+	}
+	for _, tt := range tests {
+		prompter := &scriptedPrompter{answers: tt.answers}
+		var out bytes.Buffer
+		got, err := pickSimilar(prompter, &out, "bank", tt.similar)
+		if err != nil {
+			t.Fatalf("%q: pickSimilar failed: %v", tt.answers, err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.answers, tt.want, got)
+		}
+		if len(prompter.answers) > 0 {
+			t.Errorf("%q: answers left over: %q", tt.answers, prompter.answers)
+		}
+		if len(tt.similar) > 1 && !strings.Contains(out.String(), "  2) bank-old\n") {
+			t.Errorf("Expected the candidates listed by number, got %q", out.String())
+		}
+	}
+}
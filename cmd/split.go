@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"password-manager/internal/hooks"
+	"password-manager/internal/query"
+	"password-manager/internal/recipient"
+	"password-manager/internal/storage"
+)
+
+// splitTombstoneTag marks the notes split leaves in place of moved entries
+const splitTombstoneTag = "moved"
+
+// splitOptions are the arguments of split
+type splitOptions struct {
+	whereExpr, into string
+	keepTombstones  bool
+	where           *query.Query
+}
+
+// splitFlags returns the flag set of split, filling opts
+func splitFlags(opts *splitOptions) *flag.FlagSet {
+	fs := newFlagSet("split")
+	fs.StringVar(&opts.whereExpr, "where", "", "move the entries matching `expr` (required)")
+	fs.StringVar(&opts.into, "into", "", "the `vault-file` to move them to, created if needed (required)")
+	fs.BoolVar(&opts.keepTombstones, "keep-tombstones", false, "leave a note in place of each moved entry")
+	return fs
+}
+
+// parseSplitArgs reads the arguments of split
+func parseSplitArgs(args []string) (*splitOptions, error) {
+	opts := &splitOptions{}
+	fs := splitFlags(opts)
+	rest, err := parseFlags(fs, args)
+	if err == nil {
+		err = noArguments(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	given := flagsGiven(fs)
+	if !given["where"] || !given["into"] {
+		return nil, fmt.Errorf("--where and --into are needed")
+	}
+	if opts.where, err = parseWhere(opts.whereExpr, true); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// handleSplit moves the entries matching a query into another vault,
+// creating it if needed. Each entry is moved on its own, so a failure
+// stops the split with every entry in exactly one of the vaults.
+func handleSplit() {
+	opts, err := parseSplitArgs(os.Args[2:])
+	if err != nil {
+		usage := os.Args[0] + " split --where <query> --into <vault-file> [--keep-tombstones]"
+		failFlags(splitFlags(&splitOptions{}), err, usage)
+	}
+	q, into, keepTombstones := opts.where, opts.into, opts.keepTombstones
+	if database.IsViewer() {
+		printError(storage.ErrReadOnly)
+		exit(1)
+	}
+	if sameFile(into, dbPath) {
+		fmt.Fprintf(os.Stderr, "Error: %s is the open vault\n", into)
+		exit(1)
+	}
+
+	matched, err := queryEntries(q)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	// The tombstones of an earlier split stay where they are
+	var entries []*storage.PasswordEntry
+	for _, entry := range matched {
+		if !entry.IsNote() || !hasFlag(entry.Tags, splitTombstoneTag) {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("No entries match.")
+		return
+	}
+
+	target, err := openSplitTarget(into)
+	if err != nil {
+		printError(fmt.Errorf("%s: %w", into, err))
+		exit(1)
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		var tombstone *storage.PasswordEntry
+		if keepTombstones {
+			tombstone = &storage.PasswordEntry{
+				Name:  entry.Name,
+				Type:  storage.EntryTypeNote,
+				Notes: fmt.Sprintf("Moved to %s on %s.", into, time.Now().Format("2006-01-02")),
+				Tags:  []string{splitTombstoneTag},
+			}
+		}
+		if err = database.MoveEntry(target, entry.Name, tombstone); err != nil {
+			break
+		}
+		moved++
+		queueHook(hooks.Delete, entry.Name)
+	}
+	if closeErr := target.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close %s: %w", into, closeErr)
+	}
+
+	fmt.Printf("Moved %d of %d entries to %s.\n", moved, len(entries), into)
+	if keepTombstones && moved > 0 {
+		fmt.Printf("Each left a note tagged %s in its place.\n", splitTombstoneTag)
+	}
+	if err != nil {
+		printError(err)
+		fmt.Fprintln(os.Stderr, "Run the same split again to move the rest.")
+		exit(1)
+	}
+}
+
+// openSplitTarget opens the vault entries are split into, with the master
+// password of this vault if it works and otherwise by asking, or creates
+// it. Whole-file encrypted vaults only reach the disk when closed, so a
+// copy could not be known to be safe before the original is removed;
+// they are refused.
+func openSplitTarget(path string) (*storage.Database, error) {
+	var target *storage.Database
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Printf("Creating a new vault at %s.\n", path)
+		password, err := chooseMasterPassword("vault not created")
+		if err != nil {
+			return nil, err
+		}
+		if target, err = storage.CreateDatabase(path, password, storage.InitOptions{}); err != nil {
+			return nil, err
+		}
+	} else {
+		target, err = storage.NewDatabase(path, masterSecret.Reveal())
+		if errors.Is(err, storage.ErrInvalidPassword) {
+			var password []byte
+			if password, err = readSecretBytes(fmt.Sprintf("Master password of %s: ", path)); err == nil {
+				target, err = storage.NewDatabase(path, password)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if target.IsFullyEncrypted() {
+		target.Close()
+		return nil, fmt.Errorf("cannot split into a vault with whole-file encryption; convert it first")
+	}
+	if identityFile != "" {
+		identities, err := recipient.LoadIdentities(identityFile)
+		if err != nil {
+			target.Close()
+			return nil, err
+		}
+		target.SetIdentities(identities)
+	}
+	return target, nil
+}
+
+// sameFile reports whether two paths name the same existing file
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(infoA, infoB)
+}
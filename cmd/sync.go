@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/hooks"
+	"password-manager/internal/importreport"
+	"password-manager/internal/recipient"
+	"password-manager/internal/storage"
+)
+
+// syncOptions are the arguments of the sync subcommands
+type syncOptions struct {
+	// command is "import", "conflicts" or "conflicts restore"
+	command string
+	file    string
+	prefer  string
+	report  reportOptions
+	long    bool
+	id      int64
+	as      string
+}
+
+// syncFlags returns the flag set of a sync subcommand, filling opts
+func syncFlags(command string, opts *syncOptions) *flag.FlagSet {
+	fs := newFlagSet("sync " + command)
+	switch command {
+	case "import":
+		fs.StringVar(&opts.prefer, "prefer", storage.SyncNewer, "which side wins a conflict: `newer`, local or remote")
+		opts.report.addFlags(fs)
+	case "conflicts":
+		fs.BoolVar(&opts.long, "long", false, "show full timestamps")
+	case "conflicts restore":
+		fs.StringVar(&opts.as, "as", "", "save the losing version under `name`")
+	}
+	return fs
+}
+
+// parseSyncArgs reads the subcommand of sync and its arguments. opts is
+// returned with the subcommand set even when the rest does not parse.
+func parseSyncArgs(args []string) (*syncOptions, error) {
+	opts := &syncOptions{}
+	switch {
+	case len(args) > 0 && args[0] == "import":
+		opts.command, args = "import", args[1:]
+	case len(args) > 1 && args[0] == "conflicts" && args[1] == "restore":
+		opts.command, args = "conflicts restore", args[2:]
+	case len(args) > 0 && args[0] == "conflicts":
+		opts.command, args = "conflicts", args[1:]
+	default:
+		return opts, subcommandError("sync", args)
+	}
+	fs := syncFlags(opts.command, opts)
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return opts, err
+	}
+
+	switch opts.command {
+	case "import":
+		switch {
+		case len(rest) != 1:
+			return opts, fmt.Errorf("one vault file is needed")
+		case opts.prefer != storage.SyncNewer && opts.prefer != storage.SyncLocal && opts.prefer != storage.SyncRemote:
+			return opts, fmt.Errorf("--prefer must be newer, local or remote")
+		}
+		opts.file = rest[0]
+		return opts, opts.report.check(flagsGiven(fs))
+	case "conflicts restore":
+		if len(rest) != 1 {
+			return opts, fmt.Errorf("a conflict ID is needed")
+		}
+		if opts.id, err = strconv.ParseInt(rest[0], 10, 64); err != nil {
+			return opts, fmt.Errorf("conflict ID must be a number")
+		}
+		return opts, nil
+	}
+	return opts, noArguments(rest)
+}
+
+// handleSync merges another copy of the vault into this one, and lists
+// and restores the versions that lost a conflict
+func handleSync() {
+	opts, err := parseSyncArgs(os.Args[2:])
+	if err != nil {
+		usage := os.Args[0] + " sync import [--prefer newer|local|remote] [--report <file> [--report-redact]] <vault-file>\n" +
+			"       " + os.Args[0] + " sync conflicts [--long]\n" +
+			"       " + os.Args[0] + " sync conflicts restore [--as <name>] <id>"
+		failFlags(syncFlags(opts.command, &syncOptions{}), err, usage)
+	}
+
+	// The retention setting is checked before anything is written
+	retention, err := duration.Parse(settings.ConflictRetention(), duration.Expiry)
+	if err != nil {
+		printError(fmt.Errorf("config %s: sync_conflict_retention: %w", configPath, err))
+		exit(1)
+	}
+
+	switch opts.command {
+	case "import":
+		start := time.Now()
+		var report *importreport.Report
+		if opts.report.path != "" {
+			if err := checkReportPath(opts.report.path, opts.file); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			if report, err = importreport.New("sync import", opts.file, "vault", opts.prefer, start); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+		syncImport(opts.file, opts.prefer, report)
+		if report != nil {
+			report.Finish(time.Now(), opts.report.redact)
+			if err := importreport.Write(opts.report.path, report); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+	case "conflicts":
+		listSyncConflicts(opts.long)
+		return
+	case "conflicts restore":
+		syncRestore(opts.id, opts.as)
+		return
+	}
+
+	pruned, err := database.PruneSyncConflicts(retention.Before(time.Now()))
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if pruned > 0 {
+		fmt.Printf("Pruned %d sync conflicts older than %s.\n", pruned, settings.ConflictRetention())
+	}
+}
+
+// syncImport opens the vault file at path, with the master password of
+// this vault if it works and otherwise by asking, and merges it in,
+// recording the outcome of each entry in report if it is not nil
+func syncImport(path, prefer string, report *importreport.Report) {
+	remote, err := storage.NewDatabase(path, masterSecret.Reveal())
+	if errors.Is(err, storage.ErrInvalidPassword) {
+		var password []byte
+		if password, err = readSecretBytes(fmt.Sprintf("Master password of %s: ", path)); err == nil {
+			remote, err = storage.NewDatabase(path, password)
+		}
+	}
+	if err != nil {
+		printError(fmt.Errorf("%s: %w", path, err))
+		exit(1)
+	}
+	defer remote.Close()
+	if identityFile != "" {
+		identities, err := recipient.LoadIdentities(identityFile)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		remote.SetIdentities(identities)
+	}
+
+	result, err := database.SyncFrom(remote, prefer)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+
+	if report != nil {
+		for _, outcome := range result.Outcomes {
+			report.Add(importreport.Row{Name: outcome.Name, Username: outcome.Username, Outcome: outcome.Outcome, Reason: outcome.Reason})
+		}
+	}
+
+	fmt.Printf("Sync %s: %d added, %d conflicts, %d unchanged.\n", result.RunID, result.Added, len(result.Conflicts), result.Unchanged)
+	for _, c := range result.Conflicts {
+		fmt.Printf("  %s: kept %s version%s\n", c.Name, c.Winner, lostNewerWarning(c))
+	}
+	for _, name := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "Warning: skipped '%s': its password is encrypted to recipients and no identity can read it\n", name)
+	}
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("The losing versions are logged; see '%s sync conflicts'.\n", os.Args[0])
+	}
+	queueHook(hooks.Import, "")
+}
+
+// lostNewerWarning flags a conflict where the newer remote version lost
+func lostNewerWarning(c *storage.SyncConflict) string {
+	if c.RemoteNewerLost() {
+		return " (! the remote version was newer)"
+	}
+	return ""
+}
+
+// listSyncConflicts prints the conflict log, newest first
+func listSyncConflicts(long bool) {
+	conflicts, err := database.SyncConflicts()
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if len(conflicts) == 0 {
+		fmt.Println("No sync conflicts logged.")
+		return
+	}
+
+	unresolved := 0
+	for _, c := range conflicts {
+		marker := " "
+		if c.RemoteNewerLost() && c.RestoredAt.IsZero() {
+			marker = "!"
+			unresolved++
+		}
+		fmt.Printf("%s %d  %s  kept %s (local %s, remote %s)  sync %s, %s",
+			marker, c.ID, c.Name, c.Winner, formatTime(c.LocalUpdatedAt, long),
+			formatTime(c.RemoteUpdatedAt, long), c.RunID, formatTime(c.CreatedAt, long))
+		if !c.RestoredAt.IsZero() {
+			fmt.Printf("  restored %s", formatTime(c.RestoredAt, long))
+		}
+		fmt.Println()
+	}
+	if unresolved > 0 {
+		fmt.Printf("\n%d conflicts marked ! kept an older local version over a newer remote one.\n", unresolved)
+		fmt.Printf("Restore the remote version with '%s sync conflicts restore <id>'.\n", os.Args[0])
+	}
+}
+
+// syncRestore saves the losing version of conflict id as a new entry
+// called name, or after the entry it lost to if name is empty
+func syncRestore(id int64, name string) {
+	if name == "" {
+		conflicts, err := database.SyncConflicts()
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		for _, c := range conflicts {
+			if c.ID == id {
+				name = fmt.Sprintf("%s (sync conflict %d)", c.Name, c.ID)
+			}
+		}
+	}
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "Error: no sync conflict with ID %d\n", id)
+		exit(1)
+	}
+
+	if _, err := database.RestoreSyncConflict(id, name); err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf("Restored the losing version as '%s'.\n", name)
+	queueHook(hooks.Save, name)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/totp"
+)
+
+// totpVerifyWindow is how many steps either side of now a code may be
+// from and still verify
+const totpVerifyWindow = 1
+
+// totpOptions are the arguments of totp and its subcommands
+type totpOptions struct {
+	// command is "" to show a code, "set", "verify" or "remove"
+	command        string
+	name, code     string
+	atText         string
+	at             time.Time
+	uri, secret    string
+	algorithm      string
+	digits, period int
+}
+
+// totpFlags returns the flag set of a totp subcommand, filling opts. The
+// --uri and --secret of set take secrets.
+func totpFlags(command string, opts *totpOptions) *flag.FlagSet {
+	fs := newFlagSet(strings.TrimSpace("totp " + command))
+	switch command {
+	case "", "verify":
+		fs.StringVar(&opts.atText, "at", "", "use the RFC 3339 `time` instead of now")
+	case "set":
+		fs.Var(secretFlag{&opts.uri}, "uri", "read the settings from an otpauth:// `uri`")
+		fs.Var(secretFlag{&opts.secret}, "secret", "the base32 `secret`")
+		fs.IntVar(&opts.digits, "digits", 0, "code length: 6, 7 or 8 `digits`")
+		fs.StringVar(&opts.algorithm, "algorithm", "", "hash `algorithm`: SHA1, SHA256 or SHA512")
+		fs.IntVar(&opts.period, "period", 0, "`seconds` each code is valid for")
+	}
+	return fs
+}
+
+// parseTOTPArgs reads the subcommand of totp and its arguments. All
+// positional arguments form the name, but for the code verify takes
+// last. opts is returned with the subcommand set even when the rest does
+// not parse.
+func parseTOTPArgs(args []string) (*totpOptions, error) {
+	opts := &totpOptions{at: time.Now()}
+	if len(args) > 0 && (args[0] == "set" || args[0] == "verify" || args[0] == "remove") {
+		opts.command, args = args[0], args[1:]
+	}
+	fs := totpFlags(opts.command, opts)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return opts, err
+	}
+
+	if opts.command == "verify" {
+		if len(words) < 2 {
+			return opts, fmt.Errorf("a name and a code are needed")
+		}
+		opts.code, words = words[len(words)-1], words[:len(words)-1]
+	}
+	if opts.name = strings.Join(words, " "); opts.name == "" {
+		return opts, fmt.Errorf("a name is needed")
+	}
+	if flagsGiven(fs)["at"] {
+		if opts.at, err = time.Parse(time.RFC3339, opts.atText); err != nil {
+			return opts, fmt.Errorf("--at must be an RFC 3339 time such as 2025-01-01T00:00:00Z")
+		}
+	}
+	if opts.command == "set" && (opts.uri == "") == (opts.secret == "") {
+		return opts, fmt.Errorf("one of --uri and --secret is needed")
+	}
+	return opts, nil
+}
+
+// handleTOTP shows the current code of an entry, or with a subcommand
+// stores, removes or checks its TOTP settings
+func handleTOTP() {
+	opts, err := parseTOTPArgs(os.Args[2:])
+	if err != nil {
+		usage := os.Args[0] + " totp [--at <time>] [--] <name>\n" +
+			"       " + os.Args[0] + " totp set (--uri <otpauth-uri> | --secret <base32>) [--digits 6|7|8] [--algorithm SHA1|SHA256|SHA512] [--period <seconds>] [--] <name>\n" +
+			"       " + os.Args[0] + " totp verify [--at <time>] [--] <name> <code>\n" +
+			"       " + os.Args[0] + " totp remove [--] <name>"
+		failFlags(totpFlags(opts.command, &totpOptions{}), err, usage)
+	}
+
+	switch opts.command {
+	case "set":
+		totpSet(opts)
+	case "remove":
+		if err := database.SetTOTP(opts.name, nil); err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Printf("TOTP removed from '%s'.\n", opts.name)
+	case "verify":
+		totpVerify(loadTOTP(opts.name), opts.code, opts.at)
+	default:
+		params := loadTOTP(opts.name)
+		code, err := params.Code(opts.at)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Printf("%s (valid for %ds)\n", code, int(params.Remaining(opts.at).Seconds()))
+	}
+}
+
+// loadTOTP returns the TOTP settings of an entry or exits
+func loadTOTP(name string) *totp.Params {
+	params, err := database.TOTP(name)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if params == nil {
+		fmt.Fprintf(os.Stderr, "Error: '%s' has no TOTP; add it with '%s totp set'\n", name, os.Args[0])
+		exit(1)
+	}
+	return params
+}
+
+// totpSet stores TOTP settings from an otpauth URI or a bare secret; the
+// flags override what the URI says
+func totpSet(opts *totpOptions) {
+	params := &totp.Params{Secret: opts.secret}
+	if opts.uri != "" {
+		var err error
+		if params, err = totp.ParseURI(opts.uri); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+	if opts.algorithm != "" {
+		params.Algorithm = opts.algorithm
+	}
+	if opts.digits != 0 {
+		params.Digits = opts.digits
+	}
+	if opts.period != 0 {
+		params.Period = opts.period
+	}
+
+	if err := database.SetTOTP(opts.name, params); err != nil {
+		printError(err)
+		exit(1)
+	}
+	fmt.Printf("TOTP saved for '%s' (%s, %d digits, %ds period).\n", opts.name, params.Algorithm, params.Digits, params.Period)
+}
+
+// totpVerify checks a code and reports how far the clock that made it is
+// from ours, in steps and seconds
+func totpVerify(params *totp.Params, code string, at time.Time) {
+	drift, ok, err := params.Verify(code, at, totpVerifyWindow)
+	if err != nil {
+		printError(err)
+		exit(1)
+	}
+	if !ok {
+		fmt.Printf("Code does not match within ±%d step (±%ds).\n", totpVerifyWindow, totpVerifyWindow*params.Period)
+		exit(1)
+	}
+
+	switch {
+	case drift == 0:
+		fmt.Println("Code matches; no drift.")
+	case drift < 0:
+		fmt.Printf("Code matches with a drift of %d step (%ds): the generating clock is behind.\n", drift, drift*params.Period)
+	default:
+		fmt.Printf("Code matches with a drift of +%d step (+%ds): the generating clock is ahead.\n", drift, drift*params.Period)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/hooks"
+)
+
+// trashOptions are the arguments of trash and its subcommands
+type trashOptions struct {
+	// command is "list" or "empty"
+	command   string
+	long      bool
+	olderText string
+	olderThan time.Duration
+}
+
+// trashFlags returns the flag set of a trash subcommand, filling opts
+func trashFlags(command string, opts *trashOptions) *flag.FlagSet {
+	fs := newFlagSet("trash " + command)
+	switch command {
+	case "list":
+		fs.BoolVar(&opts.long, "long", false, "show full timestamps")
+	case "empty":
+		fs.StringVar(&opts.olderText, "older-than", "", "delete only the entries deleted more than `age` ago, such as 30d")
+	}
+	return fs
+}
+
+// parseTrashArgs reads the subcommand of trash, list when none is given,
+// and its arguments
+func parseTrashArgs(args []string) (*trashOptions, error) {
+	opts := &trashOptions{command: "list"}
+	named := len(args) > 0 && (args[0] == "list" || args[0] == "empty")
+	if named {
+		opts.command, args = args[0], args[1:]
+	}
+	fs := trashFlags(opts.command, opts)
+	rest, err := parseFlags(fs, args)
+	switch {
+	case err != nil:
+		return opts, err
+	case len(rest) > 0 && !named:
+		return opts, fmt.Errorf("unknown trash command %s", rest[0])
+	case len(rest) > 0:
+		return opts, noArguments(rest)
+	}
+	if flagsGiven(fs)["older-than"] {
+		spec, err := duration.Parse(opts.olderText, duration.Expiry)
+		if err != nil {
+			return opts, fmt.Errorf("--older-than: %w", err)
+		}
+		now := time.Now()
+		opts.olderThan = now.Sub(spec.Before(now))
+	}
+	return opts, nil
+}
+
+// handleTrash lists or empties the entries delete has moved to the trash
+func handleTrash() {
+	opts, err := parseTrashArgs(os.Args[2:])
+	if err != nil {
+		usage := os.Args[0] + " trash [list [--long] | empty [--older-than <age>]]"
+		failFlags(trashFlags(opts.command, &trashOptions{}), err, usage)
+	}
+
+	switch opts.command {
+	case "list":
+		items, err := database.ListTrash()
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		if len(items) == 0 {
+			fmt.Println("The trash is empty.")
+			return
+		}
+		fmt.Printf("%d entries in the trash, most recently deleted first:\n", len(items))
+		for _, item := range items {
+			fmt.Printf("  %-30s deleted %s\n", item.Name, formatTime(item.DeletedAt, opts.long))
+		}
+		fmt.Printf("Bring one back with '%s restore <name>'.\n", os.Args[0])
+	case "empty":
+		n, err := database.PurgeTrash(opts.olderThan)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		fmt.Printf("Permanently deleted %d entries from the trash.\n", n)
+	}
+}
+
+// restoreFlags returns the flag set of restore, filling as
+func restoreFlags(as *string) *flag.FlagSet {
+	fs := newFlagSet("restore")
+	fs.StringVar(as, "as", "", "restore the entry under `new name`")
+	return fs
+}
+
+// parseRestoreArgs reads the arguments of restore. All positional
+// arguments form the name.
+func parseRestoreArgs(args []string) (name, as string, err error) {
+	fs := restoreFlags(&as)
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return "", "", err
+	}
+	if name = strings.Join(words, " "); name == "" {
+		return "", "", fmt.Errorf("a name is needed")
+	}
+	if flagsGiven(fs)["as"] {
+		if err := validateName(as); err != nil {
+			return "", "", err
+		}
+	}
+	return name, as, nil
+}
+
+// handleRestore brings an entry back from the trash, under another name
+// with --as when its own has been taken since
+func handleRestore() {
+	name, as, err := parseRestoreArgs(os.Args[2:])
+	if err != nil {
+		failFlags(restoreFlags(new(string)), err, os.Args[0]+" restore <name> [--as <new name>]")
+	}
+	if as == "" {
+		as = name
+	}
+
+	if err := database.RestoreAs(name, as); err != nil {
+		printError(err)
+		exit(1)
+	}
+	if as != name {
+		fmt.Printf("Restored '%s' as '%s'.\n", name, as)
+	} else {
+		fmt.Printf("Restored '%s'.\n", name)
+	}
+	queueHook(hooks.Save, as)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"password-manager/internal/hooks"
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+)
+
+// updateOptions are the arguments of update
+type updateOptions struct {
+	name     string
+	updates  storage.PasswordEntry
+	password string
+	// prompt is set by a --password without a value
+	prompt     bool
+	expiresAt  *time.Time
+	hasExpires bool
+	tags       tagChange
+	exact      bool
+	// changed names the fields given new values, except the password
+	changed []string
+
+	expires  string
+	tagTexts [3]string
+}
+
+// updateFlags returns the flag set of update, filling opts. --password is
+// listed here for --help and the shell history, but taken out of the
+// arguments by takePasswordFlag first, as its value is optional.
+func updateFlags(opts *updateOptions) *flag.FlagSet {
+	fs := newFlagSet("update")
+	fs.StringVar(&opts.updates.Username, "username", "", "the new `username`")
+	fs.Var(secretFlag{&opts.password}, "password", "the new `password`; asked for without echo when left out")
+	fs.StringVar(&opts.updates.URL, "url", "", "the new `url`")
+	fs.StringVar(&opts.updates.Notes, "notes", "", "the new `notes`")
+	fs.StringVar(&opts.updates.Icon, "icon", "", "the new icon, a single `char`")
+	fs.StringVar(&opts.expires, "expires", "", "when the password expires: a `span or date`, or never")
+	fs.StringVar(&opts.tagTexts[0], "tags", "", "replace the tags with the comma-separated `tags`")
+	fs.StringVar(&opts.tagTexts[1], "add-tags", "", "add the comma-separated `tags`")
+	fs.StringVar(&opts.tagTexts[2], "remove-tags", "", "remove the comma-separated `tags`")
+	fs.BoolVar(&opts.tags.clear, "clear-tags", false, "remove every tag")
+	fs.BoolVar(&opts.exact, "exact", false, "match the name exactly, without suggesting similar ones")
+	return fs
+}
+
+// parseUpdateArgs reads the arguments of update. All positional
+// arguments form the name, and at least one field must change.
+func parseUpdateArgs(args []string) (*updateOptions, error) {
+	opts := &updateOptions{}
+	var rest []string
+	opts.password, opts.prompt, rest = takePasswordFlag(args)
+	fs := updateFlags(opts)
+	words, err := parseFlags(fs, rest)
+	if err != nil {
+		return nil, err
+	}
+	given := flagsGiven(fs)
+	if given["password"] {
+		return nil, fmt.Errorf("--password may be given once")
+	}
+	if err := opts.tags.parse(opts.tagTexts, given); err != nil {
+		return nil, err
+	}
+	if !opts.tags.empty() {
+		opts.changed = append(opts.changed, "tags")
+	}
+	for _, field := range []struct{ flag, label, value string }{
+		{"username", "username", opts.updates.Username},
+		{"url", "URL", opts.updates.URL},
+		{"notes", "notes", opts.updates.Notes},
+		{"icon", "icon", opts.updates.Icon},
+	} {
+		if field.value != "" {
+			opts.changed = append(opts.changed, field.label)
+		}
+	}
+	if opts.hasExpires = given["expires"]; opts.hasExpires {
+		if opts.expiresAt, err = parseExpires(opts.expires, time.Now()); err != nil {
+			return nil, err
+		}
+		opts.changed = append(opts.changed, "expiry")
+	}
+
+	if opts.name = strings.Join(words, " "); opts.name == "" {
+		return nil, fmt.Errorf("a name is needed")
+	}
+	if len(opts.changed) == 0 && opts.password == "" && !opts.prompt {
+		return nil, fmt.Errorf("nothing to change")
+	}
+	return opts, nil
+}
+
+// handleUpdate changes some fields of an existing entry, leaving the rest
+// as they are. --tags replaces the tags, warning about those it drops;
+// --add-tags and --remove-tags change them one by one and --clear-tags
+// removes them all.
+func handleUpdate() {
+	opts, err := parseUpdateArgs(os.Args[2:])
+	if err != nil {
+		usage := os.Args[0] + " update [--exact] <name> [--username <username>] [--password [<password>]] [--url <url>] [--notes <notes>] [--tags <tag1,tag2> | --add-tags <tags> | --remove-tags <tags> | --clear-tags] [--icon <char>] [--expires <span or date> | never]"
+		failFlags(updateFlags(&updateOptions{}), err, usage)
+	}
+	name, updates, password, tags := opts.name, &opts.updates, opts.password, opts.tags
+	changed, hasExpires := opts.changed, opts.hasExpires
+
+	// A missing entry is reported before the new password is asked for
+	self, err := entryID(name)
+	if err != nil {
+		printError(fmt.Errorf("failed to list passwords: %w", err))
+		exit(1)
+	}
+	if self == 0 && !opts.exact {
+		if name, err = findSimilar(name); err == nil {
+			self, err = entryID(name)
+		}
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+	}
+	if self == 0 {
+		printError(fmt.Errorf("%w: %s", storage.ErrEntryNotFound, name))
+		exit(1)
+	}
+
+	var removedTags []string
+	if !tags.empty() {
+		entry, secret, err := database.GetSecret(name)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		secret.Wipe()
+		updates.Tags, removedTags = tags.apply(entry.Tags)
+	}
+
+	if opts.prompt {
+		if password, err = readSecret("New password: "); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if password == "" {
+			fmt.Fprintln(os.Stderr, "Error: password cannot be empty")
+			exit(1)
+		}
+	}
+	if password != "" {
+		updates.Password = password
+		changed = append([]string{"password"}, changed...)
+	}
+
+	if err := validateUpdates(updates); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if updates.Password != "" {
+		warnReuse(updates.Password, self)
+	}
+
+	// The expiry is set on its own, and alone it leaves the change time
+	if !(hasExpires && len(changed) == 1) {
+		err = database.EditPassword(name, updates)
+	}
+	if err == nil && hasExpires {
+		err = database.SetExpiry(name, opts.expiresAt)
+	}
+	if errors.Is(err, storage.ErrEntryNotFound) {
+		printError(err)
+		exit(1)
+	}
+	if err != nil {
+		printError(fmt.Errorf("failed to update password: %w", err))
+		exit(1)
+	}
+
+	fmt.Printf("Updated %s of '%s'.\n", strings.Join(changed, ", "), name)
+	warnMisplacedSecrets(updatedFields(name, updates))
+	if !tags.empty() {
+		if tags.replace && len(removedTags) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: --tags replaced the tags of '%s', removing %s; --add-tags keeps the others\n", name, strings.Join(removedTags, ", "))
+		}
+		fmt.Printf("Tags: %s\n", formatTagSet(updates.Tags))
+	}
+	if updates.Password != "" {
+		queueHook(hooks.Rotate, name)
+	} else {
+		queueHook(hooks.Save, name)
+	}
+}
+
+// updatedFields returns the fields update set on the entry called name,
+// as an entry of its type, for checking what was just written
+func updatedFields(name string, updates *storage.PasswordEntry) *storage.PasswordEntry {
+	fields := &storage.PasswordEntry{Name: name, Username: updates.Username, URL: updates.URL, Notes: updates.Notes}
+	if entries, err := database.ListMetadata(); err == nil {
+		for _, entry := range entries {
+			if entry.Name == name {
+				fields.Type = entry.Type
+			}
+		}
+	}
+	return fields
+}
+
+// tagChange is how update changes the tags of an entry: replacing them
+// with set, clearing them, or adding and removing some
+type tagChange struct {
+	replace bool
+	set     []string
+	clear   bool
+	add     []string
+	remove  []string
+}
+
+// parse sets the change from the values of --tags, --add-tags and
+// --remove-tags, in that order, and the flags given; clear is set by
+// --clear-tags already. --tags and --clear-tags stand alone; a tag may
+// not be both added and removed.
+func (c *tagChange) parse(values [3]string, given map[string]bool) error {
+	for i, flag := range []string{"tags", "add-tags", "remove-tags"} {
+		if given[flag] && len(parseTags(values[i])) == 0 {
+			return fmt.Errorf("--%s needs at least one tag; --clear-tags removes them all", flag)
+		}
+	}
+	c.replace, c.set = given["tags"], parseTags(values[0])
+	c.add, c.remove = parseTags(values[1]), parseTags(values[2])
+
+	incremental := len(c.add) > 0 || len(c.remove) > 0
+	switch {
+	case c.replace && (c.clear || incremental):
+		return fmt.Errorf("--tags replaces all tags and cannot be combined with --add-tags, --remove-tags or --clear-tags")
+	case c.clear && incremental:
+		return fmt.Errorf("--clear-tags cannot be combined with --add-tags or --remove-tags")
+	}
+	for _, tag := range c.add {
+		if hasTag(c.remove, tag) {
+			return fmt.Errorf("tag %q cannot be both added and removed", tag)
+		}
+	}
+	return nil
+}
+
+// empty reports whether the change leaves the tags alone
+func (c tagChange) empty() bool {
+	return !c.replace && !c.clear && len(c.add) == 0 && len(c.remove) == 0
+}
+
+// apply returns the tags current has after the change, never nil, and the
+// tags of current it removes. Tags are matched ignoring case, so adding a
+// tag the entry has in another case keeps the one it has.
+func (c tagChange) apply(current []string) (tags, removed []string) {
+	tags = []string{}
+	var kept []string
+	switch {
+	case c.clear:
+	case c.replace:
+		kept = c.set
+	default:
+		for _, tag := range current {
+			if !hasTag(c.remove, tag) {
+				kept = append(kept, tag)
+			}
+		}
+		kept = append(kept, c.add...)
+	}
+	for _, tag := range kept {
+		if !hasTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range current {
+		if !hasTag(tags, tag) {
+			removed = append(removed, tag)
+		}
+	}
+	return tags, removed
+}
+
+// hasTag reports whether tags holds tag, ignoring case
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTagSet lists tags for the report of an update
+func formatTagSet(tags []string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	return strings.Join(tags, ", ")
+}
+
+// takePasswordFlag removes --password from the arguments of update. The
+// value may be left out, or be another flag, to be asked for without
+// echo; --password=<value> passes one starting with a dash.
+func takePasswordFlag(args []string) (password string, prompt bool, rest []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--password=") {
+			rest = append(append(rest, args[:i]...), args[i+1:]...)
+			return strings.TrimPrefix(arg, "--password="), false, rest
+		}
+		if arg != "--password" {
+			continue
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			rest = append(append(rest, args[:i]...), args[i+2:]...)
+			return args[i+1], false, rest
+		}
+		rest = append(append(rest, args[:i]...), args[i+1:]...)
+		return "", true, rest
+	}
+	return "", false, args
+}
+
+// validateUpdates checks the fields an update sets, by the rules
+// validateEntry applies to whole entries
+func validateUpdates(updates *storage.PasswordEntry) error {
+	if updates.Password != "" {
+		if err := validatePassword(updates.Password); err != nil {
+			return err
+		}
+	}
+	if err := validateURL(updates.URL); err != nil {
+		return err
+	}
+	if updates.Icon != "" && !tui.ValidIcon(updates.Icon) {
+		return fmt.Errorf("icon must be a single character, such as an emoji")
+	}
+	return validateTags(updates.Tags)
+}
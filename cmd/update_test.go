@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTakePasswordFlag(t *testing.T) {
+	tests := []struct {
+		args     []string
+		password string
+		prompt   bool
+		wantRest []string
+	}{
+		{[]string{"gmail", "--password", "s3cret"}, "s3cret", false, []string{"gmail"}},
+		{[]string{"gmail", "--password"}, "", true, []string{"gmail"}},
+		{[]string{"gmail", "--password", "--username", "me"}, "", true, []string{"gmail", "--username", "me"}},
+		{[]string{"gmail", "--password=-dash"}, "-dash", false, []string{"gmail"}},
+		{[]string{"gmail", "--username", "me"}, "", false, []string{"gmail", "--username", "me"}},
+		{[]string{"--", "--password"}, "", false, []string{"--", "--password"}},
+	}
+
+	for _, tt := range tests {
+		password, prompt, rest := takePasswordFlag(tt.args)
+		if password != tt.password || prompt != tt.prompt || !reflect.DeepEqual(rest, tt.wantRest) {
+			t.Errorf("takePasswordFlag(%q) = %q, %t, %q; want %q, %t, %q",
+				tt.args, password, prompt, rest, tt.password, tt.prompt, tt.wantRest)
+		}
+	}
+}
+
+func TestTagChange(t *testing.T) {
+	current := []string{"work", "Email", "old stuff"}
+	tests := []struct {
+		args    []string
+		tags    []string
+		removed []string
+	}{
+		{[]string{"--tags", "a, b"}, []string{"a", "b"}, []string{"work", "Email", "old stuff"}},
+		{[]string{"--tags", "WORK,new"}, []string{"WORK", "new"}, []string{"Email", "old stuff"}},
+		{[]string{"--add-tags", "new,  spaced   out "}, []string{"work", "Email", "old stuff", "new", "spaced out"}, nil},
+		{[]string{"--add-tags", "email"}, []string{"work", "Email", "old stuff"}, nil},
+		{[]string{"--remove-tags", "EMAIL,old   stuff,missing"}, []string{"work"}, []string{"Email", "old stuff"}},
+		{[]string{"--add-tags", "new", "--remove-tags", "work"}, []string{"Email", "old stuff", "new"}, []string{"work"}},
+		{[]string{"--clear-tags"}, []string{}, []string{"work", "Email", "old stuff"}},
+		{[]string{"--tags", "a,a,A"}, []string{"a"}, []string{"work", "Email", "old stuff"}},
+	}
+	for _, tt := range tests {
+		opts, err := parseUpdateArgs(append([]string{"gmail"}, tt.args...))
+		if err != nil {
+			t.Errorf("parseUpdateArgs(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if opts.name != "gmail" {
+			t.Errorf("parseUpdateArgs(%q) took the name %q", tt.args, opts.name)
+		}
+		tags, removed := opts.tags.apply(current)
+		if !reflect.DeepEqual(tags, tt.tags) || !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("%q: got tags %q, removed %q; want %q, %q", tt.args, tags, removed, tt.tags, tt.removed)
+		}
+	}
+
+	if opts, err := parseUpdateArgs([]string{"gmail", "--username", "me"}); err != nil || !opts.tags.empty() {
+		t.Errorf("Expected no tag change, got %+v, %v", opts, err)
+	}
+}
+
+func TestTagChangeErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--add-tags", "work,Mail", "--remove-tags", "mail"}, `tag "Mail" cannot be both added and removed`},
+		{[]string{"--tags", "a", "--add-tags", "b"}, "--tags replaces all tags and cannot be combined"},
+		{[]string{"--tags", "a", "--clear-tags"}, "--tags replaces all tags and cannot be combined"},
+		{[]string{"--clear-tags", "--remove-tags", "b"}, "--clear-tags cannot be combined with --add-tags or --remove-tags"},
+		{[]string{"--tags", " , "}, "--tags needs at least one tag"},
+		{[]string{"--add-tags"}, "a value is needed for --add-tags"},
+	}
+	for _, tt := range tests {
+		_, err := parseUpdateArgs(append([]string{"gmail"}, tt.args...))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("parseUpdateArgs(%q) = %v, want an error starting with %q", tt.args, err, tt.want)
+		}
+	}
+}
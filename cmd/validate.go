@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"password-manager/internal/storage"
+	"password-manager/internal/tui"
+)
+
+// validateEntry checks an entry before it is saved. Every path that
+// creates entries (save, add, note add) goes through it so the rules
+// cannot drift. Notes need a body instead of a password.
+func validateEntry(entry *storage.PasswordEntry) error {
+	if err := validateName(entry.Name); err != nil {
+		return err
+	}
+	if entry.IsNote() {
+		if strings.TrimSpace(entry.Notes) == "" {
+			return fmt.Errorf("note cannot be empty")
+		}
+	} else if err := validatePassword(entry.Password); err != nil {
+		return err
+	}
+	if err := validateURL(entry.URL); err != nil {
+		return err
+	}
+	if entry.Icon != "" && !tui.ValidIcon(entry.Icon) {
+		return fmt.Errorf("icon must be a single character, such as an emoji")
+	}
+	return validateTags(entry.Tags)
+}
+
+// validateName checks an entry name
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if strings.TrimSpace(name) != name {
+		return fmt.Errorf("name cannot start or end with whitespace")
+	}
+	return nil
+}
+
+// validatePassword checks an entry password
+func validatePassword(password string) error {
+	if password == "" {
+		return fmt.Errorf("password cannot be empty")
+	}
+	return nil
+}
+
+// validateURL checks an optional entry URL
+func validateURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if strings.ContainsAny(raw, " \t\n") {
+		return fmt.Errorf("URL cannot contain whitespace")
+	}
+	if _, err := url.Parse(raw); err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	return nil
+}
+
+// validateTags checks entry tags
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" {
+			return fmt.Errorf("tags cannot be empty")
+		}
+		if strings.Contains(tag, ",") {
+			return fmt.Errorf("tag %q cannot contain a comma", tag)
+		}
+	}
+	return nil
+}
+
+// parseTags splits a comma-separated tag list into normalized tags,
+// dropping empty items
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = normalizeTag(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// normalizeTag trims a tag and collapses the whitespace inside it to
+// single spaces, so "  work   stuff " and "work stuff" are one tag. Case
+// is kept; tags are compared ignoring it.
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(tag), " ")
+}
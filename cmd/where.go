@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"password-manager/internal/query"
+	"password-manager/internal/storage"
+)
+
+// parseWhere parses the query of --where, nil when the flag was not
+// given. Syntax errors point at the offending spot.
+func parseWhere(expr string, given bool) (*query.Query, error) {
+	if !given {
+		return nil, nil
+	}
+	q, err := query.Parse(expr)
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		pointer := strings.ReplaceAll(qerr.Pointer(expr), "\n", "\n  ")
+		return nil, fmt.Errorf("--where: %v\n  %s", err, pointer)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("--where: %w", err)
+	}
+	return q, nil
+}
+
+// applyWhereMatches returns the search matches whose entries match q, or
+// all of them for a nil query
+func applyWhereMatches(q *query.Query, matches []storage.SearchMatch) ([]storage.SearchMatch, error) {
+	if q == nil {
+		return matches, nil
+	}
+	entries := make([]*storage.PasswordEntry, len(matches))
+	for i, match := range matches {
+		entries[i] = match.Entry
+	}
+	kept, err := applyWhere(q, entries)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[*storage.PasswordEntry]bool, len(kept))
+	for _, entry := range kept {
+		keep[entry] = true
+	}
+	var out []storage.SearchMatch
+	for _, match := range matches {
+		if keep[match.Entry] {
+			out = append(out, match)
+		}
+	}
+	return out, nil
+}
+
+// applyWhere returns the entries matching q, or all of them for a nil
+// query. Cached strength grades are only loaded if the query needs them.
+func applyWhere(q *query.Query, entries []*storage.PasswordEntry) ([]*storage.PasswordEntry, error) {
+	if q == nil {
+		return entries, nil
+	}
+	var grades map[int64]storage.StrengthGrade
+	if q.NeedsPasswords() {
+		var err error
+		if grades, err = database.StrengthGrades(); err != nil {
+			return nil, err
+		}
+	}
+	return q.Apply(entries, grades), nil
+}
+
+// queryEntries lists the entries matching q for commands that only need
+// metadata. Passwords are decrypted only when a term of q needs them.
+func queryEntries(q *query.Query) ([]*storage.PasswordEntry, error) {
+	list := database.ListMetadata
+	if q.NeedsPasswords() {
+		list = database.ListPasswords
+	}
+	entries, err := list()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passwords: %w", err)
+	}
+	return applyWhere(q, entries)
+}
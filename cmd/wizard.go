@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+// wizardBack is typed at any step to return to the previous one
+const wizardBack = "<"
+
+var (
+	// errWizardBack signals that the user asked to go back a step
+	errWizardBack = errors.New("back")
+	// errWizardAborted is returned when the user declines the summary
+	errWizardAborted = errors.New("entry creation cancelled")
+)
+
+// wizard walks the user through creating an entry step by step
+type wizard struct {
+	prompter  Prompter
+	out       io.Writer
+	usernames []string // suggestions, most used first
+	tags      []string // existing tags for completion
+	taken     map[string]bool
+	generate  func() (string, error)
+	editNotes func(initial string) (string, error)
+
+	entry storage.PasswordEntry
+}
+
+// newWizard prepares a wizard with suggestions drawn from existing entries
+func newWizard(prompter Prompter, out io.Writer, existing []*storage.PasswordEntry) *wizard {
+	taken := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		taken[entry.Name] = true
+	}
+	return &wizard{
+		prompter:  prompter,
+		out:       out,
+		usernames: usernameSuggestions(existing),
+		tags:      existingTags(existing),
+		taken:     taken,
+		generate: func() (string, error) {
+			return generator.GeneratePassword(generator.DefaultConfig())
+		},
+		editNotes: editInEditor,
+	}
+}
+
+// run executes the steps and returns the confirmed entry
+func (w *wizard) run() (*storage.PasswordEntry, error) {
+	steps := []func() error{
+		w.askName,
+		w.askUsername,
+		w.askPassword,
+		w.askURL,
+		w.askTags,
+		w.askNotes,
+		w.confirm,
+	}
+
+	fmt.Fprintf(w.out, "Creating a new entry. Type %q at any prompt to go back.\n\n", wizardBack)
+	for i := 0; i < len(steps); {
+		err := steps[i]()
+		switch {
+		case err == errWizardBack:
+			if i > 0 {
+				i--
+			}
+		case err != nil:
+			return nil, err
+		default:
+			i++
+		}
+	}
+
+	entry := w.entry
+	return &entry, nil
+}
+
+// ask prompts until the answer passes validate. Typing "<" goes back.
+func (w *wizard) ask(label string, secret bool, validate func(string) error) (string, error) {
+	for {
+		var answer string
+		var err error
+		if secret {
+			answer, err = w.prompter.AskSecret(label)
+		} else {
+			answer, err = w.prompter.Ask(label)
+		}
+		if err != nil {
+			return "", err
+		}
+		if answer == wizardBack {
+			return "", errWizardBack
+		}
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				fmt.Fprintf(w.out, "  %v\n", err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+func (w *wizard) askName() error {
+	name, err := w.ask("Name: ", false, func(name string) error {
+		if w.taken[name] {
+			return fmt.Errorf("an entry called %s already exists; use update to change it", name)
+		}
+		return validateName(name)
+	})
+	if err != nil {
+		return err
+	}
+	w.entry.Name = name
+	return nil
+}
+
+func (w *wizard) askUsername() error {
+	if len(w.usernames) > 0 {
+		fmt.Fprintln(w.out, "Suggestions:")
+		for i, username := range w.usernames {
+			fmt.Fprintf(w.out, "  %d) %s\n", i+1, username)
+		}
+	}
+
+	answer, err := w.ask("Username (number picks a suggestion, empty for none): ", false, nil)
+	if err != nil {
+		return err
+	}
+	if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(w.usernames) {
+		answer = w.usernames[n-1]
+	}
+	w.entry.Username = answer
+	return nil
+}
+
+func (w *wizard) askPassword() error {
+	for {
+		choice, err := w.ask("Password: (g)enerate or (t)ype? [g]: ", false, nil)
+		if err != nil {
+			return err
+		}
+
+		var password string
+		switch strings.ToLower(choice) {
+		case "", "g", "generate":
+			password, err = w.generate()
+			if err != nil {
+				fmt.Fprintf(w.out, "  could not generate a password: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(w.out, "  Generated: %s\n", password)
+		case "t", "type":
+			password, err = w.ask("Enter password: ", true, validatePassword)
+			if err == errWizardBack {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintln(w.out, "  please answer g or t")
+			continue
+		}
+
+		analysis := generator.Analyze(password)
+		fmt.Fprintf(w.out, "  Strength: %s %s\n", strengthMeter(analysis.Score), analysis.Level)
+
+		keep, err := w.ask("Use this password? (Y/n): ", false, nil)
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(keep) == "n" {
+			continue
+		}
+		w.entry.Password = password
+		return nil
+	}
+}
+
+func (w *wizard) askURL() error {
+	url, err := w.ask("URL (empty for none): ", false, validateURL)
+	if err != nil {
+		return err
+	}
+	w.entry.URL = url
+	return nil
+}
+
+func (w *wizard) askTags() error {
+	if len(w.tags) > 0 {
+		fmt.Fprintf(w.out, "Existing tags: %s\n", strings.Join(w.tags, ", "))
+	}
+
+	for {
+		answer, err := w.ask("Tags (comma-separated, end a tag with * to complete it): ", false, nil)
+		if err != nil {
+			return err
+		}
+		tags, err := completeTags(parseTags(answer), w.tags)
+		if err == nil {
+			err = validateTags(tags)
+		}
+		if err != nil {
+			fmt.Fprintf(w.out, "  %v\n", err)
+			continue
+		}
+		w.entry.Tags = tags
+		return nil
+	}
+}
+
+func (w *wizard) askNotes() error {
+	for {
+		choice, err := w.ask("Notes: (e)dit in $EDITOR, (t)ype a line or (s)kip? [s]: ", false, nil)
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(choice) {
+		case "", "s", "skip":
+			return nil
+		case "t", "type":
+			notes, err := w.ask("Notes: ", false, nil)
+			if err == errWizardBack {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			w.entry.Notes = notes
+			return nil
+		case "e", "edit":
+			notes, err := w.editNotes(w.entry.Notes)
+			if err != nil {
+				fmt.Fprintf(w.out, "  could not edit notes: %v\n", err)
+				continue
+			}
+			w.entry.Notes = notes
+			return nil
+		default:
+			fmt.Fprintln(w.out, "  please answer e, t or s")
+		}
+	}
+}
+
+func (w *wizard) confirm() error {
+	fmt.Fprintln(w.out)
+	fmt.Fprintln(w.out, "Summary:")
+	fmt.Fprintf(w.out, "  Name:     %s\n", w.entry.Name)
+	fmt.Fprintf(w.out, "  Username: %s\n", w.entry.Username)
+	fmt.Fprintf(w.out, "  Password: %s\n", strings.Repeat("*", 8))
+	fmt.Fprintf(w.out, "  URL:      %s\n", w.entry.URL)
+	fmt.Fprintf(w.out, "  Tags:     %s\n", strings.Join(w.entry.Tags, ", "))
+	if w.entry.Notes != "" {
+		fmt.Fprintf(w.out, "  Notes:    %d characters\n", len(w.entry.Notes))
+	}
+
+	for {
+		answer, err := w.ask("Save this entry? (y/n): ", false, nil)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return validateEntry(&w.entry)
+		case "n", "no":
+			return errWizardAborted
+		}
+	}
+}
+
+// strengthMeter renders a strength score as a bar of generator.MaxScore
+func strengthMeter(score int) string {
+	if score > generator.MaxScore {
+		score = generator.MaxScore
+	}
+	return "[" + strings.Repeat("#", score) + strings.Repeat("-", generator.MaxScore-score) + "]"
+}
+
+// completeTags expands tags ending in "*" to the single existing tag they
+// prefix
+func completeTags(tags, existing []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !strings.HasSuffix(tag, "*") {
+			result = append(result, tag)
+			continue
+		}
+
+		prefix := strings.ToLower(strings.TrimSuffix(tag, "*"))
+		var matches []string
+		for _, candidate := range existing {
+			if strings.HasPrefix(strings.ToLower(candidate), prefix) {
+				matches = append(matches, candidate)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no existing tag starts with %q", prefix)
+		case 1:
+			result = append(result, matches[0])
+		default:
+			return nil, fmt.Errorf("%q matches several tags: %s", prefix, strings.Join(matches, ", "))
+		}
+	}
+	return result, nil
+}
+
+// usernameSuggestions returns existing usernames, most used first
+func usernameSuggestions(entries []*storage.PasswordEntry) []string {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		if entry.Username != "" {
+			counts[entry.Username]++
+		}
+	}
+
+	usernames := make([]string, 0, len(counts))
+	for username := range counts {
+		usernames = append(usernames, username)
+	}
+	sort.Slice(usernames, func(i, j int) bool {
+		if counts[usernames[i]] != counts[usernames[j]] {
+			return counts[usernames[i]] > counts[usernames[j]]
+		}
+		return usernames[i] < usernames[j]
+	})
+
+	if len(usernames) > 5 {
+		usernames = usernames[:5]
+	}
+	return usernames
+}
+
+// existingTags returns the sorted set of tags used by entries
+func existingTags(entries []*storage.PasswordEntry) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, entry := range entries {
+		for _, tag := range entry.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// editInEditor opens $EDITOR on a private temporary file seeded with
+// initial and returns the edited text
+func editInEditor(initial string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := tmpfile.Create("pm-notes-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+	defer tmpfile.Remove(path)
+
+	if _, err := file.WriteString(initial); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	file.Close()
+
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read temp file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
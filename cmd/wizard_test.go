@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+// scriptedPrompter answers prompts from a fixed script
+type scriptedPrompter struct {
+	answers []string
+	asked   []string
+}
+
+func (p *scriptedPrompter) next(label string) (string, error) {
+	p.asked = append(p.asked, label)
+	if len(p.answers) == 0 {
+		return "", fmt.Errorf("script exhausted at prompt %q", label)
+	}
+	answer := p.answers[0]
+	p.answers = p.answers[1:]
+	return answer, nil
+}
+
+func (p *scriptedPrompter) Ask(label string) (string, error)       { return p.next(label) }
+func (p *scriptedPrompter) AskSecret(label string) (string, error) { return p.next(label) }
+
+func newTestWizard(answers ...string) (*wizard, *scriptedPrompter) {
+	prompter := &scriptedPrompter{answers: answers}
+	existing := []*storage.PasswordEntry{
+		{Name: "a", Username: "ops@corp.com", Tags: []string{"work", "infra"}},
+		{Name: "b", Username: "ops@corp.com", Tags: []string{"work"}},
+		{Name: "c", Username: "me@home.net", Tags: []string{"personal"}},
+	}
+	w := newWizard(prompter, &bytes.Buffer{}, existing)
+	w.generate = func() (string, error) { return "Gen3rated!Pass", nil }
+	w.editNotes = func(initial string) (string, error) { return "edited notes", nil }
+	return w, prompter
+}
+
+func TestWizardTypedEntry(t *testing.T) {
+	w, _ := newTestWizard(
+		"aws-console", // name
+		"1",           // username suggestion: ops@corp.com
+		"t",           // type password
+		"hunter2hunter2",
+		"y",
+		"https://console.aws.amazon.com",
+		"wor*, aws",
+		"t",
+		"root account",
+		"y",
+	)
+
+	entry, err := w.run()
+	if err != nil {
+		t.Fatalf("Wizard failed: %v", err)
+	}
+	if entry.Name != "aws-console" || entry.Username != "ops@corp.com" || entry.Password != "hunter2hunter2" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if entry.URL != "https://console.aws.amazon.com" || entry.Notes != "root account" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if strings.Join(entry.Tags, ",") != "work,aws" {
+		t.Errorf("Expected tags [work aws], got %v", entry.Tags)
+	}
+}
+
+func TestWizardGeneratedPasswordAndEditor(t *testing.T) {
+	w, _ := newTestWizard(
+		"github",
+		"dev",
+		"", // generate is the default
+		"",
+		"",
+		"",
+		"e",
+		"yes",
+	)
+
+	entry, err := w.run()
+	if err != nil {
+		t.Fatalf("Wizard failed: %v", err)
+	}
+	if entry.Password != "Gen3rated!Pass" {
+		t.Errorf("Expected generated password, got %q", entry.Password)
+	}
+	if entry.Notes != "edited notes" {
+		t.Errorf("Expected edited notes, got %q", entry.Notes)
+	}
+	if len(entry.Tags) != 0 {
+		t.Errorf("Expected no tags, got %v", entry.Tags)
+	}
+}
+
+func TestWizardGoBack(t *testing.T) {
+	w, _ := newTestWizard(
+		"first-name",
+		"<", // back to name
+		"second-name",
+		"user",
+		"g",
+		"y",
+		"<", // back from URL to password
+		"t",
+		"typed-password",
+		"y",
+		"",
+		"",
+		"s",
+		"y",
+	)
+
+	entry, err := w.run()
+	if err != nil {
+		t.Fatalf("Wizard failed: %v", err)
+	}
+	if entry.Name != "second-name" {
+		t.Errorf("Expected name to be re-entered, got %q", entry.Name)
+	}
+	if entry.Password != "typed-password" {
+		t.Errorf("Expected password to be re-entered, got %q", entry.Password)
+	}
+}
+
+func TestWizardValidationReprompts(t *testing.T) {
+	w, prompter := newTestWizard(
+		"   ",         // invalid name
+		" padded",     // invalid name
+		"b",           // name is taken
+		"valid",       //
+		"",            // no username
+		"t",           //
+		"",            // empty password is rejected
+		"secret",      //
+		"y",           //
+		"has a space", // invalid URL
+		"",            //
+		"nomatch*",    // completion without match
+		"",            //
+		"s",           //
+		"y",           //
+	)
+
+	entry, err := w.run()
+	if err != nil {
+		t.Fatalf("Wizard failed: %v", err)
+	}
+	if entry.Name != "valid" || entry.Password != "secret" || entry.URL != "" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if len(prompter.answers) != 0 {
+		t.Errorf("Expected all answers to be consumed, %d left", len(prompter.answers))
+	}
+}
+
+func TestWizardAbort(t *testing.T) {
+	w, _ := newTestWizard("name", "", "g", "y", "", "", "s", "n")
+
+	if _, err := w.run(); err != errWizardAborted {
+		t.Errorf("Expected errWizardAborted, got %v", err)
+	}
+}
+
+func TestCompleteTags(t *testing.T) {
+	existing := []string{"infra", "personal", "work", "workshop"}
+
+	got, err := completeTags([]string{"inf*", "new"}, existing)
+	if err != nil || strings.Join(got, ",") != "infra,new" {
+		t.Errorf("Expected [infra new], got %v (%v)", got, err)
+	}
+	if _, err := completeTags([]string{"wor*"}, existing); err == nil {
+		t.Error("Expected error for ambiguous completion")
+	}
+	if _, err := completeTags([]string{"zzz*"}, existing); err == nil {
+		t.Error("Expected error for completion without match")
+	}
+}
+
+func TestUsernameSuggestions(t *testing.T) {
+	entries := []*storage.PasswordEntry{
+		{Username: "b@x"}, {Username: "a@x"}, {Username: "b@x"}, {Username: ""},
+	}
+	got := usernameSuggestions(entries)
+	if strings.Join(got, ",") != "b@x,a@x" {
+		t.Errorf("Expected most used first, got %v", got)
+	}
+}
@@ -25,7 +25,7 @@ if %errorlevel% neq 0 (
 )
 
 echo [3] Building project...
-go build -o password-manager.exe cmd/main.go
+go build -o password-manager.exe ./cmd
 if %errorlevel% neq 0 (
     echo ERROR: Build failed!
     pause
@@ -59,16 +59,19 @@ echo.
 echo 1. Generate a password:
 echo    password-manager.exe generate --length 20
 echo.
-echo 2. Save a password:
+echo 2. Create your vault (once):
+echo    password-manager.exe init
+echo.
+echo 3. Save a password:
 echo    password-manager.exe save gmail --username user@gmail.com --password mypass
 echo.
-echo 3. Get a password:
+echo 4. Get a password:
 echo    password-manager.exe get gmail
 echo.
-echo 4. List all passwords:
+echo 5. List all passwords:
 echo    password-manager.exe list
 echo.
-echo 5. Analyze password strength:
+echo 6. Analyze password strength:
 echo    password-manager.exe analyze mypassword123
 echo.
 
@@ -33,7 +33,7 @@ try {
 # Build project
 Write-Host "[3] Building project..." -ForegroundColor Yellow
 try {
-    go build -o password-manager.exe cmd/main.go
+    go build -o password-manager.exe ./cmd
     Write-Host "✓ Project built successfully" -ForegroundColor Green
 } catch {
     Write-Host "✗ ERROR: Build failed!" -ForegroundColor Red
@@ -75,19 +75,23 @@ Write-Host "1. Generate a password:" -ForegroundColor White
 Write-Host "   .\password-manager.exe generate --length 20" -ForegroundColor Gray
 Write-Host ""
 
-Write-Host "2. Save a password:" -ForegroundColor White
+Write-Host "2. Create your vault (once):" -ForegroundColor White
+Write-Host "   .\password-manager.exe init" -ForegroundColor Gray
+Write-Host ""
+
+Write-Host "3. Save a password:" -ForegroundColor White
 Write-Host "   .\password-manager.exe save gmail --username user@gmail.com --password mypass" -ForegroundColor Gray
 Write-Host ""
 
-Write-Host "3. Get a password:" -ForegroundColor White
+Write-Host "4. Get a password:" -ForegroundColor White
 Write-Host "   .\password-manager.exe get gmail" -ForegroundColor Gray
 Write-Host ""
 
-Write-Host "4. List all passwords:" -ForegroundColor White
+Write-Host "5. List all passwords:" -ForegroundColor White
 Write-Host "   .\password-manager.exe list" -ForegroundColor Gray
 Write-Host ""
 
-Write-Host "5. Analyze password strength:" -ForegroundColor White
+Write-Host "6. Analyze password strength:" -ForegroundColor White
 Write-Host "   .\password-manager.exe analyze mypassword123" -ForegroundColor Gray
 Write-Host ""
 
@@ -3,6 +3,13 @@ module password-manager
 go 1.21
 
 require (
-	golang.org/x/crypto v0.17.0
-	golang.org/x/term v0.15.0
+	filippo.io/age v1.2.1
+	github.com/BurntSushi/toml v1.4.0
+	github.com/mattn/go-sqlite3 v1.14.52
+	golang.org/x/crypto v0.24.0
+	golang.org/x/net v0.26.0
+	golang.org/x/sys v0.21.0
+	golang.org/x/term v0.21.0
+	golang.org/x/text v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,166 @@
+package appversion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Current is the version of this build
+const Current = "1.3.0"
+
+// Version is a semantic version, MAJOR.MINOR.PATCH with an optional
+// pre-release. Build metadata is accepted but plays no part in ordering,
+// so it is not kept.
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the pre-release, such as "rc.1"; empty for a release
+	Pre string
+}
+
+// Parse reads a semantic version as described at semver.org. A leading
+// "v" is allowed, as in "v1.3.0".
+func Parse(s string) (Version, error) {
+	rest := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		if !validIdentifiers(rest[i+1:], false) {
+			return Version{}, fmt.Errorf("invalid version %q: bad build metadata", s)
+		}
+		rest = rest[:i]
+	}
+	var v Version
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		v.Pre = rest[i+1:]
+		if !validIdentifiers(v.Pre, true) {
+			return Version{}, fmt.Errorf("invalid version %q: bad pre-release", s)
+		}
+		rest = rest[:i]
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: want MAJOR.MINOR.PATCH", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, ok := number(part)
+		if !ok {
+			return Version{}, fmt.Errorf("invalid version %q: %q is not a number", s, part)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// MustParse is Parse for versions known to be valid, and panics otherwise
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// String formats v without a leading "v"
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v orders before, with or after w. A
+// pre-release orders before its release.
+func (v Version) Compare(w Version) int {
+	for _, d := range [][2]int{{v.Major, w.Major}, {v.Minor, w.Minor}, {v.Patch, w.Patch}} {
+		if d[0] != d[1] {
+			return sign(d[0] - d[1])
+		}
+	}
+	switch {
+	case v.Pre == w.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case w.Pre == "":
+		return -1
+	}
+
+	// Identifiers are compared in turn: numbers numerically and before
+	// any alphanumeric identifier, others in ASCII order. When all shared
+	// ones are equal, the longer pre-release is the later.
+	a, b := strings.Split(v.Pre, "."), strings.Split(w.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		m, mNum := number(a[i])
+		n, nNum := number(b[i])
+		switch {
+		case mNum && nNum:
+			if m != n {
+				return sign(m - n)
+			}
+		case mNum:
+			return -1
+		case nNum:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(a) - len(b))
+}
+
+// Less reports whether v orders before w
+func (v Version) Less(w Version) bool {
+	return v.Compare(w) < 0
+}
+
+// number parses a numeric identifier, which has no leading zeros
+func number(s string) (int, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// validIdentifiers checks dot-separated identifiers of [0-9A-Za-z-];
+// numeric pre-release identifiers must not have leading zeros
+func validIdentifiers(s string, pre bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, r := range id {
+			switch {
+			case r >= '0' && r <= '9':
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if pre && numeric && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package appversion
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"1.3.0", Version{1, 3, 0, ""}},
+		{"v1.3.0", Version{1, 3, 0, ""}},
+		{"10.20.30", Version{10, 20, 30, ""}},
+		{"1.0.0-rc.1", Version{1, 0, 0, "rc.1"}},
+		{"1.0.0-alpha-beta+build.7", Version{1, 0, 0, "alpha-beta"}},
+		{"2.0.0+20240101", Version{2, 0, 0, ""}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if err != nil || got != test.want {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v", test.in, got, err, test.want)
+		}
+	}
+
+	for _, in := range []string{"", "1", "1.3", "1.3.0.1", "01.3.0", "1.3.x", "-1.3.0", "1.3.0-", "1.3.0-rc..1", "1.3.0-01", "1.3.0+", "1.3.0-rc_1"} {
+		if v, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %+v, expected an error", in, v)
+		}
+	}
+
+	if got := MustParse("v1.3.0-rc.1+x").String(); got != "1.3.0-rc.1" {
+		t.Errorf("String = %q", got)
+	}
+	if _, err := Parse(Current); err != nil {
+		t.Errorf("Current is not a valid version: %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// The precedence example of semver.org, in ascending order
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := MustParse(a).Compare(MustParse(b)); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+
+	if MustParse("1.0.0+a").Compare(MustParse("1.0.0+b")) != 0 {
+		t.Error("Expected build metadata to be ignored")
+	}
+	if !MustParse("1.2.0").Less(MustParse("1.10.0")) {
+		t.Error("Expected numeric rather than string ordering")
+	}
+}
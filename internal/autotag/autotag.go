@@ -0,0 +1,216 @@
+package autotag
+
+import (
+	"fmt"
+	"strings"
+
+	"password-manager/internal/config"
+	"password-manager/internal/query"
+	"password-manager/internal/storage"
+)
+
+// Rule adds and removes tags on the entries its query matches
+type Rule struct {
+	Match  *query.Query
+	Add    []string
+	Remove []string
+}
+
+// Rules are the automatic tagging rules from the config file. They
+// implement storage.Tagger, so entries are tagged as they are saved.
+type Rules []*Rule
+
+// Compile parses the match expressions of the configured rules. Rules
+// may not test strength, which needs the password and so could not be
+// re-applied from metadata.
+func Compile(configured []config.AutoTagRule) (Rules, error) {
+	rules := make(Rules, 0, len(configured))
+	for i, c := range configured {
+		if strings.TrimSpace(c.Match) == "" {
+			return nil, fmt.Errorf("auto_tag[%d]: match is required", i)
+		}
+		q, err := query.Parse(c.Match)
+		if err != nil {
+			return nil, fmt.Errorf("auto_tag[%d]: invalid match %q: %w", i, c.Match, err)
+		}
+		if q.NeedsPasswords() {
+			return nil, fmt.Errorf("auto_tag[%d]: match cannot test strength", i)
+		}
+		rule := &Rule{Match: q, Add: cleanTags(c.AddTags), Remove: cleanTags(c.RemoveTags)}
+		if len(rule.Add) == 0 && len(rule.Remove) == 0 {
+			return nil, fmt.Errorf("auto_tag[%d]: add_tags or remove_tags is required", i)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func cleanTags(tags []string) []string {
+	var cleaned []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	return cleaned
+}
+
+// Change is what applying the rules did to one entry's tags
+type Change struct {
+	Name    string
+	Added   []string
+	Removed []string
+}
+
+// Changed reports whether any tag was added or removed
+func (c *Change) Changed() bool {
+	return len(c.Added) > 0 || len(c.Removed) > 0
+}
+
+// Apply updates entry's tags until the rules no longer change them, so a
+// rule may match on a tag another rule adds. Each pass evaluates every
+// rule against the tags as they were at its start; when one matching
+// rule adds a tag and another removes it, the removal wins. Tags are
+// compared case-insensitively and only ever removed by remove_tags.
+// Applying the rules again to the result changes nothing. Rules that
+// keep undoing each other are an error, and the tags are left as they
+// were.
+func (r Rules) Apply(entry *storage.PasswordEntry) (*Change, error) {
+	original := entry.Tags
+	tags := append([]string(nil), original...)
+	for pass := 0; ; pass++ {
+		if pass > len(r) {
+			entry.Tags = original
+			return nil, fmt.Errorf("auto_tag rules do not settle on the tags of %s; check for rules undoing each other", entry.Name)
+		}
+		entry.Tags = tags
+		next := r.pass(entry)
+		if sameTags(next, tags) {
+			break
+		}
+		tags = next
+	}
+	entry.Tags = tags
+	if sameTags(tags, original) {
+		entry.Tags = original
+	}
+
+	return Diff(entry.Name, original, tags), nil
+}
+
+// Diff describes the change from the tags before to the tags after
+func Diff(name string, before, after []string) *Change {
+	return &Change{
+		Name:    name,
+		Added:   missingFrom(before, after),
+		Removed: missingFrom(after, before),
+	}
+}
+
+// String lists the change as +added -removed
+func (c *Change) String() string {
+	var parts []string
+	for _, tag := range c.Added {
+		parts = append(parts, "+"+tag)
+	}
+	for _, tag := range c.Removed {
+		parts = append(parts, "-"+tag)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Store is the part of a vault Retag works on
+type Store interface {
+	ListMetadata() ([]*storage.PasswordEntry, error)
+	SetTags(name string, tags []string) error
+}
+
+// Retag applies the rules to every entry in vault and, unless dryRun,
+// stores the tags that changed. It returns the changed entries; entries
+// the rules do not settle on are left alone and reported in failed.
+func (r Rules) Retag(vault Store, dryRun bool) (changes []*Change, failed []error, err error) {
+	entries, err := vault.ListMetadata()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		change, err := r.Apply(entry)
+		if err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		if !change.Changed() {
+			continue
+		}
+		if !dryRun {
+			if err := vault.SetTags(entry.Name, entry.Tags); err != nil {
+				return changes, failed, fmt.Errorf("%s: %w", entry.Name, err)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, failed, nil
+}
+
+// pass applies every rule matching entry once and returns the new tags
+func (r Rules) pass(entry *storage.PasswordEntry) []string {
+	var add, remove []string
+	for _, rule := range r {
+		if rule.Match.Match(entry, nil) {
+			add = append(add, rule.Add...)
+			remove = append(remove, rule.Remove...)
+		}
+	}
+
+	var tags []string
+	for _, tag := range entry.Tags {
+		if !contains(remove, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range add {
+		if !contains(remove, tag) && !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Tag applies the rules to an entry about to be stored
+func (r Rules) Tag(entry *storage.PasswordEntry) error {
+	_, err := r.Apply(entry)
+	return err
+}
+
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTags reports whether a and b hold the same tags in the same order
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// missingFrom returns the tags of b that are not in a
+func missingFrom(a, b []string) []string {
+	var missing []string
+	for _, tag := range b {
+		if !contains(a, tag) {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
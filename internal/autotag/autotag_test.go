@@ -0,0 +1,149 @@
+package autotag
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"password-manager/internal/config"
+	"password-manager/internal/storage"
+	"password-manager/internal/tmpfile"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	tmpfile.Cleanup()
+	os.Exit(code)
+}
+
+func mustCompile(t *testing.T, rules ...config.AutoTagRule) Rules {
+	t.Helper()
+	compiled, err := Compile(rules)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	return compiled
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		rule config.AutoTagRule
+		want string
+	}{
+		{config.AutoTagRule{AddTags: []string{"x"}}, "auto_tag[0]: match is required"},
+		{config.AutoTagRule{Match: "url ~", AddTags: []string{"x"}}, "auto_tag[0]: invalid match"},
+		{config.AutoTagRule{Match: "strength < Good", AddTags: []string{"weak"}}, "cannot test strength"},
+		{config.AutoTagRule{Match: "name ~ aws", AddTags: []string{" "}}, "add_tags or remove_tags is required"},
+	}
+	for _, tt := range tests {
+		if _, err := Compile([]config.AutoTagRule{tt.rule}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%+v) = %v, want an error containing %q", tt.rule, err, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	rules := mustCompile(t,
+		config.AutoTagRule{Match: "url ~ .internal", AddTags: []string{"infra"}},
+		// Implied by a tag another rule adds
+		config.AutoTagRule{Match: "tag = infra", AddTags: []string{"vpn"}},
+		config.AutoTagRule{Match: "name ~ old", RemoveTags: []string{"current"}},
+	)
+
+	entry := &storage.PasswordEntry{Name: "old-jenkins", URL: "https://ci.corp.internal", Tags: []string{"Current", "VPN"}}
+	change, err := rules.Apply(entry)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if want := []string{"VPN", "infra"}; !reflect.DeepEqual(entry.Tags, want) {
+		t.Errorf("Tags = %v, want %v", entry.Tags, want)
+	}
+	if change.String() != "+infra -Current" {
+		t.Errorf("Change = %q", change)
+	}
+
+	// Re-applying changes nothing
+	if change, err := rules.Apply(entry); err != nil || change.Changed() {
+		t.Errorf("Expected re-applying to be a no-op, got %v, %v", change, err)
+	}
+
+	// Tags no rule mentions are kept
+	entry = &storage.PasswordEntry{Name: "mail", Tags: []string{"personal"}}
+	if change, _ := rules.Apply(entry); change.Changed() || !reflect.DeepEqual(entry.Tags, []string{"personal"}) {
+		t.Errorf("Expected an unmatched entry to be left alone, got %v, %v", entry.Tags, change)
+	}
+}
+
+func TestApplyConflicts(t *testing.T) {
+	// Removal wins over addition within a pass
+	rules := mustCompile(t,
+		config.AutoTagRule{Match: "name ~ db", AddTags: []string{"prod"}},
+		config.AutoTagRule{Match: "name ~ test", RemoveTags: []string{"prod"}},
+	)
+	entry := &storage.PasswordEntry{Name: "test-db"}
+	if _, err := rules.Apply(entry); err != nil || len(entry.Tags) != 0 {
+		t.Errorf("Expected the removal to win, got %v, %v", entry.Tags, err)
+	}
+
+	// Rules undoing each other never settle
+	rules = mustCompile(t,
+		config.AutoTagRule{Match: "tag != flip", AddTags: []string{"flip"}},
+		config.AutoTagRule{Match: "tag = flip", RemoveTags: []string{"flip"}},
+	)
+	entry = &storage.PasswordEntry{Name: "x", Tags: []string{"keep"}}
+	if _, err := rules.Apply(entry); err == nil || !strings.Contains(err.Error(), "do not settle") {
+		t.Errorf("Expected an error for oscillating rules, got %v", err)
+	}
+	if !reflect.DeepEqual(entry.Tags, []string{"keep"}) {
+		t.Errorf("Expected the tags to be restored, got %v", entry.Tags)
+	}
+}
+
+func TestRetagVault(t *testing.T) {
+	db, err := storage.CreateDatabase(filepath.Join(t.TempDir(), "vault.db"), "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	defer db.Close()
+	for _, entry := range []*storage.PasswordEntry{
+		{Name: "grafana", URL: "https://grafana.internal", Password: "a"},
+		{Name: "jenkins", URL: "https://ci.internal", Password: "b", Tags: []string{"infra"}},
+		{Name: "mail", URL: "https://mail.example", Password: "c"},
+	} {
+		if err := db.SavePassword(entry); err != nil {
+			t.Fatalf("SavePassword failed: %v", err)
+		}
+	}
+
+	rules := mustCompile(t, config.AutoTagRule{Match: "url ~ .internal", AddTags: []string{"infra", "vpn"}})
+	changes, failed, err := rules.Retag(db, true)
+	if err != nil || len(failed) > 0 || len(changes) != 2 {
+		t.Fatalf("Dry run = %v, %v, %v", changes, failed, err)
+	}
+	if entry, _ := db.GetPassword("grafana"); len(entry.Tags) != 0 {
+		t.Errorf("Expected a dry run to store nothing, got %v", entry.Tags)
+	}
+
+	changes, _, err = rules.Retag(db, false)
+	if err != nil || len(changes) != 2 || changes[0].String() != "+infra +vpn" || changes[1].String() != "+vpn" {
+		t.Fatalf("Retag = %v, %v", changes, err)
+	}
+	if entry, _ := db.GetPassword("jenkins"); !reflect.DeepEqual(entry.Tags, []string{"infra", "vpn"}) || entry.Password != "b" {
+		t.Errorf("Unexpected entry after retag: %+v", entry)
+	}
+	if changes, _, _ := rules.Retag(db, false); len(changes) != 0 {
+		t.Errorf("Expected a second retag to change nothing, got %v", changes)
+	}
+
+	// Rules also apply as entries are saved
+	db.SetTagger(rules)
+	entry := &storage.PasswordEntry{Name: "vault", URL: "https://vault.internal", Password: "d"}
+	if err := db.SavePassword(entry); err != nil {
+		t.Fatalf("SavePassword failed: %v", err)
+	}
+	if stored, _ := db.GetPassword("vault"); !reflect.DeepEqual(stored.Tags, []string{"infra", "vpn"}) {
+		t.Errorf("Expected the rules to tag a saved entry, got %v", stored.Tags)
+	}
+}
@@ -0,0 +1,171 @@
+package autotype
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSequence types the username, tabs to the next field, types the
+// password and submits
+const DefaultSequence = "{username}{TAB}{password}{ENTER}"
+
+// ErrUnsupported is returned when no keystroke injection path exists
+var ErrUnsupported = errors.New("autotype is not supported here")
+
+// keys maps the key placeholders of a sequence to injector key names
+var keys = map[string]string{
+	"TAB":   "Tab",
+	"ENTER": "Return",
+	"SPACE": "space",
+	"ESC":   "Escape",
+	"BS":    "BackSpace",
+	"UP":    "Up",
+	"DOWN":  "Down",
+	"LEFT":  "Left",
+	"RIGHT": "Right",
+}
+
+// fields lists the entry placeholders a sequence may use
+var fields = map[string]bool{
+	"name":     true,
+	"username": true,
+	"password": true,
+	"url":      true,
+	"notes":    true,
+}
+
+// Kind is the kind of a step in a sequence
+type Kind int
+
+const (
+	// Field types the value of an entry field
+	Field Kind = iota
+	// Key presses a named key
+	Key
+	// Delay pauses between steps
+	Delay
+)
+
+// Step is one parsed element of a sequence
+type Step struct {
+	Kind  Kind
+	Name  string        // field or key name
+	Delay time.Duration // for Delay steps
+}
+
+// Parse parses a sequence such as "{username}{TAB}{password}{ENTER}".
+// Field placeholders are lower case, key placeholders upper case, and
+// {DELAY ms} pauses. Literal text is not allowed: everything typed comes
+// from the entry.
+func Parse(sequence string) ([]Step, error) {
+	var steps []Step
+	rest := sequence
+	for rest != "" {
+		if rest[0] != '{' {
+			return nil, fmt.Errorf("invalid sequence %q: expected { at %q", sequence, rest)
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid sequence %q: unterminated placeholder", sequence)
+		}
+		token := rest[1:end]
+		rest = rest[end+1:]
+
+		switch {
+		case fields[token]:
+			steps = append(steps, Step{Kind: Field, Name: token})
+		case keys[token] != "":
+			steps = append(steps, Step{Kind: Key, Name: token})
+		case strings.HasPrefix(token, "DELAY "):
+			ms, err := strconv.Atoi(strings.TrimPrefix(token, "DELAY "))
+			if err != nil || ms < 0 || ms > 10000 {
+				return nil, fmt.Errorf("invalid sequence %q: {DELAY ms} needs 0-10000", sequence)
+			}
+			steps = append(steps, Step{Kind: Delay, Delay: time.Duration(ms) * time.Millisecond})
+		default:
+			return nil, fmt.Errorf("invalid sequence %q: unknown placeholder {%s}", sequence, token)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty sequence")
+	}
+	return steps, nil
+}
+
+// UsesField reports whether steps type the named field
+func UsesField(steps []Step, field string) bool {
+	for _, step := range steps {
+		if step.Kind == Field && step.Name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Injector sends keystrokes to the focused window. Implementations must
+// never log or echo the text they type.
+type Injector interface {
+	Type(text string) error
+	Key(name string) error
+}
+
+// Run plays steps through injector, reading field values from values.
+// Empty fields type nothing.
+func Run(injector Injector, steps []Step, values map[string]string) error {
+	for _, step := range steps {
+		var err error
+		switch step.Kind {
+		case Field:
+			if value := values[step.Name]; value != "" {
+				err = injector.Type(value)
+			}
+		case Key:
+			err = injector.Key(keys[step.Name])
+		case Delay:
+			time.Sleep(step.Delay)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Event is a keystroke recorded by DryRun
+type Event struct {
+	Text string // typed text, empty for key presses
+	Key  string // key name, empty for typed text
+}
+
+// DryRun records events instead of sending them
+type DryRun struct {
+	Events []Event
+}
+
+func (d *DryRun) Type(text string) error {
+	d.Events = append(d.Events, Event{Text: text})
+	return nil
+}
+
+func (d *DryRun) Key(name string) error {
+	d.Events = append(d.Events, Event{Key: name})
+	return nil
+}
+
+// Countdown waits for the given number of seconds, calling tick with the
+// seconds remaining before each one. It returns false if abort fires
+// first.
+func Countdown(seconds int, tick func(remaining int), abort <-chan struct{}) bool {
+	for remaining := seconds; remaining > 0; remaining-- {
+		tick(remaining)
+		select {
+		case <-abort:
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+	return true
+}
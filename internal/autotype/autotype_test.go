@@ -0,0 +1,85 @@
+package autotype
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	steps, err := Parse("{username}{TAB}{DELAY 50}{password}{ENTER}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	want := []Step{
+		{Kind: Field, Name: "username"},
+		{Kind: Key, Name: "TAB"},
+		{Kind: Delay, Delay: 50 * time.Millisecond},
+		{Kind: Field, Name: "password"},
+		{Kind: Key, Name: "ENTER"},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("Parse = %+v, want %+v", steps, want)
+	}
+	if !UsesField(steps, "password") || UsesField(steps, "url") {
+		t.Error("UsesField reported the wrong fields")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, sequence := range []string{
+		"",
+		"{username",
+		"user{TAB}",
+		"{USERNAME}",
+		"{tab}",
+		"{totp}",
+		"{DELAY x}",
+		"{DELAY 99999}",
+	} {
+		if _, err := Parse(sequence); err == nil {
+			t.Errorf("Expected error for %q", sequence)
+		}
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	steps, err := Parse(DefaultSequence)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var injector DryRun
+	values := map[string]string{"username": "john", "password": "hunter2"}
+	if err := Run(&injector, steps, values); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := []Event{{Text: "john"}, {Key: "Tab"}, {Text: "hunter2"}, {Key: "Return"}}
+	if !reflect.DeepEqual(injector.Events, want) {
+		t.Errorf("Events = %+v, want %+v", injector.Events, want)
+	}
+
+	// Empty fields type nothing
+	injector.Events = nil
+	if err := Run(&injector, steps, map[string]string{"password": "x"}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(injector.Events) != 3 || injector.Events[0].Key != "Tab" {
+		t.Errorf("Expected the empty username to be skipped, got %+v", injector.Events)
+	}
+}
+
+func TestCountdownAbort(t *testing.T) {
+	abort := make(chan struct{})
+	close(abort)
+
+	ticks := 0
+	if Countdown(3, func(int) { ticks++ }, abort) {
+		t.Error("Expected the countdown to be aborted")
+	}
+	if ticks != 1 {
+		t.Errorf("Expected 1 tick before aborting, got %d", ticks)
+	}
+}
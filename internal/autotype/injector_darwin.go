@@ -0,0 +1,57 @@
+//go:build darwin
+
+package autotype
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// appleKeyCodes maps key names to macOS virtual key codes
+var appleKeyCodes = map[string]int{
+	"Tab":       48,
+	"Return":    36,
+	"space":     49,
+	"Escape":    53,
+	"BackSpace": 51,
+	"Up":        126,
+	"Down":      125,
+	"Left":      123,
+	"Right":     124,
+}
+
+// NewInjector drives System Events through osascript. The terminal needs
+// the Accessibility permission.
+func NewInjector() (Injector, error) {
+	if _, err := exec.LookPath("osascript"); err != nil {
+		return nil, fmt.Errorf("%w: osascript not found", ErrUnsupported)
+	}
+	return osascriptInjector{}, nil
+}
+
+// osascriptInjector passes its script on stdin so typed text never shows
+// up in the process list
+type osascriptInjector struct{}
+
+func (osascriptInjector) Type(text string) error {
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+	return runAppleScript(`tell application "System Events" to keystroke "` + quoted + `"`)
+}
+
+func (osascriptInjector) Key(name string) error {
+	code, ok := appleKeyCodes[name]
+	if !ok {
+		return fmt.Errorf("unknown key %s", name)
+	}
+	return runAppleScript(fmt.Sprintf(`tell application "System Events" to key code %d`, code))
+}
+
+func runAppleScript(script string) error {
+	cmd := exec.Command("osascript", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("osascript failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package autotype
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// NewInjector picks wtype on Wayland and xdotool on X11. Wayland
+// compositors only accept synthetic input through the virtual keyboard
+// protocol, which wtype speaks; without it there is no injection path.
+func NewInjector() (Injector, error) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wtype"); err != nil {
+			return nil, fmt.Errorf("%w: Wayland session without wtype (install wtype, or use a compositor supporting virtual-keyboard)", ErrUnsupported)
+		}
+		return commandInjector{typeCmd: []string{"wtype", "-"}, keyCmd: []string{"wtype", "-k"}}, nil
+	}
+	if os.Getenv("DISPLAY") != "" {
+		if _, err := exec.LookPath("xdotool"); err != nil {
+			return nil, fmt.Errorf("%w: xdotool is not installed", ErrUnsupported)
+		}
+		return commandInjector{typeCmd: []string{"xdotool", "type", "--clearmodifiers", "--file", "-"}, keyCmd: []string{"xdotool", "key", "--clearmodifiers"}}, nil
+	}
+	return nil, fmt.Errorf("%w: no graphical session", ErrUnsupported)
+}
+
+// commandInjector runs an external tool. Text goes through stdin so it
+// never shows up in the process list.
+type commandInjector struct {
+	typeCmd []string
+	keyCmd  []string
+}
+
+func (c commandInjector) Type(text string) error {
+	cmd := exec.Command(c.typeCmd[0], c.typeCmd[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", c.typeCmd[0], err)
+	}
+	return nil
+}
+
+func (c commandInjector) Key(name string) error {
+	args := append(append([]string{}, c.keyCmd[1:]...), name)
+	if err := exec.Command(c.keyCmd[0], args...).Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", c.keyCmd[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package autotype
+
+// NewInjector reports that no injection path exists on this platform
+func NewInjector() (Injector, error) {
+	return nil, ErrUnsupported
+}
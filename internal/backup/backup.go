@@ -0,0 +1,227 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/storage"
+)
+
+const (
+	// Format identifies backup files
+	Format = "pmbackup"
+	// Version is the current backup file version
+	Version = 1
+)
+
+var (
+	// ErrInvalidPassphrase is returned when a backup cannot be decrypted
+	ErrInvalidPassphrase = errors.New("invalid backup passphrase")
+	// ErrPassphraseRequired is returned by ReadInfo when the health
+	// summary of a backup is encrypted and no passphrase was given
+	ErrPassphraseRequired = errors.New("backup passphrase required")
+	// ErrHeaderMismatch is returned when the plaintext health summary of
+	// a backup does not match its encrypted copy
+	ErrHeaderMismatch = errors.New("backup health header does not match its encrypted contents")
+)
+
+// Backup is the decrypted content of a backup file
+type Backup struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Filter is the expression a partial backup was made with, empty for
+	// a backup of the whole vault
+	Filter  string                   `json:"filter,omitempty"`
+	Entries []*storage.PasswordEntry `json:"entries"`
+	// Health summarizes the vault at the time of the backup. It is also
+	// stored apart from the entries so ReadInfo can show it cheaply.
+	Health *Health `json:"health,omitempty"`
+	// PublicHealth stores the summary as a plaintext header too, readable
+	// without the passphrase. Read verifies it against the encrypted copy.
+	PublicHealth bool `json:"public_health,omitempty"`
+}
+
+// Partial reports whether the backup holds only the entries matching a
+// filter
+func (b *Backup) Partial() bool {
+	return b.Filter != ""
+}
+
+// Each calls fn with the entries of the backup in order, stopping at the
+// first error. It is a storage.EntrySource, so a backup can be loaded
+// with storage.OpenMemory.
+func (b *Backup) Each(fn func(*storage.PasswordEntry) error) error {
+	for _, entry := range b.Entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Info is what ReadInfo learns about a backup without its entries
+type Info struct {
+	Health *Health
+	// Public is set when Health came from the plaintext header, which
+	// is only authenticated once the backup is read with its passphrase
+	Public bool
+}
+
+// file is the on-disk envelope: the backup is encrypted as a whole with a
+// passphrase, so nothing but the format and version is readable without
+// it, unless the health summary was made public
+type file struct {
+	Format  string                `json:"format"`
+	Version int                   `json:"version"`
+	Data    *crypto.EncryptedData `json:"data"`
+	// Health is the summary encrypted on its own under the passphrase
+	Health *crypto.EncryptedData `json:"health,omitempty"`
+	// PublicHealth is the summary in plaintext
+	PublicHealth *Health `json:"public_health,omitempty"`
+	// Export names the format of an encrypted export, which is kept in
+	// Data, or in Sealed when it is encrypted to age recipients
+	Export string `json:"export,omitempty"`
+	Sealed string `json:"sealed,omitempty"`
+}
+
+// Write encrypts b with passphrase and writes it to path, stamping the
+// creation time if unset. The file is created with owner-only permissions
+// and never overwrites an existing one.
+func Write(path string, b *Backup, passphrase string) error {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+	envelope := file{Format: Format, Version: Version}
+	if b.Health != nil {
+		b.Health.CreatedAt = b.CreatedAt
+		b.Health.Filter = b.Filter
+		summary, err := json.Marshal(b.Health)
+		if err != nil {
+			return fmt.Errorf("failed to marshal health summary: %w", err)
+		}
+		if envelope.Health, err = crypto.EncryptBytes(summary, passphrase); err != nil {
+			return fmt.Errorf("failed to encrypt health summary: %w", err)
+		}
+		if b.PublicHealth {
+			envelope.PublicHealth = b.Health
+		}
+	}
+
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+	if envelope.Data, err = crypto.EncryptBytes(payload, passphrase); err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+
+	return writeFile(path, &envelope)
+}
+
+// writeFile writes an envelope to a new file readable by the owner only
+func writeFile(path string, envelope *file) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup file: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return f.Close()
+}
+
+// readFile reads the envelope of the backup at path
+func readFile(path string) (*file, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil || f.Format != Format || (f.Data == nil && f.Sealed == "") {
+		return nil, fmt.Errorf("%s is not a backup file", path)
+	}
+	if f.Version > Version {
+		return nil, fmt.Errorf("backup version %d is newer than supported version %d", f.Version, Version)
+	}
+	return &f, nil
+}
+
+// readBackupFile reads the envelope of the backup at path, refusing
+// encrypted exports
+func readBackupFile(path string) (*file, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if f.Export != "" {
+		return nil, fmt.Errorf("%s is an encrypted export, not a backup", path)
+	}
+	return f, nil
+}
+
+// Read reads and decrypts the backup at path
+func Read(path, passphrase string) (*Backup, error) {
+	f, err := readBackupFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := crypto.DecryptBytes(f.Data, passphrase)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+
+	var b Backup
+	if err := json.Unmarshal(payload, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse backup: %w", err)
+	}
+	if f.PublicHealth != nil {
+		header, _ := json.Marshal(f.PublicHealth)
+		inner, _ := json.Marshal(b.Health)
+		if !bytes.Equal(header, inner) {
+			return nil, ErrHeaderMismatch
+		}
+	}
+	return &b, nil
+}
+
+// ReadInfo reads the health summary of the backup at path without
+// decrypting its entries. A public summary needs no passphrase; otherwise
+// an empty passphrase gives ErrPassphraseRequired. Backups made before
+// summaries existed have a nil Health.
+func ReadInfo(path, passphrase string) (*Info, error) {
+	f, err := readBackupFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if f.PublicHealth != nil {
+		return &Info{Health: f.PublicHealth, Public: true}, nil
+	}
+	if f.Health == nil {
+		return &Info{}, nil
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	summary, err := crypto.DecryptBytes(f.Health, passphrase)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	var h Health
+	if err := json.Unmarshal(summary, &h); err != nil {
+		return nil, fmt.Errorf("failed to parse health summary: %w", err)
+	}
+	return &Info{Health: &h}, nil
+}
@@ -0,0 +1,350 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"password-manager/internal/storage"
+)
+
+// readFixture reads one of the backups in testdata
+func readFixture(t *testing.T, name, passphrase string) *Backup {
+	t.Helper()
+
+	b, err := Read(filepath.Join("testdata", name), passphrase)
+	if err != nil {
+		t.Fatalf("Read(%s) failed: %v", name, err)
+	}
+	return b
+}
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.pmbackup")
+	entries := []*storage.PasswordEntry{{Name: "gmail", Password: "secret", Tags: []string{"email"}}}
+
+	if err := Write(path, &Backup{Entries: entries, Filter: "tag=email"}, "passphrase"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := Write(path, &Backup{Entries: entries}, "passphrase"); err == nil {
+		t.Error("Expected Write to refuse overwriting an existing backup")
+	}
+
+	if _, err := Read(path, "wrong"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+
+	b, err := Read(path, "passphrase")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(b.Entries) != 1 || b.Entries[0].Password != "secret" || b.Entries[0].Tags[0] != "email" {
+		t.Errorf("Unexpected entries: %+v", b.Entries)
+	}
+	if !b.Partial() || b.Filter != "tag=email" || b.CreatedAt.IsZero() {
+		t.Errorf("Expected a partial backup with its filter recorded, got %+v", b)
+	}
+}
+
+func TestDiffFixtures(t *testing.T) {
+	old := readFixture(t, "old.pmbackup", "old-passphrase")
+	new := readFixture(t, "new.pmbackup", "new-passphrase")
+
+	result := Diff(old.Entries, new.Entries)
+
+	if !reflect.DeepEqual(result.Added, []string{"jira"}) {
+		t.Errorf("Expected added [jira], got %v", result.Added)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"work-vpn"}) {
+		t.Errorf("Expected removed [work-vpn], got %v", result.Removed)
+	}
+	if !reflect.DeepEqual(result.Renamed, []Rename{{From: "old-forum", To: "forum"}}) {
+		t.Errorf("Expected old-forum renamed to forum, got %v", result.Renamed)
+	}
+	if want := (Counts{Added: 1, Removed: 1, Modified: 2, Renamed: 1, Unchanged: 1}); result.Counts != want {
+		t.Errorf("Expected counts %+v, got %+v", want, result.Counts)
+	}
+
+	want := []Modified{
+		{Name: "github", Changes: []FieldChange{{Field: "password", Secret: true}}},
+		{Name: "gmail", Changes: []FieldChange{
+			{Field: "notes", Secret: true},
+			{Field: "tags", Old: "email", New: "email, personal"},
+		}},
+	}
+	if !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Unexpected modifications:\n got %+v\nwant %+v", result.Modified, want)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	old := readFixture(t, "old.pmbackup", "old-passphrase")
+
+	result := Diff(old.Entries, old.Entries)
+	if !result.Empty() || result.Counts.Unchanged != len(old.Entries) {
+		t.Errorf("Expected no differences, got %+v", result)
+	}
+}
+
+func TestDiffAmbiguousRename(t *testing.T) {
+	old := []*storage.PasswordEntry{{Name: "a", Password: "same"}}
+	new := []*storage.PasswordEntry{{Name: "b", Password: "same"}, {Name: "c", Password: "same"}}
+
+	result := Diff(old, new)
+	if len(result.Renamed) != 0 {
+		t.Errorf("Expected no rename for an ambiguous match, got %v", result.Renamed)
+	}
+	if len(result.Removed) != 1 || len(result.Added) != 2 {
+		t.Errorf("Expected 1 removed and 2 added, got %+v", result)
+	}
+}
+
+func TestDiffHidesNotes(t *testing.T) {
+	old := []*storage.PasswordEntry{{Name: "gmail", Notes: "recovery: 1111-2222"}}
+	new := []*storage.PasswordEntry{{Name: "gmail", Notes: "recovery: 3333-4444"}}
+
+	result := Diff(old, new)
+	want := []Modified{{Name: "gmail", Changes: []FieldChange{{Field: "notes", Secret: true}}}}
+	if !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Expected the notes of a login reported as changed only, got %+v", result.Modified)
+	}
+}
+
+func TestDiffExpiry(t *testing.T) {
+	expires := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := []*storage.PasswordEntry{{Name: "vpn", Password: "same"}}
+	new := []*storage.PasswordEntry{{Name: "vpn", Password: "same", ExpiresAt: &expires}}
+
+	result := Diff(old, new)
+	want := []Modified{{Name: "vpn", Changes: []FieldChange{{Field: "expires", New: "2025-03-01T00:00:00Z"}}}}
+	if !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Expected the expiry change, got %+v", result.Modified)
+	}
+	if result := Diff(new, new); !result.Empty() {
+		t.Errorf("Expected no differences for the same expiry, got %+v", result)
+	}
+}
+
+func TestDiffNoteHidesBody(t *testing.T) {
+	old := []*storage.PasswordEntry{{Name: "safe", Type: storage.EntryTypeNote, Notes: "12-34-56"}}
+	new := []*storage.PasswordEntry{{Name: "safe", Notes: "65-43-21"}}
+
+	result := Diff(old, new)
+	if len(result.Modified) != 1 {
+		t.Fatalf("Expected 1 modified entry, got %+v", result)
+	}
+	for _, change := range result.Modified[0].Changes {
+		if change.Field == "notes" && (!change.Secret || change.Old != "" || change.New != "") {
+			t.Errorf("Note body leaked in diff: %+v", change)
+		}
+	}
+	if changes := result.Modified[0].Changes; len(changes) != 2 || changes[0].Field != "type" || changes[0].New != storage.EntryTypeLogin {
+		t.Errorf("Expected type and notes changes, got %+v", changes)
+	}
+}
+
+func TestHealthSummary(t *testing.T) {
+	updated := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*storage.PasswordEntry{
+		{ID: 1, Name: "bank", Password: "hunter2", UpdatedAt: updated},
+		{ID: 2, Name: "mail", Password: "x", UpdatedAt: updated},
+		{ID: 3, Name: "stale", Password: "y", UpdatedAt: updated},
+		{ID: 4, Name: "safe", Type: storage.EntryTypeNote, Notes: "12-34", UpdatedAt: updated},
+	}
+	grades := map[int64]storage.StrengthGrade{
+		1: {EntryID: 1, Level: "Fair", AnalyzedAt: updated.Add(time.Hour)},
+		2: {EntryID: 2, Level: "Fair", AnalyzedAt: updated},
+		3: {EntryID: 3, Level: "Strong", AnalyzedAt: updated.Add(-time.Hour)},
+	}
+	path := filepath.Join(t.TempDir(), "vault.pmbackup")
+	b := &Backup{Entries: entries, Health: NewHealth(entries, grades, "1.0.0")}
+	if err := Write(path, b, "passphrase"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if _, err := ReadInfo(path, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Expected ErrPassphraseRequired, got %v", err)
+	}
+	if _, err := ReadInfo(path, "wrong"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	info, err := ReadInfo(path, "passphrase")
+	if err != nil {
+		t.Fatalf("ReadInfo failed: %v", err)
+	}
+	h := info.Health
+	if info.Public || h.Entries != 4 || h.Notes != 1 || h.Unrated != 1 || h.AppVersion != "1.0.0" ||
+		h.SchemaVersion != storage.SchemaVersion || !h.CreatedAt.Equal(b.CreatedAt) {
+		t.Errorf("Unexpected summary %+v", h)
+	}
+	if !reflect.DeepEqual(h.Strength, map[string]int{"Fair": 2}) {
+		t.Errorf("Expected 2 Fair entries, got %v", h.Strength)
+	}
+
+	var out bytes.Buffer
+	h.Print(&out)
+	if text := out.String(); !strings.Contains(text, "Entries:  4 (1 notes)") || strings.Contains(text, "hunter2") || strings.Contains(text, "bank") {
+		t.Errorf("Unexpected summary output:\n%s", text)
+	}
+}
+
+func TestPublicHealthHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.pmbackup")
+	entries := []*storage.PasswordEntry{{Name: "gmail", Password: "secret"}}
+	b := &Backup{Entries: entries, Health: NewHealth(entries, nil, "1.0.0"), PublicHealth: true}
+	if err := Write(path, b, "passphrase"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	info, err := ReadInfo(path, "")
+	if err != nil || !info.Public || info.Health.Entries != 1 {
+		t.Fatalf("Expected the public summary without a passphrase, got %+v, %v", info, err)
+	}
+	if _, err := Read(path, "passphrase"); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// Forge the plaintext header
+	data, _ := os.ReadFile(path)
+	forged := bytes.Replace(data, []byte(`"entries":1`), []byte(`"entries":9`), 1)
+	if bytes.Equal(forged, data) {
+		t.Fatal("Header not found in backup file")
+	}
+	if err := os.WriteFile(path, forged, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path, "passphrase"); !errors.Is(err, ErrHeaderMismatch) {
+		t.Errorf("Expected ErrHeaderMismatch, got %v", err)
+	}
+}
+
+func TestReadInfoWithoutSummary(t *testing.T) {
+	info, err := ReadInfo(filepath.Join("testdata", "old.pmbackup"), "")
+	if err != nil || info.Health != nil {
+		t.Errorf("Expected no summary in an old backup, got %+v, %v", info, err)
+	}
+}
+
+func TestEncryptedExport(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("name,url,username,password,notes\nbank,,,hunter2,\n")
+
+	path := filepath.Join(dir, "vault.pmexport")
+	if err := WriteExport(path, "csv", data, "passphrase", nil); err != nil {
+		t.Fatalf("WriteExport failed: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("hunter2")) {
+		t.Error("Expected the export to be encrypted")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a 0600 file, got %v, %v", info, err)
+	}
+	if _, _, err := ReadExport(path, "wrong", nil); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	format, got, err := ReadExport(path, "passphrase", nil)
+	if err != nil || format != "csv" || !bytes.Equal(got, data) {
+		t.Errorf("ReadExport = %q, %q, %v", format, got, err)
+	}
+	if _, err := Read(path, "passphrase"); err == nil {
+		t.Error("Expected Read to refuse an export")
+	}
+	if err := WriteExport(path, "csv", data, "passphrase", nil); err == nil {
+		t.Error("Expected WriteExport not to overwrite a file")
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedPath := filepath.Join(dir, "sealed.pmexport")
+	if err := WriteExport(sealedPath, "json", data, "", []string{identity.Recipient().String()}); err != nil {
+		t.Fatalf("WriteExport to a recipient failed: %v", err)
+	}
+	if sealed, err := IsSealedExport(sealedPath); err != nil || !sealed {
+		t.Errorf("Expected a sealed export, got %t, %v", sealed, err)
+	}
+	if _, got, err = ReadExport(sealedPath, "", []age.Identity{identity}); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("ReadExport with an identity = %q, %v", got, err)
+	}
+}
+
+// TestOpenMemoryFromBackup inspects a backup through an in-memory vault
+// and checks the live vault is left byte for byte as it was
+func TestOpenMemoryFromBackup(t *testing.T) {
+	dir := t.TempDir()
+	livePath := filepath.Join(dir, "passwords.db")
+	live, err := storage.CreateDatabase(livePath, "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	for _, name := range []string{"bank", "gmail"} {
+		if err := live.SavePassword(&storage.PasswordEntry{Name: name, Password: name + "-pw"}); err != nil {
+			t.Fatalf("SavePassword failed: %v", err)
+		}
+	}
+	entries, err := live.ListPasswords()
+	if err != nil {
+		t.Fatalf("ListPasswords failed: %v", err)
+	}
+	if err := live.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	path := filepath.Join(dir, "vault.pmbackup")
+	if err := Write(path, &Backup{Entries: entries}, "passphrase"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	before, err := os.ReadFile(livePath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	b, err := Read(path, "passphrase")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	db, err := storage.OpenMemory(b.Each)
+	if err != nil {
+		t.Fatalf("OpenMemory failed: %v", err)
+	}
+	if !db.IsMemory() {
+		t.Error("Expected an in-memory vault")
+	}
+	got, err := db.ListPasswords()
+	if err != nil || len(got) != 2 || got[0].Name != "bank" || got[0].Password != "bank-pw" {
+		t.Fatalf("Expected the backed up entries, got %+v, %v", got, err)
+	}
+	if !got[0].UpdatedAt.Equal(entries[0].UpdatedAt) {
+		t.Errorf("Expected the backed up change time %v, got %v", entries[0].UpdatedAt, got[0].UpdatedAt)
+	}
+	stats, err := db.GetStats()
+	if err != nil || stats["total_passwords"] != 2 {
+		t.Errorf("Expected stats for 2 entries, got %v, %v", stats, err)
+	}
+	if err := db.SavePassword(&storage.PasswordEntry{Name: "new", Password: "pw"}); err == nil {
+		t.Error("Expected the in-memory vault to be read-only")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	after, err := os.ReadFile(livePath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Expected the live vault to be untouched")
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("Expected nothing written next to the vault, got %d files", len(files))
+	}
+}
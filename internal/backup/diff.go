@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+// FieldChange describes one changed field of an entry. Values of secret
+// fields are never reported, only the fact that they changed.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Secret bool   `json:"secret,omitempty"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// Modified is an entry present on both sides with different content
+type Modified struct {
+	Name    string        `json:"name"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Rename is an entry whose name changed while every other field matched
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Counts summarizes a Result
+type Counts struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Modified  int `json:"modified"`
+	Renamed   int `json:"renamed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Result is the difference between two sets of entries
+type Result struct {
+	Counts   Counts     `json:"counts"`
+	Added    []string   `json:"added"`
+	Removed  []string   `json:"removed"`
+	Modified []Modified `json:"modified"`
+	Renamed  []Rename   `json:"renamed"`
+}
+
+// Empty reports whether the two sides hold the same entries
+func (r *Result) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Modified) == 0 && len(r.Renamed) == 0
+}
+
+// Diff compares old and new entries keyed by name. An entry removed from
+// old and added to new with every other field equal is reported as a
+// rename, as long as the match is unambiguous.
+func Diff(old, new []*storage.PasswordEntry) *Result {
+	oldByName := byName(old)
+	newByName := byName(new)
+	result := &Result{
+		Added:    []string{},
+		Removed:  []string{},
+		Modified: []Modified{},
+		Renamed:  []Rename{},
+	}
+
+	var removed, added []*storage.PasswordEntry
+	for _, name := range sortedNames(oldByName) {
+		before := oldByName[name]
+		after, ok := newByName[name]
+		if !ok {
+			removed = append(removed, before)
+			continue
+		}
+		if changes := compare(before, after); len(changes) > 0 {
+			result.Modified = append(result.Modified, Modified{Name: name, Changes: changes})
+		} else {
+			result.Counts.Unchanged++
+		}
+	}
+	for _, name := range sortedNames(newByName) {
+		if _, ok := oldByName[name]; !ok {
+			added = append(added, newByName[name])
+		}
+	}
+
+	// Pair removed and added entries whose content matches exactly once
+	// on each side
+	renamedTo := make(map[string]bool)
+	for _, before := range removed {
+		match := uniqueMatch(before, added)
+		if match != nil && uniqueMatch(match, removed) == before {
+			result.Renamed = append(result.Renamed, Rename{From: before.Name, To: match.Name})
+			renamedTo[match.Name] = true
+			continue
+		}
+		result.Removed = append(result.Removed, before.Name)
+	}
+	for _, after := range added {
+		if !renamedTo[after.Name] {
+			result.Added = append(result.Added, after.Name)
+		}
+	}
+
+	result.Counts.Added = len(result.Added)
+	result.Counts.Removed = len(result.Removed)
+	result.Counts.Modified = len(result.Modified)
+	result.Counts.Renamed = len(result.Renamed)
+	return result
+}
+
+// byName indexes entries by name. Should a side hold duplicate names,
+// the last one wins.
+func byName(entries []*storage.PasswordEntry) map[string]*storage.PasswordEntry {
+	index := make(map[string]*storage.PasswordEntry, len(entries))
+	for _, entry := range entries {
+		index[entry.Name] = entry
+	}
+	return index
+}
+
+// sortedNames returns the keys of index in order
+func sortedNames(index map[string]*storage.PasswordEntry) []string {
+	names := make([]string, 0, len(index))
+	for name := range index {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// uniqueMatch returns the only candidate whose content equals entry's
+func uniqueMatch(entry *storage.PasswordEntry, candidates []*storage.PasswordEntry) *storage.PasswordEntry {
+	var match *storage.PasswordEntry
+	for _, candidate := range candidates {
+		if len(compare(entry, candidate)) == 0 {
+			if match != nil {
+				return nil
+			}
+			match = candidate
+		}
+	}
+	return match
+}
+
+// compare lists the fields that differ between two entries, ignoring the
+// name, the ID and timestamps
+func compare(before, after *storage.PasswordEntry) []FieldChange {
+	var changes []FieldChange
+	field := func(name, old, new string) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: name, Old: old, New: new})
+		}
+	}
+
+	field("type", entryType(before), entryType(after))
+	field("username", before.Username, after.Username)
+	if before.Password != after.Password {
+		changes = append(changes, FieldChange{Field: "password", Secret: true})
+	}
+	field("url", before.URL, after.URL)
+	// Notes hold the body of a secure note, and often recovery codes and
+	// the like on other entries
+	if before.Notes != after.Notes {
+		changes = append(changes, FieldChange{Field: "notes", Secret: true})
+	}
+	field("tags", joinTags(before.Tags), joinTags(after.Tags))
+	field("icon", before.Icon, after.Icon)
+	field("expires", expiry(before), expiry(after))
+	return changes
+}
+
+// expiry renders the expiry date of an entry, "" for none
+func expiry(entry *storage.PasswordEntry) string {
+	if entry.ExpiresAt == nil {
+		return ""
+	}
+	return entry.ExpiresAt.UTC().Format(time.RFC3339)
+}
+
+// entryType returns the type of an entry; backups written before entry
+// types existed hold logins only
+func entryType(entry *storage.PasswordEntry) string {
+	if entry.Type == "" {
+		return storage.EntryTypeLogin
+	}
+	return entry.Type
+}
+
+// joinTags renders tags in a stable order so reordering is not a change
+func joinTags(tags []string) string {
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"fmt"
+
+	"filippo.io/age"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/recipient"
+)
+
+// WriteExport writes data, an export in another tool's format, to path in
+// the backup envelope: encrypted to the age recipients if any are given,
+// else under passphrase. Like Write, it never overwrites a file.
+func WriteExport(path, format string, data []byte, passphrase string, recipients []string) error {
+	envelope := file{Format: Format, Version: Version, Export: format}
+	var err error
+	if len(recipients) > 0 {
+		envelope.Sealed, err = recipient.Wrap(string(data), recipients)
+	} else {
+		envelope.Data, err = crypto.EncryptBytes(data, passphrase)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt export: %w", err)
+	}
+	return writeFile(path, &envelope)
+}
+
+// IsSealedExport reports whether the file at path is an export encrypted
+// to age recipients, which ReadExport opens with identities rather than a
+// passphrase
+func IsSealedExport(path string) (bool, error) {
+	f, err := readExportFile(path)
+	if err != nil {
+		return false, err
+	}
+	return f.Sealed != "", nil
+}
+
+// ReadExport decrypts the export at path and returns its format and
+// contents
+func ReadExport(path, passphrase string, identities []age.Identity) (string, []byte, error) {
+	f, err := readExportFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if f.Sealed != "" {
+		data, err := recipient.Unwrap(f.Sealed, identities)
+		if err != nil {
+			return "", nil, err
+		}
+		return f.Export, []byte(data), nil
+	}
+	data, err := crypto.DecryptBytes(f.Data, passphrase)
+	if err != nil {
+		return "", nil, ErrInvalidPassphrase
+	}
+	return f.Export, data, nil
+}
+
+// readExportFile reads the envelope of the export at path
+func readExportFile(path string) (*file, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if f.Export == "" {
+		return nil, fmt.Errorf("%s is a backup, not an encrypted export", path)
+	}
+	return f, nil
+}
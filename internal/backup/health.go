@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"password-manager/internal/query"
+	"password-manager/internal/storage"
+)
+
+// Health summarizes the state of the vault a backup was made from. It
+// holds counts only, never names or secrets.
+type Health struct {
+	CreatedAt     time.Time `json:"created_at"`
+	AppVersion    string    `json:"app_version,omitempty"`
+	SchemaVersion int       `json:"schema_version"`
+	Entries       int       `json:"entries"`
+	Notes         int       `json:"notes,omitempty"`
+	// Strength counts entries by their cached strength level; Unrated
+	// counts those without an up-to-date grade
+	Strength map[string]int `json:"strength,omitempty"`
+	Unrated  int            `json:"unrated,omitempty"`
+	// Filter is set for a partial backup
+	Filter string `json:"filter,omitempty"`
+}
+
+// NewHealth summarizes entries. grades are the vault's cached strength
+// grades by entry ID; a grade older than the entry's last update is not
+// counted.
+func NewHealth(entries []*storage.PasswordEntry, grades map[int64]storage.StrengthGrade, appVersion string) *Health {
+	h := &Health{
+		AppVersion:    appVersion,
+		SchemaVersion: storage.SchemaVersion,
+		Entries:       len(entries),
+		Strength:      make(map[string]int),
+	}
+	for _, entry := range entries {
+		if entry.IsNote() {
+			h.Notes++
+			continue
+		}
+		grade, ok := grades[entry.ID]
+		if !ok || grade.AnalyzedAt.Before(entry.UpdatedAt) {
+			h.Unrated++
+			continue
+		}
+		h.Strength[grade.Level]++
+	}
+	return h
+}
+
+// Print renders the summary for people
+func (h *Health) Print(w io.Writer) {
+	fmt.Fprintf(w, "Created:  %s\n", h.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	if h.AppVersion != "" {
+		fmt.Fprintf(w, "Made by:  v%s (schema %d)\n", h.AppVersion, h.SchemaVersion)
+	}
+	fmt.Fprintf(w, "Entries:  %d", h.Entries)
+	if h.Notes > 0 {
+		fmt.Fprintf(w, " (%d notes)", h.Notes)
+	}
+	fmt.Fprintln(w)
+	if h.Filter != "" {
+		fmt.Fprintf(w, "Partial:  %s\n", h.Filter)
+	}
+
+	if len(h.Strength) == 0 && h.Unrated == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Strength:")
+	levels := make([]string, 0, len(h.Strength))
+	for level := range h.Strength {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levelRank(levels[i]) < levelRank(levels[j])
+	})
+	for _, level := range levels {
+		fmt.Fprintf(w, "  %-12s %d\n", level, h.Strength[level])
+	}
+	if h.Unrated > 0 {
+		fmt.Fprintf(w, "  %-12s %d\n", "Not rated", h.Unrated)
+	}
+}
+
+// levelRank orders strength levels, unknown ones last
+func levelRank(level string) int {
+	for i, known := range query.Levels {
+		if level == known {
+			return i
+		}
+	}
+	return len(query.Levels)
+}
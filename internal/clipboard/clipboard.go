@@ -0,0 +1,85 @@
+package clipboard
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ErrUnavailable is returned when there is no clipboard to use, as on a
+// headless system
+var ErrUnavailable = errors.New("no clipboard available")
+
+// Clipboard is the system clipboard
+type Clipboard interface {
+	Read() ([]byte, error)
+	Write(text []byte) error
+	Clear() error
+}
+
+// Fingerprint returns a hash of text. A process clearing the clipboard
+// later compares it with what the clipboard holds, so it never needs the
+// text itself.
+func Fingerprint(text []byte) string {
+	sum := sha256.Sum256(text)
+	return hex.EncodeToString(sum[:])
+}
+
+// ClearIfUnchanged clears the clipboard if it still holds the text with
+// the given fingerprint, and reports whether it did. Anything copied
+// since is left alone.
+func ClearIfUnchanged(c Clipboard, fingerprint string) (bool, error) {
+	current, err := c.Read()
+	if err != nil {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(Fingerprint(current)), []byte(fingerprint)) != 1 {
+		return false, nil
+	}
+	if err := c.Clear(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// commandClipboard runs external tools. Text goes through stdin so it
+// never shows up in the process list. Without a clear command the
+// clipboard is cleared by writing nothing to it.
+type commandClipboard struct {
+	readCmd  []string
+	writeCmd []string
+	clearCmd []string
+	// trim is a suffix the read tool adds to the contents
+	trim string
+}
+
+func (c commandClipboard) Read() ([]byte, error) {
+	out, err := exec.Command(c.readCmd[0], c.readCmd[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", c.readCmd[0], err)
+	}
+	return bytes.TrimSuffix(out, []byte(c.trim)), nil
+}
+
+func (c commandClipboard) Write(text []byte) error {
+	cmd := exec.Command(c.writeCmd[0], c.writeCmd[1:]...)
+	cmd.Stdin = bytes.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", c.writeCmd[0], err)
+	}
+	return nil
+}
+
+func (c commandClipboard) Clear() error {
+	if c.clearCmd == nil {
+		return c.Write(nil)
+	}
+	if err := exec.Command(c.clearCmd[0], c.clearCmd[1:]...).Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", c.clearCmd[0], err)
+	}
+	return nil
+}
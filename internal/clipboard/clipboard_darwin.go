@@ -0,0 +1,19 @@
+//go:build darwin
+
+package clipboard
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// New uses pbcopy and pbpaste
+func New() (Clipboard, error) {
+	if _, err := exec.LookPath("pbcopy"); err != nil {
+		return nil, fmt.Errorf("%w: pbcopy not found", ErrUnavailable)
+	}
+	return commandClipboard{
+		readCmd:  []string{"pbpaste"},
+		writeCmd: []string{"pbcopy"},
+	}, nil
+}
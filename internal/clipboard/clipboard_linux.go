@@ -0,0 +1,40 @@
+//go:build linux
+
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// New picks wl-clipboard on Wayland, and xclip or xsel on X11
+func New() (Clipboard, error) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err != nil {
+			return nil, fmt.Errorf("%w: Wayland session without wl-clipboard", ErrUnavailable)
+		}
+		return commandClipboard{
+			readCmd:  []string{"wl-paste", "--no-newline"},
+			writeCmd: []string{"wl-copy"},
+			clearCmd: []string{"wl-copy", "--clear"},
+		}, nil
+	}
+	if os.Getenv("DISPLAY") != "" {
+		if _, err := exec.LookPath("xclip"); err == nil {
+			return commandClipboard{
+				readCmd:  []string{"xclip", "-selection", "clipboard", "-out"},
+				writeCmd: []string{"xclip", "-selection", "clipboard", "-in"},
+			}, nil
+		}
+		if _, err := exec.LookPath("xsel"); err == nil {
+			return commandClipboard{
+				readCmd:  []string{"xsel", "--clipboard", "--output"},
+				writeCmd: []string{"xsel", "--clipboard", "--input"},
+				clearCmd: []string{"xsel", "--clipboard", "--clear"},
+			}, nil
+		}
+		return nil, fmt.Errorf("%w: neither xclip nor xsel is installed", ErrUnavailable)
+	}
+	return nil, fmt.Errorf("%w: no graphical session", ErrUnavailable)
+}
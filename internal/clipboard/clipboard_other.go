@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package clipboard
+
+// New reports that no clipboard is known on this platform
+func New() (Clipboard, error) {
+	return nil, ErrUnavailable
+}
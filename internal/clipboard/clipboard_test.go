@@ -0,0 +1,43 @@
+package clipboard
+
+import "testing"
+
+// memoryClipboard is a clipboard held in memory
+type memoryClipboard struct {
+	text    string
+	cleared bool
+}
+
+func (m *memoryClipboard) Read() ([]byte, error) { return []byte(m.text), nil }
+
+func (m *memoryClipboard) Write(text []byte) error {
+	m.text = string(text)
+	return nil
+}
+
+func (m *memoryClipboard) Clear() error {
+	m.text, m.cleared = "", true
+	return nil
+}
+
+func TestClearIfUnchanged(t *testing.T) {
+	c := &memoryClipboard{text: "hunter2"}
+	cleared, err := ClearIfUnchanged(c, Fingerprint([]byte("hunter2")))
+	if err != nil {
+		t.Fatalf("ClearIfUnchanged failed: %v", err)
+	}
+	if !cleared || !c.cleared || c.text != "" {
+		t.Errorf("Expected the copied password to be cleared, clipboard holds %q", c.text)
+	}
+}
+
+func TestClearIfUnchangedKeepsNewContents(t *testing.T) {
+	c := &memoryClipboard{text: "copied since"}
+	cleared, err := ClearIfUnchanged(c, Fingerprint([]byte("hunter2")))
+	if err != nil {
+		t.Fatalf("ClearIfUnchanged failed: %v", err)
+	}
+	if cleared || c.cleared || c.text != "copied since" {
+		t.Errorf("Expected newer clipboard contents to be kept, clipboard holds %q", c.text)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package clipboard
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// New drives Get-Clipboard and Set-Clipboard through PowerShell, which
+// unlike clip.exe can read the clipboard back and empty it
+func New() (Clipboard, error) {
+	if _, err := exec.LookPath("powershell"); err != nil {
+		return nil, fmt.Errorf("%w: powershell not found", ErrUnavailable)
+	}
+	return commandClipboard{
+		readCmd:  []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		writeCmd: []string{"powershell", "-NoProfile", "-Command", "Set-Clipboard -Value ([Console]::In.ReadToEnd())"},
+		clearCmd: []string{"powershell", "-NoProfile", "-Command", "Set-Clipboard -Value $null"},
+		trim:     "\r\n",
+	}, nil
+}
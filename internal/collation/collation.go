@@ -0,0 +1,93 @@
+// Package collation orders entry names the way a reader of a language
+// expects, so "Ärzte" sorts next to "Arzt" rather than after "Zebra".
+// Every listing that shows names in order goes through it.
+package collation
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Default is the locale used when none is configured: the root order of
+// the Unicode Collation Algorithm, which suits most languages
+const Default = "und"
+
+// Collator compares names in the order of a locale, ignoring case. Names
+// the locale ranks equal, such as "bank" and "Bank", are ordered by their
+// bytes, so every order it gives is total and the same from run to run.
+// It is safe for concurrent use.
+type Collator struct {
+	locale string
+	mu     sync.Mutex
+	c      *collate.Collator
+}
+
+// New returns the collator of locale, a BCP 47 tag such as "de" or
+// "sv-SE"; empty means Default. A locale without an order of its own gets
+// the closest one known, the root order if none is; a tag that is not a
+// locale at all is an error.
+func New(locale string) (*Collator, error) {
+	if locale == "" {
+		locale = Default
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, fmt.Errorf("unknown collation locale %q", locale)
+	}
+	return &Collator{locale: locale, c: collate.New(tag, collate.IgnoreCase)}, nil
+}
+
+// defaultCollator is what Of returns for nil
+var defaultCollator, _ = New(Default)
+
+// Of returns c, or the collator of Default if c is nil, so the zero value
+// of a struct holding a *Collator sorts sensibly
+func Of(c *Collator) *Collator {
+	if c == nil {
+		return defaultCollator
+	}
+	return c
+}
+
+// Locale returns the locale c was made for
+func (c *Collator) Locale() string {
+	return c.locale
+}
+
+// Compare returns -1, 0 or 1 as a sorts before, with or after b. It is 0
+// only when a and b are the same string.
+func (c *Collator) Compare(a, b string) int {
+	c.mu.Lock()
+	n := c.c.CompareString(a, b)
+	c.mu.Unlock()
+	if n != 0 {
+		return n
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Less reports whether a sorts before b
+func (c *Collator) Less(a, b string) bool {
+	return c.Compare(a, b) < 0
+}
+
+// Strings sorts names in place
+func (c *Collator) Strings(names []string) {
+	sort.SliceStable(names, func(i, j int) bool { return c.Less(names[i], names[j]) })
+}
+
+// Slice sorts s in place by the name name returns for each index, keeping
+// elements with the same name in the order they were in
+func (c *Collator) Slice(s interface{}, name func(i int) string) {
+	sort.SliceStable(s, func(i, j int) bool { return c.Less(name(i), name(j)) })
+}
@@ -0,0 +1,52 @@
+package collation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		locale string
+		names  []string
+		want   []string
+	}{
+		{"", []string{"Zebra", "Ärzte", "bank", "apple", "Bank", "Arzt"}, []string{"apple", "Arzt", "Ärzte", "Bank", "bank", "Zebra"}},
+		{"de", []string{"Zebra", "Ärzte", "Arzt", "Öl", "Ofen"}, []string{"Arzt", "Ärzte", "Ofen", "Öl", "Zebra"}},
+		// Swedish puts å, ä and ö after z
+		{"sv", []string{"Öl", "Zebra", "Ärzte", "Arzt"}, []string{"Arzt", "Zebra", "Ärzte", "Öl"}},
+		{"de-DE", []string{"b", "B", "a"}, []string{"a", "B", "b"}},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.locale)
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", tt.locale, err)
+		}
+		names := append([]string(nil), tt.names...)
+		c.Strings(names)
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.locale, names, tt.want)
+		}
+	}
+}
+
+func TestCompareIsTotal(t *testing.T) {
+	c := Of(nil)
+	if c.Compare("bank", "Bank") == 0 || c.Compare("bank", "Bank") != -c.Compare("Bank", "bank") {
+		t.Error("Expected names differing in case to be ordered, one way only")
+	}
+	if c.Compare("bank", "bank") != 0 {
+		t.Error("Expected a name to equal itself")
+	}
+	if c.Locale() != Default {
+		t.Errorf("Expected the default locale, got %q", c.Locale())
+	}
+}
+
+func TestUnknownLocale(t *testing.T) {
+	for _, locale := range []string{"xx", "C", "not a locale"} {
+		if _, err := New(locale); err == nil {
+			t.Errorf("Expected New(%q) to fail", locale)
+		}
+	}
+}
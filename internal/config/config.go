@@ -0,0 +1,313 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"password-manager/internal/collation"
+
+	"github.com/BurntSushi/toml"
+)
+
+// FileName is the name of the config file in the vault directory
+const FileName = "config.toml"
+
+// Config holds the settings read from the config file. The zero value is
+// the default configuration.
+type Config struct {
+	// AutoTag are the automatic tagging rules, applied in order
+	AutoTag []AutoTagRule `toml:"auto_tag"`
+	// AllowUnauthenticatedNames lets entry names be read before the
+	// master password is entered, for shell completion. Unset means true.
+	AllowUnauthenticatedNames *bool `toml:"allow_unauthenticated_names"`
+	// SyncConflictRetention is how long sync conflicts are logged, as a
+	// duration such as 90d. Empty means DefaultSyncConflictRetention.
+	SyncConflictRetention string `toml:"sync_conflict_retention"`
+	// ImportJournalRetention is how long imports can be rolled back, as
+	// a duration such as 30d. Empty means DefaultImportJournalRetention.
+	ImportJournalRetention string `toml:"import_journal_retention"`
+	// Hooks are commands run after the vault changes
+	Hooks Hooks `toml:"hooks"`
+	// Quota are soft limits on the size of the vault
+	Quota Quota `toml:"quota"`
+	// ClipboardClearAfter is how long a copied password stays on the
+	// clipboard, such as 45s; "0" keeps it there. Empty means
+	// DefaultClipboardClearAfter.
+	ClipboardClearAfter string `toml:"clipboard_clear_after"`
+	// IdleLockAfter is how long the interactive shell waits for a command
+	// before locking the vault, such as 10m; "0" never locks it. Empty
+	// means DefaultIdleLockAfter.
+	IdleLockAfter string `toml:"idle_lock_after"`
+	// AutoUpgradeKDF re-encrypts the vault right after unlock, without
+	// asking, once its key derivation parameters fall below the current
+	// ones
+	AutoUpgradeKDF bool `toml:"auto_upgrade_kdf"`
+	// PasswordHistory is how many replaced passwords are kept per entry;
+	// 0 keeps none. Unset means DefaultPasswordHistory.
+	PasswordHistory *int `toml:"password_history"`
+	// UnlockDigest shows, right after unlock at a terminal, what changed
+	// since this device last had the vault open. Unset means true.
+	UnlockDigest *bool `toml:"unlock_digest"`
+	// StrengthRefresh re-grades the cached password strengths in the
+	// background while the interactive shell waits for a command. Unset
+	// means true.
+	StrengthRefresh *bool `toml:"strength_refresh"`
+	// Profile bundles settings for a kind of device: ProfileStandard or
+	// ProfileLowPower. Empty means ProfileStandard.
+	Profile string `toml:"profile"`
+	// Collation is the locale entry names are sorted for, such as "de";
+	// empty means collation.Default. Case is ignored either way.
+	Collation string `toml:"collation"`
+	// TagStyles are the colors and icons of tags in list and search
+	// output, by tag
+	TagStyles map[string]TagStyle `toml:"tag_styles"`
+}
+
+// TagStyle is the display style of a tag in the [tag_styles] table. Styles
+// are presentation only, so they travel with the config rather than the
+// vault.
+type TagStyle struct {
+	Color string `toml:"color,omitempty"`
+	Icon  string `toml:"icon,omitempty"`
+}
+
+// Quota holds the soft limits of the [quota] table. They never stop a
+// write; stats and startup warn once the vault goes past one.
+type Quota struct {
+	// Entries is how many entries the vault should hold at most; 0 means
+	// no limit
+	Entries int `toml:"entries"`
+	// Size is how large the vault file should grow at most, such as
+	// "20MB"; empty means no limit
+	Size string `toml:"size"`
+}
+
+// Check reports the first invalid limit
+func (q *Quota) Check() error {
+	if q.Entries < 0 {
+		return fmt.Errorf("quota.entries cannot be negative")
+	}
+	if _, err := q.SizeBytes(); err != nil {
+		return fmt.Errorf("quota.size: %w", err)
+	}
+	return nil
+}
+
+// SizeBytes returns the size limit in bytes, 0 if none is set
+func (q *Quota) SizeBytes() (int64, error) {
+	if q.Size == "" {
+		return 0, nil
+	}
+	return ParseSize(q.Size)
+}
+
+// sizeUnits are the units ParseSize accepts, in powers of 1024
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// ParseSize reads a size such as 512KB or 20MB. The units are B, KB, MB
+// and GB, in powers of 1024; a bare number is a count of bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	n, err := strconv.ParseInt(s[:digits], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[digits:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q (supported: B, KB, MB, GB)", s)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * unit, nil
+}
+
+// Hooks are the commands of the [hooks] table, each run through the shell
+// after the matching change has been committed
+type Hooks struct {
+	PostSave   string `toml:"post_save"`
+	PostDelete string `toml:"post_delete"`
+	PostRotate string `toml:"post_rotate"`
+	PostImport string `toml:"post_import"`
+}
+
+// Command returns the hook for an event (save, delete, rotate or
+// import), empty if none is set
+func (h *Hooks) Command(event string) string {
+	switch event {
+	case "save":
+		return h.PostSave
+	case "delete":
+		return h.PostDelete
+	case "rotate":
+		return h.PostRotate
+	case "import":
+		return h.PostImport
+	}
+	return ""
+}
+
+// DefaultSyncConflictRetention is how long sync conflicts are kept when
+// the config does not say
+const DefaultSyncConflictRetention = "90d"
+
+// ConflictRetention returns the sync conflict retention setting
+func (c *Config) ConflictRetention() string {
+	if c.SyncConflictRetention == "" {
+		return DefaultSyncConflictRetention
+	}
+	return c.SyncConflictRetention
+}
+
+// DefaultImportJournalRetention is how long the operations journal keeps
+// the state before an import when the config does not say
+const DefaultImportJournalRetention = "90d"
+
+// JournalRetention returns the import journal retention setting
+func (c *Config) JournalRetention() string {
+	if c.ImportJournalRetention == "" {
+		return DefaultImportJournalRetention
+	}
+	return c.ImportJournalRetention
+}
+
+// DefaultClipboardClearAfter is how long a copied password stays on the
+// clipboard when the config does not say
+const DefaultClipboardClearAfter = "30s"
+
+// ClipboardClear returns the clipboard_clear_after setting
+func (c *Config) ClipboardClear() string {
+	if c.ClipboardClearAfter == "" {
+		return DefaultClipboardClearAfter
+	}
+	return c.ClipboardClearAfter
+}
+
+// DefaultIdleLockAfter is how long the interactive shell stays unlocked
+// without a command when the config does not say
+const DefaultIdleLockAfter = "5m"
+
+// IdleLock returns the idle_lock_after setting
+func (c *Config) IdleLock() string {
+	if c.IdleLockAfter == "" {
+		return DefaultIdleLockAfter
+	}
+	return c.IdleLockAfter
+}
+
+// DefaultPasswordHistory is how many replaced passwords are kept per
+// entry when the config does not say
+const DefaultPasswordHistory = 5
+
+// HistoryLimit returns how many replaced passwords are kept per entry
+func (c *Config) HistoryLimit() (int, error) {
+	if c.PasswordHistory == nil {
+		return DefaultPasswordHistory, nil
+	}
+	if *c.PasswordHistory < 0 {
+		return 0, fmt.Errorf("password_history cannot be negative")
+	}
+	return *c.PasswordHistory, nil
+}
+
+// Device profiles
+const (
+	ProfileStandard = "standard"
+	// ProfileLowPower suits slow devices such as a Raspberry Pi
+	ProfileLowPower = "low-power"
+)
+
+// Tuning holds the settings a profile resolves to
+type Tuning struct {
+	// ProgressInterval is the least time between two redraws of a
+	// progress counter; 0 redraws it on every step
+	ProgressInterval time.Duration
+}
+
+// profiles are the known profiles and what they resolve to
+var profiles = map[string]Tuning{
+	ProfileStandard: {},
+	ProfileLowPower: {ProgressInterval: 500 * time.Millisecond},
+}
+
+// Tuning returns the settings of the profile the config chooses
+func (c *Config) Tuning() (Tuning, error) {
+	name := c.Profile
+	if name == "" {
+		name = ProfileStandard
+	}
+	tuning, ok := profiles[name]
+	if !ok {
+		return Tuning{}, fmt.Errorf("unknown profile %q (supported: %s, %s)", c.Profile, ProfileStandard, ProfileLowPower)
+	}
+	return tuning, nil
+}
+
+// Collator returns the collator of the collation setting. An unknown
+// locale gives the default collator along with the error, so names are
+// still sorted.
+func (c *Config) Collator() (*collation.Collator, error) {
+	collator, err := collation.New(c.Collation)
+	if err != nil {
+		return collation.Of(nil), fmt.Errorf("collation: %w", err)
+	}
+	return collator, nil
+}
+
+// NamesWithoutUnlock reports whether entry names may be read without the
+// master password
+func (c *Config) NamesWithoutUnlock() bool {
+	return c.AllowUnauthenticatedNames == nil || *c.AllowUnauthenticatedNames
+}
+
+// ShowUnlockDigest reports whether the digest is shown after unlock
+func (c *Config) ShowUnlockDigest() bool {
+	return c.UnlockDigest == nil || *c.UnlockDigest
+}
+
+// RefreshStrength reports whether the interactive shell refreshes the
+// cached strength grades in the background
+func (c *Config) RefreshStrength() bool {
+	return c.StrengthRefresh == nil || *c.StrengthRefresh
+}
+
+// AutoTagRule adds and removes tags on entries matching a --where
+// expression
+type AutoTagRule struct {
+	Match      string   `toml:"match"`
+	AddTags    []string `toml:"add_tags"`
+	RemoveTags []string `toml:"remove_tags"`
+}
+
+// Load reads the config file at path. A missing file gives the default
+// configuration; unknown keys are an error so typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	var c Config
+	meta, err := toml.DecodeFile(path, &c)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return nil, fmt.Errorf("unknown setting in config %s: %s", path, strings.Join(keys, ", "))
+	}
+	return &c, nil
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAutoTag(t *testing.T) {
+	path := writeConfig(t, `
+[[auto_tag]]
+match = "url ~ .internal"
+add_tags = ["infra"]
+
+[[auto_tag]]
+match = "tag = legacy"
+add_tags = ["review"]
+remove_tags = ["current"]
+`)
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []AutoTagRule{
+		{Match: "url ~ .internal", AddTags: []string{"infra"}},
+		{Match: "tag = legacy", AddTags: []string{"review"}, RemoveTags: []string{"current"}},
+	}
+	if !reflect.DeepEqual(c.AutoTag, want) {
+		t.Errorf("AutoTag = %+v, want %+v", c.AutoTag, want)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	c, err := Load(filepath.Join(t.TempDir(), FileName))
+	if err != nil || len(c.AutoTag) != 0 {
+		t.Errorf("Expected the default config for a missing file, got %+v, %v", c, err)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := writeConfig(t, "[[auto_tag]]\nmatch = \"name ~ aws\"\nadd_tag = [\"cloud\"]\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "auto_tag.add_tag") {
+		t.Errorf("Expected an unknown key error, got %v", err)
+	}
+
+	path = writeConfig(t, "[[auto_tag]\n")
+	if _, err := Load(path); err == nil {
+		t.Error("Expected a syntax error")
+	}
+}
+
+func TestNamesWithoutUnlock(t *testing.T) {
+	if !(&Config{}).NamesWithoutUnlock() {
+		t.Error("Expected names to be readable without unlocking by default")
+	}
+	for content, want := range map[string]bool{
+		"allow_unauthenticated_names = true\n":  true,
+		"allow_unauthenticated_names = false\n": false,
+	} {
+		c, err := Load(writeConfig(t, content))
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got := c.NamesWithoutUnlock(); got != want {
+			t.Errorf("%q: NamesWithoutUnlock() = %v, want %v", content, got, want)
+		}
+	}
+}
+
+func TestShowUnlockDigest(t *testing.T) {
+	if !(&Config{}).ShowUnlockDigest() {
+		t.Error("Expected the digest to be shown by default")
+	}
+	c, err := Load(writeConfig(t, "unlock_digest = false\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.ShowUnlockDigest() {
+		t.Error("Expected unlock_digest = false to hide the digest")
+	}
+}
+
+func TestRefreshStrength(t *testing.T) {
+	if !(&Config{}).RefreshStrength() {
+		t.Error("Expected the strength refresh to be on by default")
+	}
+	c, err := Load(writeConfig(t, "strength_refresh = false\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.RefreshStrength() {
+		t.Error("Expected strength_refresh = false to turn it off")
+	}
+}
+
+func TestLoadHooks(t *testing.T) {
+	c, err := Load(writeConfig(t, `
+[hooks]
+post_save = "~/bin/on-vault-change"
+post_import = "sync-vault --quiet"
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.Hooks.Command("save") != "~/bin/on-vault-change" || c.Hooks.Command("import") != "sync-vault --quiet" || c.Hooks.Command("delete") != "" {
+		t.Errorf("Unexpected hooks: %+v", c.Hooks)
+	}
+}
+
+func TestLoadQuota(t *testing.T) {
+	path := writeConfig(t, "[quota]\nentries = 500\nsize = \"20MB\"\n")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := c.Quota.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if size, _ := c.Quota.SizeBytes(); c.Quota.Entries != 500 || size != 20<<20 {
+		t.Errorf("Quota = %d entries, %d bytes", c.Quota.Entries, size)
+	}
+
+	for _, bad := range []Quota{{Entries: -1}, {Size: "20 parsecs"}, {Size: "MB"}, {Size: "99999999999GB"}} {
+		if err := bad.Check(); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	c, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if limit, err := c.HistoryLimit(); err != nil || limit != DefaultPasswordHistory {
+		t.Errorf("Expected the default limit, got %d, %v", limit, err)
+	}
+
+	if c, err = Load(writeConfig(t, "password_history = 0\n")); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if limit, err := c.HistoryLimit(); err != nil || limit != 0 {
+		t.Errorf("Expected history to be off, got %d, %v", limit, err)
+	}
+
+	if c, err = Load(writeConfig(t, "password_history = -1\n")); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, err := c.HistoryLimit(); err == nil {
+		t.Error("Expected a negative limit to be rejected")
+	}
+}
+
+func TestTuning(t *testing.T) {
+	for _, tt := range []struct {
+		profile string
+		want    Tuning
+	}{
+		{"", Tuning{}},
+		{"standard", Tuning{}},
+		{"low-power", Tuning{ProgressInterval: 500 * time.Millisecond}},
+	} {
+		c, err := Load(writeConfig(t, fmt.Sprintf("profile = %q\n", tt.profile)))
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got, err := c.Tuning(); err != nil || got != tt.want {
+			t.Errorf("profile %q: got %+v, %v, want %+v", tt.profile, got, err, tt.want)
+		}
+	}
+
+	c := &Config{Profile: "turbo"}
+	if _, err := c.Tuning(); err == nil {
+		t.Error("Expected an unknown profile to be rejected")
+	}
+}
+
+func TestCollator(t *testing.T) {
+	c, err := Load(writeConfig(t, "collation = \"de\"\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if collator, err := c.Collator(); err != nil || collator.Locale() != "de" {
+		t.Errorf("Expected the de collator, got %v", err)
+	}
+	if collator, err := (&Config{}).Collator(); err != nil || collator.Locale() != "und" {
+		t.Errorf("Expected the default collator, got %v", err)
+	}
+
+	// An unknown locale falls back to the default order
+	collator, err := (&Config{Collation: "xx"}).Collator()
+	if err == nil || collator == nil || collator.Locale() != "und" {
+		t.Errorf("Expected the default collator with an error, got %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"0": 0, "512": 512, "10B": 10, "4kb": 4096, "20 MB": 20 << 20, "1GB": 1 << 30} {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+}
+
+func TestSetTagStyle(t *testing.T) {
+	path := writeConfig(t, `# Sorted for German
+collation = "de"
+
+[tag_styles.work]
+color = "blue"
+
+[hooks]
+post_save = "git commit -qam sync" # after every save
+`)
+	if err := SetTagStyle(path, "home", TagStyle{Color: "green", Icon: "H"}); err != nil {
+		t.Fatalf("SetTagStyle failed: %v", err)
+	}
+	if err := SetTagStyle(path, "work", TagStyle{Color: "red"}); err != nil {
+		t.Fatalf("SetTagStyle failed: %v", err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := map[string]TagStyle{"home": {Color: "green", Icon: "H"}, "work": {Color: "red"}}
+	if !reflect.DeepEqual(c.TagStyles, want) {
+		t.Errorf("TagStyles = %+v, want %+v", c.TagStyles, want)
+	}
+	if c.Collation != "de" || c.Hooks.PostSave != "git commit -qam sync" {
+		t.Errorf("Expected the other settings to be kept, got %+v", c)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"# Sorted for German", "# after every save"} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("Expected %q to be kept in:\n%s", comment, data)
+		}
+	}
+
+	// Removing the last style removes the table
+	for _, tag := range []string{"home", "work"} {
+		if err := SetTagStyle(path, tag, TagStyle{}); err != nil {
+			t.Fatalf("SetTagStyle failed: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "tag_styles") {
+		t.Errorf("Expected no tag_styles table, got:\n%s", data)
+	}
+}
+
+func TestSetTagStyleNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pm", FileName)
+	if err := SetTagStyle(path, "work", TagStyle{Icon: "W"}); err != nil {
+		t.Fatalf("SetTagStyle failed: %v", err)
+	}
+	c, err := Load(path)
+	if err != nil || c.TagStyles["work"] != (TagStyle{Icon: "W"}) {
+		t.Errorf("Expected the style to be saved, got %+v, %v", c, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a 0600 config file, got %v, %v", info, err)
+	}
+}
+
+func TestSetTagStyleInline(t *testing.T) {
+	content := "tag_styles = { work = { color = \"blue\" } }\n"
+	path := writeConfig(t, content)
+	if err := SetTagStyle(path, "home", TagStyle{Color: "green"}); err == nil {
+		t.Error("Expected inline tag styles to be refused")
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Errorf("Expected the config to be left alone, got:\n%s", data)
+	}
+}
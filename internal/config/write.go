@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SetTagStyle stores the style of tag in the config file at path; an
+// empty style removes it. The [tag_styles] tables are written anew at the
+// end of the file and the rest is kept as it is, comments included. A
+// file whose tag styles are not in tables of their own is left alone
+// with an error, as they cannot be replaced without rewriting it.
+func SetTagStyle(path, tag string, style TagStyle) error {
+	c, err := Load(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	styles := make(map[string]TagStyle, len(c.TagStyles)+1)
+	for name, s := range c.TagStyles {
+		styles[name] = s
+	}
+	if style == (TagStyle{}) {
+		delete(styles, tag)
+	} else {
+		styles[tag] = style
+	}
+
+	content := strings.TrimRight(withoutTagStyles(string(data)), "\n")
+	if len(styles) > 0 {
+		var table bytes.Buffer
+		enc := toml.NewEncoder(&table)
+		enc.Indent = ""
+		if err := enc.Encode(struct {
+			TagStyles map[string]TagStyle `toml:"tag_styles"`
+		}{styles}); err != nil {
+			return fmt.Errorf("failed to encode tag styles: %w", err)
+		}
+		if content != "" {
+			content += "\n\n"
+		}
+		content += strings.TrimLeft(table.String(), "\n")
+	} else if content != "" {
+		content += "\n"
+	}
+
+	// Everything but the tag styles must read back as it was
+	want := *c
+	want.TagStyles = styles
+	if len(styles) == 0 {
+		want.TagStyles = nil
+	}
+	var got Config
+	if _, err := toml.Decode(content, &got); err != nil || !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("config %s: tag_styles cannot be updated in place; edit it by hand", path)
+	}
+	return Write(path, []byte(content))
+}
+
+// withoutTagStyles returns content with its [tag_styles] tables left out
+func withoutTagStyles(content string) string {
+	var kept []string
+	skipping := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if header, ok := tableHeader(line); ok {
+			skipping = header == "tag_styles" || strings.HasPrefix(header, "tag_styles.")
+		}
+		if !skipping {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// tableHeader returns the key of the table line opens, such as
+// "tag_styles.work" for [tag_styles.work], with the spaces around its
+// parts removed
+func tableHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "#"); i >= 0 && strings.HasPrefix(line, "[") {
+		line = strings.TrimSpace(line[:i])
+	}
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	key := strings.Trim(line, "[]")
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.Join(parts, "."), true
+}
+
+// Write replaces the config file at path with data. The file is written
+// next to it first and renamed over it, so a failed write leaves the old
+// config in place; it is readable by its owner only.
+func Write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	// A file left over with wider permissions keeps them through WriteFile
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	return nil
+}
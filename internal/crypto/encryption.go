@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -18,27 +19,54 @@ const (
 	NonceLength    = 12 // GCM nonce size
 )
 
+// ErrDecrypt is returned when data does not decrypt under the key or
+// password given: the password is wrong or the data has been changed
+var ErrDecrypt = errors.New("failed to decrypt")
+
 // EncryptedData represents encrypted data with metadata
 type EncryptedData struct {
-	Salt      []byte `json:"salt"`
+	Salt      []byte `json:"salt,omitempty"`
 	Nonce     []byte `json:"nonce"`
 	Ciphertext []byte `json:"ciphertext"`
 	Tag       []byte `json:"tag"`
+	// KDF is how the key was derived; nil on blobs from before it was
+	// recorded, which used LegacyKDF
+	KDF *KDFParams `json:"kdf,omitempty"`
 }
 
-// DeriveKey derives a cryptographic key from password using PBKDF2
-func DeriveKey(password string, salt []byte) ([]byte, error) {
-	if len(salt) != SaltLength {
-		return nil, fmt.Errorf("invalid salt length: expected %d, got %d", SaltLength, len(salt))
+// Params returns the KDF parameters the data was encrypted with
+func (e *EncryptedData) Params() KDFParams {
+	if e.KDF == nil {
+		return LegacyKDF
 	}
-	
-	// Derive key using PBKDF2-SHA256
-	key := pbkdf2.Key([]byte(password), salt, Iterations, KeyLength, sha256.New)
-	return key, nil
+	return *e.KDF
+}
+
+// DeriveKey derives a cryptographic key from password with DefaultKDF
+func DeriveKey(password string, salt []byte) ([]byte, error) {
+	return DeriveKeyWithParams(password, salt, DefaultKDF)
 }
 
-// Encrypt encrypts plaintext using AES-256-GCM
+// Encrypt encrypts plaintext using AES-256-GCM under a key derived with
+// DefaultKDF
 func Encrypt(plaintext string, password string) (*EncryptedData, error) {
+	return EncryptBytesWithParams([]byte(plaintext), password, DefaultKDF)
+}
+
+// EncryptWithParams encrypts like Encrypt under a key derived with p
+func EncryptWithParams(plaintext string, password string, p KDFParams) (*EncryptedData, error) {
+	return EncryptBytesWithParams([]byte(plaintext), password, p)
+}
+
+// EncryptBytes encrypts like Encrypt but takes the plaintext as a byte
+// slice, which the caller can wipe afterwards
+func EncryptBytes(plaintext []byte, password string) (*EncryptedData, error) {
+	return EncryptBytesWithParams(plaintext, password, DefaultKDF)
+}
+
+// EncryptBytesWithParams encrypts like EncryptBytes under a key derived
+// with p
+func EncryptBytesWithParams(plaintext []byte, password string, p KDFParams) (*EncryptedData, error) {
 	// Generate random salt
 	salt := make([]byte, SaltLength)
 	if _, err := rand.Read(salt); err != nil {
@@ -46,10 +74,28 @@ func Encrypt(plaintext string, password string) (*EncryptedData, error) {
 	}
 
 	// Derive key from password
-	key, err := DeriveKey(password, salt)
+	key, err := DeriveKeyWithParams(password, salt, p)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
+	defer zeroBytes(key)
+
+	encryptedData, err := EncryptWithKey(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	encryptedData.Salt = salt
+	encryptedData.KDF = &p
+	return encryptedData, nil
+}
+
+// EncryptWithKey encrypts plaintext using AES-256-GCM directly under key,
+// which must be KeyLength random bytes. Nothing is derived, so the result
+// has no salt or KDF; a key from a password goes through Encrypt instead.
+func EncryptWithKey(key []byte, plaintext []byte) (*EncryptedData, error) {
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("invalid key length: expected %d, got %d", KeyLength, len(key))
+	}
 
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
@@ -70,67 +116,83 @@ func Encrypt(plaintext string, password string) (*EncryptedData, error) {
 	}
 
 	// Encrypt and authenticate
-	ciphertext := gcm.Seal(nil, nonce, []byte(plaintext), nil)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
 
 	// Split ciphertext and tag
 	tagStart := len(ciphertext) - gcm.Overhead()
-	encryptedData := &EncryptedData{
-		Salt:      salt,
-		Nonce:     nonce,
+	return &EncryptedData{
+		Nonce:      nonce,
 		Ciphertext: ciphertext[:tagStart],
-		Tag:       ciphertext[tagStart:],
-	}
-
-	// Zero out sensitive data
-	zeroBytes(key)
-	
-	return encryptedData, nil
+		Tag:        ciphertext[tagStart:],
+	}, nil
 }
 
-// Decrypt decrypts ciphertext using AES-256-GCM
+// Decrypt decrypts ciphertext using AES-256-GCM, deriving the key with
+// the KDF recorded in it
 func Decrypt(encryptedData *EncryptedData, password string) (string, error) {
+	plaintext, err := DecryptBytes(encryptedData, password)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(plaintext)
+	return string(plaintext), nil
+}
+
+// DecryptBytes decrypts like Decrypt but returns the plaintext as a byte
+// slice, which unlike a string can be wiped once it is no longer needed
+func DecryptBytes(encryptedData *EncryptedData, password string) ([]byte, error) {
 	// Validate input
 	if encryptedData == nil {
-		return "", fmt.Errorf("encrypted data is nil")
+		return nil, fmt.Errorf("encrypted data is nil")
 	}
 	if len(encryptedData.Salt) != SaltLength {
-		return "", fmt.Errorf("invalid salt length")
-	}
-	if len(encryptedData.Nonce) != NonceLength {
-		return "", fmt.Errorf("invalid nonce length")
+		return nil, fmt.Errorf("invalid salt length")
 	}
 
 	// Derive key from password
-	key, err := DeriveKey(password, encryptedData.Salt)
+	key, err := DeriveKeyWithParams(password, encryptedData.Salt, encryptedData.Params())
 	if err != nil {
-		return "", fmt.Errorf("failed to derive key: %w", err)
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer zeroBytes(key)
+
+	return DecryptWithKey(key, encryptedData)
+}
+
+// DecryptWithKey decrypts data produced by EncryptWithKey under key
+func DecryptWithKey(key []byte, encryptedData *EncryptedData) ([]byte, error) {
+	// Validate input
+	if encryptedData == nil {
+		return nil, fmt.Errorf("encrypted data is nil")
+	}
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("invalid key length: expected %d, got %d", KeyLength, len(key))
+	}
+	if len(encryptedData.Nonce) != NonceLength {
+		return nil, fmt.Errorf("invalid nonce length")
 	}
 
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
 	}
 
 	// Create GCM mode
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM mode: %w", err)
+		return nil, fmt.Errorf("failed to create GCM mode: %w", err)
 	}
 
 	// Combine ciphertext and tag
-	ciphertext := append(encryptedData.Ciphertext, encryptedData.Tag...)
+	ciphertext := append(encryptedData.Ciphertext[:len(encryptedData.Ciphertext):len(encryptedData.Ciphertext)], encryptedData.Tag...)
 
 	// Decrypt and authenticate
 	plaintext, err := gcm.Open(nil, encryptedData.Nonce, ciphertext, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
 	}
-
-	// Zero out sensitive data
-	zeroBytes(key)
-	
-	return string(plaintext), nil
+	return plaintext, nil
 }
 
 // GenerateRandomBytes generates cryptographically secure random bytes
@@ -179,6 +241,14 @@ func VerifyPassword(password, hash string) (bool, error) {
 	return constantTimeCompare(derivedKey, storedHash), nil
 }
 
+// SecretsEqual compares two secrets in constant time. Both are hashed
+// first so that not even their lengths leak through timing.
+func SecretsEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return constantTimeCompare(ha[:], hb[:])
+}
+
 // constantTimeCompare performs constant-time comparison to prevent timing attacks
 func constantTimeCompare(a, b []byte) bool {
 	if len(a) != len(b) {
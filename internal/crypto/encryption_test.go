@@ -230,6 +230,18 @@ func TestConstantTimeCompare(t *testing.T) {
 	}
 }
 
+func TestSecretsEqual(t *testing.T) {
+	if !SecretsEqual("hunter2", "hunter2") {
+		t.Error("Identical secrets should compare equal")
+	}
+	if SecretsEqual("hunter2", "hunter3") || SecretsEqual("hunter2", "hunter") || SecretsEqual("", "x") {
+		t.Error("Different secrets should not compare equal")
+	}
+	if !SecretsEqual("", "") {
+		t.Error("Empty secrets should compare equal")
+	}
+}
+
 func TestZeroBytes(t *testing.T) {
 	bytes := []byte{1, 2, 3, 4, 5}
 	zeroBytes(bytes)
@@ -240,3 +252,35 @@ func TestZeroBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestEncryptWithKey(t *testing.T) {
+	key, err := GenerateRandomBytes(KeyLength)
+	if err != nil {
+		t.Fatalf("GenerateRandomBytes failed: %v", err)
+	}
+
+	encrypted, err := EncryptWithKey(key, []byte("direct"))
+	if err != nil {
+		t.Fatalf("EncryptWithKey failed: %v", err)
+	}
+	// Nothing is derived, so there is no salt or KDF to record
+	if encrypted.Salt != nil || encrypted.KDF != nil {
+		t.Errorf("Expected no salt or KDF, got %+v", encrypted)
+	}
+	plaintext, err := DecryptWithKey(key, encrypted)
+	if err != nil || string(plaintext) != "direct" {
+		t.Errorf("DecryptWithKey = %q, %v", plaintext, err)
+	}
+
+	other, _ := GenerateRandomBytes(KeyLength)
+	if _, err := DecryptWithKey(other, encrypted); err == nil {
+		t.Error("Expected decryption with another key to fail")
+	}
+	if _, err := EncryptWithKey(key[:16], []byte("short")); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+	// A password cannot stand in for the key the data was sealed under
+	if _, err := Decrypt(encrypted, string(key)); err == nil {
+		t.Error("Expected Decrypt to refuse data without a salt")
+	}
+}
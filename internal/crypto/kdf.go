@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Key derivation functions
+const (
+	KDFPBKDF2   = "pbkdf2-sha256"
+	KDFArgon2id = "argon2id"
+)
+
+// maxArgon2Memory bounds the memory a blob may ask Argon2id for, in KiB,
+// so a damaged or hostile vault cannot exhaust memory on unlock
+const maxArgon2Memory = 4 << 20
+
+// KDFParams are the key derivation function and parameters a key was
+// derived with. They are stored with every EncryptedData written since
+// Argon2id was added; blobs without them are LegacyKDF.
+type KDFParams struct {
+	Algorithm string `json:"algorithm"`
+	// Iterations is the iteration count of PBKDF2 or the number of passes
+	// of Argon2id
+	Iterations uint32 `json:"iterations"`
+	// Memory is the memory of Argon2id in KiB
+	Memory uint32 `json:"memory,omitempty"`
+	// Threads is the parallelism of Argon2id
+	Threads uint8 `json:"threads,omitempty"`
+}
+
+var (
+	// LegacyKDF is what blobs without KDF parameters were derived with
+	LegacyKDF = KDFParams{Algorithm: KDFPBKDF2, Iterations: Iterations}
+	// DefaultKDF is what Encrypt derives keys with: Argon2id with 64 MiB,
+	// 3 passes and 4 lanes
+	DefaultKDF = KDFParams{Algorithm: KDFArgon2id, Iterations: 3, Memory: 64 << 10, Threads: 4}
+)
+
+// Validate rejects unknown algorithms and parameters out of range
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFPBKDF2:
+		if p.Iterations == 0 {
+			return fmt.Errorf("invalid PBKDF2 iteration count 0")
+		}
+	case KDFArgon2id:
+		if p.Iterations == 0 || p.Threads == 0 {
+			return fmt.Errorf("invalid Argon2id parameters: %d passes, %d lanes", p.Iterations, p.Threads)
+		}
+		if p.Memory < 8*uint32(p.Threads) || p.Memory > maxArgon2Memory {
+			return fmt.Errorf("invalid Argon2id memory %d KiB", p.Memory)
+		}
+	default:
+		return fmt.Errorf("unknown KDF %q", p.Algorithm)
+	}
+	return nil
+}
+
+// Weaker reports whether keys derived with p are cheaper to guess than
+// keys derived with floor: PBKDF2 against Argon2id, or fewer iterations
+// or less memory with the same function
+func (p KDFParams) Weaker(floor KDFParams) bool {
+	if p.Algorithm != floor.Algorithm {
+		return p.Algorithm == KDFPBKDF2 && floor.Algorithm == KDFArgon2id
+	}
+	return p.Iterations < floor.Iterations || p.Memory < floor.Memory
+}
+
+// String describes p, such as "argon2id (3 passes, 64 MiB, 4 lanes)"
+func (p KDFParams) String() string {
+	if p.Algorithm != KDFArgon2id {
+		return fmt.Sprintf("%s (%d iterations)", p.Algorithm, p.Iterations)
+	}
+	memory := fmt.Sprintf("%d KiB", p.Memory)
+	if p.Memory%1024 == 0 {
+		memory = fmt.Sprintf("%d MiB", p.Memory/1024)
+	}
+	return fmt.Sprintf("%s (%d passes, %s, %d lanes)", p.Algorithm, p.Iterations, memory, p.Threads)
+}
+
+// DeriveKeyWithParams derives a KeyLength key from password and salt
+// with the function and parameters of p
+func DeriveKeyWithParams(password string, salt []byte, p KDFParams) ([]byte, error) {
+	if len(salt) != SaltLength {
+		return nil, fmt.Errorf("invalid salt length: expected %d, got %d", SaltLength, len(salt))
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Algorithm == KDFArgon2id {
+		return argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Threads, KeyLength), nil
+	}
+	return pbkdf2.Key([]byte(password), salt, int(p.Iterations), KeyLength, sha256.New), nil
+}
@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// legacyBlob was encrypted before KDF parameters were recorded, with a
+// PBKDF2 key, salt 0..31 and a fixed nonce
+const legacyBlob = `{
+	"salt": "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=",
+	"nonce": "oKGio6Slpqeoqaqr",
+	"ciphertext": "CvOLVayyiMlgLtxTKkxVuzJcgLrc4v1tmMc=",
+	"tag": "XxeAJuxDQZCQo79hnoriQA=="
+}`
+
+func TestDecryptLegacyBlob(t *testing.T) {
+	var encrypted EncryptedData
+	if err := json.Unmarshal([]byte(legacyBlob), &encrypted); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if encrypted.Params() != LegacyKDF {
+		t.Errorf("Expected a blob without parameters to use %+v, got %+v", LegacyKDF, encrypted.Params())
+	}
+	plaintext, err := Decrypt(&encrypted, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if plaintext != "Known answer: p@ssw0rd ✓" {
+		t.Errorf("Unexpected plaintext %q", plaintext)
+	}
+}
+
+func TestEncryptRecordsKDF(t *testing.T) {
+	params := KDFParams{Algorithm: KDFArgon2id, Iterations: 1, Memory: 64, Threads: 1}
+	encrypted, err := EncryptWithParams("secret", "password", params)
+	if err != nil {
+		t.Fatalf("EncryptWithParams failed: %v", err)
+	}
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded EncryptedData
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Params() != params {
+		t.Errorf("Expected %+v to be recorded, got %+v", params, decoded.Params())
+	}
+	if plaintext, err := Decrypt(&decoded, "password"); err != nil || plaintext != "secret" {
+		t.Errorf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	// The same password and salt give different keys under different
+	// parameters
+	salt := make([]byte, SaltLength)
+	argon, _ := DeriveKeyWithParams("password", salt, params)
+	legacy, _ := DeriveKeyWithParams("password", salt, LegacyKDF)
+	if bytes.Equal(argon, legacy) {
+		t.Error("Expected Argon2id and PBKDF2 keys to differ")
+	}
+}
+
+func TestKDFParamsValidate(t *testing.T) {
+	if err := DefaultKDF.Validate(); err != nil {
+		t.Errorf("DefaultKDF invalid: %v", err)
+	}
+	for _, p := range []KDFParams{
+		{Algorithm: "scrypt", Iterations: 1},
+		{Algorithm: KDFPBKDF2},
+		{Algorithm: KDFArgon2id, Iterations: 0, Memory: 64, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: 64, Threads: 0},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: 4, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: maxArgon2Memory + 1, Threads: 1},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", p)
+		}
+		if _, err := DeriveKeyWithParams("password", make([]byte, SaltLength), p); err == nil {
+			t.Errorf("Expected DeriveKeyWithParams to reject %+v", p)
+		}
+	}
+}
+
+func TestKDFParamsWeaker(t *testing.T) {
+	tests := []struct {
+		p    KDFParams
+		want bool
+	}{
+		{LegacyKDF, true},
+		{DefaultKDF, false},
+		{KDFParams{Algorithm: KDFArgon2id, Iterations: 1, Memory: 64 << 10, Threads: 4}, true},
+		{KDFParams{Algorithm: KDFArgon2id, Iterations: 3, Memory: 19 << 10, Threads: 1}, true},
+		{KDFParams{Algorithm: KDFArgon2id, Iterations: 4, Memory: 256 << 10, Threads: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Weaker(DefaultKDF); got != tt.want {
+			t.Errorf("%v.Weaker(DefaultKDF) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if DefaultKDF.Weaker(LegacyKDF) {
+		t.Error("Expected Argon2id not to be weaker than PBKDF2")
+	}
+	if got := DefaultKDF.String(); got != "argon2id (3 passes, 64 MiB, 4 lanes)" {
+		t.Errorf("Unexpected description %q", got)
+	}
+}
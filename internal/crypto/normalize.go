@@ -0,0 +1,16 @@
+package crypto
+
+import "golang.org/x/text/unicode/norm"
+
+// MaxPasswordLength is the longest password, in bytes once normalized,
+// that a vault accepts
+const MaxPasswordLength = 1024
+
+// NormalizePassword returns password in Unicode normalization form NFKC,
+// the form keys are derived from. The same accented letter may be typed as
+// one code point on one system and as a letter and a combining mark on
+// another (macOS input methods often produce the latter); both give the
+// same normalized password.
+func NormalizePassword(password string) string {
+	return norm.NFKC.String(password)
+}
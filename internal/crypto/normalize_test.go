@@ -0,0 +1,39 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNormalizePassword(t *testing.T) {
+	// "Straße-été" with its accents composed and decomposed
+	composed, decomposed := "Stra\u00dfe-\u00e9t\u00e9", "Stra\u00dfe-e\u0301te\u0301"
+	if composed == decomposed {
+		t.Fatal("Expected the two forms to differ before normalization")
+	}
+	if NormalizePassword(composed) != NormalizePassword(decomposed) {
+		t.Fatalf("Expected %q and %q to normalize alike", composed, decomposed)
+	}
+
+	// The forms derive the same key once normalized
+	salt := make([]byte, SaltLength)
+	a, err := DeriveKeyWithParams(NormalizePassword(composed), salt, DefaultKDF)
+	if err != nil {
+		t.Fatalf("DeriveKeyWithParams failed: %v", err)
+	}
+	b, err := DeriveKeyWithParams(NormalizePassword(decomposed), salt, DefaultKDF)
+	if err != nil {
+		t.Fatalf("DeriveKeyWithParams failed: %v", err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("Expected both forms to derive the same key")
+	}
+
+	// Compatibility characters fold too, and ASCII is left alone
+	if got := NormalizePassword("\uff21\uff22"); got != "AB" {
+		t.Errorf("Expected fullwidth letters to fold to AB, got %q", got)
+	}
+	if got := NormalizePassword("Tr0ub4dor&3"); got != "Tr0ub4dor&3" {
+		t.Errorf("Expected ASCII to be unchanged, got %q", got)
+	}
+}
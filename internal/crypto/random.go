@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+)
+
+// randomSampleLength is the number of bytes CheckRandomness draws
+const randomSampleLength = 2500
+
+// CheckRandomness draws from the random source and fails if the output is
+// obviously broken: repeated draws, a heavy bias towards ones or zeros, or
+// a long run of the same bit. It is a health check against a source that
+// returns zeros or the same bytes, not a statistical test of quality.
+func CheckRandomness() error {
+	first, err := GenerateRandomBytes(randomSampleLength)
+	if err != nil {
+		return err
+	}
+	second, err := GenerateRandomBytes(randomSampleLength)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(first, second) {
+		return fmt.Errorf("random source returned the same %d bytes twice", randomSampleLength)
+	}
+
+	// The monobit and runs bounds are those of FIPS 140-2 for 20,000 bits
+	ones := 0
+	for _, b := range first {
+		ones += bits.OnesCount8(b)
+	}
+	if ones <= 9725 || ones >= 10275 {
+		return fmt.Errorf("random source is biased: %d of %d bits set", ones, randomSampleLength*8)
+	}
+
+	run, longest := 0, 0
+	last := -1
+	for _, b := range first {
+		for i := 7; i >= 0; i-- {
+			bit := int(b>>i) & 1
+			if bit == last {
+				run++
+			} else {
+				run, last = 1, bit
+			}
+			longest = max(longest, run)
+		}
+	}
+	if longest >= 26 {
+		return fmt.Errorf("random source produced a run of %d identical bits", longest)
+	}
+	return nil
+}
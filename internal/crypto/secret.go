@@ -0,0 +1,37 @@
+package crypto
+
+// SecretString holds a decrypted secret in a byte slice rather than a
+// string, so that it can be overwritten once it has been shown. Go strings
+// cannot be changed and stay in memory until collected; anything formed
+// from Reveal with string() escapes the wipe.
+type SecretString struct {
+	b []byte
+}
+
+// NewSecretString wraps b, which the SecretString owns from then on
+func NewSecretString(b []byte) *SecretString {
+	return &SecretString{b: b}
+}
+
+// Reveal returns the secret. The slice is only valid until Wipe.
+func (s *SecretString) Reveal() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.b
+}
+
+// Len returns the length of the secret in bytes
+func (s *SecretString) Len() int {
+	return len(s.Reveal())
+}
+
+// Wipe overwrites the secret with zeros and empties it. It is safe to
+// call more than once, and on nil.
+func (s *SecretString) Wipe() {
+	if s == nil {
+		return
+	}
+	zeroBytes(s.b)
+	s.b = nil
+}
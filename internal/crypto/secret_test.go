@@ -0,0 +1,43 @@
+package crypto
+
+import "testing"
+
+func TestSecretStringWipe(t *testing.T) {
+	secret := NewSecretString([]byte("hunter2"))
+	backing := secret.Reveal()
+	if string(backing) != "hunter2" || secret.Len() != 7 {
+		t.Fatalf("Reveal = %q, want hunter2", backing)
+	}
+
+	secret.Wipe()
+	for i, b := range backing {
+		if b != 0 {
+			t.Fatalf("byte %d of the backing array is %q after Wipe", i, b)
+		}
+	}
+	if secret.Reveal() != nil || secret.Len() != 0 {
+		t.Error("Expected a wiped secret to be empty")
+	}
+
+	// Wiping again, or a nil secret, does nothing
+	secret.Wipe()
+	var missing *SecretString
+	missing.Wipe()
+}
+
+func TestDecryptBytes(t *testing.T) {
+	encrypted, err := Encrypt("hunter2", "key")
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	plaintext, err := DecryptBytes(encrypted, "key")
+	if err != nil {
+		t.Fatalf("DecryptBytes failed: %v", err)
+	}
+	if string(plaintext) != "hunter2" {
+		t.Errorf("DecryptBytes = %q, want hunter2", plaintext)
+	}
+	if _, err := DecryptBytes(encrypted, "wrong"); err == nil {
+		t.Error("Expected an error for the wrong key")
+	}
+}
@@ -0,0 +1,302 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A stream encrypts data too large to hold in memory twice, such as a
+// whole vault file, in chunks sealed with AES-256-GCM under one key. The
+// nonce of each chunk is a random prefix, the number of the chunk and a
+// flag set on the last chunk only, so chunks cannot be reordered, dropped
+// or cut off without the stream failing to decrypt. A stream is:
+//
+//	version      1 byte, StreamVersion
+//	header size  4 bytes, big-endian
+//	header       JSON: the salt and KDF of a stream under a password, the
+//	             nonce prefix and the chunk size
+//	chunks       each its sealed size in 4 bytes, big-endian, and the
+//	             sealed chunk
+//
+// Every chunk authenticates the version and header; the last one also
+// authenticates the length of the whole plaintext.
+const (
+	// StreamVersion is the version of the stream format written
+	StreamVersion = 1
+	// DefaultChunkSize is how much plaintext each chunk holds
+	DefaultChunkSize = 64 << 10
+)
+
+const (
+	// maxChunkSize bounds the chunk size a stream may ask for, so a
+	// damaged or hostile stream cannot exhaust memory
+	maxChunkSize = 16 << 20
+	// maxStreamHeader bounds the size of the JSON header
+	maxStreamHeader = 4 << 10
+	// streamPrefixLength leaves room in the nonce for the chunk number and
+	// the last-chunk flag
+	streamPrefixLength = NonceLength - 5
+)
+
+// streamHeader is the JSON header of a stream
+type streamHeader struct {
+	Salt        []byte     `json:"salt,omitempty"`
+	KDF         *KDFParams `json:"kdf,omitempty"`
+	NoncePrefix []byte     `json:"nonce_prefix"`
+	ChunkSize   int        `json:"chunk_size"`
+}
+
+// EncryptStream encrypts src to dst as a stream, under a key derived from
+// password with DefaultKDF
+func EncryptStream(dst io.Writer, src io.Reader, password string) error {
+	salt, err := GenerateRandomBytes(SaltLength)
+	if err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	p := DefaultKDF
+	key, err := DeriveKeyWithParams(password, salt, p)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer zeroBytes(key)
+	return sealStream(dst, src, key, streamHeader{Salt: salt, KDF: &p, ChunkSize: DefaultChunkSize})
+}
+
+// EncryptStreamWithKey encrypts src to dst as a stream directly under key,
+// which must be KeyLength random bytes
+func EncryptStreamWithKey(dst io.Writer, src io.Reader, key []byte) error {
+	return sealStream(dst, src, key, streamHeader{ChunkSize: DefaultChunkSize})
+}
+
+// DecryptStream decrypts a stream written by EncryptStream from src to
+// dst. Chunks are written as they are authenticated, so on an error dst
+// may hold part of the plaintext and must be discarded. A wrong password
+// and a damaged, truncated or reordered stream give ErrDecrypt.
+func DecryptStream(dst io.Writer, src io.Reader, password string) error {
+	header, aad, err := readStreamHeader(src)
+	if err != nil {
+		return err
+	}
+	if header.KDF == nil {
+		return fmt.Errorf("stream is not encrypted under a password")
+	}
+	key, err := DeriveKeyWithParams(password, header.Salt, *header.KDF)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer zeroBytes(key)
+	return openStream(dst, src, key, header, aad)
+}
+
+// DecryptStreamWithKey decrypts a stream written by EncryptStreamWithKey
+// from src to dst, like DecryptStream
+func DecryptStreamWithKey(dst io.Writer, src io.Reader, key []byte) error {
+	header, aad, err := readStreamHeader(src)
+	if err != nil {
+		return err
+	}
+	return openStream(dst, src, key, header, aad)
+}
+
+// streamCipher returns the AES-256-GCM cipher of key
+func streamCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("invalid key length: expected %d, got %d", KeyLength, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM mode: %w", err)
+	}
+	return gcm, nil
+}
+
+// chunkNonce returns the nonce of chunk n of a stream with prefix
+func chunkNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, NonceLength)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixLength:], n)
+	if last {
+		nonce[NonceLength-1] = 1
+	}
+	return nonce
+}
+
+// lastChunkData returns the additional data of the last chunk: that of
+// every chunk followed by the length of the plaintext
+func lastChunkData(aad []byte, total uint64) []byte {
+	return binary.BigEndian.AppendUint64(aad[:len(aad):len(aad)], total)
+}
+
+// sealStream writes header and src sealed in chunks under key to dst. The
+// header gets a fresh nonce prefix.
+func sealStream(dst io.Writer, src io.Reader, key []byte, header streamHeader) error {
+	gcm, err := streamCipher(key)
+	if err != nil {
+		return err
+	}
+	if header.NoncePrefix, err = GenerateRandomBytes(streamPrefixLength); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	body, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream header: %w", err)
+	}
+	aad := binary.BigEndian.AppendUint32([]byte{StreamVersion}, uint32(len(body)))
+	aad = append(aad, body...)
+	if _, err := dst.Write(aad); err != nil {
+		return fmt.Errorf("failed to write stream: %w", err)
+	}
+
+	// One chunk is read ahead to tell whether the current one is the last
+	buf, ahead := make([]byte, header.ChunkSize), make([]byte, header.ChunkSize)
+	defer zeroBytes(buf)
+	defer zeroBytes(ahead)
+	sealed := make([]byte, 4, 4+header.ChunkSize+gcm.Overhead())
+	n, err := readChunk(src, buf)
+	if err != nil {
+		return err
+	}
+	var total uint64
+	for counter := uint32(0); ; counter++ {
+		last, next := n < len(buf), 0
+		if !last {
+			if next, err = readChunk(src, ahead); err != nil {
+				return err
+			}
+			last = next == 0
+		}
+		if !last && counter == math.MaxUint32 {
+			return fmt.Errorf("stream is too long")
+		}
+
+		total += uint64(n)
+		data := aad
+		if last {
+			data = lastChunkData(aad, total)
+		}
+		sealed = gcm.Seal(sealed[:4], chunkNonce(header.NoncePrefix, counter, last), buf[:n], data)
+		binary.BigEndian.PutUint32(sealed, uint32(len(sealed)-4))
+		if _, err := dst.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write stream: %w", err)
+		}
+		if last {
+			return nil
+		}
+		buf, ahead, n = ahead, buf, next
+	}
+}
+
+// readChunk fills buf from src as far as src goes and returns how much
+// it read
+func readChunk(src io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(src, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read plaintext: %w", err)
+	}
+	return n, nil
+}
+
+// readStreamHeader reads the version and header of a stream from src. It
+// returns the header and the bytes read, which every chunk authenticates.
+func readStreamHeader(src io.Reader) (*streamHeader, []byte, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(src, prefix); err != nil {
+		return nil, nil, fmt.Errorf("%w: stream ends in its header", ErrDecrypt)
+	}
+	if prefix[0] != StreamVersion {
+		return nil, nil, fmt.Errorf("unsupported stream version %d", prefix[0])
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxStreamHeader {
+		return nil, nil, fmt.Errorf("%w: stream header of %d bytes", ErrDecrypt, size)
+	}
+	aad := make([]byte, 5+size)
+	copy(aad, prefix)
+	if _, err := io.ReadFull(src, aad[5:]); err != nil {
+		return nil, nil, fmt.Errorf("%w: stream ends in its header", ErrDecrypt)
+	}
+
+	var header streamHeader
+	if err := json.Unmarshal(aad[5:], &header); err != nil {
+		return nil, nil, fmt.Errorf("%w: corrupt stream header: %w", ErrDecrypt, err)
+	}
+	if len(header.NoncePrefix) != streamPrefixLength || header.ChunkSize < 1 || header.ChunkSize > maxChunkSize {
+		return nil, nil, fmt.Errorf("%w: invalid stream header", ErrDecrypt)
+	}
+	return &header, aad, nil
+}
+
+// openStream decrypts the chunks of a stream from src to dst
+func openStream(dst io.Writer, src io.Reader, key []byte, header *streamHeader, aad []byte) error {
+	gcm, err := streamCipher(key)
+	if err != nil {
+		return err
+	}
+	overhead := gcm.Overhead()
+	sealed := make([]byte, header.ChunkSize+overhead)
+	var plain []byte
+	defer func() { zeroBytes(plain) }()
+
+	var total uint64
+	for counter := uint32(0); ; counter++ {
+		var size [4]byte
+		if _, err := io.ReadFull(src, size[:]); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: stream ends before its last chunk", ErrDecrypt)
+		} else if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+		n := int(binary.BigEndian.Uint32(size[:]))
+		if n < overhead || n > len(sealed) {
+			return fmt.Errorf("%w: chunk %d has an invalid size", ErrDecrypt, counter)
+		}
+		if _, err := io.ReadFull(src, sealed[:n]); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: stream ends in chunk %d", ErrDecrypt, counter)
+		} else if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+
+		// A full chunk is the last one only when the plaintext fills a
+		// whole number of chunks, so it is first opened as one of many
+		last := n-overhead < header.ChunkSize
+		if !last {
+			plain, err = gcm.Open(plain[:0], chunkNonce(header.NoncePrefix, counter, false), sealed[:n], aad)
+			last = err != nil
+		}
+		if last {
+			total := total + uint64(n-overhead)
+			plain, err = gcm.Open(plain[:0], chunkNonce(header.NoncePrefix, counter, true), sealed[:n], lastChunkData(aad, total))
+		}
+		if err != nil {
+			return fmt.Errorf("%w: chunk %d: %w", ErrDecrypt, counter, err)
+		}
+
+		total += uint64(len(plain))
+		if _, err := dst.Write(plain); err != nil {
+			return fmt.Errorf("failed to write plaintext: %w", err)
+		}
+		zeroBytes(plain)
+		if last {
+			// Nothing may follow the last chunk
+			if n, _ := io.ReadFull(src, size[:1]); n > 0 {
+				return fmt.Errorf("%w: data after the last chunk", ErrDecrypt)
+			}
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("%w: stream is too long", ErrDecrypt)
+		}
+	}
+}
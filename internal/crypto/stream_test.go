@@ -0,0 +1,197 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testKey is a fixed stream key
+var testKey = bytes.Repeat([]byte{7}, KeyLength)
+
+// sealTestStream seals plaintext under testKey in chunks of size
+func sealTestStream(t *testing.T, plaintext []byte, size int) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := sealStream(&out, bytes.NewReader(plaintext), testKey, streamHeader{ChunkSize: size}); err != nil {
+		t.Fatalf("sealStream failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+// splitStream splits a stream into its version and header, and its framed
+// chunks
+func splitStream(t *testing.T, stream []byte) ([]byte, [][]byte) {
+	t.Helper()
+	end := 5 + int(binary.BigEndian.Uint32(stream[1:5]))
+	header, rest := stream[:end], stream[end:]
+	var chunks [][]byte
+	for len(rest) > 0 {
+		n := 4 + int(binary.BigEndian.Uint32(rest))
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+	return header, chunks
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	// Lengths around the chunk boundaries, which decide the last chunk
+	for _, length := range []int{0, 1, 15, 16, 17, 32, 50} {
+		plaintext := []byte(strings.Repeat("abcdefg", 10)[:length])
+		stream := sealTestStream(t, plaintext, 16)
+		// A full last chunk ends the stream; only no plaintext at all
+		// takes an empty one
+		want := max(1, (length+15)/16)
+		if _, chunks := splitStream(t, stream); len(chunks) != want {
+			t.Errorf("Expected %d chunks for %d bytes, got %d", want, length, len(chunks))
+		}
+		var out bytes.Buffer
+		if err := DecryptStreamWithKey(&out, bytes.NewReader(stream), testKey); err != nil || !bytes.Equal(out.Bytes(), plaintext) {
+			t.Errorf("Length %d: got %q, %v", length, out.Bytes(), err)
+		}
+	}
+}
+
+func TestStreamPassword(t *testing.T) {
+	var stream bytes.Buffer
+	if err := EncryptStream(&stream, strings.NewReader("attachment"), "password"); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := DecryptStream(&out, bytes.NewReader(stream.Bytes()), "password"); err != nil || out.String() != "attachment" {
+		t.Errorf("Expected the plaintext back, got %q, %v", out.String(), err)
+	}
+	if err := DecryptStream(io.Discard, bytes.NewReader(stream.Bytes()), "wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for the wrong password, got %v", err)
+	}
+
+	// A stream under a key has no salt to derive one from
+	keyed := sealTestStream(t, []byte("x"), 16)
+	if err := DecryptStream(io.Discard, bytes.NewReader(keyed), "password"); err == nil {
+		t.Error("Expected a stream under a key to be refused")
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	plaintext := []byte(strings.Repeat("0123456789", 6))
+	header, chunks := splitStream(t, sealTestStream(t, plaintext, 16))
+	if len(chunks) != 4 {
+		t.Fatalf("Expected 4 chunks, got %d", len(chunks))
+	}
+	join := func(chunks ...[]byte) []byte {
+		return bytes.Join(append([][]byte{header}, chunks...), nil)
+	}
+	whole := join(chunks...)
+
+	flippedHeader := append([]byte{}, whole...)
+	flippedHeader[len(header)-3] ^= 1
+	flippedChunk := append([]byte{}, whole...)
+	flippedChunk[len(header)+10] ^= 1
+	otherHeader, otherChunks := splitStream(t, sealTestStream(t, plaintext, 16))
+
+	tests := map[string][]byte{
+		"no chunks":             join(),
+		"last chunk dropped":    join(chunks[0], chunks[1], chunks[2]),
+		"middle chunk dropped":  join(chunks[0], chunks[2], chunks[3]),
+		"chunks swapped":        join(chunks[1], chunks[0], chunks[2], chunks[3]),
+		"chunk repeated":        join(chunks[0], chunks[0], chunks[1], chunks[2], chunks[3]),
+		"cut in a chunk":        whole[:len(whole)-5],
+		"cut in the header":     whole[:len(header)-1],
+		"data after the end":    append(append([]byte{}, whole...), 0),
+		"header changed":        flippedHeader,
+		"chunk changed":         flippedChunk,
+		"chunk of other stream": join(chunks[0], otherChunks[1], chunks[2], chunks[3]),
+		"header of other":       bytes.Join(append([][]byte{otherHeader}, chunks...), nil),
+	}
+	for name, stream := range tests {
+		if err := DecryptStreamWithKey(io.Discard, bytes.NewReader(stream), testKey); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: expected ErrDecrypt, got %v", name, err)
+		}
+	}
+
+	// A full last chunk must not pass for one followed by more
+	_, full := splitStream(t, sealTestStream(t, plaintext[:32], 16))
+	if err := DecryptStreamWithKey(io.Discard, bytes.NewReader(join(full[0])), testKey); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected a stream cut after a full chunk to be refused, got %v", err)
+	}
+
+	future := append([]byte{StreamVersion + 1}, whole[1:]...)
+	if err := DecryptStreamWithKey(io.Discard, bytes.NewReader(future), testKey); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected an unknown version to be refused, got %v", err)
+	}
+}
+
+// zeroReader reads zeros without end
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// peakWriter discards what is written and records the peak heap
+type peakWriter struct {
+	writes int
+	peak   uint64
+}
+
+func (w *peakWriter) Write(p []byte) (int, error) {
+	if w.writes++; w.writes%64 == 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		w.peak = max(w.peak, stats.HeapAlloc)
+	}
+	return len(p), nil
+}
+
+// BenchmarkStream encrypts 100MB to a file and decrypts it again and
+// reports the peak heap of each, which should stay at a few chunks
+func BenchmarkStream(b *testing.B) {
+	const size = 100 << 20
+	path := filepath.Join(b.TempDir(), "stream")
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		base := stats.HeapAlloc
+
+		f, err := os.Create(path)
+		if err != nil {
+			b.Fatalf("Create failed: %v", err)
+		}
+		sealing := &peakWriter{peak: base}
+		err = EncryptStreamWithKey(io.MultiWriter(f, sealing), io.LimitReader(zeroReader{}, size), testKey)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			b.Fatalf("EncryptStreamWithKey failed: %v", err)
+		}
+
+		f, err = os.Open(path)
+		if err != nil {
+			b.Fatalf("Open failed: %v", err)
+		}
+		opening := &peakWriter{peak: base}
+		err = DecryptStreamWithKey(opening, f, testKey)
+		f.Close()
+		if err != nil {
+			b.Fatalf("DecryptStreamWithKey failed: %v", err)
+		}
+
+		for _, w := range []*peakWriter{sealing, opening} {
+			if growth := int64(w.peak) - int64(base); growth > 4<<20 {
+				b.Errorf("Heap grew by %d bytes for a %d byte stream", growth, size)
+			}
+		}
+		b.ReportMetric(float64(sealing.peak-base)/(1<<20), "seal-peak-MB")
+		b.ReportMetric(float64(opening.peak-base)/(1<<20), "open-peak-MB")
+	}
+}
@@ -0,0 +1,214 @@
+// Package demo makes up a vault of realistic but fake entries, for trying
+// the app without risking real secrets and for tests and benchmarks that
+// need a populated vault. The same seed and time always give the same
+// entries.
+package demo
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"password-manager/internal/reminder"
+	"password-manager/internal/storage"
+)
+
+// Persona is the made-up owner of the demo entries; every address is on
+// a domain reserved for examples
+const Persona = "alex.morgan@example.com"
+
+// Named entries whose content the demo and its tests rely on
+const (
+	// Breached holds a password found in every breach list
+	Breached = "old-forum"
+	// Expired was last changed years ago and waits to be rotated
+	Expired = "electricity"
+	// Duplicate repeats the account of "gmail" under another name
+	Duplicate = "gmail-old"
+)
+
+// Reused are the entries sharing one password
+var Reused = []string{"netflix", "spotify", "reddit"}
+
+// site is a login the demo makes up an account for
+type site struct {
+	name string
+	url  string
+	tags string
+}
+
+var sites = []site{
+	{"gmail", "https://mail.google.com", "email personal"},
+	{"outlook", "https://outlook.live.com", "email"},
+	{"github", "https://github.com/login", "work/dev"},
+	{"gitlab", "https://gitlab.com/users/sign_in", "work/dev"},
+	{"aws-console", "https://console.aws.amazon.com", "work/cloud prod"},
+	{"slack", "https://acme-corp.slack.com", "work"},
+	{"jira", "https://acme-corp.atlassian.net", "work"},
+	{"bank", "https://online.examplebank.com", "finance/banking"},
+	{"credit-card", "https://card.examplecredit.com", "finance/banking"},
+	{"paypal", "https://www.paypal.com/signin", "finance shopping"},
+	{"amazon", "https://www.amazon.com", "shopping"},
+	{"ebay", "https://signin.ebay.com", "shopping"},
+	{"netflix", "https://www.netflix.com/login", "streaming"},
+	{"spotify", "https://accounts.spotify.com", "streaming"},
+	{"steam", "https://store.steampowered.com/login", "games"},
+	{"twitter", "https://twitter.com/login", "social"},
+	{"facebook", "https://www.facebook.com", "social"},
+	{"linkedin", "https://www.linkedin.com/login", "social work"},
+	{"reddit", "https://www.reddit.com/login", "social"},
+	{"dropbox", "https://www.dropbox.com/login", "cloud"},
+	{"router", "http://192.168.1.1", "home"},
+	{"nas", "https://nas.home.arpa:5001", "home"},
+	{"electricity", "https://my.examplepower.com", "home/bills"},
+	{"insurance", "https://portal.exampleinsure.com", "finance"},
+	{"old-forum", "https://forum.example.net", "social"},
+}
+
+// notes are the secure notes of the demo, name and body
+var notes = [][2]string{
+	{"wifi", "Network: MorganHome\nPassword: correct-battery-horse-staple"},
+	{"passport", "Number: X1234567\nExpires: 2031-04-30"},
+	{"github-recovery-codes", "4f9a1-c02be\n77d3e-b91a0\n0c6f2-5e8d4\n91b7a-3ad20"},
+}
+
+// Passwords of the weaker kinds; strong ones are made up per seed
+var (
+	weakPasswords   = []string{"letmein", "qwerty12", "dragon99", "monkey1"}
+	wordPasswords   = []string{"Sunflower", "Bluebird", "Marathon", "Harbor", "Lantern"}
+	strongAlphabet  = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!@#$%^&*-_=+"
+	breachedSecret  = "Password123!"
+	reusedSecret    = "Summer2023!"
+	usernamePrefix  = []string{"alex", "amorgan", "alex.morgan", "alexm"}
+	usernameDomains = []string{"example.com", "example.org"}
+)
+
+// Entries makes up the entries of a demo vault, dated relative to now:
+// about thirty logins and notes of varied strength, tags with folders
+// such as work/dev, a duplicate account, passwords reused across three
+// sites, one found in breach lists and one long overdue for rotation.
+func Entries(seed int64, now time.Time) []*storage.PasswordEntry {
+	rng := rand.New(rand.NewSource(seed))
+	daysAgo := func(min, max int) time.Time {
+		return now.Add(-time.Duration(min+rng.Intn(max-min+1)) * 24 * time.Hour).Truncate(time.Second)
+	}
+
+	var entries []*storage.PasswordEntry
+	for _, s := range sites {
+		entry := &storage.PasswordEntry{
+			Name:     s.name,
+			Username: username(rng, s.name),
+			URL:      s.url,
+			Tags:     strings.Fields(s.tags),
+			Type:     storage.EntryTypeLogin,
+		}
+		entry.CreatedAt = daysAgo(200, 1500)
+		entry.UpdatedAt = daysAgo(0, int(now.Sub(entry.CreatedAt).Hours()/24))
+
+		switch {
+		case s.name == Breached:
+			entry.Password = breachedSecret
+			entry.Notes = "Haven't logged in for years."
+		case s.name == Expired:
+			entry.Password = word(rng)
+			entry.CreatedAt = daysAgo(1600, 1800)
+			entry.UpdatedAt = daysAgo(1100, 1200)
+			entry.Tags = append(entry.Tags, reminder.RotateTag)
+		case contains(Reused, s.name):
+			entry.Password = reusedSecret
+		default:
+			// Mostly strong, with a few weak and middling ones
+			switch n := rng.Intn(10); {
+			case n < 2:
+				entry.Password = weakPasswords[rng.Intn(len(weakPasswords))]
+			case n < 4:
+				entry.Password = word(rng)
+			default:
+				entry.Password = strong(rng, 16+rng.Intn(9))
+			}
+		}
+		entries = append(entries, entry)
+
+		if s.name == "gmail" {
+			duplicate := *entry
+			duplicate.Name = Duplicate
+			duplicate.Tags = []string{"email", "old"}
+			duplicate.Notes = "Same account as gmail, saved again before the import."
+			entries = append(entries, &duplicate)
+		}
+	}
+
+	for _, note := range notes {
+		entry := &storage.PasswordEntry{
+			Name:  note[0],
+			Notes: note[1],
+			Tags:  []string{"personal"},
+			Type:  storage.EntryTypeNote,
+		}
+		entry.CreatedAt = daysAgo(30, 900)
+		entry.UpdatedAt = entry.CreatedAt
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Source feeds entries to storage.CreateMemoryFrom
+func Source(entries []*storage.PasswordEntry) storage.EntrySource {
+	return func(fn func(*storage.PasswordEntry) error) error {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Open creates a writable vault held in memory with the entries of
+// Entries. Nothing is written to disk, and closing it discards it.
+func Open(seed int64, now time.Time) (*storage.Database, error) {
+	db, err := storage.CreateMemoryFrom(Source(Entries(seed, now)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create demo vault: %w", err)
+	}
+	return db, nil
+}
+
+// username makes up the account name of the persona on a site
+func username(rng *rand.Rand, site string) string {
+	switch site {
+	case "gmail":
+		return Persona
+	case "router", "nas":
+		return "admin"
+	}
+	prefix := usernamePrefix[rng.Intn(len(usernamePrefix))]
+	if rng.Intn(3) == 0 {
+		return prefix
+	}
+	return prefix + "@" + usernameDomains[rng.Intn(len(usernameDomains))]
+}
+
+// word makes up a password of the capitalized word and year kind
+func word(rng *rand.Rand) string {
+	return fmt.Sprintf("%s%d", wordPasswords[rng.Intn(len(wordPasswords))], 2015+rng.Intn(10))
+}
+
+// strong makes up a random password of length characters
+func strong(rng *rand.Rand, length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = strongAlphabet[rng.Intn(len(strongAlphabet))]
+	}
+	return string(b)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package demo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"password-manager/internal/reminder"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEntriesDeterministic(t *testing.T) {
+	a, b := Entries(42, now), Entries(42, now)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Expected the same seed to give the same entries")
+	}
+	if reflect.DeepEqual(a, Entries(43, now)) {
+		t.Error("Expected another seed to give other entries")
+	}
+	if len(a) < 25 || len(a) > 35 {
+		t.Errorf("Expected about 30 entries, got %d", len(a))
+	}
+}
+
+func TestEntriesCoverFindings(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3} {
+		byName := make(map[string]int)
+		entries := Entries(seed, now)
+		for i, entry := range entries {
+			if _, ok := byName[entry.Name]; ok {
+				t.Fatalf("seed %d: name %s repeated", seed, entry.Name)
+			}
+			byName[entry.Name] = i
+			if entry.UpdatedAt.Before(entry.CreatedAt) || entry.UpdatedAt.After(now) {
+				t.Errorf("seed %d: %s updated %v, created %v", seed, entry.Name, entry.UpdatedAt, entry.CreatedAt)
+			}
+		}
+		get := func(name string) int {
+			i, ok := byName[name]
+			if !ok {
+				t.Fatalf("seed %d: no entry %s", seed, name)
+			}
+			return i
+		}
+
+		for _, name := range Reused[1:] {
+			if entries[get(name)].Password != entries[get(Reused[0])].Password {
+				t.Errorf("seed %d: expected %v to share a password", seed, Reused)
+			}
+		}
+		if entries[get(Breached)].Password != breachedSecret {
+			t.Errorf("seed %d: expected %s to hold a breached password", seed, Breached)
+		}
+		expired := entries[get(Expired)]
+		if now.Sub(expired.UpdatedAt) < 3*365*24*time.Hour || !contains(expired.Tags, reminder.RotateTag) {
+			t.Errorf("seed %d: expected %s to be overdue, got %v %v", seed, Expired, expired.UpdatedAt, expired.Tags)
+		}
+		original, duplicate := entries[get("gmail")], entries[get(Duplicate)]
+		if duplicate.Username != original.Username || duplicate.Password != original.Password {
+			t.Errorf("seed %d: expected %s to repeat gmail", seed, Duplicate)
+		}
+		if !entries[get("wifi")].IsNote() {
+			t.Errorf("seed %d: expected wifi to be a note", seed)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	db, err := Open(7, now)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	stored, err := db.ListPasswords()
+	if err != nil {
+		t.Fatalf("ListPasswords failed: %v", err)
+	}
+	if want := len(Entries(7, now)); len(stored) != want {
+		t.Errorf("Expected %d entries, got %d", want, len(stored))
+	}
+	entry, err := db.GetPassword(Expired)
+	if err != nil || !entry.UpdatedAt.Equal(Entries(7, now)[indexOf(t, Expired)].UpdatedAt) {
+		t.Errorf("Expected timestamps to be kept, got %+v, %v", entry, err)
+	}
+}
+
+func indexOf(t *testing.T, name string) int {
+	t.Helper()
+	for i, entry := range Entries(7, now) {
+		if entry.Name == name {
+			return i
+		}
+	}
+	t.Fatalf("no entry %s", name)
+	return -1
+}
@@ -0,0 +1,141 @@
+// Package dictation lays out a password to be read aloud, as over a
+// phone call: in short numbered groups, each character spelled with the
+// NATO phonetic alphabet, and a checksum word the listener uses to confirm
+// they wrote it down right.
+package dictation
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"password-manager/internal/generator"
+)
+
+// GroupSize is how many characters are read out at a time
+const GroupSize = 3
+
+// Group is a run of characters read out together
+type Group struct {
+	// Number counts the groups from 1
+	Number int
+	Chars  string
+	// Spoken has how each character of Chars is said, in order
+	Spoken []string
+}
+
+// Sheet is a password laid out for dictation
+type Sheet struct {
+	Groups []Group
+	// Length is the number of characters of the password
+	Length int
+	// Checksum is a word derived from the password; the listener works it
+	// out from what they wrote down and reads it back
+	Checksum string
+}
+
+// New lays out password for dictation
+func New(password []byte) *Sheet {
+	chars := []rune(string(password))
+	sheet := &Sheet{Length: len(chars), Checksum: Checksum(password)}
+	for i := 0; i < len(chars); i += GroupSize {
+		group := Group{Number: len(sheet.Groups) + 1, Chars: string(chars[i:min(i+GroupSize, len(chars))])}
+		for _, c := range group.Chars {
+			group.Spoken = append(group.Spoken, Spell(c))
+		}
+		sheet.Groups = append(sheet.Groups, group)
+	}
+	return sheet
+}
+
+// Checksum returns the checksum word of password: the word of the EFF
+// large wordlist picked by the first four bytes of its SHA-256. The same
+// password always gives the same word; a single wrong character almost
+// always gives another one.
+func Checksum(password []byte) string {
+	sum := sha256.Sum256(password)
+	return generator.Word(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// nato is the NATO phonetic alphabet, from A to Z
+var nato = [26]string{
+	"Alfa", "Bravo", "Charlie", "Delta", "Echo", "Foxtrot", "Golf", "Hotel", "India",
+	"Juliett", "Kilo", "Lima", "Mike", "November", "Oscar", "Papa", "Quebec", "Romeo",
+	"Sierra", "Tango", "Uniform", "Victor", "Whiskey", "X-ray", "Yankee", "Zulu",
+}
+
+// digits are the names of the digits
+var digits = [10]string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+
+// symbols are the names of the symbols passwords are generated with, and
+// a few more
+var symbols = map[rune]string{
+	'!': "exclamation mark", '@': "at sign", '#': "hash", '$': "dollar sign", '%': "percent",
+	'^': "caret", '&': "ampersand", '*': "asterisk", '(': "open parenthesis", ')': "close parenthesis",
+	'_': "underscore", '+': "plus", '-': "hyphen", '=': "equals", '[': "open bracket",
+	']': "close bracket", '{': "open brace", '}': "close brace", '|': "vertical bar", ';': "semicolon",
+	':': "colon", ',': "comma", '.': "period", '<': "less-than", '>': "greater-than",
+	'?': "question mark", '\'': "apostrophe", '"': "double quote", '/': "slash", '\\': "backslash",
+	'`': "backtick", '~': "tilde", ' ': "space",
+}
+
+// homoglyphs are characters easily taken for others when written down,
+// with what they are not
+var homoglyphs = map[rune]string{
+	'0': "not the letter O",
+	'O': "the letter, not zero",
+	'o': "the letter, not zero",
+	'1': "not the letter l or I",
+	'l': "not one or capital I",
+	'I': "not one or lowercase l",
+	'|': "not one or the letter l",
+	'5': "not the letter S",
+	'S': "not five",
+	'2': "not the letter Z",
+	'Z': "not two",
+	'8': "not the letter B",
+	'B': "not eight",
+}
+
+// Spell returns how c is said: its NATO word with its case for letters,
+// the name of digits and symbols, and a note for characters easily taken
+// for others. Other characters are named by their code point.
+func Spell(c rune) string {
+	var spoken string
+	switch {
+	case c >= 'A' && c <= 'Z':
+		spoken = "capital " + strings.ToUpper(nato[c-'A'])
+	case c >= 'a' && c <= 'z':
+		spoken = "lowercase " + strings.ToLower(nato[c-'a'])
+	case c >= '0' && c <= '9':
+		spoken = "digit " + digits[c-'0']
+	case symbols[c] != "":
+		spoken = symbols[c]
+	case unicode.IsLetter(c):
+		spoken = fmt.Sprintf("letter %c (%U)", c, c)
+	default:
+		spoken = fmt.Sprintf("%U", c)
+	}
+	if note := homoglyphs[c]; note != "" {
+		spoken += " (" + note + ")"
+	}
+	return spoken
+}
+
+// Write prints the sheet: a heading, one numbered line for each group
+// and the checksum word
+func (s *Sheet) Write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dictation sheet: %d characters in %d groups of up to %d\n\n", s.Length, len(s.Groups), GroupSize)
+	for _, group := range s.Groups {
+		fmt.Fprintf(&b, "%3d  %-*s  %s\n", group.Number, GroupSize, group.Chars, strings.Join(group.Spoken, ", "))
+	}
+	fmt.Fprintf(&b, "\nChecksum word: %s\n", s.Checksum)
+	fmt.Fprintf(&b, "Read the groups in order. The listener confirms the password with the\n")
+	fmt.Fprintf(&b, "checksum word, which a single wrong character almost always changes.\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
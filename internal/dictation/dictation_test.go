@@ -0,0 +1,73 @@
+package dictation
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	// Fixed inputs pin the mapping: changing it would make sheets printed
+	// by one version disagree with the checksum command of another
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"", "sitcom"},
+		{"correct horse battery staple", "designate"},
+		{"Xk3#p2Qa", "humorist"},
+		{"Xk3#p2Qb", "debtless"},
+	}
+	for _, tt := range tests {
+		if got := Checksum([]byte(tt.password)); got != tt.want {
+			t.Errorf("Checksum(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestSpell(t *testing.T) {
+	tests := map[rune]string{
+		'A': "capital ALFA",
+		'x': "lowercase x-ray",
+		'7': "digit seven",
+		'#': "hash",
+		'0': "digit zero (not the letter O)",
+		'O': "capital OSCAR (the letter, not zero)",
+		'l': "lowercase lima (not one or capital I)",
+		'é': "letter é (U+00E9)",
+		'€': "U+20AC",
+	}
+	for c, want := range tests {
+		if got := Spell(c); got != want {
+			t.Errorf("Spell(%q) = %q, want %q", c, got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	sheet := New([]byte("aB3#x0Q"))
+	var chars []string
+	for i, group := range sheet.Groups {
+		if group.Number != i+1 || len(group.Spoken) != len([]rune(group.Chars)) {
+			t.Errorf("Unexpected group %+v", group)
+		}
+		chars = append(chars, group.Chars)
+	}
+	if want := []string{"aB3", "#x0", "Q"}; !reflect.DeepEqual(chars, want) {
+		t.Errorf("Expected groups %q, got %q", want, chars)
+	}
+	if sheet.Length != 7 || sheet.Checksum != Checksum([]byte("aB3#x0Q")) {
+		t.Errorf("Unexpected sheet %+v", sheet)
+	}
+
+	var out bytes.Buffer
+	if err := sheet.Write(&out); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for _, want := range []string{"  1  aB3  lowercase alfa, capital BRAVO (not eight), digit three\n", "  3  Q    capital QUEBEC\n", "Checksum word: " + sheet.Checksum} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in\n%s", want, out.String())
+		}
+	}
+}
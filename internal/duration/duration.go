@@ -0,0 +1,225 @@
+package duration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Hint tells Parse how to read units that mean different things in
+// different contexts, most notably "m" (minute or month).
+type Hint int
+
+const (
+	// Short is used by sub-day flags such as --clear-after: "m" means
+	// minutes and a bare number is a count of seconds.
+	Short Hint = iota
+	// Expiry is used by expiry-style flags such as --expires and
+	// --older-than: "m" means months and a bare number is a count of days.
+	Expiry
+)
+
+// Absolute date layouts accepted by Parse, tried in order
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02.01.2006",
+}
+
+// Spec is a parsed duration or absolute point in time. Calendar units
+// (days, weeks, months, years) are kept separate from the clock part so
+// that "1mo" added to January 31st lands on a real calendar date.
+type Spec struct {
+	Years    int
+	Months   int
+	Days     int
+	Clock    time.Duration
+	Absolute time.Time
+}
+
+// IsAbsolute reports whether the spec is a fixed date rather than a span
+func (s Spec) IsAbsolute() bool {
+	return !s.Absolute.IsZero()
+}
+
+// After returns the point in time the spec describes relative to now,
+// looking into the future (e.g. an expiry date)
+func (s Spec) After(now time.Time) time.Time {
+	if s.IsAbsolute() {
+		return s.Absolute
+	}
+	return now.AddDate(s.Years, s.Months, s.Days).Add(s.Clock)
+}
+
+// Before returns the point in time the spec describes relative to now,
+// looking into the past (e.g. an --older-than cutoff)
+func (s Spec) Before(now time.Time) time.Time {
+	if s.IsAbsolute() {
+		return s.Absolute
+	}
+	return now.AddDate(-s.Years, -s.Months, -s.Days).Add(-s.Clock)
+}
+
+// Duration returns the span as a plain duration measured from now. For an
+// absolute spec it is the time remaining until that date.
+func (s Spec) Duration(now time.Time) time.Duration {
+	return s.After(now).Sub(now)
+}
+
+// Parse parses a duration or absolute date. Accepted forms are Go
+// durations ("90s", "1h30m"), the calendar units d, w, mo and y
+// ("30d", "6mo", "1y2mo"), bare numbers, and absolute dates
+// ("2025-01-31", "31.01.2025", RFC 3339). The hint decides how "m" and
+// bare numbers are read; "min" and "mo" are never ambiguous.
+func Parse(value string, hint Hint) (Spec, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Spec{}, fmt.Errorf("empty duration")
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return Spec{Absolute: t}, nil
+		}
+	}
+
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 {
+			return Spec{}, fmt.Errorf("negative duration: %s", value)
+		}
+		if hint == Expiry {
+			return Spec{Days: n}, nil
+		}
+		return Spec{Clock: time.Duration(n) * time.Second}, nil
+	}
+
+	return parseUnits(value, hint)
+}
+
+// parseUnits parses a sequence of <number><unit> pairs
+func parseUnits(value string, hint Hint) (Spec, error) {
+	var spec Spec
+	rest := strings.ToLower(value)
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+		if i == 0 {
+			return Spec{}, fmt.Errorf("invalid duration %q: expected a number at %q", value, rest)
+		}
+		number := rest[:i]
+		rest = rest[i:]
+
+		j := 0
+		for j < len(rest) && unicode.IsLetter(rune(rest[j])) {
+			j++
+		}
+		if j == 0 {
+			return Spec{}, fmt.Errorf("invalid duration %q: missing unit after %s", value, number)
+		}
+		unit := rest[:j]
+		rest = rest[j:]
+
+		if err := spec.add(number, unit, hint); err != nil {
+			return Spec{}, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+	}
+	return spec, nil
+}
+
+// add adds a single <number><unit> pair to the spec
+func (s *Spec) add(number, unit string, hint Hint) error {
+	if unit == "m" {
+		if hint == Expiry {
+			unit = "mo"
+		} else {
+			unit = "min"
+		}
+	}
+
+	switch unit {
+	case "d", "w", "mo", "y":
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return fmt.Errorf("calendar unit %q needs a whole number, got %s", unit, number)
+		}
+		switch unit {
+		case "d":
+			s.Days += n
+		case "w":
+			s.Days += 7 * n
+		case "mo":
+			s.Months += n
+		case "y":
+			s.Years += n
+		}
+		return nil
+	}
+
+	clockUnits := map[string]string{
+		"ms":  "ms",
+		"s":   "s",
+		"sec": "s",
+		"min": "m",
+		"h":   "h",
+	}
+	goUnit, ok := clockUnits[unit]
+	if !ok {
+		return fmt.Errorf("unknown unit %q", unit)
+	}
+	d, err := time.ParseDuration(number + goUnit)
+	if err != nil {
+		return err
+	}
+	s.Clock += d
+	return nil
+}
+
+// Humanize describes t relative to now in words, e.g. "3 months ago" or
+// "in 12 days"
+func Humanize(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var amount int
+	var unit string
+	switch {
+	case d < 45*time.Second:
+		return "just now"
+	case d < 45*time.Minute:
+		amount, unit = roundDiv(d, time.Minute), "minute"
+	case d < 22*time.Hour:
+		amount, unit = roundDiv(d, time.Hour), "hour"
+	case d < 26*24*time.Hour:
+		amount, unit = roundDiv(d, 24*time.Hour), "day"
+	case d < 320*24*time.Hour:
+		amount, unit = roundDiv(d, 30*24*time.Hour), "month"
+	default:
+		amount, unit = roundDiv(d, 365*24*time.Hour), "year"
+	}
+
+	if amount != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", amount, unit)
+	}
+	return fmt.Sprintf("%d %s ago", amount, unit)
+}
+
+// roundDiv divides d by unit, rounding to the nearest whole number
+func roundDiv(d, unit time.Duration) int {
+	n := int((d + unit/2) / unit)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
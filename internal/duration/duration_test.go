@@ -0,0 +1,160 @@
+package duration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAmbiguousMinute(t *testing.T) {
+	now := time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	// Sub-day flags read "m" as minutes
+	short, err := Parse("1m", Short)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := short.Duration(now); got != time.Minute {
+		t.Errorf("Expected 1m with Short hint to be one minute, got %v", got)
+	}
+
+	// Expiry-style flags read "m" as months
+	expiry, err := Parse("1m", Expiry)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if expiry.Months != 1 || expiry.Clock != 0 {
+		t.Errorf("Expected 1m with Expiry hint to be one month, got %+v", expiry)
+	}
+
+	// "min" and "mo" never depend on the hint
+	for _, hint := range []Hint{Short, Expiry} {
+		spec, err := Parse("5min", hint)
+		if err != nil || spec.Clock != 5*time.Minute {
+			t.Errorf("Expected 5min to be five minutes for hint %d, got %+v (%v)", hint, spec, err)
+		}
+		spec, err = Parse("2mo", hint)
+		if err != nil || spec.Months != 2 {
+			t.Errorf("Expected 2mo to be two months for hint %d, got %+v (%v)", hint, spec, err)
+		}
+	}
+}
+
+func TestParseBareNumber(t *testing.T) {
+	short, err := Parse("60", Short)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if short.Clock != 60*time.Second {
+		t.Errorf("Expected bare 60 with Short hint to be 60 seconds, got %+v", short)
+	}
+
+	expiry, err := Parse("90", Expiry)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if expiry.Days != 90 {
+		t.Errorf("Expected bare 90 with Expiry hint to be 90 days, got %+v", expiry)
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	now := time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		hint  Hint
+		want  time.Time
+	}{
+		{"30s", Short, now.Add(30 * time.Second)},
+		{"1h30m", Short, now.Add(90 * time.Minute)},
+		{"1.5h", Short, now.Add(90 * time.Minute)},
+		{"30d", Expiry, time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)},
+		{"2w", Expiry, time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)},
+		{"6mo", Expiry, time.Date(2025, 7, 31, 12, 0, 0, 0, time.UTC)},
+		{"1y", Expiry, time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"1y6m", Expiry, time.Date(2026, 7, 31, 12, 0, 0, 0, time.UTC)},
+		{"1D", Expiry, time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		spec, err := Parse(tt.input, tt.hint)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got := spec.After(now); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).After = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseBefore(t *testing.T) {
+	now := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	spec, err := Parse("2mo", Expiry)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	if got := spec.Before(now); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestParseAbsoluteDates(t *testing.T) {
+	want := time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local)
+
+	for _, input := range []string{"2025-01-31", "31.01.2025"} {
+		spec, err := Parse(input, Expiry)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", input, err)
+			continue
+		}
+		if !spec.IsAbsolute() {
+			t.Errorf("Expected %q to be absolute", input)
+		}
+		if !spec.Absolute.Equal(want) {
+			t.Errorf("Parse(%q) = %v, want %v", input, spec.Absolute, want)
+		}
+		// Absolute dates ignore the reference time
+		if !spec.After(time.Now()).Equal(want) || !spec.Before(time.Now()).Equal(want) {
+			t.Errorf("Expected absolute spec %q to ignore now", input)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	inputs := []string{"", "abc", "10x", "d", "-5", "1.5d", "31/01/2025", "5 days"}
+	for _, input := range inputs {
+		if _, err := Parse(input, Expiry); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{now, "just now"},
+		{now.Add(-10 * time.Second), "just now"},
+		{now.Add(-time.Minute), "1 minute ago"},
+		{now.Add(-5 * time.Minute), "5 minutes ago"},
+		{now.Add(-3 * time.Hour), "3 hours ago"},
+		{now.Add(-24 * time.Hour), "1 day ago"},
+		{now.AddDate(0, 0, 12), "in 12 days"},
+		{now.AddDate(0, -3, 0), "3 months ago"},
+		{now.AddDate(0, 1, 0), "in 1 month"},
+		{now.AddDate(-2, 0, 0), "2 years ago"},
+		{now.AddDate(1, 0, 0), "in 1 year"},
+	}
+
+	for _, tt := range tests {
+		if got := Humanize(tt.t, now); got != tt.want {
+			t.Errorf("Humanize(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package favicon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Limits on what a Fetcher downloads
+const (
+	// MaxIconSize is the largest icon kept
+	MaxIconSize = 100 << 10
+	// maxPageSize is how much of a homepage is read looking for its icon
+	maxPageSize = 512 << 10
+	// maxRedirects is how many redirects a request follows
+	maxRedirects = 5
+	// DefaultInterval is the least time between two requests
+	DefaultInterval = time.Second
+)
+
+var (
+	// ErrNotFound is returned when a site has no icon to fetch
+	ErrNotFound = errors.New("no icon found")
+	// ErrTooLarge is returned when an icon is larger than MaxIconSize
+	ErrTooLarge = fmt.Errorf("icon larger than %d KB", MaxIconSize>>10)
+)
+
+// Icon is a downloaded site icon
+type Icon struct {
+	ContentType string
+	Data        []byte
+	// URL is where the icon was found, after redirects
+	URL string
+}
+
+// Fetcher downloads site icons. It sends no cookies or credentials, even
+// when a URL holds a user name and password, and waits Interval between
+// requests so fetching the icons of a whole vault does not hammer a site.
+type Fetcher struct {
+	Client   *http.Client
+	Interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewFetcher returns a Fetcher with a timeout, no cookie jar and a limit
+// on redirects, waiting DefaultInterval between requests
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:   &http.Client{Timeout: 10 * time.Second, CheckRedirect: checkRedirect},
+		Interval: DefaultInterval,
+	}
+}
+
+// checkRedirect follows only http and https redirects, at most
+// maxRedirects of them, and drops credentials from their URLs
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing redirect to %s", req.URL.Scheme)
+	}
+	req.URL.User = nil
+	return nil
+}
+
+// Fetch downloads the icon of the site at siteURL: /favicon.ico, or else
+// the icon the homepage names in a <link rel="icon">
+func (f *Fetcher) Fetch(ctx context.Context, siteURL string) (*Icon, error) {
+	site, err := url.Parse(siteURL)
+	if err != nil || (site.Scheme != "http" && site.Scheme != "https") || site.Host == "" {
+		return nil, fmt.Errorf("not a web address: %q", siteURL)
+	}
+	origin := &url.URL{Scheme: site.Scheme, Host: site.Host}
+
+	icon, err := f.fetchIcon(ctx, origin.JoinPath("favicon.ico"))
+	if err == nil || errors.Is(err, ErrTooLarge) || ctx.Err() != nil {
+		return icon, err
+	}
+
+	page, links, err := f.fetchLinks(ctx, origin.JoinPath("/"))
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		ref, err := page.Parse(link)
+		if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+			continue
+		}
+		icon, err := f.fetchIcon(ctx, ref)
+		if err == nil || errors.Is(err, ErrTooLarge) || ctx.Err() != nil {
+			return icon, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// get requests u once the interval since the last request has passed
+func (f *Fetcher) get(ctx context.Context, u *url.URL) (*http.Response, error) {
+	f.mu.Lock()
+	wait := time.Until(f.last.Add(f.Interval))
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			f.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+	f.last = time.Now()
+	f.mu.Unlock()
+
+	stripped := *u
+	stripped.User = nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stripped.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// fetchIcon downloads the image at u, failing with ErrNotFound if there
+// is none and ErrTooLarge if it is over MaxIconSize
+func (f *Fetcher) fetchIcon(ctx context.Context, u *url.URL) (*Icon, error) {
+	resp, err := f.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrNotFound
+	}
+	if resp.ContentLength > MaxIconSize {
+		return nil, ErrTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxIconSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxIconSize {
+		return nil, ErrTooLarge
+	}
+
+	// Sites answer a missing /favicon.ico with an HTML page surprisingly
+	// often, so the type is checked against the data too
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	switch {
+	case len(data) == 0:
+		return nil, ErrNotFound
+	case strings.HasPrefix(sniffed, "image/"):
+		contentType = sniffed
+	case contentType != "image/svg+xml" || sniffed == "text/html":
+		return nil, ErrNotFound
+	}
+	return &Icon{ContentType: contentType, Data: data, URL: resp.Request.URL.String()}, nil
+}
+
+// fetchLinks downloads the page at u and returns its URL after redirects
+// and the icons its head links to, those with rel="icon" first
+func (f *Fetcher) fetchLinks(ctx context.Context, u *url.URL) (*url.URL, []string, error) {
+	resp, err := f.get(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, ErrNotFound
+	}
+
+	var icons, touchIcons []string
+	tokens := html.NewTokenizer(io.LimitReader(resp.Body, maxPageSize))
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			return resp.Request.URL, append(icons, touchIcons...), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokens.Token()
+			if token.Data == "body" {
+				return resp.Request.URL, append(icons, touchIcons...), nil
+			}
+			if token.Data != "link" {
+				continue
+			}
+			var rel, href string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "rel":
+					rel = strings.ToLower(attr.Val)
+				case "href":
+					href = strings.TrimSpace(attr.Val)
+				}
+			}
+			if href == "" {
+				continue
+			}
+			for _, kind := range strings.Fields(rel) {
+				if kind == "icon" {
+					icons = append(icons, href)
+					break
+				}
+				if kind == "apple-touch-icon" {
+					touchIcons = append(touchIcons, href)
+					break
+				}
+			}
+		}
+	}
+}
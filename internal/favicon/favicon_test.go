@@ -0,0 +1,159 @@
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// png is the start of a PNG file, enough for content sniffing
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newTestFetcher() *Fetcher {
+	f := NewFetcher()
+	f.Interval = 0
+	return f
+}
+
+func TestFetchFaviconICO(t *testing.T) {
+	ico := []byte("\x00\x00\x01\x00\x01\x00\x10\x10")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+			t.Errorf("Expected no credentials, got %v", r.Header)
+		}
+		if r.URL.Path != "/favicon.ico" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(ico)
+	}))
+	defer server.Close()
+
+	// Credentials in the URL of an entry are never sent
+	siteURL := strings.Replace(server.URL, "http://", "http://alice:hunter2@", 1) + "/login"
+	icon, err := newTestFetcher().Fetch(context.Background(), siteURL)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if icon.ContentType != "image/x-icon" || !bytes.Equal(icon.Data, ico) {
+		t.Errorf("Unexpected icon %q of type %s", icon.Data, icon.ContentType)
+	}
+}
+
+func TestFetchLinkedIcon(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/favicon.ico":
+			// A soft 404: a page where the icon should be
+			w.Write([]byte("<html><body>Not here</body></html>"))
+		case "/":
+			http.Redirect(w, r, "/home/", http.StatusFound)
+		case "/home/":
+			w.Write([]byte(`<!doctype html><html><head>
+				<link rel="apple-touch-icon" href="/touch.png">
+				<link rel="Shortcut Icon" href="static/icon.png">
+				</head><body><link rel="icon" href="/ignored.png"></body></html>`))
+		case "/home/static/icon.png":
+			w.Write(png)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	icon, err := newTestFetcher().Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if icon.ContentType != "image/png" || icon.URL != server.URL+"/home/static/icon.png" {
+		t.Errorf("Expected the icon linked from the redirected homepage, got %s from %s", icon.ContentType, icon.URL)
+	}
+}
+
+func TestFetchSVGIcon(t *testing.T) {
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1"/>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<head><link rel="icon" href="/icon.svg" type="image/svg+xml"></head>`))
+		case "/icon.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(svg))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	icon, err := newTestFetcher().Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if icon.ContentType != "image/svg+xml" || string(icon.Data) != svg {
+		t.Errorf("Unexpected icon %q of type %s", icon.Data, icon.ContentType)
+	}
+}
+
+func TestFetchRejectsOversizedIcon(t *testing.T) {
+	large := append(append([]byte{}, png...), make([]byte, MaxIconSize)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without a Content-Length, so the cap on reading is what stops it
+		w.(http.Flusher).Flush()
+		w.Write(large)
+	}))
+	defer server.Close()
+
+	if _, err := newTestFetcher().Fetch(context.Background(), server.URL); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestFetchNoIcon(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<head><link rel="icon" href="javascript:alert(1)"><link rel="icon" href="/gone.png"></head>`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	if _, err := newTestFetcher().Fetch(context.Background(), server.URL); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := newTestFetcher().Fetch(context.Background(), "ftp://example.com"); err == nil {
+		t.Error("Expected a URL that is not http or https to be rejected")
+	}
+}
+
+func TestFetchStopsRedirectLoops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	if _, err := newTestFetcher().Fetch(context.Background(), server.URL); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the redirect loop to fail, got %v", err)
+	}
+}
+
+func TestFetchWaitsBetweenRequests(t *testing.T) {
+	var requests []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	f := NewFetcher()
+	f.Interval = 50 * time.Millisecond
+	f.Fetch(context.Background(), server.URL)
+	if len(requests) != 2 || requests[1].Sub(requests[0]) < f.Interval {
+		t.Errorf("Expected two requests at least %s apart, got %v", f.Interval, requests)
+	}
+}
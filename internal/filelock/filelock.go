@@ -0,0 +1,45 @@
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned by TryLock when another process holds the lock
+var ErrLocked = errors.New("file is locked by another process")
+
+// Lock is an exclusive advisory lock held on an open file. It is released
+// by Unlock or when the process exits.
+type Lock struct {
+	f *os.File
+}
+
+// TryLock takes an exclusive lock on the file at path, creating it if
+// needed. It does not wait: if the lock is held elsewhere it returns
+// ErrLocked. On systems without file locking the lock always succeeds.
+func TryLock(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock. The lock file itself is left in place, since
+// removing it would race with a process about to lock it.
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.f = nil
+	return err
+}
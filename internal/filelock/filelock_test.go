@@ -0,0 +1,32 @@
+package filelock
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.lock")
+
+	first, err := TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+	if _, err := TryLock(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked while the lock is held, got %v", err)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if err := first.Unlock(); err != nil {
+		t.Errorf("Expected a second Unlock to be a no-op, got %v", err)
+	}
+
+	second, err := TryLock(path)
+	if err != nil {
+		t.Fatalf("Expected TryLock to succeed after Unlock, got %v", err)
+	}
+	second.Unlock()
+}
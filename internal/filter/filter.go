@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// Filter selects entries by tag and name pattern. All conditions must
+// hold (AND semantics); an empty filter matches everything. It is built
+// once and applied to decrypted entries.
+type Filter struct {
+	tags       []string
+	globs      []*Glob
+	ignoreCase bool
+}
+
+// New builds a filter requiring every tag in tags and a name matching
+// every pattern in patterns
+func New(tags, patterns []string, ignoreCase bool) (*Filter, error) {
+	f := &Filter{tags: tags, ignoreCase: ignoreCase}
+	for _, pattern := range patterns {
+		g, err := CompileGlob(pattern, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		f.globs = append(f.globs, g)
+	}
+	return f, nil
+}
+
+// Empty reports whether the filter has no conditions
+func (f *Filter) Empty() bool {
+	return len(f.tags) == 0 && len(f.globs) == 0
+}
+
+// Matches reports whether entry satisfies every condition
+func (f *Filter) Matches(entry *storage.PasswordEntry) bool {
+	for _, tag := range f.tags {
+		if !f.hasTag(entry.Tags, tag) {
+			return false
+		}
+	}
+	for _, g := range f.globs {
+		if !g.Match(entry.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the entries matching the filter
+func (f *Filter) Apply(entries []*storage.PasswordEntry) []*storage.PasswordEntry {
+	var matched []*storage.PasswordEntry
+	for _, entry := range entries {
+		if f.Matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+func (f *Filter) hasTag(tags []string, want string) bool {
+	for _, tag := range tags {
+		if tag == want || f.ignoreCase && strings.EqualFold(tag, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the filter as an expression such as
+// "tag=shared-infra AND match=aws-*", or "" for an empty filter
+func (f *Filter) String() string {
+	var parts []string
+	for _, tag := range f.tags {
+		parts = append(parts, "tag="+tag)
+	}
+	for _, g := range f.globs {
+		parts = append(parts, "match="+g.String())
+	}
+	expr := strings.Join(parts, " AND ")
+	if expr != "" && f.ignoreCase {
+		expr += " (ignoring case)"
+	}
+	return expr
+}
@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		name       string
+		ignoreCase bool
+		want       bool
+	}{
+		{"aws-*", "aws-prod", false, true},
+		{"aws-*", "aws-", false, true},
+		{"aws-*", "gcp-prod", false, false},
+		{"*", "", false, true},
+		{"a**b", "axyzb", false, true},
+		{"?", "é", false, true},
+		{"??", "é", false, false},
+		{"café-*", "café-paris", false, true},
+		{"銀行*", "銀行口座", false, true},
+		{"*/prod", "team/a/prod", false, true},
+		{"[abc]x", "bx", false, true},
+		{"[!abc]x", "bx", false, false},
+		{"[^abc]x", "dx", false, true},
+		{"[a-c]*", "cat", false, true},
+		{"[]]", "]", false, true},
+		{`\*`, "*", false, true},
+		{`\*`, "a", false, false},
+		{`a\?`, "a?", false, true},
+		{`a\?`, "ab", false, false},
+		{`[\]]`, "]", false, true},
+		{"AWS-*", "aws-prod", false, false},
+		{"AWS-*", "aws-prod", true, true},
+		{"[A-C]at", "bat", true, true},
+		{"ÉTÉ", "été", true, true},
+	}
+
+	for _, tt := range tests {
+		g, err := CompileGlob(tt.pattern, tt.ignoreCase)
+		if err != nil {
+			t.Errorf("CompileGlob(%q) failed: %v", tt.pattern, err)
+			continue
+		}
+		if got := g.Match(tt.name); got != tt.want {
+			t.Errorf("%q.Match(%q) ignoreCase=%t = %t, want %t", tt.pattern, tt.name, tt.ignoreCase, got, tt.want)
+		}
+	}
+}
+
+func TestCompileGlobInvalid(t *testing.T) {
+	for _, pattern := range []string{`abc\`, "[abc", "[]", "[z-a]", "[!"} {
+		if _, err := CompileGlob(pattern, false); err == nil {
+			t.Errorf("Expected error for %q", pattern)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	entries := []*storage.PasswordEntry{
+		{Name: "aws-prod", Tags: []string{"shared-infra", "cloud"}},
+		{Name: "aws-dev", Tags: []string{"cloud"}},
+		{Name: "grafana", Tags: []string{"shared-infra"}},
+		{Name: "bank", Tags: nil},
+	}
+
+	tests := []struct {
+		tags     []string
+		patterns []string
+		want     []string
+		expr     string
+	}{
+		{nil, nil, []string{"aws-prod", "aws-dev", "grafana", "bank"}, ""},
+		{[]string{"shared-infra"}, nil, []string{"aws-prod", "grafana"}, "tag=shared-infra"},
+		{nil, []string{"aws-*"}, []string{"aws-prod", "aws-dev"}, "match=aws-*"},
+		{[]string{"shared-infra"}, []string{"aws-*"}, []string{"aws-prod"}, "tag=shared-infra AND match=aws-*"},
+		{[]string{"shared-infra", "cloud"}, nil, []string{"aws-prod"}, "tag=shared-infra AND tag=cloud"},
+		{[]string{"missing"}, nil, nil, "tag=missing"},
+	}
+
+	for _, tt := range tests {
+		f, err := New(tt.tags, tt.patterns, false)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		var got []string
+		for _, entry := range f.Apply(entries) {
+			got = append(got, entry.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Filter %q matched %v, want %v", f, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Filter %q matched %v, want %v", f, got, tt.want)
+				break
+			}
+		}
+		if f.String() != tt.expr {
+			t.Errorf("String() = %q, want %q", f.String(), tt.expr)
+		}
+	}
+}
+
+func TestFilterIgnoreCaseTags(t *testing.T) {
+	f, err := New([]string{"Shared-Infra"}, nil, true)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if !f.Matches(&storage.PasswordEntry{Name: "x", Tags: []string{"shared-infra"}}) {
+		t.Error("Expected tags to match ignoring case")
+	}
+	if f.String() != "tag=Shared-Infra (ignoring case)" {
+		t.Errorf("Unexpected expression %q", f.String())
+	}
+}
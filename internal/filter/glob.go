@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Glob is a compiled shell-style pattern. "*" matches any run of
+// characters, "?" a single character, "[a-z]" a class ("[!a-z]" or
+// "[^a-z]" negated) and "\" escapes the next character. Unlike
+// path.Match, "/" is an ordinary character and matching works on runes.
+type Glob struct {
+	pattern    string
+	tokens     []token
+	ignoreCase bool
+}
+
+type tokenKind int
+
+const (
+	literal tokenKind = iota
+	anyOne
+	anyRun
+	class
+)
+
+type token struct {
+	kind    tokenKind
+	r       rune
+	ranges  [][2]rune
+	negated bool
+}
+
+// CompileGlob parses pattern. With ignoreCase set, letters match
+// regardless of case (using simple Unicode case folding).
+func CompileGlob(pattern string, ignoreCase bool) (*Glob, error) {
+	g := &Glob{pattern: pattern, ignoreCase: ignoreCase}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			// Consecutive stars behave like one
+			if len(g.tokens) == 0 || g.tokens[len(g.tokens)-1].kind != anyRun {
+				g.tokens = append(g.tokens, token{kind: anyRun})
+			}
+		case '?':
+			g.tokens = append(g.tokens, token{kind: anyOne})
+		case '\\':
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("invalid pattern %q: trailing backslash", pattern)
+			}
+			i++
+			g.tokens = append(g.tokens, token{kind: literal, r: runes[i]})
+		case '[':
+			t, next, err := parseClass(runes, i+1)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			g.tokens = append(g.tokens, t)
+			i = next
+		default:
+			g.tokens = append(g.tokens, token{kind: literal, r: r})
+		}
+	}
+	return g, nil
+}
+
+// parseClass parses a character class starting after "[" and returns the
+// token and the index of the closing "]"
+func parseClass(runes []rune, i int) (token, int, error) {
+	t := token{kind: class}
+	if i < len(runes) && (runes[i] == '!' || runes[i] == '^') {
+		t.negated = true
+		i++
+	}
+
+	first := true
+	for ; i < len(runes); i++ {
+		r := runes[i]
+		if r == ']' && !first {
+			if len(t.ranges) == 0 {
+				return token{}, 0, fmt.Errorf("empty character class")
+			}
+			return t, i, nil
+		}
+		first = false
+
+		if r == '\\' {
+			if i+1 >= len(runes) {
+				break
+			}
+			i++
+			r = runes[i]
+		}
+		lo, hi := r, r
+		if i+2 < len(runes) && runes[i+1] == '-' && runes[i+2] != ']' {
+			hi = runes[i+2]
+			if hi == '\\' && i+3 < len(runes) {
+				hi = runes[i+3]
+				i++
+			}
+			i += 2
+			if hi < lo {
+				return token{}, 0, fmt.Errorf("invalid range %c-%c", lo, hi)
+			}
+		}
+		t.ranges = append(t.ranges, [2]rune{lo, hi})
+	}
+	return token{}, 0, fmt.Errorf("unterminated character class")
+}
+
+// String returns the pattern the glob was compiled from
+func (g *Glob) String() string {
+	return g.pattern
+}
+
+// Match reports whether s matches the whole pattern
+func (g *Glob) Match(s string) bool {
+	return g.match(g.tokens, []rune(s))
+}
+
+func (g *Glob) match(tokens []token, s []rune) bool {
+	for len(tokens) > 0 {
+		t := tokens[0]
+		if t.kind == anyRun {
+			rest := tokens[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if g.match(rest, s[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(s) == 0 || !g.matchOne(t, s[0]) {
+			return false
+		}
+		tokens, s = tokens[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// matchOne matches a single-rune token
+func (g *Glob) matchOne(t token, r rune) bool {
+	switch t.kind {
+	case anyOne:
+		return true
+	case literal:
+		return r == t.r || g.ignoreCase && foldEqual(r, t.r)
+	case class:
+		in := false
+		for _, rg := range t.ranges {
+			if inRange(r, rg) || g.ignoreCase && (inRange(unicode.ToLower(r), rg) || inRange(unicode.ToUpper(r), rg)) {
+				in = true
+				break
+			}
+		}
+		return in != t.negated
+	}
+	return false
+}
+
+func inRange(r rune, rg [2]rune) bool {
+	return r >= rg[0] && r <= rg[1]
+}
+
+// foldEqual reports whether a and b are equal under simple case folding
+func foldEqual(a, b rune) bool {
+	return strings.EqualFold(string(a), string(b))
+}
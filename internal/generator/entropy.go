@@ -0,0 +1,235 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// GuessesPerSecond is the rate of an offline attack on a fast hash that
+// crack times are estimated for
+const GuessesPerSecond = 1e10
+
+// commonWords are the words most often found in leaked passwords, which
+// an attacker tries before any other
+var commonWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		password passwd letmein welcome admin administrator login master
+		monkey dragon shadow sunshine princess football baseball soccer
+		hockey iloveyou trustno superman batman qwerty azerty
+		hello secret freedom whatever michael jennifer jordan hunter
+		ranger buster tigger charlie summer winter spring autumn love
+		lovely flower angel cookie cheese computer internet google
+		starwars pokemon matrix killer pepper ginger orange banana
+		changeme default guest root test user access family`) {
+		commonWords[word] = true
+	}
+}
+
+// leetSubstitutions are the look-alike characters undone before looking
+// for words, so "P@ssw0rd" is found as "password"
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', '!': 'i',
+}
+
+// keyboardRows are the rows of a US QWERTY keyboard, for finding walks
+// such as "qwerty" and "asdf"
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// estimateEntropy estimates the entropy of password, whose characters are
+// taken from a pool of pool characters. Characters drawn at random add
+// log2(pool) bits each; a dictionary word, a run of one character, a
+// sequence such as "abcd" or "4321" and a keyboard walk such as "qwerty"
+// add only what it takes to guess which one it is.
+func estimateEntropy(password string, pool int) float64 {
+	runes := []rune(password)
+	charBits := math.Log2(float64(pool))
+	bits := 0.0
+	for i := 0; i < len(runes); {
+		n, cost := longestPattern(runes[i:], charBits)
+		if n == 0 {
+			bits += charBits
+			i++
+			continue
+		}
+		bits += cost
+		i += n
+	}
+	return bits
+}
+
+// longestPattern returns the length and cost in bits of the longest
+// pattern at the start of runes that is cheaper to guess than its
+// characters, or 0 if there is none
+func longestPattern(runes []rune, charBits float64) (int, float64) {
+	bestLength, bestCost := 0, 0.0
+	for _, match := range []func([]rune) (int, float64){wordAt, repeatAt, sequenceAt, walkAt} {
+		n, cost := match(runes)
+		if n == 0 || cost >= float64(n)*charBits {
+			continue
+		}
+		if n > bestLength || (n == bestLength && cost < bestCost) {
+			bestLength, bestCost = n, cost
+		}
+	}
+	return bestLength, bestCost
+}
+
+// wordAt matches the longest common word, of four or more letters, or
+// word of the passphrase list, of five or more, at the start of runes. A
+// capital letter or a look-alike substitution in it adds a bit each.
+func wordAt(runes []rune) (int, float64) {
+	var normalized []rune
+	var capitalized, substituted []bool
+	for _, r := range runes[:min(len(runes), 16)] {
+		plain, leet := leetSubstitutions[r]
+		if !leet {
+			plain = r
+		}
+		lower := unicode.ToLower(plain)
+		if lower < 'a' || lower > 'z' {
+			break
+		}
+		normalized = append(normalized, lower)
+		capitalized = append(capitalized, lower != plain)
+		substituted = append(substituted, leet)
+	}
+
+	list, set := wordlist()
+	for n := len(normalized); n >= 4; n-- {
+		word := string(normalized[:n])
+		var size int
+		switch {
+		case commonWords[word]:
+			size = len(commonWords)
+		case n >= 5 && set[word]:
+			size = len(list)
+		default:
+			continue
+		}
+		cost := math.Log2(float64(size))
+		for _, variant := range [][]bool{capitalized[:n], substituted[:n]} {
+			for _, changed := range variant {
+				if changed {
+					cost++
+					break
+				}
+			}
+		}
+		return n, cost
+	}
+	return 0, 0
+}
+
+// repeatAt matches a run of three or more of one character, which costs
+// the character and the length of the run
+func repeatAt(runes []rune) (int, float64) {
+	n := 1
+	for n < len(runes) && runes[n] == runes[0] {
+		n++
+	}
+	if n < 3 {
+		return 0, 0
+	}
+	return n, math.Log2(float64(len(Symbols)+len(Numbers)+2*len(Lowercase))) + math.Log2(float64(n))
+}
+
+// sequenceAt matches three or more letters or digits that step up or down
+// by one, such as "abcd" or "4321", which cost the first character, the
+// direction and the length
+func sequenceAt(runes []rune) (int, float64) {
+	if len(runes) < 3 {
+		return 0, 0
+	}
+	first, second := unicode.ToLower(runes[0]), unicode.ToLower(runes[1])
+	step := second - first
+	letters := unicode.IsLetter(first) && first <= 'z'
+	if (step != 1 && step != -1) || !(letters || unicode.IsDigit(first)) {
+		return 0, 0
+	}
+
+	sameClass := func(r rune) bool {
+		if letters {
+			return unicode.IsLetter(r) && unicode.ToLower(r) <= 'z'
+		}
+		return unicode.IsDigit(r)
+	}
+	n := 1
+	for n < len(runes) && sameClass(runes[n]) && unicode.ToLower(runes[n])-unicode.ToLower(runes[n-1]) == step {
+		n++
+	}
+	if n < 3 {
+		return 0, 0
+	}
+	start := float64(len(Numbers))
+	if letters {
+		start = float64(len(Lowercase))
+	}
+	return n, math.Log2(start) + 1 + math.Log2(float64(n))
+}
+
+// walkAt matches four or more neighbouring keys along a keyboard row, such
+// as "qwer" or "lkjh", which cost the first key, the direction and the
+// length
+func walkAt(runes []rune) (int, float64) {
+	if len(runes) < 4 {
+		return 0, 0
+	}
+	keys := 0
+	for _, row := range keyboardRows {
+		keys += len(row)
+	}
+	for _, row := range keyboardRows {
+		start := strings.IndexRune(row, unicode.ToLower(runes[0]))
+		if start < 0 {
+			continue
+		}
+		for _, step := range []int{1, -1} {
+			n := 1
+			for pos := start + step; n < len(runes) && pos >= 0 && pos < len(row) && rune(row[pos]) == unicode.ToLower(runes[n]); pos += step {
+				n++
+			}
+			if n >= 4 {
+				return n, math.Log2(float64(keys)) + 1 + math.Log2(float64(n))
+			}
+		}
+	}
+	return 0, 0
+}
+
+// crackTime describes how long an offline attack at GuessesPerSecond
+// takes on average to guess a password of bits of entropy
+func crackTime(bits float64) string {
+	seconds := math.Pow(2, bits-1) / GuessesPerSecond
+	if seconds < 1 {
+		return "less than a second"
+	}
+	for _, unit := range []struct {
+		name    string
+		seconds float64
+	}{
+		{"century", 100 * 365 * 24 * 3600},
+		{"year", 365 * 24 * 3600},
+		{"month", 30 * 24 * 3600},
+		{"day", 24 * 3600},
+		{"hour", 3600},
+		{"minute", 60},
+		{"second", 1},
+	} {
+		if seconds < unit.seconds {
+			continue
+		}
+		if unit.name == "century" {
+			return "centuries"
+		}
+		n := int(seconds / unit.seconds)
+		if n == 1 {
+			return "1 " + unit.name
+		}
+		return fmt.Sprintf("%d %ss", n, unit.name)
+	}
+	return "less than a second"
+}
@@ -0,0 +1,196 @@
+package generator
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// effLargeWordlist is the EFF large wordlist for dice-generated
+// passphrases, one "<dice rolls>\t<word>" line for each of its 7,776
+// words. It is published by the Electronic Frontier Foundation under
+// CC BY 3.0 at https://www.eff.org/dice.
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+// wordlist returns the words of effLargeWordlist, and the same words as a
+// set for analysis
+var wordlist = sync.OnceValues(func() ([]string, map[string]bool) {
+	var words []string
+	set := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(effLargeWordlist), "\n") {
+		_, word, _ := strings.Cut(line, "\t")
+		words = append(words, word)
+		set[word] = true
+	}
+	return words, set
+})
+
+// Word returns word n of the EFF large wordlist, counting from 0 and
+// wrapping around at its end
+func Word(n uint32) string {
+	list, _ := wordlist()
+	return list[n%uint32(len(list))]
+}
+
+// Passphrase lengths, in words
+const (
+	MinPassphraseWords = 4
+	MaxPassphraseWords = 10
+)
+
+// Capitalization modes of a passphrase
+const (
+	// CapitalizeNone leaves every word in lowercase
+	CapitalizeNone = "none"
+	// CapitalizeFirst capitalizes the first letter of every word
+	CapitalizeFirst = "first"
+	// CapitalizeRandom capitalizes the first letter of each word with a
+	// chance of one half, adding a bit of entropy per word
+	CapitalizeRandom = "random"
+)
+
+// PassphraseConfig holds configuration for passphrase generation
+type PassphraseConfig struct {
+	// Words is the number of words, from MinPassphraseWords to
+	// MaxPassphraseWords
+	Words int
+	// Separator joins the words and may be empty; it cannot contain
+	// letters, so the words can be told apart
+	Separator string
+	// Capitalize is one of CapitalizeNone, CapitalizeFirst and
+	// CapitalizeRandom; empty means CapitalizeNone
+	Capitalize string
+	// Digit appends a random digit to a random word
+	Digit bool
+}
+
+// DefaultPassphraseConfig returns a default passphrase configuration
+func DefaultPassphraseConfig() *PassphraseConfig {
+	return &PassphraseConfig{
+		Words:      6,
+		Separator:  "-",
+		Capitalize: CapitalizeNone,
+	}
+}
+
+// GeneratePassphrase creates a passphrase of words drawn from the EFF
+// large wordlist, such as "correct-horse-battery-staple-copper-mango".
+// Each word adds about 12.9 bits of entropy.
+func GeneratePassphrase(config *PassphraseConfig) (string, error) {
+	if config == nil {
+		config = DefaultPassphraseConfig()
+	}
+	if config.Words < MinPassphraseWords || config.Words > MaxPassphraseWords {
+		return "", fmt.Errorf("%w: a passphrase has %d to %d words, not %d",
+			ErrInvalidConfig, MinPassphraseWords, MaxPassphraseWords, config.Words)
+	}
+	if strings.IndexFunc(config.Separator, unicode.IsLetter) >= 0 {
+		return "", fmt.Errorf("%w: word separator %q cannot contain letters", ErrInvalidConfig, config.Separator)
+	}
+	switch config.Capitalize {
+	case "", CapitalizeNone, CapitalizeFirst, CapitalizeRandom:
+	default:
+		return "", fmt.Errorf("%w: capitalization %q is not one of %s, %s or %s",
+			ErrInvalidConfig, config.Capitalize, CapitalizeNone, CapitalizeFirst, CapitalizeRandom)
+	}
+
+	list, _ := wordlist()
+	words := make([]string, config.Words)
+	for i := range words {
+		index, err := randomInt(len(list))
+		if err != nil {
+			return "", fmt.Errorf("failed to pick a word: %w", err)
+		}
+		words[i] = list[index]
+
+		capitalize := config.Capitalize == CapitalizeFirst
+		if config.Capitalize == CapitalizeRandom {
+			coin, err := randomInt(2)
+			if err != nil {
+				return "", fmt.Errorf("failed to pick a capitalization: %w", err)
+			}
+			capitalize = coin == 1
+		}
+		if capitalize {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+
+	if config.Digit {
+		word, err := randomInt(len(words))
+		if err != nil {
+			return "", fmt.Errorf("failed to pick a word: %w", err)
+		}
+		digit, err := randomChar(Numbers)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random digit: %w", err)
+		}
+		words[word] += string(digit)
+	}
+
+	return strings.Join(words, config.Separator), nil
+}
+
+// randomInt returns a uniform random integer in [0, n)
+func randomInt(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate random index: %w", err)
+	}
+	return int(index.Int64()), nil
+}
+
+// passphraseEntropy recognizes a passphrase: three or more words of the
+// EFF large wordlist separated by anything but letters, any of them
+// capitalized and one of them followed by a digit. It returns the number
+// of words and the entropy of a passphrase drawn like it, or 0 and 0.
+func passphraseEntropy(password string) (int, float64) {
+	fields := strings.FieldsFunc(password, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if len(fields) < 3 {
+		return 0, 0
+	}
+
+	list, set := wordlist()
+	n, capitalized, digits := 0, 0, 0
+	for i := 0; i < len(fields); i++ {
+		word := strings.TrimRightFunc(fields[i], unicode.IsDigit)
+		if suffix := len(fields[i]) - len(word); suffix > 1 || (suffix == 1 && digits > 0) {
+			return 0, 0
+		} else if suffix == 1 {
+			digits++
+		}
+		if first, size := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+			capitalized++
+			word = string(unicode.ToLower(first)) + word[size:]
+		}
+		// A few words, such as t-shirt, have a hyphen of their own
+		if !set[word] && i+1 < len(fields) && set[word+"-"+fields[i+1]] {
+			word += "-" + fields[i+1]
+			i++
+		}
+		if !set[word] {
+			return 0, 0
+		}
+		n++
+	}
+	if n < 3 {
+		return 0, 0
+	}
+
+	bits := float64(n) * math.Log2(float64(len(list)))
+	if capitalized > 0 && capitalized < n {
+		bits += float64(n)
+	}
+	if digits > 0 {
+		bits += math.Log2(10) + math.Log2(float64(n))
+	}
+	return n, bits
+}
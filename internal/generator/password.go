@@ -2,9 +2,13 @@ package generator
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Character sets for password generation
@@ -15,6 +19,19 @@ const (
 	Symbols   = "!@#$%^&*()_+-=[]{}|;:,.<>?"
 )
 
+// ErrInvalidConfig is wrapped by the errors of a configuration nothing
+// can be generated from, such as a length under 8 or a character set
+// whose every character is excluded
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// MobileSymbols are the symbols MobileFriendly draws from instead of
+// Symbols: those one tap away on the stock phone keyboards. All of them
+// are on the "?123" layer of Gboard, the Android default. The "123"
+// layer of the iOS keyboard has all but # and *, which are on the next
+// layer. The others, such as ^ [ ] { } | \ and ~, are two taps or more
+// away on both.
+const MobileSymbols = "!@#$&*()'\".,?-/:;"
+
 // PasswordConfig holds configuration for password generation
 type PasswordConfig struct {
 	Length     int
@@ -24,8 +41,28 @@ type PasswordConfig struct {
 	Symbols    bool
 	Exclude    string // Characters to exclude
 	NoRepeating bool  // Avoid consecutive repeating characters
+	// RequireEachClass guarantees at least one character from each
+	// selected set. Without it every position is drawn uniformly from the
+	// combined set, so a short password may lack a class.
+	RequireEachClass bool
+	// ChunkSize splits the password into groups of that many characters,
+	// such as "Xk3f-9qLm-Tt2v", for reading aloud; 0 means no groups
+	ChunkSize int
+	// ChunkSeparator joins the groups; empty means DefaultChunkSeparator
+	ChunkSeparator string
+	// SeparatorCounts makes Length include the separators. By default it
+	// counts only the generated characters, so grouping a password never
+	// makes it weaker.
+	SeparatorCounts bool
+	// MobileFriendly draws symbols from MobileSymbols only, so the
+	// password is quick to type on a phone. Letters and digits are left
+	// as they are.
+	MobileFriendly bool
 }
 
+// DefaultChunkSeparator joins the groups of a chunked password
+const DefaultChunkSeparator = "-"
+
 // DefaultConfig returns a default password configuration
 func DefaultConfig() *PasswordConfig {
 	return &PasswordConfig{
@@ -36,6 +73,7 @@ func DefaultConfig() *PasswordConfig {
 		Symbols:    true,
 		Exclude:    "",
 		NoRepeating: true,
+		RequireEachClass: true,
 	}
 }
 
@@ -45,27 +83,47 @@ func GeneratePassword(config *PasswordConfig) (string, error) {
 		config = DefaultConfig()
 	}
 
+	// The groups are formed once the characters are drawn
+	if config.ChunkSize != 0 {
+		return generateChunked(config)
+	}
+
 	// Validate configuration
 	if err := validateConfig(config); err != nil {
-		return "", fmt.Errorf("invalid configuration: %w", err)
+		return "", fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
 
 	// Build character set based on configuration
 	charSet := buildCharSet(config)
 	if len(charSet) == 0 {
-		return "", fmt.Errorf("no character sets selected")
+		return "", fmt.Errorf("%w: no character sets selected", ErrInvalidConfig)
 	}
 
-	// Ensure minimum length
-	if config.Length < len(charSet) {
-		return "", fmt.Errorf("password length %d is too short for selected character sets", config.Length)
+	// Replacing repeated characters can take out the only character of a
+	// class, so such a password is drawn again
+	for attempt := 1; ; attempt++ {
+		password, err := generateOnce(config, charSet)
+		if err != nil || !config.RequireEachClass || len(MissingClasses(password, config)) == 0 {
+			return password, err
+		}
+		if attempt == classAttempts {
+			return "", fmt.Errorf("failed to generate a password with every character set")
+		}
 	}
+}
+
+// classAttempts is how many passwords GeneratePassword draws before
+// giving up on one holding a character of every selected set
+const classAttempts = 100
 
-	// Generate password
+// generateOnce draws a password from charSet as configured
+func generateOnce(config *PasswordConfig, charSet string) (string, error) {
 	password := make([]byte, config.Length)
 	
 	// First, ensure at least one character from each selected set
-	password = ensureCharacterSets(password, config)
+	if config.RequireEachClass {
+		password = ensureCharacterSets(password, config)
+	}
 	
 	// Fill remaining positions randomly
 	for i := 0; i < config.Length; i++ {
@@ -78,17 +136,115 @@ func GeneratePassword(config *PasswordConfig) (string, error) {
 		}
 	}
 
-	// Apply no-repeating rule if enabled
-	if config.NoRepeating {
-		password = applyNoRepeatingRule(password)
-	}
-
 	// Shuffle the password to avoid predictable patterns
 	shufflePassword(password)
 
+	// Apply no-repeating rule if enabled, once the characters are in
+	// their final places
+	if config.NoRepeating {
+		var err error
+		password, err = applyNoRepeatingRule(password, charSet)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	return string(password), nil
 }
 
+// generateChunked generates the characters of a chunked password and
+// groups them
+func generateChunked(config *PasswordConfig) (string, error) {
+	if config.ChunkSize < 0 {
+		return "", fmt.Errorf("%w: chunk size cannot be negative", ErrInvalidConfig)
+	}
+	separator := config.ChunkSeparator
+	if separator == "" {
+		separator = DefaultChunkSeparator
+	}
+	if strings.IndexFunc(separator, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+		return "", fmt.Errorf("%w: chunk separator %q cannot contain letters or digits", ErrInvalidConfig, separator)
+	}
+	if config.Exclude != "" && strings.ContainsAny(separator, config.Exclude) {
+		return "", fmt.Errorf("%w: chunk separator %q uses excluded characters", ErrInvalidConfig, separator)
+	}
+
+	// With the separators counted, as many characters are drawn as fit
+	// in Length together with the separators between their groups
+	chars := *config
+	chars.ChunkSize = 0
+	// The groups never hold the separator, or they could not be told apart
+	chars.Exclude += separator
+	if config.SeparatorCounts {
+		sepLen := utf8.RuneCountInString(separator)
+		n := 0
+		for next := 1; next+(next-1)/config.ChunkSize*sepLen <= config.Length; next++ {
+			n = next
+		}
+		if n < 8 {
+			return "", fmt.Errorf("%w: length %d leaves fewer than 8 characters once the separators are counted", ErrInvalidConfig, config.Length)
+		}
+		chars.Length = n
+	}
+
+	password, err := GeneratePassword(&chars)
+	if err != nil {
+		return "", err
+	}
+	return chunk(password, config.ChunkSize, separator), nil
+}
+
+// chunk joins the groups of size characters of password with separator
+func chunk(password string, size int, separator string) string {
+	var out strings.Builder
+	for i := 0; i < len(password); i += size {
+		if i > 0 {
+			out.WriteString(separator)
+		}
+		out.WriteString(password[i:min(i+size, len(password))])
+	}
+	return out.String()
+}
+
+// chunkSeparator recognizes a chunked password: at least three groups of
+// letters, digits and symbols, all of one size but the last which may be
+// shorter, joined by a separator of symbols found nowhere else. It
+// returns the separator and the password without it, or "" and the
+// password unchanged.
+func chunkSeparator(password string) (string, string) {
+	runes := []rune(password)
+	alnum := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	// The groups may hold symbols too, so every size of the first group
+	// is tried with every run of symbols after it as the separator
+	for size := 1; size < len(runes); size++ {
+		for end := size + 1; end < len(runes) && !alnum(runes[end-1]); end++ {
+			separator := string(runes[size:end])
+			if groups, ok := chunkGroups(password, separator, size); ok {
+				return separator, strings.Join(groups, "")
+			}
+		}
+	}
+	return "", password
+}
+
+// chunkGroups splits password at separator into groups of size
+// characters, the last possibly shorter, and reports whether it is made
+// of at least three of them, none holding a character of the separator
+func chunkGroups(password, separator string, size int) ([]string, bool) {
+	groups := strings.Split(password, separator)
+	if len(groups) < 3 {
+		return nil, false
+	}
+	for i, group := range groups {
+		n := utf8.RuneCountInString(group)
+		if n == 0 || n > size || (n < size && i < len(groups)-1) || strings.ContainsAny(group, separator) {
+			return nil, false
+		}
+	}
+	return groups, true
+}
+
 // validateConfig validates the password configuration
 func validateConfig(config *PasswordConfig) error {
 	if config.Length < 8 {
@@ -102,6 +258,19 @@ func validateConfig(config *PasswordConfig) error {
 	if !config.Uppercase && !config.Lowercase && !config.Numbers && !config.Symbols {
 		return fmt.Errorf("at least one character set must be selected")
 	}
+
+	// One character of each set must fit, and be left by the exclusions
+	if config.RequireEachClass {
+		classes := selectedClasses(config)
+		if config.Length < len(classes) {
+			return fmt.Errorf("password length %d is too short for %d character sets", config.Length, len(classes))
+		}
+		for _, class := range classes {
+			if withoutExcluded(class.chars, config.Exclude) == "" {
+				return fmt.Errorf("every character of %s is excluded", class.name)
+			}
+		}
+	}
 	
 	return nil
 }
@@ -120,7 +289,7 @@ func buildCharSet(config *PasswordConfig) string {
 		charSet.WriteString(Numbers)
 	}
 	if config.Symbols {
-		charSet.WriteString(Symbols)
+		charSet.WriteString(symbolChars(config))
 	}
 	
 	// Remove excluded characters
@@ -134,9 +303,53 @@ func buildCharSet(config *PasswordConfig) string {
 	return result
 }
 
-// ensureCharacterSets ensures at least one character from each selected set
+// symbolChars returns the symbols config draws from
+func symbolChars(config *PasswordConfig) string {
+	if config.MobileFriendly {
+		return MobileSymbols
+	}
+	return Symbols
+}
+
+// characterClass is a character set a password may be drawn from
+type characterClass struct {
+	name  string
+	chars string
+}
+
+// selectedClasses returns the character sets selected in config
+func selectedClasses(config *PasswordConfig) []characterClass {
+	var classes []characterClass
+	for _, class := range []struct {
+		characterClass
+		selected bool
+	}{
+		{characterClass{"uppercase", Uppercase}, config.Uppercase},
+		{characterClass{"lowercase", Lowercase}, config.Lowercase},
+		{characterClass{"numbers", Numbers}, config.Numbers},
+		{characterClass{"symbols", symbolChars(config)}, config.Symbols},
+	} {
+		if class.selected {
+			classes = append(classes, class.characterClass)
+		}
+	}
+	return classes
+}
+
+// withoutExcluded returns chars without the characters of exclude
+func withoutExcluded(chars, exclude string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(exclude, r) {
+			return -1
+		}
+		return r
+	}, chars)
+}
+
+// ensureCharacterSets ensures at least one character from each selected set,
+// drawn from the characters the exclusions leave
 func ensureCharacterSets(password []byte, config *PasswordConfig) []byte {
-	positions := make([]int, 0, 4)
+	positions := make([]int, 0, len(password))
 	
 	// Collect available positions
 	for i := range password {
@@ -145,70 +358,54 @@ func ensureCharacterSets(password []byte, config *PasswordConfig) []byte {
 	
 	// Shuffle positions to randomize placement
 	shuffleInts(positions)
-	posIndex := 0
-	
-	// Ensure uppercase if selected
-	if config.Uppercase {
-		if posIndex < len(positions) {
-			char, _ := randomChar(Uppercase)
-			password[positions[posIndex]] = char
-			posIndex++
-		}
-	}
 	
-	// Ensure lowercase if selected
-	if config.Lowercase {
-		if posIndex < len(positions) {
-			char, _ := randomChar(Lowercase)
-			password[positions[posIndex]] = char
-			posIndex++
+	for i, class := range selectedClasses(config) {
+		if i == len(positions) {
+			break
 		}
-	}
-	
-	// Ensure numbers if selected
-	if config.Numbers {
-		if posIndex < len(positions) {
-			char, _ := randomChar(Numbers)
-			password[positions[posIndex]] = char
-			posIndex++
-		}
-	}
-	
-	// Ensure symbols if selected
-	if config.Symbols {
-		if posIndex < len(positions) {
-			char, _ := randomChar(Symbols)
-			password[positions[posIndex]] = char
-			posIndex++
+		char, err := randomChar(withoutExcluded(class.chars, config.Exclude))
+		if err == nil {
+			password[positions[i]] = char
 		}
 	}
 	
 	return password
 }
 
-// applyNoRepeatingRule ensures no consecutive repeating characters
-func applyNoRepeatingRule(password []byte) []byte {
-	charSet := buildCharSet(&PasswordConfig{
-		Uppercase: true,
-		Lowercase: true,
-		Numbers:   true,
-		Symbols:   true,
-	})
-	
+// applyNoRepeatingRule ensures no consecutive repeating characters,
+// replacing repeats with other characters of charSet, the character set
+// the configuration built with its exclusions taken out
+func applyNoRepeatingRule(password []byte, charSet string) ([]byte, error) {
+	if strings.Trim(charSet, charSet[:min(1, len(charSet))]) == "" {
+		return nil, fmt.Errorf("%w: no repeating characters needs at least two characters to choose from", ErrInvalidConfig)
+	}
+
 	for i := 1; i < len(password); i++ {
-		if password[i] == password[i-1] {
-			// Find a different character
-			for attempts := 0; attempts < 10; attempts++ {
-				newChar, err := randomChar(charSet)
-				if err == nil && newChar != password[i-1] {
-					password[i] = newChar
-					break
+		if password[i] != password[i-1] {
+			continue
+		}
+		// The replacement differs from both neighbours when the set allows
+		// it; otherwise from the one before, and the next is replaced in turn
+		var candidates, fallback []byte
+		for j := 0; j < len(charSet); j++ {
+			if c := charSet[j]; c != password[i-1] {
+				fallback = append(fallback, c)
+				if i+1 == len(password) || c != password[i+1] {
+					candidates = append(candidates, c)
 				}
 			}
 		}
+		if len(candidates) == 0 {
+			candidates = fallback
+		}
+		newChar, err := randomChar(string(candidates))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate random character: %w", err)
+		}
+		password[i] = newChar
 	}
-	
-	return password
+
+	return password, nil
 }
 
 // randomChar selects a random character from the given character set
@@ -247,95 +444,184 @@ func shuffleInts(ints []int) {
 	}
 }
 
-// AnalyzePasswordStrength analyzes the strength of a password
-func AnalyzePasswordStrength(password string) map[string]interface{} {
-	analysis := map[string]interface{}{
-		"length":        len(password),
-		"has_uppercase": false,
-		"has_lowercase": false,
-		"has_numbers":   false,
-		"has_symbols":   false,
-		"unique_chars":  0,
-		"strength_score": 0,
-		"strength_level": "",
+// MissingClasses returns the names of the character sets selected in
+// config that password has no character from. With RequireEachClass off
+// this is expected now and then and is not an error.
+func MissingClasses(password string, config *PasswordConfig) []string {
+	var missing []string
+	for _, class := range []struct {
+		name     string
+		selected bool
+		chars    string
+	}{
+		{"uppercase", config.Uppercase, Uppercase},
+		{"lowercase", config.Lowercase, Lowercase},
+		{"numbers", config.Numbers, Numbers},
+		{"symbols", config.Symbols, symbolChars(config)},
+	} {
+		if class.selected && !strings.ContainsAny(password, class.chars) {
+			missing = append(missing, class.name)
+		}
 	}
-	
-	if len(password) == 0 {
-		analysis["strength_level"] = "Empty"
+	return missing
+}
+
+// PasswordAnalysis is the result of Analyze
+type PasswordAnalysis struct {
+	// Length is the number of characters, not bytes
+	Length      int  `json:"length"`
+	UniqueChars int  `json:"unique_chars"`
+	HasUpper    bool `json:"has_uppercase"`
+	HasLower    bool `json:"has_lowercase"`
+	HasDigits   bool `json:"has_numbers"`
+	HasSymbols  bool `json:"has_symbols"`
+	// Score runs from 0 to MaxScore and Level names it, from "Very Weak" to
+	// "Excellent", or is "Empty" for an empty password
+	Score int    `json:"strength_score"`
+	Level string `json:"strength_level"`
+	// EntropyBits estimates the entropy to a tenth of a bit. Characters
+	// count by the size of the character classes the password uses;
+	// dictionary words, repeated characters, sequences and keyboard walks
+	// count only as much as it takes to guess them. A passphrase counts
+	// by its number of words drawn from the wordlist.
+	EntropyBits float64 `json:"entropy_bits"`
+	// EstimatedCrackTime is how long an offline attack at
+	// GuessesPerSecond takes on average to guess the password, such as
+	// "3 hours" or "centuries"
+	EstimatedCrackTime string `json:"estimated_crack_time"`
+	// Words is the number of words of a passphrase, or 0 for a password
+	// that is not one
+	Words int `json:"words,omitempty"`
+}
+
+// Classes returns how many of the four character classes the password
+// uses
+func (a PasswordAnalysis) Classes() int {
+	n := 0
+	for _, has := range []bool{a.HasUpper, a.HasLower, a.HasDigits, a.HasSymbols} {
+		if has {
+			n++
+		}
+	}
+	return n
+}
+
+// MaxScore is the highest strength score: three for length, four for the
+// character classes and one for unique characters
+const MaxScore = 8
+
+// Analyze analyzes the strength of a password
+func Analyze(password string) PasswordAnalysis {
+	analysis := PasswordAnalysis{Length: utf8.RuneCountInString(password)}
+	if password == "" {
+		analysis.Level = "Empty"
+		analysis.EstimatedCrackTime = crackTime(0)
 		return analysis
 	}
-	
+
+	// A passphrase is only as strong as its choice of words
+	words, wordBits := passphraseEntropy(password)
+
+	// The separators of a chunked password add no strength of their own,
+	// so it is scored on its groups
+	_, password = chunkSeparator(password)
+	length := utf8.RuneCountInString(password)
+
 	// Check character types
 	uniqueChars := make(map[rune]bool)
 	for _, char := range password {
 		uniqueChars[char] = true
-		
+
 		if char >= 'A' && char <= 'Z' {
-			analysis["has_uppercase"] = true
+			analysis.HasUpper = true
 		} else if char >= 'a' && char <= 'z' {
-			analysis["has_lowercase"] = true
+			analysis.HasLower = true
 		} else if char >= '0' && char <= '9' {
-			analysis["has_numbers"] = true
+			analysis.HasDigits = true
 		} else {
-			analysis["has_symbols"] = true
+			analysis.HasSymbols = true
 		}
 	}
-	
-	analysis["unique_chars"] = len(uniqueChars)
-	
+	analysis.UniqueChars = len(uniqueChars)
+
 	// Calculate strength score
 	score := 0
-	
+
 	// Length contribution
-	if len(password) >= 8 {
-		score += 1
-	}
-	if len(password) >= 12 {
-		score += 1
-	}
-	if len(password) >= 16 {
-		score += 1
+	for _, threshold := range []int{8, 12, 16} {
+		if length >= threshold {
+			score++
+		}
 	}
-	
+
 	// Character variety contribution
-	if analysis["has_uppercase"].(bool) {
-		score += 1
-	}
-	if analysis["has_lowercase"].(bool) {
-		score += 1
-	}
-	if analysis["has_numbers"].(bool) {
-		score += 1
-	}
-	if analysis["has_symbols"].(bool) {
-		score += 1
-	}
-	
+	score += analysis.Classes()
+
 	// Uniqueness contribution
-	uniqueRatio := float64(analysis["unique_chars"].(int)) / float64(len(password))
-	if uniqueRatio >= 0.8 {
-		score += 1
+	if float64(analysis.UniqueChars)/float64(length) >= 0.8 {
+		score++
 	}
-	
-	analysis["strength_score"] = score
-	
+	analysis.Score = score
+
 	// Determine strength level
 	switch score {
 	case 0, 1:
-		analysis["strength_level"] = "Very Weak"
+		analysis.Level = "Very Weak"
 	case 2:
-		analysis["strength_level"] = "Weak"
+		analysis.Level = "Weak"
 	case 3:
-		analysis["strength_level"] = "Fair"
+		analysis.Level = "Fair"
 	case 4:
-		analysis["strength_level"] = "Good"
+		analysis.Level = "Good"
 	case 5:
-		analysis["strength_level"] = "Strong"
+		analysis.Level = "Strong"
 	case 6, 7:
-		analysis["strength_level"] = "Very Strong"
+		analysis.Level = "Very Strong"
 	default:
-		analysis["strength_level"] = "Excellent"
+		analysis.Level = "Excellent"
 	}
-	
+
+	pool := 0
+	for _, class := range []struct {
+		has   bool
+		chars string
+	}{
+		{analysis.HasUpper, Uppercase},
+		{analysis.HasLower, Lowercase},
+		{analysis.HasDigits, Numbers},
+		{analysis.HasSymbols, Symbols},
+	} {
+		if class.has {
+			pool += len(class.chars)
+		}
+	}
+	bits := estimateEntropy(password, pool)
+	if words > 0 {
+		analysis.Words, bits = words, wordBits
+	}
+	analysis.EntropyBits = math.Round(bits*10) / 10
+	analysis.EstimatedCrackTime = crackTime(analysis.EntropyBits)
+
 	return analysis
 }
+
+// AnalyzePasswordStrength analyzes the strength of a password. It returns
+// the fields of Analyze under the keys of their JSON names and is kept for
+// callers written before Analyze.
+func AnalyzePasswordStrength(password string) map[string]interface{} {
+	analysis := Analyze(password)
+	return map[string]interface{}{
+		"length":         analysis.Length,
+		"has_uppercase":  analysis.HasUpper,
+		"has_lowercase":  analysis.HasLower,
+		"has_numbers":    analysis.HasDigits,
+		"has_symbols":    analysis.HasSymbols,
+		"unique_chars":   analysis.UniqueChars,
+		"strength_score": analysis.Score,
+		"strength_level": analysis.Level,
+		"entropy_bits":   analysis.EntropyBits,
+		"words":          analysis.Words,
+
+		"estimated_crack_time": analysis.EstimatedCrackTime,
+	}
+}
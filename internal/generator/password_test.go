@@ -1,8 +1,10 @@
 package generator
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"unicode"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -272,6 +274,78 @@ func TestValidateConfig(t *testing.T) {
 	}
 }
 
+func TestValidateConfigExcludedClass(t *testing.T) {
+	config := &PasswordConfig{Length: 12, Lowercase: true, Numbers: true, Exclude: Numbers, RequireEachClass: true}
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected a required class with every character excluded to be refused")
+	}
+	config.RequireEachClass = false
+	if err := validateConfig(config); err != nil {
+		t.Errorf("Expected the class to be allowed without RequireEachClass: %v", err)
+	}
+}
+
+func TestGenerateInvalidConfig(t *testing.T) {
+	short := DefaultConfig()
+	short.Length = 4
+	excluded := DefaultConfig()
+	excluded.Exclude = Numbers
+	chunked := DefaultConfig()
+	chunked.ChunkSize = 4
+	chunked.ChunkSeparator = "x"
+	for name, config := range map[string]*PasswordConfig{"short": short, "excluded": excluded, "chunked": chunked} {
+		if _, err := GeneratePassword(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+
+	if _, err := GeneratePassphrase(&PassphraseConfig{Words: 1, Separator: "-"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a one-word passphrase, got %v", err)
+	}
+}
+
+func TestGeneratePasswordShortLengths(t *testing.T) {
+	// Lengths below the size of the combined set used to be refused
+	for length := 8; length <= 32; length++ {
+		config := DefaultConfig()
+		config.Length = length
+		password, err := GeneratePassword(config)
+		if err != nil {
+			t.Fatalf("GeneratePassword(length %d) failed: %v", length, err)
+		}
+		if len(password) != length {
+			t.Errorf("Expected %d characters, got %q", length, password)
+		}
+		if missing := MissingClasses(password, config); len(missing) > 0 {
+			t.Errorf("Length %d: %q lacks %v", length, password, missing)
+		}
+	}
+}
+
+func TestEnsureCharacterSetsEveryLength(t *testing.T) {
+	// Every allowed length gets one character of each class, from those
+	// the exclusions leave
+	for length := 8; length <= 128; length++ {
+		config := DefaultConfig()
+		config.Length = length
+		config.NoRepeating = false
+		config.Exclude = Uppercase[:25] + Numbers[:9]
+		password := ensureCharacterSets(make([]byte, length), config)
+		placed := strings.Map(func(r rune) rune {
+			if r == 0 {
+				return -1
+			}
+			return r
+		}, string(password))
+		if len(placed) != 4 || len(MissingClasses(placed, config)) > 0 {
+			t.Errorf("Length %d: expected one character of each class, got %q", length, placed)
+		}
+		if strings.ContainsAny(placed, config.Exclude) {
+			t.Errorf("Length %d: excluded characters placed in %q", length, placed)
+		}
+	}
+}
+
 func TestBuildCharSet(t *testing.T) {
 	config := &PasswordConfig{
 		Uppercase: true,
@@ -415,3 +489,407 @@ func TestShuffleInts(t *testing.T) {
 		}
 	}
 }
+
+func TestUniformWithoutClassGuarantee(t *testing.T) {
+	config := &PasswordConfig{
+		Length:    100,
+		Uppercase: true,
+		Lowercase: true,
+		Numbers:   true,
+		Symbols:   true,
+	}
+	charSet := buildCharSet(config)
+
+	const runs = 500
+	counts := map[string]int{}
+	for i := 0; i < runs; i++ {
+		password, err := GeneratePassword(config)
+		if err != nil {
+			t.Fatalf("GeneratePassword failed: %v", err)
+		}
+		for _, char := range password {
+			switch {
+			case strings.ContainsRune(Uppercase, char):
+				counts["upper"]++
+			case strings.ContainsRune(Lowercase, char):
+				counts["lower"]++
+			case strings.ContainsRune(Numbers, char):
+				counts["numbers"]++
+			default:
+				counts["symbols"]++
+			}
+		}
+	}
+
+	// Each class should turn up in proportion to its size; 0.02 is more
+	// than five standard deviations at this sample size
+	total := float64(runs * config.Length)
+	for class, size := range map[string]int{"upper": len(Uppercase), "lower": len(Lowercase), "numbers": len(Numbers), "symbols": len(Symbols)} {
+		want := float64(size) / float64(len(charSet))
+		got := float64(counts[class]) / total
+		if got < want-0.02 || got > want+0.02 {
+			t.Errorf("%s frequency %.3f, want about %.3f", class, got, want)
+		}
+	}
+	config.RequireEachClass = true
+	for i := 0; i < 200; i++ {
+		password, _ := GeneratePassword(config)
+		if missing := MissingClasses(password, config); len(missing) > 0 {
+			t.Fatalf("Password %q lacks %v despite the guarantee", password, missing)
+		}
+	}
+}
+
+func TestMissingClasses(t *testing.T) {
+	config := &PasswordConfig{Uppercase: true, Lowercase: true, Numbers: true}
+	missing := MissingClasses("abcDEF", config)
+	if len(missing) != 1 || missing[0] != "numbers" {
+		t.Errorf("Expected [numbers], got %v", missing)
+	}
+	if missing := MissingClasses("!!!", &PasswordConfig{Symbols: true}); len(missing) != 0 {
+		t.Errorf("Expected nothing missing, got %v", missing)
+	}
+}
+
+func TestGeneratePasswordChunks(t *testing.T) {
+	// Separators are not counted by default: 12 characters in 3 groups
+	config := &PasswordConfig{Length: 12, Numbers: true, ChunkSize: 4}
+	password, err := GeneratePassword(config)
+	if err != nil {
+		t.Fatalf("GeneratePassword failed: %v", err)
+	}
+	groups := strings.Split(password, "-")
+	if len(password) != 14 || len(groups) != 3 || len(strings.Join(groups, "")) != 12 {
+		t.Errorf("Expected 12 digits in groups of 4, got %q", password)
+	}
+
+	// Counted, the separators fit into the length: 13 characters leave
+	// room for 11 digits, "xxxx xxxx xxx"
+	config = &PasswordConfig{Length: 13, Numbers: true, ChunkSize: 4, ChunkSeparator: " ", SeparatorCounts: true}
+	if password, err = GeneratePassword(config); err != nil {
+		t.Fatalf("GeneratePassword failed: %v", err)
+	}
+	groups = strings.Split(password, " ")
+	if len(password) != 13 || len(groups) != 3 || len(groups[2]) != 3 {
+		t.Errorf("Expected 13 characters with the separators, got %q", password)
+	}
+	// Where a separator would end the password it is one character short
+	config.Length = 15
+	if password, err = GeneratePassword(config); err != nil || len(password) != 14 {
+		t.Errorf("Expected 14 characters, got %q, %v", password, err)
+	}
+	config.Length = 8
+	if _, err := GeneratePassword(config); err == nil {
+		t.Error("Expected too few characters once separators count to fail")
+	}
+
+	for _, bad := range []*PasswordConfig{
+		{Length: 12, Numbers: true, ChunkSize: 4, Exclude: "-"},
+		{Length: 12, Numbers: true, ChunkSize: 4, ChunkSeparator: "x"},
+		{Length: 12, Numbers: true, ChunkSize: -1},
+	} {
+		if password, err := GeneratePassword(bad); err == nil {
+			t.Errorf("Expected %+v to be rejected, got %q", bad, password)
+		}
+	}
+	config = &PasswordConfig{Length: 12, Numbers: true, ChunkSize: 4, ChunkSeparator: ".", Exclude: "-"}
+	if password, err := GeneratePassword(config); err != nil || strings.Count(password, ".") != 2 {
+		t.Errorf("Expected a permitted separator to work, got %q, %v", password, err)
+	}
+}
+
+func TestGeneratePasswordChunksDefaultClasses(t *testing.T) {
+	// The default classes include "-", which must not turn up inside a
+	// group where it would be taken for a separator
+	for _, separator := range []string{"", "-", " ", "_."} {
+		config := DefaultConfig()
+		config.ChunkSize, config.ChunkSeparator = 4, separator
+		want := separator
+		if want == "" {
+			want = DefaultChunkSeparator
+		}
+		for i := 0; i < 200; i++ {
+			password, err := GeneratePassword(config)
+			if err != nil {
+				t.Fatalf("GeneratePassword(%+v) failed: %v", config, err)
+			}
+			groups := strings.Split(password, want)
+			for j, group := range groups {
+				if len(group) != 4 && j < len(groups)-1 || strings.ContainsAny(group, want) {
+					t.Fatalf("Password %q has a group %q holding the separator %q", password, group, want)
+				}
+			}
+			found, stripped := chunkSeparator(password)
+			if found != want || len(stripped) != config.Length {
+				t.Fatalf("chunkSeparator(%q) = %q, %q; want the separator %q", password, found, stripped, want)
+			}
+		}
+	}
+}
+
+func TestChunkSeparator(t *testing.T) {
+	tests := []struct {
+		password, separator, rest string
+	}{
+		{"Xk3f-9qLm-Tt2v", "-", "Xk3f9qLmTt2v"},
+		{"X!3f-9q#m-T", "-", "X!3f9q#mT"},
+		{"!k3f_.9qLm_.Tt2v", "_.", "!k3f9qLmTt2v"},
+		{"Xk3-9qLm-Tt2v", "", "Xk3-9qLm-Tt2v"},
+		{"Xk3f-9qLm", "", "Xk3f-9qLm"},
+		{"Xk3f--9qLm-Tt2v", "", "Xk3f--9qLm-Tt2v"},
+	}
+	for _, tt := range tests {
+		if separator, rest := chunkSeparator(tt.password); separator != tt.separator || rest != tt.rest {
+			t.Errorf("chunkSeparator(%q) = %q, %q; want %q, %q", tt.password, separator, rest, tt.separator, tt.rest)
+		}
+	}
+}
+
+func TestAnalyzeChunkedPassword(t *testing.T) {
+	chunked := AnalyzePasswordStrength("Xk3f-9qLm-Tt2v-Pz8w")
+	if chunked["has_symbols"].(bool) {
+		t.Error("Separators alone should not count as symbols")
+	}
+	if chunked["length"] != 19 {
+		t.Errorf("Expected the full length to be reported, got %v", chunked["length"])
+	}
+	if plain := AnalyzePasswordStrength("Xk3f9qLmTt2vPz8w"); plain["strength_score"] != chunked["strength_score"] {
+		t.Errorf("Chunking changed the score: %v vs %v", chunked["strength_score"], plain["strength_score"])
+	}
+
+	// Symbols inside the groups, or uneven groups, still count
+	for _, password := range []string{"Xk3f-9q!m-Tt2v", "Xk3-9qLm-Tt2v", "Xk3f-9qLm", "Xk3f--9qLm-Tt2v"} {
+		if !AnalyzePasswordStrength(password)["has_symbols"].(bool) {
+			t.Errorf("Expected %q to have symbols", password)
+		}
+	}
+}
+
+func TestAnalyzeCountsRunes(t *testing.T) {
+	analysis := Analyze("pässwörd€")
+	if analysis.Length != 9 {
+		t.Errorf("Expected a length of 9 characters, got %d", analysis.Length)
+	}
+	if analysis.UniqueChars != 8 || !analysis.HasLower || !analysis.HasSymbols {
+		t.Errorf("Unexpected analysis %+v", analysis)
+	}
+	// Seven accented letters and a digit score as 8 characters, not 15 bytes
+	if short := Analyze("ééééééé1"); short.Score != Analyze("eeeeeee1").Score {
+		t.Errorf("Expected accents not to add length, got %d vs %d", short.Score, Analyze("eeeeeee1").Score)
+	}
+
+	legacy := AnalyzePasswordStrength("pässwörd€")
+	if legacy["length"] != analysis.Length || legacy["strength_level"] != analysis.Level || legacy["strength_score"] != analysis.Score {
+		t.Errorf("Expected the map to carry the fields of Analyze, got %v", legacy)
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	words, set := wordlist()
+	if len(words) != 7776 || len(set) != 7776 {
+		t.Fatalf("Expected 7776 distinct words, got %d (%d distinct)", len(words), len(set))
+	}
+
+	passphrase, err := GeneratePassphrase(&PassphraseConfig{Words: 6, Separator: "-"})
+	if err != nil {
+		t.Fatalf("GeneratePassphrase failed: %v", err)
+	}
+	analysis := Analyze(passphrase)
+	if analysis.Words != 6 {
+		t.Errorf("Expected %q to be analyzed as 6 words, got %d", passphrase, analysis.Words)
+	}
+	if analysis.EntropyBits < 77 || analysis.EntropyBits > 78 {
+		t.Errorf("Expected about 77.5 bits for 6 words, got %.1f", analysis.EntropyBits)
+	}
+
+	config := &PassphraseConfig{Words: 5, Separator: " ", Capitalize: CapitalizeFirst, Digit: true}
+	passphrase, err = GeneratePassphrase(config)
+	if err != nil {
+		t.Fatalf("GeneratePassphrase failed: %v", err)
+	}
+	parts := strings.Split(passphrase, " ")
+	if len(parts) != 5 || strings.IndexFunc(passphrase, unicode.IsDigit) < 0 {
+		t.Errorf("Expected 5 words and a digit, got %q", passphrase)
+	}
+	for _, part := range parts {
+		if !unicode.IsUpper(rune(part[0])) {
+			t.Errorf("Expected %q to be capitalized", part)
+		}
+	}
+	if words := Analyze(passphrase).Words; words != 5 {
+		t.Errorf("Expected %q to be analyzed as 5 words, got %d", passphrase, words)
+	}
+
+	for _, config := range []*PassphraseConfig{
+		{Words: 3, Separator: "-"},
+		{Words: 11, Separator: "-"},
+		{Words: 6, Separator: "x"},
+		{Words: 6, Capitalize: "upper"},
+	} {
+		if _, err := GeneratePassphrase(config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
+
+func TestAnalyzePassphrase(t *testing.T) {
+	tests := []struct {
+		password string
+		words    int
+	}{
+		{"correct-horse-battery-staple", 0}, // "horse" is not on the list
+		{"abacus-zoom-yo-yo-copper", 4},
+		{"Abacus zoom Copper3 mango", 4},
+		{"abacus.zoom", 0},
+		{"abacus-zoom-xyzzy", 0},
+		{"abacus12-zoom-copper", 0},
+	}
+	for _, tt := range tests {
+		if got := Analyze(tt.password).Words; got != tt.words {
+			t.Errorf("Analyze(%q).Words = %d, want %d", tt.password, got, tt.words)
+		}
+	}
+	if bits := Analyze("abacus-zoom-copper-mango").EntropyBits; bits != 51.7 {
+		t.Errorf("Expected 51.7 bits for 4 words, got %.1f", bits)
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		maxBits  float64
+		pattern  string
+	}{
+		{"password", 10, "common word"},
+		{"P@ssw0rd", 10, "common word with substitutions"},
+		{"Password1!", 25, "capitalized word and suffix"},
+		{"letmein", 10, "common word"},
+		{"123456", 10, "ascending digits"},
+		{"654321", 10, "descending digits"},
+		{"abcdefgh", 10, "ascending letters"},
+		{"qwerty", 10, "keyboard walk"},
+		{"asdfghjkl", 12, "keyboard walk"},
+		{"zxcvbnm", 12, "keyboard walk"},
+		{"aaaaaaaa", 10, "repeated character"},
+		{"monkey123", 15, "word and sequence"},
+	}
+	for _, tt := range tests {
+		analysis := Analyze(tt.password)
+		if analysis.EntropyBits > tt.maxBits {
+			t.Errorf("%q (%s): expected at most %.0f bits, got %.1f", tt.password, tt.pattern, tt.maxBits, analysis.EntropyBits)
+		}
+		if analysis.EstimatedCrackTime != "less than a second" {
+			t.Errorf("%q: expected to be cracked in less than a second, got %s", tt.password, analysis.EstimatedCrackTime)
+		}
+	}
+
+	// Random characters keep the entropy of their pool
+	random := Analyze("V9#kq!Lz2@xW7$mR")
+	if random.EntropyBits < 100 || random.EstimatedCrackTime != "centuries" {
+		t.Errorf("Expected a random password to keep its entropy, got %.1f bits, %s", random.EntropyBits, random.EstimatedCrackTime)
+	}
+	// The same score no longer hides the difference
+	if weak := Analyze("Password1!"); weak.Score < random.Score-2 || weak.EntropyBits > random.EntropyBits/4 {
+		t.Errorf("Expected Password1! to score alike but have far less entropy, got %d and %.1f bits", weak.Score, weak.EntropyBits)
+	}
+}
+
+func TestCrackTime(t *testing.T) {
+	tests := []struct {
+		bits float64
+		want string
+	}{
+		{0, "less than a second"},
+		{30, "less than a second"},
+		{40, "54 seconds"},
+		{50, "15 hours"},
+		{60, "1 year"},
+		{70, "centuries"},
+	}
+	for _, tt := range tests {
+		if got := crackTime(tt.bits); got != tt.want {
+			t.Errorf("crackTime(%v) = %q, want %q", tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratePasswordMobileFriendly(t *testing.T) {
+	allowed := Uppercase + Lowercase + Numbers + MobileSymbols
+	configs := []*PasswordConfig{
+		{Length: 100, Uppercase: true, Lowercase: true, Numbers: true, Symbols: true, NoRepeating: true, RequireEachClass: true, MobileFriendly: true},
+		{Length: 24, Symbols: true, NoRepeating: true, RequireEachClass: true, MobileFriendly: true},
+		// Combined with exclusions, as site rules forbidding some add them
+		{Length: 100, Uppercase: true, Lowercase: true, Numbers: true, Symbols: true, Exclude: "@/", MobileFriendly: true},
+		{Length: 100, Uppercase: true, Lowercase: true, Numbers: true, Symbols: true, ChunkSize: 5, MobileFriendly: true},
+	}
+	for _, config := range configs {
+		seen := map[rune]bool{}
+		for i := 0; i < 300; i++ {
+			password, err := GeneratePassword(config)
+			if err != nil {
+				t.Fatalf("GeneratePassword(%+v) failed: %v", config, err)
+			}
+			_, password = chunkSeparator(password)
+			for _, char := range password {
+				if !strings.ContainsRune(allowed, char) || strings.ContainsRune(config.Exclude, char) {
+					t.Fatalf("Password %q has %q, outside the allowed set", password, char)
+				}
+				seen[char] = true
+			}
+			if missing := MissingClasses(password, config); config.RequireEachClass && len(missing) > 0 {
+				t.Fatalf("Password %q lacks %v", password, missing)
+			}
+		}
+		// Letters and digits are left alone
+		if config.Lowercase && !seen['z'] || config.Numbers && !seen['9'] {
+			t.Errorf("Expected letters and digits to be drawn as usual with %+v", config)
+		}
+	}
+}
+
+func TestAnalyzeMobileSymbols(t *testing.T) {
+	// The symbols only MobileSymbols has count as symbols all the same
+	for _, password := range []string{`Quiet'River9`, `Quiet"River9`, "Quiet/River9"} {
+		if analysis := Analyze(password); !analysis.HasSymbols || analysis.Classes() != 4 {
+			t.Errorf("Expected %q to use all four classes, got %+v", password, analysis)
+		}
+	}
+}
+
+func TestGeneratePasswordNoRepeatingCharSet(t *testing.T) {
+	// Repeats are replaced from the configured set, exclusions and all
+	configs := []*PasswordConfig{
+		{Length: 16, Numbers: true, NoRepeating: true, RequireEachClass: true},
+		{Length: 64, Uppercase: true, Lowercase: true, Numbers: true, Symbols: true, Exclude: "0O1lI", NoRepeating: true, RequireEachClass: true},
+		{Length: 32, Numbers: true, Exclude: "23456789", NoRepeating: true},
+	}
+	for _, config := range configs {
+		charSet := buildCharSet(config)
+		for i := 0; i < 200; i++ {
+			password, err := GeneratePassword(config)
+			if err != nil {
+				t.Fatalf("GeneratePassword(%+v) failed: %v", config, err)
+			}
+			for j, char := range password {
+				if !strings.ContainsRune(charSet, char) || strings.ContainsRune(config.Exclude, char) {
+					t.Fatalf("Password %q has %q, outside the configured set", password, char)
+				}
+				if j > 0 && password[j] == password[j-1] {
+					t.Fatalf("Password %q repeats %q", password, char)
+				}
+			}
+		}
+	}
+}
+
+func TestApplyNoRepeatingRuleSingleChar(t *testing.T) {
+	for _, charSet := range []string{"7", "77", ""} {
+		if _, err := applyNoRepeatingRule([]byte("7777"), charSet); err == nil {
+			t.Errorf("Expected a character set of %q to be refused", charSet)
+		}
+	}
+	config := &PasswordConfig{Length: 12, Numbers: true, Exclude: "012345678", NoRepeating: true}
+	if _, err := GeneratePassword(config); err == nil {
+		t.Error("Expected no repeating with a single digit left to be refused")
+	}
+}
@@ -0,0 +1,99 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Events a hook can run after
+const (
+	Save   = "save"
+	Delete = "delete"
+	Rotate = "rotate"
+	Import = "import"
+)
+
+// DefaultTimeout is how long a hook may run before it is killed
+const DefaultTimeout = 10 * time.Second
+
+// Event describes a change to the vault. It holds names only, never
+// secrets, as it is passed to user scripts in the environment.
+type Event struct {
+	Name string
+	// Entry is the entry changed, empty for events on many entries
+	Entry     string
+	VaultPath string
+}
+
+// Environ returns the environment variables describing e
+func (e Event) Environ() []string {
+	return []string{
+		"PM_EVENT=" + e.Name,
+		"PM_ENTRY_NAME=" + e.Entry,
+		"PM_VAULT_PATH=" + e.VaultPath,
+	}
+}
+
+// Runner runs hook commands
+type Runner struct {
+	Timeout time.Duration
+	// Output receives what hooks print; nil discards it
+	Output io.Writer
+}
+
+// Run runs command through the shell with the event in its environment,
+// and waits for it up to the timeout. A leading ~/ is expanded. The error
+// carries the exit code of a failed hook.
+func (r *Runner) Run(command string, event Event) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, expandHome(command))
+	cmd.Env = append(os.Environ(), event.Environ()...)
+	cmd.Stdout, cmd.Stderr = r.Output, r.Output
+	// Children the hook leaves behind must not keep Run waiting on their
+	// output once the hook itself is killed
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s", timeout)
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("exited with code %d", exitErr.ExitCode())
+	}
+	return err
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(command string) string {
+	if !strings.HasPrefix(command, "~/") {
+		return command
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return command
+	}
+	return home + command[1:]
+}
@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeHook writes a shell script hook into a temporary directory
+func writeHook(t *testing.T, body string) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts are shell scripts")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path, dir
+}
+
+func TestRunPassesEvent(t *testing.T) {
+	hook, dir := writeHook(t, `echo "$PM_EVENT|$PM_ENTRY_NAME|$PM_VAULT_PATH" > "$(dirname "$0")/marker"`)
+
+	r := &Runner{}
+	if err := r.Run(hook, Event{Name: Save, Entry: "my bank", VaultPath: "/vault.db"}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	marker, err := os.ReadFile(filepath.Join(dir, "marker"))
+	if err != nil {
+		t.Fatalf("Expected the hook to write its marker: %v", err)
+	}
+	if got := strings.TrimSpace(string(marker)); got != "save|my bank|/vault.db" {
+		t.Errorf("Hook saw %q", got)
+	}
+}
+
+func TestRunReportsExitCode(t *testing.T) {
+	hook, _ := writeHook(t, "exit 3\n")
+
+	err := (&Runner{}).Run(hook, Event{Name: Delete})
+	if err == nil || !strings.Contains(err.Error(), "code 3") {
+		t.Errorf("Expected the exit code to be reported, got %v", err)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	hook, _ := writeHook(t, "sleep 30\n")
+
+	start := time.Now()
+	err := (&Runner{Timeout: 200 * time.Millisecond}).Run(hook, Event{Name: Rotate})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %v; the hook was not stopped", elapsed)
+	}
+}
@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// Formats accepted by Parse
+const (
+	FormatBitwarden  = "bitwarden"
+	FormatLastPass   = "lastpass"
+	FormatChrome     = "chrome"
+	FormatKeePassXML = "keepass-xml"
+)
+
+// Formats lists the formats accepted by Parse
+var Formats = []string{FormatBitwarden, FormatLastPass, FormatChrome, FormatKeePassXML}
+
+// Options adjust what Parse reads
+type Options struct {
+	// IncludeTrash imports the entries in the recycle bin of a KeePass
+	// export too
+	IncludeTrash bool
+}
+
+// lastPassNoteURL is the URL LastPass gives secure notes in its exports
+const lastPassNoteURL = "http://sn"
+
+// Row is an entry read from an export, with the line of the file it
+// starts on
+type Row struct {
+	Entry *storage.PasswordEntry
+	Line  int
+}
+
+// Parse reads an export in format, one of Formats
+func Parse(format string, r io.Reader, opts Options) ([]*storage.PasswordEntry, error) {
+	return entriesOf(ParseRows(format, r, opts))
+}
+
+// ParseRows reads an export in format like Parse, keeping the line each
+// entry came from
+func ParseRows(format string, r io.Reader, opts Options) ([]Row, error) {
+	switch format {
+	case FormatBitwarden:
+		return parseBitwardenCSV(r)
+	case FormatLastPass:
+		return parseLastPassCSV(r)
+	case FormatChrome:
+		return parseChromeCSV(r)
+	case FormatKeePassXML:
+		return parseKeePassXML(r, opts)
+	}
+	return nil, fmt.Errorf("unsupported import format %q (supported: %s)", format, strings.Join(Formats, ", "))
+}
+
+// entriesOf drops the lines of rows
+func entriesOf(rows []Row, err error) ([]*storage.PasswordEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*storage.PasswordEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = row.Entry
+	}
+	return entries, nil
+}
+
+// ParseBitwardenCSV reads a Bitwarden CSV export, with the columns
+// folder,favorite,type,name,notes,fields,reprompt,login_uri,
+// login_username,login_password,login_totp. Secure notes become notes,
+// the folder becomes a tag and custom fields are added to the notes.
+// TOTP secrets are not imported.
+func ParseBitwardenCSV(r io.Reader) ([]*storage.PasswordEntry, error) {
+	return entriesOf(parseBitwardenCSV(r))
+}
+
+func parseBitwardenCSV(r io.Reader) ([]Row, error) {
+	rows, err := readCSV(r, "Bitwarden", "name", "login_uri", "login_username", "login_password")
+	if err != nil {
+		return nil, err
+	}
+	var entries []Row
+	for _, row := range rows {
+		entry := &storage.PasswordEntry{
+			Name:     row.get("name"),
+			Username: row.get("login_username"),
+			Password: row.get("login_password"),
+			URL:      firstURI(row.get("login_uri")),
+			Notes:    joinNotes(row.get("notes"), row.get("fields")),
+			Tags:     folderTags(row.get("folder")),
+		}
+		if row.get("type") == "note" {
+			entry.Type = storage.EntryTypeNote
+		}
+		entries = append(entries, Row{Entry: named(entry), Line: row.line})
+	}
+	return entries, nil
+}
+
+// ParseLastPassCSV reads a LastPass CSV export, with the columns url,
+// username,password,totp,extra,name,grouping,fav. Secure notes, which
+// LastPass gives the URL http://sn, become notes and the group a tag.
+// TOTP secrets are not imported.
+func ParseLastPassCSV(r io.Reader) ([]*storage.PasswordEntry, error) {
+	return entriesOf(parseLastPassCSV(r))
+}
+
+func parseLastPassCSV(r io.Reader) ([]Row, error) {
+	rows, err := readCSV(r, "LastPass", "url", "username", "password", "extra", "name")
+	if err != nil {
+		return nil, err
+	}
+	var entries []Row
+	for _, row := range rows {
+		entry := &storage.PasswordEntry{
+			Name:     row.get("name"),
+			Username: row.get("username"),
+			Password: row.get("password"),
+			URL:      row.get("url"),
+			Notes:    row.get("extra"),
+			Tags:     folderTags(strings.ReplaceAll(row.get("grouping"), `\`, "/")),
+		}
+		if entry.URL == lastPassNoteURL {
+			entry.URL = ""
+			entry.Type = storage.EntryTypeNote
+		}
+		entries = append(entries, Row{Entry: named(entry), Line: row.line})
+	}
+	return entries, nil
+}
+
+// ParseChromeCSV reads the password export of Chrome and other Chromium
+// browsers, with the columns name,url,username,password and, in newer
+// versions, note. The CSV export of this app has the same layout with a
+// notes column, so it is read here too.
+func ParseChromeCSV(r io.Reader) ([]*storage.PasswordEntry, error) {
+	return entriesOf(parseChromeCSV(r))
+}
+
+func parseChromeCSV(r io.Reader) ([]Row, error) {
+	rows, err := readCSV(r, "Chrome", "name", "url", "username", "password")
+	if err != nil {
+		return nil, err
+	}
+	var entries []Row
+	for _, row := range rows {
+		entries = append(entries, Row{Entry: named(&storage.PasswordEntry{
+			Name:     row.get("name"),
+			Username: row.get("username"),
+			Password: row.get("password"),
+			URL:      row.get("url"),
+			Notes:    joinNotes(row.get("note"), row.get("notes")),
+		}), Line: row.line})
+	}
+	return entries, nil
+}
+
+// csvRow is a record of a CSV export with its header, and the line it
+// starts on
+type csvRow struct {
+	columns map[string]int
+	record  []string
+	line    int
+}
+
+// get returns the value of column, empty if the row does not have it
+func (r csvRow) get(column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return r.record[i]
+}
+
+// readCSV reads a CSV export whose header names at least the required
+// columns, skipping a UTF-8 byte order mark and blank rows. Quoted fields
+// may hold commas and newlines.
+func readCSV(r io.Reader, tool string, required ...string) ([]csvRow, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("not a %s export: the file is empty", tool)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s export: %w", tool, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("not a %s export: no %s column", tool, name)
+		}
+	}
+
+	var rows []csvRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s export: %w", tool, err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, csvRow{columns: columns, record: record, line: line})
+	}
+}
+
+// named trims the name of entry, or takes the host of its URL when the
+// export has none
+func named(entry *storage.PasswordEntry) *storage.PasswordEntry {
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" {
+		if u, err := url.Parse(entry.URL); err == nil {
+			entry.Name = u.Hostname()
+		}
+	}
+	return entry
+}
+
+// firstURI returns the first of the newline-separated URIs Bitwarden
+// exports for a login
+func firstURI(uris string) string {
+	first, _, _ := strings.Cut(uris, "\n")
+	return strings.TrimSpace(first)
+}
+
+// folderTags turns a folder into the tags of an entry. Tags cannot hold
+// commas, so those become spaces.
+func folderTags(folder string) []string {
+	folder = strings.TrimSpace(strings.ReplaceAll(folder, ",", " "))
+	if folder == "" {
+		return nil
+	}
+	return []string{folder}
+}
+
+// joinNotes joins the non-empty parts of the notes of an entry
+func joinNotes(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "\n\n")
+}
@@ -0,0 +1,187 @@
+package importer
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+func TestParseBitwardenCSV(t *testing.T) {
+	export := "\ufefffolder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+		"Work,1,login,GitHub,\"first line\nsecond, with a comma\",,0,https://github.com/login,alice,\"pa,ss\",\n" +
+		",,note,Safe,\"12-34-56\",,0,,,,\n"
+
+	entries, err := ParseBitwardenCSV(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseBitwardenCSV failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	github := entries[0]
+	if github.Name != "GitHub" || github.Username != "alice" || github.Password != "pa,ss" || github.URL != "https://github.com/login" {
+		t.Errorf("Unexpected login: %+v", github)
+	}
+	if github.Notes != "first line\nsecond, with a comma" {
+		t.Errorf("Expected the notes with their newline and comma, got %q", github.Notes)
+	}
+	if len(github.Tags) != 1 || github.Tags[0] != "Work" {
+		t.Errorf("Expected the folder as a tag, got %v", github.Tags)
+	}
+	if !entries[1].IsNote() || entries[1].Notes != "12-34-56" {
+		t.Errorf("Expected a secure note, got %+v", entries[1])
+	}
+}
+
+func TestParseLastPassCSV(t *testing.T) {
+	export := "url,username,password,totp,extra,name,grouping,fav\r\n" +
+		"https://mail.example.com,bob,hunter2,,\"line one\r\nline two\",Mail,Personal\\Email,0\r\n" +
+		"http://sn,,,,\"NoteType:Server\",Server,,0\r\n"
+
+	entries, err := ParseLastPassCSV(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseLastPassCSV failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if mail := entries[0]; mail.Name != "Mail" || mail.Password != "hunter2" || mail.Tags[0] != "Personal/Email" {
+		t.Errorf("Unexpected login: %+v", mail)
+	}
+	if server := entries[1]; !server.IsNote() || server.URL != "" || server.Notes != "NoteType:Server" {
+		t.Errorf("Expected a secure note, got %+v", server)
+	}
+}
+
+func TestParseChromeCSV(t *testing.T) {
+	export := "\ufeffname,url,username,password,note\n" +
+		"example.com,https://example.com/,carol,\"s3cret, really\",\"remember\nthis\"\n" +
+		",https://nameless.example.org/login,dave,pw,\n" +
+		"\n"
+
+	entries, err := ParseChromeCSV(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseChromeCSV failed: %v", err)
+	}
+	want := []*storage.PasswordEntry{
+		{Name: "example.com", URL: "https://example.com/", Username: "carol", Password: "s3cret, really", Notes: "remember\nthis"},
+		{Name: "nameless.example.org", URL: "https://nameless.example.org/login", Username: "dave", Password: "pw"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %d", len(want), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Name != want[i].Name || entry.URL != want[i].URL || entry.Username != want[i].Username ||
+			entry.Password != want[i].Password || entry.Notes != want[i].Notes {
+			t.Errorf("Entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestParseRejectsOtherExports(t *testing.T) {
+	chrome := "name,url,username,password\nexample.com,https://example.com/,carol,pw\n"
+	if _, err := ParseBitwardenCSV(strings.NewReader(chrome)); err == nil {
+		t.Error("Expected a Chrome export to be rejected as Bitwarden")
+	}
+	if _, err := ParseChromeCSV(strings.NewReader("")); err == nil {
+		t.Error("Expected an empty file to be rejected")
+	}
+	if _, err := Parse("keepass", strings.NewReader(chrome), Options{}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestParseRowsLines(t *testing.T) {
+	// The notes of the first row span two lines
+	export := "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+		",,login,GitHub,\"first\nsecond\",,0,,alice,pw,\n" +
+		"\n" +
+		",,login,Mail,,,0,,bob,pw,\n"
+	rows, err := ParseRows(FormatBitwarden, strings.NewReader(export), Options{})
+	if err != nil {
+		t.Fatalf("ParseRows failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Line != 2 || rows[1].Line != 5 {
+		t.Errorf("Expected rows on lines 2 and 5, got %+v", rows)
+	}
+
+	f, err := os.Open("testdata/keepass.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if rows, err = ParseRows(FormatKeePassXML, f, Options{}); err != nil {
+		t.Fatalf("ParseRows failed: %v", err)
+	}
+	var lines []int
+	for _, row := range rows {
+		lines = append(lines, row.Line)
+	}
+	if len(lines) != 3 || lines[0] != 13 {
+		t.Errorf("Expected the first entry on line 13, got lines %v", lines)
+	}
+}
+
+func TestParseKeePassXML(t *testing.T) {
+	f, err := os.Open("testdata/keepass.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries, err := ParseKeePassXML(f)
+	if err != nil {
+		t.Fatalf("ParseKeePassXML failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries outside the recycle bin, got %d", len(entries))
+	}
+	if router := entries[0]; router.Name != "Router" || router.Username != "admin" || router.Password != "r0uter & <friends>" || len(router.Tags) != 0 {
+		t.Errorf("Unexpected entry in the root group: %+v", router)
+	}
+	mail := entries[2]
+	if mail.Name != "Fastmail" || mail.Username != "alice@example.com" || mail.Password != "current-pass" || mail.URL != "https://www.fastmail.com" {
+		t.Errorf("Unexpected entry in a nested group: %+v", mail)
+	}
+	if mail.Notes != "Recovery codes in the safe\n\nSecurity question: Rex" {
+		t.Errorf("Expected the custom field after the notes, got %q", mail.Notes)
+	}
+	if strings.Join(mail.Tags, ",") != "group:Internet/Email,personal,mail" {
+		t.Errorf("Expected the group path and the entry's tags, got %v", mail.Tags)
+	}
+	if forum := entries[1]; forum.Name != "forum.example.org" || forum.Tags[0] != "group:Internet" {
+		t.Errorf("Expected an untitled entry named after its host, got %+v", forum)
+	}
+}
+
+func TestParseKeePassXMLIncludeTrash(t *testing.T) {
+	data, err := os.ReadFile("testdata/keepass.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := Parse(FormatKeePassXML, bytes.NewReader(data), Options{IncludeTrash: true})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 entries with the recycle bin, got %d", len(entries))
+	}
+	if deleted := entries[3]; deleted.Name != "Deleted" || deleted.Tags[0] != "group:Recycle Bin" {
+		t.Errorf("Unexpected entry from the recycle bin: %+v", deleted)
+	}
+}
+
+func TestParseKeePassXMLRejectsEncryptedValues(t *testing.T) {
+	inner := `<KeePassFile><Root><Group><Name>Root</Name><Entry>` +
+		`<String><Key>Password</Key><Value Protected="True">c2VjcmV0</Value></String>` +
+		`</Entry></Group></Root></KeePassFile>`
+	if _, err := ParseKeePassXML(strings.NewReader(inner)); err == nil {
+		t.Error("Expected values encrypted under the key of a .kdbx file to be rejected")
+	}
+	if _, err := ParseKeePassXML(strings.NewReader("")); err == nil {
+		t.Error("Expected an empty file to be rejected")
+	}
+}
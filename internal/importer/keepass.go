@@ -0,0 +1,177 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// keePassRecycleBin is the name KeePass gives the group of deleted
+// entries, used when the file does not say which group that is
+const keePassRecycleBin = "Recycle Bin"
+
+// keePassGroupTag prefixes the tag holding the group path of an entry
+const keePassGroupTag = "group:"
+
+// keePassStandardFields are the String keys mapped to entry fields. Any
+// other key is a custom field.
+var keePassStandardFields = map[string]bool{
+	"Title": true, "UserName": true, "Password": true, "URL": true, "Notes": true,
+}
+
+type keePassFile struct {
+	Meta struct {
+		RecycleBinEnabled string `xml:"RecycleBinEnabled"`
+		RecycleBinUUID    string `xml:"RecycleBinUUID"`
+	} `xml:"Meta"`
+	Root struct {
+		Groups []keePassGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type keePassGroup struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Entries []keePassEntry `xml:"Entry"`
+	Groups  []keePassGroup `xml:"Group"`
+}
+
+// keePassEntry is an entry; its History element, holding earlier
+// versions of it, is left out so those are not imported
+type keePassEntry struct {
+	// Line is where the Entry element starts
+	Line    int `xml:"-"`
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value struct {
+			Text      string `xml:",chardata"`
+			Protected string `xml:"Protected,attr"`
+		} `xml:"Value"`
+	} `xml:"String"`
+	Tags string `xml:"Tags"`
+}
+
+// ParseKeePassXML reads the XML export of KeePass 2 or KeePassXC. Title,
+// UserName, Password, URL and Notes map to the fields of an entry, custom
+// fields are added to the notes and the group path below the root group
+// becomes a tag such as group:Internet/Email, next to the tags of the
+// entry. Entries in the recycle bin are skipped; earlier versions in an
+// entry's history are never imported.
+func ParseKeePassXML(r io.Reader) ([]*storage.PasswordEntry, error) {
+	return entriesOf(parseKeePassXML(r, Options{}))
+}
+
+func parseKeePassXML(r io.Reader, opts Options) ([]Row, error) {
+	var file keePassFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("not a KeePass XML export: the file is empty")
+		}
+		return nil, fmt.Errorf("failed to read KeePass XML export: %w", err)
+	}
+	if len(file.Root.Groups) == 0 {
+		return nil, fmt.Errorf("not a KeePass XML export: no root group")
+	}
+
+	p := &keePassParser{opts: opts, binUUID: file.Meta.RecycleBinUUID}
+	if strings.EqualFold(file.Meta.RecycleBinEnabled, "false") {
+		p.binUUID = ""
+	}
+	// The root group is named after the database, so paths start below it
+	for _, root := range file.Root.Groups {
+		if err := p.group(root, ""); err != nil {
+			return nil, err
+		}
+	}
+	return p.entries, nil
+}
+
+type keePassParser struct {
+	opts    Options
+	binUUID string
+	entries []Row
+}
+
+// group collects the entries of g and its subgroups, where path is the
+// group path of g
+func (p *keePassParser) group(g keePassGroup, path string) error {
+	for _, e := range g.Entries {
+		entry, err := keePassToEntry(e, path)
+		if err != nil {
+			return err
+		}
+		p.entries = append(p.entries, Row{Entry: entry, Line: e.Line})
+	}
+	for _, sub := range g.Groups {
+		if !p.opts.IncludeTrash && p.isRecycleBin(sub) {
+			continue
+		}
+		subPath := strings.TrimSpace(sub.Name)
+		if path != "" {
+			subPath = path + "/" + subPath
+		}
+		if err := p.group(sub, subPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRecycleBin reports whether g is the recycle bin: the group named in
+// the file, or without one, the group with the name KeePass gives it
+func (p *keePassParser) isRecycleBin(g keePassGroup) bool {
+	if p.binUUID != "" {
+		return g.UUID == p.binUUID
+	}
+	return g.Name == keePassRecycleBin
+}
+
+// UnmarshalXML decodes an Entry element, noting the line it starts on
+func (e *keePassEntry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	line, _ := d.InputPos()
+	type plain keePassEntry
+	if err := d.DecodeElement((*plain)(e), &start); err != nil {
+		return err
+	}
+	e.Line = line
+	return nil
+}
+
+func keePassToEntry(e keePassEntry, path string) (*storage.PasswordEntry, error) {
+	fields := make(map[string]string)
+	var custom []string
+	for _, s := range e.Strings {
+		// The XML inside a .kdbx file keeps these values encrypted under
+		// a key of the file; an export holds them in the clear
+		if strings.EqualFold(s.Value.Protected, "true") {
+			return nil, fmt.Errorf("KeePass XML holds encrypted values; export it from KeePass as plain XML")
+		}
+		if keePassStandardFields[s.Key] {
+			fields[s.Key] = s.Value.Text
+		} else if strings.TrimSpace(s.Value.Text) != "" {
+			custom = append(custom, s.Key+": "+s.Value.Text)
+		}
+	}
+
+	var tags []string
+	if path != "" {
+		tags = folderTags(keePassGroupTag + path)
+	}
+	for _, tag := range strings.FieldsFunc(e.Tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return named(&storage.PasswordEntry{
+		Name:     fields["Title"],
+		Username: fields["UserName"],
+		Password: fields["Password"],
+		URL:      fields["URL"],
+		Notes:    joinNotes(fields["Notes"], strings.Join(custom, "\n")),
+		Tags:     tags,
+	}), nil
+}
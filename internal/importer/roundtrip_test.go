@@ -0,0 +1,237 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/passstore"
+	"password-manager/internal/storage"
+	"password-manager/internal/totp"
+)
+
+// roundTripFields are the fields compared after a round trip, as read by
+// fieldsOf
+var roundTripFields = []string{"username", "password", "url", "notes", "tags", "type", "icon", "created_at", "totp", "history"}
+
+// roundTripFormats are the formats that can be both written and read.
+// lost lists the fields a format legitimately cannot carry; losing any
+// other field fails TestRoundTrip, and so does a listed field that
+// survives, so the lists stay exact. A new export or import format joins
+// this table before it ships.
+var roundTripFormats = []struct {
+	name string
+	// trip exports the entries of db and reads them back
+	trip func(t *testing.T, db *storage.Database) []*storage.PasswordEntry
+	lost []string
+}{
+	{
+		name: "csv, read as a Chrome export",
+		trip: func(t *testing.T, db *storage.Database) []*storage.PasswordEntry {
+			var buf bytes.Buffer
+			if err := db.Export(&buf, storage.ExportCSV, true); err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			entries, err := ParseChromeCSV(&buf)
+			if err != nil {
+				t.Fatalf("ParseChromeCSV failed: %v", err)
+			}
+			return entries
+		},
+		// The browser layout has none of the rest
+		lost: []string{"tags", "type", "icon", "created_at", "totp", "history"},
+	},
+	{
+		// There is no JSON importer; the export is decoded the way one
+		// would read it
+		name: "json",
+		trip: func(t *testing.T, db *storage.Database) []*storage.PasswordEntry {
+			var buf bytes.Buffer
+			if err := db.Export(&buf, storage.ExportJSON, true); err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			var entries []*storage.PasswordEntry
+			if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+				t.Fatalf("Failed to decode the export: %v", err)
+			}
+			for _, entry := range entries {
+				entry.ID = 0
+			}
+			return entries
+		},
+		// Imports stamp entries with the time they are stored
+		lost: []string{"created_at", "totp", "history"},
+	},
+	{
+		// The files of a pass store, without the GPG layer around them
+		name: "pass",
+		trip: func(t *testing.T, db *storage.Database) []*storage.PasswordEntry {
+			stored, err := db.ListPasswords()
+			if err != nil {
+				t.Fatalf("ListPasswords failed: %v", err)
+			}
+			var entries []*storage.PasswordEntry
+			for _, entry := range stored {
+				entries = append(entries, passstore.Decode(entry.Name, passstore.Encode(entry)))
+			}
+			return entries
+		},
+		lost: []string{"type", "created_at", "totp", "history"},
+	},
+}
+
+// roundTripFixture is the canonical vault: every feature an entry can
+// have, with values that trip up text formats
+var roundTripFixture = []struct {
+	entry *storage.PasswordEntry
+	totp  *totp.Params
+	// previous is a password the entry had before, for its history
+	previous string
+}{
+	{
+		entry: &storage.PasswordEntry{
+			Name: "Café Ünïcode ☕", Username: "zoë@example.com", Password: `p,a"s s;w\ord`,
+			URL: "https://café.example.com/login?a=1&b=2", Notes: "first line\nsecond, with \"quotes\"\n\n  indented",
+			Tags: []string{"work", "übung"}, Icon: "★",
+		},
+		totp:     &totp.Params{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		previous: "older-password-1",
+	},
+	{
+		entry: &storage.PasswordEntry{
+			Name: "bank", Username: "carol", Password: "Plain-Secret-2", URL: "https://bank.example.org/",
+			Tags: []string{"finance"},
+		},
+	},
+	{
+		entry: &storage.PasswordEntry{
+			Name: "wifi code", Type: storage.EntryTypeNote, Notes: "SSID: home\nkey: 1234 5678",
+		},
+	},
+}
+
+func newRoundTripVault(t *testing.T, name string) *storage.Database {
+	t.Helper()
+	db, err := storage.CreateDatabase(filepath.Join(t.TempDir(), name), "master", storage.InitOptions{})
+	if err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fieldsOf reads back what the vault db keeps of the entry called name,
+// as text per field of roundTripFields
+func fieldsOf(t *testing.T, db *storage.Database, name string) map[string]string {
+	t.Helper()
+	entry, err := db.GetPassword(name)
+	if err != nil {
+		t.Fatalf("GetPassword(%q) failed: %v", name, err)
+	}
+	params, err := db.TOTP(name)
+	if err != nil {
+		t.Fatalf("TOTP(%q) failed: %v", name, err)
+	}
+	history, err := db.GetPasswordHistory(name)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory(%q) failed: %v", name, err)
+	}
+	var previous []string
+	for _, item := range history {
+		previous = append(previous, item.Password)
+	}
+	tags := append([]string{}, entry.Tags...)
+	sort.Strings(tags)
+	kind := entry.Type
+	if kind == "" {
+		kind = storage.EntryTypeLogin
+	}
+	return map[string]string{
+		"username":   entry.Username,
+		"password":   entry.Password,
+		"url":        entry.URL,
+		"notes":      entry.Notes,
+		"tags":       strings.Join(tags, ","),
+		"type":       kind,
+		"icon":       entry.Icon,
+		"created_at": entry.CreatedAt.UTC().Format("2006-01-02 15:04:05"),
+		"totp":       fmt.Sprint(params),
+		"history":    strings.Join(previous, ","),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	source := newRoundTripVault(t, "source.db")
+	for _, f := range roundTripFixture {
+		entry := *f.entry
+		if f.previous != "" {
+			entry.Password = f.previous
+		}
+		if err := source.SavePassword(&entry); err != nil {
+			t.Fatalf("SavePassword(%q) failed: %v", entry.Name, err)
+		}
+		if f.previous != "" {
+			entry.Password = f.entry.Password
+			if err := source.UpdatePassword(&entry); err != nil {
+				t.Fatalf("UpdatePassword(%q) failed: %v", entry.Name, err)
+			}
+		}
+		if f.totp != nil {
+			if err := source.SetTOTP(entry.Name, f.totp); err != nil {
+				t.Fatalf("SetTOTP(%q) failed: %v", entry.Name, err)
+			}
+		}
+	}
+	want := make(map[string]map[string]string)
+	for _, f := range roundTripFixture {
+		want[f.entry.Name] = fieldsOf(t, source, f.entry.Name)
+		if want[f.entry.Name]["password"] != f.entry.Password {
+			t.Fatalf("The fixture did not store %q as given", f.entry.Name)
+		}
+	}
+	// Timestamps are kept to the second: import in the next one, so a
+	// creation time that is not carried over shows
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	for _, format := range roundTripFormats {
+		t.Run(format.name, func(t *testing.T) {
+			entries := format.trip(t, source)
+			target := newRoundTripVault(t, "target.db")
+			report, err := target.ImportEntries(entries, storage.ConflictSkip)
+			if err != nil {
+				t.Fatalf("ImportEntries failed: %v", err)
+			}
+			if report.Created != len(roundTripFixture) {
+				t.Fatalf("Expected %d entries imported, got %+v", len(roundTripFixture), report.Outcomes)
+			}
+
+			lost := make(map[string]bool)
+			for _, field := range format.lost {
+				lost[field] = false
+			}
+			for name, fields := range want {
+				got := fieldsOf(t, target, name)
+				for _, field := range roundTripFields {
+					if got[field] == fields[field] {
+						continue
+					}
+					if _, ok := lost[field]; ok {
+						lost[field] = true
+						continue
+					}
+					t.Errorf("%s lost %s: expected %q, got %q", name, field, fields[field], got[field])
+				}
+			}
+			for _, field := range format.lost {
+				if !lost[field] {
+					t.Errorf("%s survives the round trip; take it off the list of fields lost", field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package importreport records what a bulk import did with each row, in a
+// JSON file kept for compliance and troubleshooting. Reports never hold
+// passwords or notes; usernames may be redacted too.
+package importreport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"password-manager/internal/appversion"
+	"password-manager/internal/storage"
+)
+
+// SchemaVersion is the version of the report format written by Write.
+// It goes up whenever a field changes meaning or is removed.
+const SchemaVersion = 1
+
+// Redacted replaces the usernames of a report written with redaction
+const Redacted = "[redacted]"
+
+// Report is the record of one import
+type Report struct {
+	Schema int `json:"schema"`
+	// Command is the command that ran, such as "import" or "sync import"
+	Command    string `json:"command"`
+	AppVersion string `json:"app_version"`
+	Source     Source `json:"source"`
+	// ConflictPolicy is how entries stored with other content were handled
+	ConflictPolicy string    `json:"conflict_policy"`
+	StartedAt      time.Time `json:"started_at"`
+	DurationMS     int64     `json:"duration_ms"`
+	// UsernamesRedacted is set when usernames were left out
+	UsernamesRedacted bool   `json:"usernames_redacted"`
+	Counts            Counts `json:"counts"`
+	Rows              []Row  `json:"rows"`
+}
+
+// Counts totals the rows of a report by outcome
+type Counts struct {
+	Imported int `json:"imported"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// Source is what was imported
+type Source struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	// SHA256 is the hash of the file; empty for a directory
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Row is the outcome of one incoming entry
+type Row struct {
+	// Line is where the entry starts in the source; 0 when the format has
+	// no lines, such as a pass store or a vault
+	Line     int    `json:"line,omitempty"`
+	Name     string `json:"name"`
+	Username string `json:"username,omitempty"`
+	// Outcome is storage.OutcomeImported, OutcomeUpdated, OutcomeSkipped
+	// or OutcomeFailed
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// New starts the report of command importing from the source at path in
+// format, hashing the source if it is a file
+func New(command, path, format, policy string, start time.Time) (*Report, error) {
+	r := &Report{
+		Schema:         SchemaVersion,
+		Command:        command,
+		AppVersion:     appversion.Current,
+		Source:         Source{Path: path, Format: format},
+		ConflictPolicy: policy,
+		StartedAt:      start.UTC(),
+		Rows:           []Row{},
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if r.Source.SHA256, err = hashFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// hashFile returns the SHA-256 of the file at path, in hex
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Add records the outcome of an entry
+func (r *Report) Add(row Row) {
+	r.Rows = append(r.Rows, row)
+}
+
+// Finish counts the outcomes and records the duration up to end. With
+// redact, usernames are replaced by Redacted.
+func (r *Report) Finish(end time.Time, redact bool) {
+	r.DurationMS = end.Sub(r.StartedAt).Milliseconds()
+	r.UsernamesRedacted = redact
+	r.Counts = Counts{}
+	for i := range r.Rows {
+		switch r.Rows[i].Outcome {
+		case storage.OutcomeImported:
+			r.Counts.Imported++
+		case storage.OutcomeUpdated:
+			r.Counts.Updated++
+		case storage.OutcomeSkipped:
+			r.Counts.Skipped++
+		default:
+			r.Counts.Failed++
+		}
+		if redact && r.Rows[i].Username != "" {
+			r.Rows[i].Username = Redacted
+		}
+	}
+}
+
+// Write saves the report at path, readable by the owner only
+func Write(path string, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Read loads the report at path. Reports of a newer schema are refused
+// rather than shown wrong.
+func Read(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s is not an import report: %w", path, err)
+	}
+	switch {
+	case r.Schema == 0:
+		return nil, fmt.Errorf("%s is not an import report: no schema version", path)
+	case r.Schema > SchemaVersion:
+		return nil, fmt.Errorf("%s has report schema %d; this version reads up to %d", path, r.Schema, SchemaVersion)
+	}
+	return &r, nil
+}
+
+// Print writes the report for reading: a summary, then every row that
+// was not a plain import
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s of %s (%s)\n", r.Command, r.Source.Path, r.Source.Format)
+	if r.Source.SHA256 != "" {
+		fmt.Fprintf(w, "  SHA-256:   %s\n", r.Source.SHA256)
+	}
+	fmt.Fprintf(w, "  Started:   %s, took %s\n", r.StartedAt.Local().Format("2006-01-02 15:04:05"),
+		time.Duration(r.DurationMS)*time.Millisecond)
+	fmt.Fprintf(w, "  Conflicts: %s\n", r.ConflictPolicy)
+	fmt.Fprintf(w, "  Version:   %s (report schema %d)\n", r.AppVersion, r.Schema)
+	fmt.Fprintf(w, "  %d imported, %d updated, %d skipped, %d failed\n",
+		r.Counts.Imported, r.Counts.Updated, r.Counts.Skipped, r.Counts.Failed)
+
+	// Failures first, then the rest in source order
+	rows := append([]Row{}, r.Rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Outcome == storage.OutcomeFailed && rows[j].Outcome != storage.OutcomeFailed
+	})
+	for _, row := range rows {
+		if row.Outcome == storage.OutcomeImported && row.Reason == "" {
+			continue
+		}
+		where := ""
+		if row.Line > 0 {
+			where = fmt.Sprintf("line %d: ", row.Line)
+		}
+		fmt.Fprintf(w, "  %-8s %s%s", row.Outcome, where, row.Name)
+		if row.Username != "" {
+			fmt.Fprintf(w, " (%s)", row.Username)
+		}
+		if row.Reason != "" {
+			fmt.Fprintf(w, ": %s", row.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+}
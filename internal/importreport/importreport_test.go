@@ -0,0 +1,67 @@
+package importreport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "export.csv")
+	if err := os.WriteFile(source, []byte("name\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	r, err := New("import", source, "chrome", "skip", start)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	// The SHA-256 of "name\n"
+	if r.Source.SHA256 != "f80b1fa820d95a87cf48f78eb6c298b427fda46207f7b52eaff6fb8ab1590c64" {
+		t.Errorf("Unexpected hash %q", r.Source.SHA256)
+	}
+	r.Add(Row{Line: 2, Name: "a", Username: "alice", Outcome: storage.OutcomeImported})
+	r.Add(Row{Line: 3, Name: "b", Outcome: storage.OutcomeFailed, Reason: "password cannot be empty"})
+	r.Finish(start.Add(1500*time.Millisecond), true)
+
+	path := filepath.Join(dir, "report.json")
+	if err := Write(path, r); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if read.DurationMS != 1500 || read.Counts != (Counts{Imported: 1, Failed: 1}) || !read.UsernamesRedacted {
+		t.Errorf("Unexpected report %+v", read)
+	}
+	// Only usernames that were there are redacted
+	if read.Rows[0].Username != Redacted || read.Rows[1].Username != "" {
+		t.Errorf("Unexpected rows %+v", read.Rows)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		data string
+		want string
+	}{
+		{`{"schema": 2, "rows": []}`, "has report schema 2; this version reads up to 1"},
+		{`{"rows": []}`, "is not an import report: no schema version"},
+		{`name,url`, "is not an import report"},
+	} {
+		path := filepath.Join(dir, "report.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Read(%s) = %v, want an error containing %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package passstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GPG runs the gpg program; no OpenPGP code runs in this process. The
+// options are the ones pass itself uses.
+type GPG struct {
+	// Program is the gpg executable, "gpg" if empty
+	Program string
+	// Home overrides GNUPGHOME when set
+	Home string
+}
+
+var gpgOptions = []string{"--quiet", "--yes", "--compress-algo=none", "--no-encrypt-to"}
+
+// Encrypt encrypts plaintext to the given key IDs
+func (g *GPG) Encrypt(ids []string, plaintext []byte) ([]byte, error) {
+	args := []string{"--batch", "--encrypt"}
+	for _, id := range ids {
+		args = append(args, "--recipient", id)
+	}
+	return g.run(append(args, gpgOptions...), plaintext)
+}
+
+// Decrypt decrypts a file written by pass or Encrypt. gpg may ask for
+// the key's passphrase through its agent.
+func (g *GPG) Decrypt(ciphertext []byte) ([]byte, error) {
+	return g.run(append([]string{"--decrypt"}, gpgOptions...), ciphertext)
+}
+
+func (g *GPG) run(args []string, input []byte) ([]byte, error) {
+	program := g.Program
+	if program == "" {
+		program = "gpg"
+	}
+	cmd := exec.Command(program, args...)
+	if g.Home != "" {
+		cmd.Env = append(os.Environ(), "GNUPGHOME="+g.Home)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg := lastLine(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("gpg failed: %s", msg)
+			}
+		}
+		return nil, fmt.Errorf("gpg failed: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// lastLine returns the last non-empty line of gpg's diagnostics
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
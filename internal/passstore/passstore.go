@@ -0,0 +1,246 @@
+package passstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// IDFile is the file at the root of a store listing the GPG key IDs
+// entries are encrypted to
+const IDFile = ".gpg-id"
+
+// EntryError is a failure to export or import one entry
+type EntryError struct {
+	Name string
+	Err  error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// Encode renders an entry the way pass stores it: the password on the
+// first line, then "username:", "url:", "tags:" and "icon:" lines for the
+// fields that are set, then the notes
+func Encode(entry *storage.PasswordEntry) []byte {
+	var b strings.Builder
+	b.WriteString(entry.Password)
+	b.WriteString("\n")
+	if entry.Username != "" {
+		fmt.Fprintf(&b, "username: %s\n", entry.Username)
+	}
+	if entry.URL != "" {
+		fmt.Fprintf(&b, "url: %s\n", entry.URL)
+	}
+	if len(entry.Tags) > 0 {
+		fmt.Fprintf(&b, "tags: %s\n", strings.Join(entry.Tags, ", "))
+	}
+	if entry.Icon != "" {
+		fmt.Fprintf(&b, "icon: %s\n", entry.Icon)
+	}
+	if entry.Notes != "" {
+		b.WriteString(entry.Notes)
+		if !strings.HasSuffix(entry.Notes, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// Decode parses a decrypted pass file. The first line is the password;
+// the "key: value" lines right after it fill the username (also written
+// "user" or "login"), url, tags and icon; everything from the first other line
+// on is the notes.
+func Decode(name string, data []byte) *storage.PasswordEntry {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	entry := &storage.PasswordEntry{Name: name, Password: lines[0]}
+	i := 1
+	for ; i < len(lines); i++ {
+		key, value, ok := strings.Cut(lines[i], ":")
+		if !ok {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "username", "user", "login":
+			if entry.Username != "" {
+				break
+			}
+			entry.Username = value
+			continue
+		case "url":
+			if entry.URL != "" {
+				break
+			}
+			entry.URL = value
+			continue
+		case "tags":
+			if entry.Tags != nil {
+				break
+			}
+			entry.Tags = splitTags(value)
+			continue
+		case "icon":
+			if entry.Icon != "" {
+				break
+			}
+			entry.Icon = value
+			continue
+		}
+		break
+	}
+	if i < len(lines) {
+		entry.Notes = strings.Join(lines[i:], "\n")
+	}
+	return entry
+}
+
+func splitTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// entryPath returns where an entry lives in the store at dir. Slashes in
+// the name become folders, as in pass; names leaving the store are
+// rejected.
+func entryPath(dir, name string) (string, error) {
+	rel := filepath.FromSlash(name) + ".gpg"
+	if name == "" || !filepath.IsLocal(rel) || strings.HasPrefix(filepath.Base(rel), ".") {
+		return "", fmt.Errorf("name cannot be stored as a file")
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+// ReadIDs returns the key IDs listed in the IDFile of the store at dir
+func ReadIDs(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IDFile))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			ids = append(ids, line)
+		}
+	}
+	return ids, nil
+}
+
+// Export writes each entry to the store at dir, encrypted to ids, and
+// writes the IDFile if the store has none. Entries that fail, including
+// those that already exist in the store, are skipped and returned as
+// EntryErrors; the error is for failures affecting the whole store.
+func Export(dir string, ids []string, entries []*storage.PasswordEntry, gpg *GPG) ([]*EntryError, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no GPG key ID to encrypt to")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+	idPath := filepath.Join(dir, IDFile)
+	if _, err := os.Stat(idPath); errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(idPath, []byte(strings.Join(ids, "\n")+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", IDFile, err)
+		}
+	}
+
+	var failed []*EntryError
+	for _, entry := range entries {
+		if err := exportEntry(dir, ids, entry, gpg); err != nil {
+			failed = append(failed, &EntryError{Name: entry.Name, Err: err})
+		}
+	}
+	return failed, nil
+}
+
+func exportEntry(dir string, ids []string, entry *storage.PasswordEntry, gpg *GPG) error {
+	if entry.Locked {
+		return errors.New("password is encrypted to recipients you hold no identity for")
+	}
+	path, err := entryPath(dir, entry.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return errors.New("already exists in the store")
+	}
+
+	ciphertext, err := gpg.Encrypt(ids, Encode(entry))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := f.Write(ciphertext); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return f.Close()
+}
+
+// Import reads and decrypts every entry of the store at dir, sorted by
+// name. Names are the file paths relative to dir without the .gpg
+// suffix. Files that cannot be decrypted are returned as EntryErrors.
+func Import(dir string, gpg *GPG) ([]*storage.PasswordEntry, []*EntryError, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".gpg") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read store: %w", err)
+	}
+	sort.Strings(paths)
+
+	var entries []*storage.PasswordEntry
+	var failed []*EntryError
+	for _, path := range paths {
+		rel, _ := filepath.Rel(dir, path)
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ".gpg"))
+		ciphertext, err := os.ReadFile(path)
+		if err == nil {
+			var plaintext []byte
+			if plaintext, err = gpg.Decrypt(ciphertext); err == nil {
+				entries = append(entries, Decode(name, plaintext))
+				continue
+			}
+		}
+		failed = append(failed, &EntryError{Name: name, Err: err})
+	}
+	return entries, failed, nil
+}
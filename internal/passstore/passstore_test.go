@@ -0,0 +1,154 @@
+package passstore
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"password-manager/internal/storage"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *storage.PasswordEntry
+		text  string
+	}{
+		{
+			"full",
+			&storage.PasswordEntry{Name: "web/github", Password: "s3cret", Username: "alice", URL: "https://github.com",
+				Tags: []string{"dev", "work"}, Icon: "🐙", Notes: "recovery codes\nin the safe"},
+			"s3cret\nusername: alice\nurl: https://github.com\ntags: dev, work\nicon: 🐙\nrecovery codes\nin the safe\n",
+		},
+		{"password only", &storage.PasswordEntry{Name: "pin", Password: "1234"}, "1234\n"},
+		{"note without password", &storage.PasswordEntry{Name: "safe", Notes: "12-34-56"}, "\n12-34-56\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Encode(tt.entry)); got != tt.text {
+				t.Errorf("Encode = %q, want %q", got, tt.text)
+			}
+			got := Decode(tt.entry.Name, []byte(tt.text))
+			if got.Password != tt.entry.Password || got.Username != tt.entry.Username || got.URL != tt.entry.URL ||
+				got.Notes != tt.entry.Notes || got.Icon != tt.entry.Icon || len(got.Tags) != len(tt.entry.Tags) {
+				t.Errorf("Decode = %+v, want %+v", got, tt.entry)
+			}
+		})
+	}
+}
+
+func TestDecodeConventions(t *testing.T) {
+	text := "pw\r\nlogin: bob\r\nURL: example.com\r\nuser: ignored\r\nmore notes\r\n"
+	got := Decode("site", []byte(text))
+	if got.Password != "pw" || got.Username != "bob" || got.URL != "example.com" {
+		t.Errorf("Unexpected fields %+v", got)
+	}
+	// The repeated user line ends the header and starts the notes
+	if got.Notes != "user: ignored\nmore notes" {
+		t.Errorf("Unexpected notes %q", got.Notes)
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	for _, name := range []string{"", "../escape", "/etc/passwd", "web/../../x", ".hidden", "web/.gpg-id"} {
+		if _, err := entryPath("/store", name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+	if path, err := entryPath("/store", "web/github"); err != nil || path != filepath.Join("/store", "web", "github.gpg") {
+		t.Errorf("entryPath = %q, %v", path, err)
+	}
+}
+
+// newTestGPG creates a keyring holding one key without a passphrase and
+// returns the key ID
+func newTestGPG(t *testing.T) (*GPG, string) {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	home, err := os.MkdirTemp("", "gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(home, 0700)
+	t.Cleanup(func() {
+		kill := exec.Command("gpgconf", "--kill", "gpg-agent")
+		kill.Env = append(os.Environ(), "GNUPGHOME="+home)
+		kill.Run()
+		os.RemoveAll(home)
+	})
+
+	id := "pm-test@example.com"
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", id, "future-default", "default", "never")
+	gen.Env = append(os.Environ(), "GNUPGHOME="+home)
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Fatalf("Generating a test key failed: %v\n%s", err, out)
+	}
+	return &GPG{Home: home}, id
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	gpg, id := newTestGPG(t)
+	dir := filepath.Join(t.TempDir(), "store")
+
+	entries := []*storage.PasswordEntry{
+		{Name: "email/work", Password: "hunter2", Username: "alice@example.com", URL: "https://mail.example.com", Tags: []string{"work"}},
+		{Name: "wifi", Password: "correct horse", Notes: "guest network\npassword rotates monthly"},
+		{Name: "locked", Password: "", Locked: true},
+		{Name: "../escape", Password: "x"},
+	}
+	failed, err := Export(dir, []string{id}, entries, gpg)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(failed) != 2 || failed[0].Name != "locked" || failed[1].Name != "../escape" {
+		t.Fatalf("Expected the locked and escaping entries to fail, got %v", failed)
+	}
+	if ids, err := ReadIDs(dir); err != nil || !reflect.DeepEqual(ids, []string{id}) {
+		t.Errorf("Expected %s to list %s, got %v, %v", IDFile, id, ids, err)
+	}
+
+	// Exporting again never overwrites
+	failed, _ = Export(dir, []string{id}, entries[:1], gpg)
+	if len(failed) != 1 {
+		t.Errorf("Expected an existing file to be skipped, got %v", failed)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.gpg"), []byte("not encrypted"), 0600)
+	imported, failed, err := Import(dir, gpg)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(failed) != 1 || failed[0].Name != "broken" {
+		t.Errorf("Expected broken to fail, got %v", failed)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(imported))
+	}
+	for i, want := range entries[:2] {
+		got := imported[i]
+		if got.Name != want.Name || got.Password != want.Password || got.Username != want.Username ||
+			got.URL != want.URL || got.Notes != want.Notes || !reflect.DeepEqual(got.Tags, want.Tags) {
+			t.Errorf("Round trip changed %s:\n got %+v\nwant %+v", want.Name, got, want)
+		}
+	}
+}
+
+func TestGPGErrors(t *testing.T) {
+	gpg := &GPG{Program: filepath.Join(t.TempDir(), "no-such-gpg")}
+	if _, err := gpg.Encrypt([]string{"x"}, []byte("secret")); err == nil {
+		t.Error("Expected an error for a missing gpg")
+	}
+
+	var entryErr *EntryError
+	err := error(&EntryError{Name: "a", Err: os.ErrNotExist})
+	if !errors.As(err, &entryErr) || !errors.Is(err, os.ErrNotExist) || err.Error() != "a: file does not exist" {
+		t.Errorf("Unexpected EntryError behavior: %v", err)
+	}
+}
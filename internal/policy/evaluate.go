@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"password-manager/internal/generator"
+	"password-manager/internal/query"
+	"password-manager/internal/storage"
+)
+
+// Report is the outcome of evaluating a policy
+type Report struct {
+	Passed bool          `json:"passed"`
+	Rules  []*RuleResult `json:"rules"`
+}
+
+// RuleResult is the outcome of one rule
+type RuleResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Checked is how many entries the rule selected
+	Checked  int        `json:"checked"`
+	Failures []*Failure `json:"failures,omitempty"`
+}
+
+// Failure lists why an entry fails a rule
+type Failure struct {
+	Entry   string   `json:"entry"`
+	Reasons []string `json:"reasons"`
+}
+
+// Vault is what a policy is evaluated against
+type Vault struct {
+	// Entries are the entries with their secrets decrypted
+	Entries []*storage.PasswordEntry
+	// Grades are the cached strength grades by entry ID. A grade newer
+	// than the entry's last change is used instead of analyzing its
+	// password again.
+	Grades map[int64]storage.StrengthGrade
+	// TOTP holds the names of the entries with a TOTP secret
+	TOTP map[string]bool
+}
+
+// Evaluate checks every entry each rule selects against the rule's
+// requirements at now. Entries of several rules are analyzed once.
+func (p *Policy) Evaluate(vault Vault, now time.Time) *Report {
+	report := &Report{Passed: true}
+	levels := make(map[int64]string)
+	level := func(entry *storage.PasswordEntry) string {
+		if level, ok := levels[entry.ID]; ok {
+			return level
+		}
+		var level string
+		if grade, ok := vault.Grades[entry.ID]; ok && !grade.AnalyzedAt.Before(entry.UpdatedAt) {
+			level = grade.Level
+		} else if !entry.Locked && entry.Password != "" {
+			level = generator.Analyze(entry.Password).Level
+		}
+		levels[entry.ID] = level
+		return level
+	}
+
+	for _, rule := range p.Rules {
+		result := &RuleResult{Name: rule.Name, Passed: true}
+		for _, entry := range vault.Entries {
+			if rule.Select != nil && !rule.Select.Match(entry, vault.Grades) {
+				continue
+			}
+			result.Checked++
+			if reasons := rule.check(entry, level, vault.TOTP[entry.Name], now); len(reasons) > 0 {
+				result.Failures = append(result.Failures, &Failure{Entry: entry.Name, Reasons: reasons})
+				result.Passed, report.Passed = false, false
+			}
+		}
+		report.Rules = append(report.Rules, result)
+	}
+	return report
+}
+
+// check returns why entry fails the rule, if it does. level returns the
+// strength level of an entry's password, or "" if it cannot be read.
+func (r *Rule) check(entry *storage.PasswordEntry, level func(*storage.PasswordEntry) string, hasTOTP bool, now time.Time) []string {
+	var reasons []string
+	if r.MinLength > 0 {
+		switch length := utf8.RuneCountInString(entry.Password); {
+		case entry.Locked:
+			reasons = append(reasons, "password is encrypted to recipients and its length cannot be checked")
+		case length < r.MinLength:
+			reasons = append(reasons, fmt.Sprintf("password has %d characters, needs %d", length, r.MinLength))
+		}
+	}
+	if r.MinStrength != "" {
+		switch got := level(entry); {
+		case got == "" && entry.Locked:
+			reasons = append(reasons, "password is encrypted to recipients and its strength cannot be checked")
+		case got == "":
+			reasons = append(reasons, fmt.Sprintf("no password, needs %s or stronger", r.MinStrength))
+		case rank(got) < rank(r.MinStrength):
+			reasons = append(reasons, fmt.Sprintf("password is %s, needs %s or stronger", got, r.MinStrength))
+		}
+	}
+	if r.maxAge != "" && entry.UpdatedAt.Before(r.MaxAge.Before(now)) {
+		days := int(now.Sub(entry.UpdatedAt).Hours() / 24)
+		reasons = append(reasons, fmt.Sprintf("last changed %d days ago, max_age is %s", days, r.maxAge))
+	}
+	if r.RequireTOTP && !hasTOTP {
+		reasons = append(reasons, "no TOTP secret")
+	}
+	if r.NotesPattern != nil && !r.NotesPattern.MatchString(entry.Notes) {
+		reasons = append(reasons, fmt.Sprintf("notes do not match %s", r.NotesPattern))
+	}
+	return reasons
+}
+
+// rank returns the position of level in query.Levels
+func rank(level string) int {
+	for i, known := range query.Levels {
+		if known == level {
+			return i
+		}
+	}
+	return -1
+}
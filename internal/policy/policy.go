@@ -0,0 +1,272 @@
+// Package policy checks a vault against compliance rules read from a
+// YAML policy file, such as "entries tagged prod have passwords of 20 or
+// more characters, a TOTP secret and were changed within 180 days".
+package policy
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"password-manager/internal/duration"
+	"password-manager/internal/query"
+)
+
+// Error is a schema error in a policy file. Line is 1-based, or 0 when
+// the error is not tied to a line.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Policy is a parsed policy file
+type Policy struct {
+	Rules []*Rule
+}
+
+// Rule requires the entries its selector matches to meet every
+// requirement set on it
+type Rule struct {
+	Name string
+	// Select picks the entries the rule applies to; nil means every entry
+	Select *query.Query
+	// Line is where the rule starts in the policy file
+	Line int
+
+	// MinLength is the fewest characters a password may have; 0 means
+	// any
+	MinLength int
+	// MinStrength is the weakest level of query.Levels a password may
+	// have; empty means any
+	MinStrength string
+	// MaxAge is how long ago the entry may have last been changed, such
+	// as 180d; the zero Spec means any time
+	MaxAge duration.Spec
+	// maxAge is MaxAge as written, for reports
+	maxAge string
+	// RequireTOTP requires a TOTP secret
+	RequireTOTP bool
+	// NotesPattern is a regular expression the notes must match; nil
+	// means any notes
+	NotesPattern *regexp.Regexp
+}
+
+// ruleKeys are the keys a rule takes, in the order they are documented
+var ruleKeys = []string{"name", "select", "min_length", "min_strength", "max_age", "totp", "notes_pattern"}
+
+// Load reads and parses the policy file at path
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a policy document:
+//
+//	rules:
+//	  - name: prod
+//	    select: tag=prod
+//	    min_length: 20
+//	    min_strength: Strong
+//	    max_age: 180d
+//	    totp: true
+//	    notes_pattern: "(?i)owner:"
+//
+// select is a --where expression and may be left out to apply a rule to
+// every entry. Unknown keys and values of the wrong type are errors, with
+// the line they are on.
+func Parse(data []byte) (*Policy, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, &Error{Msg: strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	if len(doc.Content) == 0 {
+		return nil, &Error{Msg: "the policy is empty"}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, &Error{root.Line, "the policy must be a mapping with a rules key"}
+	}
+
+	var rules *yaml.Node
+	err := eachKey(root, []string{"rules"}, func(key string, value *yaml.Node) error {
+		rules = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		return nil, &Error{root.Line, "rules is required"}
+	}
+	if rules.Kind != yaml.SequenceNode {
+		return nil, &Error{rules.Line, "rules must be a list of rules"}
+	}
+	if len(rules.Content) == 0 {
+		return nil, &Error{rules.Line, "rules is empty"}
+	}
+
+	policy := &Policy{}
+	names := make(map[string]int)
+	for _, node := range rules.Content {
+		rule, err := parseRule(node)
+		if err != nil {
+			return nil, err
+		}
+		if line, ok := names[rule.Name]; ok {
+			return nil, &Error{rule.Line, fmt.Sprintf("rule %q is already defined on line %d", rule.Name, line)}
+		}
+		names[rule.Name] = rule.Line
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// parseRule parses one element of rules
+func parseRule(node *yaml.Node) (*Rule, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, &Error{node.Line, "a rule must be a mapping of name, select and requirements"}
+	}
+
+	rule := &Rule{Line: node.Line}
+	requirements := 0
+	err := eachKey(node, ruleKeys, func(key string, value *yaml.Node) error {
+		if key != "name" && key != "select" {
+			requirements++
+		}
+		switch key {
+		case "name":
+			text, err := scalar(value, key, "!!str")
+			if err == nil && strings.TrimSpace(text) == "" {
+				err = &Error{value.Line, "name cannot be empty"}
+			}
+			rule.Name = strings.TrimSpace(text)
+			return err
+		case "select":
+			text, err := scalar(value, key, "!!str")
+			if err != nil {
+				return err
+			}
+			if rule.Select, err = query.Parse(text); err != nil {
+				return &Error{value.Line, fmt.Sprintf("invalid select %q: %v", text, err)}
+			}
+		case "min_length":
+			text, err := scalar(value, key, "!!int")
+			if err != nil {
+				return err
+			}
+			if rule.MinLength, err = strconv.Atoi(text); err != nil || rule.MinLength < 1 {
+				return &Error{value.Line, fmt.Sprintf("min_length must be a positive number, not %s", text)}
+			}
+		case "min_strength":
+			text, err := scalar(value, key, "!!str")
+			if err != nil {
+				return err
+			}
+			for _, level := range query.Levels {
+				if strings.EqualFold(text, level) {
+					rule.MinStrength = level
+				}
+			}
+			if rule.MinStrength == "" {
+				return &Error{value.Line, fmt.Sprintf("min_strength %q is not one of %s", text, strings.Join(query.Levels, ", "))}
+			}
+		case "max_age":
+			text, err := scalar(value, key, "!!str", "!!int", "!!timestamp")
+			if err != nil {
+				return err
+			}
+			spec, err := duration.Parse(text, duration.Expiry)
+			if err == nil && spec.IsAbsolute() {
+				err = fmt.Errorf("it must be a span such as 180d, not a date")
+			}
+			if err != nil {
+				return &Error{value.Line, fmt.Sprintf("invalid max_age %q: %v", text, err)}
+			}
+			rule.MaxAge, rule.maxAge = spec, text
+		case "totp":
+			text, err := scalar(value, key, "!!bool")
+			if err != nil {
+				return err
+			}
+			rule.RequireTOTP, _ = strconv.ParseBool(text)
+			if !rule.RequireTOTP {
+				requirements--
+			}
+		case "notes_pattern":
+			text, err := scalar(value, key, "!!str")
+			if err != nil {
+				return err
+			}
+			if rule.NotesPattern, err = regexp.Compile(text); err != nil {
+				return &Error{value.Line, fmt.Sprintf("invalid notes_pattern: %v", err)}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rule.Name == "" {
+		return nil, &Error{node.Line, "the rule has no name"}
+	}
+	if requirements == 0 {
+		return nil, &Error{node.Line, fmt.Sprintf("rule %q has no requirements; set one of %s",
+			rule.Name, strings.Join(ruleKeys[2:], ", "))}
+	}
+	return rule, nil
+}
+
+// eachKey calls fn with the keys and values of a mapping in order,
+// rejecting keys that are not known or appear twice
+func eachKey(node *yaml.Node, known []string, fn func(key string, value *yaml.Node) error) error {
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Kind != yaml.ScalarNode || !contains(known, key.Value) {
+			sorted := append([]string{}, known...)
+			sort.Strings(sorted)
+			return &Error{key.Line, fmt.Sprintf("unknown key %q (known: %s)", key.Value, strings.Join(sorted, ", "))}
+		}
+		if seen[key.Value] {
+			return &Error{key.Line, fmt.Sprintf("%s is given twice", key.Value)}
+		}
+		seen[key.Value] = true
+		if err := fn(key.Value, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scalar returns the text of a scalar value of one of the YAML tags
+func scalar(node *yaml.Node, key string, tags ...string) (string, error) {
+	want := map[string]string{"!!str": "text", "!!int": "a number", "!!bool": "true or false"}
+	if node.Kind != yaml.ScalarNode || !contains(tags, node.ShortTag()) {
+		return "", &Error{node.Line, fmt.Sprintf("%s must be %s", key, want[tags[0]])}
+	}
+	return node.Value, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
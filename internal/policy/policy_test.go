@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+const testPolicy = `rules:
+  - name: prod
+    select: tag=prod
+    min_length: 20
+    max_age: 180d
+    totp: true
+  - name: strong
+    min_strength: Good
+  - name: owners
+    select: type=login
+    notes_pattern: "(?i)owner: \\S+"
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(p.Rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(p.Rules))
+	}
+	prod := p.Rules[0]
+	if prod.Name != "prod" || prod.Line != 2 || prod.MinLength != 20 || !prod.RequireTOTP || prod.Select == nil {
+		t.Errorf("Unexpected rule %+v", prod)
+	}
+	if p.Rules[1].Select != nil || p.Rules[1].MinStrength != "Good" {
+		t.Errorf("Unexpected rule %+v", p.Rules[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"", "the policy is empty"},
+		{"rules: []\n", "line 1: rules is empty"},
+		{"rule:\n  - name: x\n", `line 1: unknown key "rule" (known: rules)`},
+		{"rules:\n  - name: x\n    min_len: 20\n", `line 3: unknown key "min_len"`},
+		{"rules:\n  - name: x\n    min_length: twenty\n", "line 3: min_length must be a number"},
+		{"rules:\n  - name: x\n    min_length: 0\n", "line 3: min_length must be a positive number"},
+		{"rules:\n  - name: x\n    min_strength: Mighty\n", `line 3: min_strength "Mighty" is not one of`},
+		{"rules:\n  - name: x\n    max_age: 2024-01-01\n", "line 3: invalid max_age"},
+		{"rules:\n  - name: x\n    totp: yes please\n", "line 3: totp must be true or false"},
+		{"rules:\n  - name: x\n    notes_pattern: \"(\"\n", "line 3: invalid notes_pattern"},
+		{"rules:\n  - name: x\n    select: tag=\n    totp: true\n", "line 3: invalid select"},
+		{"rules:\n  - select: tag=prod\n    totp: true\n", "line 2: the rule has no name"},
+		{"rules:\n  - name: x\n    select: tag=prod\n", `line 2: rule "x" has no requirements`},
+		{"rules:\n  - name: x\n    totp: false\n", `line 2: rule "x" has no requirements`},
+		{"rules:\n  - name: x\n    totp: true\n  - name: x\n    totp: true\n", `line 4: rule "x" is already defined on line 2`},
+		{"rules:\n  - name: x\n    totp: true\n    totp: false\n", "line 4: totp is given twice"},
+		{"rules:\n  - name: x\n   totp: true\n", "line "}, // YAML syntax
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.policy))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want an error starting with %q", tt.policy, err, tt.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent, old := now.AddDate(0, -1, 0), now.AddDate(-1, 0, 0)
+	vault := Vault{
+		Entries: []*storage.PasswordEntry{
+			{ID: 1, Name: "aws", Password: "Xk3f9qLmTt2vPz8w!a#B", Tags: []string{"prod"}, Notes: "owner: ops", UpdatedAt: recent},
+			{ID: 2, Name: "db", Password: "short", Tags: []string{"prod"}, Notes: "owner: dba", UpdatedAt: old},
+			{ID: 3, Name: "wiki", Password: "hunter2", Notes: "shared", UpdatedAt: recent},
+		},
+		// A current cached grade is used instead of analyzing the password
+		Grades: map[int64]storage.StrengthGrade{3: {EntryID: 3, Level: "Strong", AnalyzedAt: now}},
+		TOTP:   map[string]bool{"aws": true},
+	}
+	report := p.Evaluate(vault, now)
+	if report.Passed {
+		t.Fatal("Expected the policy to fail")
+	}
+
+	prod := report.Rules[0]
+	if prod.Passed || prod.Checked != 2 || len(prod.Failures) != 1 || prod.Failures[0].Entry != "db" {
+		t.Fatalf("Unexpected prod result %+v", prod)
+	}
+	want := []string{"password has 5 characters, needs 20", "last changed 365 days ago, max_age is 180d", "no TOTP secret"}
+	if got := prod.Failures[0].Reasons; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected reasons %q, got %q", want, got)
+	}
+
+	strong := report.Rules[1]
+	if strong.Checked != 3 || len(strong.Failures) != 1 || strong.Failures[0].Entry != "db" {
+		t.Errorf("Expected only db to be weak, got %+v", strong.Failures)
+	}
+
+	owners := report.Rules[2]
+	if owners.Passed || len(owners.Failures) != 1 || owners.Failures[0].Entry != "wiki" {
+		t.Errorf("Expected wiki to lack an owner, got %+v", owners.Failures)
+	}
+}
+
+func TestEvaluateLocked(t *testing.T) {
+	p, err := Parse([]byte("rules:\n  - name: long\n    min_length: 12\n    min_strength: Good\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	vault := Vault{Entries: []*storage.PasswordEntry{{ID: 1, Name: "shared", Locked: true}}}
+	report := p.Evaluate(vault, time.Now())
+	if report.Passed || len(report.Rules[0].Failures[0].Reasons) != 2 {
+		t.Errorf("Expected a locked entry to fail both checks, got %+v", report.Rules[0].Failures)
+	}
+}
+
+func TestParseSiteRules(t *testing.T) {
+	rules, err := ParseSiteRules("min=12, max=20,classes=3,forbid=<>&,")
+	if err != nil {
+		t.Fatalf("ParseSiteRules failed: %v", err)
+	}
+	if rules.Min != 12 || rules.Max != 20 || rules.Classes != 3 || rules.Forbid != "<>&," {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+
+	for _, expr := range []string{
+		"", "min", "length=12", "min=0", "min=x", "max=8,min=12", "classes=5", "forbid=", "min=8,min=9",
+	} {
+		if _, err := ParseSiteRules(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestSiteRulesCheck(t *testing.T) {
+	tests := []struct {
+		expr, password string
+		// broken are the rules the password breaks
+		broken []string
+	}{
+		{"min=12", "Short-1", []string{"min=12"}},
+		{"min=12", "Long-enough-1", nil},
+		{"min=4", "pässwörd", nil},
+		{"max=10", "much-too-long-for-it", []string{"max=10"}},
+		{"max=10", "fits-ten!!", nil},
+		{"classes=3", "lowercase only", []string{"classes=3"}},
+		{"classes=3", "Mixed-case", nil},
+		{"classes=4", "Aa1!", nil},
+		{"forbid=<>&", "a<b&c", []string{"forbid=<>&"}},
+		{"forbid=<>&", "a-b-c", nil},
+		{"min=12,max=20,classes=3,forbid=<>&", "ab<", []string{"min=12", "classes=3", "forbid=<>&"}},
+	}
+	for _, tt := range tests {
+		rules, err := ParseSiteRules(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSiteRules(%q) failed: %v", tt.expr, err)
+		}
+		var broken []string
+		for _, v := range rules.Check(tt.password) {
+			broken = append(broken, v.Rule)
+		}
+		if !reflect.DeepEqual(broken, tt.broken) {
+			t.Errorf("%s on %q: expected %v broken, got %v", tt.expr, tt.password, tt.broken, rules.Check(tt.password))
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// siteKeys are the rules a site expression takes, in the order they are
+// documented
+var siteKeys = []string{"min", "max", "classes", "forbid"}
+
+// SiteRules are the password rules a site states on its signup form,
+// written as a comma-separated expression such as
+// "min=12,max=20,classes=3,forbid=<>&":
+//
+//	min=N      at least N characters
+//	max=N      at most N characters
+//	classes=N  characters of at least N of lowercase, uppercase, digits
+//	           and symbols
+//	forbid=S   none of the characters of S
+//
+// Commas split the expression only where a rule name and = follow, so
+// forbid=,; forbids commas and semicolons.
+type SiteRules struct {
+	// Min and Max bound the length in characters; 0 means no bound
+	Min, Max int
+	// Classes is how many character classes must appear; 0 means any
+	Classes int
+	// Forbid holds the characters the password may not contain
+	Forbid string
+	// expr is the expression as given, for String
+	expr string
+}
+
+// Violation is a rule a password breaks
+type Violation struct {
+	// Rule is the rule as written, such as "min=12"
+	Rule string
+	// Msg says how the password breaks it
+	Msg string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Msg)
+}
+
+// ParseSiteRules parses a site expression. Unknown or repeated rules,
+// values out of range and a max below min are errors.
+func ParseSiteRules(expr string) (*SiteRules, error) {
+	rules := &SiteRules{expr: strings.TrimSpace(expr)}
+	if rules.expr == "" {
+		return nil, fmt.Errorf("the expression is empty")
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range splitSiteRules(rules.expr) {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a rule such as min=12", part)
+		}
+		if !contains(siteKeys, key) {
+			return nil, fmt.Errorf("unknown rule %q (rules are %s)", key, strings.Join(siteKeys, ", "))
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%s is given more than once", key)
+		}
+		seen[key] = true
+
+		if key == "forbid" {
+			if value == "" {
+				return nil, fmt.Errorf("forbid needs the characters to forbid")
+			}
+			rules.Forbid = value
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s must be a positive number, not %q", key, value)
+		}
+		switch key {
+		case "min":
+			rules.Min = n
+		case "max":
+			rules.Max = n
+		case "classes":
+			if n > 4 {
+				return nil, fmt.Errorf("classes must be 1 to 4, not %d", n)
+			}
+			rules.Classes = n
+		}
+	}
+	if rules.Max > 0 && rules.Max < rules.Min {
+		return nil, fmt.Errorf("max=%d is below min=%d", rules.Max, rules.Min)
+	}
+	return rules, nil
+}
+
+// splitSiteRules splits expr at the commas followed by a rule name and =
+func splitSiteRules(expr string) []string {
+	var parts []string
+	for _, piece := range strings.Split(expr, ",") {
+		key, _, _ := strings.Cut(piece, "=")
+		if len(parts) > 0 && !contains(siteKeys, strings.TrimSpace(key)) {
+			parts[len(parts)-1] += "," + piece
+			continue
+		}
+		parts = append(parts, piece)
+	}
+	return parts
+}
+
+// String returns the expression the rules were parsed from
+func (r *SiteRules) String() string {
+	return r.expr
+}
+
+// Check returns the rules password breaks, in the order of the rule
+// names; none if it complies
+func (r *SiteRules) Check(password string) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(password)
+	if r.Min > 0 && length < r.Min {
+		violations = append(violations, Violation{fmt.Sprintf("min=%d", r.Min), fmt.Sprintf("has %d characters", length)})
+	}
+	if r.Max > 0 && length > r.Max {
+		violations = append(violations, Violation{fmt.Sprintf("max=%d", r.Max), fmt.Sprintf("has %d characters", length)})
+	}
+	if r.Classes > 0 {
+		if classes := characterClasses(password); len(classes) < r.Classes {
+			msg := "has no character classes"
+			if len(classes) > 0 {
+				msg = fmt.Sprintf("has %d (%s)", len(classes), strings.Join(classes, ", "))
+			}
+			violations = append(violations, Violation{fmt.Sprintf("classes=%d", r.Classes), msg})
+		}
+	}
+	if r.Forbid != "" {
+		var found []string
+		for _, c := range r.Forbid {
+			if strings.ContainsRune(password, c) && !contains(found, string(c)) {
+				found = append(found, string(c))
+			}
+		}
+		if len(found) > 0 {
+			violations = append(violations, Violation{"forbid=" + r.Forbid, fmt.Sprintf("contains %s", strings.Join(found, " "))})
+		}
+	}
+	return violations
+}
+
+// characterClasses returns the classes of the characters of password, in
+// a fixed order
+func characterClasses(password string) []string {
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	var classes []string
+	for _, class := range []struct {
+		name    string
+		present bool
+	}{{"lowercase", lower}, {"uppercase", upper}, {"digits", digit}, {"symbols", symbol}} {
+		if class.present {
+			classes = append(classes, class.name)
+		}
+	}
+	return classes
+}
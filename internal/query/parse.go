@@ -0,0 +1,261 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"password-manager/internal/duration"
+)
+
+// Error is a syntax or type error in an expression. Pos is the byte
+// offset of the offending token.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos+1)
+}
+
+// Pointer renders expr with a caret under the error position
+func (e *Error) Pointer(expr string) string {
+	pos := e.Pos
+	if pos > len(expr) {
+		pos = len(expr)
+	}
+	return expr + "\n" + strings.Repeat(" ", utf8.RuneCountInString(expr[:pos])) + "^"
+}
+
+// tokenKind classifies lexer tokens
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators, longest first so that "<=" wins over "<"
+var operators = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+// lex splits expr into tokens. Words run until whitespace, a quote, a
+// parenthesis or an operator character; strings are quoted with ' or "
+// and use \ to escape the next character.
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			var value strings.Builder
+			i++
+			closed := false
+			for i < len(expr) {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					value.WriteByte(expr[i+1])
+					i += 2
+					continue
+				}
+				if expr[i] == c {
+					closed = true
+					i++
+					break
+				}
+				value.WriteByte(expr[i])
+				i++
+			}
+			if !closed {
+				return nil, &Error{start, "unterminated string"}
+			}
+			tokens = append(tokens, token{tokString, value.String(), start})
+		case strings.IndexByte("=!<>~", c) >= 0:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{i, fmt.Sprintf("unexpected %q", c)}
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(expr) && strings.IndexByte(" \t\n\r()'\"=!<>~", expr[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, expr[start:i], start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(expr)}), nil
+}
+
+// parser is a recursive descent parser over the token list:
+//
+//	expr   = and { "or" and }
+//	and    = unary { "and" unary }
+//	unary  = "not" unary | "(" expr ")" | term
+//	term   = field operator value
+type parser struct {
+	tokens []token
+	next   int
+	now    time.Time
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the given keyword
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		p.take()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.keyword("not") {
+		p.take()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	if p.peek().kind == tokLParen {
+		open := p.take()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t.kind != tokRParen {
+			if t.kind == tokEOF {
+				return nil, &Error{open.pos, "unclosed parenthesis"}
+			}
+			return nil, &Error{t.pos, fmt.Sprintf("expected ) but found %s", describe(t))}
+		}
+		p.take()
+		return inner, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *parser) parseTerm() (node, error) {
+	fieldTok := p.take()
+	if fieldTok.kind != tokWord {
+		return nil, &Error{fieldTok.pos, fmt.Sprintf("expected a field name but found %s", describe(fieldTok))}
+	}
+	name := strings.ToLower(fieldTok.text)
+	kind, ok := fields[name]
+	if !ok {
+		return nil, &Error{fieldTok.pos, fmt.Sprintf("unknown field %q (known: %s)", fieldTok.text, fieldNames())}
+	}
+
+	opTok := p.take()
+	if opTok.kind != tokOp {
+		return nil, &Error{opTok.pos, fmt.Sprintf("expected an operator after %s but found %s", name, describe(opTok))}
+	}
+	if !kind.allows(opTok.text) {
+		return nil, &Error{opTok.pos, fmt.Sprintf("operator %s does not apply to %s", opTok.text, name)}
+	}
+
+	valueTok := p.take()
+	if valueTok.kind != tokWord && valueTok.kind != tokString {
+		return nil, &Error{valueTok.pos, fmt.Sprintf("expected a value after %s but found %s", opTok.text, describe(valueTok))}
+	}
+
+	t := &term{field: name, kind: kind, op: opTok.text, text: strings.ToLower(valueTok.text)}
+	switch kind {
+	case timeField:
+		spec, err := duration.Parse(valueTok.text, duration.Expiry)
+		if err != nil {
+			return nil, &Error{valueTok.pos, fmt.Sprintf("invalid date %q", valueTok.text)}
+		}
+		t.time = spec.Before(p.now)
+	case strengthField:
+		level := levelRank(valueTok.text)
+		if level < 0 {
+			return nil, &Error{valueTok.pos, fmt.Sprintf("unknown strength level %q (known: %s)", valueTok.text, strings.Join(Levels, ", "))}
+		}
+		t.level = level
+	case typeField:
+		if t.text != "login" && t.text != "note" {
+			return nil, &Error{valueTok.pos, fmt.Sprintf("unknown entry type %q (known: login, note)", valueTok.text)}
+		}
+	}
+	return t, nil
+}
+
+// describe names a token in error messages
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
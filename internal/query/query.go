@@ -0,0 +1,302 @@
+package query
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+)
+
+// Levels are the strength levels in increasing order, as reported by
+// generator.Analyze
+var Levels = []string{"Very Weak", "Weak", "Fair", "Good", "Strong", "Very Strong", "Excellent"}
+
+// levelRank returns the position of level in Levels, or -1
+func levelRank(level string) int {
+	for i, known := range Levels {
+		if strings.EqualFold(level, known) {
+			return i
+		}
+	}
+	return -1
+}
+
+// fieldKind decides which operators a field takes and how it is compared
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	typeField
+	tagField
+	timeField
+	strengthField
+)
+
+// fields maps field names to their kind
+var fields = map[string]fieldKind{
+	"name":     textField,
+	"username": textField,
+	"url":      textField,
+	"type":     typeField,
+	"tag":      tagField,
+	"created":  timeField,
+	"updated":  timeField,
+	"accessed": timeField,
+	"strength": strengthField,
+}
+
+func fieldNames() string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// allows reports whether op applies to fields of this kind
+func (k fieldKind) allows(op string) bool {
+	switch k {
+	case textField, tagField:
+		return op == "=" || op == "!=" || op == "~" || op == "!~"
+	case typeField:
+		return op == "=" || op == "!="
+	default:
+		return op != "~" && op != "!~"
+	}
+}
+
+// Query is a parsed --where expression such as
+// "name~aws and tag=prod and updated<2023-01-01 and strength<Good".
+//
+// Terms compare a field with a value: text fields (name, username, url)
+// and tags take = != (case-insensitive equality) and ~ !~ (substring);
+// type takes = != with login or note; created, updated and accessed take
+// = != < <= > >= with a date or a span such as 90d meaning that long ago
+// (= is the same day; an entry never accessed is older than any date);
+// strength takes = != < <= > >= with one of Levels. Terms combine with
+// and, or, not and parentheses; and binds tighter than or.
+type Query struct {
+	expr     string
+	root     node
+	strength bool
+}
+
+// Parse parses an expression. Spans are resolved against the current
+// time.
+func Parse(expr string) (*Query, error) {
+	return parse(expr, time.Now())
+}
+
+func parse(expr string, now time.Time) (*Query, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, now: now}
+	if p.peek().kind == tokEOF {
+		return nil, &Error{0, "empty expression"}
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{t.pos, "expected and, or or end of expression but found " + describe(t)}
+	}
+	return &Query{expr: expr, root: root, strength: uses(root, "strength")}, nil
+}
+
+// String returns the expression the query was parsed from
+func (q *Query) String() string {
+	return q.expr
+}
+
+// NeedsPasswords reports whether evaluating the query may need decrypted
+// passwords: only strength terms do, and only for entries without a
+// cached grade. Otherwise metadata is enough.
+func (q *Query) NeedsPasswords() bool {
+	return q.strength
+}
+
+// Match reports whether entry satisfies the query. grades are the cached
+// strength grades by entry ID; entries without one are analyzed from
+// their password if it is available and otherwise never match a
+// strength term.
+func (q *Query) Match(entry *storage.PasswordEntry, grades map[int64]storage.StrengthGrade) bool {
+	return q.root.eval(&subject{entry: entry, grades: grades})
+}
+
+// Apply returns the entries matching the query
+func (q *Query) Apply(entries []*storage.PasswordEntry, grades map[int64]storage.StrengthGrade) []*storage.PasswordEntry {
+	var matched []*storage.PasswordEntry
+	for _, entry := range entries {
+		if q.Match(entry, grades) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// subject is an entry under evaluation. Its strength level is worked
+// out at most once, and only if a term asks for it.
+type subject struct {
+	entry    *storage.PasswordEntry
+	grades   map[int64]storage.StrengthGrade
+	level    int
+	resolved bool
+}
+
+// strength returns the rank of the entry's strength level, or -1 if it
+// is unknown
+func (s *subject) strength() int {
+	if s.resolved {
+		return s.level
+	}
+	s.resolved = true
+	s.level = -1
+	if s.entry.IsNote() {
+		return s.level
+	}
+	if grade, ok := s.grades[s.entry.ID]; ok && !grade.AnalyzedAt.Before(s.entry.UpdatedAt) {
+		s.level = levelRank(grade.Level)
+	} else if s.entry.Password != "" {
+		level := generator.Analyze(s.entry.Password).Level
+		s.level = levelRank(level)
+	}
+	return s.level
+}
+
+// node is an element of the expression tree
+type node interface {
+	eval(s *subject) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ operand node }
+
+func (n *andNode) eval(s *subject) bool { return n.left.eval(s) && n.right.eval(s) }
+func (n *orNode) eval(s *subject) bool  { return n.left.eval(s) || n.right.eval(s) }
+func (n *notNode) eval(s *subject) bool { return !n.operand.eval(s) }
+
+// uses reports whether any term under n compares field
+func uses(n node, field string) bool {
+	switch n := n.(type) {
+	case *andNode:
+		return uses(n.left, field) || uses(n.right, field)
+	case *orNode:
+		return uses(n.left, field) || uses(n.right, field)
+	case *notNode:
+		return uses(n.operand, field)
+	case *term:
+		return n.field == field
+	}
+	return false
+}
+
+// term compares one field with a value. text is lower-cased.
+type term struct {
+	field string
+	kind  fieldKind
+	op    string
+	text  string
+	time  time.Time
+	level int
+}
+
+func (t *term) eval(s *subject) bool {
+	entry := s.entry
+	switch t.field {
+	case "name":
+		return t.compareText(entry.Name)
+	case "username":
+		return t.compareText(entry.Username)
+	case "url":
+		return t.compareText(entry.URL)
+	case "type":
+		entryType := entry.Type
+		if entryType == "" {
+			entryType = storage.EntryTypeLogin
+		}
+		return t.compareText(entryType)
+	case "tag":
+		return t.compareTags(entry.Tags)
+	case "created":
+		return t.compareTime(entry.CreatedAt)
+	case "updated":
+		return t.compareTime(entry.UpdatedAt)
+	case "accessed":
+		return t.compareTime(entry.LastAccessedAt)
+	case "strength":
+		level := s.strength()
+		if level < 0 {
+			return false
+		}
+		return compareOrdered(t.op, level-t.level)
+	}
+	return false
+}
+
+func (t *term) compareText(value string) bool {
+	value = strings.ToLower(value)
+	switch t.op {
+	case "=":
+		return value == t.text
+	case "!=":
+		return value != t.text
+	case "~":
+		return strings.Contains(value, t.text)
+	case "!~":
+		return !strings.Contains(value, t.text)
+	}
+	return false
+}
+
+// compareTags applies the operator to the tag set: = and ~ hold if some
+// tag matches, != and !~ if none does
+func (t *term) compareTags(tags []string) bool {
+	positive := t.op == "=" || t.op == "~"
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if t.op == "=" || t.op == "!=" {
+			if tag == t.text {
+				return positive
+			}
+		} else if strings.Contains(tag, t.text) {
+			return positive
+		}
+	}
+	return !positive
+}
+
+func (t *term) compareTime(value time.Time) bool {
+	if t.op == "=" || t.op == "!=" {
+		y1, m1, d1 := value.In(t.time.Location()).Date()
+		y2, m2, d2 := t.time.Date()
+		same := y1 == y2 && m1 == m2 && d1 == d2
+		return same == (t.op == "=")
+	}
+	return compareOrdered(t.op, value.Compare(t.time))
+}
+
+// compareOrdered applies an ordering operator to the sign of a comparison
+func compareOrdered(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+var testNow = time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+
+// testEntries are the entries every expression in TestMatch runs against
+func testEntries() []*storage.PasswordEntry {
+	return []*storage.PasswordEntry{
+		{
+			ID: 1, Name: "aws-prod", Username: "root", URL: "https://console.aws.amazon.com",
+			Tags:      []string{"prod", "Cloud"},
+			CreatedAt: time.Date(2022, 3, 1, 9, 0, 0, 0, time.Local),
+			UpdatedAt: time.Date(2022, 12, 31, 23, 0, 0, 0, time.Local),
+		},
+		{
+			ID: 2, Name: "aws-staging", Username: "deploy",
+			Tags:           []string{"staging", "cloud"},
+			CreatedAt:      time.Date(2023, 5, 1, 9, 0, 0, 0, time.Local),
+			UpdatedAt:      time.Date(2024, 6, 1, 9, 0, 0, 0, time.Local),
+			LastAccessedAt: time.Date(2024, 6, 14, 8, 0, 0, 0, time.Local),
+		},
+		{
+			ID: 3, Name: "bank", Username: "john.doe", Password: "hunter2",
+			CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local),
+			UpdatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+		},
+		{
+			ID: 4, Name: "passport", Type: storage.EntryTypeNote, Notes: "X1234567",
+			Tags:      []string{"prod"},
+			CreatedAt: time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local),
+			UpdatedAt: time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local),
+		},
+	}
+}
+
+// testGrades caches a grade for aws-prod only; bank is analyzed from its
+// password and aws-staging has neither
+func testGrades() map[int64]storage.StrengthGrade {
+	return map[int64]storage.StrengthGrade{
+		1: {EntryID: 1, Level: "Strong", AnalyzedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local)},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // names of matching entries, comma-separated
+	}{
+		{"name=bank", "bank"},
+		{"name=BANK", "bank"},
+		{"name='aws-prod'", "aws-prod"},
+		{`name="aws-prod"`, "aws-prod"},
+		{"name!=bank", "aws-prod,aws-staging,passport"},
+		{"name~aws", "aws-prod,aws-staging"},
+		{"name~'AWS'", "aws-prod,aws-staging"},
+		{"name!~aws", "bank,passport"},
+		{"username=root", "aws-prod"},
+		{"username~'.'", "bank"},
+		{"url~amazon", "aws-prod"},
+		{"url=''", "aws-staging,bank,passport"},
+		{"type=note", "passport"},
+		{"type=login", "aws-prod,aws-staging,bank"},
+		{"type!=note", "aws-prod,aws-staging,bank"},
+		{"tag=prod", "aws-prod,passport"},
+		{"tag=cloud", "aws-prod,aws-staging"},
+		{"tag!=prod", "aws-staging,bank"},
+		{"tag~stag", "aws-staging"},
+		{"tag!~o", "bank"},
+		{"updated<'2023-01-01'", "aws-prod"},
+		{"updated<=2023-01-01", "aws-prod,bank"},
+		{"updated>2023-01-01", "aws-staging,passport"},
+		{"updated>=2023-01-01", "aws-staging,bank,passport"},
+		{"updated=2024-06-15", "passport"},
+		{"updated!=2024-06-15", "aws-prod,aws-staging,bank"},
+		{"created<'2020-01-02'", "bank"},
+		{"updated<30d", "aws-prod,bank"},
+		{"updated>1y", "aws-staging,passport"},
+		{"accessed<7d", "aws-prod,bank,passport"},
+		{"accessed>7d", "aws-staging"},
+		{"strength=Strong", "aws-prod"},
+		{"strength='fair'", "bank"},
+		{"strength<Good", "bank"},
+		{"strength>=Fair", "aws-prod,bank"},
+		{"strength>Fair", "aws-prod"},
+		{"strength='very weak'", ""},
+		{"strength!=Strong", "bank"},
+		{"name~aws and tag=prod", "aws-prod"},
+		{"name~aws or name=bank", "aws-prod,aws-staging,bank"},
+		{"name=bank or name=passport and tag=prod", "bank,passport"},
+		{"(name=bank or name=passport) and tag=prod", "passport"},
+		{"not tag=prod", "aws-staging,bank"},
+		{"not not tag=prod", "aws-prod,passport"},
+		{"NOT (name~aws OR type=note)", "bank"},
+		{"name~aws AND NOT tag=staging", "aws-prod"},
+		{"name~'aws' and tag='prod' and updated<'2023-01-01' and strength<'Very Strong'", "aws-prod"},
+		{"name='it\\'s'", ""},
+		{"name = bank", "bank"},
+		{"  name=bank  ", "bank"},
+		{"((name=bank))", "bank"},
+	}
+
+	for _, tt := range tests {
+		q, err := parse(tt.expr, testNow)
+		if err != nil {
+			t.Errorf("parse(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		var names []string
+		for _, entry := range q.Apply(testEntries(), testGrades()) {
+			names = append(names, entry.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("%s matched %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"", 0, "empty expression"},
+		{"   ", 0, "empty expression"},
+		{"nme=bank", 0, "unknown field"},
+		{"name", 4, "expected an operator"},
+		{"name bank", 5, "expected an operator"},
+		{"name=", 5, "expected a value"},
+		{"name=(", 5, "expected a value"},
+		{"name='bank", 5, "unterminated string"},
+		{"name<bank", 4, "operator < does not apply to name"},
+		{"tag>=prod", 3, "operator >= does not apply to tag"},
+		{"type~no", 4, "operator ~ does not apply to type"},
+		{"updated~2023", 7, "operator ~ does not apply to updated"},
+		{"type=card", 5, "unknown entry type"},
+		{"updated<yesterday", 8, "invalid date"},
+		{"strength<ok", 9, "unknown strength level"},
+		{"name=bank and", 13, "expected a field name"},
+		{"name=bank tag=prod", 10, "expected and, or"},
+		{"(name=bank", 0, "unclosed parenthesis"},
+		{"(name=bank tag=x)", 11, "expected )"},
+		{"name=bank)", 9, "expected and, or"},
+		{"name!bank", 4, "unexpected"},
+		{"not", 3, "expected a field name"},
+		{"=bank", 0, "expected a field name"},
+		{"breach=true", 0, "unknown field"},
+	}
+
+	for _, tt := range tests {
+		_, err := parse(tt.expr, testNow)
+		var qerr *Error
+		if !errors.As(err, &qerr) {
+			t.Errorf("parse(%q) error = %v, want *Error", tt.expr, err)
+			continue
+		}
+		if qerr.Pos != tt.pos || !strings.Contains(qerr.Msg, tt.msg) {
+			t.Errorf("parse(%q) error = %q at %d, want %q at %d", tt.expr, qerr.Msg, qerr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestErrorPointer(t *testing.T) {
+	_, err := parse("name~aws and tg=prod", testNow)
+	var qerr *Error
+	if !errors.As(err, &qerr) {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	want := "name~aws and tg=prod\n             ^"
+	if got := qerr.Pointer("name~aws and tg=prod"); got != want {
+		t.Errorf("Pointer() = %q, want %q", got, want)
+	}
+	if !strings.Contains(qerr.Error(), "position 14") {
+		t.Errorf("Expected a 1-based position in %q", qerr.Error())
+	}
+}
+
+func TestNeedsPasswords(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"name~aws and tag=prod and updated<2023-01-01", false},
+		{"strength<Good", true},
+		{"name=bank or not (tag=x and strength=Weak)", true},
+	}
+	for _, tt := range tests {
+		q, err := parse(tt.expr, testNow)
+		if err != nil {
+			t.Fatalf("parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := q.NeedsPasswords(); got != tt.want {
+			t.Errorf("NeedsPasswords(%q) = %t, want %t", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"name~'aws' and tag='prod' and updated<'2023-01-01' and strength<'Good'",
+		"not (name=a or type=note)",
+		`name="a\"b"`,
+		"accessed>=90d",
+		"((",
+		"name='",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, expr string) {
+		q, err := parse(expr, testNow)
+		if err != nil {
+			var qerr *Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("parse(%q) returned %T, want *Error", expr, err)
+			}
+			if qerr.Pos < 0 || qerr.Pos > len(expr) {
+				t.Fatalf("parse(%q) error position %d out of range", expr, qerr.Pos)
+			}
+			qerr.Pointer(expr)
+			return
+		}
+		q.Apply(testEntries(), testGrades())
+	})
+}
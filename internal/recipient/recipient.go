@@ -0,0 +1,128 @@
+package recipient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+var (
+	// ErrNotARecipient is returned when none of the identities can unwrap
+	// a secret
+	ErrNotARecipient = errors.New("not a recipient of this entry")
+	// ErrNoIdentity is returned when a wrapped secret is read without any
+	// identity loaded
+	ErrNoIdentity = errors.New("entry is encrypted to recipients; an identity is required")
+)
+
+// ParseRecipients parses age public keys ("age1...")
+func ParseRecipients(keys []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", key, err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// NormalizeKeys validates keys and returns them trimmed and in order,
+// without blanks or duplicates
+func NormalizeKeys(keys []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		if _, err := age.ParseX25519Recipient(key); err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", key, err)
+		}
+		seen[key] = true
+		out = append(out, key)
+	}
+	return out, nil
+}
+
+// LoadIdentities reads an age identity file ("AGE-SECRET-KEY-1..." lines)
+func LoadIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// Wrap encrypts secret to every key in keys and returns it base64 encoded
+func Wrap(secret string, keys []string) (string, error) {
+	recipients, err := ParseRecipients(keys)
+	if err != nil {
+		return "", err
+	}
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("no recipients")
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt to recipients: %w", err)
+	}
+	if _, err := io.WriteString(w, secret); err != nil {
+		return "", fmt.Errorf("failed to encrypt to recipients: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt to recipients: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Unwrap decrypts a secret produced by Wrap with any of identities
+func Unwrap(wrapped string, identities []age.Identity) (string, error) {
+	secret, err := UnwrapBytes(wrapped, identities)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// UnwrapBytes decrypts like Unwrap, returning the secret as a byte slice
+// the caller can wipe
+func UnwrapBytes(wrapped string, identities []age.Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, ErrNoIdentity
+	}
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt wrapped secret: %w", err)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, ErrNotARecipient
+		}
+		return nil, fmt.Errorf("failed to decrypt wrapped secret: %w", err)
+	}
+	secret, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt wrapped secret: %w", err)
+	}
+	return secret, nil
+}
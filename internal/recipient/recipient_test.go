@@ -0,0 +1,76 @@
+package recipient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity failed: %v", err)
+	}
+	return id
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	alice, bob, mallory := newIdentity(t), newIdentity(t), newIdentity(t)
+
+	wrapped, err := Wrap("hunter2", []string{alice.Recipient().String(), bob.Recipient().String()})
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+
+	for _, id := range []age.Identity{alice, bob} {
+		secret, err := Unwrap(wrapped, []age.Identity{id})
+		if err != nil || secret != "hunter2" {
+			t.Errorf("Expected recipient to unwrap, got %q (%v)", secret, err)
+		}
+	}
+
+	if _, err := Unwrap(wrapped, []age.Identity{mallory}); !errors.Is(err, ErrNotARecipient) {
+		t.Errorf("Expected ErrNotARecipient, got %v", err)
+	}
+	if _, err := Unwrap(wrapped, nil); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("Expected ErrNoIdentity, got %v", err)
+	}
+}
+
+func TestNormalizeKeys(t *testing.T) {
+	key := newIdentity(t).Recipient().String()
+
+	keys, err := NormalizeKeys([]string{" " + key, key, ""})
+	if err != nil {
+		t.Fatalf("NormalizeKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Errorf("Expected a single trimmed key, got %v", keys)
+	}
+
+	if _, err := NormalizeKeys([]string{"alice"}); err == nil {
+		t.Error("Expected error for an invalid key")
+	}
+}
+
+func TestLoadIdentities(t *testing.T) {
+	id := newIdentity(t)
+	path := filepath.Join(t.TempDir(), "identity.txt")
+	if err := os.WriteFile(path, []byte("# comment\n"+id.String()+"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	identities, err := LoadIdentities(path)
+	if err != nil {
+		t.Fatalf("LoadIdentities failed: %v", err)
+	}
+	wrapped, _ := Wrap("s", []string{id.Recipient().String()})
+	if secret, err := Unwrap(wrapped, identities); err != nil || secret != "s" {
+		t.Errorf("Expected loaded identity to unwrap, got %q (%v)", secret, err)
+	}
+}
@@ -0,0 +1,189 @@
+package refresh
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+)
+
+// Store is the part of the database the refresher needs
+type Store interface {
+	StaleStrengthEntries(limit int) ([]*storage.PasswordEntry, error)
+	SetStrengthGrade(entryID int64, score int, level string) error
+}
+
+// Clock abstracts time so tests can drive the scheduler
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Config controls how much work the refresher does
+type Config struct {
+	Enabled   bool
+	Interval  time.Duration // time between wakes
+	BatchSize int           // entries fetched per wake
+	Budget    time.Duration // maximum time spent per wake
+}
+
+// DefaultConfig returns a conservative configuration: a small batch every
+// ten minutes, never more than 200ms of work at a time
+func DefaultConfig() Config {
+	return Config{
+		Enabled:   true,
+		Interval:  10 * time.Minute,
+		BatchSize: 20,
+		Budget:    200 * time.Millisecond,
+	}
+}
+
+// Status describes what the refresher has done so far
+type Status struct {
+	Enabled   bool
+	Refreshed int       // entries refreshed since start
+	LastRun   time.Time // zero if it never ran
+	LastBatch int       // entries refreshed by the last run
+	LastError error
+}
+
+// Refresher opportunistically refreshes cached strength grades while a
+// long-running process is idle and unlocked. It never runs while a
+// foreground request is active and stops for good once locked.
+type Refresher struct {
+	store   Store
+	clock   Clock
+	config  Config
+	analyze func(password string) (int, string)
+
+	mu      sync.Mutex
+	active  int
+	locked  bool
+	status  Status
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// New returns a refresher over store using the system clock
+func New(store Store, config Config) *Refresher {
+	return NewWithClock(store, config, systemClock{})
+}
+
+// NewWithClock returns a refresher driven by clock
+func NewWithClock(store Store, config Config, clock Clock) *Refresher {
+	return &Refresher{
+		store:   store,
+		clock:   clock,
+		config:  config,
+		analyze: analyzeStrength,
+		status:  Status{Enabled: config.Enabled},
+		stopped: make(chan struct{}),
+	}
+}
+
+// analyzeStrength grades a password with the generator's analyzer
+func analyzeStrength(password string) (int, string) {
+	analysis := generator.Analyze(password)
+	return analysis.Score, analysis.Level
+}
+
+// Begin marks the start of a foreground request; the refresher pauses
+// until the matching End
+func (r *Refresher) Begin() {
+	r.mu.Lock()
+	r.active++
+	r.mu.Unlock()
+}
+
+// End marks the end of a foreground request
+func (r *Refresher) End() {
+	r.mu.Lock()
+	if r.active > 0 {
+		r.active--
+	}
+	r.mu.Unlock()
+}
+
+// Lock stops the refresher; the key it worked with is about to be wiped
+func (r *Refresher) Lock() {
+	r.mu.Lock()
+	r.locked = true
+	r.mu.Unlock()
+	r.once.Do(func() { close(r.stopped) })
+}
+
+// Status returns a snapshot of the refresher's activity
+func (r *Refresher) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Run wakes every Interval and refreshes a batch until ctx is done or the
+// refresher is locked
+func (r *Refresher) Run(ctx context.Context) {
+	if !r.config.Enabled {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopped:
+			return
+		case <-r.clock.After(r.config.Interval):
+			r.Tick()
+		}
+	}
+}
+
+// Tick performs a single wake: it refreshes stale entries, oldest cache
+// first, until the batch is done or the time budget is spent. It does
+// nothing while disabled, locked or busy with a foreground request.
+func (r *Refresher) Tick() int {
+	r.mu.Lock()
+	idle := r.config.Enabled && !r.locked && r.active == 0
+	r.mu.Unlock()
+	if !idle {
+		return 0
+	}
+
+	start := r.clock.Now()
+	entries, err := r.store.StaleStrengthEntries(r.config.BatchSize)
+
+	refreshed := 0
+	for _, entry := range entries {
+		if err != nil || !r.mayContinue(start) {
+			break
+		}
+		score, level := r.analyze(entry.Password)
+		entry.Password = ""
+		err = r.store.SetStrengthGrade(entry.ID, score, level)
+		if err == nil {
+			refreshed++
+		}
+	}
+
+	r.mu.Lock()
+	r.status.Refreshed += refreshed
+	r.status.LastRun = start
+	r.status.LastBatch = refreshed
+	r.status.LastError = err
+	r.mu.Unlock()
+	return refreshed
+}
+
+// mayContinue reports whether the current wake may process another entry
+func (r *Refresher) mayContinue(start time.Time) bool {
+	r.mu.Lock()
+	busy := r.locked || r.active > 0
+	r.mu.Unlock()
+	return !busy && r.clock.Now().Sub(start) < r.config.Budget
+}
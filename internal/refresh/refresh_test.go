@@ -0,0 +1,177 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"password-manager/internal/storage"
+)
+
+// fakeClock advances only when told to
+type fakeClock struct {
+	now   time.Time
+	after chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:   time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC),
+		after: make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) Now() time.Time                         { return c.now }
+func (c *fakeClock) After(d time.Duration) <-chan time.Time { return c.after }
+
+// fakeStore serves entries in order and records cached grades
+type fakeStore struct {
+	stale    []*storage.PasswordEntry
+	grades   map[int64]string
+	onSet    func()
+	staleErr error
+}
+
+func newFakeStore(n int) *fakeStore {
+	s := &fakeStore{grades: make(map[int64]string)}
+	for i := 1; i <= n; i++ {
+		s.stale = append(s.stale, &storage.PasswordEntry{ID: int64(i), Password: "password"})
+	}
+	return s
+}
+
+func (s *fakeStore) StaleStrengthEntries(limit int) ([]*storage.PasswordEntry, error) {
+	if s.staleErr != nil {
+		return nil, s.staleErr
+	}
+	var out []*storage.PasswordEntry
+	for _, e := range s.stale {
+		if _, done := s.grades[e.ID]; !done && len(out) < limit {
+			out = append(out, &storage.PasswordEntry{ID: e.ID, Password: e.Password})
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) SetStrengthGrade(entryID int64, score int, level string) error {
+	s.grades[entryID] = level
+	if s.onSet != nil {
+		s.onSet()
+	}
+	return nil
+}
+
+func testConfig() Config {
+	return Config{Enabled: true, Interval: time.Minute, BatchSize: 3, Budget: time.Second}
+}
+
+func TestTickProcessesBatch(t *testing.T) {
+	store := newFakeStore(5)
+	clock := newFakeClock()
+	r := NewWithClock(store, testConfig(), clock)
+
+	if n := r.Tick(); n != 3 {
+		t.Errorf("Expected first wake to refresh a batch of 3, got %d", n)
+	}
+	if n := r.Tick(); n != 2 {
+		t.Errorf("Expected second wake to refresh the remaining 2, got %d", n)
+	}
+	if n := r.Tick(); n != 0 {
+		t.Errorf("Expected nothing left to refresh, got %d", n)
+	}
+
+	status := r.Status()
+	if status.Refreshed != 5 || status.LastBatch != 0 || !status.LastRun.Equal(clock.now) {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestTickRespectsBudget(t *testing.T) {
+	store := newFakeStore(10)
+	clock := newFakeClock()
+	config := testConfig()
+	config.BatchSize = 10
+	r := NewWithClock(store, config, clock)
+
+	// Every analysis takes 400ms of the 1s budget
+	store.onSet = func() { clock.now = clock.now.Add(400 * time.Millisecond) }
+
+	if n := r.Tick(); n != 3 {
+		t.Errorf("Expected the budget to stop the wake after 3 entries, got %d", n)
+	}
+}
+
+func TestTickPausesDuringForegroundRequest(t *testing.T) {
+	store := newFakeStore(5)
+	r := NewWithClock(store, testConfig(), newFakeClock())
+
+	r.Begin()
+	if n := r.Tick(); n != 0 {
+		t.Errorf("Expected no work during a foreground request, got %d", n)
+	}
+
+	// A request starting mid-wake stops the batch
+	r.End()
+	store.onSet = func() { r.Begin() }
+	if n := r.Tick(); n != 1 {
+		t.Errorf("Expected the wake to stop after the request began, got %d", n)
+	}
+}
+
+func TestTickStopsWhenLocked(t *testing.T) {
+	store := newFakeStore(5)
+	r := NewWithClock(store, testConfig(), newFakeClock())
+
+	r.Lock()
+	if n := r.Tick(); n != 0 {
+		t.Errorf("Expected no work once locked, got %d", n)
+	}
+}
+
+func TestTickDisabled(t *testing.T) {
+	config := testConfig()
+	config.Enabled = false
+	r := NewWithClock(newFakeStore(5), config, newFakeClock())
+
+	if n := r.Tick(); n != 0 {
+		t.Errorf("Expected no work when disabled, got %d", n)
+	}
+	if r.Status().Enabled {
+		t.Error("Expected status to report disabled")
+	}
+}
+
+func TestTickRecordsErrors(t *testing.T) {
+	store := newFakeStore(1)
+	store.staleErr = errors.New("boom")
+	r := NewWithClock(store, testConfig(), newFakeClock())
+
+	r.Tick()
+	if r.Status().LastError == nil {
+		t.Error("Expected the error to be recorded")
+	}
+}
+
+func TestRunWakesOnInterval(t *testing.T) {
+	store := newFakeStore(5)
+	clock := newFakeClock()
+	r := NewWithClock(store, testConfig(), clock)
+
+	done := make(chan struct{})
+	go func() {
+		r.Run(context.Background())
+		close(done)
+	}()
+
+	// The third wake is only received once the second has finished
+	clock.after <- clock.now
+	clock.after <- clock.now
+	clock.after <- clock.now
+	r.Lock()
+	<-done
+
+	if len(store.grades) != 5 {
+		t.Errorf("Expected two wakes to refresh all 5 entries, got %d", len(store.grades))
+	}
+}
@@ -0,0 +1,59 @@
+package reminder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"password-manager/internal/duration"
+)
+
+// DigestExpiryWindow is how far ahead a digest looks for expiring entries
+const DigestExpiryWindow = 30 * 24 * time.Hour
+
+// Digest counts what happened to a vault while this device did not have it
+// open. Like Summary it is built from cheap metadata queries.
+type Digest struct {
+	// LastSeen is when this device last had the vault open, and Now when
+	// it is opened again
+	LastSeen, Now time.Time
+	// Changed is the number of entries created or updated in between, so
+	// on another device or through a synced copy
+	Changed int
+	// Backups is the number of backups taken in between
+	Backups int
+	// Expiring is the number of entries expiring within
+	// DigestExpiryWindow
+	Expiring int
+}
+
+// Empty reports whether there is nothing to tell
+func (d Digest) Empty() bool {
+	return d.Changed == 0 && d.Backups == 0 && d.Expiring == 0
+}
+
+// DigestMessage renders a digest as two lines such as
+//
+//	Since your last unlock on this device 6 days ago:
+//	3 entries modified on another device, 1 backup taken, 2 entries now expiring within 30 days.
+//
+// or "" when it is empty or the device never had the vault open
+func DigestMessage(d Digest) string {
+	if d.Empty() || d.LastSeen.IsZero() {
+		return ""
+	}
+	var parts []string
+	if d.Changed > 0 {
+		parts = append(parts, fmt.Sprintf("%s modified on another device", entries(d.Changed)))
+	}
+	if d.Backups == 1 {
+		parts = append(parts, "1 backup taken")
+	} else if d.Backups > 1 {
+		parts = append(parts, fmt.Sprintf("%d backups taken", d.Backups))
+	}
+	if d.Expiring > 0 {
+		parts = append(parts, fmt.Sprintf("%s now expiring within %d days", entries(d.Expiring), int(DigestExpiryWindow/(24*time.Hour))))
+	}
+	return fmt.Sprintf("Since your last unlock on this device %s:\n%s.\n",
+		duration.Humanize(d.LastSeen, d.Now), strings.Join(parts, ", "))
+}
@@ -0,0 +1,105 @@
+package reminder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RotateTag is the tag that marks entries waiting to be rotated
+const RotateTag = "todo-rotate"
+
+// Summary counts the items a reminder points out. It is built from cheap
+// metadata queries; no password is needed.
+type Summary struct {
+	// TodoRotate is the number of entries tagged RotateTag
+	TodoRotate int
+	// Expiring is the number of entries expiring soon and NextExpiry the
+	// time left until the first of them expires
+	Expiring   int
+	NextExpiry time.Duration
+}
+
+// Empty reports whether there is nothing to remind about
+func (s Summary) Empty() bool {
+	return s.TodoRotate == 0 && s.Expiring == 0
+}
+
+// Message renders a summary as one line such as "3 entries tagged
+// todo-rotate, 1 entry expires in 5 days", or "" when it is empty
+func Message(s Summary) string {
+	var parts []string
+	if s.TodoRotate > 0 {
+		parts = append(parts, fmt.Sprintf("%s tagged %s", entries(s.TodoRotate), RotateTag))
+	}
+	if s.Expiring == 1 {
+		parts = append(parts, fmt.Sprintf("1 entry expires %s", within(s.NextExpiry)))
+	} else if s.Expiring > 1 {
+		parts = append(parts, fmt.Sprintf("%s expire soon, the first %s", entries(s.Expiring), within(s.NextExpiry)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func entries(n int) string {
+	if n == 1 {
+		return "1 entry"
+	}
+	return fmt.Sprintf("%d entries", n)
+}
+
+// within renders the time until an expiry in whole days
+func within(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	switch {
+	case d <= 0:
+		return "today"
+	case days <= 1:
+		return "within a day"
+	}
+	return fmt.Sprintf("in %d days", days)
+}
+
+// Tracker remembers per vault on which day a reminder was last shown, so
+// it is shown at most once a day. State lives in files under dir named
+// after a hash of the vault path.
+type Tracker struct {
+	dir string
+}
+
+// NewTracker returns a tracker keeping its state in dir
+func NewTracker(dir string) *Tracker {
+	return &Tracker{dir: dir}
+}
+
+// path returns the state file of a vault
+func (t *Tracker) path(vaultPath string) string {
+	if abs, err := filepath.Abs(vaultPath); err == nil {
+		vaultPath = abs
+	}
+	sum := sha256.Sum256([]byte(vaultPath))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:8]))
+}
+
+// Due reports whether no reminder was shown for the vault today
+func (t *Tracker) Due(vaultPath string, now time.Time) bool {
+	data, err := os.ReadFile(t.path(vaultPath))
+	if err != nil {
+		return true
+	}
+	return strings.TrimSpace(string(data)) != now.Format("2006-01-02")
+}
+
+// MarkShown records that a reminder was shown for the vault today
+func (t *Tracker) MarkShown(vaultPath string, now time.Time) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create reminder directory: %w", err)
+	}
+	if err := os.WriteFile(t.path(vaultPath), []byte(now.Format("2006-01-02")+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to record reminder: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package reminder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		summary Summary
+		want    string
+	}{
+		{Summary{}, ""},
+		{Summary{TodoRotate: 1}, "1 entry tagged todo-rotate"},
+		{Summary{TodoRotate: 3}, "3 entries tagged todo-rotate"},
+		{Summary{Expiring: 1, NextExpiry: 5 * day}, "1 entry expires in 5 days"},
+		{Summary{Expiring: 1, NextExpiry: 5*day + time.Hour}, "1 entry expires in 5 days"},
+		{Summary{Expiring: 1, NextExpiry: 20 * time.Hour}, "1 entry expires within a day"},
+		{Summary{Expiring: 1, NextExpiry: 0}, "1 entry expires today"},
+		{Summary{Expiring: 1, NextExpiry: -day}, "1 entry expires today"},
+		{Summary{Expiring: 4, NextExpiry: 2 * day}, "4 entries expire soon, the first in 2 days"},
+		{Summary{TodoRotate: 3, Expiring: 1, NextExpiry: 5 * day}, "3 entries tagged todo-rotate, 1 entry expires in 5 days"},
+		{Summary{TodoRotate: 1, Expiring: 2, NextExpiry: 0}, "1 entry tagged todo-rotate, 2 entries expire soon, the first today"},
+	}
+
+	for _, tt := range tests {
+		if got := Message(tt.summary); got != tt.want {
+			t.Errorf("Message(%+v) = %q, want %q", tt.summary, got, tt.want)
+		}
+		if tt.summary.Empty() != (tt.want == "") {
+			t.Errorf("Empty(%+v) = %t", tt.summary, tt.summary.Empty())
+		}
+	}
+}
+
+func TestTrackerOncePerDayPerVault(t *testing.T) {
+	tracker := NewTracker(filepath.Join(t.TempDir(), "reminders"))
+	today := time.Date(2024, 6, 15, 9, 0, 0, 0, time.Local)
+
+	if !tracker.Due("/vaults/a.db", today) {
+		t.Fatal("Expected a reminder to be due before any was shown")
+	}
+	if err := tracker.MarkShown("/vaults/a.db", today); err != nil {
+		t.Fatalf("MarkShown failed: %v", err)
+	}
+	if tracker.Due("/vaults/a.db", today.Add(8*time.Hour)) {
+		t.Error("Expected no second reminder on the same day")
+	}
+	if !tracker.Due("/vaults/b.db", today) {
+		t.Error("Expected another vault to keep its own schedule")
+	}
+	if !tracker.Due("/vaults/a.db", today.AddDate(0, 0, 1)) {
+		t.Error("Expected a reminder to be due the next day")
+	}
+}
+
+// TestDigestMessageGolden compares the phrasing of digests with the
+// .golden files of testdata
+func TestDigestMessageGolden(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		golden string
+		digest Digest
+	}{
+		{"empty.golden", Digest{LastSeen: now.Add(-6 * day), Now: now}},
+		{"singular.golden", Digest{LastSeen: now.Add(-day), Now: now, Changed: 1, Backups: 1, Expiring: 1}},
+		{"plural.golden", Digest{LastSeen: now.Add(-6 * day), Now: now, Changed: 3, Backups: 2, Expiring: 2}},
+		{"backups_only.golden", Digest{LastSeen: now.Add(-3 * time.Hour), Now: now, Backups: 2}},
+	}
+	for _, tt := range tests {
+		want, err := os.ReadFile(filepath.Join("testdata", "digest", tt.golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := DigestMessage(tt.digest); got != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.golden, got, want)
+		}
+	}
+
+	// A device opening the vault for the first time has nothing to
+	// compare with
+	if got := DigestMessage(Digest{Now: now, Changed: 3}); got != "" {
+		t.Errorf("Expected no digest without a last unlock, got %q", got)
+	}
+}
@@ -0,0 +1,160 @@
+package secretscan
+
+import (
+	"net/url"
+	"strings"
+
+	"password-manager/internal/storage"
+)
+
+// The fields of an entry that are scanned. The notes of a secure note
+// are its secret and are left alone.
+const (
+	FieldUsername = "username"
+	FieldURL      = "url"
+	FieldNotes    = "notes"
+)
+
+// Finding is a secret found in a field of an entry
+type Finding struct {
+	Field string
+	Match
+}
+
+// Entry returns the secrets in the username, URL and, for logins, notes
+// of entry
+func Entry(entry *storage.PasswordEntry) []Finding {
+	var findings []Finding
+	add := func(field string, matches []Match) {
+		for _, m := range matches {
+			findings = append(findings, Finding{Field: field, Match: m})
+		}
+	}
+	add(FieldUsername, Text(entry.Username))
+	add(FieldURL, URL(entry.URL))
+	if !entry.IsNote() {
+		add(FieldNotes, Text(entry.Notes))
+	}
+	return findings
+}
+
+// field returns the value of the field of f in entry, to be changed
+// through the pointer
+func (f Finding) field(entry *storage.PasswordEntry) *string {
+	switch f.Field {
+	case FieldUsername:
+		return &entry.Username
+	case FieldURL:
+		return &entry.URL
+	}
+	return &entry.Notes
+}
+
+// Secret returns the secret f found in entry, decoded if it was in a URL.
+// It is for moving the secret, not for showing it.
+func (f Finding) Secret(entry *storage.PasswordEntry) string {
+	value := (*f.field(entry))[f.Start:f.End]
+	switch f.Kind {
+	case KindURLPassword:
+		if decoded, err := url.PathUnescape(value); err == nil {
+			return decoded
+		}
+	case KindURLSecret:
+		if decoded, err := url.QueryUnescape(value); err == nil {
+			return decoded
+		}
+	}
+	if f.Field == FieldURL && strings.Contains(value, "%") {
+		if decoded, err := url.QueryUnescape(value); err == nil {
+			return decoded
+		}
+	}
+	return value
+}
+
+// Move takes the secret of f out of its field of entry and makes it the
+// password. From a URL, the password is cut from the user info and a
+// query parameter is dropped whole; from text, the secret is cut along
+// with a label such as "password:" before it and any line left empty.
+// Other findings in the same field are no longer where they were once
+// one has been moved, so the entry should be scanned again.
+func Move(entry *storage.PasswordEntry, f Finding) {
+	secret := f.Secret(entry)
+	value := f.field(entry)
+	if f.Field == FieldURL {
+		*value = cutFromURL(*value, f.Match)
+	} else {
+		*value = cutFromText(*value, f.Match)
+	}
+	entry.Password = secret
+}
+
+// cutFromURL removes the secret of m from the URL s
+func cutFromURL(s string, m Match) string {
+	if m.Kind == KindURLPassword {
+		// The colon before the password goes with it
+		return s[:m.Start-1] + s[m.End:]
+	}
+	// A query value: drop the parameter and one of the & around it, and
+	// the ? if no parameter is left
+	start := strings.LastIndexAny(s[:m.Start], "?&") + 1
+	end := m.End
+	switch {
+	case end < len(s) && s[end] == '&':
+		end++
+	case s[start-1] == '&':
+		start--
+	case end == len(s) || s[end] == '#':
+		start--
+	}
+	return s[:start] + s[end:]
+}
+
+// cutFromText removes the secret of m from s, with a label just before
+// it, and the line it was on if nothing else is left there
+func cutFromText(s string, m Match) string {
+	start, end := m.Start, m.End
+	base := lineStart(s, start)
+	for _, loc := range labelled.FindAllStringSubmatchIndex(s[base:end], -1) {
+		if valueStart, _ := trimToken(s, base+loc[2], base+loc[3]); valueStart == m.Start {
+			start = base + loc[0]
+		}
+	}
+	// A label glued to the secret, as in key=..., was trimmed off the
+	// token the secret was found in
+	if token := strings.LastIndexAny(s[:start], " \t\n") + 1; token < start {
+		if valueStart, _ := trimToken(s, token, end); valueStart == start {
+			start = token
+		}
+	}
+	before, after := s[:start], s[end:]
+
+	lineBefore := before[lineStart(before, len(before)):]
+	lineAfter := after
+	if i := strings.IndexByte(after, '\n'); i >= 0 {
+		lineAfter = after[:i]
+	}
+	if strings.TrimSpace(lineBefore) == "" && strings.TrimSpace(lineAfter) == "" {
+		// Drop the whole line with its line break
+		before = before[:len(before)-len(lineBefore)]
+		after = after[len(lineAfter):]
+		if strings.HasPrefix(after, "\n") {
+			after = after[1:]
+		} else {
+			before = strings.TrimSuffix(before, "\n")
+		}
+		return before + after
+	}
+	// Close the gap, keeping one space between the words around it
+	before = strings.TrimRight(before, " \t")
+	after = strings.TrimLeft(after, " \t")
+	if before != "" && after != "" && !strings.HasSuffix(before, "\n") && !strings.HasPrefix(after, "\n") {
+		return before + " " + after
+	}
+	return before + after
+}
+
+// lineStart returns where the line holding byte i of s starts
+func lineStart(s string, i int) int {
+	return strings.LastIndexByte(s[:i], '\n') + 1
+}
@@ -0,0 +1,284 @@
+// Package secretscan finds secrets pasted into the fields of an entry
+// that are not kept secret, such as a password in the notes of a login
+// or an API key in its URL. The detectors are heuristics over the text
+// alone. They report where a secret seems to be and what kind it is,
+// never the value, so findings can be printed and logged.
+package secretscan
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kinds of secrets the detectors tell apart
+const (
+	KindPrivateKey  = "private key"
+	KindAWSKey      = "AWS access key"
+	KindGitHubToken = "GitHub token"
+	KindJWT         = "JSON web token"
+	KindLabelled    = "labelled password"
+	KindURLPassword = "password in URL"
+	KindURLSecret   = "secret in URL query"
+	KindHighEntropy = "high-entropy token"
+)
+
+// Match is a secret found in a text, at the bytes [Start, End)
+type Match struct {
+	Kind  string
+	Start int
+	End   int
+}
+
+// patterns are the detectors of well-known secret formats, in order of
+// precedence when two overlap
+var patterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	// Up to the end marker, or the end of the text if it was cut off
+	{KindPrivateKey, regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----(?s:.*?)(?:-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----|\z)`)},
+	{KindAWSKey, regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{KindGitHubToken, regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{50,255})\b`)},
+	{KindJWT, regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]*`)},
+}
+
+// labelled finds a word given as a password, as in "password: hunter2";
+// the first group is the value
+var labelled = regexp.MustCompile(`(?i)\b(?:password|passwd|passphrase|pwd|pw|pin|secret|api[ _-]?key|token)\s*[:=]\s*(\S+)`)
+
+// minLabelled is the length from which a labelled word counts as a
+// password, so "PIN: 1234" does and "password: see" does not
+const minLabelled = 4
+
+// secretParams are the URL query parameters that carry secrets, compared
+// in lower case with - and _ left out
+var secretParams = map[string]bool{
+	"password": true, "passwd": true, "pwd": true, "pass": true, "secret": true,
+	"token": true, "accesstoken": true, "authtoken": true, "apikey": true,
+	"key": true, "clientsecret": true, "auth": true,
+}
+
+// Text returns the secrets in s, ordered by where they start. Matches of
+// the known formats win over the looser ones they overlap.
+func Text(s string) []Match {
+	var matches []Match
+	for _, p := range patterns {
+		for _, loc := range p.re.FindAllStringIndex(s, -1) {
+			matches = addMatch(matches, Match{p.kind, loc[0], loc[1]})
+		}
+	}
+	for _, loc := range labelled.FindAllStringSubmatchIndex(s, -1) {
+		start, end := trimToken(s, loc[2], loc[3])
+		if utf8.RuneCountInString(s[start:end]) >= minLabelled {
+			matches = addMatch(matches, Match{KindLabelled, start, end})
+		}
+	}
+	for _, loc := range tokens(s) {
+		start, end := trimToken(s, loc[0], loc[1])
+		if start < end && HighEntropy(s[start:end]) {
+			matches = addMatch(matches, Match{KindHighEntropy, start, end})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// URL returns the secrets in a URL: a password in its user info, and the
+// values of query parameters named like secrets or holding one. A value
+// that is not a URL is scanned as text.
+func URL(s string) []Match {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return Text(s)
+	}
+
+	var matches []Match
+	// The user info ends at the first @ after the scheme
+	if _, set := u.User.Password(); set {
+		begin := strings.Index(s, "//") + 2
+		at := begin + strings.Index(s[begin:], "@")
+		if colon := strings.Index(s[begin:at], ":"); colon >= 0 {
+			matches = append(matches, Match{KindURLPassword, begin + colon + 1, at})
+		}
+	}
+	if q := strings.Index(s, "?"); q >= 0 {
+		offset := q + 1
+		query := s[offset:]
+		if hash := strings.Index(query, "#"); hash >= 0 {
+			query = query[:hash]
+		}
+		for _, param := range strings.Split(query, "&") {
+			key, value, found := strings.Cut(param, "=")
+			start := offset + len(key) + 1
+			offset += len(param) + 1
+			if !found || value == "" {
+				continue
+			}
+			name := strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+			if secretParams[name] {
+				matches = append(matches, Match{KindURLSecret, start, start + len(value)})
+				continue
+			}
+			decoded, err := url.QueryUnescape(value)
+			if err != nil {
+				decoded = value
+			}
+			// Where a secret starts in the decoded value is not where it
+			// does in the URL, so the whole value is reported
+			if found := Text(decoded); len(found) > 0 {
+				matches = append(matches, Match{found[0].Kind, start, start + len(value)})
+			}
+		}
+	}
+	return matches
+}
+
+// addMatch adds m to matches unless it overlaps one of them
+func addMatch(matches []Match, m Match) []Match {
+	for _, other := range matches {
+		if m.Start < other.End && other.Start < m.End {
+			return matches
+		}
+	}
+	return append(matches, m)
+}
+
+// tokens returns the spans of the words of s, split at whitespace
+func tokens(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// label is a word such as "key=" or "pin:" leading a token
+var label = regexp.MustCompile(`^[A-Za-z][A-Za-z_-]{0,19}[:=]`)
+
+// trimToken narrows the token s[start:end] to what could be a secret:
+// without a leading label or the quotes, brackets and punctuation that
+// surround words in prose
+func trimToken(s string, start, end int) (int, int) {
+	if loc := label.FindStringIndex(s[start:end]); loc != nil {
+		start += loc[1]
+	}
+	for start < end && strings.ContainsRune(`"'([{<`, rune(s[start])) {
+		start++
+	}
+	for start < end && strings.ContainsRune(`"')]}>,.;:`, rune(s[end-1])) {
+		end--
+	}
+	return start, end
+}
+
+// MinEntropyBits is the least Shannon entropy, over the whole token, of a
+// token HighEntropy reports
+const MinEntropyBits = 40
+
+// HighEntropy reports whether token looks like a random secret rather
+// than a word, number or identifier: at least 12 characters in more than
+// one class with a digit or symbol among them, carrying MinEntropyBits.
+// URLs, email addresses, paths, UUIDs, numbers, dates and versions are
+// left out, and so are identifiers such as snake_case or release-2024-01
+// whose parts are each letters or digits.
+func HighEntropy(token string) bool {
+	n := utf8.RuneCountInString(token)
+	if n < 12 || n > 512 {
+		return false
+	}
+	if strings.Contains(token, "://") || email.MatchString(token) || uuid.MatchString(token) ||
+		numeric.MatchString(token) || version.MatchString(token) || path.MatchString(token) || identifier(token) {
+		return false
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range token {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, set := range []bool{lower, upper, digit, symbol} {
+		if set {
+			classes++
+		}
+	}
+	if classes < 2 || !(digit || symbol) {
+		return false
+	}
+	return entropy(token)*float64(n) >= MinEntropyBits
+}
+
+var (
+	email   = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	uuid    = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+	numeric = regexp.MustCompile(`^[0-9+()./:-]+$`)
+	version = regexp.MustCompile(`^[vV]?[0-9]+(?:\.[0-9]+)+(?:[-+][0-9A-Za-z.-]+)?$`)
+	path    = regexp.MustCompile(`^(?:~?/|\./|\.\./|[A-Za-z]:\\)`)
+)
+
+// identifier reports whether token is made of parts joined by - _ or .
+// that are each all letters or all digits
+func identifier(token string) bool {
+	parts := strings.FieldsFunc(token, func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	if len(parts) == 0 {
+		return false
+	}
+	for _, part := range parts {
+		letters, digits := 0, 0
+		for _, r := range part {
+			switch {
+			case unicode.IsLetter(r):
+				letters++
+			case unicode.IsDigit(r):
+				digits++
+			default:
+				return false
+			}
+		}
+		if letters > 0 && digits > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// entropy returns the Shannon entropy of the characters of s in bits per
+// character
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var bits float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
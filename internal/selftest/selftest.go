@@ -0,0 +1,267 @@
+package selftest
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/generator"
+	"password-manager/internal/storage"
+)
+
+// vectorsJSON holds the known-answer vectors, one for each supported
+// pairing of KDF and cipher
+//
+//go:embed vectors.json
+var vectorsJSON []byte
+
+// vector is a known answer: key is what the KDF derives from password and
+// salt with params, and ciphertext and tag are plaintext sealed under it with nonce.
+// hash is what HashPassword gives for password with the same salt.
+type vector struct {
+	KDF        string           `json:"kdf"`
+	Params     crypto.KDFParams `json:"params"`
+	Cipher     string           `json:"cipher"`
+	Password   string           `json:"password"`
+	Salt       []byte           `json:"salt"`
+	Key        []byte           `json:"key"`
+	Nonce      []byte           `json:"nonce"`
+	Ciphertext []byte           `json:"ciphertext"`
+	Tag        []byte           `json:"tag"`
+	Plaintext  string           `json:"plaintext"`
+	Hash       string           `json:"hash"`
+}
+
+// Check is one section of the self-test
+type Check struct {
+	Name string
+	Run  func() error
+}
+
+// Checks are the sections of the self-test, in the order they run. None
+// of them touches the vault on disk.
+var Checks = []Check{
+	{"known-answer vectors", checkVectors},
+	{"encryption round trip", checkRoundTrip},
+	{"password hashing", checkHashing},
+	{"randomness", crypto.CheckRandomness},
+	{"storage", checkStorage},
+	{"generator", checkGenerator},
+}
+
+// Run runs every check, writing PASS or FAIL for each to w, and reports
+// whether all of them passed
+func Run(w io.Writer) bool {
+	ok := true
+	for _, check := range Checks {
+		if err := check.Run(); err != nil {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", check.Name, err)
+			ok = false
+			continue
+		}
+		fmt.Fprintf(w, "PASS  %s\n", check.Name)
+	}
+	return ok
+}
+
+func loadVectors() ([]vector, error) {
+	var vectors []vector
+	if err := json.Unmarshal(vectorsJSON, &vectors); err != nil {
+		return nil, fmt.Errorf("failed to read vectors: %w", err)
+	}
+	return vectors, nil
+}
+
+// checkVectors derives and decrypts every vector, and fails if a supported
+// KDF or cipher has none
+func checkVectors() error {
+	vectors, err := loadVectors()
+	if err != nil {
+		return err
+	}
+	covered := make(map[string]bool)
+	for _, v := range vectors {
+		covered[v.KDF] = true
+		covered[v.Cipher] = true
+		if err := checkVector(v); err != nil {
+			return fmt.Errorf("%s/%s: %w", v.KDF, v.Cipher, err)
+		}
+	}
+	for _, name := range append(append([]string{}, storage.KDFs...), storage.Ciphers...) {
+		if !covered[name] {
+			return fmt.Errorf("no vector for %s", name)
+		}
+	}
+	return nil
+}
+
+func checkVector(v vector) error {
+	key, err := crypto.DeriveKeyWithParams(v.Password, v.Salt, v.Params)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, v.Key) {
+		return fmt.Errorf("derived key does not match")
+	}
+	plaintext, err := crypto.Decrypt(&crypto.EncryptedData{
+		Salt:       v.Salt,
+		Nonce:      v.Nonce,
+		Ciphertext: v.Ciphertext,
+		Tag:        v.Tag,
+		KDF:        &v.Params,
+	}, v.Password)
+	if err != nil {
+		return err
+	}
+	if plaintext != v.Plaintext {
+		return fmt.Errorf("decrypted %q, want %q", plaintext, v.Plaintext)
+	}
+	return nil
+}
+
+// checkRoundTrip encrypts and decrypts under fresh salts and nonces, and
+// checks that a wrong password or a changed ciphertext is refused
+func checkRoundTrip() error {
+	const plaintext, password = "round trip ✓", "self-test"
+	first, err := crypto.Encrypt(plaintext, password)
+	if err != nil {
+		return err
+	}
+	second, err := crypto.Encrypt(plaintext, password)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(first.Salt, second.Salt) || bytes.Equal(first.Nonce, second.Nonce) {
+		return fmt.Errorf("salt or nonce repeated between encryptions")
+	}
+	decrypted, err := crypto.Decrypt(first, password)
+	if err != nil {
+		return err
+	}
+	if decrypted != plaintext {
+		return fmt.Errorf("decrypted %q, want %q", decrypted, plaintext)
+	}
+	if _, err := crypto.Decrypt(first, "wrong"); err == nil {
+		return fmt.Errorf("decrypted with the wrong password")
+	}
+	first.Ciphertext[0] ^= 1
+	if _, err := crypto.Decrypt(first, password); err == nil {
+		return fmt.Errorf("decrypted a tampered ciphertext")
+	}
+	return nil
+}
+
+// checkHashing verifies the known hashes and a fresh one
+func checkHashing() error {
+	vectors, err := loadVectors()
+	if err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		if err := verifyHash(v.Password, v.Hash); err != nil {
+			return fmt.Errorf("known hash: %w", err)
+		}
+	}
+	hash, err := crypto.HashPassword("self-test")
+	if err != nil {
+		return err
+	}
+	return verifyHash("self-test", hash)
+}
+
+func verifyHash(password, hash string) error {
+	ok, err := crypto.VerifyPassword(password, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("password not verified against its hash")
+	}
+	if ok, _ := crypto.VerifyPassword(password+"x", hash); ok {
+		return fmt.Errorf("wrong password verified")
+	}
+	return nil
+}
+
+// checkStorage saves, reads, updates, searches and deletes an entry in a
+// vault held in memory
+func checkStorage() error {
+	db, err := storage.CreateMemory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	entry := &storage.PasswordEntry{
+		Name:     "selftest",
+		Username: "someone",
+		Password: "Self-Test-1 ✓",
+		URL:      "https://example.com",
+	}
+	if err := db.SavePassword(entry); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if err := expectPassword(db, entry.Name, entry.Password); err != nil {
+		return err
+	}
+
+	entry.Password = "Self-Test-2 ✓"
+	if err := db.UpdatePassword(entry); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	if err := expectPassword(db, entry.Name, entry.Password); err != nil {
+		return err
+	}
+
+	found, err := db.SearchPasswords("selftest")
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	if len(found) != 1 || found[0].Name != entry.Name {
+		return fmt.Errorf("search found %d entries, want 1", len(found))
+	}
+
+	if err := db.DeletePassword(entry.Name); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if _, err := db.GetPassword(entry.Name); err == nil {
+		return fmt.Errorf("entry still there after delete")
+	}
+	return nil
+}
+
+func expectPassword(db *storage.Database, name, password string) error {
+	got, err := db.GetPassword(name)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if got.Password != password {
+		return fmt.Errorf("get returned a different password")
+	}
+	return nil
+}
+
+// checkGenerator generates a long password and checks that it has every
+// class it was asked for and is rated at least Very Strong
+func checkGenerator() error {
+	config := generator.DefaultConfig()
+	config.Length = 128
+	password, err := generator.GeneratePassword(config)
+	if err != nil {
+		return err
+	}
+	if len(password) != config.Length {
+		return fmt.Errorf("generated %d characters, want %d", len(password), config.Length)
+	}
+	if missing := generator.MissingClasses(password, config); len(missing) > 0 {
+		return fmt.Errorf("generated password has no %s", strings.Join(missing, ", "))
+	}
+	if analysis := generator.Analyze(password); analysis.Score < 6 {
+		return fmt.Errorf("generated password rated %s", analysis.Level)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package selftest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var out strings.Builder
+	if !Run(&out) {
+		t.Fatalf("Expected the self-test to pass, got:\n%s", out.String())
+	}
+	if got := strings.Count(out.String(), "PASS"); got != len(Checks) {
+		t.Errorf("Expected %d PASS lines, got:\n%s", len(Checks), out.String())
+	}
+}
+
+func TestVectorDetectsMismatch(t *testing.T) {
+	vectors, err := loadVectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := vectors[0]
+	v.Plaintext += "!"
+	if err := checkVector(v); err == nil {
+		t.Error("Expected a wrong plaintext to fail the vector")
+	}
+	v = vectors[0]
+	v.Key = append([]byte{}, v.Key...)
+	v.Key[0] ^= 1
+	if err := checkVector(v); err == nil {
+		t.Error("Expected a wrong key to fail the vector")
+	}
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// Audit findings an entry can be acknowledged for
+const (
+	// FindingWeak is a password scoring below Good
+	FindingWeak = "weak"
+	// FindingReused is a password other entries have too
+	FindingReused = "reused"
+	// FindingStale is a password left unchanged for longer than the
+	// audit allows
+	FindingStale = "stale"
+)
+
+// Findings are the known audit findings
+var Findings = []string{FindingWeak, FindingReused, FindingStale}
+
+// ErrUnknownFinding is returned when acknowledging a finding that is not
+// one of Findings
+var ErrUnknownFinding = errors.New("unknown audit finding")
+
+// Ack acknowledges an audit finding of an entry, such as a weak password
+// on a site that caps passwords at 8 characters, so audits list it apart
+// from the findings still to be dealt with. It holds while the entry keeps
+// the password it was made for and, if Until is set, until then.
+//
+// Acks travel with the entries of ListPasswords, so backups and exports
+// with secrets keep them.
+type Ack struct {
+	// Name is the entry acknowledged, set by Acks
+	Name    string    `json:"-"`
+	Finding string    `json:"finding"`
+	Reason  string    `json:"reason"`
+	Until   time.Time `json:"until,omitempty"`
+	AckedAt time.Time `json:"acked_at"`
+	// Fingerprint is a salted hash of the password acknowledged, which
+	// the vault only stores encrypted
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Holds reports whether the ack still applies at now to an entry with
+// password
+func (a *Ack) Holds(password string, now time.Time) bool {
+	if !a.Until.IsZero() && !now.Before(a.Until) {
+		return false
+	}
+	salt, sum, ok := strings.Cut(a.Fingerprint, ":")
+	if !ok {
+		return false
+	}
+	raw, err := hex.DecodeString(salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(passwordFingerprint(raw, password)), []byte(salt+":"+sum)) == 1
+}
+
+// Acked returns the ack of finding that still holds for the entry at now,
+// or nil
+func (e *PasswordEntry) Acked(finding string, now time.Time) *Ack {
+	for i := range e.Acks {
+		if e.Acks[i].Finding == finding && e.Acks[i].Holds(e.Password, now) {
+			return &e.Acks[i]
+		}
+	}
+	return nil
+}
+
+// passwordFingerprint hashes password with salt. The hash is not keyed to
+// the vault, so an ack still matches once restored into another one.
+func passwordFingerprint(salt []byte, password string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(password))
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// ackData is what the data column of audit_acks holds, encrypted
+type ackData struct {
+	Reason      string    `json:"reason"`
+	Until       time.Time `json:"until,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+// ackRow is an encoded ack, ready to be stored
+type ackRow struct {
+	finding string
+	data    string
+	ackedAt string
+}
+
+// encodeAck encrypts the reason, expiry and fingerprint of ack
+func (db *Database) encodeAck(ack *Ack) (ackRow, error) {
+	data, err := json.Marshal(ackData{Reason: ack.Reason, Until: ack.Until, Fingerprint: ack.Fingerprint})
+	if err != nil {
+		return ackRow{}, fmt.Errorf("failed to encode acknowledgement: %w", err)
+	}
+	value, err := db.encryptValue(string(data))
+	if err != nil {
+		return ackRow{}, fmt.Errorf("failed to encrypt acknowledgement: %w", err)
+	}
+	return ackRow{finding: ack.Finding, data: value, ackedAt: ack.AckedAt.UTC().Format(sqliteTimestamp)}, nil
+}
+
+// insertAcks stores the encoded acks of the entry with ID id
+func insertAcks(ex execer, id int64, acks []ackRow) error {
+	for _, ack := range acks {
+		_, err := ex.Exec(`INSERT OR REPLACE INTO audit_acks (entry_id, finding, data, acked_at) VALUES (?, ?, ?, ?)`,
+			id, ack.finding, ack.data, ack.ackedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save acknowledgement: %w", err)
+		}
+	}
+	return nil
+}
+
+// AckFinding acknowledges finding for the entry called name, for its
+// current password and, if until is not zero, until then. An earlier ack
+// of the same finding is replaced.
+func (db *Database) AckFinding(name, finding, reason string, until time.Time) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	known := false
+	for _, f := range Findings {
+		known = known || f == finding
+	}
+	if !known {
+		return fmt.Errorf("%w: %s", ErrUnknownFinding, finding)
+	}
+	entry, err := db.GetPassword(name)
+	if err != nil {
+		return err
+	}
+
+	salt, err := crypto.GenerateRandomBytes(16)
+	if err != nil {
+		return err
+	}
+	ack := &Ack{
+		Finding:     finding,
+		Reason:      reason,
+		Until:       until,
+		AckedAt:     time.Now(),
+		Fingerprint: passwordFingerprint(salt, entry.Password),
+	}
+	row, err := db.encodeAck(ack)
+	if err != nil {
+		return err
+	}
+	return insertAcks(db.db, entry.ID, []ackRow{row})
+}
+
+// Unack removes the acks of finding, or of every finding if it is empty,
+// from the entry called name and returns how many there were
+func (db *Database) Unack(name, finding string) (int, error) {
+	if err := db.writable(); err != nil {
+		return 0, err
+	}
+	result, err := db.db.Exec(`DELETE FROM audit_acks WHERE entry_id IN (SELECT id FROM passwords WHERE name = ?)
+		AND (? = '' OR finding = ?)`, name, finding, finding)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete acknowledgements: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete acknowledgements: %w", err)
+	}
+	return int(removed), nil
+}
+
+// Acks returns the acks holding at now, sorted by entry name and finding.
+// Acks that have lapsed, as the password changed or their time ran out,
+// are deleted along the way.
+func (db *Database) Acks(now time.Time) ([]Ack, error) {
+	entries, err := db.ListPasswords()
+	if err != nil {
+		return nil, err
+	}
+
+	var acks []Ack
+	type key struct {
+		id      int64
+		finding string
+	}
+	var lapsed []key
+	for _, entry := range entries {
+		for _, ack := range entry.Acks {
+			holds := ack.Holds(entry.Password, now)
+			if entry.Locked {
+				// Only the time of a locked entry's ack can be checked
+				holds = ack.Until.IsZero() || now.Before(ack.Until)
+			}
+			if !holds {
+				lapsed = append(lapsed, key{entry.ID, ack.Finding})
+				continue
+			}
+			ack.Name = entry.Name
+			acks = append(acks, ack)
+		}
+	}
+	sort.Slice(acks, func(i, j int) bool {
+		if acks[i].Name != acks[j].Name {
+			return acks[i].Name < acks[j].Name
+		}
+		return acks[i].Finding < acks[j].Finding
+	})
+
+	if db.writable() == nil && !db.IsMemory() {
+		for _, k := range lapsed {
+			if _, err := db.db.Exec(`DELETE FROM audit_acks WHERE entry_id = ? AND finding = ?`, k.id, k.finding); err != nil {
+				return nil, fmt.Errorf("failed to delete acknowledgement: %w", err)
+			}
+		}
+	}
+	return acks, nil
+}
+
+// loadAcks attaches their stored acks to entries, whose secrets have been
+// decrypted
+func (db *Database) loadAcks(entries []*PasswordEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*PasswordEntry, len(entries))
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+		ids = append(ids, fmt.Sprint(entry.ID))
+	}
+
+	rows, err := db.db.Query(`SELECT entry_id, finding, data, acked_at FROM audit_acks
+		WHERE entry_id IN (` + strings.Join(ids, ",") + `) ORDER BY entry_id, finding`)
+	if err != nil {
+		return fmt.Errorf("failed to query acknowledgements: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var finding, value, ackedAt string
+		if err := rows.Scan(&id, &finding, &value, &ackedAt); err != nil {
+			return fmt.Errorf("failed to scan acknowledgement: %w", err)
+		}
+		plaintext, err := decryptField(value, db.dataKey)
+		if err != nil {
+			continue // Skip acks that cannot be decrypted, as entries are
+		}
+		var data ackData
+		if err := json.Unmarshal([]byte(plaintext), &data); err != nil {
+			continue
+		}
+		entry := byID[id]
+		entry.Acks = append(entry.Acks, Ack{
+			Finding:     finding,
+			Reason:      data.Reason,
+			Until:       data.Until,
+			AckedAt:     parseTimestamp(ackedAt),
+			Fingerprint: data.Fingerprint,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read acknowledgements: %w", err)
+	}
+	return nil
+}
+
+// reencryptAcks moves the acks from oldKey to newKey within tx
+func reencryptAcks(tx *sql.Tx, oldKey, newKey string) error {
+	rows, err := tx.Query(`SELECT rowid, data FROM audit_acks`)
+	if err != nil {
+		return fmt.Errorf("failed to query acknowledgements: %w", err)
+	}
+	values := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan acknowledgement: %w", err)
+		}
+		values[id] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read acknowledgements: %w", err)
+	}
+
+	for id, value := range values {
+		data, err := decryptField(value, oldKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt acknowledgement: %w", err)
+		}
+		if value, err = sealField(data, newKey); err != nil {
+			return fmt.Errorf("failed to encrypt acknowledgement: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE audit_acks SET data = ? WHERE rowid = ?`, value, id); err != nil {
+			return fmt.Errorf("failed to update acknowledgement: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// metaLastSeenPrefix prefixes the metadata keys holding when a device
+// last closed the vault, keyed by a device identity the caller chooses
+const metaLastSeenPrefix = "last_seen:"
+
+// metaBackups holds the times backups of the vault were taken, as a JSON
+// array of Unix seconds
+const metaBackups = "backups"
+
+// backupsKept is how many backup times metaBackups keeps, the latest
+const backupsKept = 50
+
+// LastSeen returns when device last had the vault open, zero if it never
+// had
+func (db *Database) LastSeen(device string) (time.Time, error) {
+	value, err := db.getMetadata(metaLastSeenPrefix + device)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read last seen time of %s: %w", device, err)
+	}
+	return t, nil
+}
+
+// MarkSeen records that device had the vault open until at. Read-only
+// sessions cannot record it and are skipped, as MarkAccessed skips them.
+func (db *Database) MarkSeen(device string, at time.Time) error {
+	if db.writable() != nil {
+		return nil
+	}
+	if _, err := db.db.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`,
+		metaLastSeenPrefix+device, at.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to record last seen time: %w", err)
+	}
+	return nil
+}
+
+// ChangedSince counts the entries created or updated after t
+func (db *Database) ChangedSince(t time.Time) (int, error) {
+	var n int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM passwords WHERE updated_at > ?`,
+		t.UTC().Format(sqliteTimestamp)).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count changed entries: %w", err)
+	}
+	return n, nil
+}
+
+// RecordBackup records that a backup of the vault was taken at
+func (db *Database) RecordBackup(at time.Time) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	times, err := db.backupTimes()
+	if err != nil {
+		return err
+	}
+	times = append(times, at.Unix())
+	if len(times) > backupsKept {
+		times = times[len(times)-backupsKept:]
+	}
+	data, err := json.Marshal(times)
+	if err != nil {
+		return fmt.Errorf("failed to encode backup times: %w", err)
+	}
+	if _, err := db.db.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`, metaBackups, string(data)); err != nil {
+		return fmt.Errorf("failed to record backup: %w", err)
+	}
+	return nil
+}
+
+// BackupsSince counts the backups recorded after t
+func (db *Database) BackupsSince(t time.Time) (int, error) {
+	times, err := db.backupTimes()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, at := range times {
+		if at > t.Unix() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// backupTimes returns the backup times of metaBackups, oldest first
+func (db *Database) backupTimes() ([]int64, error) {
+	value, err := db.getMetadata(metaBackups)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var times []int64
+	if err := json.Unmarshal([]byte(value), &times); err != nil {
+		return nil, fmt.Errorf("failed to read backup times: %w", err)
+	}
+	return times, nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"sort"
+	"time"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/generator"
+)
+
+// DefaultAuditMaxAge is how long a password may go unchanged before an
+// audit reports it as stale, unless AuditOptions says otherwise
+const DefaultAuditMaxAge = 365 * 24 * time.Hour
+
+// weakLevels are the strength levels below Good, which an audit reports
+var weakLevels = map[string]bool{"Very Weak": true, "Weak": true, "Fair": true}
+
+// AuditOptions adjust what Audit reports
+type AuditOptions struct {
+	// MaxAge is how long a password may go unchanged before it is stale;
+	// 0 leaves staleness unchecked
+	MaxAge time.Duration
+	// Now is the time of the audit; the zero time means time.Now
+	Now time.Time
+	// Only, when not nil, limits the audit to the entries it names.
+	// Reuse is still looked for across the vault, so a password shared
+	// with an entry left out is reported all the same.
+	Only map[string]bool
+}
+
+// AuditReport lists the passwords that need attention. Findings an ack
+// still holds for are listed in Acknowledged instead.
+type AuditReport struct {
+	// Checked is how many entries were audited
+	Checked      int            `json:"checked"`
+	Weak         []WeakEntry    `json:"weak"`
+	Reused       []ReusedGroup  `json:"reused"`
+	Stale        []StaleEntry   `json:"stale"`
+	Acknowledged []AckedFinding `json:"acknowledged"`
+}
+
+// WeakEntry is an entry whose password scores below Good
+type WeakEntry struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// ReusedGroup is a set of entries sharing one password, sorted by name
+type ReusedGroup struct {
+	Names []string `json:"names"`
+}
+
+// StaleEntry is an entry left unchanged for longer than the audit allows
+type StaleEntry struct {
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Days is how many whole days ago the entry last changed
+	Days int `json:"days"`
+}
+
+// AckedFinding is a finding left out of an audit by an ack
+type AckedFinding struct {
+	Name    string `json:"name"`
+	Finding string `json:"finding"`
+	Reason  string `json:"reason"`
+	// Until is when the ack lapses, if it does before the password changes
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Problems returns how many findings need attention: each weak and stale
+// entry, and each group of reused passwords
+func (r *AuditReport) Problems() int {
+	return len(r.Weak) + len(r.Reused) + len(r.Stale)
+}
+
+// Audit checks every entry for a weak password, a password shared with
+// other entries and a password left unchanged for longer than
+// opts.MaxAge. Strength comes from the cached grade while it is current.
+// Shared passwords are found by an HMAC of each password under a key
+// made for this audit, so the report and the grouping hold no secrets.
+// Notes, whose password is optional, are only checked for staleness, and
+// so are entries encrypted to recipients that cannot be read.
+func (db *Database) Audit(opts AuditOptions) (*AuditReport, error) {
+	if db.viewer {
+		return nil, ErrReadOnly
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	entries, err := db.ListPasswords()
+	if err != nil {
+		return nil, err
+	}
+	grades, err := db.StrengthGrades()
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.GenerateRandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{Weak: []WeakEntry{}, Reused: []ReusedGroup{},
+		Stale: []StaleEntry{}, Acknowledged: []AckedFinding{}}
+	audited := func(entry *PasswordEntry) bool {
+		return opts.Only == nil || opts.Only[entry.Name]
+	}
+	// acked reports whether an ack holds for the finding of entry, and
+	// lists it if so and the entry is audited
+	acked := func(entry *PasswordEntry, finding string) bool {
+		ack := entry.Acked(finding, now)
+		if ack != nil && audited(entry) {
+			item := AckedFinding{Name: entry.Name, Finding: ack.Finding, Reason: ack.Reason}
+			if !ack.Until.IsZero() {
+				until := ack.Until
+				item.Until = &until
+			}
+			report.Acknowledged = append(report.Acknowledged, item)
+		}
+		return ack != nil
+	}
+
+	groups := make(map[string][]*PasswordEntry)
+	for _, entry := range entries {
+		if !entry.IsNote() && entry.Password != "" {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(entry.Password))
+			fingerprint := string(mac.Sum(nil))
+			groups[fingerprint] = append(groups[fingerprint], entry)
+		}
+		if !audited(entry) {
+			continue
+		}
+		report.Checked++
+
+		if !entry.IsNote() && entry.Password != "" {
+			var level string
+			if grade, ok := grades[entry.ID]; ok && !grade.AnalyzedAt.Before(entry.UpdatedAt) {
+				level = grade.Level
+			} else {
+				level = generator.Analyze(entry.Password).Level
+			}
+			if weakLevels[level] && !acked(entry, FindingWeak) {
+				report.Weak = append(report.Weak, WeakEntry{Name: entry.Name, Level: level})
+			}
+		}
+
+		if opts.MaxAge > 0 && now.Sub(entry.UpdatedAt) > opts.MaxAge && !acked(entry, FindingStale) {
+			report.Stale = append(report.Stale, StaleEntry{
+				Name:      entry.Name,
+				UpdatedAt: entry.UpdatedAt,
+				Days:      int(now.Sub(entry.UpdatedAt).Hours() / 24),
+			})
+		}
+	}
+
+	// A group is reported while any of its entries has not acknowledged
+	// the reuse, if one of them is audited
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		group := ReusedGroup{}
+		open, anyAudited := false, false
+		for _, entry := range members {
+			group.Names = append(group.Names, entry.Name)
+			if !acked(entry, FindingReused) {
+				open = true
+			}
+			anyAudited = anyAudited || audited(entry)
+		}
+		if open && anyAudited {
+			sort.Strings(group.Names)
+			report.Reused = append(report.Reused, group)
+		}
+	}
+	sort.Slice(report.Reused, func(i, j int) bool {
+		return report.Reused[i].Names[0] < report.Reused[j].Names[0]
+	})
+	sort.Slice(report.Acknowledged, func(i, j int) bool {
+		a, b := report.Acknowledged[i], report.Acknowledged[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Finding < b.Finding
+	})
+	return report, nil
+}
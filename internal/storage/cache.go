@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// maxCachedEntries bounds the metadata cache. Larger vaults are listed
+// from the database every time instead.
+const maxCachedEntries = 50000
+
+// metadataCache keeps the last metadata listing of a session so repeated
+// listings skip the query and the tag decryption. It never holds
+// passwords or note bodies. The listing is tied to the size and
+// modification time of the vault file, so a change made by another
+// process is noticed, and it is dropped on every write of this session.
+type metadataCache struct {
+	mu      sync.Mutex
+	entries []*PasswordEntry
+	size    int64
+	modTime time.Time
+}
+
+// get returns a copy of the cached listing if the vault file still has
+// the size and modification time it had when the listing was stored
+func (c *metadataCache) get(stamp os.FileInfo) ([]*PasswordEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil || stamp.Size() != c.size || !stamp.ModTime().Equal(c.modTime) {
+		return nil, false
+	}
+	return copyEntries(c.entries), true
+}
+
+// put stores a listing taken while the vault file looked like stamp.
+// Listings over maxCachedEntries are not kept.
+func (c *metadataCache) put(entries []*PasswordEntry, stamp os.FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	if len(entries) > maxCachedEntries {
+		return
+	}
+	c.entries = copyEntries(entries)
+	if c.entries == nil {
+		c.entries = []*PasswordEntry{}
+	}
+	c.size = stamp.Size()
+	c.modTime = stamp.ModTime()
+}
+
+// clear drops the cached listing
+func (c *metadataCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// copyEntries copies entries so callers cannot change the cached ones
+func copyEntries(entries []*PasswordEntry) []*PasswordEntry {
+	if entries == nil {
+		return nil
+	}
+	copies := make([]*PasswordEntry, len(entries))
+	for i, entry := range entries {
+		c := *entry
+		c.Tags = copyStrings(entry.Tags)
+		c.Recipients = copyStrings(entry.Recipients)
+		if entry.ExpiresAt != nil {
+			expiresAt := *entry.ExpiresAt
+			c.ExpiresAt = &expiresAt
+		}
+		copies[i] = &c
+	}
+	return copies
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Kinds of change in a ChangeSet
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	// ChangeTouch bumps the updated_at of an entry without changing it
+	ChangeTouch = "touch"
+)
+
+// ErrChangeConflict is returned by ChangeSet.Validate when a set adds,
+// updates or deletes the same name more than once, or touches a name it
+// deletes
+var ErrChangeConflict = errors.New("name is changed more than once in the set")
+
+// ChangeSet is a batch of additions, updates and deletions that Apply
+// makes together: all of them, or on any error none. Build one with
+// NewChangeSet and its Add, Update, Delete and Touch methods.
+type ChangeSet struct {
+	db      *Database
+	changes []*change
+	// Snapshot, when set, makes Apply write a compacted copy of the vault
+	// next to it before changing anything, named after the vault, the time
+	// and Snapshot. Vaults in memory get none.
+	Snapshot string
+	// SnapshotPath is where Apply wrote the copy
+	SnapshotPath string
+	// Journal, when set, makes Apply record the additions and updates of
+	// the set in the operations journal as one operation of that kind,
+	// with the state each updated entry had before, so RollbackOperation
+	// can undo them
+	Journal string
+	// Operation is the ID of the operation Apply recorded
+	Operation string
+	// after runs within the transaction once every change is made, for
+	// the bookkeeping of callers in this package, such as the sync log
+	after []func(tx *sql.Tx) error
+}
+
+// change is one operation of a ChangeSet
+type change struct {
+	kind  string
+	name  string
+	entry *PasswordEntry
+	// id is the stored entry changed, as found by validate
+	id int64
+	// trashed is what a deletion keeps in the trash, read by validate
+	trashed *trashRow
+	// before is what a journaled update replaces, read by validate
+	before *trashRow
+}
+
+// ChangeResult is what Apply did for one change of the set
+type ChangeResult struct {
+	// Kind is ChangeAdd, ChangeUpdate, ChangeDelete or ChangeTouch
+	Kind string
+	Name string
+	// ID is the row of the entry; for an addition, the new one
+	ID int64
+}
+
+// NewChangeSet starts an empty set of changes to the vault
+func (db *Database) NewChangeSet() *ChangeSet {
+	return &ChangeSet{db: db}
+}
+
+// Add stores entry as a new entry
+func (cs *ChangeSet) Add(entry *PasswordEntry) *ChangeSet {
+	cs.changes = append(cs.changes, &change{kind: ChangeAdd, name: entry.Name, entry: entry})
+	return cs
+}
+
+// Update replaces the stored entry called entry.Name with entry, keeping
+// its creation time
+func (cs *ChangeSet) Update(entry *PasswordEntry) *ChangeSet {
+	cs.changes = append(cs.changes, &change{kind: ChangeUpdate, name: entry.Name, entry: entry})
+	return cs
+}
+
+// Delete moves the entry called name to the trash
+func (cs *ChangeSet) Delete(name string) *ChangeSet {
+	cs.changes = append(cs.changes, &change{kind: ChangeDelete, name: name})
+	return cs
+}
+
+// Touch bumps the updated_at of the entry called name
+func (cs *ChangeSet) Touch(name string) *ChangeSet {
+	cs.changes = append(cs.changes, &change{kind: ChangeTouch, name: name})
+	return cs
+}
+
+// Len returns how many changes the set holds
+func (cs *ChangeSet) Len() int {
+	return len(cs.changes)
+}
+
+// Validate checks the whole set against the vault without changing it:
+// additions need a free name, the rest an existing one, no name may be
+// written twice, and every entry must encrypt. Updates get the ID of the
+// entry they replace.
+func (cs *ChangeSet) Validate() error {
+	_, err := cs.validate()
+	return err
+}
+
+// validate does the work of Validate and returns the encoded entries, in
+// the order of the changes; nil for deletions and touches
+func (cs *ChangeSet) validate() ([]*entryRow, error) {
+	db := cs.db
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+	stored, err := db.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int64, len(stored))
+	for _, entry := range stored {
+		ids[entry.Name] = entry.ID
+	}
+
+	rows := make([]*entryRow, len(cs.changes))
+	seen := make(map[string]string, len(cs.changes))
+	for i, c := range cs.changes {
+		if c.name == "" {
+			return nil, fmt.Errorf("change %d: entry name cannot be empty", i+1)
+		}
+		// Touching an entry the set also writes is harmless; only a
+		// deletion rules it out
+		kind, ok := seen[c.name]
+		if ok && (c.kind != ChangeTouch && kind != ChangeTouch || c.kind == ChangeDelete || kind == ChangeDelete) {
+			return nil, fmt.Errorf("%w: %s (%s, then %s)", ErrChangeConflict, c.name, kind, c.kind)
+		}
+		if !ok || kind == ChangeTouch {
+			seen[c.name] = c.kind
+		}
+
+		id, exists := ids[c.name]
+		c.id = id
+		switch {
+		case c.kind == ChangeAdd && exists:
+			return nil, fmt.Errorf("%w: %s", ErrEntryExists, c.name)
+		case c.kind != ChangeAdd && !exists:
+			return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, c.name)
+		}
+		if c.kind == ChangeDelete {
+			if c.trashed, err = db.trashRowOf(c.name, true); err != nil {
+				return nil, err
+			}
+		}
+		if c.kind == ChangeUpdate && cs.Journal != "" {
+			if c.before, err = db.trashRowOf(c.name, false); err != nil {
+				return nil, err
+			}
+		}
+		if c.entry == nil {
+			continue
+		}
+		if c.kind == ChangeUpdate {
+			c.entry.ID = id
+		}
+		if rows[i], err = db.encodeEntry(c.entry); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+	return rows, nil
+}
+
+// Apply validates the set and makes every change in one transaction,
+// writing the snapshot first if the set asks for one. It returns what was
+// done for each change, in order. On any error, or when ctx is done
+// before the transaction commits, nothing is changed and added entries
+// keep the IDs they had.
+func (cs *ChangeSet) Apply(ctx context.Context) ([]ChangeResult, error) {
+	db := cs.db
+	rows, err := cs.validate()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cs.Snapshot != "" && !db.IsMemory() {
+		if cs.SnapshotPath, err = db.writeSnapshot(cs.Snapshot); err != nil {
+			return nil, err
+		}
+	}
+
+	// IDs are only kept once the transaction commits
+	var added []*PasswordEntry
+	var addedIDs []int64
+	defer func() {
+		if err != nil {
+			restoreIDs(added, addedIDs)
+		}
+	}()
+
+	db.cache.clear()
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]ChangeResult, len(cs.changes))
+	var written []*PasswordEntry
+	var journaled []journalEntry
+	for i, c := range cs.changes {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch c.kind {
+		case ChangeAdd:
+			added, addedIDs = append(added, c.entry), append(addedIDs, c.entry.ID)
+			err = insertEntry(tx, c.entry, rows[i])
+		case ChangeUpdate:
+			err = db.updateEntry(tx, c.entry, rows[i])
+		case ChangeDelete:
+			err = db.trashEntry(tx, c.trashed)
+		case ChangeTouch:
+			err = touchEntry(tx, c.name)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", c.name, err)
+			return nil, err
+		}
+		results[i] = ChangeResult{Kind: c.kind, Name: c.name, ID: c.id}
+		if c.entry != nil {
+			results[i].ID = c.entry.ID
+			written = append(written, c.entry)
+			journaled = append(journaled, journalEntry{change: c.kind, entry: c.entry, before: c.before})
+		}
+	}
+	if err = db.updateReuseIndex(tx, written); err != nil {
+		return nil, err
+	}
+	var operation string
+	if cs.Journal != "" && len(journaled) > 0 {
+		if operation, err = db.recordOperation(tx, cs.Journal, journaled); err != nil {
+			return nil, err
+		}
+	}
+	for _, fn := range cs.after {
+		if err = fn(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		err = fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, err
+	}
+	cs.Operation = operation
+	return results, nil
+}
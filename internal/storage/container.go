@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/filelock"
+	"password-manager/internal/tmpfile"
+)
+
+// containerMagic starts every fully encrypted vault file, followed by the
+// vault as a crypto stream. Plain vaults are ordinary SQLite files
+// starting with "SQLite format 3".
+var containerMagic = []byte("PMVAULT2")
+
+// legacyContainerMagic starts containers sealed before streams, which
+// hold the vault in one EncryptedData. They are still read, and written
+// as streams on the next seal.
+var legacyContainerMagic = []byte("PMVAULT1")
+
+// ErrFullEncryption is returned for operations a fully encrypted vault
+// does not support
+var ErrFullEncryption = errors.New("not supported for fully encrypted vaults")
+
+// ErrVaultInUse is returned when a fully encrypted vault is already open
+// in another session, whose changes would otherwise be lost when both
+// seal their working copies back
+var ErrVaultInUse = errors.New("vault is open in another session")
+
+// renameFile is os.Rename; tests replace it to simulate a crash while
+// re-sealing
+var renameFile = os.Rename
+
+// isContainer reports whether the file at path is a fully encrypted vault.
+// A missing file is not a container.
+func isContainer(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open vault: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, len(containerMagic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(header, containerMagic) || bytes.Equal(header, legacyContainerMagic), nil
+}
+
+// lockContainer takes the session lock of the fully encrypted vault at
+// path. The lock lives in a side file since the container itself is
+// replaced on every re-seal.
+func lockContainer(path string) (*filelock.Lock, error) {
+	lock, err := filelock.TryLock(path + ".lock")
+	if errors.Is(err, filelock.ErrLocked) {
+		return nil, ErrVaultInUse
+	}
+	return lock, err
+}
+
+// newWorkPath reserves a fresh path for a decrypted working copy in the
+// private, preferably memory-backed, temporary directory of the process
+func newWorkPath() (string, error) {
+	path, err := tmpfile.Path("pm-vault-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create working copy: %w", err)
+	}
+	return path, nil
+}
+
+// unseal decrypts the container at path into a new working copy and
+// returns its path
+func unseal(path, password string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault: %w", err)
+	}
+	defer f.Close()
+	magic := make([]byte, len(containerMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return "", fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	workPath, err := newWorkPath()
+	if err != nil {
+		return "", err
+	}
+	out, err := os.OpenFile(workPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write working copy: %w", err)
+	}
+	if bytes.Equal(magic, legacyContainerMagic) {
+		err = unsealLegacy(out, f, password)
+	} else {
+		err = crypto.DecryptStream(out, f, password)
+	}
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write working copy: %w", closeErr)
+	}
+	if err != nil {
+		removeWorkCopy(workPath)
+		if errors.Is(err, crypto.ErrDecrypt) {
+			return "", ErrInvalidPassword
+		}
+		return "", fmt.Errorf("corrupt vault container: %w", err)
+	}
+	return workPath, nil
+}
+
+// unsealLegacy decrypts the body of a container sealed before streams
+// from src to dst
+func unsealLegacy(dst io.Writer, src io.Reader, password string) error {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("failed to read vault: %w", err)
+	}
+	var encrypted crypto.EncryptedData
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return err
+	}
+	plain, err := crypto.DecryptBytes(&encrypted, password)
+	if err != nil {
+		return err
+	}
+	defer crypto.NewSecretString(plain).Wipe()
+	if _, err := dst.Write(plain); err != nil {
+		return fmt.Errorf("failed to write working copy: %w", err)
+	}
+	return nil
+}
+
+// seal encrypts the SQLite file at plainPath under password and atomically
+// replaces the container at path with it. The file is encrypted as a
+// stream, so it is never held in memory whole.
+func seal(plainPath, path, password string) error {
+	plain, err := os.Open(plainPath)
+	if err != nil {
+		return fmt.Errorf("failed to read working copy: %w", err)
+	}
+	defer plain.Close()
+
+	return writeAtomic(path, func(w io.Writer) error {
+		if _, err := w.Write(containerMagic); err != nil {
+			return err
+		}
+		if err := crypto.EncryptStream(w, plain, password); err != nil {
+			return fmt.Errorf("failed to encrypt vault: %w", err)
+		}
+		return nil
+	})
+}
+
+// writeAtomic replaces path with what write writes so that a crash at
+// any point leaves either the old or the new file: the data is written to
+// a temporary file next to path, synced, renamed over path, and the
+// directory is synced
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close %s: %w", tmp, err)
+	}
+	return replaceFile(tmp, path)
+}
+
+// replaceFile renames the synced file tmp over path and syncs the directory
+func replaceFile(tmp, path string) error {
+	if err := renameFile(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	// Persist the rename; not every platform can sync a directory
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// removeWorkCopy wipes and deletes a working copy and any SQLite side
+// files
+func removeWorkCopy(path string) {
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		tmpfile.Remove(path + suffix)
+	}
+}
+
+// IsFullyEncrypted reports whether the whole vault file is encrypted,
+// hiding the schema, entry names and timestamps
+func (db *Database) IsFullyEncrypted() bool {
+	return db.workPath != ""
+}
+
+// RewriteTo writes a compacted copy of the open vault to path, which must
+// not exist yet. The copy has the same format as the working database.
+func (db *Database) RewriteTo(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if _, err := db.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to rewrite vault: %w", err)
+	}
+	return nil
+}
+
+// SetFullEncryption converts the vault to or from whole-file encryption
+// and reopens it in the new format. The container is encrypted under the
+// master password, so a viewer credential cannot be combined with it.
+func (db *Database) SetFullEncryption(masterPassword []byte, enabled bool) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	if enabled == db.IsFullyEncrypted() {
+		return nil
+	}
+	if err := db.checkMasterPassword(string(masterPassword)); err != nil {
+		return err
+	}
+	if enabled {
+		if hasViewer, err := db.HasViewer(); err != nil {
+			return err
+		} else if hasViewer {
+			return fmt.Errorf("disable the viewer credential first: %w", ErrFullEncryption)
+		}
+	}
+
+	// Write the vault in its new format next to the current one, close
+	// the current handle and swap the files; whatever happens, the vault
+	// is reopened from what is on disk
+	var convertErr error
+	if enabled {
+		convertErr = db.sealCopy(crypto.NormalizePassword(string(masterPassword)))
+	} else {
+		convertErr = db.plainCopy()
+	}
+	db.db.Close()
+	if db.workPath != "" {
+		// On failure the container is still current; keep its changes
+		if convertErr != nil {
+			seal(db.workPath, db.dbPath, db.sealKey)
+		}
+		removeWorkCopy(db.workPath)
+	}
+	db.lock.Unlock()
+
+	reopened, err := NewDatabase(db.dbPath, masterPassword)
+	if err != nil {
+		return fmt.Errorf("failed to reopen vault: %w", err)
+	}
+	reopened.identities = db.identities
+	reopened.tagger = db.tagger
+	*db = *reopened
+	return convertErr
+}
+
+// sealCopy replaces the plain vault file with a container holding a
+// rewritten copy of it
+func (db *Database) sealCopy(masterPassword string) error {
+	plainPath, err := newWorkPath()
+	if err != nil {
+		return err
+	}
+	defer removeWorkCopy(plainPath)
+	if err := db.RewriteTo(plainPath); err != nil {
+		return err
+	}
+	return seal(plainPath, db.dbPath, masterPassword)
+}
+
+// plainCopy replaces the container with a plain rewritten copy of the
+// working database
+func (db *Database) plainCopy() error {
+	tmp := db.dbPath + ".tmp"
+	os.Remove(tmp)
+	if err := db.RewriteTo(tmp); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return replaceFile(tmp, db.dbPath)
+}
+
+// syncFile flushes the file at path to stable storage
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// Metadata keys written when a vault is created. initialized_at marks the
+// file as a vault; kdf and cipher record the choices made at init.
+const (
+	metaInitialized = "initialized_at"
+	metaKDF         = "kdf"
+	metaCipher      = "cipher"
+)
+
+// Key derivation functions and ciphers a vault can be created with.
+// Vaults created as pbkdf2 are still read; see MigrateKDF.
+const (
+	KDFArgon2id     = "argon2id"
+	KDFPBKDF2       = "pbkdf2"
+	CipherAES256GCM = "aes-256-gcm"
+)
+
+var (
+	// KDFs lists the key derivation functions a vault can be created with
+	KDFs = []string{KDFArgon2id}
+	// Ciphers lists the ciphers a vault can be created with
+	Ciphers = []string{CipherAES256GCM}
+)
+
+var (
+	// ErrNoVault is returned when opening a path that holds no vault
+	ErrNoVault = errors.New("no vault found")
+	// ErrVaultExists is returned when creating a vault over an existing file
+	ErrVaultExists = errors.New("vault already exists")
+)
+
+// InitOptions are the choices made when a vault is created. Empty fields
+// take the defaults.
+type InitOptions struct {
+	KDF            string
+	Cipher         string
+	FullEncryption bool
+}
+
+// Validate fills in defaults and rejects unsupported choices
+func (o *InitOptions) Validate() error {
+	if o.KDF == "" {
+		o.KDF = KDFArgon2id
+	}
+	if o.Cipher == "" {
+		o.Cipher = CipherAES256GCM
+	}
+	if !slices.Contains(KDFs, o.KDF) {
+		return fmt.Errorf("unsupported KDF %q (available: %s)", o.KDF, strings.Join(KDFs, ", "))
+	}
+	if !slices.Contains(Ciphers, o.Cipher) {
+		return fmt.Errorf("unsupported cipher %q (available: %s)", o.Cipher, strings.Join(Ciphers, ", "))
+	}
+	return nil
+}
+
+// CreateDatabase creates a new vault at dbPath and returns it open. It
+// refuses to touch an existing file. Entries are encrypted under a random
+// data key wrapped with the master password, so a wrong password is
+// rejected on open rather than producing undecryptable entries.
+func CreateDatabase(dbPath, masterPassword string, options InitOptions) (*Database, error) {
+	if masterPassword == "" {
+		return nil, fmt.Errorf("master password cannot be empty")
+	}
+	if err := checkPasswordLength("master", masterPassword); err != nil {
+		return nil, err
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	// Claiming the path with O_EXCL makes the existence check atomic
+	file, err := os.OpenFile(dbPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w at %s", ErrVaultExists, dbPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault: %w", err)
+	}
+	file.Close()
+
+	database, err := createVault(dbPath, masterPassword, options)
+	if err != nil {
+		os.Remove(dbPath)
+		return nil, err
+	}
+	return database, nil
+}
+
+// createVault sets up the schema, data key and markers in the empty file
+// at dbPath
+func createVault(dbPath, masterPassword string, options InitOptions) (*Database, error) {
+	masterPassword = crypto.NormalizePassword(masterPassword)
+	db, err := sql.Open("sqlite3", vaultDSN(dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	database := &Database{
+		dbPath:       dbPath,
+		db:           db,
+		dataKey:      masterPassword,
+		sealKey:      masterPassword,
+		normalized:   true,
+		cache:        &metadataCache{},
+		names:        &nameLocks{},
+		historyLimit: DefaultHistoryLimit,
+	}
+
+	if err := database.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	if err := database.rekey(masterPassword, ""); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for key, value := range map[string]string{
+		metaInitialized:   time.Now().UTC().Format(time.RFC3339),
+		metaKDF:           options.KDF,
+		metaCipher:        options.Cipher,
+		metaMinAppVersion: currentFormat().String(),
+	} {
+		if err := setMetadataTx(tx, key, value); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if err := database.recordFile(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if options.FullEncryption {
+		if err := database.SetFullEncryption([]byte(masterPassword), true); err != nil {
+			database.Close()
+			return nil, err
+		}
+	}
+	return database, nil
+}
+
+// checkVault confirms the open file is a vault: it carries the
+// initialized marker, or predates it and already holds the passwords
+// table. Anything else, such as an empty file, is ErrNoVault.
+func (db *Database) checkVault() error {
+	tables := make(map[string]bool)
+	rows, err := db.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name IN ('metadata', 'passwords')`)
+	if err != nil {
+		return fmt.Errorf("failed to inspect database: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to inspect database: %w", err)
+		}
+		tables[name] = true
+	}
+	rows.Close()
+
+	if tables["metadata"] {
+		if marker, err := db.getMetadata(metaInitialized); err != nil || marker != "" {
+			return err
+		}
+	}
+	if !tables["passwords"] {
+		return fmt.Errorf("%w at %s", ErrNoVault, db.dbPath)
+	}
+	return nil
+}
+
+// initializedAt returns when the vault was created, or the zero time for
+// vaults older than the marker
+func (db *Database) initializedAt() (time.Time, error) {
+	marker, err := db.getMetadata(metaInitialized)
+	if err != nil || marker == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, marker)
+}
@@ -2,15 +2,26 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"password-manager/internal/collation"
 	"password-manager/internal/crypto"
+	"password-manager/internal/filelock"
+	"password-manager/internal/recipient"
+	"password-manager/internal/suggest"
 
-	_ "github.com/mattn/go-sqlite3"
+	"filippo.io/age"
+	"github.com/mattn/go-sqlite3"
 )
 
 // PasswordEntry represents a stored password entry
@@ -24,396 +35,2222 @@ type PasswordEntry struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Tags        []string  `json:"tags"`
+	// Type is EntryTypeLogin or EntryTypeNote; empty means login
+	Type string `json:"type,omitempty"`
+	// Recipients are the age public keys the password is additionally
+	// encrypted to; reading it then needs a matching identity
+	Recipients []string `json:"recipients,omitempty"`
+	// LastAccessedAt is when the password was last read or verified; zero
+	// if never
+	LastAccessedAt time.Time `json:"last_accessed_at,omitempty"`
+	// Icon is an optional single character shown before the name in
+	// listings. Like the name, it is stored in plaintext.
+	Icon string `json:"icon,omitempty"`
+	// ExpiresAt is when the entry is due to be rotated; nil if never. It
+	// is stored in plaintext, so expiring entries are found by an index
+	// without decrypting anything.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Acks are the acknowledged audit findings of the entry, loaded by
+	// ListPasswords along with its secrets
+	Acks []Ack `json:"acks,omitempty"`
+	// Locked is set by listings when the password is encrypted to
+	// recipients none of the loaded identities belongs to
+	Locked bool `json:"-"`
+	// plainFields is set when the row read still stores the username, URL
+	// and notes in plaintext, for sealPlainFields
+	plainFields bool
 }
 
+// Entry types. A note keeps its secret in Notes, which is then encrypted
+// like the password; the password of a note is optional.
+const (
+	EntryTypeLogin = "login"
+	EntryTypeNote  = "note"
+)
+
+// IsNote reports whether the entry is a secure note
+func (e *PasswordEntry) IsNote() bool {
+	return e.Type == EntryTypeNote
+}
+
+// Expired reports whether the entry has an expiry date and it has passed
+// at now
+func (e *PasswordEntry) Expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+// Metadata keys holding the wrapped data key
+const (
+	metaDataKeyMaster = "data_key_master"
+	metaDataKeyViewer = "data_key_viewer"
+)
+
+// metaMasterVerifier holds a salted hash of the master password of a
+// legacy vault, whose entries are encrypted directly under it
+const metaMasterVerifier = "master_verifier"
+
+// metaPasswordForm holds passwordFormNFKC once the keys of a vault derive
+// from the normalized master and viewer passwords; see
+// crypto.NormalizePassword. Older vaults derive them from the passwords
+// exactly as typed.
+const metaPasswordForm = "password_form"
+
+const passwordFormNFKC = "nfkc"
+
+// metaAutotypePrefix prefixes the metadata keys holding per-entry
+// autotype sequences
+const metaAutotypePrefix = "autotype:"
+
+// metaReminders holds "off" when startup reminders are disabled
+const metaReminders = "reminders"
+
+var (
+	// ErrReadOnly is returned by write operations on a viewer session
+	ErrReadOnly = errors.New("vault is open read-only")
+	// ErrInvalidPassword is returned when a password unwraps neither the
+	// master nor the viewer copy of the data key
+	ErrInvalidPassword = errors.New("invalid master password")
+	// ErrPasswordForm comes with ErrInvalidPassword when a vault whose keys
+	// derive from the password as typed rejects a password with
+	// non-ASCII characters, which may have been typed in another form
+	// than when the vault was created
+	ErrPasswordForm = errors.New("vault predates password normalization")
+	// ErrNoteRecipients is returned when recipients are set on a note;
+	// they would only cover its optional password, not the note itself
+	ErrNoteRecipients = errors.New("notes cannot be encrypted to recipients")
+	// ErrEntryNotFound is returned when changing an entry that does not
+	// exist
+	ErrEntryNotFound = errors.New("entry not found")
+	// ErrEntryExists is returned when saving an entry under a name that is
+	// taken
+	ErrEntryExists = errors.New("entry already exists, use update")
+)
+
 // Database represents the encrypted password database
 type Database struct {
 	dbPath string
 	db     *sql.DB
-	masterPassword string
+	// dataKey is the secret every field is encrypted under: the master
+	// password itself for legacy vaults, or the random data key unwrapped
+	// from metadata once a viewer credential has been enabled
+	dataKey string
+	// randomKey is set when dataKey is a random data key rather than the
+	// master password; see encryptValue
+	randomKey bool
+	// viewer is set when the vault was opened with the viewer credential.
+	// Such sessions are read-only and never decrypt passwords.
+	viewer bool
+	// needsUpgrade is set when the vault is in the format of an older
+	// version, which leaves it read-only; see checkVersion
+	needsUpgrade bool
+	// workPath is the decrypted working copy of a fully encrypted vault,
+	// sealed back into dbPath under sealKey on Close
+	workPath string
+	sealKey  string
+	// normalized is set when the keys of the vault derive from the
+	// normalized form of the passwords
+	normalized bool
+	// legacyForm is set when the vault was unlocked with the password as
+	// typed and would not have been with its normalized form
+	legacyForm bool
+	// lock keeps a second session from opening a fully encrypted vault
+	// while this one holds a working copy that will be sealed over it
+	lock *filelock.Lock
+	// identities unwrap passwords encrypted to recipients
+	identities []age.Identity
+	// cache holds the last metadata listing
+	cache *metadataCache
+	// tagger adjusts the tags of entries as they are saved
+	tagger Tagger
+	// historyLimit is how many replaced passwords are kept per entry
+	historyLimit int
+	// collator orders listings by name; nil means the default order
+	collator *collation.Collator
+	// memory is the connection keeping an in-memory vault alive; see
+	// OpenMemory
+	memory *sql.DB
+	// file is the vault file as found on open; see CheckFile
+	file os.FileInfo
+	// names serializes the writes of this session to each entry name
+	names *nameLocks
+}
+
+// Tagger adjusts the tags of an entry about to be stored, as the
+// automatic tagging rules do
+type Tagger interface {
+	Tag(entry *PasswordEntry) error
+}
+
+// vaultDSN returns the data source name a vault file is opened with.
+// Transactions take the write lock as they begin, so sessions writing at
+// once wait their turn, up to the busy timeout of the driver, rather than
+// one failing as "database is locked" after both have read.
+func vaultDSN(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// A Windows drive letter
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path, RawQuery: "_txlock=immediate"}).String()
 }
 
-// NewDatabase creates a new database instance
-func NewDatabase(dbPath, masterPassword string) (*Database, error) {
-	// Ensure directory exists
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+// NewDatabase opens the vault at dbPath. Vaults are created with
+// CreateDatabase; a missing file is ErrNoVault rather than a new vault.
+// masterPassword is only read, so the caller may overwrite it afterwards.
+func NewDatabase(dbPath string, masterPassword []byte) (*Database, error) {
+	password := string(masterPassword)
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w at %s", ErrNoVault, dbPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open vault: %w", err)
+	}
+
+	// A fully encrypted vault is decrypted to a memory-backed working copy
+	sqlPath := dbPath
+	var workPath string
+	var lock *filelock.Lock
+	sealKey := password
+	sealed, err := isContainer(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if sealed {
+		if lock, err = lockContainer(dbPath); err != nil {
+			return nil, err
+		}
+		// Containers sealed before passwords were normalized take the
+		// password as typed
+		for _, sealKey = range passwordForms(password) {
+			if workPath, err = unseal(dbPath, sealKey); !errors.Is(err, ErrInvalidPassword) {
+				break
+			}
+		}
+		if err != nil {
+			lock.Unlock()
+			return nil, err
+		}
+		sqlPath = workPath
 	}
 
 	// Open SQLite database
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", vaultDSN(sqlPath))
 	if err != nil {
+		removeWorkCopy(workPath)
+		lock.Unlock()
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	database := &Database{
+		dbPath: dbPath,
+		db:     db,
+		dataKey: password,
+		workPath: workPath,
+		sealKey:  sealKey,
+		lock:     lock,
+		cache:    &metadataCache{},
+		names:    &nameLocks{},
+		historyLimit: DefaultHistoryLimit,
+	}
+
 	// Test connection
 	if err := db.Ping(); err != nil {
+		database.discard()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	database := &Database{
-		dbPath: dbPath,
-		db:     db,
-		masterPassword: masterPassword,
+	if err := database.checkVault(); err != nil {
+		database.discard()
+		return nil, err
+	}
+	if err := database.checkVersion(); err != nil {
+		database.discard()
+		return nil, err
 	}
 
 	// Initialize database schema
 	if err := database.initSchema(); err != nil {
+		database.discard()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	if err := database.unlock(password); err != nil {
+		database.discard()
+		return nil, err
+	}
+	if err := database.recordFile(); err != nil {
+		database.discard()
+		return nil, err
+	}
+
 	return database, nil
 }
 
-// Close closes the database connection
-func (db *Database) Close() error {
-	if db.db != nil {
-		return db.db.Close()
+// passwordForms returns the forms of password keys may derive from: its
+// normalized form and, if that differs, the password as typed
+func passwordForms(password string) []string {
+	normalized := crypto.NormalizePassword(password)
+	if normalized == password {
+		return []string{password}
 	}
-	return nil
+	return []string{normalized, password}
 }
 
-// initSchema creates the database tables if they don't exist
-func (db *Database) initSchema() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS passwords (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			username TEXT,
-			encrypted_password TEXT NOT NULL,
-			url TEXT,
-			notes TEXT,
-			encrypted_tags TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS metadata (
-			key TEXT PRIMARY KEY,
-			value TEXT NOT NULL
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_passwords_name ON passwords(name)`,
-		`CREATE INDEX IF NOT EXISTS idx_passwords_username ON passwords(username)`,
+// unlock resolves the data key. Vaults marked with metaPasswordForm take
+// the normalized password. Older ones take the password as typed, or its
+// normalized form, as a vault created on another system may have been
+// given it in that form; the password as typed comes first, as it is what
+// such vaults were created with.
+func (db *Database) unlock(password string) error {
+	form, err := db.getMetadata(metaPasswordForm)
+	if err != nil {
+		return err
+	}
+	normalized := crypto.NormalizePassword(password)
+	candidates := []string{normalized}
+	if form != passwordFormNFKC && normalized != password {
+		candidates = []string{password, normalized}
 	}
 
-	for _, query := range queries {
-		if _, err := db.db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query '%s': %w", query, err)
+	for _, candidate := range candidates {
+		err := db.unlockWith(candidate)
+		if errors.Is(err, ErrInvalidPassword) {
+			continue
+		}
+		if err != nil {
+			return err
 		}
+		db.normalized = candidate == normalized
+		db.legacyForm = !db.normalized
+		return nil
 	}
-
-	return nil
+	if form != passwordFormNFKC && !isASCII(password) {
+		return fmt.Errorf("%w: %w", ErrInvalidPassword, ErrPasswordForm)
+	}
+	return ErrInvalidPassword
 }
 
-// SavePassword saves a password entry to the database
-func (db *Database) SavePassword(entry *PasswordEntry) error {
-	// Encrypt password
-	encryptedPassword, err := crypto.Encrypt(entry.Password, db.masterPassword)
+// unlockWith resolves the data key with one form of the password. Vaults
+// without a wrapped data key encrypt directly under the master password;
+// otherwise the password must unwrap either the master or the viewer copy.
+func (db *Database) unlockWith(password string) error {
+	masterWrap, err := db.getMetadata(metaDataKeyMaster)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt password: %w", err)
+		return err
+	}
+	if masterWrap == "" {
+		if err := db.verifyLegacyPassword(password); err != nil {
+			return err
+		}
+		db.dataKey = password
+		return nil
 	}
 
-	// Encrypt tags
-	encryptedTags, err := crypto.Encrypt(string(marshalTags(entry.Tags)), db.masterPassword)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt tags: %w", err)
+	if key, err := decryptField(masterWrap, password); err == nil {
+		db.dataKey, db.randomKey = key, true
+		return nil
 	}
 
-	// Convert encrypted data to JSON
-	passwordJSON, err := json.Marshal(encryptedPassword)
+	viewerWrap, err := db.getMetadata(metaDataKeyViewer)
 	if err != nil {
-		return fmt.Errorf("failed to marshal encrypted password: %w", err)
+		return err
+	}
+	if viewerWrap != "" {
+		if key, err := decryptField(viewerWrap, password); err == nil {
+			db.dataKey, db.randomKey = key, true
+			db.viewer = true
+			return nil
+		}
 	}
 
-	tagsJSON, err := json.Marshal(encryptedTags)
+	return ErrInvalidPassword
+}
+
+// verifyLegacyPassword checks the password of a legacy vault against its
+// verifier. Vaults opened for the first time since verifiers were added
+// have none; the password is then checked against the first entry, and
+// the verifier stored, so a mistyped password never gets to write
+// entries under the wrong key.
+func (db *Database) verifyLegacyPassword(password string) error {
+	verifier, err := db.getMetadata(metaMasterVerifier)
 	if err != nil {
-		return fmt.Errorf("failed to marshal encrypted tags: %w", err)
+		return err
+	}
+	if verifier != "" {
+		ok, err := crypto.VerifyPassword(password, verifier)
+		if err != nil {
+			return fmt.Errorf("failed to check master password: %w", err)
+		}
+		if !ok {
+			return ErrInvalidPassword
+		}
+		return nil
 	}
 
-	// Insert or update password
-	query := `INSERT OR REPLACE INTO passwords 
-		(name, username, encrypted_password, url, notes, encrypted_tags, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	var passwordJSON string
+	err = db.db.QueryRow(`SELECT encrypted_password FROM passwords ORDER BY id LIMIT 1`).Scan(&passwordJSON)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query passwords: %w", err)
+	}
+	if err == nil {
+		if _, err := decryptField(passwordJSON, password); err != nil {
+			return ErrInvalidPassword
+		}
+	}
 
-	result, err := db.db.Exec(query, 
-		entry.Name, 
-		entry.Username, 
-		string(passwordJSON), 
-		entry.URL, 
-		entry.Notes, 
-		string(tagsJSON))
-	
-	if err != nil {
-		return fmt.Errorf("failed to save password: %w", err)
+	if verifier, err = crypto.HashPassword(password); err != nil {
+		return err
 	}
+	// A verifier stored meanwhile by another session is kept
+	if _, err := db.db.Exec(`INSERT OR IGNORE INTO metadata (key, value) VALUES (?, ?)`, metaMasterVerifier, verifier); err != nil {
+		return fmt.Errorf("failed to store master password verifier: %w", err)
+	}
+	return db.verifyLegacyPassword(password)
+}
 
-	// Get the ID if it's a new entry
-	if entry.ID == 0 {
-		id, err := result.LastInsertId()
-		if err != nil {
-			return fmt.Errorf("failed to get last insert ID: %w", err)
+// isASCII reports whether s has only ASCII characters, which every form
+// of a password shares
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
 		}
-		entry.ID = id
 	}
+	return true
+}
+
+// LegacyPasswordForm reports whether the vault was unlocked with the
+// master password exactly as typed when it was created, in a form its
+// normalized one would not match. Typed on a system producing the other
+// form, it would be rejected; changing the master password, even to the
+// same one, moves the vault to the normalized form.
+func (db *Database) LegacyPasswordForm() bool {
+	return db.legacyForm
+}
+
+// keyForm returns password in the form the keys of the vault derive from
+func (db *Database) keyForm(password string) string {
+	if db.normalized {
+		return crypto.NormalizePassword(password)
+	}
+	return password
+}
 
+// checkPasswordLength rejects a new password longer than
+// crypto.MaxPasswordLength once normalized
+func checkPasswordLength(what, password string) error {
+	if len(crypto.NormalizePassword(password)) > crypto.MaxPasswordLength {
+		return fmt.Errorf("%s password is longer than %d bytes", what, crypto.MaxPasswordLength)
+	}
 	return nil
 }
 
-// GetPassword retrieves a password entry by name
-func (db *Database) GetPassword(name string) (*PasswordEntry, error) {
-	query := `SELECT id, name, username, encrypted_password, url, notes, encrypted_tags, created_at, updated_at 
-		FROM passwords WHERE name = ?`
+// IsViewer reports whether the vault was opened with the viewer credential
+func (db *Database) IsViewer() bool {
+	return db.viewer
+}
 
-	var entry PasswordEntry
-	var passwordJSON, tagsJSON string
-	var createdAt, updatedAt string
+// HasViewer reports whether a viewer credential is currently enabled
+func (db *Database) HasViewer() (bool, error) {
+	wrap, err := db.getMetadata(metaDataKeyViewer)
+	return wrap != "", err
+}
 
-	err := db.db.QueryRow(query, name).Scan(
-		&entry.ID,
-		&entry.Name,
-		&entry.Username,
-		&passwordJSON,
-		&entry.URL,
-		&entry.Notes,
-		&tagsJSON,
-		&createdAt,
-		&updatedAt,
-	)
+// EnableViewer sets (or replaces) the viewer credential. The vault is
+// re-keyed under a fresh data key so that a previously issued viewer
+// password, or a data key recovered from it, stops working.
+func (db *Database) EnableViewer(masterPassword []byte, viewerPassword string) error {
+	if viewerPassword == "" {
+		return fmt.Errorf("viewer password cannot be empty")
+	}
+	if crypto.NormalizePassword(viewerPassword) == crypto.NormalizePassword(string(masterPassword)) {
+		return fmt.Errorf("viewer password must differ from the master password")
+	}
+	if err := checkPasswordLength("viewer", viewerPassword); err != nil {
+		return err
+	}
+	if db.IsFullyEncrypted() {
+		return fmt.Errorf("viewer credential: %w", ErrFullEncryption)
+	}
+	return db.rekey(string(masterPassword), viewerPassword)
+}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("password not found: %s", name)
-		}
-		return nil, fmt.Errorf("failed to query password: %w", err)
+// DisableViewer removes the viewer credential, re-keying the vault so the
+// old viewer password can no longer unwrap anything
+func (db *Database) DisableViewer(masterPassword []byte) error {
+	return db.rekey(string(masterPassword), "")
+}
+
+// ChangeMasterPassword replaces the master password. Like the viewer
+// credential, it comes with a fresh data key: every entry is re-encrypted
+// under it in a single transaction, so a copy of the vault unlocked with
+// the old password does not hold a key to the new one. The viewer
+// password is not known here and cannot wrap the new key, so a viewer
+// credential is removed; hadViewer reports whether there was one. The new
+// password may be the old one only to move a vault in LegacyPasswordForm
+// to the normalized form.
+func (db *Database) ChangeMasterPassword(oldPassword, newPassword []byte) (hadViewer bool, err error) {
+	current, next := string(oldPassword), string(newPassword)
+	if err := db.writable(); err != nil {
+		return false, err
+	}
+	if next == "" {
+		return false, fmt.Errorf("master password cannot be empty")
+	}
+	if err := checkPasswordLength("master", next); err != nil {
+		return false, err
+	}
+	if err := db.checkMasterPassword(current); err != nil {
+		return false, err
+	}
+	if crypto.NormalizePassword(next) == crypto.NormalizePassword(current) && !db.legacyForm {
+		return false, fmt.Errorf("new master password must differ from the current one")
+	}
+	if hadViewer, err = db.HasViewer(); err != nil {
+		return false, err
 	}
 
-	// Parse timestamps
-	if entry.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
-		entry.CreatedAt = time.Now()
+	if err := db.rewrap(next, ""); err != nil {
+		return false, err
+	}
+	return hadViewer, nil
+}
+
+// rekey generates a new data key, re-encrypts every entry under it and
+// stores it wrapped under the master password and, if given, the viewer
+// password. Everything happens in a single transaction.
+func (db *Database) rekey(masterPassword, viewerPassword string) error {
+	if err := db.writable(); err != nil {
+		return err
 	}
-	if entry.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", updatedAt); err != nil {
-		entry.UpdatedAt = time.Now()
+	if err := db.checkMasterPassword(masterPassword); err != nil {
+		return err
 	}
+	return db.rewrap(masterPassword, viewerPassword)
+}
 
-	// Decrypt password
-	var encryptedPassword crypto.EncryptedData
-	if err := json.Unmarshal([]byte(passwordJSON), &encryptedPassword); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal encrypted password: %w", err)
+// rewrap does the work of rekey once the master password is checked. The
+// data key is wrapped under the normalized passwords, and a fully
+// encrypted vault sealed under the normalized master password on Close.
+func (db *Database) rewrap(masterPassword, viewerPassword string) error {
+	masterPassword = crypto.NormalizePassword(masterPassword)
+	viewerPassword = crypto.NormalizePassword(viewerPassword)
+	rawKey, err := crypto.GenerateRandomBytes(crypto.KeyLength)
+	if err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
 	}
+	newKey := base64.StdEncoding.EncodeToString(rawKey)
 
-	decryptedPassword, err := crypto.Decrypt(&encryptedPassword, db.masterPassword)
+	masterWrap, err := encryptField(newKey, masterPassword, crypto.DefaultKDF)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	var viewerWrap string
+	if viewerPassword != "" {
+		viewerWrap, err = encryptField(newKey, viewerPassword, crypto.DefaultKDF)
+		if err != nil {
+			return fmt.Errorf("failed to wrap data key: %w", err)
+		}
 	}
-	entry.Password = decryptedPassword
 
-	// Decrypt tags
-	var encryptedTags crypto.EncryptedData
-	if err := json.Unmarshal([]byte(tagsJSON), &encryptedTags); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal encrypted tags: %w", err)
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	decryptedTags, err := crypto.Decrypt(&encryptedTags, db.masterPassword)
+	if err := reencryptEntries(tx, db.dataKey, newKey, nil); err != nil {
+		return err
+	}
+	if err := setMetadataTx(tx, metaDataKeyMaster, masterWrap); err != nil {
+		return err
+	}
+	// The wrapped data key now does the verifier's job
+	if _, err := tx.Exec(`DELETE FROM metadata WHERE key = ?`, metaMasterVerifier); err != nil {
+		return fmt.Errorf("failed to remove master password verifier: %w", err)
+	}
+	if viewerPassword != "" {
+		err = setMetadataTx(tx, metaDataKeyViewer, viewerWrap)
+	} else {
+		_, err = tx.Exec(`DELETE FROM metadata WHERE key = ?`, metaDataKeyViewer)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt tags: %w", err)
+		return fmt.Errorf("failed to store viewer key: %w", err)
+	}
+	if err := setMetadataTx(tx, metaPasswordForm, passwordFormNFKC); err != nil {
+		return err
+	}
+	if err := setKDFRecordTx(tx, crypto.DefaultKDF); err != nil {
+		return err
 	}
 
-	entry.Tags = unmarshalTags(decryptedTags)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 
-	return &entry, nil
+	db.dataKey, db.randomKey = newKey, true
+	db.sealKey, db.normalized, db.legacyForm = masterPassword, true, false
+	return nil
 }
 
-// ListPasswords returns all password entries
-func (db *Database) ListPasswords() ([]*PasswordEntry, error) {
-	query := `SELECT id, name, username, encrypted_password, url, notes, encrypted_tags, created_at, updated_at 
-		FROM passwords ORDER BY name`
+// checkMasterPassword confirms the caller knows the master password
+func (db *Database) checkMasterPassword(password string) error {
+	password = db.keyForm(password)
+	masterWrap, err := db.getMetadata(metaDataKeyMaster)
+	if err != nil {
+		return err
+	}
+	if masterWrap == "" {
+		if password != db.dataKey {
+			return ErrInvalidPassword
+		}
+		return nil
+	}
+	if _, err := decryptField(masterWrap, password); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
 
-	rows, err := db.db.Query(query)
+// reencryptEntries re-encrypts the secret columns of every row from oldKey
+// to newKey within tx. Usernames, URLs and notes still stored in plaintext
+// are encrypted along the way. progress, if not nil, is called after each
+// row.
+func reencryptEntries(tx *sql.Tx, oldKey, newKey string, progress func(done, total int)) error {
+	rows, err := tx.Query(`SELECT id, username, encrypted_password, url, notes, encrypted_tags, type, encrypted_fields FROM passwords`)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query passwords: %w", err)
+		return fmt.Errorf("failed to query passwords: %w", err)
 	}
-	defer rows.Close()
 
-	var entries []*PasswordEntry
+	type row struct {
+		id           int64
+		username     sql.NullString
+		passwordJSON string
+		url          sql.NullString
+		notes        sql.NullString
+		tagsJSON     sql.NullString
+		entryType    string
+		sealed       bool
+	}
+	var all []row
 	for rows.Next() {
-		var entry PasswordEntry
-		var passwordJSON, tagsJSON string
-		var createdAt, updatedAt string
-
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Name,
-			&entry.Username,
-			&passwordJSON,
-			&entry.URL,
-			&entry.Notes,
-			&tagsJSON,
-			&createdAt,
-			&updatedAt,
-		)
-
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+		var r row
+		if err := rows.Scan(&r.id, &r.username, &r.passwordJSON, &r.url, &r.notes, &r.tagsJSON, &r.entryType, &r.sealed); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
 		}
+		all = append(all, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read passwords: %w", err)
+	}
 
-		// Parse timestamps
-		if entry.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
-			entry.CreatedAt = time.Now()
+	for i, r := range all {
+		password, err := decryptField(r.passwordJSON, oldKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt entry %d: %w", r.id, err)
 		}
-		if entry.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", updatedAt); err != nil {
-			entry.UpdatedAt = time.Now()
+		passwordJSON, err := sealField(password, newKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt entry %d: %w", r.id, err)
 		}
 
-		// Decrypt password
-		var encryptedPassword crypto.EncryptedData
-		if err := json.Unmarshal([]byte(passwordJSON), &encryptedPassword); err != nil {
-			continue // Skip invalid entries
+		tags := "[]"
+		if r.tagsJSON.Valid && r.tagsJSON.String != "" {
+			if tags, err = decryptField(r.tagsJSON.String, oldKey); err != nil {
+				return fmt.Errorf("failed to decrypt tags of entry %d: %w", r.id, err)
+			}
 		}
-
-		decryptedPassword, err := crypto.Decrypt(&encryptedPassword, db.masterPassword)
+		tagsJSON, err := sealField(tags, newKey)
 		if err != nil {
-			continue // Skip entries that can't be decrypted
+			return fmt.Errorf("failed to encrypt tags of entry %d: %w", r.id, err)
 		}
-		entry.Password = decryptedPassword
 
-		// Decrypt tags
-		var encryptedTags crypto.EncryptedData
-		if err := json.Unmarshal([]byte(tagsJSON), &encryptedTags); err != nil {
-			entry.Tags = []string{}
-		} else {
-			decryptedTags, err := crypto.Decrypt(&encryptedTags, db.masterPassword)
-			if err != nil {
-				entry.Tags = []string{}
-			} else {
-				entry.Tags = unmarshalTags(decryptedTags)
+		fields := []struct {
+			value     string
+			encrypted bool
+		}{
+			{r.username.String, r.sealed},
+			{r.url.String, r.sealed},
+			{r.notes.String, r.sealed || r.entryType == EntryTypeNote},
+		}
+		sealed := make([]string, len(fields))
+		for i, field := range fields {
+			value := field.value
+			if field.encrypted {
+				if value, err = decryptField(value, oldKey); err != nil {
+					return fmt.Errorf("failed to decrypt fields of entry %d: %w", r.id, err)
+				}
+			}
+			if sealed[i], err = sealField(value, newKey); err != nil {
+				return fmt.Errorf("failed to encrypt fields of entry %d: %w", r.id, err)
 			}
 		}
 
-		entries = append(entries, &entry)
+		if _, err := tx.Exec(`UPDATE passwords SET username = ?, encrypted_password = ?, url = ?, notes = ?,
+			encrypted_tags = ?, encrypted_fields = 1 WHERE id = ?`,
+			sealed[0], passwordJSON, sealed[1], sealed[2], tagsJSON, r.id); err != nil {
+			return fmt.Errorf("failed to update entry %d: %w", r.id, err)
+		}
+		if progress != nil {
+			progress(i+1, len(all))
+		}
 	}
 
-	return entries, nil
-}
-
-// DeletePassword deletes a password entry by name
-func (db *Database) DeletePassword(name string) error {
-	query := `DELETE FROM passwords WHERE name = ?`
-	
-	result, err := db.db.Exec(query, name)
-	if err != nil {
-		return fmt.Errorf("failed to delete password: %w", err)
+	if err := reencryptMetadata(tx, metaTOTPPrefix, oldKey, newKey); err != nil {
+		return err
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	if err := reencryptMetadata(tx, metaReuseIndex, oldKey, newKey); err != nil {
+		return err
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("password not found: %s", name)
+	if err := reencryptAcks(tx, oldKey, newKey); err != nil {
+		return err
 	}
-
-	return nil
+	if err := reencryptHistory(tx, oldKey, newKey); err != nil {
+		return err
+	}
+	if err := reencryptTrash(tx, oldKey, newKey); err != nil {
+		return err
+	}
+	if err := reencryptJournal(tx, oldKey, newKey); err != nil {
+		return err
+	}
+	return reencryptSnapshots(tx, oldKey, newKey)
 }
 
-// SearchPasswords searches for passwords by query
-func (db *Database) SearchPasswords(query string) ([]*PasswordEntry, error) {
-	searchQuery := `SELECT id, name, username, encrypted_password, url, notes, encrypted_tags, created_at, updated_at 
-		FROM passwords WHERE name LIKE ? OR username LIKE ? OR url LIKE ? ORDER BY name`
-
-	searchPattern := "%" + query + "%"
-	rows, err := db.db.Query(searchQuery, searchPattern, searchPattern, searchPattern)
+// reencryptMetadata moves the encrypted metadata values whose keys start
+// with prefix from oldKey to newKey
+func reencryptMetadata(tx *sql.Tx, prefix, oldKey, newKey string) error {
+	rows, err := tx.Query(`SELECT key, value FROM metadata WHERE substr(key, 1, ?) = ?`, len(prefix), prefix)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search passwords: %w", err)
+		return fmt.Errorf("failed to query metadata: %w", err)
 	}
-	defer rows.Close()
-
-	var entries []*PasswordEntry
+	values := make(map[string]string)
 	for rows.Next() {
-		var entry PasswordEntry
-		var passwordJSON, tagsJSON string
-		var createdAt, updatedAt string
-
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Name,
-			&entry.Username,
-			&passwordJSON,
-			&entry.URL,
-			&entry.Notes,
-			&tagsJSON,
-			&createdAt,
-			&updatedAt,
-		)
-
-		if err != nil {
-			continue
-		}
-
-		// Parse timestamps
-		if entry.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
-			entry.CreatedAt = time.Now()
-		}
-		if entry.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", updatedAt); err != nil {
-			entry.UpdatedAt = time.Now()
-		}
-
-		// Decrypt password
-		var encryptedPassword crypto.EncryptedData
-		if err := json.Unmarshal([]byte(passwordJSON), &encryptedPassword); err != nil {
-			continue
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan metadata: %w", err)
 		}
+		values[key] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
 
-		decryptedPassword, err := crypto.Decrypt(&encryptedPassword, db.masterPassword)
+	for key, value := range values {
+		plaintext, err := decryptField(value, oldKey)
 		if err != nil {
-			continue
+			return fmt.Errorf("failed to decrypt %s: %w", key, err)
 		}
-		entry.Password = decryptedPassword
-
-		// Decrypt tags
-		var encryptedTags crypto.EncryptedData
-		if err := json.Unmarshal([]byte(tagsJSON), &encryptedTags); err != nil {
-			entry.Tags = []string{}
-		} else {
-			decryptedTags, err := crypto.Decrypt(&encryptedTags, db.masterPassword)
-			if err != nil {
-				entry.Tags = []string{}
-			} else {
-				entry.Tags = unmarshalTags(decryptedTags)
-			}
+		if value, err = sealField(plaintext, newKey); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", key, err)
+		}
+		if err := setMetadataTx(tx, key, value); err != nil {
+			return err
 		}
-
-		entries = append(entries, &entry)
 	}
-
-	return entries, nil
+	return nil
 }
 
-// GetStats returns database statistics
-func (db *Database) GetStats() (map[string]interface{}, error) {
-	query := `SELECT COUNT(*) FROM passwords`
-	
-	var count int
-	err := db.db.QueryRow(query).Scan(&count)
+// getMetadata returns the metadata value for key, or "" if it is unset
+func (db *Database) getMetadata(key string) (string, error) {
+	var value string
+	err := db.db.QueryRow(`SELECT value FROM metadata WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get password count: %w", err)
+		return "", fmt.Errorf("failed to read metadata %s: %w", key, err)
 	}
+	return value, nil
+}
 
-	// Get file size
-	fileInfo, err := os.Stat(db.dbPath)
+// setMetadataTx stores a metadata value within tx
+func setMetadataTx(tx *sql.Tx, key, value string) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`, key, value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return fmt.Errorf("failed to write metadata %s: %w", key, err)
 	}
-
+	return nil
+}
+
+// encryptField encrypts plaintext under a key derived from password with
+// kdf, and returns the JSON form stored in the database
+func encryptField(plaintext, password string, kdf crypto.KDFParams) (string, error) {
+	encrypted, err := crypto.EncryptWithParams(plaintext, password, kdf)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// sealField encrypts plaintext directly under dataKey, a random data key,
+// and returns the JSON form stored in the database. No key is derived, so
+// reading it back costs no more than the decryption itself.
+func sealField(plaintext, dataKey string) (string, error) {
+	key, err := rawDataKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := crypto.EncryptWithKey(key, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encryptValue encrypts a field of the vault: directly under a random data
+// key, or in a legacy vault under a key derived from the master password
+// for each value, as those vaults have no data key to use
+func (db *Database) encryptValue(plaintext string) (string, error) {
+	if db.randomKey {
+		return sealField(plaintext, db.dataKey)
+	}
+	return encryptField(plaintext, db.dataKey, crypto.DefaultKDF)
+}
+
+// rawDataKey decodes a random data key as stored in its wraps
+func rawDataKey(dataKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(dataKey)
+	if err != nil || len(key) != crypto.KeyLength {
+		return nil, errors.New("invalid data key")
+	}
+	return key, nil
+}
+
+// decryptField decrypts a JSON-encoded encrypted value produced by
+// encryptField or sealField
+func decryptField(data, key string) (string, error) {
+	var encrypted crypto.EncryptedData
+	if err := json.Unmarshal([]byte(data), &encrypted); err != nil {
+		return "", fmt.Errorf("failed to unmarshal encrypted data: %w", err)
+	}
+	return decryptData(&encrypted, key)
+}
+
+// decryptData decrypts a value encrypted under key, telling the formats
+// apart by the salt: values from sealField have none and use key directly,
+// while older values, and those of legacy vaults, derive a key from it
+func decryptData(encrypted *crypto.EncryptedData, key string) (string, error) {
+	plaintext, err := decryptDataBytes(encrypted, key)
+	if err != nil {
+		return "", err
+	}
+	defer crypto.NewSecretString(plaintext).Wipe()
+	return string(plaintext), nil
+}
+
+// decryptDataBytes is decryptData returning the plaintext as a byte slice
+func decryptDataBytes(encrypted *crypto.EncryptedData, key string) ([]byte, error) {
+	if len(encrypted.Salt) > 0 {
+		return crypto.DecryptBytes(encrypted, key)
+	}
+	raw, err := rawDataKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptWithKey(raw, encrypted)
+}
+
+// Close closes the database connection. A fully encrypted vault is
+// re-sealed first; if that fails the file keeps its previous contents.
+func (db *Database) Close() error {
+	if db.db == nil {
+		return nil
+	}
+	db.cache.clear()
+	if db.memory != nil {
+		db.db.Close()
+		return db.memory.Close()
+	}
+	if db.workPath == "" {
+		return db.db.Close()
+	}
+
+	defer db.discard()
+	if err := db.db.Close(); err != nil {
+		return err
+	}
+	// Sealing over a file that is not the one opened, as on a stale mount
+	// point, would lose both
+	if err := db.writable(); errors.Is(err, ErrVaultUnavailable) {
+		return fmt.Errorf("changes were not saved: %w", err)
+	} else if err != nil {
+		return nil
+	}
+	if err := seal(db.workPath, db.dbPath, db.sealKey); err != nil {
+		return fmt.Errorf("changes were not saved: %w", err)
+	}
+	return nil
+}
+
+// discard closes the connection without saving, removes the working
+// copy of a fully encrypted vault and releases its lock
+func (db *Database) discard() {
+	db.db.Close()
+	if db.workPath != "" {
+		removeWorkCopy(db.workPath)
+	}
+	db.lock.Unlock()
+}
+
+// SchemaVersion identifies the table layout initSchema creates. Backups
+// record it; it is bumped whenever a table or column is added.
+const SchemaVersion = 5
+
+// initSchema creates the database tables if they don't exist
+func (db *Database) initSchema() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS passwords (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			username TEXT,
+			encrypted_password TEXT NOT NULL,
+			url TEXT,
+			notes TEXT,
+			encrypted_tags TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS metadata (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_passwords_username ON passwords(username)`,
+		`CREATE TABLE IF NOT EXISTS strength_cache (
+			entry_id INTEGER PRIMARY KEY,
+			score INTEGER NOT NULL,
+			level TEXT NOT NULL,
+			analyzed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS favicons (
+			entry_id INTEGER PRIMARY KEY,
+			content_type TEXT NOT NULL,
+			data BLOB NOT NULL,
+			fetched_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS sync_conflicts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			local_updated_at TEXT NOT NULL,
+			remote_updated_at TEXT NOT NULL,
+			winner TEXT NOT NULL,
+			snapshot TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			restored_at TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_acks (
+			entry_id INTEGER NOT NULL,
+			finding TEXT NOT NULL,
+			data TEXT NOT NULL,
+			acked_at DATETIME NOT NULL,
+			PRIMARY KEY (entry_id, finding)
+		)`,
+		`CREATE TABLE IF NOT EXISTS password_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entry_id INTEGER NOT NULL,
+			encrypted_password TEXT NOT NULL,
+			recipients TEXT,
+			replaced_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_password_history_entry ON password_history(entry_id)`,
+		`CREATE TABLE IF NOT EXISTS trash (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			snapshot TEXT NOT NULL,
+			encrypted_password TEXT NOT NULL,
+			recipients TEXT,
+			deleted_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_trash_name ON trash(name)`,
+		`CREATE TABLE IF NOT EXISTS operations (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			pruned INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS operation_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			operation_id TEXT NOT NULL,
+			entry_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			change TEXT NOT NULL,
+			after_digest TEXT NOT NULL,
+			before_snapshot TEXT,
+			before_password TEXT,
+			before_recipients TEXT,
+			rolled_back_at TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_operation_entries_operation ON operation_entries(operation_id)`,
+	}
+
+	for _, query := range queries {
+		if _, err := db.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query '%s': %w", query, err)
+		}
+	}
+
+	err := db.addMissingColumns("passwords", map[string]string{
+		"recipients":       "TEXT",
+		"last_accessed_at": "DATETIME",
+		"type":             "TEXT NOT NULL DEFAULT 'login'",
+		"icon":             "TEXT NOT NULL DEFAULT ''",
+		"encrypted_fields": "INTEGER NOT NULL DEFAULT 0",
+		"expires_at":       "DATETIME",
+	})
+	if err != nil {
+		return err
+	}
+	// Only after the column is added to vaults from before it
+	if _, err := db.db.Exec(`CREATE INDEX IF NOT EXISTS idx_passwords_expires_at ON passwords(expires_at)`); err != nil {
+		return fmt.Errorf("failed to index expiry dates: %w", err)
+	}
+	return db.uniqueNames()
+}
+
+// uniqueNames adds the unique index on entry names. Vaults from before it
+// may hold several entries of one name, as saving again added a row; only
+// the most recently updated of them is kept.
+func (db *Database) uniqueNames() error {
+	var indexed bool
+	err := db.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'index' AND name = 'idx_passwords_name_unique')`).Scan(&indexed)
+	if err != nil {
+		return fmt.Errorf("failed to inspect indexes: %w", err)
+	}
+	if indexed {
+		return nil
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	superseded := `SELECT id FROM passwords p WHERE EXISTS (SELECT 1 FROM passwords q
+		WHERE q.name = p.name AND (q.updated_at > p.updated_at OR (q.updated_at = p.updated_at AND q.id > p.id)))`
+	for _, query := range []string{
+		`DELETE FROM strength_cache WHERE entry_id IN (` + superseded + `)`,
+		`DELETE FROM favicons WHERE entry_id IN (` + superseded + `)`,
+		`DELETE FROM audit_acks WHERE entry_id IN (` + superseded + `)`,
+		`DELETE FROM password_history WHERE entry_id IN (` + superseded + `)`,
+		`DELETE FROM passwords WHERE id IN (` + superseded + `)`,
+		`DROP INDEX IF EXISTS idx_passwords_name`,
+		`CREATE UNIQUE INDEX idx_passwords_name_unique ON passwords(name)`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to make entry names unique: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// addMissingColumns adds the given columns to table unless they exist,
+// upgrading vaults created by older versions
+func (db *Database) addMissingColumns(table string, columns map[string]string) error {
+	rows, err := db.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for column, definition := range columns {
+		if existing[column] {
+			continue
+		}
+		if _, err := db.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+// SetTagger sets what adjusts the tags of entries passed to SavePassword
+// and UpdatePassword
+func (db *Database) SetTagger(tagger Tagger) {
+	db.tagger = tagger
+}
+
+// SetCollator sets the order listings give entries in by name
+func (db *Database) SetCollator(collator *collation.Collator) {
+	db.collator = collator
+	db.cache.clear()
+}
+
+// SavePassword saves a new entry. A name that is taken is ErrEntryExists,
+// also when another session takes it between the check and the insert:
+// the unique index on names decides, so of two saves of one name only one
+// succeeds. Replacing an entry goes through UpdatePassword, EditPassword
+// or SaveOrUpdate.
+func (db *Database) SavePassword(entry *PasswordEntry) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	defer db.names.lock(entry.Name)()
+	if exists, err := db.hasEntry(entry.Name); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrEntryExists, entry.Name)
+	}
+
+	row, err := db.encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := insertEntry(tx, entry, row); err != nil {
+		return err
+	}
+	if err := db.updateReuseIndex(tx, []*PasswordEntry{entry}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SaveOrUpdate stores entry under its name whether or not an entry is
+// called that: a new name is inserted as by SavePassword, and an entry
+// already there is rewritten in place as by UpdatePassword, keeping its
+// creation time and the password it replaces in the history. entry.ID is
+// set to that of the stored entry. Concurrent calls for one name are last
+// writer wins: each is applied whole, one after the other, so the entry
+// ends up as the last call left it and each earlier password is in its
+// history, up to the history limit.
+func (db *Database) SaveOrUpdate(entry *PasswordEntry) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	defer db.names.lock(entry.Name)()
+
+	row, err := db.encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM passwords WHERE name = ?`, entry.Name).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		entry.ID = 0
+		err = insertEntry(tx, entry, row)
+	case err != nil:
+		return fmt.Errorf("failed to look up entry: %w", err)
+	default:
+		entry.ID = id
+		err = db.updateEntry(tx, entry, row)
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.updateReuseIndex(tx, []*PasswordEntry{entry}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// hasEntry reports whether an entry called name exists
+func (db *Database) hasEntry(name string) (bool, error) {
+	var exists bool
+	if err := db.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM passwords WHERE name = ?)`, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up entry: %w", err)
+	}
+	return exists, nil
+}
+
+// execer runs statements on the database or within a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertEntry stores an encoded new entry and sets its ID
+func insertEntry(ex execer, entry *PasswordEntry, row *entryRow) error {
+	query := `INSERT INTO passwords 
+		(name, username, encrypted_password, url, notes, encrypted_tags, recipients, type, icon, encrypted_fields, expires_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	result, err := ex.Exec(query, 
+		entry.Name, 
+		row.username, 
+		row.password, 
+		row.url, 
+		row.notes, 
+		row.tags,
+		row.recipients,
+		row.entryType,
+		entry.Icon,
+		row.sealedFields,
+		expiryValue(entry.ExpiresAt))
+	
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrEntryExists, entry.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save password: %w", err)
+	}
+
+	// Get the ID if it's a new entry
+	if entry.ID == 0 {
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+		entry.ID = id
+	}
+
+	return insertAcks(ex, entry.ID, row.acks)
+}
+
+// isUniqueViolation reports whether err is SQLite refusing a row that
+// repeats a unique column, such as a name another entry has
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// UpdatePassword rewrites the stored entry with entry's ID in place,
+// keeping its creation time, cached strength grade and autotype sequence
+func (db *Database) UpdatePassword(entry *PasswordEntry) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	defer db.names.lock(entry.Name)()
+	return db.updatePassword(entry)
+}
+
+// updatePassword is UpdatePassword for callers holding the lock of the
+// name of entry
+func (db *Database) updatePassword(entry *PasswordEntry) error {
+	row, err := db.encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := db.updateEntry(tx, entry, row); err != nil {
+		return err
+	}
+	if err := db.updateReuseIndex(tx, []*PasswordEntry{entry}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// EditPassword changes the fields set in updates on the entry called
+// name; empty fields, and nil tags and expiry, are left as they are. Like
+// UpdatePassword it keeps the creation time and bumps the change time,
+// and unlike SavePassword it never creates an entry.
+func (db *Database) EditPassword(name string, updates *PasswordEntry) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	// The entry is read and written back as one change
+	defer db.names.lock(name)()
+
+	if exists, err := db.hasEntry(name); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	entry, err := db.GetPassword(name)
+	if err != nil {
+		return err
+	}
+
+	if updates.Username != "" {
+		entry.Username = updates.Username
+	}
+	if updates.Password != "" {
+		entry.Password = updates.Password
+	}
+	if updates.URL != "" {
+		entry.URL = updates.URL
+	}
+	if updates.Notes != "" {
+		entry.Notes = updates.Notes
+	}
+	if updates.Icon != "" {
+		entry.Icon = updates.Icon
+	}
+	if updates.Tags != nil {
+		entry.Tags = updates.Tags
+	}
+	if updates.ExpiresAt != nil {
+		entry.ExpiresAt = updates.ExpiresAt
+	}
+	return db.updatePassword(entry)
+}
+
+// updateEntry rewrites the stored entry with entry's ID from its encoded
+// form, keeping the password it replaces in the history
+func (db *Database) updateEntry(tx *sql.Tx, entry *PasswordEntry, row *entryRow) error {
+	if err := db.archivePassword(tx, entry); err != nil {
+		return err
+	}
+	query := `UPDATE passwords SET name = ?, username = ?, encrypted_password = ?, url = ?, notes = ?,
+		encrypted_tags = ?, recipients = ?, type = ?, icon = ?, encrypted_fields = ?, expires_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`
+	result, err := tx.Exec(query, entry.Name, row.username, row.password, row.url, row.notes,
+		row.tags, row.recipients, row.entryType, entry.Icon, row.sealedFields, expiryValue(entry.ExpiresAt), entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, entry.Name)
+	}
+	return nil
+}
+
+// entryRow holds the stored form of an entry's encrypted columns
+type entryRow struct {
+	entryType  string
+	username   string
+	url        string
+	notes      string
+	password   string
+	tags       string
+	recipients interface{}
+	// sealedFields is set when username, url and notes are encrypted
+	sealedFields bool
+	acks         []ackRow
+}
+
+// encodeEntry validates the type of an entry, applies the tagger and
+// encrypts its columns
+func (db *Database) encodeEntry(entry *PasswordEntry) (*entryRow, error) {
+	entryType := entry.Type
+	switch entryType {
+	case "":
+		entryType = EntryTypeLogin
+	case EntryTypeLogin:
+	case EntryTypeNote:
+		if len(entry.Recipients) > 0 {
+			return nil, ErrNoteRecipients
+		}
+	default:
+		return nil, fmt.Errorf("unknown entry type: %s", entry.Type)
+	}
+	if db.tagger != nil {
+		if err := db.tagger.Tag(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// Under a random data key the username, URL and notes are encrypted
+	// too. Legacy vaults keep them in plaintext, except the body of a
+	// note, until they are moved to one.
+	row := &entryRow{
+		entryType:    entryType,
+		username:     entry.Username,
+		url:          entry.URL,
+		notes:        entry.Notes,
+		sealedFields: db.randomKey,
+	}
+	if row.sealedFields || entryType == EntryTypeNote {
+		var err error
+		if row.notes, err = db.encryptValue(entry.Notes); err != nil {
+			return nil, fmt.Errorf("failed to encrypt notes: %w", err)
+		}
+	}
+	if row.sealedFields {
+		var err error
+		if row.username, err = sealField(entry.Username, db.dataKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt username: %w", err)
+		}
+		if row.url, err = sealField(entry.URL, db.dataKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt URL: %w", err)
+		}
+	}
+
+	// Wrap the password to its recipients, if any, then encrypt it
+	secret, recipientsJSON, err := sealSecret(entry.Password, entry.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	passwordJSON, err := db.encryptValue(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	// Encrypt tags
+	tagsJSON, err := db.encryptValue(string(marshalTags(entry.Tags)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt tags: %w", err)
+	}
+
+	for i := range entry.Acks {
+		ack, err := db.encodeAck(&entry.Acks[i])
+		if err != nil {
+			return nil, err
+		}
+		row.acks = append(row.acks, ack)
+	}
+
+	row.password, row.tags, row.recipients = passwordJSON, tagsJSON, recipientsJSON
+	return row, nil
+}
+
+// GetPassword retrieves a password entry by name
+func (db *Database) GetPassword(name string) (*PasswordEntry, error) {
+	entry, secret, err := db.GetSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	entry.Password = string(secret.Reveal())
+	secret.Wipe()
+	return entry, nil
+}
+
+// GetSecret retrieves an entry by name like GetPassword, but leaves its
+// Password empty and returns the password on its own, decrypted straight
+// into a SecretString the caller wipes once done. Viewer sessions get a
+// nil secret.
+func (db *Database) GetSecret(name string) (*PasswordEntry, *crypto.SecretString, error) {
+	query := `SELECT ` + entryColumns + ` FROM passwords WHERE name = ?`
+
+	var entry PasswordEntry
+	var passwordJSON, tagsJSON string
+	var createdAt, updatedAt string
+	var recipientsJSON, lastAccessedAt, expiresAt sql.NullString
+	var sealedFields bool
+
+	err := db.db.QueryRow(query, name).Scan(
+		&entry.ID,
+		&entry.Name,
+		&entry.Username,
+		&passwordJSON,
+		&entry.URL,
+		&entry.Notes,
+		&tagsJSON,
+		&createdAt,
+		&updatedAt,
+		&recipientsJSON,
+		&lastAccessedAt,
+		&entry.Type,
+		&entry.Icon,
+		&sealedFields,
+		&expiresAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+		}
+		return nil, nil, fmt.Errorf("failed to query password: %w", err)
+	}
+
+	// Parse timestamps
+	entry.CreatedAt = parseTimestamp(createdAt)
+	entry.UpdatedAt = parseTimestamp(updatedAt)
+	entry.Recipients = unmarshalTags(recipientsJSON.String)
+	if lastAccessedAt.Valid {
+		entry.LastAccessedAt = parseTimestamp(lastAccessedAt.String)
+	}
+	entry.ExpiresAt = parseExpiry(expiresAt)
+	if err := db.openFields(&entry, sealedFields); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", entry.Name, err)
+	}
+
+	// Decrypt password (never for viewer sessions)
+	var secret *crypto.SecretString
+	if !db.viewer {
+		var encryptedPassword crypto.EncryptedData
+		if err := json.Unmarshal([]byte(passwordJSON), &encryptedPassword); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal encrypted password: %w", err)
+		}
+
+		decryptedPassword, err := decryptDataBytes(&encryptedPassword, db.dataKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt password: %w", err)
+		}
+		if secret, err = db.openSecretBytes(&entry, decryptedPassword); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+	if err := db.openNote(&entry); err != nil {
+		secret.Wipe()
+		return nil, nil, fmt.Errorf("failed to decrypt note: %w", err)
+	}
+
+	// Decrypt tags
+	var encryptedTags crypto.EncryptedData
+	if err := json.Unmarshal([]byte(tagsJSON), &encryptedTags); err != nil {
+		secret.Wipe()
+		return nil, nil, fmt.Errorf("failed to unmarshal encrypted tags: %w", err)
+	}
+
+	decryptedTags, err := decryptData(&encryptedTags, db.dataKey)
+	if err != nil {
+		secret.Wipe()
+		return nil, nil, fmt.Errorf("failed to decrypt tags: %w", err)
+	}
+
+	entry.Tags = unmarshalTags(decryptedTags)
+
+	db.sealPlainFields([]*PasswordEntry{&entry})
+	return &entry, secret, nil
+}
+
+// ListPasswords returns all password entries
+func (db *Database) ListPasswords() ([]*PasswordEntry, error) {
+	return db.listEntries(true)
+}
+
+// ListMetadata returns all entries without decrypting their passwords or
+// note bodies, for callers that only look at metadata. The listing is
+// cached for the session until the vault changes.
+func (db *Database) ListMetadata() ([]*PasswordEntry, error) {
+	stamp, err := os.Stat(db.dbPath)
+	if err != nil {
+		return db.listEntries(false)
+	}
+	if entries, ok := db.cache.get(stamp); ok {
+		return entries, nil
+	}
+
+	entries, err := db.listEntries(false)
+	if err != nil {
+		return nil, err
+	}
+	db.cache.put(entries, stamp)
+	return entries, nil
+}
+
+// entryColumns are the columns scanEntry reads, in order
+const entryColumns = `id, name, username, encrypted_password, url, notes, encrypted_tags, created_at, updated_at, recipients, last_accessed_at, type, icon, encrypted_fields, expires_at`
+
+// listEntries returns all entries in the order of the collator,
+// decrypting secrets if asked to, and encrypts the fields of any still
+// stored in plaintext
+func (db *Database) listEntries(secrets bool) ([]*PasswordEntry, error) {
+	rows, err := db.db.Query(`SELECT ` + entryColumns + ` FROM passwords ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*PasswordEntry
+	for rows.Next() {
+		entry, ok, err := db.scanEntry(rows, secrets)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read passwords: %w", err)
+	}
+	rows.Close()
+
+	if secrets && !db.viewer {
+		if err := db.loadAcks(entries); err != nil {
+			return nil, err
+		}
+	}
+	db.sealPlainFields(entries)
+	collation.Of(db.collator).Slice(entries, func(i int) string { return entries[i].Name })
+	return entries, nil
+}
+
+// scanEntry reads a row of entryColumns, decrypting secrets if asked to.
+// ok is false for rows whose secrets cannot be decrypted, which listings
+// skip; the entry still carries their ID and name.
+func (db *Database) scanEntry(rows *sql.Rows, secrets bool) (entry *PasswordEntry, ok bool, err error) {
+	entry = &PasswordEntry{}
+	var passwordJSON, tagsJSON string
+	var createdAt, updatedAt string
+	var recipientsJSON, lastAccessedAt, expiresAt sql.NullString
+	var sealedFields bool
+
+	err = rows.Scan(
+		&entry.ID,
+		&entry.Name,
+		&entry.Username,
+		&passwordJSON,
+		&entry.URL,
+		&entry.Notes,
+		&tagsJSON,
+		&createdAt,
+		&updatedAt,
+		&recipientsJSON,
+		&lastAccessedAt,
+		&entry.Type,
+		&entry.Icon,
+		&sealedFields,
+		&expiresAt,
+	)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	// Parse timestamps
+	entry.CreatedAt = parseTimestamp(createdAt)
+	entry.UpdatedAt = parseTimestamp(updatedAt)
+	entry.Recipients = unmarshalTags(recipientsJSON.String)
+	if lastAccessedAt.Valid {
+		entry.LastAccessedAt = parseTimestamp(lastAccessedAt.String)
+	}
+	entry.ExpiresAt = parseExpiry(expiresAt)
+	if db.openFields(entry, sealedFields) != nil {
+		return entry, false, nil // Skip entries that can't be decrypted
+	}
+
+	// Decrypt password (never for viewer sessions)
+	if secrets && !db.viewer {
+		var encryptedPassword crypto.EncryptedData
+		if err := json.Unmarshal([]byte(passwordJSON), &encryptedPassword); err != nil {
+			return entry, false, nil // Skip invalid entries
+		}
+
+		decryptedPassword, err := decryptData(&encryptedPassword, db.dataKey)
+		if err != nil {
+			return entry, false, nil // Skip entries that can't be decrypted
+		}
+		if db.openSecret(entry, decryptedPassword) != nil {
+			entry.Locked = true
+		}
+	}
+	if !secrets {
+		if entry.IsNote() {
+			entry.Notes = ""
+		}
+	} else if db.openNote(entry) != nil {
+		return entry, false, nil // Skip notes that can't be decrypted
+	}
+
+	// Decrypt tags
+	var encryptedTags crypto.EncryptedData
+	if err := json.Unmarshal([]byte(tagsJSON), &encryptedTags); err != nil {
+		entry.Tags = []string{}
+	} else {
+		decryptedTags, err := decryptData(&encryptedTags, db.dataKey)
+		if err != nil {
+			entry.Tags = []string{}
+		} else {
+			entry.Tags = unmarshalTags(decryptedTags)
+		}
+	}
+
+	return entry, true, nil
+}
+
+// DeletePassword moves the entry called name to the trash, from which
+// Restore brings it back
+func (db *Database) DeletePassword(name string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	row, err := db.trashRowOf(name, true)
+	if err != nil {
+		return err
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := db.trashEntry(tx, row); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeletePermanently deletes the entry called name without keeping it in
+// the trash
+func (db *Database) DeletePermanently(name string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := db.deleteEntry(tx, name); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// deleteEntry removes the entry called name within tx, with everything
+// kept about it elsewhere
+func (db *Database) deleteEntry(tx *sql.Tx, name string) error {
+	if _, err := tx.Exec(`DELETE FROM strength_cache WHERE entry_id IN (SELECT id FROM passwords WHERE name = ?)`, name); err != nil {
+		return fmt.Errorf("failed to delete strength cache: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM favicons WHERE entry_id IN (SELECT id FROM passwords WHERE name = ?)`, name); err != nil {
+		return fmt.Errorf("failed to delete icon: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audit_acks WHERE entry_id IN (SELECT id FROM passwords WHERE name = ?)`, name); err != nil {
+		return fmt.Errorf("failed to delete acknowledgements: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE entry_id IN (SELECT id FROM passwords WHERE name = ?)`, name); err != nil {
+		return fmt.Errorf("failed to delete password history: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM metadata WHERE key = ?`, metaAutotypePrefix+name); err != nil {
+		return fmt.Errorf("failed to delete autotype sequence: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM metadata WHERE key = ?`, metaTOTPPrefix+name); err != nil {
+		return fmt.Errorf("failed to delete TOTP settings: %w", err)
+	}
+	var ids []int64
+	rows, err := tx.Query(`SELECT id FROM passwords WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to look up password: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := db.updateReuseIndex(tx, nil, ids...); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM passwords WHERE name = ?`
+	
+	result, err := tx.Exec(query, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete password: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+
+	return nil
+}
+
+// SearchPasswords returns the entries whose name, username, URL, notes
+// or tags contain query, ignoring case. It is SearchPasswordsAdvanced
+// with the default options.
+func (db *Database) SearchPasswords(query string) ([]*PasswordEntry, error) {
+	matches, err := db.SearchPasswordsAdvanced(query, SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*PasswordEntry, len(matches))
+	for i, match := range matches {
+		entries[i] = match.Entry
+	}
+	return entries, nil
+}
+
+// FindByURL returns the entries, without their secrets, whose URL is on
+// the same host as rawURL, ignoring a leading www. Several accounts on
+// one site are all returned, the most recently used first.
+func (db *Database) FindByURL(rawURL string) ([]*PasswordEntry, error) {
+	host := suggest.Host(rawURL)
+	if host == "" {
+		return nil, nil
+	}
+	entries, err := db.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	var found []*PasswordEntry
+	for _, entry := range entries {
+		if entry.URL != "" && suggest.Host(entry.URL) == host {
+			found = append(found, entry)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i].LastAccessedAt, found[j].LastAccessedAt
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return collation.Of(db.collator).Less(found[i].Name, found[j].Name)
+	})
+	return found, nil
+}
+
+// GetStats returns database statistics
+func (db *Database) GetStats() (map[string]interface{}, error) {
+	query := `SELECT COUNT(*) FROM passwords`
+	
+	var count int
+	err := db.db.QueryRow(query).Scan(&count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password count: %w", err)
+	}
+
+	// Vaults older than the initialized marker fall back to the file time
+	createdAt, err := db.initializedAt()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get file size; a vault held in memory, which has no path, reports
+	// the size of its pages
+	var size int64
+	if db.dbPath == "" {
+		err = db.db.QueryRow(`SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`).Scan(&size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get database size: %w", err)
+		}
+	} else {
+		fileInfo, err := os.Stat(db.dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file info: %w", err)
+		}
+		size = fileInfo.Size()
+		if createdAt.IsZero() {
+			createdAt = fileInfo.ModTime()
+		}
+	}
+
 	stats := map[string]interface{}{
 		"total_passwords": count,
-		"database_size":   fileInfo.Size(),
-		"created_at":      fileInfo.ModTime(),
+		"database_size":   size,
+		"created_at":      createdAt,
+		"full_encryption": db.IsFullyEncrypted(),
 	}
 
 	return stats, nil
 }
 
+// SetIdentities sets the age identities used to read passwords encrypted
+// to recipients
+func (db *Database) SetIdentities(identities []age.Identity) {
+	db.identities = identities
+}
+
+// sealSecret wraps password to recipients and returns the value to
+// encrypt and the recipients column. Without recipients the password is
+// returned unchanged and the column is NULL.
+func sealSecret(password string, recipients []string) (string, interface{}, error) {
+	if len(recipients) == 0 {
+		return password, nil, nil
+	}
+	wrapped, err := recipient.Wrap(password, recipients)
+	if err != nil {
+		return "", nil, err
+	}
+	return wrapped, string(marshalTags(recipients)), nil
+}
+
+// openSecretBytes returns the password of entry from the decrypted
+// password column, which it takes over, like openSecret
+func (db *Database) openSecretBytes(entry *PasswordEntry, decrypted []byte) (*crypto.SecretString, error) {
+	if len(entry.Recipients) == 0 {
+		return crypto.NewSecretString(decrypted), nil
+	}
+	secret, err := recipient.UnwrapBytes(string(decrypted), db.identities)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewSecretString(secret), nil
+}
+
+// openSecret sets entry.Password from the decrypted password column,
+// unwrapping it with the loaded identities if the entry has recipients
+func (db *Database) openSecret(entry *PasswordEntry, decrypted string) error {
+	if len(entry.Recipients) == 0 {
+		entry.Password = decrypted
+		return nil
+	}
+	secret, err := recipient.Unwrap(decrypted, db.identities)
+	if err != nil {
+		return err
+	}
+	entry.Password = secret
+	return nil
+}
+
+// openFields decrypts the username, URL and, for logins, notes of an
+// entry in place when sealed says its row stores them encrypted. Rows
+// from before they were are marked for sealPlainFields instead.
+func (db *Database) openFields(entry *PasswordEntry, sealed bool) error {
+	if !sealed {
+		entry.plainFields = true
+		return nil
+	}
+	var err error
+	if entry.Username, err = decryptField(entry.Username, db.dataKey); err != nil {
+		return fmt.Errorf("failed to decrypt username: %w", err)
+	}
+	if entry.URL, err = decryptField(entry.URL, db.dataKey); err != nil {
+		return fmt.Errorf("failed to decrypt URL: %w", err)
+	}
+	if !entry.IsNote() {
+		if entry.Notes, err = decryptField(entry.Notes, db.dataKey); err != nil {
+			return fmt.Errorf("failed to decrypt notes: %w", err)
+		}
+	}
+	return nil
+}
+
+// sealPlainFields encrypts the username, URL and notes of entries read
+// from rows that still store them in plaintext, as vaults from before
+// they were encrypted do. It only rewrites those columns, leaving
+// updated_at alone. Reads never fail because of it: rows it cannot
+// rewrite, say in a viewer session, are tried again when next read.
+// Legacy vaults keep plaintext fields until they are moved to a random
+// data key, which encrypts them all.
+func (db *Database) sealPlainFields(entries []*PasswordEntry) {
+	if !db.randomKey || db.writable() != nil || db.IsMemory() {
+		return
+	}
+	var plain []*PasswordEntry
+	for _, entry := range entries {
+		if entry.plainFields {
+			plain = append(plain, entry)
+		}
+	}
+	if len(plain) == 0 {
+		return
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for _, entry := range plain {
+		username, err := sealField(entry.Username, db.dataKey)
+		if err != nil {
+			return
+		}
+		url, err := sealField(entry.URL, db.dataKey)
+		if err != nil {
+			return
+		}
+		// The body of a note is encrypted already
+		query := `UPDATE passwords SET username = ?, url = ?, encrypted_fields = 1 WHERE id = ? AND encrypted_fields = 0`
+		args := []interface{}{username, url, entry.ID}
+		if !entry.IsNote() {
+			notes, err := sealField(entry.Notes, db.dataKey)
+			if err != nil {
+				return
+			}
+			query = `UPDATE passwords SET username = ?, url = ?, notes = ?, encrypted_fields = 1 WHERE id = ? AND encrypted_fields = 0`
+			args = []interface{}{username, url, notes, entry.ID}
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return
+		}
+	}
+	if tx.Commit() != nil {
+		return
+	}
+	for _, entry := range plain {
+		entry.plainFields = false
+	}
+}
+
+// openNote decrypts the body of a note in place. Viewer sessions never
+// see it, like passwords.
+func (db *Database) openNote(entry *PasswordEntry) error {
+	if !entry.IsNote() {
+		return nil
+	}
+	if db.viewer {
+		entry.Notes = ""
+		return nil
+	}
+	notes, err := decryptField(entry.Notes, db.dataKey)
+	if err != nil {
+		return err
+	}
+	entry.Notes = notes
+	return nil
+}
+
+// MarkAccessed records that the password of an entry was just read.
+// Viewer sessions never see passwords, and like sessions on a vault
+// awaiting Upgrade they record nothing.
+func (db *Database) MarkAccessed(name string) error {
+	if db.writable() != nil {
+		return nil
+	}
+	db.cache.clear()
+	if _, err := db.db.Exec(`UPDATE passwords SET last_accessed_at = CURRENT_TIMESTAMP WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("failed to record access: %w", err)
+	}
+	return nil
+}
+
+// Recipients returns the recipients of an entry without decrypting it
+func (db *Database) Recipients(name string) ([]string, error) {
+	var recipientsJSON sql.NullString
+	err := db.db.QueryRow(`SELECT recipients FROM passwords WHERE name = ?`, name).Scan(&recipientsJSON)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recipients: %w", err)
+	}
+	return unmarshalTags(recipientsJSON.String), nil
+}
+
+// SetRecipients re-wraps the password of an entry to a new set of
+// recipients without changing it. An empty set removes the extra layer.
+// Changing the recipients of a wrapped entry needs one of its identities.
+// SetTags replaces the tags of the named entry as they are, without the
+// tagger and without changing its update time
+func (db *Database) SetTags(name string, tags []string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	tagsJSON, err := db.encryptValue(string(marshalTags(tags)))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt tags: %w", err)
+	}
+	db.cache.clear()
+	result, err := db.db.Exec(`UPDATE passwords SET encrypted_tags = ? WHERE name = ?`, tagsJSON, name)
+	if err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	return nil
+}
+
+func (db *Database) SetRecipients(name string, recipients []string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	entry, err := db.GetPassword(name)
+	if err != nil {
+		return err
+	}
+	if entry.IsNote() && len(recipients) > 0 {
+		return ErrNoteRecipients
+	}
+	secret, recipientsJSON, err := sealSecret(entry.Password, recipients)
+	if err != nil {
+		return err
+	}
+	passwordJSON, err := db.encryptValue(secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	db.cache.clear()
+	if _, err := db.db.Exec(`UPDATE passwords SET encrypted_password = ?, recipients = ? WHERE id = ?`,
+		passwordJSON, recipientsJSON, entry.ID); err != nil {
+		return fmt.Errorf("failed to update recipients: %w", err)
+	}
+	return nil
+}
+
+// SetAutotypeSequence stores the autotype sequence of an entry. An empty
+// sequence restores the default.
+func (db *Database) SetAutotypeSequence(name, sequence string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	key := metaAutotypePrefix + name
+	if sequence == "" {
+		if _, err := db.db.Exec(`DELETE FROM metadata WHERE key = ?`, key); err != nil {
+			return fmt.Errorf("failed to delete autotype sequence: %w", err)
+		}
+		return nil
+	}
+	if _, err := db.db.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`, key, sequence); err != nil {
+		return fmt.Errorf("failed to save autotype sequence: %w", err)
+	}
+	return nil
+}
+
+// AutotypeSequence returns the autotype sequence of an entry, or "" if it
+// uses the default
+func (db *Database) AutotypeSequence(name string) (string, error) {
+	return db.getMetadata(metaAutotypePrefix + name)
+}
+
+// RemindersEnabled reports whether startup reminders are shown for this
+// vault. They are on unless turned off.
+func (db *Database) RemindersEnabled() (bool, error) {
+	value, err := db.getMetadata(metaReminders)
+	return value != "off", err
+}
+
+// SetRemindersEnabled turns startup reminders on or off
+func (db *Database) SetRemindersEnabled(enabled bool) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	var err error
+	if enabled {
+		_, err = db.db.Exec(`DELETE FROM metadata WHERE key = ?`, metaReminders)
+	} else {
+		_, err = db.db.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, 'off')`, metaReminders)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save reminder setting: %w", err)
+	}
+	return nil
+}
+
+// StrengthGrade is a cached strength analysis of an entry's password. It
+// holds no secret material, so it is readable in viewer sessions.
+type StrengthGrade struct {
+	EntryID    int64
+	Score      int
+	Level      string
+	AnalyzedAt time.Time
+}
+
+// StaleStrengthEntries returns up to limit entries (with decrypted
+// passwords) whose cached strength grade is missing or older than their
+// last update, least recently analyzed first. Entries encrypted to
+// recipients are left out, as their passwords need an identity, and so
+// are notes, whose password is optional and not what they protect.
+func (db *Database) StaleStrengthEntries(limit int) ([]*PasswordEntry, error) {
+	if db.viewer {
+		return nil, ErrReadOnly
+	}
+
+	query := `SELECT p.id, p.name, p.encrypted_password
+		FROM passwords p LEFT JOIN strength_cache c ON c.entry_id = p.id
+		WHERE (c.analyzed_at IS NULL OR c.analyzed_at < p.updated_at) AND p.recipients IS NULL AND p.type != 'note'
+		ORDER BY c.analyzed_at IS NOT NULL, c.analyzed_at, p.id
+		LIMIT ?`
+
+	rows, err := db.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*PasswordEntry
+	for rows.Next() {
+		var entry PasswordEntry
+		var passwordJSON string
+		if err := rows.Scan(&entry.ID, &entry.Name, &passwordJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if entry.Password, err = decryptField(passwordJSON, db.dataKey); err != nil {
+			continue // Skip entries that can't be decrypted
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// SetStrengthGrade caches the strength analysis of an entry
+func (db *Database) SetStrengthGrade(entryID int64, score int, level string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO strength_cache (entry_id, score, level, analyzed_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)`
+	if _, err := db.db.Exec(query, entryID, score, level); err != nil {
+		return fmt.Errorf("failed to cache strength grade: %w", err)
+	}
+	return nil
+}
+
+// StrengthGrades returns the cached strength grades keyed by entry ID
+func (db *Database) StrengthGrades() (map[int64]StrengthGrade, error) {
+	rows, err := db.db.Query(`SELECT entry_id, score, level, analyzed_at FROM strength_cache`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query strength cache: %w", err)
+	}
+	defer rows.Close()
+
+	grades := make(map[int64]StrengthGrade)
+	for rows.Next() {
+		var grade StrengthGrade
+		var analyzedAt string
+		if err := rows.Scan(&grade.EntryID, &grade.Score, &grade.Level, &analyzedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan strength grade: %w", err)
+		}
+		grade.AnalyzedAt = parseTimestamp(analyzedAt)
+		grades[grade.EntryID] = grade
+	}
+	return grades, rows.Err()
+}
+
+// parseTimestamp parses a DATETIME column. The driver returns RFC 3339 for
+// columns declared DATETIME; plain SQLite text is accepted as well. Unparseable
+// values fall back to the current time.
+func parseTimestamp(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
 // marshalTags converts tags slice to JSON string
 func marshalTags(tags []string) []byte {
 	if len(tags) == 0 {
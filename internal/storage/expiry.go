@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetExpiry sets when the entry called name is due to be rotated, or
+// clears it if expiresAt is nil. Nothing else about the entry changes,
+// not even its change time.
+func (db *Database) SetExpiry(name string, expiresAt *time.Time) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	defer db.names.lock(name)()
+
+	db.cache.clear()
+	result, err := db.db.Exec(`UPDATE passwords SET expires_at = ? WHERE name = ?`, expiryValue(expiresAt), name)
+	if err != nil {
+		return fmt.Errorf("failed to set expiry: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	return nil
+}
+
+// ListExpiring returns the entries whose expiry date is before the given
+// time, those already expired included, soonest first. Like ListMetadata
+// it decrypts no password. The expiry dates are indexed, so only the
+// entries returned are read.
+func (db *Database) ListExpiring(before time.Time) ([]*PasswordEntry, error) {
+	rows, err := db.db.Query(`SELECT `+entryColumns+` FROM passwords
+		WHERE expires_at IS NOT NULL AND expires_at < ? ORDER BY expires_at, name`, expiryValue(&before))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expiring passwords: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*PasswordEntry
+	for rows.Next() {
+		entry, ok, err := db.scanEntry(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read passwords: %w", err)
+	}
+	return entries, nil
+}
+
+// expiryValue is the stored form of an expiry date: UTC in the layout
+// SQLite compares as text, or NULL for none
+func expiryValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimestamp)
+}
+
+// parseExpiry reads a stored expiry date
+func parseExpiry(value sql.NullString) *time.Time {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	t := parseTimestamp(value.String)
+	return &t
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Export formats written by WriteExport
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+)
+
+// exportColumns is the CSV header, the layout browsers import
+var exportColumns = []string{"name", "url", "username", "password", "notes"}
+
+// WriteExport writes entries to w as a JSON array of entries or as CSV
+// with the name,url,username,password,notes columns. Unless includeSecrets
+// is set, passwords and notes are left empty, so the output holds nothing
+// that is encrypted in the vault.
+func WriteExport(w io.Writer, format string, entries []*PasswordEntry, includeSecrets bool) error {
+	ew, err := NewExportWriter(w, format, includeSecrets)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ew.Write(entry); err != nil {
+			return err
+		}
+	}
+	return ew.Close()
+}
+
+// Export writes every entry of the vault to w in format, streaming them
+// a batch at a time. Secrets need the master password: a viewer session
+// can only export without them.
+func (db *Database) Export(w io.Writer, format string, includeSecrets bool) error {
+	if includeSecrets && db.viewer {
+		return ErrReadOnly
+	}
+	ew, err := NewExportWriter(w, format, includeSecrets)
+	if err != nil {
+		return err
+	}
+	if err := db.ForEachEntry(context.Background(), ForEachOptions{Secrets: includeSecrets}, ew.Write); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// ExportWriter writes an export one entry at a time, in the formats of
+// WriteExport, so a vault can be exported without holding it in memory
+type ExportWriter struct {
+	w              io.Writer
+	includeSecrets bool
+	csv            *csv.Writer
+	count          int
+}
+
+// NewExportWriter starts an export in format on w
+func NewExportWriter(w io.Writer, format string, includeSecrets bool) (*ExportWriter, error) {
+	ew := &ExportWriter{w: w, includeSecrets: includeSecrets}
+	switch format {
+	case ExportJSON:
+	case ExportCSV:
+		ew.csv = csv.NewWriter(w)
+		if err := ew.csv.Write(exportColumns); err != nil {
+			return nil, fmt.Errorf("failed to write export: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+	return ew, nil
+}
+
+// Write adds an entry to the export
+func (ew *ExportWriter) Write(entry *PasswordEntry) error {
+	if !ew.includeSecrets {
+		redacted := *entry
+		redacted.Password = ""
+		redacted.Notes = ""
+		redacted.Acks = nil
+		entry = &redacted
+	}
+
+	var err error
+	if ew.csv != nil {
+		err = ew.csv.Write([]string{entry.Name, entry.URL, entry.Username, entry.Password, entry.Notes})
+	} else {
+		// Elements of an indented array, as json.Encoder would write it
+		var data []byte
+		if data, err = json.MarshalIndent(entry, "  ", "  "); err == nil {
+			separator := ",\n  "
+			if ew.count == 0 {
+				separator = "[\n  "
+			}
+			if _, err = io.WriteString(ew.w, separator); err == nil {
+				_, err = ew.w.Write(data)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	ew.count++
+	return nil
+}
+
+// Count returns how many entries have been written
+func (ew *ExportWriter) Count() int {
+	return ew.count
+}
+
+// Close finishes the export. The underlying writer is not closed.
+func (ew *ExportWriter) Close() error {
+	var err error
+	if ew.csv != nil {
+		ew.csv.Flush()
+		err = ew.csv.Error()
+	} else if ew.count == 0 {
+		_, err = io.WriteString(ew.w, "[]\n")
+	} else {
+		_, err = io.WriteString(ew.w, "\n]\n")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Favicon is the site icon stored for an entry
+type Favicon struct {
+	ContentType string
+	Data        []byte
+	FetchedAt   time.Time
+}
+
+// SetFavicon stores the site icon of the named entry, replacing any
+// earlier one
+func (db *Database) SetFavicon(name string, icon *Favicon) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	var id int64
+	err := db.db.QueryRow(`SELECT id FROM passwords WHERE name = ?`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up entry: %w", err)
+	}
+	_, err = db.db.Exec(`INSERT OR REPLACE INTO favicons (entry_id, content_type, data, fetched_at) VALUES (?, ?, ?, ?)`,
+		id, icon.ContentType, icon.Data, time.Now().UTC().Format(sqliteTimestamp))
+	if err != nil {
+		return fmt.Errorf("failed to store icon: %w", err)
+	}
+	return nil
+}
+
+// Favicon returns the site icon of the named entry, or nil if it has none
+func (db *Database) Favicon(name string) (*Favicon, error) {
+	var icon Favicon
+	var fetchedAt string
+	err := db.db.QueryRow(`SELECT f.content_type, f.data, f.fetched_at
+		FROM favicons f JOIN passwords p ON p.id = f.entry_id WHERE p.name = ?`, name).Scan(&icon.ContentType, &icon.Data, &fetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read icon: %w", err)
+	}
+	icon.FetchedAt = parseTimestamp(fetchedAt)
+	return &icon, nil
+}
+
+// FaviconTargets returns the names and URLs of the logins that have a
+// URL, only those without an icon if missing is set. URLs are encrypted,
+// so they are filtered after listing.
+func (db *Database) FaviconTargets(missing bool) (names, urls []string, err error) {
+	entries, err := db.ListMetadata()
+	if err != nil {
+		return nil, nil, err
+	}
+	have := make(map[int64]bool)
+	if missing {
+		rows, err := db.db.Query(`SELECT entry_id FROM favicons`)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list icons: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, nil, fmt.Errorf("failed to scan row: %w", err)
+			}
+			have[id] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, nil, fmt.Errorf("failed to list icons: %w", err)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Type == EntryTypeLogin && entry.URL != "" && !have[entry.ID] {
+			names, urls = append(names, entry.Name), append(urls, entry.URL)
+		}
+	}
+	return names, urls, nil
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// DefaultHistoryLimit is how many replaced passwords are kept per entry
+// unless SetHistoryLimit says otherwise
+const DefaultHistoryLimit = 5
+
+// HistoryItem is a password an entry had before
+type HistoryItem struct {
+	// Version counts back from the current password: 1 is the one it
+	// replaced, 2 the one before that
+	Version  int
+	Password string
+	// ReplacedAt is when the entry stopped using the password
+	ReplacedAt time.Time
+	// Locked is set, and Password empty, when the password was encrypted
+	// to recipients none of the loaded identities belongs to
+	Locked bool
+}
+
+// SetHistoryLimit sets how many replaced passwords are kept per entry; 0
+// keeps none. Lowering it prunes each entry's history as it next changes.
+func (db *Database) SetHistoryLimit(limit int) {
+	db.historyLimit = limit
+}
+
+// archivePassword keeps the stored password of entry in its history when
+// entry is about to replace it with a different one. The encrypted value
+// is moved over as it is, with the recipients it was encrypted to, and
+// the oldest versions beyond the limit are dropped.
+func (db *Database) archivePassword(tx *sql.Tx, entry *PasswordEntry) error {
+	if db.historyLimit <= 0 {
+		return nil
+	}
+	var passwordJSON string
+	var recipientsJSON sql.NullString
+	err := tx.QueryRow(`SELECT encrypted_password, recipients FROM passwords WHERE id = ?`, entry.ID).Scan(&passwordJSON, &recipientsJSON)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+
+	// A password that cannot be read, being encrypted to recipients of
+	// someone else, is kept: it cannot be told apart from the new one
+	old := &PasswordEntry{Recipients: unmarshalTags(recipientsJSON.String)}
+	decrypted, err := decryptField(passwordJSON, db.dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	if err := db.openSecret(old, decrypted); err == nil {
+		if old.Password == "" || crypto.SecretsEqual(old.Password, entry.Password) {
+			return nil
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO password_history (entry_id, encrypted_password, recipients, replaced_at)
+		VALUES (?, ?, ?, ?)`, entry.ID, passwordJSON, recipientsJSON, time.Now().UTC().Format(sqliteTimestamp)); err != nil {
+		return fmt.Errorf("failed to save password history: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE entry_id = ? AND id NOT IN
+		(SELECT id FROM password_history WHERE entry_id = ? ORDER BY id DESC LIMIT ?)`,
+		entry.ID, entry.ID, db.historyLimit); err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+	return nil
+}
+
+// GetPasswordHistory returns the passwords the entry called name had
+// before, newest first. Viewer sessions, which never decrypt passwords,
+// get ErrReadOnly.
+func (db *Database) GetPasswordHistory(name string) ([]HistoryItem, error) {
+	if db.viewer {
+		return nil, ErrReadOnly
+	}
+	if exists, err := db.hasEntry(name); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+
+	rows, err := db.db.Query(`SELECT h.encrypted_password, h.recipients, h.replaced_at FROM password_history h
+		JOIN passwords p ON p.id = h.entry_id WHERE p.name = ? ORDER BY h.id DESC`, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query password history: %w", err)
+	}
+	defer rows.Close()
+
+	var items []HistoryItem
+	for rows.Next() {
+		var passwordJSON, replacedAt string
+		var recipientsJSON sql.NullString
+		if err := rows.Scan(&passwordJSON, &recipientsJSON, &replacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		decrypted, err := decryptField(passwordJSON, db.dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt password history: %w", err)
+		}
+		item := HistoryItem{Version: len(items) + 1, ReplacedAt: parseTimestamp(replacedAt)}
+		old := &PasswordEntry{Recipients: unmarshalTags(recipientsJSON.String)}
+		if err := db.openSecret(old, decrypted); err != nil {
+			item.Locked = true
+		}
+		item.Password = old.Password
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password history: %w", err)
+	}
+	return items, nil
+}
+
+// reencryptHistory moves the passwords in the history from oldKey to
+// newKey
+func reencryptHistory(tx *sql.Tx, oldKey, newKey string) error {
+	rows, err := tx.Query(`SELECT id, encrypted_password FROM password_history`)
+	if err != nil {
+		return fmt.Errorf("failed to query password history: %w", err)
+	}
+	values := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan password history: %w", err)
+		}
+		values[id] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read password history: %w", err)
+	}
+
+	for id, value := range values {
+		password, err := decryptField(value, oldKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt password history: %w", err)
+		}
+		if value, err = sealField(password, newKey); err != nil {
+			return fmt.Errorf("failed to encrypt password history: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE password_history SET encrypted_password = ? WHERE id = ?`, value, id); err != nil {
+			return fmt.Errorf("failed to update password history: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"password-manager/internal/crypto"
+	"password-manager/internal/suggest"
+)
+
+// ImportClass is how an incoming entry relates to the vault
+type ImportClass int
+
+const (
+	// ImportNew is an entry whose name is not in the vault
+	ImportNew ImportClass = iota
+	// ImportIdentical is an entry already stored with the same secret,
+	// username and URL; importing it again changes nothing
+	ImportIdentical
+	// ImportChanged is an entry stored under the same name with a
+	// different secret, username or URL: a real conflict
+	ImportChanged
+)
+
+func (c ImportClass) String() string {
+	switch c {
+	case ImportIdentical:
+		return "identical"
+	case ImportChanged:
+		return "changed"
+	}
+	return "new"
+}
+
+// ImportCounts totals the classes of an import
+type ImportCounts struct {
+	Identical int
+	Changed   int
+	New       int
+}
+
+// CountImport totals classes as returned by ClassifyImport
+func CountImport(classes []ImportClass) ImportCounts {
+	var counts ImportCounts
+	for _, class := range classes {
+		switch class {
+		case ImportIdentical:
+			counts.Identical++
+		case ImportChanged:
+			counts.Changed++
+		default:
+			counts.New++
+		}
+	}
+	return counts
+}
+
+// ClassifyImport compares incoming entries with the vault by name and
+// returns the class of each, in order. Incoming entries whose name is
+// stored get the ID of the stored entry, so they can be passed to
+// UpdatePassword. Each existing entry is decrypted at most once however
+// often its name comes up, and each pair of fields is compared in
+// constant time. Viewer sessions cannot import.
+func (db *Database) ClassifyImport(entries []*PasswordEntry) ([]ImportClass, error) {
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+
+	// Names come from metadata, so only real candidates are decrypted
+	stored, err := db.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(stored))
+	for _, entry := range stored {
+		names[entry.Name] = true
+	}
+
+	existing := make(map[string]*PasswordEntry)
+	classes := make([]ImportClass, len(entries))
+	for i, incoming := range entries {
+		if !names[incoming.Name] {
+			classes[i] = ImportNew
+			continue
+		}
+		current, ok := existing[incoming.Name]
+		if !ok {
+			if current, err = db.GetPassword(incoming.Name); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", incoming.Name, err)
+			}
+			existing[incoming.Name] = current
+		}
+		incoming.ID = current.ID
+		if sameContent(current, incoming) {
+			classes[i] = ImportIdentical
+		} else {
+			classes[i] = ImportChanged
+		}
+	}
+	return classes, nil
+}
+
+// sameContent reports whether two entries hold the same secret, username
+// and URL. Every field is compared, so the time taken does not reveal
+// which one differs.
+func sameContent(a, b *PasswordEntry) bool {
+	same := crypto.SecretsEqual(a.Password, b.Password)
+	same = crypto.SecretsEqual(a.Username, b.Username) && same
+	same = crypto.SecretsEqual(a.URL, b.URL) && same
+	if a.IsNote() || b.IsNote() {
+		same = crypto.SecretsEqual(a.Notes, b.Notes) && same && a.IsNote() == b.IsNote()
+	}
+	return same
+}
+
+// ImportPlan is every write an import makes, applied together by
+// ApplyImport
+type ImportPlan struct {
+	// Save are entries new to the vault
+	Save []*PasswordEntry
+	// Update replace the stored entries with the same IDs
+	Update []*PasswordEntry
+	// Touch are the names of entries whose updated_at is bumped
+	Touch []string
+}
+
+// Empty reports whether the plan writes nothing
+func (p *ImportPlan) Empty() bool {
+	return len(p.Save) == 0 && len(p.Update) == 0 && len(p.Touch) == 0
+}
+
+// ApplyImport makes the writes of plan as one ChangeSet, so either all
+// of them happen or, on any error, none do. The entries saved and updated
+// are recorded in the operations journal; the ID of the operation is
+// returned, empty if nothing was saved or updated.
+func (db *Database) ApplyImport(plan *ImportPlan) (string, error) {
+	cs := db.NewChangeSet()
+	cs.Journal = OperationImport
+	for _, entry := range plan.Save {
+		cs.Add(entry)
+	}
+	for _, entry := range plan.Update {
+		cs.Update(entry)
+	}
+	for _, name := range plan.Touch {
+		cs.Touch(name)
+	}
+	if _, err := cs.Apply(context.Background()); err != nil {
+		return "", err
+	}
+	return cs.Operation, nil
+}
+
+// ConflictStrategy is what ImportEntries does with an incoming entry
+// whose name is stored with different content
+type ConflictStrategy int
+
+const (
+	// ConflictSkip keeps the stored entry
+	ConflictSkip ConflictStrategy = iota
+	// ConflictOverwrite replaces the stored entry
+	ConflictOverwrite
+	// ConflictRename stores the incoming entry under its name with
+	// RenameSuffix added, and a number after it if that is taken too
+	ConflictRename
+)
+
+// RenameSuffix is added to the names of entries ConflictRename keeps
+// alongside the stored ones
+const RenameSuffix = "-imported"
+
+// Outcomes of an incoming entry, as recorded in ImportOutcome
+const (
+	OutcomeImported = "imported"
+	OutcomeUpdated  = "updated"
+	OutcomeSkipped  = "skipped"
+	OutcomeFailed   = "failed"
+)
+
+// ImportOutcome is what became of one incoming entry of a bulk import or
+// sync
+type ImportOutcome struct {
+	Name     string
+	Username string
+	// Outcome is one of OutcomeImported, OutcomeUpdated, OutcomeSkipped
+	// and OutcomeFailed
+	Outcome string
+	// Reason says why, for anything but a plain new entry
+	Reason string
+}
+
+// ImportReport is what ImportEntries did with each incoming entry
+type ImportReport struct {
+	// Created are the entries new to the vault
+	Created int
+	// Overwritten are the stored entries replaced by ConflictOverwrite
+	Overwritten int
+	// Renamed are the names ConflictRename stored entries under
+	Renamed []string
+	// Skipped are the entries stored with the same content already, or
+	// kept by ConflictSkip
+	Skipped int
+	// Outcomes has the outcome of each incoming entry, in order
+	Outcomes []ImportOutcome
+	// Operation is the ID of the import in the operations journal, empty
+	// if it stored nothing
+	Operation string
+}
+
+// ImportEntries stores entries in one transaction. Entries already stored
+// with the same content are skipped; entries whose name is stored with
+// different content, or that repeat a name earlier in entries, are
+// handled by strategy.
+func (db *Database) ImportEntries(entries []*PasswordEntry, strategy ConflictStrategy) (ImportReport, error) {
+	var report ImportReport
+	classes, err := db.ClassifyImport(entries)
+	if err != nil {
+		return report, err
+	}
+	stored, err := db.ListMetadata()
+	if err != nil {
+		return report, err
+	}
+	taken := make(map[string]bool, len(stored))
+	for _, entry := range stored {
+		taken[entry.Name] = true
+	}
+
+	plan := &ImportPlan{}
+	planned := make(map[string]*PasswordEntry)
+	for i, entry := range entries {
+		outcome := ImportOutcome{Name: entry.Name, Username: entry.Username, Outcome: OutcomeSkipped}
+		earlier := planned[entry.Name]
+		switch {
+		case earlier != nil && sameContent(earlier, entry):
+			report.Skipped++
+			outcome.Reason = "repeats an earlier entry"
+		case earlier == nil && classes[i] == ImportIdentical:
+			report.Skipped++
+			outcome.Reason = "already stored with the same content"
+		case earlier == nil && classes[i] == ImportNew:
+			plan.Save = append(plan.Save, entry)
+			report.Created++
+			outcome.Outcome = OutcomeImported
+			planned[entry.Name] = entry
+			taken[entry.Name] = true
+
+		// A conflict, with the vault or an earlier row
+		case strategy == ConflictOverwrite:
+			report.Overwritten++
+			outcome.Outcome = OutcomeUpdated
+			if earlier != nil {
+				id := earlier.ID
+				*earlier = *entry
+				earlier.ID = id
+				outcome.Reason = "replaced an earlier entry with the same name"
+				break
+			}
+			outcome.Reason = "replaced the stored entry"
+			plan.Update = append(plan.Update, entry)
+			planned[entry.Name] = entry
+		case strategy == ConflictRename:
+			renamed := *entry
+			renamed.ID = 0
+			renamed.Name = suggest.Unique(entry.Name+RenameSuffix, func(name string) bool { return taken[name] })
+			plan.Save = append(plan.Save, &renamed)
+			report.Renamed = append(report.Renamed, renamed.Name)
+			outcome.Outcome = OutcomeImported
+			outcome.Reason = "name taken; stored as " + renamed.Name
+			planned[renamed.Name] = &renamed
+			taken[renamed.Name] = true
+		default:
+			report.Skipped++
+			outcome.Reason = "name taken by an entry with different content"
+		}
+		report.Outcomes = append(report.Outcomes, outcome)
+	}
+
+	if report.Operation, err = db.ApplyImport(plan); err != nil {
+		return ImportReport{}, err
+	}
+	return report, nil
+}
+
+// restoreIDs puts back the IDs entries had before a failed import
+func restoreIDs(entries []*PasswordEntry, ids []int64) {
+	for i, id := range ids {
+		entries[i].ID = id
+	}
+}
+
+// Touch bumps the updated_at timestamp of an entry without changing it,
+// for imports that want an identical row to count as updated
+func (db *Database) Touch(name string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	db.cache.clear()
+	return touchEntry(db.db, name)
+}
+
+func touchEntry(ex execer, name string) error {
+	result, err := ex.Exec(`UPDATE passwords SET updated_at = CURRENT_TIMESTAMP WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to touch entry: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	return nil
+}
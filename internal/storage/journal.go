@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// Kinds of operation recorded in the operations journal
+const (
+	OperationImport = "import"
+)
+
+var (
+	// ErrOperationNotFound is returned for an operation ID the journal
+	// does not hold
+	ErrOperationNotFound = errors.New("no operation with that ID in the journal")
+	// ErrJournalPruned is returned when rolling back an operation whose
+	// before-images were pruned by retention
+	ErrJournalPruned = errors.New("the journal no longer holds the state before the operation")
+	// ErrRolledBack is returned when rolling back an operation again
+	ErrRolledBack = errors.New("operation was already rolled back")
+)
+
+// Operation is a change to the vault recorded in the operations journal,
+// with the state of each entry before it, so it can be rolled back
+type Operation struct {
+	ID        string
+	Kind      string
+	CreatedAt time.Time
+	// Created and Updated count the entries the operation added and
+	// replaced
+	Created, Updated int
+	// Pending counts the entries not rolled back yet; less than
+	// Created+Updated once a rollback has run
+	Pending int
+	// Pruned is set once retention dropped the before-images
+	Pruned bool
+}
+
+// Outcomes of the entries of a rollback, as recorded in RollbackEntry
+const (
+	RollbackTrashed  = "trashed"
+	RollbackRestored = "restored"
+	// RollbackConflict is an entry changed again after the operation,
+	// left as it is
+	RollbackConflict = "conflict"
+	// RollbackGone is an entry the operation added that has been deleted
+	// since, leaving nothing to do
+	RollbackGone = "gone"
+)
+
+// RollbackEntry is what RollbackOperation did with one entry
+type RollbackEntry struct {
+	Name string
+	// Change is what the operation did: ChangeAdd or ChangeUpdate
+	Change string
+	// Outcome is one of RollbackTrashed, RollbackRestored,
+	// RollbackConflict and RollbackGone
+	Outcome string
+	// Reason says why, for conflicts
+	Reason string
+}
+
+// journalEntry is an entry an operation is about to add or replace
+type journalEntry struct {
+	change string
+	entry  *PasswordEntry
+	// before is the replaced entry, for updates
+	before *trashRow
+}
+
+// recordOperation writes an operation of kind with its entries within tx
+// and returns its ID. Entries must have the IDs they were stored under.
+func (db *Database) recordOperation(tx *sql.Tx, kind string, entries []journalEntry) (string, error) {
+	raw, err := crypto.GenerateRandomBytes(6)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate operation ID: %w", err)
+	}
+	id := hex.EncodeToString(raw)
+	if _, err := tx.Exec(`INSERT INTO operations (id, kind, created_at) VALUES (?, ?, ?)`,
+		id, kind, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return "", fmt.Errorf("failed to record operation: %w", err)
+	}
+
+	for _, e := range entries {
+		digest, err := db.encryptValue(entryDigest(e.entry))
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt journal: %w", err)
+		}
+		var snapshot, password, recipients sql.NullString
+		if e.before != nil {
+			snapshot = sql.NullString{String: e.before.snapshot, Valid: true}
+			password = sql.NullString{String: e.before.password, Valid: true}
+			recipients = e.before.recipients
+		}
+		if _, err := tx.Exec(`INSERT INTO operation_entries
+			(operation_id, entry_id, name, change, after_digest, before_snapshot, before_password, before_recipients)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, e.entry.ID, e.entry.Name, e.change, digest, snapshot, password, recipients); err != nil {
+			return "", fmt.Errorf("failed to record operation: %w", err)
+		}
+	}
+	return id, nil
+}
+
+// entryDigest hashes what an entry holds, to tell whether it changed
+// after an operation wrote it. The digest is only stored encrypted.
+func entryDigest(entry *PasswordEntry) string {
+	entryType := entry.Type
+	if entryType == "" {
+		entryType = EntryTypeLogin
+	}
+	// No tags and empty tags are the same
+	tags, recipients := append([]string{}, entry.Tags...), append([]string{}, entry.Recipients...)
+	data, _ := json.Marshal([]interface{}{entry.Name, entryType, entry.Username, entry.Password,
+		entry.URL, entry.Notes, tags, entry.Icon, recipients})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Operations returns the operations in the journal, newest first
+func (db *Database) Operations() ([]*Operation, error) {
+	rows, err := db.db.Query(`SELECT o.id, o.kind, o.created_at, o.pruned,
+		COUNT(CASE WHEN e.change = ? THEN 1 END), COUNT(CASE WHEN e.change = ? THEN 1 END),
+		COUNT(e.id) - COUNT(e.rolled_back_at)
+		FROM operations o LEFT JOIN operation_entries e ON e.operation_id = o.id
+		GROUP BY o.id ORDER BY o.created_at DESC`, ChangeAdd, ChangeUpdate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query operations: %w", err)
+	}
+	defer rows.Close()
+
+	var operations []*Operation
+	for rows.Next() {
+		op := &Operation{}
+		var createdAt string
+		if err := rows.Scan(&op.ID, &op.Kind, &createdAt, &op.Pruned, &op.Created, &op.Updated, &op.Pending); err != nil {
+			return nil, fmt.Errorf("failed to scan operation: %w", err)
+		}
+		op.CreatedAt = parseTimestamp(createdAt)
+		operations = append(operations, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read operations: %w", err)
+	}
+	return operations, nil
+}
+
+// operationRow is an entry of an operation not rolled back yet
+type operationRow struct {
+	id         int64
+	entryID    int64
+	name       string
+	change     string
+	digest     string
+	snapshot   string
+	password   string
+	recipients sql.NullString
+}
+
+// RollbackOperation undoes the operation id: entries it added go to the
+// trash and entries it replaced get their state from before it back,
+// timestamps included. Entries changed or deleted since are conflicts,
+// left as they are unless force is set, and stay pending so the rollback
+// can be run again once they are sorted out. Everything is done in one
+// transaction.
+func (db *Database) RollbackOperation(id string, force bool) ([]RollbackEntry, error) {
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+	var pruned bool
+	err := db.db.QueryRow(`SELECT pruned FROM operations WHERE id = ?`, id).Scan(&pruned)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrOperationNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operation: %w", err)
+	}
+	if pruned {
+		return nil, fmt.Errorf("%w: %s", ErrJournalPruned, id)
+	}
+	pending, err := db.pendingRows(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRolledBack, id)
+	}
+
+	stored, err := db.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(stored))
+	for _, entry := range stored {
+		names[entry.ID] = entry.Name
+	}
+
+	cs := db.NewChangeSet()
+	report := make([]RollbackEntry, len(pending))
+	var done []int64
+	var restored []*restoredEntry
+	for i, row := range pending {
+		result := RollbackEntry{Name: row.name, Change: row.change, Outcome: RollbackConflict}
+		name, exists := names[row.entryID]
+		switch {
+		case !exists && row.change == ChangeAdd:
+			result.Outcome = RollbackGone
+			done = append(done, row.id)
+		case !exists:
+			result.Reason = "deleted since"
+		default:
+			changed, err := db.changedSince(row, name)
+			if err != nil {
+				return nil, err
+			}
+			if changed && !force {
+				result.Reason = "changed since"
+				if name != row.name {
+					result.Reason = "renamed to " + name + " since"
+				}
+				break
+			}
+			result.Name = name
+			if row.change == ChangeAdd {
+				cs.Delete(name)
+				result.Outcome = RollbackTrashed
+			} else {
+				entry, err := db.openBeforeImage(row, name)
+				if err != nil {
+					return nil, err
+				}
+				cs.Update(entry.entry)
+				restored = append(restored, entry)
+				result.Outcome = RollbackRestored
+			}
+			done = append(done, row.id)
+		}
+		report[i] = result
+	}
+
+	cs.after = append(cs.after, func(tx *sql.Tx) error {
+		for _, r := range restored {
+			if err := r.restore(tx); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		for _, rowID := range done {
+			if _, err := tx.Exec(`UPDATE operation_entries SET rolled_back_at = ? WHERE id = ?`, now, rowID); err != nil {
+				return fmt.Errorf("failed to update journal: %w", err)
+			}
+		}
+		return nil
+	})
+	if _, err := cs.Apply(context.Background()); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// pendingRows reads the entries of operation id not rolled back yet
+func (db *Database) pendingRows(id string) ([]*operationRow, error) {
+	rows, err := db.db.Query(`SELECT id, entry_id, name, change, after_digest, COALESCE(before_snapshot, ''),
+		COALESCE(before_password, ''), before_recipients
+		FROM operation_entries WHERE operation_id = ? AND rolled_back_at IS NULL ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []*operationRow
+	for rows.Next() {
+		row := &operationRow{}
+		if err := rows.Scan(&row.id, &row.entryID, &row.name, &row.change, &row.digest,
+			&row.snapshot, &row.password, &row.recipients); err != nil {
+			return nil, fmt.Errorf("failed to scan journal: %w", err)
+		}
+		pending = append(pending, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return pending, nil
+}
+
+// changedSince reports whether the entry now called name differs from
+// what the operation of row left
+func (db *Database) changedSince(row *operationRow, name string) (bool, error) {
+	current, err := db.GetPassword(name)
+	if err != nil {
+		return false, err
+	}
+	if current.Locked {
+		return true, nil
+	}
+	digest, err := decryptField(row.digest, db.dataKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt journal: %w", err)
+	}
+	return digest != entryDigest(current), nil
+}
+
+// restoredEntry is the state of an entry before an operation, on its way
+// back into the vault
+type restoredEntry struct {
+	entry      *PasswordEntry
+	kept       trashedEntry
+	password   string
+	recipients sql.NullString
+	totp       string
+}
+
+// openBeforeImage reads the state of the entry of row before the
+// operation, to be stored back as name
+func (db *Database) openBeforeImage(row *operationRow, name string) (*restoredEntry, error) {
+	if row.snapshot == "" {
+		return nil, fmt.Errorf("%w: %s", ErrJournalPruned, row.name)
+	}
+	data, err := decryptField(row.snapshot, db.dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt journal: %w", err)
+	}
+	r := &restoredEntry{password: row.password, recipients: row.recipients}
+	if err := json.Unmarshal([]byte(data), &r.kept); err != nil {
+		return nil, fmt.Errorf("failed to decode journal: %w", err)
+	}
+	r.entry = r.kept.Entry
+	r.entry.Name = name
+	decrypted, err := decryptField(row.password, db.dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	r.entry.Locked = db.openSecret(r.entry, decrypted) != nil
+	if r.kept.TOTP != nil {
+		if r.totp, err = db.sealTOTP(r.kept.TOTP); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// restore puts back what the ChangeSet update of the entry does not: the
+// password as it was stored, readable or not, the timestamps, the TOTP
+// settings and the autotype sequence
+func (r *restoredEntry) restore(tx *sql.Tx) error {
+	entry := r.entry
+	if _, err := tx.Exec(`UPDATE passwords SET encrypted_password = ?, recipients = ?, created_at = ?, updated_at = ? WHERE id = ?`,
+		r.password, r.recipients, entry.CreatedAt.UTC().Format(sqliteTimestamp), entry.UpdatedAt.UTC().Format(sqliteTimestamp), entry.ID); err != nil {
+		return fmt.Errorf("%s: failed to restore password: %w", entry.Name, err)
+	}
+	if r.totp != "" {
+		if err := setMetadataTx(tx, metaTOTPPrefix+entry.Name, r.totp); err != nil {
+			return err
+		}
+	}
+	if r.kept.Autotype != "" {
+		if err := setMetadataTx(tx, metaAutotypePrefix+entry.Name, r.kept.Autotype); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneOperations drops the before-images of the operations recorded
+// before cutoff, which can then no longer be rolled back, and returns
+// how many operations there were
+func (db *Database) PruneOperations(cutoff time.Time) (int, error) {
+	if err := db.writable(); err != nil {
+		return 0, err
+	}
+	tx, err := db.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE operations SET pruned = 1 WHERE pruned = 0 AND created_at < ?`, cutoff.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune journal: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE operation_entries SET before_snapshot = NULL, before_password = NULL, before_recipients = NULL
+		WHERE before_snapshot IS NOT NULL AND operation_id IN (SELECT id FROM operations WHERE pruned = 1)`); err != nil {
+		return 0, fmt.Errorf("failed to prune journal: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(n), nil
+}
+
+// reencryptJournal moves the digests and before-images of the journal
+// from oldKey to newKey
+func reencryptJournal(tx *sql.Tx, oldKey, newKey string) error {
+	rows, err := tx.Query(`SELECT id, after_digest, COALESCE(before_snapshot, ''), COALESCE(before_password, '') FROM operation_entries`)
+	if err != nil {
+		return fmt.Errorf("failed to query journal: %w", err)
+	}
+	values := make(map[int64][3]string)
+	for rows.Next() {
+		var id int64
+		var value [3]string
+		if err := rows.Scan(&id, &value[0], &value[1], &value[2]); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan journal: %w", err)
+		}
+		values[id] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	for id, value := range values {
+		var sealed [3]sql.NullString
+		for i := range value {
+			if value[i] == "" {
+				continue
+			}
+			plain, err := decryptField(value[i], oldKey)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt journal entry %d: %w", id, err)
+			}
+			if sealed[i].String, err = sealField(plain, newKey); err != nil {
+				return fmt.Errorf("failed to encrypt journal entry %d: %w", id, err)
+			}
+			sealed[i].Valid = true
+		}
+		if _, err := tx.Exec(`UPDATE operation_entries SET after_digest = ?, before_snapshot = ?, before_password = ? WHERE id = ?`,
+			sealed[0].String, sealed[1], sealed[2], id); err != nil {
+			return fmt.Errorf("failed to update journal: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// metaKDFParams holds, as a KDFRecord in JSON, the parameters the master
+// copy of the data key was last wrapped with
+const metaKDFParams = "kdf_params"
+
+// KDFRecord is how the key of the master password is derived, and since
+// when
+type KDFRecord struct {
+	crypto.KDFParams
+	// Since is when the data key was wrapped with these parameters; zero
+	// for vaults that predate the record
+	Since time.Time `json:"since"`
+}
+
+// setKDFRecordTx records within tx that the data key was just wrapped
+// with params
+func setKDFRecordTx(tx *sql.Tx, params crypto.KDFParams) error {
+	data, err := json.Marshal(KDFRecord{KDFParams: params, Since: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode KDF parameters: %w", err)
+	}
+	return setMetadataTx(tx, metaKDFParams, string(data))
+}
+
+// KDFStatus returns how the key of the master password is derived and
+// whether that is weaker than crypto.DefaultKDF, the parameters new keys
+// get. It takes a single metadata query, so it is cheap enough for every
+// unlock. Sessions that cannot write never report outdated parameters, as
+// they could not re-encrypt the vault anyway.
+func (db *Database) KDFStatus() (record KDFRecord, outdated bool, err error) {
+	if db.writable() != nil {
+		return record, false, nil
+	}
+	rows, err := db.db.Query(`SELECT key, value FROM metadata WHERE key IN (?, ?)`, metaKDFParams, metaDataKeyMaster)
+	if err != nil {
+		return record, false, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	defer rows.Close()
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return record, false, fmt.Errorf("failed to read metadata: %w", err)
+		}
+		values[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return record, false, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	switch {
+	case values[metaKDFParams] != "":
+		if err := json.Unmarshal([]byte(values[metaKDFParams]), &record); err != nil {
+			return record, false, fmt.Errorf("invalid KDF record: %w", err)
+		}
+	case values[metaDataKeyMaster] != "":
+		// Vaults from before the record carry the parameters in the wrap
+		var encrypted crypto.EncryptedData
+		if err := json.Unmarshal([]byte(values[metaDataKeyMaster]), &encrypted); err != nil {
+			return record, false, fmt.Errorf("invalid wrapped data key: %w", err)
+		}
+		record.KDFParams = encrypted.Params()
+	default:
+		// A legacy vault derives a key for every field; the zero record
+		// says so, and moving it to a data key is an upgrade in itself
+		return record, true, nil
+	}
+	return record, record.Weaker(crypto.DefaultKDF), nil
+}
+
+// legacyBlob reports whether an encrypted value predates recorded KDF
+// parameters, and so was derived with PBKDF2
+func legacyBlob(data string) bool {
+	var encrypted crypto.EncryptedData
+	if err := json.Unmarshal([]byte(data), &encrypted); err != nil {
+		return false
+	}
+	return len(encrypted.Salt) > 0 && encrypted.KDF == nil
+}
+
+// wrapOutdated reports whether a wrapped data key derives its key with
+// parameters weaker than crypto.DefaultKDF
+func wrapOutdated(data string) bool {
+	var encrypted crypto.EncryptedData
+	if err := json.Unmarshal([]byte(data), &encrypted); err != nil {
+		return false
+	}
+	return encrypted.Params().Weaker(crypto.DefaultKDF)
+}
+
+// derivedBlob reports whether an encrypted value derives its own key
+// rather than using the data key directly, as fields did before sealField
+func derivedBlob(data string) bool {
+	var encrypted crypto.EncryptedData
+	if err := json.Unmarshal([]byte(data), &encrypted); err != nil {
+		return false
+	}
+	return len(encrypted.Salt) > 0
+}
+
+// MigrateKDF re-encrypts, on demand, the fields that still derive a key
+// each, with PBKDF2 or Argon2id, so they use the data key directly, and
+// wraps the data key with crypto.DefaultKDF if its wrap is weaker. Usernames, URLs and notes still in
+// plaintext are encrypted at the same time. It returns the number of
+// entries that had such fields. A legacy vault, encrypting entries under the master
+// password, is moved to a random data key. The viewer copy of the data
+// key cannot be rewrapped without the viewer password and is upgraded
+// when that is next set.
+func (db *Database) MigrateKDF(masterPassword []byte) (int, error) {
+	return db.migrateKDF(string(masterPassword), nil)
+}
+
+// UpgradeKDF moves the vault to crypto.DefaultKDF as MigrateKDF does,
+// reporting each entry re-encrypted to progress if it is not nil. It
+// first writes a compacted copy of the vault next to it, sealed like the
+// vault if that is fully encrypted, and returns its path: the
+// re-encryption happens in one transaction, and the copy keeps the vault
+// as it was in case anything else goes wrong.
+func (db *Database) UpgradeKDF(masterPassword []byte, progress func(done, total int)) (snapshot string, err error) {
+	if err := db.writable(); err != nil {
+		return "", err
+	}
+	if err := db.checkMasterPassword(string(masterPassword)); err != nil {
+		return "", err
+	}
+	if snapshot, err = db.writeSnapshot("pre-kdf-upgrade"); err != nil {
+		return "", err
+	}
+	if _, err := db.migrateKDF(string(masterPassword), progress); err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// writeSnapshot writes a compacted copy of the vault to a new file next
+// to it, named after the vault, the time and what it is for
+func (db *Database) writeSnapshot(purpose string) (string, error) {
+	path := fmt.Sprintf("%s.%s.%s", db.dbPath, time.Now().UTC().Format("20060102-150405"), purpose)
+	if db.workPath == "" {
+		if err := db.RewriteTo(path); err != nil {
+			return "", err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("failed to protect snapshot: %w", err)
+		}
+		return path, nil
+	}
+
+	plainPath, err := newWorkPath()
+	if err != nil {
+		return "", err
+	}
+	defer removeWorkCopy(plainPath)
+	if err := db.RewriteTo(plainPath); err != nil {
+		return "", err
+	}
+	if err := seal(plainPath, path, db.sealKey); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// migrateKDF does the work of MigrateKDF and UpgradeKDF
+func (db *Database) migrateKDF(masterPassword string, progress func(done, total int)) (int, error) {
+	if err := db.writable(); err != nil {
+		return 0, err
+	}
+	if err := db.checkMasterPassword(masterPassword); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.db.Query(`SELECT encrypted_password, encrypted_tags, notes, type, encrypted_fields FROM passwords`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	count := 0
+	for rows.Next() {
+		var password, tags, notes, entryType string
+		var sealed bool
+		if err := rows.Scan(&password, &tags, &notes, &entryType, &sealed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if !sealed || derivedBlob(password) || derivedBlob(tags) || (entryType == EntryTypeNote && derivedBlob(notes)) {
+			count++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read passwords: %w", err)
+	}
+
+	masterWrap, err := db.getMetadata(metaDataKeyMaster)
+	if err != nil {
+		return 0, err
+	}
+	if masterWrap == "" {
+		if err := db.rewrap(masterPassword, ""); err != nil {
+			return 0, err
+		}
+		return count, nil
+	}
+	if count == 0 && !wrapOutdated(masterWrap) {
+		return 0, nil
+	}
+
+	// The data key stays the same; only how it is wrapped and how the
+	// fields under it are encrypted change
+	masterWrap, err = encryptField(db.dataKey, db.keyForm(masterPassword), crypto.DefaultKDF)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	tx, err := db.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := reencryptEntries(tx, db.dataKey, db.dataKey, progress); err != nil {
+		return 0, err
+	}
+	if err := setMetadataTx(tx, metaDataKeyMaster, masterWrap); err != nil {
+		return 0, err
+	}
+	if err := setKDFRecordTx(tx, crypto.DefaultKDF); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return count, nil
+}
+
+// sealFields re-encrypts every field directly under the data key. Legacy
+// vaults have no data key and are left as they are; MigrateKDF, which
+// needs the master password, moves them to one.
+func (db *Database) sealFields() error {
+	if !db.randomKey {
+		return nil
+	}
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := reencryptEntries(tx, db.dataKey, db.dataKey, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
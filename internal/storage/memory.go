@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// EntrySource feeds entries one at a time to fn, stopping at the first
+// error fn returns
+type EntrySource func(fn func(*PasswordEntry) error) error
+
+// OpenMemory builds a read-only vault held entirely in memory from the
+// entries of source, such as those of a backup, so it can be inspected
+// with the usual commands without restoring it. Nothing is written to
+// disk, and closing the vault discards it.
+func OpenMemory(source EntrySource) (*Database, error) {
+	load, dsn, err := openMemoryLoader()
+	if err != nil {
+		return nil, err
+	}
+	if err := load.fill(source); err != nil {
+		load.db.Close()
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", dsn+"&_query_only=true")
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		load.db.Close()
+		return nil, fmt.Errorf("failed to open memory database: %w", err)
+	}
+	return &Database{db: db, memory: load.db, dataKey: load.dataKey, randomKey: true, cache: &metadataCache{}, names: &nameLocks{}}, nil
+}
+
+// CreateMemory creates an empty, writable vault held entirely in memory
+// under a random key, for checks that must not touch a vault on disk.
+// Closing it discards it.
+func CreateMemory() (*Database, error) {
+	return CreateMemoryFrom(func(func(*PasswordEntry) error) error { return nil })
+}
+
+// CreateMemoryFrom is CreateMemory with the entries of source stored,
+// keeping their timestamps, such as the made-up ones of the demo
+func CreateMemoryFrom(source EntrySource) (*Database, error) {
+	db, _, err := openMemoryLoader()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.fill(source); err != nil {
+		db.db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openMemoryLoader opens a new memory database under a random key,
+// through one connection, which is kept open as the memory database lives
+// only as long as a connection to it. It also returns the DSN other
+// connections reach it by.
+func openMemoryLoader() (*Database, string, error) {
+	id, err := crypto.GenerateRandomBytes(8)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := crypto.GenerateRandomBytes(crypto.KeyLength)
+	if err != nil {
+		return nil, "", err
+	}
+	dsn := "file:pm-memory-" + hex.EncodeToString(id) + "?mode=memory&cache=shared"
+	loader, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open memory database: %w", err)
+	}
+	loader.SetMaxOpenConns(1)
+	loader.SetConnMaxLifetime(0)
+	return &Database{db: loader, dataKey: base64.StdEncoding.EncodeToString(key), randomKey: true, cache: &metadataCache{}, names: &nameLocks{},
+		historyLimit: DefaultHistoryLimit}, dsn, nil
+}
+
+// fill creates the schema and stores the entries of source
+func (db *Database) fill(source EntrySource) error {
+	if err := db.initSchema(); err != nil {
+		return fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := setMetadataTx(tx, metaInitialized, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	// Backups of vaults from before names were unique may repeat a name;
+	// as in the vault itself, the most recently updated entry is kept
+	var names []string
+	latest := make(map[string]*PasswordEntry)
+	err = source(func(entry *PasswordEntry) error {
+		if kept, ok := latest[entry.Name]; !ok {
+			names = append(names, entry.Name)
+		} else if kept.UpdatedAt.After(entry.UpdatedAt) {
+			return nil
+		}
+		copied := *entry
+		copied.ID = 0
+		latest[entry.Name] = &copied
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		entry := latest[name]
+		row, err := db.encodeEntry(entry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		if err := insertEntry(tx, entry, row); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE passwords SET created_at = ?, updated_at = ? WHERE id = ?`,
+			entry.CreatedAt.UTC().Format(sqliteTimestamp), entry.UpdatedAt.UTC().Format(sqliteTimestamp), entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IsMemory reports whether the vault is a read-only copy held in memory
+func (db *Database) IsMemory() bool {
+	return db.memory != nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"fmt"
+
+	"password-manager/internal/totp"
+)
+
+// removeMoved is (*Database).removeMoved; tests replace it to simulate a
+// crash between copying an entry to another vault and removing it here
+var removeMoved = (*Database).removeMoved
+
+// MoveEntry moves the entry called name, with its TOTP settings and
+// autotype sequence, into dst. The copy is written to dst in one
+// transaction and read back before anything is removed here; if the
+// removal then fails, the copy is taken out of dst again, so the entry
+// ends up in exactly one of the vaults. A copy dst already holds from an
+// interrupted move is used as it is. A non-nil tombstone takes the place
+// of the entry here, in the transaction that removes it.
+func (db *Database) MoveEntry(dst *Database, name string, tombstone *PasswordEntry) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	if err := dst.writable(); err != nil {
+		return err
+	}
+
+	entry, err := db.GetPassword(name)
+	if err != nil {
+		return err
+	}
+	params, err := db.TOTP(name)
+	if err != nil {
+		return err
+	}
+	sequence, err := db.AutotypeSequence(name)
+	if err != nil {
+		return err
+	}
+
+	copied, err := dst.copyEntry(entry, params, sequence)
+	if err != nil {
+		return fmt.Errorf("%s: failed to copy: %w", name, err)
+	}
+	if err := dst.verifyCopy(entry, params, sequence); err != nil {
+		if copied {
+			dst.DeletePermanently(name)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := removeMoved(db, entry, tombstone); err != nil {
+		if !copied {
+			return fmt.Errorf("%s: failed to remove after copying: %w", name, err)
+		}
+		if undo := dst.DeletePermanently(name); undo != nil {
+			return fmt.Errorf("%s: failed to remove after copying (%v), and failed to take the copy out again: %w", name, err, undo)
+		}
+		return fmt.Errorf("%s: failed to remove after copying, so the copy was taken out again: %w", name, err)
+	}
+	return nil
+}
+
+// copyEntry inserts a copy of entry, keeping its timestamps, together
+// with its TOTP settings and autotype sequence in one transaction. It
+// reports false, writing nothing, when the vault already holds an entry
+// of that name with the same content.
+func (db *Database) copyEntry(entry *PasswordEntry, params *totp.Params, sequence string) (bool, error) {
+	exists, err := db.hasEntry(entry.Name)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		existing, err := db.GetPassword(entry.Name)
+		if err != nil {
+			return false, err
+		}
+		if !sameContent(existing, entry) || existing.Notes != entry.Notes {
+			return false, fmt.Errorf("a different entry called %s already exists there", entry.Name)
+		}
+		return false, nil
+	}
+
+	copied := *entry
+	copied.ID = 0
+	row, err := db.encodeEntry(&copied)
+	if err != nil {
+		return false, err
+	}
+	var totpValue string
+	if params != nil {
+		if totpValue, err = db.sealTOTP(params); err != nil {
+			return false, err
+		}
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertEntry(tx, &copied, row); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE passwords SET created_at = ?, updated_at = ? WHERE id = ?`,
+		entry.CreatedAt.UTC().Format(sqliteTimestamp), entry.UpdatedAt.UTC().Format(sqliteTimestamp), copied.ID); err != nil {
+		return false, fmt.Errorf("failed to set timestamps: %w", err)
+	}
+	if totpValue != "" {
+		if err := setMetadataTx(tx, metaTOTPPrefix+entry.Name, totpValue); err != nil {
+			return false, err
+		}
+	}
+	if sequence != "" {
+		if err := setMetadataTx(tx, metaAutotypePrefix+entry.Name, sequence); err != nil {
+			return false, err
+		}
+	}
+	if err := db.updateReuseIndex(tx, []*PasswordEntry{&copied}); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// verifyCopy reads back a copied entry and checks it matches the original
+func (db *Database) verifyCopy(entry *PasswordEntry, params *totp.Params, sequence string) error {
+	stored, err := db.GetPassword(entry.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read back the copy: %w", err)
+	}
+	storedParams, err := db.TOTP(entry.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read back the copy: %w", err)
+	}
+	storedSequence, err := db.AutotypeSequence(entry.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read back the copy: %w", err)
+	}
+
+	same := sameContent(stored, entry) && stored.Notes == entry.Notes &&
+		stored.Icon == entry.Icon && sequence == storedSequence &&
+		(params == nil) == (storedParams == nil) && (params == nil || *params == *storedParams)
+	if !same {
+		return fmt.Errorf("the copy does not match the original")
+	}
+	return nil
+}
+
+// removeMoved deletes entry, its cached strength grade and its metadata,
+// and stores tombstone in its place if it is set, in one transaction
+func (db *Database) removeMoved(entry *PasswordEntry, tombstone *PasswordEntry) error {
+	var row *entryRow
+	if tombstone != nil {
+		var err error
+		if row, err = db.encodeEntry(tombstone); err != nil {
+			return err
+		}
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM strength_cache WHERE entry_id = ?`, entry.ID); err != nil {
+		return fmt.Errorf("failed to delete strength cache: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM favicons WHERE entry_id = ?`, entry.ID); err != nil {
+		return fmt.Errorf("failed to delete icon: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audit_acks WHERE entry_id = ?`, entry.ID); err != nil {
+		return fmt.Errorf("failed to delete acknowledgements: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE entry_id = ?`, entry.ID); err != nil {
+		return fmt.Errorf("failed to delete password history: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM metadata WHERE key IN (?, ?)`,
+		metaAutotypePrefix+entry.Name, metaTOTPPrefix+entry.Name); err != nil {
+		return fmt.Errorf("failed to delete entry metadata: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM passwords WHERE id = ?`, entry.ID); err != nil {
+		return fmt.Errorf("failed to delete password: %w", err)
+	}
+	var written []*PasswordEntry
+	if tombstone != nil {
+		if err := insertEntry(tx, tombstone, row); err != nil {
+			return err
+		}
+		written = append(written, tombstone)
+	}
+	if err := db.updateReuseIndex(tx, written, entry.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
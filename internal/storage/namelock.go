@@ -0,0 +1,45 @@
+package storage
+
+import "sync"
+
+// nameLocks serializes the writes of a session to each entry name, so
+// that concurrent changes to one entry, each reading it and then writing
+// it back with a snapshot of its password in the history, do not
+// interleave. Writes to different names go ahead side by side. A lock is
+// dropped from the map once no one holds or waits for it, so the map
+// stays as small as the number of names being written at once.
+type nameLocks struct {
+	mu    sync.Mutex
+	locks map[string]*nameLock
+}
+
+// nameLock is the lock of one name and how many hold or wait for it
+type nameLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock takes the lock of name and returns what releases it
+func (l *nameLocks) lock(name string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*nameLock)
+	}
+	lock := l.locks[name]
+	if lock == nil {
+		lock = &nameLock{}
+		l.locks[name] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, name)
+		}
+		l.mu.Unlock()
+	}
+}
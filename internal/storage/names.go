@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"password-manager/internal/collation"
+)
+
+// ErrRequiresUnlock is returned when entry names cannot be read without
+// the master password
+var ErrRequiresUnlock = errors.New("entry names are only readable after unlocking the vault")
+
+// ListNamesUnauthenticated returns the entry names of the vault at dbPath
+// in the order of collator, nil for the default one, without the master password and without any key derivation.
+// A standard vault stores names in plaintext and is read without being
+// modified; a fully encrypted vault seals them, giving ErrRequiresUnlock.
+// Nothing but the names is read.
+func ListNamesUnauthenticated(dbPath string, collator *collation.Collator) ([]string, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w at %s", ErrNoVault, dbPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open vault: %w", err)
+	}
+	sealed, err := isContainer(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if sealed {
+		return nil, ErrRequiresUnlock
+	}
+
+	// Read-only, so the schema is never created or upgraded here
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(dbPath), RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite3", uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	database := &Database{dbPath: dbPath, db: db}
+	if err := database.checkVault(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT DISTINCT name FROM passwords`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query names: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query names: %w", err)
+	}
+	collation.Of(collator).Strings(names)
+	return names, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// RenamePassword gives the entry called oldName the name newName. The
+// entry keeps its row, so its ID, creation time, password history, cached
+// strength grade, icon and acknowledged findings stay with it; its TOTP
+// settings and autotype sequence, which are stored by name, move with it.
+// The change time is bumped. A newName another entry holds is
+// ErrEntryExists; a newName that differs only in case is not, as names are
+// compared exactly.
+func (db *Database) RenamePassword(oldName, newName string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	if oldName == newName {
+		if exists, err := db.hasEntry(oldName); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("%w: %s", ErrEntryNotFound, oldName)
+		}
+		return nil
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM passwords WHERE name = ?)`, newName).Scan(&taken); err != nil {
+		return fmt.Errorf("failed to look up entry: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("%w: %s", ErrEntryExists, newName)
+	}
+
+	result, err := tx.Exec(`UPDATE passwords SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?`, newName, oldName)
+	if err != nil {
+		return fmt.Errorf("failed to rename entry: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, oldName)
+	}
+	// No entry holds newName, so metadata of that name is left over and
+	// would only be in the way
+	for _, prefix := range []string{metaTOTPPrefix, metaAutotypePrefix} {
+		if _, err := tx.Exec(`DELETE FROM metadata WHERE key = ?`, prefix+newName); err != nil {
+			return fmt.Errorf("failed to move entry metadata: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE metadata SET key = ? WHERE key = ?`, prefix+newName, prefix+oldName); err != nil {
+			return fmt.Errorf("failed to move entry metadata: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"password-manager/internal/crypto"
+)
+
+// metaReuseIndex holds the password reuse index, encrypted under the
+// data key
+const metaReuseIndex = "reuse_index"
+
+// reuseIndex maps entry IDs to a fingerprint of their password, so a
+// password can be checked for reuse without decrypting every entry.
+//
+// It is an exact set of HMAC-SHA256 fingerprints rather than a bloom
+// filter: a vault holds few enough entries that the size saving of a
+// bloom filter does not matter, and an exact set means a hit only ever
+// costs decrypting the entries that really share the password. Hits are
+// still confirmed against the decrypted passwords, which also covers an
+// index left stale by an older version. The HMAC key is random and kept
+// inside the encrypted index, so fingerprints are useless without it.
+type reuseIndex struct {
+	Key     []byte           `json:"key"`
+	Entries map[int64]string `json:"entries"`
+}
+
+// fingerprint returns the keyed fingerprint of a password
+func (idx *reuseIndex) fingerprint(password string) string {
+	mac := hmac.New(sha256.New, idx.Key)
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// set records the password of an entry; empty passwords, as notes have,
+// are not indexed
+func (idx *reuseIndex) set(entry *PasswordEntry) {
+	delete(idx.Entries, entry.ID)
+	if entry.Password != "" {
+		idx.Entries[entry.ID] = idx.fingerprint(entry.Password)
+	}
+}
+
+// dbtx is the database or a transaction
+type dbtx interface {
+	execer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// readReuseIndex returns the stored index, or nil if none has been built
+func (db *Database) readReuseIndex(q dbtx) (*reuseIndex, error) {
+	var value string
+	err := q.QueryRow(`SELECT value FROM metadata WHERE key = ?`, metaReuseIndex).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reuse index: %w", err)
+	}
+	data, err := decryptField(value, db.dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt reuse index: %w", err)
+	}
+	var idx reuseIndex
+	if err := json.Unmarshal([]byte(data), &idx); err != nil {
+		return nil, fmt.Errorf("failed to decode reuse index: %w", err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[int64]string)
+	}
+	return &idx, nil
+}
+
+// writeReuseIndex stores idx
+func (db *Database) writeReuseIndex(ex execer, idx *reuseIndex) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to encode reuse index: %w", err)
+	}
+	value, err := db.encryptValue(string(data))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt reuse index: %w", err)
+	}
+	if _, err := ex.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`, metaReuseIndex, value); err != nil {
+		return fmt.Errorf("failed to write reuse index: %w", err)
+	}
+	return nil
+}
+
+// updateReuseIndex records the passwords of entries and forgets the
+// entries with the removed IDs. Until the index is first built, by
+// ReusedBy or RebuildReuseIndex, there is nothing to update.
+func (db *Database) updateReuseIndex(q dbtx, entries []*PasswordEntry, removed ...int64) error {
+	idx, err := db.readReuseIndex(q)
+	if err != nil || idx == nil {
+		return err
+	}
+	for _, id := range removed {
+		delete(idx.Entries, id)
+	}
+	for _, entry := range entries {
+		idx.set(entry)
+	}
+	return db.writeReuseIndex(q, idx)
+}
+
+// RebuildReuseIndex builds the reuse index from scratch under a fresh key
+// and returns how many passwords it holds. Entries encrypted to
+// recipients no loaded identity belongs to cannot be indexed.
+func (db *Database) RebuildReuseIndex() (int, error) {
+	if err := db.writable(); err != nil {
+		return 0, err
+	}
+	key, err := crypto.GenerateRandomBytes(32)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := db.ListPasswords()
+	if err != nil {
+		return 0, err
+	}
+
+	idx := &reuseIndex{Key: key, Entries: make(map[int64]string)}
+	for _, entry := range entries {
+		idx.set(entry)
+	}
+	if err := db.writeReuseIndex(db.db, idx); err != nil {
+		return 0, err
+	}
+	return len(idx.Entries), nil
+}
+
+// ReusedBy returns the names of the entries other than the one with ID
+// self whose password is password, sorted. The index is consulted first,
+// so only the candidate entries are decrypted; it is built on first use.
+func (db *Database) ReusedBy(password string, self int64) ([]string, error) {
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, nil
+	}
+	idx, err := db.readReuseIndex(db.db)
+	if err == nil && idx == nil {
+		if _, err = db.RebuildReuseIndex(); err == nil {
+			idx, err = db.readReuseIndex(db.db)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := idx.fingerprint(password)
+	var candidates []string
+	for id, fp := range idx.Entries {
+		if id != self && fp == fingerprint {
+			candidates = append(candidates, fmt.Sprint(id))
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.db.Query(`SELECT ` + entryColumns + ` FROM passwords WHERE id IN (` + strings.Join(candidates, ",") + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		entry, ok, err := db.scanEntry(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		if ok && crypto.SecretsEqual(entry.Password, password) {
+			names = append(names, entry.Name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The fields SearchPasswordsAdvanced can match
+const (
+	FieldName     = "name"
+	FieldUsername = "username"
+	FieldURL      = "url"
+	FieldNotes    = "notes"
+	FieldTags     = "tags"
+	FieldPassword = "password"
+)
+
+// SearchFields are the fields a search can match, in the order matches
+// are reported
+var SearchFields = []string{FieldName, FieldUsername, FieldURL, FieldNotes, FieldTags, FieldPassword}
+
+// DefaultSearchFields are the fields matched when SearchOptions names
+// none. Passwords are only matched when asked for.
+var DefaultSearchFields = []string{FieldName, FieldUsername, FieldURL, FieldNotes, FieldTags}
+
+// SearchOptions control SearchPasswordsAdvanced
+type SearchOptions struct {
+	// Fields are the fields to match, DefaultSearchFields when empty
+	Fields []string
+	// CaseSensitive matches case exactly instead of ignoring it
+	CaseSensitive bool
+	// Regex takes the query as a regular expression instead of text the
+	// field must contain
+	Regex bool
+}
+
+// SearchMatch is an entry a search found, with the fields that matched
+// in the order of SearchFields
+type SearchMatch struct {
+	Entry  *PasswordEntry
+	Fields []string
+}
+
+// SearchPasswordsAdvanced returns the entries with a field among
+// opts.Fields that matches query. Everything but the name is encrypted,
+// so the entries are decrypted and matched in memory. Matching passwords
+// is refused in viewer sessions, which cannot read them; passwords
+// encrypted to recipients without a matching identity never match.
+func (db *Database) SearchPasswordsAdvanced(query string, opts SearchOptions) ([]SearchMatch, error) {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = DefaultSearchFields
+	}
+	wanted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if !isSearchField(field) {
+			return nil, fmt.Errorf("unknown search field %q (one of %s)", field, strings.Join(SearchFields, ", "))
+		}
+		wanted[field] = true
+	}
+	if wanted[FieldPassword] && db.viewer {
+		return nil, fmt.Errorf("passwords are redacted in viewer sessions, so they cannot be searched")
+	}
+
+	match, err := searchMatcher(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := db.listEntries(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search passwords: %w", err)
+	}
+
+	var matches []SearchMatch
+	for _, entry := range entries {
+		var matched []string
+		for _, field := range SearchFields {
+			if wanted[field] && fieldMatches(entry, field, match) {
+				matched = append(matched, field)
+			}
+		}
+		if len(matched) > 0 {
+			matches = append(matches, SearchMatch{Entry: entry, Fields: matched})
+		}
+	}
+	return matches, nil
+}
+
+// isSearchField reports whether field is one of SearchFields
+func isSearchField(field string) bool {
+	for _, f := range SearchFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// searchMatcher returns what matches a value against query under opts
+func searchMatcher(query string, opts SearchOptions) (func(string) bool, error) {
+	if opts.Regex {
+		expr := query
+		if !opts.CaseSensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return re.MatchString, nil
+	}
+	if opts.CaseSensitive {
+		return func(value string) bool { return strings.Contains(value, query) }, nil
+	}
+	query = strings.ToLower(query)
+	return func(value string) bool { return strings.Contains(strings.ToLower(value), query) }, nil
+}
+
+// fieldMatches reports whether field of entry matches. Empty fields
+// never do, so a pattern such as ^$ does not find every entry without a
+// URL.
+func fieldMatches(entry *PasswordEntry, field string, match func(string) bool) bool {
+	var values []string
+	switch field {
+	case FieldName:
+		values = []string{entry.Name}
+	case FieldUsername:
+		values = []string{entry.Username}
+	case FieldURL:
+		values = []string{entry.URL}
+	case FieldNotes:
+		values = []string{entry.Notes}
+	case FieldTags:
+		values = entry.Tags
+	case FieldPassword:
+		if !entry.Locked {
+			values = []string{entry.Password}
+		}
+	}
+	for _, value := range values {
+		if value != "" && match(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	"password-manager/internal/collation"
+)
+
+// The ways a name can be similar to another, closest first
+const (
+	similarFold        = iota // the same but for case
+	similarEdit               // a few typos apart
+	similarSubsequence        // holds the other's letters in order
+)
+
+// FindSimilar returns up to limit names of entries other than name that
+// look like it, for when name was mistyped: those equal to it but for
+// case, those a few edits away, counting a swap of neighbouring letters
+// as one, and those holding its letters in order, such as "gmail" for
+// "gml". The allowed edits grow with the length of name, one for every
+// three characters; names shorter than three characters only match by
+// case. The closest come first, then in the order of the collator. A
+// limit of 0 or less returns them all.
+func (db *Database) FindSimilar(name string, limit int) ([]string, error) {
+	entries, err := db.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	query := []rune(strings.ToLower(name))
+	maxEdits := len(query) / 3
+
+	type candidate struct {
+		name     string
+		kind     int
+		distance int
+	}
+	var found []candidate
+	for _, entry := range entries {
+		if entry.Name == name {
+			continue
+		}
+		other := []rune(strings.ToLower(entry.Name))
+		distance := editDistance(query, other)
+		switch {
+		case distance == 0:
+			found = append(found, candidate{entry.Name, similarFold, 0})
+		case distance <= maxEdits:
+			found = append(found, candidate{entry.Name, similarEdit, distance})
+		case len(query) >= 3 && isSubsequence(query, other):
+			found = append(found, candidate{entry.Name, similarSubsequence, distance})
+		}
+	}
+
+	collator := collation.Of(db.collator)
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		return collator.Less(a.name, b.name)
+	})
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	names := make([]string, len(found))
+	for i, c := range found {
+		names[i] = c.name
+	}
+	return names, nil
+}
+
+// editDistance returns the optimal string alignment distance of a and b:
+// the insertions, deletions, substitutions and swaps of neighbouring
+// runes that turn one into the other
+func editDistance(a, b []rune) int {
+	// Three rows of the table: two back, the last and the current
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+// isSubsequence reports whether the runes of sub appear in s in order
+func isSubsequence(sub, s []rune) bool {
+	i := 0
+	for _, r := range s {
+		if i < len(sub) && sub[i] == r {
+			i++
+		}
+	}
+	return i == len(sub)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"password-manager/internal/collation"
+)
+
+// DefaultBatchSize is how many rows ForEachEntry fetches at a time unless
+// told otherwise
+const DefaultBatchSize = 500
+
+// ForEachOptions controls ForEachEntry
+type ForEachOptions struct {
+	// Secrets decrypts passwords and note bodies, as ListPasswords does;
+	// otherwise entries carry metadata only, as from ListMetadata
+	Secrets bool
+	// BatchSize is how many rows are fetched per query; zero means
+	// DefaultBatchSize
+	BatchSize int
+}
+
+// ForEachEntry calls fn with every entry in the order of the collator,
+// fetching and decrypting them a batch at a time so memory use does not
+// grow with the vault beyond the names and IDs it orders. Entries that
+// cannot be decrypted are skipped as in listings. It stops at the first
+// error from fn, or when ctx is done, and returns that error.
+func (db *Database) ForEachEntry(ctx context.Context, opts ForEachOptions, fn func(*PasswordEntry) error) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	// SQLite orders names by their bytes, so the order is taken from the
+	// names alone and the entries are fetched by ID
+	ids, err := db.orderedIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for len(ids) > 0 {
+		n := batchSize
+		if n > len(ids) {
+			n = len(ids)
+		}
+		batch, err := db.entryBatch(ctx, opts.Secrets, ids[:n])
+		if err != nil {
+			return err
+		}
+		for _, entry := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// orderedIDs returns the IDs of all entries in the order of the collator
+// by name, entries sharing a name by ID
+func (db *Database) orderedIDs(ctx context.Context) ([]int64, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT id, name FROM passwords ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	defer rows.Close()
+
+	type row struct {
+		id   int64
+		name string
+	}
+	var all []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.name); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		all = append(all, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+
+	collation.Of(db.collator).Slice(all, func(i int) string { return all[i].name })
+	ids := make([]int64, len(all))
+	for i, r := range all {
+		ids[i] = r.id
+	}
+	return ids, nil
+}
+
+// entryBatch reads the entries with ids, in that order, and returns the
+// readable ones
+func (db *Database) entryBatch(ctx context.Context, secrets bool, ids []int64) ([]*PasswordEntry, error) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := db.db.QueryContext(ctx, `SELECT `+entryColumns+` FROM passwords WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*PasswordEntry, len(ids))
+	for rows.Next() {
+		entry, ok, err := db.scanEntry(rows, secrets)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			byID[entry.ID] = entry
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query passwords: %w", err)
+	}
+	rows.Close()
+
+	// Entries deleted since the IDs were read are left out
+	batch := make([]*PasswordEntry, 0, len(byID))
+	for _, id := range ids {
+		if entry, ok := byID[id]; ok {
+			batch = append(batch, entry)
+		}
+	}
+	if secrets && !db.viewer {
+		if err := db.loadAcks(batch); err != nil {
+			return nil, err
+		}
+	}
+	return batch, nil
+}
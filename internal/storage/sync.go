@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"password-manager/internal/crypto"
+)
+
+// Sides of a sync, and the policies choosing between them
+const (
+	SyncLocal  = "local"
+	SyncRemote = "remote"
+	// SyncNewer keeps whichever side was updated last; local wins ties
+	SyncNewer = "newer"
+)
+
+// sqliteTimestamp is the layout of CURRENT_TIMESTAMP
+const sqliteTimestamp = "2006-01-02 15:04:05"
+
+// SyncConflict records an entry that differed between the two vaults of
+// a sync, and the version that lost
+type SyncConflict struct {
+	ID              int64
+	RunID           string
+	Name            string
+	LocalUpdatedAt  time.Time
+	RemoteUpdatedAt time.Time
+	// Winner is SyncLocal or SyncRemote
+	Winner    string
+	CreatedAt time.Time
+	// RestoredAt is when the losing version was restored; zero if never
+	RestoredAt time.Time
+}
+
+// RemoteNewerLost reports whether the remote version was the newer one
+// but the local one was kept, so a recent change may have been dropped
+func (c *SyncConflict) RemoteNewerLost() bool {
+	return c.Winner == SyncLocal && c.RemoteUpdatedAt.After(c.LocalUpdatedAt)
+}
+
+// SyncResult summarizes a sync run
+type SyncResult struct {
+	RunID     string
+	Added     int
+	Unchanged int
+	Conflicts []*SyncConflict
+	// Skipped are entries whose password one side cannot read, as it is
+	// encrypted to recipients without a loaded identity
+	Skipped []string
+	// Outcomes has the outcome of each remote entry, in order
+	Outcomes []ImportOutcome
+}
+
+// SyncFrom brings the entries of remote into the vault. Entries only the
+// remote has are added; entries that differ are resolved by prefer, one
+// of SyncNewer, SyncLocal and SyncRemote. Every conflict is logged with
+// an encrypted snapshot of the losing version, so it can be restored.
+// All changes are made in one transaction.
+func (db *Database) SyncFrom(remote *Database, prefer string) (*SyncResult, error) {
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+	if remote.viewer {
+		return nil, fmt.Errorf("the remote vault was opened with its viewer credential, which cannot read passwords")
+	}
+	switch prefer {
+	case SyncNewer, SyncLocal, SyncRemote:
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q (supported: newer, local, remote)", prefer)
+	}
+
+	runID, err := crypto.GenerateRandomBytes(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate sync run ID: %w", err)
+	}
+	result := &SyncResult{RunID: hex.EncodeToString(runID)}
+
+	remoteEntries, err := remote.ListPasswords()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote vault: %w", err)
+	}
+	localEntries, err := db.ListPasswords()
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[string]*PasswordEntry, len(localEntries))
+	for _, entry := range localEntries {
+		local[entry.Name] = entry
+	}
+
+	type write struct {
+		entry    *PasswordEntry
+		update   bool
+		snapshot string
+		conflict *SyncConflict
+	}
+	var writes []*write
+	for _, incoming := range remoteEntries {
+		existing, ok := local[incoming.Name]
+		if incoming.Locked || (ok && existing.Locked) {
+			result.Skipped = append(result.Skipped, incoming.Name)
+			result.Outcomes = append(result.Outcomes, ImportOutcome{Name: incoming.Name, Username: incoming.Username, Outcome: OutcomeFailed,
+				Reason: "encrypted to recipients without a loaded identity"})
+			continue
+		}
+		if !ok {
+			added := *incoming
+			added.ID = 0
+			writes = append(writes, &write{entry: &added})
+			result.Added++
+			result.Outcomes = append(result.Outcomes, ImportOutcome{Name: incoming.Name, Username: incoming.Username, Outcome: OutcomeImported})
+			continue
+		}
+		if sameContent(existing, incoming) && existing.Notes == incoming.Notes {
+			result.Unchanged++
+			result.Outcomes = append(result.Outcomes, ImportOutcome{Name: incoming.Name, Username: incoming.Username, Outcome: OutcomeSkipped,
+				Reason: "unchanged"})
+			continue
+		}
+
+		conflict := &SyncConflict{
+			RunID:           result.RunID,
+			Name:            incoming.Name,
+			LocalUpdatedAt:  existing.UpdatedAt,
+			RemoteUpdatedAt: incoming.UpdatedAt,
+			Winner:          prefer,
+		}
+		if prefer == SyncNewer {
+			conflict.Winner = SyncLocal
+			if incoming.UpdatedAt.After(existing.UpdatedAt) {
+				conflict.Winner = SyncRemote
+			}
+		}
+		w := &write{conflict: conflict}
+		loser := incoming
+		outcome := ImportOutcome{Name: incoming.Name, Username: incoming.Username, Outcome: OutcomeSkipped, Reason: "conflict; kept the local version"}
+		if conflict.Winner == SyncRemote {
+			outcome = ImportOutcome{Name: incoming.Name, Username: incoming.Username, Outcome: OutcomeUpdated, Reason: "conflict; took the remote version"}
+			updated := *incoming
+			updated.ID = existing.ID
+			w.entry, w.update, loser = &updated, true, existing
+		}
+		if w.snapshot, err = db.sealSnapshot(loser); err != nil {
+			return nil, err
+		}
+		writes = append(writes, w)
+		result.Conflicts = append(result.Conflicts, conflict)
+		result.Outcomes = append(result.Outcomes, outcome)
+	}
+
+	// The remote's change time is kept, so syncing back the other way
+	// does not see the copy as newer; the conflict log is written with the
+	// entries
+	cs := db.NewChangeSet()
+	for _, w := range writes {
+		w := w
+		switch {
+		case w.entry == nil:
+		case w.update:
+			cs.Update(w.entry)
+		default:
+			cs.Add(w.entry)
+		}
+		cs.after = append(cs.after, func(tx *sql.Tx) error {
+			if w.entry != nil {
+				if _, err := tx.Exec(`UPDATE passwords SET updated_at = ? WHERE id = ?`,
+					w.entry.UpdatedAt.UTC().Format(sqliteTimestamp), w.entry.ID); err != nil {
+					return fmt.Errorf("%s: failed to keep the change time: %w", w.entry.Name, err)
+				}
+			}
+			if w.conflict != nil {
+				return insertSyncConflict(tx, w.conflict, w.snapshot)
+			}
+			return nil
+		})
+	}
+	if _, err := cs.Apply(context.Background()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sealSnapshot encrypts a whole entry under the data key
+func (db *Database) sealSnapshot(entry *PasswordEntry) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	snapshot, err := db.encryptValue(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func insertSyncConflict(tx *sql.Tx, c *SyncConflict, snapshot string) error {
+	c.CreatedAt = time.Now().UTC()
+	result, err := tx.Exec(`INSERT INTO sync_conflicts
+		(run_id, name, local_updated_at, remote_updated_at, winner, snapshot, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.RunID, c.Name, c.LocalUpdatedAt.UTC().Format(time.RFC3339Nano),
+		c.RemoteUpdatedAt.UTC().Format(time.RFC3339Nano), c.Winner, snapshot,
+		c.CreatedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("failed to log sync conflict: %w", err)
+	}
+	c.ID, err = result.LastInsertId()
+	return err
+}
+
+// SyncConflicts returns the logged sync conflicts, newest first
+func (db *Database) SyncConflicts() ([]*SyncConflict, error) {
+	rows, err := db.db.Query(`SELECT id, run_id, name, local_updated_at, remote_updated_at, winner, created_at, restored_at
+		FROM sync_conflicts ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync conflicts: %w", err)
+	}
+	defer rows.Close()
+
+	var conflicts []*SyncConflict
+	for rows.Next() {
+		c := &SyncConflict{}
+		var localAt, remoteAt, createdAt string
+		var restoredAt sql.NullString
+		if err := rows.Scan(&c.ID, &c.RunID, &c.Name, &localAt, &remoteAt, &c.Winner, &createdAt, &restoredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.LocalUpdatedAt = parseTimestamp(localAt)
+		c.RemoteUpdatedAt = parseTimestamp(remoteAt)
+		c.CreatedAt = parseTimestamp(createdAt)
+		if restoredAt.Valid {
+			c.RestoredAt = parseTimestamp(restoredAt.String)
+		}
+		conflicts = append(conflicts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query sync conflicts: %w", err)
+	}
+	return conflicts, nil
+}
+
+// RestoreSyncConflict saves the losing version of a logged conflict as a
+// new entry named name and marks the conflict restored
+func (db *Database) RestoreSyncConflict(id int64, name string) (*PasswordEntry, error) {
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+
+	var snapshot string
+	err := db.db.QueryRow(`SELECT snapshot FROM sync_conflicts WHERE id = ?`, id).Scan(&snapshot)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no sync conflict with ID %d", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync conflict: %w", err)
+	}
+	data, err := decryptField(snapshot, db.dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt snapshot: %w", err)
+	}
+	var entry PasswordEntry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	if exists, err := db.hasEntry(name); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, fmt.Errorf("an entry named %s already exists", name)
+	}
+
+	entry.ID = 0
+	entry.Name = name
+	if err := db.SavePassword(&entry); err != nil {
+		return nil, err
+	}
+	if _, err := db.db.Exec(`UPDATE sync_conflicts SET restored_at = ? WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339Nano), id); err != nil {
+		return nil, fmt.Errorf("failed to mark sync conflict restored: %w", err)
+	}
+	return &entry, nil
+}
+
+// PruneSyncConflicts deletes the conflicts logged before cutoff and
+// returns how many there were
+func (db *Database) PruneSyncConflicts(cutoff time.Time) (int, error) {
+	if err := db.writable(); err != nil {
+		return 0, err
+	}
+	result, err := db.db.Exec(`DELETE FROM sync_conflicts WHERE created_at < ?`, cutoff.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune sync conflicts: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// reencryptSnapshots moves the conflict snapshots from oldKey to newKey
+func reencryptSnapshots(tx *sql.Tx, oldKey, newKey string) error {
+	rows, err := tx.Query(`SELECT id, snapshot FROM sync_conflicts`)
+	if err != nil {
+		return fmt.Errorf("failed to query sync conflicts: %w", err)
+	}
+	snapshots := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var snapshot string
+		if err := rows.Scan(&id, &snapshot); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshots[id] = snapshot
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read sync conflicts: %w", err)
+	}
+
+	for id, snapshot := range snapshots {
+		data, err := decryptField(snapshot, oldKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt sync conflict %d: %w", id, err)
+		}
+		if snapshot, err = sealField(data, newKey); err != nil {
+			return fmt.Errorf("failed to encrypt sync conflict %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`UPDATE sync_conflicts SET snapshot = ? WHERE id = ?`, snapshot, id); err != nil {
+			return fmt.Errorf("failed to update sync conflict %d: %w", id, err)
+		}
+	}
+	return nil
+}
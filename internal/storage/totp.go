@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"password-manager/internal/totp"
+)
+
+// metaTOTPPrefix prefixes the metadata keys holding the encrypted TOTP
+// parameters of entries
+const metaTOTPPrefix = "totp:"
+
+// SetTOTP stores the TOTP parameters of an entry, encrypted like its
+// password, after validating them. nil removes them.
+func (db *Database) SetTOTP(name string, params *totp.Params) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	key := metaTOTPPrefix + name
+	if params == nil {
+		if _, err := db.db.Exec(`DELETE FROM metadata WHERE key = ?`, key); err != nil {
+			return fmt.Errorf("failed to delete TOTP settings: %w", err)
+		}
+		return nil
+	}
+
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	if exists, err := db.hasEntry(name); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+
+	value, err := db.sealTOTP(params)
+	if err != nil {
+		return err
+	}
+	if _, err := db.db.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`, key, value); err != nil {
+		return fmt.Errorf("failed to save TOTP settings: %w", err)
+	}
+	return nil
+}
+
+// TOTP returns the TOTP parameters of an entry, or nil if it has none.
+// Viewer sessions cannot read them.
+func (db *Database) TOTP(name string) (*totp.Params, error) {
+	if db.viewer {
+		return nil, ErrReadOnly
+	}
+	value, err := db.getMetadata(metaTOTPPrefix + name)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	data, err := decryptField(value, db.dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt TOTP settings: %w", err)
+	}
+	var params totp.Params
+	if err := json.Unmarshal([]byte(data), &params); err != nil {
+		return nil, fmt.Errorf("failed to decode TOTP settings: %w", err)
+	}
+	return &params, nil
+}
+
+// TOTPNames returns the names of the entries with TOTP parameters,
+// without decrypting them
+func (db *Database) TOTPNames() (map[string]bool, error) {
+	rows, err := db.db.Query(`SELECT key FROM metadata WHERE substr(key, 1, ?) = ?`, len(metaTOTPPrefix), metaTOTPPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query TOTP settings: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan TOTP settings: %w", err)
+		}
+		names[strings.TrimPrefix(key, metaTOTPPrefix)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read TOTP settings: %w", err)
+	}
+	return names, nil
+}
+
+// sealTOTP encodes TOTP parameters and encrypts them under the data key
+func (db *Database) sealTOTP(params *totp.Params) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode TOTP settings: %w", err)
+	}
+	value, err := db.encryptValue(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt TOTP settings: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"password-manager/internal/totp"
+)
+
+// ErrNotInTrash is returned when restoring a name the trash does not hold
+var ErrNotInTrash = errors.New("no entry of that name in the trash")
+
+// ErrRestoreConflict is returned when an entry is restored under a name a
+// live entry has taken since
+var ErrRestoreConflict = errors.New("name is taken by another entry")
+
+// TrashItem is an entry in the trash
+type TrashItem struct {
+	ID        int64
+	Name      string
+	DeletedAt time.Time
+}
+
+// trashedEntry is what the trash keeps of an entry besides its password,
+// sealed under the data key
+type trashedEntry struct {
+	Entry    *PasswordEntry `json:"entry"`
+	TOTP     *totp.Params   `json:"totp,omitempty"`
+	Autotype string         `json:"autotype,omitempty"`
+	// History and Icon are kept in the trash only, as a restored entry
+	// gets a new ID the rows keyed by the old one would not follow
+	History []trashedPassword `json:"history,omitempty"`
+	Icon    *Favicon          `json:"icon,omitempty"`
+}
+
+// trashedPassword is a password from the history of a trashed entry. The
+// data key is taken off, as the snapshot holding it is sealed under the
+// data key itself; a password encrypted to recipients stays so.
+type trashedPassword struct {
+	Password   string `json:"password"`
+	Recipients string `json:"recipients,omitempty"`
+	ReplacedAt string `json:"replaced_at"`
+}
+
+// trashRow is the stored form of a trashed entry. The password column is
+// kept as it was, with the recipients it was encrypted to, so passwords
+// encrypted to someone else survive the trip.
+type trashRow struct {
+	name       string
+	snapshot   string
+	password   string
+	recipients sql.NullString
+}
+
+// trashRowOf reads everything the trash keeps of the entry called name.
+// With history set its password history and icon are kept too, which the
+// journal's before-images do without: rolling back an update keeps the ID.
+func (db *Database) trashRowOf(name string, history bool) (*trashRow, error) {
+	rows, err := db.db.Query(`SELECT `+entryColumns+` FROM passwords WHERE name = ?`, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query password: %w", err)
+	}
+	var entry *PasswordEntry
+	ok := false
+	if rows.Next() {
+		entry, ok, err = db.scanEntry(rows, true)
+	}
+	rows.Close()
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	case !ok:
+		return nil, fmt.Errorf("%s cannot be decrypted, so it cannot go to the trash; delete it permanently instead", name)
+	}
+
+	row := &trashRow{name: name}
+	if err := db.db.QueryRow(`SELECT encrypted_password, recipients FROM passwords WHERE id = ?`, entry.ID).
+		Scan(&row.password, &row.recipients); err != nil {
+		return nil, fmt.Errorf("failed to read password: %w", err)
+	}
+	kept := trashedEntry{Entry: entry}
+	if kept.TOTP, err = db.TOTP(name); err != nil {
+		return nil, err
+	}
+	if kept.Autotype, err = db.AutotypeSequence(name); err != nil {
+		return nil, err
+	}
+	if history {
+		if kept.History, err = db.trashedHistory(entry.ID); err != nil {
+			return nil, err
+		}
+		if kept.Icon, err = db.Favicon(name); err != nil {
+			return nil, err
+		}
+	}
+
+	entry.Password = ""
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode trashed entry: %w", err)
+	}
+	if row.snapshot, err = db.encryptValue(string(data)); err != nil {
+		return nil, fmt.Errorf("failed to encrypt trashed entry: %w", err)
+	}
+	return row, nil
+}
+
+// trashedHistory reads the password history of the entry id, oldest
+// first
+func (db *Database) trashedHistory(id int64) ([]trashedPassword, error) {
+	rows, err := db.db.Query(`SELECT encrypted_password, recipients, replaced_at FROM password_history
+		WHERE entry_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query password history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []trashedPassword
+	for rows.Next() {
+		var value string
+		var recipients sql.NullString
+		var item trashedPassword
+		if err := rows.Scan(&value, &recipients, &item.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		if item.Password, err = decryptField(value, db.dataKey); err != nil {
+			return nil, fmt.Errorf("failed to decrypt password history: %w", err)
+		}
+		item.Recipients = recipients.String
+		history = append(history, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password history: %w", err)
+	}
+	return history, nil
+}
+
+// trashEntry moves the entry read into row to the trash within tx
+func (db *Database) trashEntry(tx *sql.Tx, row *trashRow) error {
+	if _, err := tx.Exec(`INSERT INTO trash (name, snapshot, encrypted_password, recipients, deleted_at) VALUES (?, ?, ?, ?, ?)`,
+		row.name, row.snapshot, row.password, row.recipients, time.Now().UTC().Format(sqliteTimestamp)); err != nil {
+		return fmt.Errorf("failed to move entry to the trash: %w", err)
+	}
+	return db.deleteEntry(tx, row.name)
+}
+
+// ListTrash returns the entries in the trash, most recently deleted first
+func (db *Database) ListTrash() ([]TrashItem, error) {
+	rows, err := db.db.Query(`SELECT id, name, deleted_at FROM trash ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %w", err)
+	}
+	defer rows.Close()
+
+	var items []TrashItem
+	for rows.Next() {
+		var item TrashItem
+		var deletedAt string
+		if err := rows.Scan(&item.ID, &item.Name, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trash: %w", err)
+		}
+		item.DeletedAt = parseTimestamp(deletedAt)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+	return items, nil
+}
+
+// Restore brings the entry called name back from the trash, with its
+// timestamps, TOTP settings, autotype sequence, password history and
+// icon. If the name was
+// deleted more than once, the latest deletion is restored. A live entry
+// with the name makes it fail with ErrRestoreConflict; see RestoreAs.
+func (db *Database) Restore(name string) error {
+	return db.RestoreAs(name, name)
+}
+
+// RestoreAs restores the entry deleted as name under the name as
+func (db *Database) RestoreAs(name, as string) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	var id int64
+	var snapshot, password string
+	var recipients sql.NullString
+	err := db.db.QueryRow(`SELECT id, snapshot, encrypted_password, recipients FROM trash WHERE name = ? ORDER BY id DESC LIMIT 1`, name).
+		Scan(&id, &snapshot, &password, &recipients)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrNotInTrash, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read trash: %w", err)
+	}
+	data, err := decryptField(snapshot, db.dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt trashed entry: %w", err)
+	}
+	var kept trashedEntry
+	if err := json.Unmarshal([]byte(data), &kept); err != nil {
+		return fmt.Errorf("failed to decode trashed entry: %w", err)
+	}
+
+	if exists, err := db.hasEntry(as); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrRestoreConflict, as)
+	}
+
+	entry := kept.Entry
+	entry.ID = 0
+	entry.Name = as
+	decrypted, err := decryptField(password, db.dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	entry.Locked = db.openSecret(entry, decrypted) != nil
+	row, err := db.encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	var totpValue string
+	if kept.TOTP != nil {
+		if totpValue, err = db.sealTOTP(kept.TOTP); err != nil {
+			return err
+		}
+	}
+	history := make([]string, len(kept.History))
+	for i, item := range kept.History {
+		if history[i], err = db.encryptValue(item.Password); err != nil {
+			return fmt.Errorf("failed to encrypt password history: %w", err)
+		}
+	}
+
+	db.cache.clear()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertEntry(tx, entry, row); err != nil {
+		return err
+	}
+	// The password goes back as it was stored, readable or not
+	if _, err := tx.Exec(`UPDATE passwords SET encrypted_password = ?, recipients = ?, created_at = ?, updated_at = ? WHERE id = ?`,
+		password, recipients, entry.CreatedAt.UTC().Format(sqliteTimestamp), entry.UpdatedAt.UTC().Format(sqliteTimestamp), entry.ID); err != nil {
+		return fmt.Errorf("failed to restore password: %w", err)
+	}
+	if totpValue != "" {
+		if err := setMetadataTx(tx, metaTOTPPrefix+as, totpValue); err != nil {
+			return err
+		}
+	}
+	if kept.Autotype != "" {
+		if err := setMetadataTx(tx, metaAutotypePrefix+as, kept.Autotype); err != nil {
+			return err
+		}
+	}
+	for i, item := range kept.History {
+		recipients := sql.NullString{String: item.Recipients, Valid: item.Recipients != ""}
+		if _, err := tx.Exec(`INSERT INTO password_history (entry_id, encrypted_password, recipients, replaced_at)
+			VALUES (?, ?, ?, ?)`, entry.ID, history[i], recipients, item.ReplacedAt); err != nil {
+			return fmt.Errorf("failed to restore password history: %w", err)
+		}
+	}
+	if icon := kept.Icon; icon != nil {
+		if _, err := tx.Exec(`INSERT INTO favicons (entry_id, content_type, data, fetched_at) VALUES (?, ?, ?, ?)`,
+			entry.ID, icon.ContentType, icon.Data, icon.FetchedAt.UTC().Format(sqliteTimestamp)); err != nil {
+			return fmt.Errorf("failed to restore icon: %w", err)
+		}
+	}
+	if !entry.Locked {
+		if err := db.updateReuseIndex(tx, []*PasswordEntry{entry}); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM trash WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to take entry out of the trash: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes the entries trashed more than olderThan
+// ago, or all of them for 0, and returns how many there were
+func (db *Database) PurgeTrash(olderThan time.Duration) (int, error) {
+	if err := db.writable(); err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-olderThan).UTC().Format(sqliteTimestamp)
+	result, err := db.db.Exec(`DELETE FROM trash WHERE deleted_at <= ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to empty trash: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(n), nil
+}
+
+// reencryptTrash moves the trashed entries from oldKey to newKey
+func reencryptTrash(tx *sql.Tx, oldKey, newKey string) error {
+	rows, err := tx.Query(`SELECT id, snapshot, encrypted_password FROM trash`)
+	if err != nil {
+		return fmt.Errorf("failed to query trash: %w", err)
+	}
+	values := make(map[int64][2]string)
+	for rows.Next() {
+		var id int64
+		var value [2]string
+		if err := rows.Scan(&id, &value[0], &value[1]); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan trash: %w", err)
+		}
+		values[id] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read trash: %w", err)
+	}
+
+	for id, value := range values {
+		for i := range value {
+			plain, err := decryptField(value[i], oldKey)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt trashed entry %d: %w", id, err)
+			}
+			if value[i], err = sealField(plain, newKey); err != nil {
+				return fmt.Errorf("failed to encrypt trashed entry %d: %w", id, err)
+			}
+		}
+		if _, err := tx.Exec(`UPDATE trash SET snapshot = ?, encrypted_password = ? WHERE id = ?`, value[0], value[1], id); err != nil {
+			return fmt.Errorf("failed to update trash: %w", err)
+		}
+	}
+	return nil
+}
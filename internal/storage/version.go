@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"password-manager/internal/appversion"
+)
+
+// metaMinAppVersion holds the oldest version of the app that can read the
+// vault. Vaults from before it was recorded read as baseVersion.
+const metaMinAppVersion = "min_app_version"
+
+// baseVersion is the version vaults without a recorded minimum need
+const baseVersion = "1.0.0"
+
+// formatChange is a change to the on-disk format that versions before it
+// cannot read: a vault holding data in the new format must not be opened
+// by them. migrate, if set, converts what is already stored.
+type formatChange struct {
+	version     string
+	description string
+	migrate     func(db *Database) error
+}
+
+// formatChanges lists the format changes, oldest first. Adding columns
+// and tables that older versions ignore is not one; initSchema does those
+// on open.
+var formatChanges = []formatChange{
+	{version: "1.1.0", description: "encrypted values may be derived with Argon2id"},
+	{version: "1.2.0", description: "fields are encrypted directly under the data key", migrate: (*Database).sealFields},
+	// Rows already stored are encrypted as they are read, by sealPlainFields
+	{version: "1.3.0", description: "usernames, URLs and notes are encrypted"},
+}
+
+// running is the version of this build, which the tests change
+var running = appversion.MustParse(appversion.Current)
+
+var (
+	// ErrVaultTooNew is returned when opening a vault that needs a newer
+	// version of the app
+	ErrVaultTooNew = errors.New("vault is from a newer version of the app")
+	// ErrUpgradeRequired is returned by write operations on a vault still
+	// in the format of an older version, until Upgrade is run
+	ErrUpgradeRequired = fmt.Errorf("%w until it is upgraded", ErrReadOnly)
+)
+
+// currentFormat returns the version whose format this build writes
+func currentFormat() appversion.Version {
+	return appversion.MustParse(formatChanges[len(formatChanges)-1].version)
+}
+
+// checkVersion compares the minimum version the vault records with this
+// build. A newer minimum refuses the vault, as this build could mangle
+// it; an older one leaves it read-only until Upgrade.
+func (db *Database) checkVersion() error {
+	// The oldest vaults have no metadata table until initSchema runs
+	var hasMetadata bool
+	err := db.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'metadata')`).Scan(&hasMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to inspect database: %w", err)
+	}
+	recorded := baseVersion
+	if hasMetadata {
+		if recorded, err = db.MinAppVersion(); err != nil {
+			return err
+		}
+	}
+	minimum, err := appversion.Parse(recorded)
+	if err != nil {
+		return fmt.Errorf("vault records an invalid minimum app version: %w", err)
+	}
+	if running.Less(minimum) {
+		return fmt.Errorf("%w: this vault requires v%s+, this is v%s", ErrVaultTooNew, minimum, running)
+	}
+	db.needsUpgrade = minimum.Less(currentFormat())
+	return nil
+}
+
+// MinAppVersion returns the oldest version of the app that can read the
+// vault
+func (db *Database) MinAppVersion() (string, error) {
+	recorded, err := db.getMetadata(metaMinAppVersion)
+	if err != nil || recorded != "" {
+		return recorded, err
+	}
+	return baseVersion, nil
+}
+
+// NeedsUpgrade reports whether the vault is in the format of an older
+// version and so open read-only
+func (db *Database) NeedsUpgrade() bool {
+	return db.needsUpgrade
+}
+
+// Upgrade moves the vault to the format of this build and records this
+// build's format as the minimum version, after which older versions
+// refuse it. It returns the descriptions of the changes applied, none if
+// the vault was already current.
+func (db *Database) Upgrade() (applied []string, err error) {
+	if db.viewer {
+		return nil, ErrReadOnly
+	}
+	minimum, err := db.MinAppVersion()
+	if err != nil {
+		return nil, err
+	}
+	from, err := appversion.Parse(minimum)
+	if err != nil {
+		return nil, fmt.Errorf("vault records an invalid minimum app version: %w", err)
+	}
+
+	// The migrations write; if one fails, the vault stays read-only at
+	// the last version reached
+	db.needsUpgrade = false
+	defer func() {
+		if err != nil {
+			db.checkVersion()
+		}
+	}()
+	for _, change := range formatChanges {
+		if !from.Less(appversion.MustParse(change.version)) {
+			continue
+		}
+		if change.migrate != nil {
+			if err := change.migrate(db); err != nil {
+				return applied, fmt.Errorf("failed to upgrade to v%s: %w", change.version, err)
+			}
+		}
+		if _, err := db.db.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`,
+			metaMinAppVersion, change.version); err != nil {
+			return applied, fmt.Errorf("failed to record app version: %w", err)
+		}
+		applied = append(applied, change.description)
+	}
+	return applied, nil
+}
+
+// writable returns why the vault cannot be written to, or nil if it can
+func (db *Database) writable() error {
+	if db.viewer {
+		return ErrReadOnly
+	}
+	if db.needsUpgrade {
+		return ErrUpgradeRequired
+	}
+	return db.CheckFile()
+}
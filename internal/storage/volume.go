@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrVaultUnavailable is returned when the vault file cannot be
+	// reached while the vault is open, as when the drive holding it has
+	// been removed. Writes are refused until CheckFile finds the same file
+	// at the path again.
+	ErrVaultUnavailable = errors.New("vault file is unavailable")
+	// ErrVaultReplaced is returned when another file has taken the place
+	// of the open vault, as a stale mount point or a restored copy would
+	ErrVaultReplaced = fmt.Errorf("%w: another file is at its path", ErrVaultUnavailable)
+)
+
+// recordFile notes which file the vault was opened from, for CheckFile
+func (db *Database) recordFile() error {
+	info, err := os.Stat(db.dbPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVaultUnavailable, err)
+	}
+	db.file = info
+	return nil
+}
+
+// CheckFile reports whether the file the vault was opened from is still
+// at its path: ErrVaultUnavailable when nothing can be read there, and
+// ErrVaultReplaced when a different file is. Files are told apart by
+// device and inode, as the size changes with every write. Vaults in
+// memory always pass.
+func (db *Database) CheckFile() error {
+	if db.dbPath == "" || db.file == nil {
+		return nil
+	}
+	info, err := os.Stat(db.dbPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVaultUnavailable, err)
+	}
+	if !os.SameFile(info, db.file) {
+		return fmt.Errorf("%w: %s", ErrVaultReplaced, db.dbPath)
+	}
+	return nil
+}
+
+// Reload picks the vault up again once its file is back at its path, as
+// when a removed drive is reinserted. The connection to a plain vault is
+// reopened, since the old one may still hold the file of the removed
+// drive; a fully encrypted vault works on its working copy and needs
+// nothing more. It fails like CheckFile while the file is missing or a
+// different one; such a file must be opened as a new session.
+func (db *Database) Reload() error {
+	if err := db.CheckFile(); err != nil {
+		return err
+	}
+	if db.dbPath == "" || db.workPath != "" {
+		return nil
+	}
+
+	conn, err := sql.Open("sqlite3", vaultDSN(db.dbPath))
+	if err == nil {
+		err = conn.Ping()
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return Unavailable(fmt.Errorf("failed to reopen vault: %w", err))
+	}
+	db.db.Close()
+	db.db = conn
+	db.cache.clear()
+	return nil
+}
+
+// Unavailable returns err marked with ErrVaultUnavailable when it is the
+// driver or the system failing to reach the vault file, such as an I/O
+// error from a removed drive or a file that no longer reads as a
+// database, and err unchanged otherwise
+func Unavailable(err error) error {
+	if err == nil || errors.Is(err, ErrVaultUnavailable) {
+		return err
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrIoErr, sqlite3.ErrCorrupt, sqlite3.ErrCantOpen, sqlite3.ErrNotADB:
+			return fmt.Errorf("%w: %w", ErrVaultUnavailable, err)
+		}
+	}
+	if errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.ENXIO) {
+		return fmt.Errorf("%w: %w", ErrVaultUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package suggest
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// genericLabels are subdomains that say nothing about the service, left
+// out of suggested names
+var genericLabels = map[string]bool{
+	"www": true, "m": true, "login": true, "signin": true, "auth": true,
+	"accounts": true, "account": true, "sso": true, "secure": true,
+}
+
+// Name suggests an entry name from a URL and username: the label before
+// the registrable domain, the registrable domain without its public
+// suffix, and the local part of the username, joined with hyphens. So
+// https://console.aws.amazon.com and ops@corp.com give aws-amazon-ops.
+// Punycode is decoded for readability. It returns "" if the URL has no
+// host.
+func Name(rawURL, username string) string {
+	host := hostParts(rawURL)
+	if host == nil {
+		return ""
+	}
+	var parts []string
+	for _, part := range append(host, localPart(username)) {
+		if part = clean(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Host returns the host of a URL in the form accounts on one site share:
+// lowercased, in punycode and without a leading www. A URL without a
+// scheme is taken as https. It returns "" if the URL has no host.
+func Host(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// hostParts returns the words of a URL's host that go into a name
+func hostParts(rawURL string) []string {
+	host := Host(rawURL)
+	if host == "" {
+		return nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+
+	var parts []string
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// A bare suffix or a single-label host such as localhost
+		parts = strings.Split(host, ".")
+	} else {
+		suffix, _ := publicsuffix.PublicSuffix(host)
+		if sub := strings.TrimSuffix(host, "."+registrable); sub != host {
+			labels := strings.Split(sub, ".")
+			if last := labels[len(labels)-1]; !genericLabels[last] {
+				parts = append(parts, last)
+			}
+		}
+		parts = append(parts, strings.TrimSuffix(registrable, "."+suffix))
+	}
+	for i, part := range parts {
+		if decoded, err := idna.Lookup.ToUnicode(part); err == nil {
+			parts[i] = decoded
+		}
+	}
+	return parts
+}
+
+// localPart returns the part of an email address before the @, or the
+// whole username if it is not one
+func localPart(username string) string {
+	if i := strings.LastIndexByte(username, '@'); i >= 0 {
+		return username[:i]
+	}
+	return username
+}
+
+// clean lowercases s and turns every run of characters other than
+// letters and digits into a single hyphen
+func clean(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
+
+// Unique returns name, or name with the first numeric suffix from -2 up
+// that taken does not report as in use
+func Unique(name string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+	for n := 2; ; n++ {
+		if candidate := name + "-" + strconv.Itoa(n); !taken(candidate) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package suggest
+
+import "testing"
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		url, username, want string
+	}{
+		{"https://console.aws.amazon.com", "ops@corp.com", "aws-amazon-ops"},
+		{"https://github.com/login", "octocat", "github-octocat"},
+		{"https://www.github.com", "", "github"},
+		{"https://accounts.google.com", "jane.doe@gmail.com", "google-jane-doe"},
+		{"https://a.b.example.co.uk/path", "", "b-example"},
+		{"example.org", "", "example"},
+		{"https://example.com:8443/admin", "root", "example-root"},
+		{"http://192.168.1.1:8080", "admin", "192-168-1-1-admin"},
+		{"http://[2001:db8::1]:8080", "", "2001-db8-1"},
+		{"http://localhost:3000", "dev", "localhost-dev"},
+		{"https://xn--mnchen-3ya.de", "", "münchen"},
+		{"https://shop.xn--bcher-kva.example", "", "shop-bücher"},
+		{"https://Login.Bank.COM.", "X_Y@bank.com", "bank-x-y"},
+		{"", "someone", ""},
+		{"not a url %%", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Name(tt.url, tt.username); got != tt.want {
+			t.Errorf("Name(%q, %q) = %q, want %q", tt.url, tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestUnique(t *testing.T) {
+	taken := map[string]bool{"aws": true, "aws-2": true}
+	if got := Unique("aws", func(name string) bool { return taken[name] }); got != "aws-3" {
+		t.Errorf("Unique = %q, want aws-3", got)
+	}
+	if got := Unique("gcp", func(name string) bool { return taken[name] }); got != "gcp" {
+		t.Errorf("Unique = %q, want gcp", got)
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct{ url, want string }{
+		{"https://www.Google.com/accounts", "google.com"},
+		{"google.com", "google.com"},
+		{"https://mail.google.com.", "mail.google.com"},
+		{"https://münchen.de", "xn--mnchen-3ya.de"},
+		{"http://192.168.1.1:8080", "192.168.1.1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Host(tt.url); got != tt.want {
+			t.Errorf("Host(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
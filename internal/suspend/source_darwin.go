@@ -0,0 +1,11 @@
+//go:build darwin
+
+package suspend
+
+// NewSource would subscribe to IOKit power notifications and the
+// NSWorkspace screen-lock notifications, both of which need cgo and
+// framework bindings this build does not carry. Until then macOS relies on
+// the GapDetector, which catches sleep after the fact on the next request.
+func NewSource() (Source, error) {
+	return nil, ErrUnsupported
+}
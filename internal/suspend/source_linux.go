@@ -0,0 +1,108 @@
+//go:build linux
+
+package suspend
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Match rules for the signals we care about. PrepareForSleep comes from
+// systemd-logind on the system bus, ActiveChanged from the session's
+// org.freedesktop.ScreenSaver implementation.
+const (
+	sleepMatch  = "type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForSleep'"
+	screenMatch = "type='signal',interface='org.freedesktop.ScreenSaver',member='ActiveChanged'"
+)
+
+// dbusSource follows dbus-monitor on the system and session buses. Using
+// the monitor binary keeps a D-Bus client library out of the build.
+type dbusSource struct {
+	events chan Event
+	cmds   []*exec.Cmd
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+// NewSource starts listening for suspend and screen-lock signals. It
+// returns ErrUnsupported when dbus-monitor is not installed or neither
+// bus can be monitored.
+func NewSource() (Source, error) {
+	if _, err := exec.LookPath("dbus-monitor"); err != nil {
+		return nil, ErrUnsupported
+	}
+
+	s := &dbusSource{events: make(chan Event, 4)}
+	for _, args := range [][]string{
+		{"--system", sleepMatch},
+		{"--session", screenMatch},
+	} {
+		cmd := exec.Command("dbus-monitor", args...)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			continue
+		}
+		if err := cmd.Start(); err != nil {
+			continue
+		}
+		s.cmds = append(s.cmds, cmd)
+		s.wg.Add(1)
+		go func(r io.Reader) {
+			defer s.wg.Done()
+			parseMonitor(r, s.events)
+		}(stdout)
+	}
+
+	if len(s.cmds) == 0 {
+		return nil, ErrUnsupported
+	}
+
+	go func() {
+		s.wg.Wait()
+		close(s.events)
+	}()
+	return s, nil
+}
+
+func (s *dbusSource) Events() <-chan Event {
+	return s.events
+}
+
+func (s *dbusSource) Close() error {
+	s.once.Do(func() {
+		for _, cmd := range s.cmds {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	})
+	return nil
+}
+
+// parseMonitor reads dbus-monitor output and emits an event whenever a
+// watched signal carries "boolean true" (going to sleep, screen locked).
+// Resume and unlock carry "boolean false" and are ignored: the key is
+// already gone and the next request has to unlock again.
+func parseMonitor(r io.Reader, events chan<- Event) {
+	scanner := bufio.NewScanner(r)
+	pending := -1
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "signal "):
+			pending = -1
+			if strings.Contains(line, "member=PrepareForSleep") {
+				pending = int(Sleep)
+			} else if strings.Contains(line, "member=ActiveChanged") {
+				pending = int(ScreenLock)
+			}
+		case pending >= 0 && strings.HasPrefix(line, "boolean "):
+			if line == "boolean true" {
+				events <- Event(pending)
+			}
+			pending = -1
+		}
+	}
+}
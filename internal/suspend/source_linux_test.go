@@ -0,0 +1,33 @@
+//go:build linux
+
+package suspend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMonitor(t *testing.T) {
+	output := `signal time=1700000000.1 sender=org.freedesktop.DBus -> destination=:1.5 serial=2 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameAcquired
+   string ":1.5"
+signal time=1700000001.2 sender=:1.3 -> destination=(null destination) serial=900 path=/org/freedesktop/login1; interface=org.freedesktop.login1.Manager; member=PrepareForSleep
+   boolean true
+signal time=1700000900.3 sender=:1.3 -> destination=(null destination) serial=901 path=/org/freedesktop/login1; interface=org.freedesktop.login1.Manager; member=PrepareForSleep
+   boolean false
+signal time=1700001000.4 sender=:1.40 -> destination=(null destination) serial=12 path=/org/freedesktop/ScreenSaver; interface=org.freedesktop.ScreenSaver; member=ActiveChanged
+   boolean true
+signal time=1700001100.5 sender=:1.40 -> destination=(null destination) serial=13 path=/org/freedesktop/ScreenSaver; interface=org.freedesktop.ScreenSaver; member=ActiveChanged
+   boolean false
+`
+	events := make(chan Event, 10)
+	parseMonitor(strings.NewReader(output), events)
+	close(events)
+
+	var got []Event
+	for e := range events {
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[0] != Sleep || got[1] != ScreenLock {
+		t.Errorf("Expected [Sleep ScreenLock], got %v", got)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package suspend
+
+// NewSource reports that no notification source exists on this platform;
+// callers fall back to the GapDetector
+func NewSource() (Source, error) {
+	return nil, ErrUnsupported
+}
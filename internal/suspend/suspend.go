@@ -0,0 +1,175 @@
+package suspend
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Event is a reason to drop cached key material
+type Event int
+
+const (
+	// Sleep is delivered just before the system suspends or hibernates
+	Sleep Event = iota
+	// ScreenLock is delivered when the user session is locked
+	ScreenLock
+	// ClockGap is delivered by the GapDetector when wall-clock time moved
+	// much further than monotonic time, i.e. the machine was asleep
+	ClockGap
+)
+
+// String returns a human-readable name for the event
+func (e Event) String() string {
+	switch e {
+	case Sleep:
+		return "system suspend"
+	case ScreenLock:
+		return "screen lock"
+	case ClockGap:
+		return "clock gap"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrUnsupported is returned by NewSource when the platform offers no
+// suspend or lock notifications; callers fall back to the GapDetector
+var ErrUnsupported = errors.New("suspend notifications not supported on this platform")
+
+// Source delivers suspend and screen-lock events
+type Source interface {
+	// Events returns the channel events are delivered on. It is closed
+	// when the source stops.
+	Events() <-chan Event
+	// Close stops the source
+	Close() error
+}
+
+// Locker is anything holding unlocked key material that must be wiped
+type Locker interface {
+	Lock()
+}
+
+// Watch calls l.Lock for every event delivered by src until the source is
+// closed. It blocks, so run it in its own goroutine.
+func Watch(src Source, l Locker) {
+	for range src.Events() {
+		l.Lock()
+	}
+}
+
+// DefaultGapThreshold is how far wall-clock time may run ahead of monotonic
+// time before the GapDetector assumes the machine was suspended
+const DefaultGapThreshold = 30 * time.Second
+
+// Clock reports wall-clock and monotonic time separately. Monotonic time
+// stops while the machine sleeps on most platforms, wall-clock time does not.
+type Clock interface {
+	Wall() time.Time
+	Monotonic() time.Duration
+}
+
+// systemClock reads the real clocks
+type systemClock struct {
+	start time.Time
+}
+
+func (c systemClock) Wall() time.Time {
+	// Round(0) strips the monotonic reading so comparisons use wall time
+	return time.Now().Round(0)
+}
+
+func (c systemClock) Monotonic() time.Duration {
+	return time.Since(c.start)
+}
+
+// SystemClock returns a Clock backed by the operating system clocks
+func SystemClock() Clock {
+	return systemClock{start: time.Now()}
+}
+
+// GapDetector detects a suspend after the fact by comparing how much
+// wall-clock and monotonic time elapsed between two checks. It is the
+// fallback where no Source is available; call Check on every request.
+type GapDetector struct {
+	mu        sync.Mutex
+	clock     Clock
+	threshold time.Duration
+	lastWall  time.Time
+	lastMono  time.Duration
+}
+
+// NewGapDetector returns a detector using clock, treating any gap larger
+// than threshold as a suspend
+func NewGapDetector(clock Clock, threshold time.Duration) *GapDetector {
+	if threshold <= 0 {
+		threshold = DefaultGapThreshold
+	}
+	return &GapDetector{
+		clock:     clock,
+		threshold: threshold,
+		lastWall:  clock.Wall(),
+		lastMono:  clock.Monotonic(),
+	}
+}
+
+// Check reports whether a suspend happened since the previous check
+func (g *GapDetector) Check() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wall := g.clock.Wall()
+	mono := g.clock.Monotonic()
+	wallElapsed := wall.Sub(g.lastWall)
+	monoElapsed := mono - g.lastMono
+	g.lastWall = wall
+	g.lastMono = mono
+
+	return wallElapsed-monoElapsed > g.threshold
+}
+
+// Monitor calls l.Lock for every event NewSource delivers. Where there is
+// no source, or once it stops, it falls back to a GapDetector checked
+// every interval, so a sleep is still caught once the machine wakes. It
+// returns what stops it.
+func Monitor(l Locker, interval time.Duration) (stop func()) {
+	src, err := NewSource()
+	if err != nil {
+		src = nil
+	}
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		monitor(src, NewGapDetector(SystemClock(), DefaultGapThreshold), ticker.C, l, done)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			if src != nil {
+				src.Close()
+			}
+		})
+	}
+}
+
+// monitor does the watching of Monitor until done is closed, checking gap
+// on every tick once src, if any, has stopped
+func monitor(src Source, gap *GapDetector, ticks <-chan time.Time, l Locker, done <-chan struct{}) {
+	if src != nil {
+		Watch(src, l)
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticks:
+			if gap.Check() {
+				l.Lock()
+			}
+		}
+	}
+}
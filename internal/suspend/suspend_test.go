@@ -0,0 +1,187 @@
+package suspend
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock lets tests move wall-clock and monotonic time independently
+type fakeClock struct {
+	mu   sync.Mutex
+	wall time.Time
+	mono time.Duration
+}
+
+func (c *fakeClock) Wall() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.wall
+}
+
+func (c *fakeClock) Monotonic() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mono
+}
+
+// advance moves both clocks, as happens while the machine is awake
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.wall = c.wall.Add(d)
+	c.mono += d
+	c.mu.Unlock()
+}
+
+// sleep moves only the wall clock, as happens while the machine is suspended
+func (c *fakeClock) sleep(d time.Duration) {
+	c.mu.Lock()
+	c.wall = c.wall.Add(d)
+	c.mu.Unlock()
+}
+
+func TestGapDetectorAwake(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)}
+	detector := NewGapDetector(clock, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		clock.advance(time.Hour)
+		if detector.Check() {
+			t.Fatalf("Expected no gap while awake (check %d)", i)
+		}
+	}
+}
+
+func TestGapDetectorSuspend(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)}
+	detector := NewGapDetector(clock, time.Minute)
+
+	clock.advance(5 * time.Minute)
+	clock.sleep(8 * time.Hour)
+	clock.advance(time.Second)
+	if !detector.Check() {
+		t.Fatal("Expected a gap after an overnight suspend")
+	}
+
+	// The gap is reported once, not on every following request
+	clock.advance(time.Minute)
+	if detector.Check() {
+		t.Error("Expected the gap to be reported only once")
+	}
+}
+
+func TestGapDetectorBelowThreshold(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)}
+	detector := NewGapDetector(clock, time.Minute)
+
+	// Small NTP adjustments must not lock the vault
+	clock.sleep(5 * time.Second)
+	if detector.Check() {
+		t.Error("Expected small wall-clock adjustments to be ignored")
+	}
+}
+
+func TestGapDetectorDefaultThreshold(t *testing.T) {
+	detector := NewGapDetector(&fakeClock{}, 0)
+	if detector.threshold != DefaultGapThreshold {
+		t.Errorf("Expected default threshold %v, got %v", DefaultGapThreshold, detector.threshold)
+	}
+}
+
+// fakeSource delivers events pushed by the test
+type fakeSource struct {
+	events chan Event
+}
+
+func (s *fakeSource) Events() <-chan Event { return s.events }
+func (s *fakeSource) Close() error         { close(s.events); return nil }
+
+// countingLocker records how often it was locked
+type countingLocker struct {
+	mu    sync.Mutex
+	locks int
+}
+
+func (l *countingLocker) Lock() {
+	l.mu.Lock()
+	l.locks++
+	l.mu.Unlock()
+}
+
+func TestWatch(t *testing.T) {
+	src := &fakeSource{events: make(chan Event)}
+	locker := &countingLocker{}
+
+	done := make(chan struct{})
+	go func() {
+		Watch(src, locker)
+		close(done)
+	}()
+
+	src.events <- Sleep
+	src.events <- ScreenLock
+	src.Close()
+	<-done
+
+	if locker.locks != 2 {
+		t.Errorf("Expected 2 locks, got %d", locker.locks)
+	}
+}
+
+func TestEventString(t *testing.T) {
+	if Sleep.String() != "system suspend" || ScreenLock.String() != "screen lock" || ClockGap.String() != "clock gap" {
+		t.Error("Unexpected event names")
+	}
+}
+
+func TestMonitorFallsBackToGaps(t *testing.T) {
+	src := &fakeSource{events: make(chan Event)}
+	clock := &fakeClock{wall: time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)}
+	gap := NewGapDetector(clock, time.Minute)
+	ticks := make(chan time.Time)
+	locker := &countingLocker{}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		monitor(src, gap, ticks, locker, done)
+		close(stopped)
+	}()
+
+	src.events <- Sleep
+	// The source stops; gaps are checked from then on
+	src.Close()
+	clock.advance(time.Minute)
+	ticks <- time.Time{}
+	clock.sleep(8 * time.Hour)
+	ticks <- time.Time{}
+	close(done)
+	<-stopped
+
+	if locker.locks != 2 {
+		t.Errorf("Expected a lock for the event and one for the gap, got %d", locker.locks)
+	}
+}
+
+func TestMonitorWithoutSource(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)}
+	gap := NewGapDetector(clock, time.Minute)
+	ticks := make(chan time.Time)
+	locker := &countingLocker{}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		monitor(nil, gap, ticks, locker, done)
+		close(stopped)
+	}()
+
+	clock.sleep(time.Hour)
+	ticks <- time.Time{}
+	close(done)
+	<-stopped
+
+	if locker.locks != 1 {
+		t.Errorf("Expected a lock for the gap, got %d", locker.locks)
+	}
+}
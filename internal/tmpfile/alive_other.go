@@ -0,0 +1,9 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package tmpfile
+
+// processAlive cannot tell on this platform, so every process is taken
+// as running and no directory is removed
+func processAlive(pid int) bool {
+	return true
+}
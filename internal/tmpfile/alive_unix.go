@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package tmpfile
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether a process with the ID pid runs, as seen
+// by sending it signal 0; one of another user counts too
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package tmpfile
+
+import "os"
+
+// processAlive reports whether a process with the ID pid can be opened.
+// One that cannot be for lack of rights is taken as gone; its directory
+// would then be another user's and cannot be removed anyway.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
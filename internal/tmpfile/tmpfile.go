@@ -0,0 +1,284 @@
+package tmpfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// EnvDir names the environment variable that overrides where the per-run
+// directory is created
+const EnvDir = "PM_TMPDIR"
+
+// Dir is a private directory for files holding secrets: decrypted vault
+// copies, notes being edited and the like. It is created on first use
+// with owner-only permissions, and everything in it is overwritten
+// before it is removed.
+type Dir struct {
+	mu      sync.Mutex
+	root    string
+	path    string
+	closed  bool
+	signals chan os.Signal
+}
+
+// New returns a Dir to be created under root, or under Root() if root is
+// empty
+func New(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// Root returns where per-run directories go: $PM_TMPDIR if set, else
+// $XDG_RUNTIME_DIR or /dev/shm, which are memory-backed on most systems
+// so plaintext never reaches a disk, else the system temp directory
+func Root() string {
+	if dir := os.Getenv(EnvDir); dir != "" {
+		return dir
+	}
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return os.TempDir()
+}
+
+// dir creates the directory if needed and returns its path
+func (d *Dir) dir() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return "", errors.New("temporary directory already cleaned up")
+	}
+	if d.path != "" {
+		return d.path, nil
+	}
+	root := d.root
+	if root == "" {
+		root = Root()
+	}
+	path, err := os.MkdirTemp(root, fmt.Sprintf("%s%d-*", runPrefix, os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	if err := os.Chmod(path, 0700); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to secure temporary directory: %w", err)
+	}
+	d.path = path
+	return path, nil
+}
+
+// Create creates a new file readable by the owner only, named after
+// pattern as in os.CreateTemp
+func (d *Dir) Create(pattern string) (*os.File, error) {
+	dir, err := d.dir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	return f, nil
+}
+
+// Path reserves a fresh path for a file the caller, or a library such as
+// SQLite, creates itself
+func (d *Dir) Path(pattern string) (string, error) {
+	f, err := d.Create(pattern)
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	f.Close()
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to reserve temporary file: %w", err)
+	}
+	return path, nil
+}
+
+// Cleanup wipes and removes every file in the directory and the directory
+// itself. Later calls to Create fail.
+func (d *Dir) Cleanup() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	if d.path == "" {
+		return nil
+	}
+	filepath.WalkDir(d.path, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			wipe(path)
+		}
+		return nil
+	})
+	if err := os.RemoveAll(d.path); err != nil {
+		return fmt.Errorf("failed to remove temporary directory: %w", err)
+	}
+	d.path = ""
+	return nil
+}
+
+// HandleSignals cleans up when SIGINT or SIGTERM arrives and then exits
+// the process with the conventional status
+func (d *Dir) HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	d.mu.Lock()
+	d.signals = signals
+	d.mu.Unlock()
+	go d.handle(signals, os.Exit)
+}
+
+// StopSignals undoes HandleSignals for a caller that handles SIGINT and
+// SIGTERM itself, such as to finish writing a file first. That caller
+// must call Cleanup before it exits.
+func (d *Dir) StopSignals() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.signals != nil {
+		signal.Stop(d.signals)
+		close(d.signals)
+		d.signals = nil
+	}
+}
+
+func (d *Dir) handle(signals <-chan os.Signal, exit func(int)) {
+	sig, ok := <-signals
+	if !ok {
+		return
+	}
+	d.Cleanup()
+	status := 130
+	if sig == syscall.SIGTERM {
+		status = 143
+	}
+	exit(status)
+}
+
+// runPrefix starts the names of per-run directories, followed by the
+// process ID
+const runPrefix = "pm-run-"
+
+// RemoveStale wipes and removes the per-run directories under root, or
+// under Root() if root is empty, that processes no longer running left
+// behind, such as after a crash or a kill. It returns how many it
+// removed.
+func RemoveStale(root string) (int, error) {
+	if root == "" {
+		root = Root()
+	}
+	return removeStale(root, processAlive)
+}
+
+// removeStale does the work of RemoveStale, asking alive whether a
+// process still runs
+func removeStale(root string, alive func(pid int) bool) (int, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		pid, ok := runPID(entry.Name())
+		if !ok || !entry.IsDir() || pid == os.Getpid() || alive(pid) {
+			continue
+		}
+		stale := &Dir{path: filepath.Join(root, entry.Name())}
+		if stale.Cleanup() == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// runPID returns the process ID in the name of a per-run directory
+func runPID(name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, runPrefix)
+	if !ok {
+		return 0, false
+	}
+	digits, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(digits)
+	return pid, err == nil && pid > 0
+}
+
+// Remove overwrites the file at path with zeros and removes it. A missing
+// file is not an error.
+func Remove(path string) error {
+	wipe(path)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// wipe overwrites a file's contents with zeros and flushes them, so the
+// data does not survive in freed blocks of a disk-backed filesystem
+func wipe(path string) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	zeros := make([]byte, 32*1024)
+	for left := info.Size(); left > 0; {
+		n := int64(len(zeros))
+		if left < n {
+			n = left
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return
+		}
+		left -= n
+	}
+	f.Sync()
+}
+
+// Default is the per-run directory of the process
+var Default = New("")
+
+// Create creates a file in the default directory
+func Create(pattern string) (*os.File, error) {
+	return Default.Create(pattern)
+}
+
+// Path reserves a path in the default directory
+func Path(pattern string) (string, error) {
+	return Default.Path(pattern)
+}
+
+// Cleanup cleans up the default directory
+func Cleanup() error {
+	return Default.Cleanup()
+}
+
+// HandleSignals cleans up the default directory on SIGINT and SIGTERM
+func HandleSignals() {
+	Default.HandleSignals()
+}
+
+// StopSignals stops cleaning up the default directory on signals
+func StopSignals() {
+	Default.StopSignals()
+}
@@ -0,0 +1,135 @@
+package tmpfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestCreateAndCleanup(t *testing.T) {
+	root := t.TempDir()
+	d := New(root)
+
+	f, err := d.Create("note-*.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.WriteString("secret")
+	f.Close()
+	path, err := d.Path("vault-*.db")
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected Path to leave no file behind, got %v", err)
+	}
+	os.WriteFile(path+"-journal", []byte("side file"), 0600)
+
+	dir := filepath.Dir(f.Name())
+	if filepath.Dir(dir) != root || filepath.Dir(path) != dir {
+		t.Errorf("Expected all files in one directory under %s, got %s and %s", root, f.Name(), path)
+	}
+	// Windows has no permission bits; the directory inherits the ACL of
+	// the user's temp directory instead
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0700 {
+		t.Fatalf("Expected a 0700 directory, got %v", info.Mode())
+	}
+
+	if err := d.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory to be removed, got %v", err)
+	}
+	if _, err := d.Create("late-*"); err == nil {
+		t.Error("Expected Create to fail after Cleanup")
+	}
+}
+
+func TestRemoveWipes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(path, []byte("hunter2"), 0600)
+
+	// Keep a handle open so the wiped contents can still be read
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := Remove(path); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed, got %v", err)
+	}
+	data := make([]byte, 7)
+	f.Read(data)
+	if string(data) != "\x00\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("Expected the contents to be overwritten, got %q", data)
+	}
+	if err := Remove(path); err != nil {
+		t.Errorf("Expected removing a missing file to succeed, got %v", err)
+	}
+}
+
+func TestSignalCleansUp(t *testing.T) {
+	d := New(t.TempDir())
+	f, err := d.Create("note-*.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.Close()
+
+	signals := make(chan os.Signal, 1)
+	status := -1
+	signals <- syscall.SIGTERM
+	d.handle(signals, func(code int) { status = code })
+
+	if status != 143 {
+		t.Errorf("Expected exit status 143, got %d", status)
+	}
+	if _, err := os.Stat(filepath.Dir(f.Name())); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory to be removed on a signal, got %v", err)
+	}
+}
+
+func TestRootOverride(t *testing.T) {
+	t.Setenv(EnvDir, "/custom/tmp")
+	if got := Root(); got != "/custom/tmp" {
+		t.Errorf("Root() = %q, want /custom/tmp", got)
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"pm-run-1001-abc", "pm-run-1002-def", "pm-run-junk", "other"} {
+		os.Mkdir(filepath.Join(root, name), 0700)
+	}
+	os.WriteFile(filepath.Join(root, "pm-run-1001-abc", "pm-vault-1.db"), []byte("gmail"), 0600)
+	own := New(root)
+	if _, err := own.Create("note-*"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// 1001 is gone, 1002 still runs
+	removed, err := removeStale(root, func(pid int) bool { return pid == 1002 })
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected 1 directory removed, got %d, %v", removed, err)
+	}
+	entries, _ := os.ReadDir(root)
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	if len(left) != 4 || left[0] != "other" || left[1] != "pm-run-1002-def" {
+		t.Errorf("Expected only the directory of 1001 removed, left %v", left)
+	}
+	own.Cleanup()
+}
@@ -0,0 +1,192 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported HMAC algorithms, named as in otpauth URIs
+const (
+	SHA1   = "SHA1"
+	SHA256 = "SHA256"
+	SHA512 = "SHA512"
+)
+
+// Defaults of RFC 6238 and of otpauth URIs that leave a parameter out
+const (
+	DefaultAlgorithm = SHA1
+	DefaultDigits    = 6
+	DefaultPeriod    = 30
+)
+
+// minSecretBytes is the shortest shared secret accepted: 80 bits, what
+// most providers issue
+const minSecretBytes = 10
+
+// Params are the TOTP settings of one entry. Zero fields take the
+// defaults when validated.
+type Params struct {
+	// Secret is the shared secret in base32, without padding
+	Secret    string `json:"secret"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"`
+}
+
+// ParseURI reads the parameters of an otpauth://totp/ URI
+func ParseURI(uri string) (*Params, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		return nil, fmt.Errorf("invalid otpauth URI: expected otpauth://totp/")
+	}
+
+	query := u.Query()
+	p := &Params{Secret: query.Get("secret"), Algorithm: query.Get("algorithm")}
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"digits", &p.Digits}, {"period", &p.Period}} {
+		if s := query.Get(field.name); s != "" {
+			if *field.value, err = strconv.Atoi(s); err != nil {
+				return nil, fmt.Errorf("invalid otpauth URI: %s must be a number", field.name)
+			}
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate fills in defaults, normalizes the secret and algorithm, and
+// rejects parameters no authenticator could use
+func (p *Params) Validate() error {
+	if p.Algorithm == "" {
+		p.Algorithm = DefaultAlgorithm
+	}
+	p.Algorithm = strings.ToUpper(strings.ReplaceAll(p.Algorithm, "-", ""))
+	if p.Digits == 0 {
+		p.Digits = DefaultDigits
+	}
+	if p.Period == 0 {
+		p.Period = DefaultPeriod
+	}
+
+	switch p.Algorithm {
+	case SHA1, SHA256, SHA512:
+	default:
+		return fmt.Errorf("unsupported TOTP algorithm %q (supported: SHA1, SHA256, SHA512)", p.Algorithm)
+	}
+	if p.Digits < 6 || p.Digits > 8 {
+		return fmt.Errorf("TOTP digits must be 6, 7 or 8, got %d", p.Digits)
+	}
+	if p.Period < 15 || p.Period > 300 {
+		return fmt.Errorf("TOTP period must be between 15 and 300 seconds, got %d", p.Period)
+	}
+
+	p.Secret = strings.ToUpper(strings.TrimRight(strings.Join(strings.Fields(p.Secret), ""), "="))
+	key, err := p.key()
+	if err != nil {
+		return err
+	}
+	if len(key) < minSecretBytes {
+		return fmt.Errorf("TOTP secret is too short: %d bits, need at least %d", len(key)*8, minSecretBytes*8)
+	}
+	return nil
+}
+
+func (p *Params) key() ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(p.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("TOTP secret is not valid base32")
+	}
+	return key, nil
+}
+
+func (p *Params) hash() func() hash.Hash {
+	switch p.Algorithm {
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	}
+	return sha1.New
+}
+
+// Step returns the time step t falls in
+func (p *Params) Step(t time.Time) int64 {
+	return t.Unix() / int64(p.Period)
+}
+
+// Remaining returns how long the code for t stays valid
+func (p *Params) Remaining(t time.Time) time.Duration {
+	next := time.Unix((p.Step(t)+1)*int64(p.Period), 0)
+	return next.Sub(t)
+}
+
+// Code returns the code for time t
+func (p *Params) Code(t time.Time) (string, error) {
+	return p.codeAt(p.Step(t))
+}
+
+// codeAt computes the HOTP value of RFC 4226 for a time step
+func (p *Params) codeAt(step int64) (string, error) {
+	key, err := p.key()
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(p.hash(), key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < p.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", p.Digits, value%modulus), nil
+}
+
+// Verify checks code against the steps from window before t to window
+// after it. It returns the drift of the matching step from t's, negative
+// when the code is from an earlier step, and whether any matched.
+func (p *Params) Verify(code string, t time.Time, window int) (int, bool, error) {
+	code = strings.TrimSpace(code)
+	step := p.Step(t)
+	matched, drift := false, 0
+	// Every step is computed and compared in constant time, so the time
+	// taken does not reveal which one matched
+	for offset := -window; offset <= window; offset++ {
+		want, err := p.codeAt(step + int64(offset))
+		if err != nil {
+			return 0, false, err
+		}
+		if hmac.Equal([]byte(want), []byte(code)) && (!matched || abs(offset) < abs(drift)) {
+			matched, drift = true, offset
+		}
+	}
+	return drift, matched, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
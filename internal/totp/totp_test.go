@@ -0,0 +1,121 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func secret(ascii string) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(ascii))
+}
+
+// TestRFC6238Vectors checks the test vectors of RFC 6238, appendix B
+func TestRFC6238Vectors(t *testing.T) {
+	params := map[string]*Params{
+		SHA1:   {Secret: secret("12345678901234567890"), Algorithm: SHA1, Digits: 8},
+		SHA256: {Secret: secret("12345678901234567890123456789012"), Algorithm: SHA256, Digits: 8},
+		SHA512: {Secret: secret("1234567890123456789012345678901234567890123456789012345678901234"), Algorithm: SHA512, Digits: 8},
+	}
+	vectors := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+		{1111111109, map[string]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+		{1111111111, map[string]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+		{1234567890, map[string]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+		{2000000000, map[string]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+		{20000000000, map[string]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+	}
+
+	for algorithm, p := range params {
+		if err := p.Validate(); err != nil {
+			t.Fatalf("Validate(%s) failed: %v", algorithm, err)
+		}
+		for _, v := range vectors {
+			got, err := p.Code(time.Unix(v.unix, 0))
+			if err != nil {
+				t.Fatalf("Code failed: %v", err)
+			}
+			if got != v.want[algorithm] {
+				t.Errorf("%s at %d: got %s, want %s", algorithm, v.unix, got, v.want[algorithm])
+			}
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	p, err := ParseURI("otpauth://totp/Example:alice@example.com?secret=jbswy3dpehpk3pxp&issuer=Example&algorithm=SHA256&digits=8&period=60")
+	if err != nil {
+		t.Fatalf("ParseURI failed: %v", err)
+	}
+	want := Params{Secret: "JBSWY3DPEHPK3PXP", Algorithm: SHA256, Digits: 8, Period: 60}
+	if *p != want {
+		t.Errorf("ParseURI = %+v, want %+v", *p, want)
+	}
+
+	p, err = ParseURI("otpauth://totp/x?secret=JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("ParseURI failed: %v", err)
+	}
+	if p.Algorithm != SHA1 || p.Digits != 6 || p.Period != 30 {
+		t.Errorf("Expected the defaults, got %+v", *p)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	for _, tt := range []struct {
+		params Params
+		want   string
+	}{
+		{Params{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "MD5"}, "algorithm"},
+		{Params{Secret: "JBSWY3DPEHPK3PXP", Digits: 9}, "digits"},
+		{Params{Secret: "JBSWY3DPEHPK3PXP", Digits: 4}, "digits"},
+		{Params{Secret: "JBSWY3DPEHPK3PXP", Period: 5}, "period"},
+		{Params{Secret: "JBSWY3DPEHPK3PXP", Period: 3600}, "period"},
+		{Params{Secret: "not base32!"}, "base32"},
+		{Params{Secret: "JBSWY3DP"}, "too short"},
+	} {
+		p := tt.params
+		if err := p.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%+v) = %v, want an error about %s", tt.params, err, tt.want)
+		}
+	}
+
+	for _, uri := range []string{
+		"https://totp/x?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://hotp/x?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&digits=six",
+		"otpauth://totp/x",
+	} {
+		if _, err := ParseURI(uri); err == nil {
+			t.Errorf("Expected ParseURI(%q) to fail", uri)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := &Params{Secret: secret("12345678901234567890"), Period: 60}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	now := time.Unix(1234567890, 0)
+
+	for _, drift := range []int{-1, 0, 1} {
+		code, _ := p.Code(now.Add(time.Duration(drift*p.Period) * time.Second))
+		got, ok, err := p.Verify(code, now, 1)
+		if err != nil || !ok || got != drift {
+			t.Errorf("Verify of a code %d steps off = %d, %t, %v", drift, got, ok, err)
+		}
+	}
+
+	code, _ := p.Code(now.Add(2 * time.Duration(p.Period) * time.Second))
+	if _, ok, _ := p.Verify(code, now, 1); ok {
+		t.Error("Expected a code two steps ahead to fail")
+	}
+	if p.Remaining(time.Unix(1234567890, 0)) != 30*time.Second {
+		t.Errorf("Remaining = %v, want 30s", p.Remaining(time.Unix(1234567890, 0)))
+	}
+}
@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"unicode/utf8"
+)
+
+// ANSI foreground color codes by name
+var colorCodes = map[string]string{
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+}
+
+// hashPalette is used for tags without an explicit style. Gray and white
+// are left out so hashed chips stay distinguishable from plain text.
+var hashPalette = []string{"red", "green", "yellow", "blue", "magenta", "cyan"}
+
+// ColorNames returns the supported color names, sorted
+func ColorNames() []string {
+	names := make([]string, 0, len(colorCodes))
+	for name := range colorCodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidColor reports whether name is a supported color
+func ValidColor(name string) bool {
+	_, ok := colorCodes[name]
+	return ok
+}
+
+// ValidIcon reports whether icon is a single printable character
+func ValidIcon(icon string) bool {
+	if utf8.RuneCountInString(icon) != 1 {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(icon)
+	return r > ' ' && r != utf8.RuneError
+}
+
+// HashColor picks a deterministic color for a tag from its name, so
+// unstyled tags still look different from each other
+func HashColor(tag string) string {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	return hashPalette[h.Sum32()%uint32(len(hashPalette))]
+}
+
+// ColorEnabled reports whether output to stdout should be colored: it must
+// be a terminal, NO_COLOR must be unset and accessible mode must be off
+func ColorEnabled(a11y bool) bool {
+	return ColorEnabledOn(os.Stdout, a11y)
+}
+
+// ColorEnabledOn is ColorEnabled for output to file, such as stderr
+func ColorEnabledOn(file *os.File, a11y bool) bool {
+	if a11y {
+		return false
+	}
+	if _, set := os.LookupEnv("NO_COLOR"); set {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Colorize wraps text in the ANSI sequence for color
+func Colorize(text, color string) string {
+	code, ok := colorCodes[color]
+	if !ok {
+		return text
+	}
+	return fmt.Sprintf("\x1b[%sm%s\x1b[0m", code, text)
+}
+
+// TagChip renders a tag for list output. With color enabled the tag is
+// shown in its style color (or a hashed one when color is empty) prefixed
+// by its icon; otherwise it is plain text so screen readers and pipes get
+// just the name.
+func TagChip(tag, color, icon string, enabled bool) string {
+	if !enabled {
+		return tag
+	}
+
+	text := tag
+	if icon != "" {
+		text = icon + " " + tag
+	}
+	if color == "" {
+		color = HashColor(tag)
+	}
+	return Colorize(text, color)
+}
@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashColorDeterministic(t *testing.T) {
+	for _, tag := range []string{"work", "personal", "infra", "ünïcode"} {
+		first := HashColor(tag)
+		for i := 0; i < 10; i++ {
+			if HashColor(tag) != first {
+				t.Errorf("HashColor(%q) is not deterministic", tag)
+			}
+		}
+		if !ValidColor(first) {
+			t.Errorf("HashColor(%q) returned unknown color %q", tag, first)
+		}
+	}
+}
+
+func TestHashColorSpread(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, tag := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		seen[HashColor(tag)] = true
+	}
+	if len(seen) < 3 {
+		t.Errorf("Expected hashed colors to spread over the palette, got %v", seen)
+	}
+}
+
+func TestTagChip(t *testing.T) {
+	chip := TagChip("work", "blue", "W", true)
+	if chip != "\x1b[34mW work\x1b[0m" {
+		t.Errorf("Unexpected chip %q", chip)
+	}
+
+	// Unstyled tags get their hashed color
+	chip = TagChip("misc", "", "", true)
+	if !strings.HasPrefix(chip, "\x1b[") || !strings.Contains(chip, "misc") {
+		t.Errorf("Expected hashed color chip, got %q", chip)
+	}
+
+	// Without color the chip is just the tag name, icon included
+	if chip := TagChip("work", "blue", "W", false); chip != "work" {
+		t.Errorf("Expected plain chip, got %q", chip)
+	}
+}
+
+func TestColorEnabledRespectsNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(false) {
+		t.Error("Expected NO_COLOR to disable color")
+	}
+}
+
+func TestColorEnabledRespectsA11y(t *testing.T) {
+	if ColorEnabled(true) {
+		t.Error("Expected accessible mode to disable color")
+	}
+}
+
+func TestValidIcon(t *testing.T) {
+	valid := []string{"W", "🔑", "é"}
+	invalid := []string{"", "WW", " ", "\n"}
+	for _, icon := range valid {
+		if !ValidIcon(icon) {
+			t.Errorf("Expected %q to be a valid icon", icon)
+		}
+	}
+	for _, icon := range invalid {
+		if ValidIcon(icon) {
+			t.Errorf("Expected %q to be an invalid icon", icon)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrAborted is returned when the user quits conflict resolution
+var ErrAborted = errors.New("conflict resolution aborted")
+
+// Action is what to do with a conflicting entry
+type Action int
+
+const (
+	// Keep leaves the stored entry as it is
+	Keep Action = iota
+	// Take replaces the stored entry with the incoming one
+	Take
+	// Merge combines the two, choosing each differing field
+	Merge
+	// Skip leaves the stored entry alone and reports the entry as skipped
+	Skip
+)
+
+func (a Action) String() string {
+	switch a {
+	case Take:
+		return "take incoming"
+	case Merge:
+		return "merge"
+	case Skip:
+		return "skip"
+	}
+	return "keep"
+}
+
+// ConflictField is one row of a comparison. Secrets are passed in already
+// masked, as a fingerprint and strength, never in the clear.
+type ConflictField struct {
+	Name     string
+	Existing string
+	Incoming string
+}
+
+// Differs reports whether the two sides of the field differ
+func (f ConflictField) Differs() bool {
+	return f.Existing != f.Incoming
+}
+
+// Conflict is a stored entry and an incoming one of the same name
+type Conflict struct {
+	Name   string
+	Fields []ConflictField
+}
+
+// Resolution is the choice made for a conflict. For Merge, TakeField
+// holds for each field whether the incoming value is used.
+type Resolution struct {
+	Action    Action
+	TakeField []bool
+}
+
+// maxColumnWidth bounds each side of the comparison
+const maxColumnWidth = 32
+
+// RenderConflict writes the fields of c side by side, marking the rows
+// that differ with *
+func RenderConflict(w io.Writer, c *Conflict) {
+	nameWidth, existingWidth := len("Field"), len("Existing")
+	for _, f := range c.Fields {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(f.Name))
+		existingWidth = max(existingWidth, utf8.RuneCountInString(truncate(f.Existing)))
+	}
+
+	fmt.Fprintf(w, "Conflict: %s\n", c.Name)
+	fmt.Fprintf(w, "  %s  %s  Incoming\n", pad("Field", nameWidth), pad("Existing", existingWidth))
+	for _, f := range c.Fields {
+		marker := " "
+		if f.Differs() {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %s  %s  %s\n", marker, pad(f.Name, nameWidth), pad(truncate(f.Existing), existingWidth), truncate(f.Incoming))
+	}
+}
+
+func pad(s string, width int) string {
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
+
+// truncate shortens a value to one line of at most maxColumnWidth runes
+func truncate(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + "…"
+	}
+	if utf8.RuneCountInString(s) > maxColumnWidth {
+		s = string([]rune(s)[:maxColumnWidth-1]) + "…"
+	}
+	return s
+}
+
+// Resolver asks how to resolve each conflict. With single keypresses the
+// caller puts the terminal in raw mode; otherwise, as on dumb terminals,
+// it falls back to numbered prompts answered with a line each.
+type Resolver struct {
+	in   *bufio.Reader
+	out  io.Writer
+	keys bool
+	// all is the action chosen for every remaining conflict, if any
+	all *Action
+}
+
+// NewResolver reads answers from in and writes prompts to out. keys
+// selects keypresses over numbered prompts.
+func NewResolver(in io.Reader, out io.Writer, keys bool) *Resolver {
+	if keys {
+		out = &crlfWriter{out}
+	}
+	return &Resolver{in: bufio.NewReader(in), out: out, keys: keys}
+}
+
+// DumbTerminal reports whether the terminal cannot be driven with single
+// keypresses
+func DumbTerminal() bool {
+	t := os.Getenv("TERM")
+	return t == "" || t == "dumb"
+}
+
+// choice is one answer to a prompt
+type choice struct {
+	key    byte
+	label  string
+	action Action
+}
+
+var conflictChoices = []choice{
+	{'k', "keep existing", Keep},
+	{'t', "take incoming", Take},
+	{'m', "merge field by field", Merge},
+	{'s', "skip", Skip},
+}
+
+// applyAll is the pseudo-action of the "apply to all remaining" answer
+const applyAll Action = -1
+
+// Resolve shows c and asks what to do with it, unless an earlier answer
+// applies to all remaining conflicts
+func (r *Resolver) Resolve(c *Conflict) (*Resolution, error) {
+	if r.all != nil {
+		return &Resolution{Action: *r.all}, nil
+	}
+
+	RenderConflict(r.out, c)
+	choices := append(append([]choice{}, conflictChoices...), choice{'a', "apply a choice to all remaining", applyAll})
+	action, err := r.ask("Resolve", choices)
+	if err != nil {
+		return nil, err
+	}
+	if action == applyAll {
+		// Merging needs a decision per field, so it cannot apply to all
+		all := []choice{conflictChoices[0], conflictChoices[1], conflictChoices[3]}
+		if action, err = r.ask("For this and all remaining conflicts", all); err != nil {
+			return nil, err
+		}
+		r.all = &action
+	}
+	if action != Merge {
+		return &Resolution{Action: action}, nil
+	}
+
+	resolution := &Resolution{Action: Merge, TakeField: make([]bool, len(c.Fields))}
+	for i, f := range c.Fields {
+		if !f.Differs() {
+			continue
+		}
+		fieldChoices := []choice{
+			{'e', "existing: " + truncate(f.Existing), Keep},
+			{'i', "incoming: " + truncate(f.Incoming), Take},
+		}
+		pick, err := r.ask(f.Name, fieldChoices)
+		if err != nil {
+			return nil, err
+		}
+		resolution.TakeField[i] = pick == Take
+	}
+	return resolution, nil
+}
+
+// Option is an answer Choose offers, picked by its key
+type Option struct {
+	Key   byte
+	Label string
+}
+
+// Choose asks label, offering options, and returns the key of the one
+// picked, as Resolve asks about conflicts. q, Ctrl-C, Ctrl-D and the end
+// of input give ErrAborted.
+func (r *Resolver) Choose(label string, options []Option) (byte, error) {
+	choices := make([]choice, len(options))
+	for i, o := range options {
+		choices[i] = choice{o.Key, o.Label, Action(i)}
+	}
+	picked, err := r.ask(label, choices)
+	if err != nil {
+		return 0, err
+	}
+	return options[picked].Key, nil
+}
+
+// ask prompts until one of choices is picked. q, Ctrl-C, Ctrl-D and the
+// end of input abort.
+func (r *Resolver) ask(label string, choices []choice) (Action, error) {
+	for {
+		if r.keys {
+			var keys []string
+			for _, c := range choices {
+				keys = append(keys, fmt.Sprintf("%c) %s", c.key, c.label))
+			}
+			fmt.Fprintf(r.out, "%s: %s, q) quit? ", label, strings.Join(keys, ", "))
+			key, err := r.readKey()
+			if err != nil {
+				return 0, err
+			}
+			fmt.Fprintf(r.out, "%c\n", key)
+			for _, c := range choices {
+				if key == c.key {
+					return c.action, nil
+				}
+			}
+			continue
+		}
+
+		fmt.Fprintf(r.out, "%s:\n", label)
+		for i, c := range choices {
+			fmt.Fprintf(r.out, "  %d) %s\n", i+1, c.label)
+		}
+		fmt.Fprintf(r.out, "  q) quit\nChoice: ")
+		line, err := r.in.ReadString('\n')
+		if err != nil && line == "" {
+			return 0, ErrAborted
+		}
+		line = strings.TrimSpace(line)
+		if line == "q" {
+			return 0, ErrAborted
+		}
+		if n, convErr := strconv.Atoi(line); convErr == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1].action, nil
+		}
+		fmt.Fprintf(r.out, "Enter a number from 1 to %d.\n", len(choices))
+	}
+}
+
+// readKey reads one keypress, ignoring line endings and spaces
+func (r *Resolver) readKey() (byte, error) {
+	for {
+		key, err := r.in.ReadByte()
+		if err != nil {
+			return 0, ErrAborted
+		}
+		switch key {
+		case '\r', '\n', ' ':
+			continue
+		case 'q', 3, 4: // q, Ctrl-C, Ctrl-D
+			return 0, ErrAborted
+		}
+		return key, nil
+	}
+}
+
+// crlfWriter turns \n into \r\n, which a terminal in raw mode needs to
+// return to the first column
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write([]byte(strings.ReplaceAll(string(p), "\n", "\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
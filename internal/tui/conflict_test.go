@@ -0,0 +1,126 @@
+package tui
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testConflict(name string) *Conflict {
+	return &Conflict{Name: name, Fields: []ConflictField{
+		{Name: "username", Existing: "alice", Incoming: "alice"},
+		{Name: "password", Existing: "#1a2b3c4d, Strong", Incoming: "#5e6f7a8b, Weak"},
+		{Name: "url", Existing: "https://old.example", Incoming: "https://new.example"},
+	}}
+}
+
+func TestRenderConflict(t *testing.T) {
+	var out bytes.Buffer
+	RenderConflict(&out, testConflict("bank"))
+	want := "Conflict: bank\n" +
+		"  Field     Existing             Incoming\n" +
+		"  username  alice                alice\n" +
+		"* password  #1a2b3c4d, Strong    #5e6f7a8b, Weak\n" +
+		"* url       https://old.example  https://new.example\n"
+	if out.String() != want {
+		t.Errorf("Unexpected comparison:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestResolverKeys(t *testing.T) {
+	// keep, take, merge taking the url only, an unknown key, skip, then
+	// take for all remaining
+	var out bytes.Buffer
+	r := NewResolver(strings.NewReader("kt\r\nmeixsat"), &out, true)
+
+	want := []Resolution{
+		{Action: Keep},
+		{Action: Take},
+		{Action: Merge, TakeField: []bool{false, false, true}},
+		{Action: Skip},
+		{Action: Take},
+		{Action: Take},
+	}
+	for i, w := range want {
+		got, err := r.Resolve(testConflict("entry"))
+		if err != nil {
+			t.Fatalf("Resolve %d failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(*got, w) {
+			t.Errorf("Resolve %d = %+v, want %+v", i, *got, w)
+		}
+	}
+	if strings.Contains(strings.ReplaceAll(out.String(), "\r\n", ""), "\n") {
+		t.Error("Expected every newline to be written as \\r\\n in raw mode")
+	}
+}
+
+func TestResolverNumbered(t *testing.T) {
+	var out bytes.Buffer
+	r := NewResolver(strings.NewReader("3\n2\n1\n9\nkeep\n4\n5\n1\n"), &out, false)
+
+	want := []Resolution{
+		{Action: Merge, TakeField: []bool{false, true, false}},
+		{Action: Skip},
+		{Action: Keep},
+		{Action: Keep},
+	}
+	for i, w := range want {
+		got, err := r.Resolve(testConflict("entry"))
+		if err != nil {
+			t.Fatalf("Resolve %d failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(*got, w) {
+			t.Errorf("Resolve %d = %+v, want %+v", i, *got, w)
+		}
+	}
+	if !strings.Contains(out.String(), "Enter a number from 1 to 5.") {
+		t.Errorf("Expected invalid answers to be asked again, got:\n%s", out.String())
+	}
+}
+
+func TestResolverChoose(t *testing.T) {
+	options := []Option{{'m', "move"}, {'s', "skip"}}
+	for _, tt := range []struct {
+		input string
+		keys  bool
+		want  byte
+	}{
+		{"xs", true, 's'},
+		{"\rm", true, 'm'},
+		{"3\n1\n", false, 'm'},
+		{"2\n", false, 's'},
+	} {
+		var out bytes.Buffer
+		r := NewResolver(strings.NewReader(tt.input), &out, tt.keys)
+		if got, err := r.Choose("'ci' notes", options); err != nil || got != tt.want {
+			t.Errorf("%q: got %c, %v; want %c", tt.input, got, err, tt.want)
+		}
+		if !strings.Contains(out.String(), "'ci' notes") {
+			t.Errorf("%q: expected the label in %q", tt.input, out.String())
+		}
+	}
+	r := NewResolver(strings.NewReader("q"), &bytes.Buffer{}, true)
+	if _, err := r.Choose("label", options); err != ErrAborted {
+		t.Errorf("Expected ErrAborted, got %v", err)
+	}
+}
+
+func TestResolverAbort(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		keys  bool
+	}{
+		{"q", true},
+		{"\x03", true},
+		{"m", true},
+		{"q\n", false},
+		{"", false},
+	} {
+		r := NewResolver(strings.NewReader(tt.input), &bytes.Buffer{}, tt.keys)
+		if _, err := r.Resolve(testConflict("entry")); err != ErrAborted {
+			t.Errorf("%q: expected ErrAborted, got %v", tt.input, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HistoryLimit is how many lines a History keeps; the oldest go first
+const HistoryLimit = 1000
+
+// History is the command history of a LineEditor, kept in a file readable
+// by its owner only. Lines its filter turns down, such as those giving a
+// password, are never recorded.
+type History struct {
+	path  string
+	keep  func(line string) bool
+	lines []string
+}
+
+// LoadHistory reads the history in the file at path, which need not
+// exist yet. keep decides which lines are recorded; lines in the file it
+// turns down, as written before a rule was added, are dropped too. An
+// empty path keeps the history in memory only.
+func LoadHistory(path string, keep func(line string) bool) (*History, error) {
+	h := &History{path: path, keep: keep}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && h.keeps(line) {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if len(h.lines) > HistoryLimit {
+		h.lines = h.lines[len(h.lines)-HistoryLimit:]
+	}
+	return h, nil
+}
+
+// Lines returns the recorded lines, oldest first
+func (h *History) Lines() []string {
+	return h.lines
+}
+
+// Add records line, unless it is blank, repeats the line recorded last or
+// is turned down by the filter, and writes the history out
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") || !h.keeps(line) {
+		return nil
+	}
+	if n := len(h.lines); n > 0 && h.lines[n-1] == line {
+		return nil
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > HistoryLimit {
+		h.lines = append(h.lines[:0], h.lines[len(h.lines)-HistoryLimit:]...)
+	}
+	return h.save()
+}
+
+// Clear forgets every line and empties the file
+func (h *History) Clear() error {
+	h.lines = nil
+	return h.save()
+}
+
+// keeps reports whether the filter lets line be recorded
+func (h *History) keeps(line string) bool {
+	return h.keep == nil || h.keep(line)
+}
+
+// save replaces the file with the recorded lines. The file is written
+// next to it and renamed into place, so it is never left half-written,
+// and is created readable by its owner only.
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	var data strings.Builder
+	for _, line := range h.lines {
+		data.WriteString(line)
+		data.WriteByte('\n')
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data.String()), 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	// A file left over with wider permissions keeps them through WriteFile
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
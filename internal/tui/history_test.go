@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history")
+	noSecrets := func(line string) bool { return !strings.Contains(line, "--password") }
+
+	h, err := LoadHistory(path, noSecrets)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	for _, line := range []string{"list --tag work", "save x --password hunter2", "", "  ", "list --tag work", "get bank"} {
+		if err := h.Add(line); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	want := []string{"list --tag work", "get bank"}
+	if !reflect.DeepEqual(h.Lines(), want) {
+		t.Errorf("Expected %q, got %q", want, h.Lines())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "list --tag work\nget bank\n" {
+		t.Errorf("Unexpected history file %q", data)
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	// Lines the filter turns down are dropped when the file is read, and
+	// a file with wider permissions is narrowed when written
+	if err := os.WriteFile(path, []byte("get bank\nsave y --password=pw\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(path, 0644)
+	if h, err = LoadHistory(path, noSecrets); err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if !reflect.DeepEqual(h.Lines(), []string{"get bank"}) {
+		t.Errorf("Expected the secret line to be dropped, got %q", h.Lines())
+	}
+	h.Add("stats")
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 after writing, got %v", info.Mode().Perm())
+	}
+
+	if err := h.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 || len(h.Lines()) != 0 {
+		t.Errorf("Expected an empty history, got %q and %q", data, h.Lines())
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, _ := LoadHistory(path, nil)
+	for i := 0; i < HistoryLimit+10; i++ {
+		h.Add(fmt.Sprintf("get entry%d", i))
+	}
+	lines := h.Lines()
+	if len(lines) != HistoryLimit || lines[0] != "get entry10" || lines[len(lines)-1] != fmt.Sprintf("get entry%d", HistoryLimit+9) {
+		t.Errorf("Expected the newest %d lines, got %d from %q", HistoryLimit, len(lines), lines[0])
+	}
+	if h, _ = LoadHistory(path, nil); len(h.Lines()) != HistoryLimit {
+		t.Errorf("Expected %d lines read back, got %d", HistoryLimit, len(h.Lines()))
+	}
+}
@@ -0,0 +1,85 @@
+package tui
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/runenames"
+	"golang.org/x/text/width"
+)
+
+// iconCells is how many terminal columns an entry icon takes, so names
+// line up whether the icon is a narrow glyph or a double-width emoji
+const iconCells = 2
+
+// fallbackGlyphs are the icons of entries without one of their own. They
+// are narrow symbols, so they cannot be mistaken for a chosen emoji.
+var fallbackGlyphs = []string{"◆", "●", "▲", "■", "★", "♦", "♣", "♠", "♥", "◉", "▼", "✚"}
+
+// Width returns how many terminal columns s takes: two for wide and
+// fullwidth characters such as most emoji, none for combining marks and
+// other zero-width characters, and one for the rest
+func Width(s string) int {
+	cells := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Variation_Selector):
+		case isWide(r):
+			cells += 2
+		default:
+			cells++
+		}
+	}
+	return cells
+}
+
+func isWide(r rune) bool {
+	kind := width.LookupRune(r).Kind()
+	return kind == width.EastAsianWide || kind == width.EastAsianFullwidth
+}
+
+// FallbackIcon picks a deterministic glyph for an entry from its name, so
+// entries without an icon still look different from each other
+func FallbackIcon(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fallbackGlyphs[h.Sum32()%uint32(len(fallbackGlyphs))]
+}
+
+// ShortCode names an icon in words for plain output, e.g. "[key]" for 🔑
+func ShortCode(icon string) string {
+	r, _ := utf8.DecodeRuneInString(icon)
+	name := runenames.Name(r)
+	if name == "" {
+		return fmt.Sprintf("[U+%04X]", r)
+	}
+	return "[" + strings.ReplaceAll(strings.ToLower(name), " ", "-") + "]"
+}
+
+// EntryIcon renders the icon of an entry for the start of a listing line,
+// followed by a space. With color enabled the icon, or the fallback glyph
+// of the name in the name's hashed color, is padded to a fixed width;
+// otherwise a set icon becomes its short code and the fallback is left out
+// so screen readers and pipes are not given noise.
+func EntryIcon(name, icon string, enabled bool) string {
+	if !enabled {
+		if icon == "" {
+			return ""
+		}
+		return ShortCode(icon) + " "
+	}
+
+	padding := ""
+	if w := Width(icon); icon != "" && w < iconCells {
+		padding = strings.Repeat(" ", iconCells-w)
+	}
+	if icon == "" {
+		glyph := FallbackIcon(name)
+		icon = Colorize(glyph, HashColor(name))
+		padding = strings.Repeat(" ", iconCells-Width(glyph))
+	}
+	return icon + padding + " "
+}
@@ -0,0 +1,61 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"a", 1},
+		{"◆", 1},
+		{"🔑", 2},
+		{"☁️", 1},
+		{"é", 1},
+		{"日本", 4},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := Width(tt.text); got != tt.want {
+			t.Errorf("Width(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestShortCode(t *testing.T) {
+	tests := map[string]string{
+		"🔑": "[key]",
+		"★": "[black-star]",
+		"a": "[latin-small-letter-a]",
+	}
+	for icon, want := range tests {
+		if got := ShortCode(icon); got != want {
+			t.Errorf("ShortCode(%q) = %q, want %q", icon, got, want)
+		}
+	}
+}
+
+func TestEntryIcon(t *testing.T) {
+	// Every icon takes the same number of columns, so names line up
+	for _, icon := range []string{"🔑", "k", ""} {
+		got := EntryIcon("aws-prod", icon, true)
+		plain := strings.NewReplacer("\x1b[31m", "", "\x1b[32m", "", "\x1b[33m", "", "\x1b[34m", "",
+			"\x1b[35m", "", "\x1b[36m", "", "\x1b[0m", "").Replace(got)
+		if Width(plain) != iconCells+1 {
+			t.Errorf("EntryIcon(%q) = %q, %d columns wide", icon, got, Width(plain))
+		}
+	}
+
+	if EntryIcon("aws-prod", "", true) != EntryIcon("aws-prod", "", true) {
+		t.Error("Expected the fallback icon to be deterministic")
+	}
+	if got := EntryIcon("aws-prod", "🔑", false); got != "[key] " {
+		t.Errorf("EntryIcon without color = %q, want %q", got, "[key] ")
+	}
+	if got := EntryIcon("aws-prod", "", false); got != "" {
+		t.Errorf("Expected no fallback icon without color, got %q", got)
+	}
+}
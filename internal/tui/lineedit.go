@@ -0,0 +1,320 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// Keys the line editor acts on
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlG     = 0x07
+	keyBackspace = 0x08
+	keyCtrlK     = 0x0b
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlR     = 0x12
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+
+	// Cursor keys arrive as escape sequences and are given codes past
+	// the runes the editor inserts
+	keyUp rune = unicode.MaxRune + 1 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// LineEditor reads lines typed at a terminal in raw mode, as readline
+// does: the cursor keys and Ctrl-A, Ctrl-E, Ctrl-U, Ctrl-K and Ctrl-W
+// edit the line, up and down walk the history, and Ctrl-R searches it
+// backwards. The caller puts the terminal in raw mode and adds the lines
+// worth keeping to the history.
+type LineEditor struct {
+	in      io.RuneReader
+	out     io.Writer
+	history *History
+}
+
+// NewLineEditor returns a line editor reading keys from in and drawing
+// the line on out. history may be nil.
+func NewLineEditor(in io.RuneReader, out io.Writer, history *History) *LineEditor {
+	return &LineEditor{in: in, out: out, history: history}
+}
+
+// editState is the line being edited
+type editState struct {
+	prompt string
+	buf    []rune
+	pos    int
+	// recalled is the history line shown, len(lines) for the line being
+	// typed, which saved holds while another is shown
+	recalled int
+	saved    []rune
+	// searching is set during a Ctrl-R search for query; found is the
+	// history line matching it, -1 for none
+	searching bool
+	query     []rune
+	found     int
+}
+
+// ReadLine shows prompt and returns the line typed once Enter is
+// pressed. Ctrl-C gives ErrInterrupted, and Ctrl-D on an empty line
+// io.EOF. An error reading the keys is returned with what was typed so
+// far.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	var lines []string
+	if e.history != nil {
+		lines = e.history.Lines()
+	}
+	s := &editState{prompt: prompt, recalled: len(lines)}
+	e.draw(s, lines)
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return string(s.buf), err
+		}
+
+		if s.searching {
+			done := e.search(s, lines, key)
+			if !done {
+				e.draw(s, lines)
+				continue
+			}
+			// Any key but Ctrl-G takes the line found and is then handled
+			// like it is outside a search
+			e.draw(s, lines)
+			if key == keyCtrlG {
+				continue
+			}
+		}
+
+		switch key {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(s.buf), nil
+		case keyCtrlC:
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case keyDeleteForward:
+			s.deleteAt(s.pos)
+		case keyBackspace, keyDelete:
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case keyCtrlA, keyHome:
+			s.pos = 0
+		case keyCtrlE, keyEnd:
+			s.pos = len(s.buf)
+		case keyCtrlB, keyLeft:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case keyCtrlF, keyRight:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case keyCtrlU:
+			s.buf = append(s.buf[:0], s.buf[s.pos:]...)
+			s.pos = 0
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+		case keyCtrlW:
+			start := s.pos
+			for start > 0 && s.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && s.buf[start-1] != ' ' {
+				start--
+			}
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyUp:
+			s.recall(lines, s.recalled-1)
+		case keyCtrlN, keyDown:
+			s.recall(lines, s.recalled+1)
+		case keyCtrlR:
+			s.searching, s.query, s.found = true, nil, -1
+		default:
+			if key < unicode.MaxRune && unicode.IsPrint(key) {
+				s.buf = append(s.buf[:s.pos], append([]rune{key}, s.buf[s.pos:]...)...)
+				s.pos++
+			}
+		}
+		e.draw(s, lines)
+	}
+}
+
+// search handles key during a Ctrl-R search and reports whether the
+// search is over. Ctrl-R again finds an older match; Ctrl-G gives up and
+// brings back the line from before; any other key ends the search on the
+// line found.
+func (e *LineEditor) search(s *editState, lines []string, key rune) bool {
+	switch {
+	case key == keyCtrlR:
+		if s.found > 0 {
+			s.find(lines, s.found-1)
+		}
+		return false
+	case key == keyBackspace || key == keyDelete:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+			s.find(lines, len(lines)-1)
+		}
+		return false
+	case key < unicode.MaxRune && unicode.IsPrint(key):
+		s.query = append(s.query, key)
+		from := len(lines) - 1
+		if s.found >= 0 {
+			from = s.found
+		}
+		s.find(lines, from)
+		return false
+	}
+
+	s.searching = false
+	if key != keyCtrlG && s.found >= 0 {
+		s.buf = []rune(lines[s.found])
+		s.pos = len(s.buf)
+		s.recalled = s.found
+	}
+	return true
+}
+
+// find sets found to the newest history line from index from back that
+// contains the query, -1 if there is none
+func (s *editState) find(lines []string, from int) {
+	s.found = -1
+	if len(s.query) == 0 {
+		return
+	}
+	for i := from; i >= 0; i-- {
+		if strings.Contains(lines[i], string(s.query)) {
+			s.found = i
+			return
+		}
+	}
+}
+
+// recall shows history line i, or the line being typed for len(lines)
+func (s *editState) recall(lines []string, i int) {
+	if i < 0 || i > len(lines) || i == s.recalled {
+		return
+	}
+	if s.recalled == len(lines) {
+		s.saved = append(s.saved[:0], s.buf...)
+	}
+	if i == len(lines) {
+		s.buf = append([]rune(nil), s.saved...)
+	} else {
+		s.buf = []rune(lines[i])
+	}
+	s.recalled, s.pos = i, len(s.buf)
+}
+
+// deleteAt removes the rune at i, if there is one
+func (s *editState) deleteAt(i int) {
+	if i < len(s.buf) {
+		s.buf = append(s.buf[:i], s.buf[i+1:]...)
+	}
+}
+
+// draw redraws the line and puts the cursor where it is in the line
+func (e *LineEditor) draw(s *editState, lines []string) {
+	if s.searching {
+		match := ""
+		if s.found >= 0 {
+			match = lines[s.found]
+		}
+		label := "reverse-i-search"
+		if s.found < 0 && len(s.query) > 0 {
+			label = "failing reverse-i-search"
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", label, string(s.query), match)
+		return
+	}
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// readKey reads the next key, turning the escape sequences of the cursor
+// keys into their codes
+func (e *LineEditor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+	// CSI sequences carry digits and semicolons before their final byte
+	var params strings.Builder
+	for {
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if (c >= '0' && c <= '9') || c == ';' {
+			params.WriteRune(c)
+			continue
+		}
+		switch c {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		case 'C':
+			return keyRight, nil
+		case 'D':
+			return keyLeft, nil
+		case 'H':
+			return keyHome, nil
+		case 'F':
+			return keyEnd, nil
+		case '~':
+			switch params.String() {
+			case "1", "7":
+				return keyHome, nil
+			case "4", "8":
+				return keyEnd, nil
+			case "3":
+				return keyDeleteForward, nil
+			}
+		}
+		return keyUnknown, nil
+	}
+}
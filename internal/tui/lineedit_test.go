@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readLines reads lines from keys until they run out
+func readLines(t *testing.T, keys string, history *History) ([]string, error) {
+	t.Helper()
+	e := NewLineEditor(strings.NewReader(keys), &bytes.Buffer{}, history)
+	var lines []string
+	for {
+		line, err := e.ReadLine("pm> ")
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+		if history != nil {
+			history.Add(line)
+		}
+	}
+}
+
+func TestLineEditorEditing(t *testing.T) {
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"plain", "list\r", "list"},
+		{"newline", "list\n", "list"},
+		{"backspace", "lisst\x7f\x7ft\r", "list"},
+		{"left and insert", "lst\x1b[D\x1b[Di\r", "list"},
+		{"home and end", "ist\x01l\x05 --long\r", "list --long"},
+		{"home and end keys", "ist\x1b[Hl\x1b[F!\r", "list!"},
+		{"delete forward", "llist\x01\x1b[3~\r", "list"},
+		{"kill to end", "list --long\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", "list"},
+		{"kill to start", "oops list\x01\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x15\r", "list"},
+		{"erase word", "list --tag work\x17\x17work\r", "list work"},
+		{"ctrl-d deletes", "llist\x01\x04\r", "list"},
+		{"tab ignored", "li\tst\r", "list"},
+	}
+	for _, tt := range tests {
+		lines, err := readLines(t, tt.keys, nil)
+		if err != io.EOF || len(lines) != 1 || lines[0] != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, lines, err, tt.want)
+		}
+	}
+}
+
+func TestLineEditorKeys(t *testing.T) {
+	if _, err := readLines(t, "list\x03", nil); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted on Ctrl-C, got %v", err)
+	}
+	if lines, err := readLines(t, "list\r\x04", nil); err != io.EOF || len(lines) != 1 {
+		t.Errorf("Expected io.EOF on Ctrl-D at an empty line, got %q, %v", lines, err)
+	}
+
+	// What was typed comes back with an error reading further
+	e := NewLineEditor(strings.NewReader("lis"), &bytes.Buffer{}, nil)
+	if line, err := e.ReadLine("pm> "); err != io.EOF || line != "lis" {
+		t.Errorf("Expected the partial line with io.EOF, got %q, %v", line, err)
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	history, _ := LoadHistory("", nil)
+	for _, line := range []string{"get bank", "list --tag work", "search mail"} {
+		history.Add(line)
+	}
+
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"up", "\x1b[A\r", "search mail"},
+		{"up twice", "\x1b[A\x1b[A\r", "list --tag work"},
+		{"up past the oldest", "\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\r", "get bank"},
+		{"down back to the typed line", "sta\x1b[A\x1b[A\x1b[B\x1b[Bts\r", "stats"},
+		{"ctrl-p and ctrl-n", "\x10\x10\x0e\r", "search mail"},
+		{"edit a recalled line", "\x1bOA\x17bank\r", "search bank"},
+		{"search", "\x12tag\r", "list --tag work"},
+		{"search older", "\x12a\x12\r", "list --tag work"},
+		{"search then edit", "\x12bank\x05 --show\r", "get bank --show"},
+		{"search backspace", "\x12banz\x7fk\r", "get bank"},
+		{"search cancelled", "typed\x12bank\x07\r", "typed"},
+		{"search failing", "\x12nothing\r", ""},
+	}
+	for _, tt := range tests {
+		history, _ := LoadHistory("", nil)
+		for _, line := range []string{"get bank", "list --tag work", "search mail"} {
+			history.Add(line)
+		}
+		lines, err := readLines(t, tt.keys, history)
+		if err != io.EOF || len(lines) != 1 || lines[0] != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, lines, err, tt.want)
+		}
+	}
+
+	// Lines typed in the session are recalled too
+	lines, _ := readLines(t, "stats\r\x1b[A\x1b[A\r", history)
+	if len(lines) != 2 || lines[1] != "search mail" {
+		t.Errorf("Expected the line before the one typed last, got %q", lines)
+	}
+}